@@ -58,6 +58,17 @@ const (
 	ErrTemplateNotFound                = Error("template not found")
 	ErrMLNxRstNotFound                 = Error("MLNxRet not found")
 	ErrDLNxRstNotFound                 = Error("DLNxRet not found")
+	ErrAuditQueryInvalid               = Error("audit query is invalid")
+	ErrDashboardRevisionNotFound       = Error("dashboard revision not found")
+	ErrAPITokenNotFound                = Error("api token not found")
+	ErrAPITokenExpired                 = Error("api token has expired")
+	ErrHostKeyNotFound                 = Error("host key not found")
+	ErrTerminalProfileNotFound         = Error("terminal profile not found")
+	ErrMaintenanceWindowNotFound       = Error("maintenance window not found")
+	ErrRuleTemplateNotFound            = Error("rule template not found")
+	ErrTerminalRecordingNotFound       = Error("terminal recording not found")
+	ErrSaltJobNotFound                 = Error("salt job not found")
+	ErrRevisionMismatch                = Error("resource has been modified since it was read")
 )
 
 // Error is a domain error encountered while processing CloudHub requests
@@ -67,6 +78,14 @@ func (e Error) Error() string {
 	return string(e)
 }
 
+type contextKey string
+
+// RevisionContextKey is the key of the revision, an int64, a record has to
+// be at for an update of it to succeed. Stores that keep revisions refuse to
+// update records at another revision with ErrRevisionMismatch; without it
+// in the context updates are unconditional.
+const RevisionContextKey = contextKey("revision")
+
 // Logger represents an abstracted structured logging implementation. It
 // provides methods to trigger log messages at various alert levels and a
 // WithField method to set keys for a structured log message.
@@ -361,6 +380,8 @@ type TemplateBlock struct {
 type LoadTemplateConfig struct {
 	Field          TemplateFieldType
 	TemplateString string
+	LeftDelim      string // LeftDelim and RightDelim delimit the actions of the template; {{ and }} if empty
+	RightDelim     string
 }
 
 // Ticker generates tickscript tasks for kapacitor
@@ -450,6 +471,7 @@ type Server struct {
 	Organization       string                 `json:"organization"`       // Organization is the organization ID that resource belongs to
 	Type               string                 `json:"type"`               // Type is the kind of service (e.g. kapacitor or flux)
 	Metadata           map[string]interface{} `json:"metadata"`           // Metadata is any other data that the frontend wants to store about this service
+	AlertToken         string                 `json:"-"`                  // AlertToken authenticates the alerts a kapacitor posts to CloudHub; it is in CLEARTEXT
 }
 
 // ServersStore stores connection information for a `Server`
@@ -512,6 +534,10 @@ type User struct {
 	RetryCount         int32       `json:"retryCount,omitempty"`
 	LockedTime         string      `json:"lockedTime,omitempty"`
 	Locked             bool        `json:"locked,omitempty"`
+	TOTPSecret         string      `json:"-"`                     // TOTPSecret is the base32 secret of the user's authenticator; pending until TOTPEnabled
+	TOTPEnabled        bool        `json:"totpEnabled,omitempty"` // TOTPEnabled requires a code from the authenticator after the password
+	TOTPLastCounter    int64       `json:"-"`                     // TOTPLastCounter is the time step of the last accepted code, which cannot be used again
+	RecoveryCodes      []string    `json:"-"`                     // RecoveryCodes are the hashes of the unused recovery codes
 }
 
 // UserQuery represents the attributes that a user may be retrieved by.
@@ -668,6 +694,7 @@ type Dashboard struct {
 	Templates    []Template      `json:"templates"`
 	Name         string          `json:"name"`
 	Organization string          `json:"organization"` // Organization is the organization ID that resource belongs to
+	Revision     int64           `json:"-"`            // Revision is increased by the store every time the dashboard is updated
 }
 
 // UnmarshalJSON unmarshals a string ID into a DashboardID (int).
@@ -807,6 +834,36 @@ type DashboardsStore interface {
 	Update(context.Context, Dashboard) error
 }
 
+// DefaultDashboardRevisionRetention is the number of revisions kept per
+// dashboard when the organization has not configured a retention.
+const DefaultDashboardRevisionRetention = 10
+
+// DashboardRevision is a saved version of a dashboard.
+type DashboardRevision struct {
+	ID          int         `json:"id"`          // ID increases with every revision of the dashboard
+	DashboardID DashboardID `json:"dashboardID"` // DashboardID is the dashboard the revision belongs to
+	Author      string      `json:"author"`      // Author is the name of the user that made this version
+	Time        time.Time   `json:"time"`        // Time this version was saved
+	Dashboard   Dashboard   `json:"dashboard"`   // Dashboard as it was at this revision
+}
+
+// DashboardRevisionsStore is the storage and retrieval of dashboard revisions
+type DashboardRevisionsStore interface {
+	// All lists the revisions of a dashboard, newest first
+	All(context.Context, DashboardID) ([]DashboardRevision, error)
+	// Add saves a new revision, assigning its ID, and removes all but the
+	// newest keep revisions of the dashboard
+	Add(ctx context.Context, rev *DashboardRevision, keep int) (*DashboardRevision, error)
+	// UpdateDashboard changes a dashboard and saves the change as a new
+	// revision by author at once. A dashboard without revisions has its
+	// current version saved first.
+	UpdateDashboard(ctx context.Context, d Dashboard, author string, keep int) error
+	// Get retrieves a revision of a dashboard
+	Get(ctx context.Context, id DashboardID, revID int) (*DashboardRevision, error)
+	// Delete removes all revisions of a dashboard
+	Delete(context.Context, DashboardID) error
+}
+
 // Cell is a rectangle and multiple time series queries to visualize.
 type Cell struct {
 	X            int32            `json:"x"`
@@ -965,6 +1022,204 @@ type MappingsStore interface {
 	Update(context.Context, *Mapping) error
 }
 
+// APIToken is a long-lived credential that lets automation act within an
+// organization with a fixed role, without a user session.
+type APIToken struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`         // Name describes what the token is used for
+	Organization string    `json:"organization"` // Organization the token acts within
+	Role         string    `json:"role"`         // Role granted to requests made with the token
+	Hash         string    `json:"-"`            // Hash of the token secret; the secret itself is never stored
+	Prefix       string    `json:"prefix"`       // Prefix is the start of the secret, to tell tokens apart
+	CreatedBy    string    `json:"createdBy"`    // CreatedBy is the name of the user that created the token
+	CreatedAt    time.Time `json:"createdAt"`    // CreatedAt is when the token was created
+	ExpiresAt    time.Time `json:"expiresAt"`    // ExpiresAt is when the token stops working; zero never expires
+	LastUsedAt   time.Time `json:"lastUsedAt"`   // LastUsedAt is when the token last authenticated a request
+}
+
+// Expired reports whether the token has expired at now
+func (t *APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// APITokenQuery represents the attributes that an API token may be retrieved by.
+// It is predominantly used in the APITokensStore.Get method.
+type APITokenQuery struct {
+	ID   *string
+	Hash *string
+}
+
+// APITokensStore is the storage and retrieval of API tokens
+type APITokensStore interface {
+	// Add creates a new APIToken, populating its ID
+	Add(context.Context, *APIToken) (*APIToken, error)
+	// All lists all APITokens in the APITokensStore
+	All(context.Context) ([]APIToken, error)
+	// Delete removes an APIToken from the APITokensStore
+	Delete(context.Context, *APIToken) error
+	// Get retrieves an APIToken by ID or by the hash of its secret
+	Get(context.Context, APITokenQuery) (*APIToken, error)
+	// Update replaces an APIToken in the APITokensStore
+	Update(context.Context, *APIToken) error
+}
+
+// HostKey is the SSH host key of a host that the web terminal of an
+// organization connects to. Keys are recorded on first use and trusted only
+// once an admin approves them.
+type HostKey struct {
+	ID           string    `json:"id"`
+	Organization string    `json:"organization"`         // Organization the key is trusted in
+	Host         string    `json:"host"`                 // Host is the address and port the terminal connects to, e.g. 10.0.0.1:22
+	KeyType      string    `json:"keyType"`              // KeyType is the SSH algorithm of the key, e.g. ssh-ed25519
+	Fingerprint  string    `json:"fingerprint"`          // Fingerprint is the SHA256 fingerprint of the key
+	PublicKey    string    `json:"publicKey"`            // PublicKey is the key in authorized_keys format
+	Approved     bool      `json:"approved"`             // Approved keys are trusted; others wait for an admin
+	FirstSeen    time.Time `json:"firstSeen"`            // FirstSeen is when the host first presented the key
+	ApprovedBy   string    `json:"approvedBy,omitempty"` // ApprovedBy is the name of the admin that approved the key
+	ApprovedAt   time.Time `json:"approvedAt"`           // ApprovedAt is when the key was approved
+}
+
+// HostKeyQuery represents the attributes that a host key may be retrieved by.
+// It is predominantly used in the HostKeysStore.Get method.
+type HostKeyQuery struct {
+	ID           *string
+	Organization *string
+	Host         *string
+}
+
+// HostKeysStore is the storage and retrieval of SSH host keys
+type HostKeysStore interface {
+	// Add creates a new HostKey, populating its ID
+	Add(context.Context, *HostKey) (*HostKey, error)
+	// All lists all HostKeys in the HostKeysStore
+	All(context.Context) ([]HostKey, error)
+	// Delete removes a HostKey from the HostKeysStore
+	Delete(context.Context, *HostKey) error
+	// Get retrieves a HostKey by ID or by organization and host
+	Get(context.Context, HostKeyQuery) (*HostKey, error)
+	// Update replaces a HostKey in the HostKeysStore
+	Update(context.Context, *HostKey) error
+}
+
+// TerminalProfile is a saved web terminal connection. Credentials are kept
+// server-side, either on the profile itself or on the network device the
+// profile points to, so the browser only ever sends the profile ID.
+type TerminalProfile struct {
+	ID            string `json:"id"`
+	Organization  string `json:"organization"`            // Organization the profile belongs to
+	Name          string `json:"name"`                    // Name is shown in the terminal connection list
+	Addr          string `json:"addr"`                    // Addr is the host name or IP of the SSH server
+	Port          int    `json:"port"`                    // Port of the SSH server, 22 when zero
+	User          string `json:"user"`                    // User to log in as
+	Password      string `json:"password,omitempty"`      // Password authenticates User when no PrivateKey is set
+	PrivateKey    string `json:"privateKey,omitempty"`    // PrivateKey is a PEM encoded SSH private key
+	Passphrase    string `json:"passphrase,omitempty"`    // Passphrase decrypts PrivateKey
+	NetworkDevice string `json:"networkDevice,omitempty"` // NetworkDevice is the ID of a device whose SSH config supplies the connection
+	JumpProfile   string `json:"jumpProfile,omitempty"`   // JumpProfile is the ID of a profile to connect through, as with ssh -J
+}
+
+// TerminalProfilesStore is the storage and retrieval of terminal profiles
+type TerminalProfilesStore interface {
+	// Add creates a new TerminalProfile, populating its ID
+	Add(context.Context, *TerminalProfile) (*TerminalProfile, error)
+	// All lists all TerminalProfiles in the TerminalProfilesStore
+	All(context.Context) ([]TerminalProfile, error)
+	// Delete removes a TerminalProfile from the TerminalProfilesStore
+	Delete(context.Context, *TerminalProfile) error
+	// Get retrieves a TerminalProfile by ID
+	Get(ctx context.Context, id string) (*TerminalProfile, error)
+	// Update replaces a TerminalProfile in the TerminalProfilesStore
+	Update(context.Context, *TerminalProfile) error
+}
+
+// Statuses of a SaltJob
+const (
+	SaltJobPending   = "pending"   // SaltJobPending is a job no minion has returned from yet
+	SaltJobRunning   = "running"   // SaltJobRunning is a job some minions have returned from
+	SaltJobSucceeded = "succeeded" // SaltJobSucceeded is a job every minion returned from successfully
+	SaltJobFailed    = "failed"    // SaltJobFailed is a job that failed or timed out on a minion
+)
+
+// SaltJob is an asynchronous Salt job submitted by CloudHub. It keeps the
+// identity of the job so that its result can be polled and the job re-run.
+type SaltJob struct {
+	JID          string          `json:"jid"`
+	Organization string          `json:"organization"`         // Organization the job was submitted in
+	Client       string          `json:"client"`               // Client is local_async or runner_async
+	Function     string          `json:"function"`             // Function is the Salt function called, e.g. file.write
+	Target       string          `json:"target,omitempty"`     // Target is the minion expression of a local job
+	Arg          []string        `json:"arg,omitempty"`        // Arg are the positional arguments of Function
+	Kwarg        string          `json:"kwarg,omitempty"`      // Kwarg are the keyword arguments of Function as a JSON object
+	Minions      []string        `json:"minions"`              // Minions are the minions expected to return
+	Requester    string          `json:"requester"`            // Requester is the name of the CloudHub user that submitted the job
+	Status       string          `json:"status"`               // Status is one of the SaltJob statuses
+	Result       json.RawMessage `json:"result,omitempty"`     // Result maps the minions that returned to their return
+	Error        string          `json:"error,omitempty"`      // Error explains a failed job
+	RerunOf      string          `json:"rerunOf,omitempty"`    // RerunOf is the JID of the job this one repeats
+	CreatedAt    time.Time       `json:"createdAt"`            // CreatedAt is when CloudHub submitted the job
+	FinishedAt   time.Time       `json:"finishedAt,omitempty"` // FinishedAt is zero while the job is pending or running
+}
+
+// Finished reports whether the job has succeeded or failed
+func (j *SaltJob) Finished() bool {
+	return j.Status == SaltJobSucceeded || j.Status == SaltJobFailed
+}
+
+// SaltJobsStore is the storage and retrieval of Salt jobs
+type SaltJobsStore interface {
+	// Add creates a new SaltJob keyed by its JID
+	Add(context.Context, *SaltJob) (*SaltJob, error)
+	// All lists all SaltJobs in the SaltJobsStore
+	All(context.Context) ([]SaltJob, error)
+	// Delete removes a SaltJob from the SaltJobsStore
+	Delete(context.Context, *SaltJob) error
+	// Get retrieves a SaltJob by JID
+	Get(ctx context.Context, jid string) (*SaltJob, error)
+	// Update replaces a SaltJob in the SaltJobsStore
+	Update(context.Context, *SaltJob) error
+}
+
+// DefaultTerminalRecordingRetention is the number of days terminal recordings
+// are kept when the organization has not configured a retention.
+const DefaultTerminalRecordingRetention = 90
+
+// TerminalRecording describes a recorded web terminal session. The session
+// itself is kept in asciicast v2 format by a TerminalRecordingStorage.
+type TerminalRecording struct {
+	ID           string    `json:"id"`
+	Organization string    `json:"organization"` // Organization the session was opened in
+	User         string    `json:"user"`         // User is the name of the CloudHub user that opened the session
+	Host         string    `json:"host"`         // Host is the address and port of the SSH server
+	SSHUser      string    `json:"sshUser"`      // SSHUser is the user logged in on the host
+	StartedAt    time.Time `json:"startedAt"`
+	EndedAt      time.Time `json:"endedAt"` // EndedAt is zero while the session is open
+	Size         int64     `json:"size"`    // Size of the asciicast in bytes
+}
+
+// TerminalRecordingsStore is the storage and retrieval of terminal recording metadata
+type TerminalRecordingsStore interface {
+	// Add creates a new TerminalRecording, populating its ID
+	Add(context.Context, *TerminalRecording) (*TerminalRecording, error)
+	// All lists all TerminalRecordings in the TerminalRecordingsStore
+	All(context.Context) ([]TerminalRecording, error)
+	// Delete removes a TerminalRecording from the TerminalRecordingsStore
+	Delete(context.Context, *TerminalRecording) error
+	// Get retrieves a TerminalRecording by ID
+	Get(ctx context.Context, id string) (*TerminalRecording, error)
+	// Update replaces a TerminalRecording in the TerminalRecordingsStore
+	Update(context.Context, *TerminalRecording) error
+}
+
+// TerminalRecordingStorage keeps the asciicast content of terminal recordings
+type TerminalRecordingStorage interface {
+	// Create returns a writer for the content of a new recording
+	Create(ctx context.Context, id string) (io.WriteCloser, error)
+	// Open returns a reader of the content of a recording
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	// Delete removes the content of a recording
+	Delete(ctx context.Context, id string) error
+}
+
 // Organization is a group of resources under a common name
 type Organization struct {
 	ID   string `json:"id"`
@@ -1033,8 +1288,66 @@ type ConfigStore interface {
 // OrganizationConfig is the organization config for parameters that can
 // be set via API, with different sections, such as LogViewer
 type OrganizationConfig struct {
-	OrganizationID string          `json:"organization"`
-	LogViewer      LogViewerConfig `json:"logViewer"`
+	OrganizationID     string                   `json:"organization"`
+	LogViewer          LogViewerConfig          `json:"logViewer"`
+	DashboardRevisions DashboardRevisionsConfig `json:"dashboardRevisions"`
+	TwoFactor          TwoFactorConfig          `json:"twoFactor"`
+	TerminalRecordings TerminalRecordingsConfig `json:"terminalRecordings"`
+	SaltPolicy         SaltPolicyConfig         `json:"saltPolicy"`
+}
+
+// SaltPolicyConfig limits the Salt API calls the roles of an organization
+// may make through the Salt proxy. Without rules a built-in policy applies.
+type SaltPolicyConfig struct {
+	Rules []SaltRule `json:"rules,omitempty"`
+}
+
+// SaltRule allows a role, and the roles above it, to make the Salt API calls
+// it matches. Patterns are shell patterns as understood by path.Match.
+type SaltRule struct {
+	Role      string   `json:"role"`              // Role is the least role the rule applies to
+	Clients   []string `json:"clients"`           // Clients are patterns of Salt clients, e.g. local or runner*
+	Functions []string `json:"functions"`         // Functions are patterns of Salt functions, e.g. grains.*
+	Targets   []string `json:"targets,omitempty"` // Targets are patterns every target has to match; empty allows any
+	Args      []string `json:"args,omitempty"`    // Args are patterns every argument has to match; empty allows any
+}
+
+// TerminalRecordingsConfig is the configuration of web terminal recordings
+type TerminalRecordingsConfig struct {
+	// Retention is the number of days recordings are kept.
+	// Zero keeps them DefaultTerminalRecordingRetention days.
+	Retention int32 `json:"retention"`
+}
+
+// Keep returns how long recordings are kept
+func (c TerminalRecordingsConfig) Keep() time.Duration {
+	days := c.Retention
+	if days <= 0 {
+		days = DefaultTerminalRecordingRetention
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// TwoFactorConfig is the two-factor authentication policy of an organization
+type TwoFactorConfig struct {
+	// RequiredForAdmins requires basic users with the admin role in the
+	// organization to log in with a TOTP code
+	RequiredForAdmins bool `json:"requiredForAdmins"`
+}
+
+// DashboardRevisionsConfig is the configuration of dashboard version history
+type DashboardRevisionsConfig struct {
+	// Retention is the number of revisions kept per dashboard.
+	// Zero keeps DefaultDashboardRevisionRetention revisions.
+	Retention int32 `json:"retention"`
+}
+
+// Keep returns the number of revisions to keep per dashboard
+func (c DashboardRevisionsConfig) Keep() int {
+	if c.Retention <= 0 {
+		return DefaultDashboardRevisionRetention
+	}
+	return int(c.Retention)
 }
 
 // LogViewerConfig is the configuration settings for the Log Viewer UI
@@ -1128,6 +1441,7 @@ type Topology struct {
 	Diagram         string          `json:"diagram,string,omitempty"`  // diagram xml
 	Preferences     []string        `json:"preferences,omitempty"`     // User preferences
 	TopologyOptions TopologyOptions `json:"topologyOptions,omitempty"` // Configuration options for the topology, defined in TopologyOptions
+	Revision        int64           `json:"-"`                         // Revision is increased by the store every time the topology is updated
 }
 
 // TopologyOptions represents various settings for displaying elements of the topology.
@@ -1244,6 +1558,26 @@ type KVClient interface {
 	NetworkDeviceOrgStore() NetworkDeviceOrgStore
 	// MLNxRstStore returns the kv's MLNxRstStore type.
 	MLNxRstStore() MLNxRstStore
+	// AuditStore returns the kv's AuditStore type.
+	AuditStore() AuditStore
+	// DashboardRevisionsStore returns the kv's DashboardRevisionsStore type.
+	DashboardRevisionsStore() DashboardRevisionsStore
+	// APITokensStore returns the kv's APITokensStore type.
+	APITokensStore() APITokensStore
+	// HostKeysStore returns the kv's HostKeysStore type.
+	HostKeysStore() HostKeysStore
+	// TerminalRecordingsStore returns the kv's TerminalRecordingsStore type.
+	TerminalRecordingsStore() TerminalRecordingsStore
+	// TerminalProfilesStore returns the kv's TerminalProfilesStore type.
+	TerminalProfilesStore() TerminalProfilesStore
+	// SaltJobsStore returns the kv's SaltJobsStore type.
+	SaltJobsStore() SaltJobsStore
+	// AlertEventsStore returns the kv's AlertEventsStore type.
+	AlertEventsStore() AlertEventsStore
+	// MaintenanceWindowsStore returns the kv's MaintenanceWindowsStore type.
+	MaintenanceWindowsStore() MaintenanceWindowsStore
+	// RuleTemplatesStore returns the kv's RuleTemplatesStore type.
+	RuleTemplatesStore() RuleTemplatesStore
 }
 
 // NetworkDeviceOrgQuery represents the attributes that a networkDeviceOrg may be retrieved by.
@@ -1288,6 +1622,7 @@ type NetworkDeviceOrg struct {
 	AIKapacitor         AIKapacitor `json:"ai_kapacitor"`
 	LearningCron        string      `json:"learning_cron"`
 	ProcCnt             int         `json:"process_count"`
+	Revision            int64       `json:"-"`
 }
 
 // NetworkDeviceOrgStore is the Storage and retrieval of information
@@ -1314,9 +1649,17 @@ var DeviceCategoryMap = map[string]string{
 //
 // It is expected that only one of ID or Organization will be
 // specified, but all are provided NetworkDeviceStore should prefer ID.
+//
+// NetworkDeviceStore.Find returns the devices matching every attribute that
+// is specified. DeviceIP, Organization, LearningState and CollectorServer,
+// the server of the organization collecting the device, are looked up in
+// indexes rather than by reading every device.
 type NetworkDeviceQuery struct {
-	ID           *string
-	Organization *string
+	ID              *string
+	Organization    *string
+	DeviceIP        *string
+	LearningState   *string
+	CollectorServer *string
 }
 
 // SSHConfig is Connection Config
@@ -1359,6 +1702,7 @@ type NetworkDevice struct {
 	LearningBeginDatetime  string     `json:"learning_begin_datetime"`
 	LearningFinishDatetime string     `json:"learning_finish_datetime"`
 	IsLearning             bool       `json:"is_learning"`
+	Revision               int64      `json:"-"`
 }
 
 // NetworkDeviceStore is the Storage and retrieval of information
@@ -1371,6 +1715,8 @@ type NetworkDeviceStore interface {
 
 	Get(ctx context.Context, q NetworkDeviceQuery) (*NetworkDevice, error)
 
+	Find(ctx context.Context, q NetworkDeviceQuery) ([]NetworkDevice, error)
+
 	Update(context.Context, *NetworkDevice) error
 }
 
@@ -1491,3 +1837,188 @@ type DLNxRstStg struct {
 	Model                  []byte  `json:"model"`
 	DLThreshold            float32 `json:"dl_threshold"` // DL Threshold value
 }
+
+// AuditEvent is a single change made through the CloudHub API.
+type AuditEvent struct {
+	ID           string          `json:"id"`                     // ID is time ordered so events sort chronologically
+	Time         time.Time       `json:"time"`                   // Time the change was made
+	Actor        string          `json:"actor"`                  // Actor is the name of the user that made the change
+	Provider     string          `json:"provider,omitempty"`     // Provider of the actor, e.g. github or cloudhub
+	Organization string          `json:"organization,omitempty"` // Organization is the ID of the organization the change was made in
+	Action       string          `json:"action"`                 // Action is the kind of resource changed, e.g. Sources or Users
+	Method       string          `json:"method,omitempty"`       // Method is the HTTP method of the request
+	Resource     string          `json:"resource,omitempty"`     // Resource is the request path of the changed resource
+	Message      string          `json:"message"`                // Message is a human readable description of the change
+	Before       json.RawMessage `json:"before,omitempty"`       // Before is the resource before the change
+	After        json.RawMessage `json:"after,omitempty"`        // After is the resource after the change
+	RequestID    string          `json:"requestID,omitempty"`    // RequestID identifies the request that made the change
+}
+
+// AuditQuery filters the audit events returned by AuditStore.All.
+// Zero values do not filter.
+type AuditQuery struct {
+	Start        time.Time // Start is the inclusive lower bound of the event time
+	End          time.Time // End is the exclusive upper bound of the event time
+	Actor        string
+	Organization string
+	Action       string
+	Offset       int // Offset is the number of matching events to skip
+	Limit        int // Limit is the maximum number of events to return
+}
+
+// AuditStore is the storage and retrieval of audit events.
+type AuditStore interface {
+	// Add records a new AuditEvent, assigning its ID.
+	Add(context.Context, *AuditEvent) (*AuditEvent, error)
+	// All returns the events matching the query, newest first.
+	All(context.Context, AuditQuery) ([]AuditEvent, error)
+	// Prune removes the events older than the time, returning how many were removed.
+	Prune(context.Context, time.Time) (int, error)
+}
+
+// Alert levels of Kapacitor
+const (
+	AlertLevelOK       = "OK"
+	AlertLevelInfo     = "INFO"
+	AlertLevelWarning  = "WARNING"
+	AlertLevelCritical = "CRITICAL"
+)
+
+// AlertEvent is a change of level of an alert fired by a Kapacitor rule, as
+// posted by Kapacitor.
+type AlertEvent struct {
+	ID            string            `json:"id"`                 // ID is time ordered so events sort chronologically
+	Time          time.Time         `json:"time"`               // Time the alert changed level
+	Organization  string            `json:"organization"`       // Organization is the ID of the organization of the kapacitor
+	KapacitorID   int               `json:"kapacitorID,string"` // KapacitorID is the ID of the kapacitor of the rule
+	RuleID        string            `json:"ruleID"`             // RuleID is the ID of the Kapacitor task of the rule
+	AlertID       string            `json:"alertID"`            // AlertID identifies the alert within the rule, e.g. one per host
+	Level         string            `json:"level"`              // Level is OK, INFO, WARNING or CRITICAL
+	PreviousLevel string            `json:"previousLevel"`      // PreviousLevel is the level of the alert before this event
+	Host          string            `json:"host,omitempty"`     // Host is the host tag of the alerting series
+	Tags          map[string]string `json:"tags,omitempty"`     // Tags of the alerting series
+	Message       string            `json:"message"`            // Message of the alert
+	Duration      time.Duration     `json:"duration"`           // Duration the alert has been in a non OK level, in nanoseconds
+}
+
+// AlertEventQuery filters the alert events returned by AlertEventsStore.All.
+// Zero values do not filter.
+type AlertEventQuery struct {
+	Start        time.Time // Start is the inclusive lower bound of the event time
+	End          time.Time // End is the exclusive upper bound of the event time
+	Organization string
+	KapacitorID  int
+	RuleID       string
+	Level        string
+	Host         string
+	Limit        int // Limit is the maximum number of events to return
+}
+
+// AlertEventsStore is the storage and retrieval of the events of the alerts
+// fired by Kapacitor rules.
+type AlertEventsStore interface {
+	// Add records a new AlertEvent, assigning its ID.
+	Add(context.Context, *AlertEvent) (*AlertEvent, error)
+	// All returns the events matching the query, newest first.
+	All(context.Context, AlertEventQuery) ([]AlertEvent, error)
+	// Prune removes the events older than the time, returning how many were removed.
+	Prune(context.Context, time.Time) (int, error)
+}
+
+// MaintenanceWindow silences the rules of a kapacitor by disabling their
+// tasks for a time. A window happens once, from Start to End, or, if Cron is
+// set, for Duration from every time matching Cron between Start and End.
+// Rules are in the window if they are listed in RuleIDs, filter on one of
+// Hosts or on all of Tags; a window without any of those covers every rule
+// of the kapacitor.
+type MaintenanceWindow struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Organization  string            `json:"organization"`
+	KapacitorID   int               `json:"kapacitorID,string"`
+	RuleIDs       []string          `json:"rules"`
+	Hosts         []string          `json:"hosts"`
+	Tags          map[string]string `json:"tags"`
+	Start         time.Time         `json:"start"`
+	End           time.Time         `json:"end"`
+	Cron          string            `json:"cron"`     // Cron is a five field cron expression of the start of recurring windows
+	Duration      time.Duration     `json:"duration"` // Duration of each recurring window
+	Timezone      string            `json:"timezone"` // Timezone Cron is evaluated in; UTC if empty
+	Annotate      bool              `json:"annotate"` // Annotate marks the windows with an annotation on the source of the kapacitor
+	CreatedBy     string            `json:"createdBy"`
+	Active        bool              `json:"active"`        // Active is set while the tasks of the window are disabled
+	DisabledTasks []string          `json:"disabledTasks"` // DisabledTasks are the tasks disabled by the window, enabled again when it ends
+	PendingTasks  []string          `json:"pendingTasks"`  // PendingTasks are the tasks the window could not disable yet, retried while it is active
+}
+
+// MaintenanceWindowsStore is the storage and retrieval of maintenance windows
+type MaintenanceWindowsStore interface {
+	// Add creates a new MaintenanceWindow, populating its ID
+	Add(context.Context, *MaintenanceWindow) (*MaintenanceWindow, error)
+	// All lists all MaintenanceWindows in the MaintenanceWindowsStore
+	All(context.Context) ([]MaintenanceWindow, error)
+	// Delete removes a MaintenanceWindow from the MaintenanceWindowsStore
+	Delete(context.Context, *MaintenanceWindow) error
+	// Get retrieves a MaintenanceWindow by ID
+	Get(context.Context, string) (*MaintenanceWindow, error)
+	// Update replaces a MaintenanceWindow in the MaintenanceWindowsStore
+	Update(context.Context, *MaintenanceWindow) error
+	// UpdateSettings replaces a MaintenanceWindow in the
+	// MaintenanceWindowsStore but for Active, DisabledTasks and
+	// PendingTasks, which are set to the stored ones
+	UpdateSettings(context.Context, *MaintenanceWindow) error
+	// UpdateState sets Active, DisabledTasks and PendingTasks of a stored
+	// MaintenanceWindow, keeping its settings as stored
+	UpdateState(context.Context, *MaintenanceWindow) error
+}
+
+// RuleTemplate is an AlertRule parameterised by variables that is
+// instantiated as rules of many kapacitors. Strings of Rule refer to a
+// variable as [[ .name ]], leaving {{ }} to the templates of kapacitor.
+type RuleTemplate struct {
+	ID           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	Organization string                 `json:"organization"`
+	Rule         AlertRule              `json:"rule"`
+	Variables    map[string]string      `json:"variables"` // Variables of Rule and their default values; an empty default makes a variable required
+	Instances    []RuleTemplateInstance `json:"instances"`
+	CreatedBy    string                 `json:"createdBy"`
+}
+
+// RuleTemplateInstance is a rule of a kapacitor created from a RuleTemplate
+type RuleTemplateInstance struct {
+	KapacitorID  int               `json:"kapacitorID,string"`
+	Organization string            `json:"organization"` // Organization is the ID of the organization of the kapacitor
+	TaskID       string            `json:"taskID"`
+	Params       map[string]string `json:"params"` // Params are the values of the variables of the template
+}
+
+// RuleTemplatesStore is the storage and retrieval of alert rule templates
+type RuleTemplatesStore interface {
+	// Add creates a new RuleTemplate, populating its ID
+	Add(context.Context, *RuleTemplate) (*RuleTemplate, error)
+	// All lists all RuleTemplates in the RuleTemplatesStore
+	All(context.Context) ([]RuleTemplate, error)
+	// Delete removes a RuleTemplate from the RuleTemplatesStore
+	Delete(context.Context, *RuleTemplate) error
+	// Get retrieves a RuleTemplate by ID
+	Get(context.Context, string) (*RuleTemplate, error)
+	// Update replaces a RuleTemplate in the RuleTemplatesStore but for
+	// Instances, which are set to the stored ones
+	Update(context.Context, *RuleTemplate) error
+	// UpdateInstances sets the Instances of the RuleTemplate with the ID to
+	// the ones the function returns for the stored ones, keeping the rest of
+	// the RuleTemplate as stored. The function may be called again if the
+	// RuleTemplate changes meanwhile.
+	UpdateInstances(context.Context, string, func([]RuleTemplateInstance) []RuleTemplateInstance) error
+}
+
+// AuditSink receives a copy of every recorded AuditEvent.
+type AuditSink interface {
+	Write(context.Context, AuditEvent) error
+}
+
+// Mailer sends plain text mail, e.g. password reset links to basic users.
+type Mailer interface {
+	Send(ctx context.Context, to []string, subject, body string) error
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv"
+)
+
+func fileChecksum(t *testing.T, path string) [sha256.Size]byte {
+	t.Helper()
+	octets, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sha256.Sum256(octets)
+}
+
+// newBoltDB creates a bolt db at path at schema version 1, as written by a
+// cloudhub that predates schema migrations, holding a server.
+func newBoltDB(t *testing.T, path string) {
+	t.Helper()
+	ctx := context.Background()
+	svc, err := openService(ctx, &url.URL{Path: path}, kv.WithMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	if _, err := svc.ServersStore().Add(ctx, cloudhub.Server{Name: "Doc", Organization: "default"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateCommand_DryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudhubctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from := filepath.Join(dir, "from.db")
+	to := filepath.Join(dir, "to.db")
+	newBoltDB(t, from)
+	newBoltDB(t, to)
+	fromSum, toSum := fileChecksum(t, from), fileChecksum(t, to)
+
+	cmd := &migrateCommand{From: "bolt://" + from, To: "bolt://" + to, DryRun: true}
+	if err := cmd.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	if fileChecksum(t, from) != fromSum {
+		t.Error("dry run of the migration wrote to the source")
+	}
+	if fileChecksum(t, to) != toSum {
+		t.Error("dry run of the migration wrote to the target")
+	}
+
+	// a dry run to a bolt file that is not there yet does not create it
+	missing := filepath.Join(dir, "missing.db")
+	cmd = &migrateCommand{From: "bolt://" + from, To: "bolt://" + missing, DryRun: true}
+	if err := cmd.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("dry run of the migration created the target: %v", err)
+	}
+
+	// the migration itself only reads the source
+	cmd = &migrateCommand{From: "bolt://" + from, To: "bolt://" + to}
+	if err := cmd.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	if fileChecksum(t, from) != fromSum {
+		t.Error("migration wrote to the source")
+	}
+}
@@ -3,6 +3,7 @@ package kapacitor
 import (
 	"bytes"
 	"encoding/json"
+	"net/url"
 	"regexp"
 	"strings"
 
@@ -34,6 +35,47 @@ func AlertServices(rule cloudhub.AlertRule) (string, error) {
 	return toOldSchema(node), nil
 }
 
+// AlertIngestHeader is the header carrying the token of the kapacitor on the
+// alerts it posts to the alert ingestion endpoint of CloudHub.
+const AlertIngestHeader = "X-CloudHub-Alert-Token"
+
+// AlertIngest is where the alerts of a kapacitor are posted to be recorded
+// by CloudHub. URL is the ingestion endpoint of the kapacitor, the rule ID is
+// appended to it.
+type AlertIngest struct {
+	URL   string
+	Token string
+}
+
+// withAlertIngest returns rule with a post handler to the ingestion endpoint
+// added to its alert nodes. rule is returned as is when there is no
+// endpoint or the rule has no ID yet.
+func withAlertIngest(rule cloudhub.AlertRule, ingest *AlertIngest) cloudhub.AlertRule {
+	if ingest == nil || ingest.URL == "" || rule.ID == "" {
+		return rule
+	}
+	posts := make([]*cloudhub.Post, 0, len(rule.AlertNodes.Posts)+1)
+	for _, p := range rule.AlertNodes.Posts {
+		if !isAlertIngestPost(p) {
+			posts = append(posts, p)
+		}
+	}
+	rule.AlertNodes.Posts = append(posts, &cloudhub.Post{
+		URL:     ingest.URL + "/rules/" + url.PathEscape(rule.ID),
+		Headers: map[string]string{AlertIngestHeader: ingest.Token},
+	})
+	return rule
+}
+
+// isAlertIngestPost returns whether p posts to the alert ingestion endpoint.
+func isAlertIngestPost(p *cloudhub.Post) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.Headers[AlertIngestHeader]
+	return ok
+}
+
 func addAlertNodes(handlers cloudhub.AlertNodes) (string, error) {
 	octets, err := json.Marshal(&handlers)
 	if err != nil {
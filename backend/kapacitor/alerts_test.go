@@ -250,3 +250,49 @@ func Test_addAlertNodes(t *testing.T) {
 		})
 	}
 }
+
+func Test_withAlertIngest(t *testing.T) {
+	rule := cloudhub.AlertRule{
+		ID: "cloudhub-v1-a",
+		AlertNodes: cloudhub.AlertNodes{
+			Posts: []*cloudhub.Post{{URL: "http://example.com"}},
+		},
+	}
+	ingest := &AlertIngest{URL: "http://cloudhub:8888/alerts/kapacitors/1", Token: "secret"}
+
+	got, err := AlertServices(withAlertIngest(rule, ingest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `alert()
+        .post('http://example.com')
+        .post('http://cloudhub:8888/alerts/kapacitors/1/rules/cloudhub-v1-a')
+        .header('X-CloudHub-Alert-Token', 'secret')
+`
+	formatted, err := formatTick("alert()" + got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != want {
+		t.Errorf("AlertServices() = %v, want %v", formatted, want)
+	}
+	if len(rule.AlertNodes.Posts) != 1 {
+		t.Errorf("withAlertIngest() changed the posts of the rule: %v", rule.AlertNodes.Posts)
+	}
+
+	// the post is added once when the rule already has it
+	again := withAlertIngest(withAlertIngest(rule, ingest), ingest)
+	if len(again.AlertNodes.Posts) != 2 {
+		t.Errorf("withAlertIngest() posts = %d, want 2", len(again.AlertNodes.Posts))
+	}
+
+	for _, r := range []cloudhub.AlertRule{{AlertNodes: rule.AlertNodes}, rule} {
+		ig := ingest
+		if r.ID != "" {
+			ig = nil
+		}
+		if got := withAlertIngest(r, ig); len(got.AlertNodes.Posts) != 1 {
+			t.Errorf("withAlertIngest() added a post without an ID or endpoint: %v", got.AlertNodes.Posts)
+		}
+	}
+}
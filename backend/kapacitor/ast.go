@@ -505,7 +505,17 @@ func extractAlertNodes(p *pipeline.Pipeline, rule *cloudhub.AlertRule) error {
 			if err != nil {
 				return err
 			}
-			return json.Unmarshal(octets, &rule.AlertNodes)
+			if err := json.Unmarshal(octets, &rule.AlertNodes); err != nil {
+				return err
+			}
+			// the post to the alert ingestion endpoint is added by the
+			// ticker, so it is not one of the handlers of the rule
+			for i := 0; i < len(rule.AlertNodes.Posts); i++ {
+				if isAlertIngestPost(rule.AlertNodes.Posts[i]) {
+					rule.AlertNodes.Posts = append(rule.AlertNodes.Posts[:i], rule.AlertNodes.Posts[i+1:]...)
+					i--
+				}
+			}
 		}
 		return nil
 	})
@@ -0,0 +1,301 @@
+package kapacitor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// BacktestPoint is a value of the data of a rule
+type BacktestPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// BacktestSeries is the data of a rule for one group of its group by tags
+type BacktestSeries struct {
+	Tags   map[string]string
+	Points []BacktestPoint
+}
+
+// BacktestTransition is a change of the level of an alert that a rule would
+// have made
+type BacktestTransition struct {
+	Time          time.Time         `json:"time"`
+	ID            string            `json:"id"`
+	Level         string            `json:"level"`
+	PreviousLevel string            `json:"previousLevel"`
+	Value         float64           `json:"value"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Duration      time.Duration     `json:"duration"` // Duration of the alert until it recovered
+}
+
+// backtestRule holds the trigger of a rule parsed for backtesting
+type backtestRule struct {
+	cloudhub.AlertRule
+	period string        // period of the windows of the data, empty without an aggregate
+	shift  time.Duration // shift of relative rules
+	crit   func(v float64) bool
+}
+
+func newBacktestRule(rule cloudhub.AlertRule) (*backtestRule, error) {
+	if rule.Query == nil {
+		return nil, fmt.Errorf("invalid alert rule: no query defined")
+	}
+	if rule.Query.RawText != nil && *rule.Query.RawText != "" {
+		return nil, fmt.Errorf("rules of a raw query cannot be backtested")
+	}
+
+	b := &backtestRule{AlertRule: rule}
+	var err error
+	switch rule.Trigger {
+	case Deadman:
+		if _, err = influxql.ParseDuration(rule.TriggerValues.Period); err != nil {
+			return nil, fmt.Errorf("invalid period %q: %v", rule.TriggerValues.Period, err)
+		}
+		b.period = rule.TriggerValues.Period
+		// deadman alerts when the points in a period are at most its threshold
+		b.crit = func(v float64) bool { return v <= 0 }
+		return b, nil
+	case Relative:
+		if b.shift, err = influxql.ParseDuration(rule.TriggerValues.Shift); err != nil {
+			return nil, fmt.Errorf("invalid shift %q: %v", rule.TriggerValues.Shift, err)
+		}
+		if rule.TriggerValues.Change != ChangePercent && rule.TriggerValues.Change != ChangeAmount {
+			return nil, fmt.Errorf("Unknown change type %s", rule.TriggerValues.Change)
+		}
+		fallthrough
+	case Threshold:
+		if b.crit, err = critFunc(rule.TriggerValues); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown trigger type: %s", rule.Trigger)
+	}
+
+	if _, err := field(rule.Query); err != nil {
+		return nil, err
+	}
+	if f := rule.Query.Fields[0]; f.Type == "func" {
+		if _, err = influxql.ParseDuration(rule.Query.GroupBy.Time); err != nil {
+			return nil, fmt.Errorf("invalid group by time %q: %v", rule.Query.GroupBy.Time, err)
+		}
+		b.period = rule.Query.GroupBy.Time
+	}
+	return b, nil
+}
+
+// critFunc returns the lambda of the crit node of threshold and relative rules
+func critFunc(vals cloudhub.TriggerValues) (func(float64) bool, error) {
+	crit, err := strconv.ParseFloat(vals.Value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q: %v", vals.Value, err)
+	}
+	if vals.RangeValue != "" {
+		upper, err := strconv.ParseFloat(vals.RangeValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range value %q: %v", vals.RangeValue, err)
+		}
+		switch vals.Operator {
+		case insideRange:
+			return func(v float64) bool { return v >= crit && v <= upper }, nil
+		case outsideRange:
+			return func(v float64) bool { return v < crit || v > upper }, nil
+		}
+		return nil, fmt.Errorf("invalid operator: %s is unknown", vals.Operator)
+	}
+
+	op, err := kapaOperator(vals.Operator)
+	if err != nil {
+		return nil, err
+	}
+	return func(v float64) bool {
+		switch op {
+		case ">":
+			return v > crit
+		case "<":
+			return v < crit
+		case "<=":
+			return v <= crit
+		case ">=":
+			return v >= crit
+		case "==":
+			return v == crit
+		default:
+			return v != crit
+		}
+	}, nil
+}
+
+// BacktestQuery returns the InfluxQL query of the data a rule would have
+// alerted on between start and end. The query returns the value the rule
+// compares in a value column, except for deadman rules that count the points
+// of each field in a period. Aggregates are grouped in windows of the group
+// by time of the rule, so rules checking more often than their period are
+// backtested on fewer, non-overlapping, windows.
+func BacktestQuery(rule cloudhub.AlertRule, start, end time.Time) (string, error) {
+	b, err := newBacktestRule(rule)
+	if err != nil {
+		return "", err
+	}
+	q := rule.Query
+
+	// relative rules compare to values a shift before start
+	start = start.Add(-b.shift)
+
+	var sel string
+	switch {
+	case rule.Trigger == Deadman:
+		sel = "count(*)"
+	case q.Fields[0].Type == "func":
+		fld, _ := field(q)
+		sel = fmt.Sprintf("%s(%s) AS %s", q.Fields[0].Value, influxql.QuoteIdent(fld), influxql.QuoteIdent("value"))
+	default:
+		fld, _ := field(q)
+		sel = fmt.Sprintf("%s AS %s", influxql.QuoteIdent(fld), influxql.QuoteIdent("value"))
+	}
+
+	wheres := []string{
+		fmt.Sprintf("time >= '%s' AND time < '%s'", start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano)),
+	}
+	tags := make([]string, 0, len(q.Tags))
+	for tag := range q.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		operator, combine := "=", " OR "
+		if !q.AreTagsAccepted {
+			operator, combine = "!=", " AND "
+		}
+		inner := []string{}
+		for _, value := range q.Tags[tag] {
+			inner = append(inner, fmt.Sprintf("%s %s %s", influxql.QuoteIdent(tag), operator, influxql.QuoteString(value)))
+		}
+		if len(inner) > 0 {
+			wheres = append(wheres, "("+strings.Join(inner, combine)+")")
+		}
+	}
+
+	groupBy := []string{}
+	if b.period != "" {
+		groupBy = append(groupBy, fmt.Sprintf("time(%s)", b.period))
+	}
+	for _, tag := range q.GroupBy.Tags {
+		groupBy = append(groupBy, influxql.QuoteIdent(tag))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+		sel,
+		influxql.QuoteIdent(q.Database, q.RetentionPolicy, q.Measurement),
+		strings.Join(wheres, " AND "))
+	if len(groupBy) > 0 {
+		query += " GROUP BY " + strings.Join(groupBy, ", ")
+	}
+	if b.period != "" {
+		// kapacitor has no windows without points, but deadman alerts on them
+		if rule.Trigger == Deadman {
+			query += " fill(0)"
+		} else {
+			query += " fill(none)"
+		}
+	}
+	return query, nil
+}
+
+// Backtest evaluates the trigger of a rule on series queried with
+// BacktestQuery and returns the transitions of its alerts between start
+// and end, oldest first. As the rule only alerts on state changes, an
+// alert starts as OK and a transition is returned each time it becomes
+// CRITICAL or recovers.
+func Backtest(rule cloudhub.AlertRule, series []BacktestSeries, start, end time.Time) ([]BacktestTransition, error) {
+	b, err := newBacktestRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	transitions := []BacktestTransition{}
+	for _, s := range series {
+		points := make([]BacktestPoint, len(s.Points))
+		copy(points, s.Points)
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+
+		var past map[int64]float64
+		if rule.Trigger == Relative {
+			past = make(map[int64]float64, len(points))
+			for _, p := range points {
+				past[p.Time.UnixNano()] = p.Value
+			}
+		}
+
+		id := b.alertID(s.Tags)
+		level, since := cloudhub.AlertLevelOK, time.Time{}
+		for _, p := range points {
+			if p.Time.Before(start) || !p.Time.Before(end) {
+				continue
+			}
+
+			value := p.Value
+			if past != nil {
+				prev, ok := past[p.Time.Add(-b.shift).UnixNano()]
+				if !ok {
+					// join drops points without a past point
+					continue
+				}
+				value = p.Value - prev
+				if rule.TriggerValues.Change == ChangePercent {
+					value = math.Abs(value) / prev * 100
+				}
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					continue
+				}
+			}
+
+			next := cloudhub.AlertLevelOK
+			if b.crit(value) {
+				next = cloudhub.AlertLevelCritical
+			}
+			if next == level {
+				continue
+			}
+
+			t := BacktestTransition{
+				Time:          p.Time,
+				ID:            id,
+				Level:         next,
+				PreviousLevel: level,
+				Value:         value,
+				Tags:          s.Tags,
+			}
+			if next == cloudhub.AlertLevelOK {
+				t.Duration = p.Time.Sub(since)
+			} else {
+				since = p.Time
+			}
+			transitions = append(transitions, t)
+			level = next
+		}
+	}
+
+	sort.SliceStable(transitions, func(i, j int) bool { return transitions[i].Time.Before(transitions[j].Time) })
+	return transitions, nil
+}
+
+// alertID returns the ID of the alert of a group, as idVar does
+func (b *backtestRule) alertID(tags map[string]string) string {
+	if len(b.Query.GroupBy.Tags) == 0 {
+		return b.Name
+	}
+	group := make([]string, 0, len(b.Query.GroupBy.Tags))
+	for _, tag := range b.Query.GroupBy.Tags {
+		group = append(group, tag+"="+tags[tag])
+	}
+	sort.Strings(group)
+	return b.Name + "-" + strings.Join(group, ",")
+}
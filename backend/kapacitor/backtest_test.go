@@ -0,0 +1,214 @@
+package kapacitor
+
+import (
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+func TestBacktestQuery(t *testing.T) {
+	start := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	query := func(fields []cloudhub.Field, groupBy cloudhub.GroupBy) *cloudhub.QueryConfig {
+		return &cloudhub.QueryConfig{
+			Database:        "telegraf",
+			RetentionPolicy: "autogen",
+			Measurement:     "cpu",
+			Fields:          fields,
+			Tags:            map[string][]string{"host": {"web1", "web'2"}, "cpu": {"cpu-total"}},
+			AreTagsAccepted: true,
+			GroupBy:         groupBy,
+		}
+	}
+	mean := []cloudhub.Field{{Value: "mean", Type: "func", Args: []cloudhub.Field{{Value: "usage_user", Type: "field"}}}}
+	raw := []cloudhub.Field{{Value: "usage_user", Type: "field"}}
+
+	tests := []struct {
+		name    string
+		rule    cloudhub.AlertRule
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Threshold of an aggregate",
+			rule: cloudhub.AlertRule{
+				Trigger:       Threshold,
+				TriggerValues: cloudhub.TriggerValues{Operator: greaterThan, Value: "90"},
+				Query:         query(mean, cloudhub.GroupBy{Time: "10m", Tags: []string{"host"}}),
+			},
+			want: `SELECT mean(usage_user) AS value FROM "telegraf"."autogen".cpu WHERE time >= '2023-04-01T00:00:00Z' AND time < '2023-04-02T00:00:00Z' AND (cpu = 'cpu-total') AND (host = 'web1' OR host = 'web\'2') GROUP BY time(10m), host fill(none)`,
+		},
+		{
+			name: "Relative of a field",
+			rule: cloudhub.AlertRule{
+				Trigger:       Relative,
+				TriggerValues: cloudhub.TriggerValues{Change: ChangeAmount, Shift: "1h", Operator: greaterThan, Value: "10"},
+				Query:         query(raw, cloudhub.GroupBy{}),
+			},
+			want: `SELECT usage_user AS value FROM "telegraf"."autogen".cpu WHERE time >= '2023-03-31T23:00:00Z' AND time < '2023-04-02T00:00:00Z' AND (cpu = 'cpu-total') AND (host = 'web1' OR host = 'web\'2')`,
+		},
+		{
+			name: "Deadman",
+			rule: cloudhub.AlertRule{
+				Trigger:       Deadman,
+				TriggerValues: cloudhub.TriggerValues{Period: "5m"},
+				Query:         query(nil, cloudhub.GroupBy{Tags: []string{"host"}}),
+			},
+			want: `SELECT count(*) FROM "telegraf"."autogen".cpu WHERE time >= '2023-04-01T00:00:00Z' AND time < '2023-04-02T00:00:00Z' AND (cpu = 'cpu-total') AND (host = 'web1' OR host = 'web\'2') GROUP BY time(5m), host fill(0)`,
+		},
+		{
+			name: "Raw query",
+			rule: cloudhub.AlertRule{
+				Trigger: Threshold,
+				Query:   &cloudhub.QueryConfig{RawText: func(s string) *string { return &s }("SELECT 1")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown operator",
+			rule: cloudhub.AlertRule{
+				Trigger:       Threshold,
+				TriggerValues: cloudhub.TriggerValues{Operator: "over", Value: "90"},
+				Query:         query(raw, cloudhub.GroupBy{}),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BacktestQuery(tt.rule, start, end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BacktestQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BacktestQuery() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBacktest(t *testing.T) {
+	start := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	points := func(values ...float64) []BacktestPoint {
+		// one point a minute, the first a minute before start
+		ps := make([]BacktestPoint, len(values))
+		for i, v := range values {
+			ps[i] = BacktestPoint{Time: start.Add(time.Duration(i-1) * time.Minute), Value: v}
+		}
+		return ps
+	}
+	query := &cloudhub.QueryConfig{
+		Fields:  []cloudhub.Field{{Value: "usage_user", Type: "field"}},
+		GroupBy: cloudhub.GroupBy{Tags: []string{"host"}},
+	}
+	type level struct {
+		minute int
+		level  string
+		value  float64
+	}
+
+	tests := []struct {
+		name   string
+		rule   cloudhub.AlertRule
+		series []BacktestSeries
+		want   []level
+	}{
+		{
+			name: "Threshold",
+			rule: cloudhub.AlertRule{
+				Name:          "cpu",
+				Trigger:       Threshold,
+				TriggerValues: cloudhub.TriggerValues{Operator: greaterThan, Value: "90"},
+				Query:         query,
+			},
+			series: []BacktestSeries{{Tags: map[string]string{"host": "web1"}, Points: points(95, 50, 95, 99, 10, 95)}},
+			want: []level{
+				{1, cloudhub.AlertLevelCritical, 95},
+				{3, cloudhub.AlertLevelOK, 10},
+				{4, cloudhub.AlertLevelCritical, 95},
+			},
+		},
+		{
+			name: "Outside range",
+			rule: cloudhub.AlertRule{
+				Name:          "cpu",
+				Trigger:       Threshold,
+				TriggerValues: cloudhub.TriggerValues{Operator: outsideRange, Value: "10", RangeValue: "20"},
+				Query:         query,
+			},
+			series: []BacktestSeries{{Tags: map[string]string{"host": "web1"}, Points: points(0, 15, 5, 20, 21)}},
+			want: []level{
+				{1, cloudhub.AlertLevelCritical, 5},
+				{2, cloudhub.AlertLevelOK, 20},
+				{3, cloudhub.AlertLevelCritical, 21},
+			},
+		},
+		{
+			name: "Relative percent",
+			rule: cloudhub.AlertRule{
+				Name:          "cpu",
+				Trigger:       Relative,
+				TriggerValues: cloudhub.TriggerValues{Change: ChangePercent, Shift: "1m", Operator: greaterThan, Value: "50"},
+				Query:         query,
+			},
+			series: []BacktestSeries{{Tags: map[string]string{"host": "web1"}, Points: points(10, 12, 30, 31, 10)}},
+			want: []level{
+				{1, cloudhub.AlertLevelCritical, 150},
+				{2, cloudhub.AlertLevelOK, 100.0 / 30},
+				{3, cloudhub.AlertLevelCritical, 2100.0 / 31},
+			},
+		},
+		{
+			name: "Deadman",
+			rule: cloudhub.AlertRule{
+				Name:          "cpu",
+				Trigger:       Deadman,
+				TriggerValues: cloudhub.TriggerValues{Period: "1m"},
+				Query:         &cloudhub.QueryConfig{},
+			},
+			series: []BacktestSeries{{Points: points(0, 3, 0, 0, 2)}},
+			want: []level{
+				{1, cloudhub.AlertLevelCritical, 0},
+				{3, cloudhub.AlertLevelOK, 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Backtest(tt.rule, tt.series, start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Backtest() = %+v, want %d transitions", got, len(tt.want))
+			}
+			previous, since := cloudhub.AlertLevelOK, time.Time{}
+			for i, w := range tt.want {
+				at := start.Add(time.Duration(w.minute) * time.Minute)
+				if !got[i].Time.Equal(at) || got[i].Level != w.level || got[i].PreviousLevel != previous || got[i].Value != w.value {
+					t.Errorf("Backtest()[%d] = %+v, want %s at %v with %v", i, got[i], w.level, at, w.value)
+				}
+				if w.level == cloudhub.AlertLevelOK && got[i].Duration != at.Sub(since) {
+					t.Errorf("Backtest()[%d] duration = %v, want %v", i, got[i].Duration, at.Sub(since))
+				}
+				previous, since = w.level, at
+			}
+		})
+	}
+
+	t.Run("Alert IDs", func(t *testing.T) {
+		rule := tests[0].rule
+		got, err := Backtest(rule, []BacktestSeries{
+			{Tags: map[string]string{"host": "web2"}, Points: points(0, 0, 95)},
+			{Tags: map[string]string{"host": "web1"}, Points: points(0, 95)},
+		}, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].ID != "cpu-host=web1" || got[1].ID != "cpu-host=web2" {
+			t.Errorf("Backtest() = %+v, want alerts of web1 then web2", got)
+		}
+	})
+}
@@ -45,6 +45,13 @@ type KapaClient interface {
 	ListTasks(opt *client.ListTasksOptions) ([]client.Task, error)
 	UpdateTask(link client.Link, opt client.UpdateTaskOptions) (client.Task, error)
 	DeleteTask(link client.Link) error
+	ListTopics(opt *client.ListTopicsOptions) (client.Topics, error)
+	ListTopicEvents(link client.Link, opt *client.ListTopicEventsOptions) (client.TopicEvents, error)
+	ListTopicHandlers(link client.Link, opt *client.ListTopicHandlersOptions) (client.TopicHandlers, error)
+	TopicHandler(link client.Link) (client.TopicHandler, error)
+	CreateTopicHandler(link client.Link, opt client.TopicHandlerOptions) (client.TopicHandler, error)
+	ReplaceTopicHandler(link client.Link, opt client.TopicHandlerOptions) (client.TopicHandler, error)
+	DeleteTopicHandler(link client.Link) error
 }
 
 // NewClient creates a client that interfaces with Kapacitor tasks
@@ -297,12 +304,13 @@ func (c *Client) createFromQueryConfig(rule cloudhub.AlertRule) (*client.CreateT
 		return nil, err
 	}
 
+	kapaID := Prefix + id
+	rule.ID = kapaID
 	script, err := c.Ticker.Generate(rule)
 	if err != nil {
 		return nil, err
 	}
 
-	kapaID := Prefix + id
 	return &client.CreateTaskOptions{
 		ID:         kapaID,
 		Type:       toTask(rule.Query),
@@ -418,7 +426,10 @@ func (c *Client) Get(ctx context.Context, id string) (*Task, error) {
 	href := c.Href(id)
 	task, err := kapa.Task(client.Link{Href: href}, nil)
 	if err != nil {
-		return nil, cloudhub.ErrAlertNotFound
+		if err.Error() == errNoTaskExists {
+			return nil, cloudhub.ErrAlertNotFound
+		}
+		return nil, err
 	}
 
 	return NewTask(&task), nil
@@ -25,6 +25,13 @@ type MockKapa struct {
 	DeleteError error
 	LastStatus  client.TaskStatus
 
+	ResTopics           client.Topics
+	ResTopicEvents      client.TopicEvents
+	ResTopicHandlers    client.TopicHandlers
+	ResTopicHandler     client.TopicHandler
+	TopicError          error
+	TopicHandlerOptions *client.TopicHandlerOptions
+
 	*client.CreateTaskOptions
 	client.Link
 	*client.TaskOptions
@@ -65,6 +72,42 @@ func (m *MockKapa) DeleteTask(link client.Link) error {
 	return m.DeleteError
 }
 
+func (m *MockKapa) ListTopics(opt *client.ListTopicsOptions) (client.Topics, error) {
+	return m.ResTopics, m.TopicError
+}
+
+func (m *MockKapa) ListTopicEvents(link client.Link, opt *client.ListTopicEventsOptions) (client.TopicEvents, error) {
+	m.Link = link
+	return m.ResTopicEvents, m.TopicError
+}
+
+func (m *MockKapa) ListTopicHandlers(link client.Link, opt *client.ListTopicHandlersOptions) (client.TopicHandlers, error) {
+	m.Link = link
+	return m.ResTopicHandlers, m.TopicError
+}
+
+func (m *MockKapa) TopicHandler(link client.Link) (client.TopicHandler, error) {
+	m.Link = link
+	return m.ResTopicHandler, m.TopicError
+}
+
+func (m *MockKapa) CreateTopicHandler(link client.Link, opt client.TopicHandlerOptions) (client.TopicHandler, error) {
+	m.Link = link
+	m.TopicHandlerOptions = &opt
+	return m.ResTopicHandler, m.TopicError
+}
+
+func (m *MockKapa) ReplaceTopicHandler(link client.Link, opt client.TopicHandlerOptions) (client.TopicHandler, error) {
+	m.Link = link
+	m.TopicHandlerOptions = &opt
+	return m.ResTopicHandler, m.TopicError
+}
+
+func (m *MockKapa) DeleteTopicHandler(link client.Link) error {
+	m.Link = link
+	return m.TopicError
+}
+
 type MockID struct {
 	ID string
 }
@@ -4,6 +4,13 @@ package kapacitor
 // CloudHub data structure.
 const ErrNotChronoTickscript = Error("TICKscript not built with CloudHub builder")
 
+// ErrTopicHandlerNotFound signals a handler that does not exist in its topic.
+const ErrTopicHandlerNotFound = Error("topic handler not found")
+
+// errNoTaskExists is the error kapacitor responds with to the tasks that do
+// not exist. The kapacitor client drops the status code of its responses.
+const errNoTaskExists = "no task exists"
+
 // Error are kapacitor errors due to communication or processing of TICKscript to kapacitor
 type Error string
 
@@ -10,6 +10,8 @@ var _ cloudhub.Ticker = &Alert{}
 
 // Alert defines alerting strings in template rendering
 type Alert struct {
+	// Ingest, if set, has the alerts of the rule posted to CloudHub as well
+	Ingest *AlertIngest
 }
 
 // Generate creates a Tickscript from the alertrule
@@ -26,7 +28,7 @@ func (a *Alert) Generate(rule cloudhub.AlertRule) (cloudhub.TICKScript, error) {
 	if err != nil {
 		return "", err
 	}
-	services, err := AlertServices(rule)
+	services, err := AlertServices(withAlertIngest(rule, a.Ingest))
 	if err != nil {
 		return "", err
 	}
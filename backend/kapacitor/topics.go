@@ -0,0 +1,601 @@
+package kapacitor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	client "github.com/influxdata/kapacitor/client/v1"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// topicsPath is the kapacitor path of the topics alerts are published to
+const topicsPath = "/kapacitor/v1/alerts/topics"
+
+// Topic is a kapacitor topic the alerts of rules are published to
+type Topic struct {
+	ID        string `json:"id"`
+	Level     string `json:"level"`     // Level is the greatest level of the events of the topic
+	Collected int64  `json:"collected"` // Collected is the number of events the topic has collected
+}
+
+// TopicEvent is the state of an alert of a topic
+type TopicEvent struct {
+	ID       string        `json:"id"`
+	Message  string        `json:"message"`
+	Details  string        `json:"details"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Level    string        `json:"level"`
+}
+
+// TopicHandler handles the alerts of a topic with the single handler
+// defined in AlertNodes, the same as the handlers of alert rules.
+type TopicHandler struct {
+	ID         string              `json:"id"`
+	Topic      string              `json:"topic"`
+	Kind       string              `json:"kind"`
+	Match      string              `json:"match,omitempty"` // Match is a lambda expression the alerts handled must match
+	AlertNodes cloudhub.AlertNodes `json:"alertNodes"`
+	// Options are those of handlers kapacitor has and AlertNodes does not,
+	// which are read only.
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// Valid checks that h has an ID and exactly one handler with its required
+// fields set.
+func (h *TopicHandler) Valid() error {
+	if h.ID == "" {
+		return fmt.Errorf("id required in topic handler")
+	}
+	if err := validTopicSegment("topic", h.Topic); err != nil {
+		return err
+	}
+	if err := validTopicSegment("topic handler id", h.ID); err != nil {
+		return err
+	}
+	if h.AlertNodes.IsStateChangesOnly || h.AlertNodes.UseFlapping {
+		return fmt.Errorf("stateChangesOnly and useFlapping apply to alert rules only")
+	}
+	_, _, err := topicHandlerOptions(h.AlertNodes)
+	return err
+}
+
+// handlerOptions are the options of a kapacitor handler
+type handlerOptions map[string]interface{}
+
+// set sets k to v unless v is empty
+func (o handlerOptions) set(k string, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	case map[string]string:
+		if len(v) == 0 {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	}
+	o[k] = v
+}
+
+func (o handlerOptions) str(k string) string {
+	s, _ := o[k].(string)
+	return s
+}
+
+func (o handlerOptions) strs(k string) []string {
+	switch v := o[k].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+func (o handlerOptions) flag(k string) bool {
+	b, _ := o[k].(bool)
+	return b
+}
+
+func (o handlerOptions) strMap(k string) map[string]string {
+	switch v := o[k].(type) {
+	case map[string]string:
+		return v
+	case map[string]interface{}:
+		m := make(map[string]string, len(v))
+		for k, s := range v {
+			if s, ok := s.(string); ok {
+				m[k] = s
+			}
+		}
+		return m
+	}
+	return nil
+}
+
+// topicHandlerOptions returns the kind and options of the kapacitor handler
+// of the single handler of n.
+func topicHandlerOptions(n cloudhub.AlertNodes) (string, handlerOptions, error) {
+	var kinds []string
+	var options handlerOptions
+	add := func(kind string) handlerOptions {
+		kinds = append(kinds, kind)
+		options = handlerOptions{}
+		return options
+	}
+
+	for _, p := range n.Posts {
+		if p == nil {
+			continue
+		}
+		if p.URL == "" {
+			return "", nil, fmt.Errorf("url required in post handler")
+		}
+		o := add("post")
+		o.set("url", p.URL)
+		o.set("headers", p.Headers)
+	}
+	for _, t := range n.TCPs {
+		if t == nil {
+			continue
+		}
+		if t.Address == "" {
+			return "", nil, fmt.Errorf("address required in tcp handler")
+		}
+		add("tcp").set("address", t.Address)
+	}
+	for _, e := range n.Email {
+		if e == nil {
+			continue
+		}
+		add("smtp").set("to", e.To)
+	}
+	for _, e := range n.Exec {
+		if e == nil {
+			continue
+		}
+		if len(e.Command) == 0 || e.Command[0] == "" {
+			return "", nil, fmt.Errorf("command required in exec handler")
+		}
+		o := add("exec")
+		o.set("prog", e.Command[0])
+		o.set("args", e.Command[1:])
+	}
+	for _, l := range n.Log {
+		if l == nil {
+			continue
+		}
+		if !path.IsAbs(l.FilePath) {
+			return "", nil, fmt.Errorf("absolute filePath required in log handler")
+		}
+		add("log").set("path", l.FilePath)
+	}
+	for _, v := range n.VictorOps {
+		if v == nil {
+			continue
+		}
+		add("victorops").set("routing-key", v.RoutingKey)
+	}
+	for _, p := range n.PagerDuty {
+		if p == nil {
+			continue
+		}
+		add("pagerduty").set("service-key", p.ServiceKey)
+	}
+	for _, p := range n.PagerDuty2 {
+		if p == nil {
+			continue
+		}
+		add("pagerduty2").set("routing-key", p.ServiceKey)
+	}
+	for _, p := range n.Pushover {
+		if p == nil {
+			continue
+		}
+		o := add("pushover")
+		o.set("user-key", p.UserKey)
+		o.set("device", p.Device)
+		o.set("title", p.Title)
+		o.set("url", p.URL)
+		o.set("url-title", p.URLTitle)
+		o.set("sound", p.Sound)
+	}
+	for _, s := range n.Sensu {
+		if s == nil {
+			continue
+		}
+		o := add("sensu")
+		o.set("source", s.Source)
+		o.set("handlers", s.Handlers)
+	}
+	for _, s := range n.Slack {
+		if s == nil {
+			continue
+		}
+		o := add("slack")
+		o.set("workspace", s.Workspace)
+		o.set("channel", s.Channel)
+		o.set("username", s.Username)
+		o.set("icon-emoji", s.IconEmoji)
+	}
+	for _, t := range n.Telegram {
+		if t == nil {
+			continue
+		}
+		o := add("telegram")
+		o.set("chat-id", t.ChatID)
+		o.set("parse-mode", t.ParseMode)
+		o.set("disable-web-page-preview", t.DisableWebPagePreview)
+		o.set("disable-notification", t.DisableNotification)
+	}
+	for _, a := range n.Alerta {
+		if a == nil {
+			continue
+		}
+		o := add("alerta")
+		o.set("token", a.Token)
+		o.set("resource", a.Resource)
+		o.set("event", a.Event)
+		o.set("environment", a.Environment)
+		o.set("group", a.Group)
+		o.set("value", a.Value)
+		o.set("origin", a.Origin)
+		o.set("service", a.Service)
+	}
+	for _, g := range n.OpsGenie {
+		if g == nil {
+			continue
+		}
+		o := add("opsgenie")
+		o.set("teams-list", g.Teams)
+		o.set("recipients-list", g.Recipients)
+	}
+	for _, g := range n.OpsGenie2 {
+		if g == nil {
+			continue
+		}
+		o := add("opsgenie2")
+		o.set("teams-list", g.Teams)
+		o.set("recipients-list", g.Recipients)
+	}
+	for _, t := range n.Talk {
+		if t == nil {
+			continue
+		}
+		add("talk")
+	}
+	for _, k := range n.Kafka {
+		if k == nil {
+			continue
+		}
+		o := add("kafka")
+		o.set("cluster", k.Cluster)
+		o.set("topic", k.Topic)
+		o.set("template", k.Template)
+	}
+	for _, s := range n.ServiceNow {
+		if s == nil {
+			continue
+		}
+		// kapacitor decodes the fields other than source by their names
+		o := add("servicenow")
+		o.set("source", s.Source)
+		o.set("node", s.Node)
+		o.set("type", s.Type)
+		o.set("resource", s.Resource)
+		o.set("metricName", s.MetricName)
+		o.set("messageKey", s.MessageKey)
+	}
+
+	if len(kinds) != 1 {
+		return "", nil, fmt.Errorf("topic handler must have exactly one handler, got %d", len(kinds))
+	}
+	return kinds[0], options, nil
+}
+
+// topicAlertNodes returns the alert nodes of a kapacitor handler, or false
+// if AlertNodes has no handler of kind.
+func topicAlertNodes(kind string, o handlerOptions) (cloudhub.AlertNodes, bool) {
+	var n cloudhub.AlertNodes
+	switch kind {
+	case "post":
+		n.Posts = []*cloudhub.Post{{URL: o.str("url"), Headers: o.strMap("headers")}}
+	case "tcp":
+		n.TCPs = []*cloudhub.TCP{{Address: o.str("address")}}
+	case "smtp":
+		n.Email = []*cloudhub.Email{{To: o.strs("to")}}
+	case "exec":
+		n.Exec = []*cloudhub.Exec{{Command: append([]string{o.str("prog")}, o.strs("args")...)}}
+	case "log":
+		n.Log = []*cloudhub.Log{{FilePath: o.str("path")}}
+	case "victorops":
+		n.VictorOps = []*cloudhub.VictorOps{{RoutingKey: o.str("routing-key")}}
+	case "pagerduty":
+		n.PagerDuty = []*cloudhub.PagerDuty{{ServiceKey: o.str("service-key")}}
+	case "pagerduty2":
+		n.PagerDuty2 = []*cloudhub.PagerDuty{{ServiceKey: o.str("routing-key")}}
+	case "pushover":
+		n.Pushover = []*cloudhub.Pushover{{
+			UserKey:  o.str("user-key"),
+			Device:   o.str("device"),
+			Title:    o.str("title"),
+			URL:      o.str("url"),
+			URLTitle: o.str("url-title"),
+			Sound:    o.str("sound"),
+		}}
+	case "sensu":
+		n.Sensu = []*cloudhub.Sensu{{Source: o.str("source"), Handlers: o.strs("handlers")}}
+	case "slack":
+		n.Slack = []*cloudhub.Slack{{
+			Workspace: o.str("workspace"),
+			Channel:   o.str("channel"),
+			Username:  o.str("username"),
+			IconEmoji: o.str("icon-emoji"),
+		}}
+	case "telegram":
+		n.Telegram = []*cloudhub.Telegram{{
+			ChatID:                o.str("chat-id"),
+			ParseMode:             o.str("parse-mode"),
+			DisableWebPagePreview: o.flag("disable-web-page-preview"),
+			DisableNotification:   o.flag("disable-notification"),
+		}}
+	case "alerta":
+		n.Alerta = []*cloudhub.Alerta{{
+			Token:       o.str("token"),
+			Resource:    o.str("resource"),
+			Event:       o.str("event"),
+			Environment: o.str("environment"),
+			Group:       o.str("group"),
+			Value:       o.str("value"),
+			Origin:      o.str("origin"),
+			Service:     o.strs("service"),
+		}}
+	case "opsgenie":
+		n.OpsGenie = []*cloudhub.OpsGenie{{Teams: o.strs("teams-list"), Recipients: o.strs("recipients-list")}}
+	case "opsgenie2":
+		n.OpsGenie2 = []*cloudhub.OpsGenie{{Teams: o.strs("teams-list"), Recipients: o.strs("recipients-list")}}
+	case "talk":
+		n.Talk = []*cloudhub.Talk{{}}
+	case "kafka":
+		n.Kafka = []*cloudhub.Kafka{{Cluster: o.str("cluster"), Topic: o.str("topic"), Template: o.str("template")}}
+	case "servicenow":
+		n.ServiceNow = []*cloudhub.ServiceNow{{
+			Source:     o.str("source"),
+			Node:       o.str("node"),
+			Type:       o.str("type"),
+			Resource:   o.str("resource"),
+			MetricName: o.str("metricName"),
+			MessageKey: o.str("messageKey"),
+		}}
+	default:
+		return n, false
+	}
+	return n, true
+}
+
+// NewTopicHandler converts a kapacitor handler of topic into a TopicHandler
+func NewTopicHandler(topic string, h client.TopicHandler) *TopicHandler {
+	res := &TopicHandler{
+		ID:    h.ID,
+		Topic: topic,
+		Kind:  h.Kind,
+		Match: h.Match,
+	}
+	if n, ok := topicAlertNodes(h.Kind, h.Options); ok {
+		res.AlertNodes = n
+	} else {
+		res.Options = h.Options
+	}
+	return res
+}
+
+// topicLink returns the link of the elements of topic. The kapacitor client
+// escapes the path of links, so the topic and elements are checked to be
+// single path segments rather than escaped, which would escape them twice.
+func topicLink(topic string, elem ...string) (client.Link, error) {
+	if err := validTopicSegment("topic", topic); err != nil {
+		return client.Link{}, err
+	}
+	for _, e := range elem {
+		if err := validTopicSegment("topic handler id", e); err != nil {
+			return client.Link{}, err
+		}
+	}
+	return client.Link{Relation: client.Self, Href: path.Join(append([]string{topicsPath, topic}, elem...)...)}, nil
+}
+
+// validTopicSegment checks that v, the name of a topic or handler, is a
+// single segment of a kapacitor path.
+func validTopicSegment(name, v string) error {
+	if v == "" {
+		return fmt.Errorf("%s required", name)
+	}
+	if strings.Contains(v, "/") || v == "." || v == ".." {
+		return fmt.Errorf("%s %q is not a valid path segment", name, v)
+	}
+	return nil
+}
+
+// Topics lists the topics of kapacitor whose level is at least minLevel
+func (c *Client) Topics(ctx context.Context, pattern, minLevel string) ([]Topic, error) {
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := kapa.ListTopics(&client.ListTopicsOptions{Pattern: pattern, MinLevel: minLevel})
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make([]Topic, len(res.Topics))
+	for i, t := range res.Topics {
+		topics[i] = Topic{ID: t.ID, Level: t.Level, Collected: t.Collected}
+	}
+	return topics, nil
+}
+
+// TopicEvents lists the events of topic whose level is at least minLevel
+func (c *Client) TopicEvents(ctx context.Context, topic, minLevel string) ([]TopicEvent, error) {
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := topicLink(topic, "events")
+	if err != nil {
+		return nil, err
+	}
+	res, err := kapa.ListTopicEvents(link, &client.ListTopicEventsOptions{MinLevel: minLevel})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]TopicEvent, len(res.Events))
+	for i, e := range res.Events {
+		events[i] = TopicEvent{
+			ID:       e.ID,
+			Message:  e.State.Message,
+			Details:  e.State.Details,
+			Time:     e.State.Time,
+			Duration: time.Duration(e.State.Duration),
+			Level:    e.State.Level,
+		}
+	}
+	return events, nil
+}
+
+// TopicHandlers lists the handlers of topic
+func (c *Client) TopicHandlers(ctx context.Context, topic string) ([]*TopicHandler, error) {
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := topicLink(topic, "handlers")
+	if err != nil {
+		return nil, err
+	}
+	res, err := kapa.ListTopicHandlers(link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	handlers := make([]*TopicHandler, len(res.Handlers))
+	for i, h := range res.Handlers {
+		handlers[i] = NewTopicHandler(topic, h)
+	}
+	return handlers, nil
+}
+
+// TopicHandler returns the handler id of topic, or ErrTopicHandlerNotFound
+func (c *Client) TopicHandler(ctx context.Context, topic, id string) (*TopicHandler, error) {
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := topicLink(topic, "handlers", id)
+	if err != nil {
+		return nil, err
+	}
+	h, err := kapa.TopicHandler(link)
+	if err != nil {
+		return nil, ErrTopicHandlerNotFound
+	}
+	return NewTopicHandler(topic, h), nil
+}
+
+// CreateTopicHandler adds the handler h to its topic
+func (c *Client) CreateTopicHandler(ctx context.Context, h *TopicHandler) (*TopicHandler, error) {
+	opt, err := topicHandlerCreateOptions(h)
+	if err != nil {
+		return nil, err
+	}
+
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := topicLink(h.Topic, "handlers")
+	if err != nil {
+		return nil, err
+	}
+	res, err := kapa.CreateTopicHandler(link, *opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewTopicHandler(h.Topic, res), nil
+}
+
+// UpdateTopicHandler replaces the handler of the ID of h in its topic
+func (c *Client) UpdateTopicHandler(ctx context.Context, h *TopicHandler) (*TopicHandler, error) {
+	opt, err := topicHandlerCreateOptions(h)
+	if err != nil {
+		return nil, err
+	}
+
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := topicLink(h.Topic, "handlers", h.ID)
+	if err != nil {
+		return nil, err
+	}
+	res, err := kapa.ReplaceTopicHandler(link, *opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewTopicHandler(h.Topic, res), nil
+}
+
+// DeleteTopicHandler removes the handler id of topic
+func (c *Client) DeleteTopicHandler(ctx context.Context, topic, id string) error {
+	kapa, err := c.kapaClient(c.URL, c.Username, c.Password, c.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	link, err := topicLink(topic, "handlers", id)
+	if err != nil {
+		return err
+	}
+	return kapa.DeleteTopicHandler(link)
+}
+
+func topicHandlerCreateOptions(h *TopicHandler) (*client.TopicHandlerOptions, error) {
+	if err := h.Valid(); err != nil {
+		return nil, err
+	}
+	kind, options, err := topicHandlerOptions(h.AlertNodes)
+	if err != nil {
+		return nil, err
+	}
+	return &client.TopicHandlerOptions{
+		Topic:   h.Topic,
+		ID:      h.ID,
+		Kind:    kind,
+		Options: options,
+		Match:   h.Match,
+	}, nil
+}
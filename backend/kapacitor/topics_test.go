@@ -0,0 +1,184 @@
+package kapacitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	client "github.com/influxdata/kapacitor/client/v1"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+func Test_topicHandlerOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodes       cloudhub.AlertNodes
+		wantKind    string
+		wantOptions string
+		wantErr     bool
+	}{
+		{
+			name:        "Slack",
+			nodes:       cloudhub.AlertNodes{Slack: []*cloudhub.Slack{{Channel: "#ops", IconEmoji: ":fire:"}}},
+			wantKind:    "slack",
+			wantOptions: `{"channel":"#ops","icon-emoji":":fire:"}`,
+		},
+		{
+			name:        "Exec",
+			nodes:       cloudhub.AlertNodes{Exec: []*cloudhub.Exec{{Command: []string{"/bin/notify", "-u", "ops"}}}},
+			wantKind:    "exec",
+			wantOptions: `{"args":["-u","ops"],"prog":"/bin/notify"}`,
+		},
+		{
+			name:        "PagerDuty v2",
+			nodes:       cloudhub.AlertNodes{PagerDuty2: []*cloudhub.PagerDuty{{ServiceKey: "key"}}},
+			wantKind:    "pagerduty2",
+			wantOptions: `{"routing-key":"key"}`,
+		},
+		{
+			name:        "Email",
+			nodes:       cloudhub.AlertNodes{Email: []*cloudhub.Email{{To: []string{"ops@example.com"}}}},
+			wantKind:    "smtp",
+			wantOptions: `{"to":["ops@example.com"]}`,
+		},
+		{
+			name:        "Talk",
+			nodes:       cloudhub.AlertNodes{Talk: []*cloudhub.Talk{{}}},
+			wantKind:    "talk",
+			wantOptions: `{}`,
+		},
+		{
+			name:    "No handler",
+			nodes:   cloudhub.AlertNodes{},
+			wantErr: true,
+		},
+		{
+			name: "Two handlers",
+			nodes: cloudhub.AlertNodes{
+				Slack:     []*cloudhub.Slack{{Channel: "#ops"}},
+				PagerDuty: []*cloudhub.PagerDuty{{ServiceKey: "key"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Post without url",
+			nodes:   cloudhub.AlertNodes{Posts: []*cloudhub.Post{{}}},
+			wantErr: true,
+		},
+		{
+			name:    "Relative log path",
+			nodes:   cloudhub.AlertNodes{Log: []*cloudhub.Log{{FilePath: "alerts.log"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, options, err := topicHandlerOptions(tt.nodes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("topicHandlerOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			octets, _ := json.Marshal(options)
+			if kind != tt.wantKind || string(octets) != tt.wantOptions {
+				t.Errorf("topicHandlerOptions() = %s %s, want %s %s", kind, octets, tt.wantKind, tt.wantOptions)
+			}
+
+			// options read back from kapacitor are decoded from JSON
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(octets, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := topicAlertNodes(kind, decoded)
+			if !ok || !reflect.DeepEqual(got, tt.nodes) {
+				t.Errorf("topicAlertNodes() = %+v, %v, want %+v", got, ok, tt.nodes)
+			}
+		})
+	}
+}
+
+func TestClient_CreateTopicHandler(t *testing.T) {
+	kapa := &MockKapa{
+		ResTopicHandler: client.TopicHandler{
+			ID:      "ops-slack",
+			Kind:    "slack",
+			Options: map[string]interface{}{"channel": "#ops"},
+			Match:   `"level" == 'CRITICAL'`,
+		},
+	}
+	c := &Client{
+		kapaClient: func(url, username, password string, insecureSkipVerify bool) (KapaClient, error) {
+			return kapa, nil
+		},
+	}
+
+	h := &TopicHandler{
+		ID:         "ops-slack",
+		Topic:      "main:cpu:alert2",
+		Match:      `"level" == 'CRITICAL'`,
+		AlertNodes: cloudhub.AlertNodes{Slack: []*cloudhub.Slack{{Channel: "#ops"}}},
+	}
+	got, err := c.CreateTopicHandler(context.Background(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kapa.Link.Href != "/kapacitor/v1/alerts/topics/main:cpu:alert2/handlers" {
+		t.Errorf("CreateTopicHandler() link = %s", kapa.Link.Href)
+	}
+	want := client.TopicHandlerOptions{
+		Topic:   "main:cpu:alert2",
+		ID:      "ops-slack",
+		Kind:    "slack",
+		Options: map[string]interface{}{"channel": "#ops"},
+		Match:   `"level" == 'CRITICAL'`,
+	}
+	if !reflect.DeepEqual(*kapa.TopicHandlerOptions, want) {
+		t.Errorf("CreateTopicHandler() options = %+v, want %+v", *kapa.TopicHandlerOptions, want)
+	}
+	if got.Kind != "slack" || got.Topic != h.Topic || !reflect.DeepEqual(got.AlertNodes, h.AlertNodes) || got.Options != nil {
+		t.Errorf("CreateTopicHandler() = %+v", got)
+	}
+
+	kapa.ResTopicHandler = client.TopicHandler{ID: "agg", Kind: "aggregate", Options: map[string]interface{}{"interval": "1m"}}
+	got, err = c.TopicHandler(context.Background(), h.Topic, "agg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != "aggregate" || got.Options["interval"] != "1m" {
+		t.Errorf("TopicHandler() of a kind without alert nodes = %+v", got)
+	}
+
+	kapa.TopicError = errors.New("handler does not exist")
+	if _, err := c.TopicHandler(context.Background(), h.Topic, "missing"); err != ErrTopicHandlerNotFound {
+		t.Errorf("TopicHandler() error = %v, want %v", err, ErrTopicHandlerNotFound)
+	}
+}
+
+func Test_topicLink(t *testing.T) {
+	tests := []struct {
+		topic   string
+		elem    []string
+		want    string
+		wantErr bool
+	}{
+		// the kapacitor client escapes the path of links
+		{topic: "main:cpu?#%", elem: []string{"handlers", "ops 1"}, want: "/kapacitor/v1/alerts/topics/main:cpu?#%/handlers/ops 1"},
+		{topic: "..", elem: []string{"handlers"}, wantErr: true},
+		{topic: "main/../../tasks", wantErr: true},
+		{topic: "main:cpu", elem: []string{"handlers", ".."}, wantErr: true},
+		{topic: "", elem: []string{"handlers"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		link, err := topicLink(tt.topic, tt.elem...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("topicLink(%q, %q) error = %v, wantErr %v", tt.topic, tt.elem, err, tt.wantErr)
+			continue
+		}
+		if link.Href != tt.want {
+			t.Errorf("topicLink(%q, %q) = %s, want %s", tt.topic, tt.elem, link.Href, tt.want)
+		}
+	}
+}
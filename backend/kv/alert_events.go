@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure alertEventsStore implements cloudhub.AlertEventsStore.
+var _ cloudhub.AlertEventsStore = &alertEventsStore{}
+
+// alertEventsStore is the bolt and etcd implementation of storing the events
+// of Kapacitor alerts. Keys start with the zero padded unix nano time of the
+// event, like the ones of the audit store, so that iterating the bucket
+// visits the events in chronological order.
+type alertEventsStore struct {
+	client *Service
+}
+
+// Add records a new alert event. The event time defaults to now.
+func (s *alertEventsStore) Add(ctx context.Context, e *cloudhub.AlertEvent) (*cloudhub.AlertEvent, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(alertEventsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = fmt.Sprintf("%019d-%016x", e.Time.UnixNano(), seq)
+
+		v, err := internal.MarshalAlertEvent(e)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(e.ID), v)
+	}); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// All returns the alert events matching q, newest first. The bucket is read
+// backwards from the end of the time range until q.Limit events are found.
+func (s *alertEventsStore) All(ctx context.Context, q cloudhub.AlertEventQuery) ([]cloudhub.AlertEvent, error) {
+	var events []cloudhub.AlertEvent
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		events = nil
+		start, end := auditKeyRange(q.Start, q.End)
+		err := tx.Bucket(alertEventsBucket).ForEachReverse(start, end, func(k, v []byte) error {
+			var e cloudhub.AlertEvent
+			if err := internal.UnmarshalAlertEvent(v, &e); err != nil {
+				return err
+			}
+			if !alertEventMatches(&e, q) {
+				return nil
+			}
+			events = append(events, e)
+			if q.Limit > 0 && len(events) >= q.Limit {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err == errStopIteration {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Prune removes the alert events older than before, returning the number of
+// events removed.
+func (s *alertEventsStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	return pruneBucket(ctx, s.client, alertEventsBucket, before)
+}
+
+func alertEventMatches(e *cloudhub.AlertEvent, q cloudhub.AlertEventQuery) bool {
+	if !q.Start.IsZero() && e.Time.Before(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && !e.Time.Before(q.End) {
+		return false
+	}
+	if q.Organization != "" && e.Organization != q.Organization {
+		return false
+	}
+	if q.KapacitorID != 0 && e.KapacitorID != q.KapacitorID {
+		return false
+	}
+	if q.RuleID != "" && e.RuleID != q.RuleID {
+		return false
+	}
+	if q.Level != "" && e.Level != q.Level {
+		return false
+	}
+	if q.Host != "" && e.Host != q.Host {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure an AlertEventsStore can record and query alert events.
+func TestAlertEventsStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.AlertEventsStore()
+
+	base := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	events := []cloudhub.AlertEvent{
+		{Time: base, Organization: "default", KapacitorID: 1, RuleID: "cloudhub-v1-a", AlertID: "cpu:host=web1", Level: cloudhub.AlertLevelCritical, PreviousLevel: cloudhub.AlertLevelOK, Host: "web1",
+			Tags: map[string]string{"host": "web1", "cpu": "cpu-total"}, Message: "cpu is high"},
+		{Time: base.Add(time.Minute), Organization: "default", KapacitorID: 1, RuleID: "cloudhub-v1-b", AlertID: "mem:host=web2", Level: cloudhub.AlertLevelWarning, Host: "web2"},
+		{Time: base.Add(2 * time.Minute), Organization: "default", KapacitorID: 1, RuleID: "cloudhub-v1-a", AlertID: "cpu:host=web1", Level: cloudhub.AlertLevelOK, PreviousLevel: cloudhub.AlertLevelCritical, Host: "web1",
+			Duration: 2 * time.Minute},
+		{Time: base.Add(3 * time.Minute), Organization: "1", KapacitorID: 2, RuleID: "cloudhub-v1-c", AlertID: "disk:host=db1", Level: cloudhub.AlertLevelCritical, Host: "db1"},
+	}
+	for i := range events {
+		e, err := s.Add(ctx, &events[i])
+		if err != nil {
+			t.Fatalf("failed to add alert event: %v", err)
+		}
+		if e.ID == "" {
+			t.Fatalf("alert event was not assigned an ID")
+		}
+	}
+
+	all, err := s.All(ctx, cloudhub.AlertEventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(events) {
+		t.Fatalf("All() returned %d events, want %d", len(all), len(events))
+	}
+	if all[0].ID != events[3].ID || all[3].ID != events[0].ID {
+		t.Fatalf("All() did not return the newest events first: %v", all)
+	}
+	if got := all[3]; got.Tags["cpu"] != "cpu-total" || got.PreviousLevel != cloudhub.AlertLevelOK || got.Message != "cpu is high" || !got.Time.Equal(base) {
+		t.Fatalf("alert event loaded is different than alert event saved; actual: %v, expected %v", got, events[0])
+	}
+	if all[1].Duration != 2*time.Minute {
+		t.Fatalf("alert event duration = %v, want %v", all[1].Duration, 2*time.Minute)
+	}
+
+	tests := []struct {
+		name string
+		q    cloudhub.AlertEventQuery
+		want []string
+	}{
+		{
+			name: "by organization and kapacitor",
+			q:    cloudhub.AlertEventQuery{Organization: "default", KapacitorID: 1},
+			want: []string{events[2].ID, events[1].ID, events[0].ID},
+		},
+		{
+			name: "by rule and level",
+			q:    cloudhub.AlertEventQuery{RuleID: "cloudhub-v1-a", Level: cloudhub.AlertLevelCritical},
+			want: []string{events[0].ID},
+		},
+		{
+			name: "by host",
+			q:    cloudhub.AlertEventQuery{Host: "web2"},
+			want: []string{events[1].ID},
+		},
+		{
+			name: "by time range",
+			q:    cloudhub.AlertEventQuery{Start: base.Add(time.Minute), End: base.Add(3 * time.Minute)},
+			want: []string{events[2].ID, events[1].ID},
+		},
+		{
+			name: "limited",
+			q:    cloudhub.AlertEventQuery{Limit: 2},
+			want: []string{events[3].ID, events[2].ID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.All(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, e := range got {
+				ids = append(ids, e.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("All() = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("All() = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertEventsStore_Prune(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.AlertEventsStore()
+
+	base := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 250; i++ {
+		if _, err := s.Add(ctx, &cloudhub.AlertEvent{Time: base.Add(time.Duration(i) * time.Minute), Organization: "default", Level: cloudhub.AlertLevelCritical}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := s.Prune(ctx, base.Add(220*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 220 {
+		t.Errorf("Prune() = %d, want 220", pruned)
+	}
+
+	all, err := s.All(ctx, cloudhub.AlertEventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 30 || !all[len(all)-1].Time.Equal(base.Add(220*time.Minute)) {
+		t.Fatalf("All() after Prune() returned %d events, the oldest at %v", len(all), all[len(all)-1].Time)
+	}
+
+	page, err := s.All(ctx, cloudhub.AlertEventQuery{End: base.Add(240 * time.Minute), Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 5 || !page[0].Time.Equal(base.Add(239*time.Minute)) {
+		t.Errorf("All() with a limit returned %d events, the newest at %v", len(page), page[0].Time)
+	}
+}
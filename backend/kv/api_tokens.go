@@ -0,0 +1,183 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure apiTokensStore implements cloudhub.APITokensStore.
+var _ cloudhub.APITokensStore = &apiTokensStore{}
+
+// apiTokensStore uses a kv to store and retrieve API tokens. Tokens are
+// also indexed by the hash of their secret, which is how every request
+// authenticated by a token finds it.
+type apiTokensStore struct {
+	client *Service
+}
+
+// Add creates a new APIToken in the apiTokensStore
+func (s *apiTokensStore) Add(ctx context.Context, t *cloudhub.APIToken) (*cloudhub.APIToken, error) {
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(apiTokensBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		t.ID = strconv.FormatUint(seq, 10)
+
+		v, err := internal.MarshalAPIToken(t)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(t.ID), v); err != nil {
+			return err
+		}
+		return indexAPIToken(tx, nil, t)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// All returns all known API tokens
+func (s *apiTokensStore) All(ctx context.Context) ([]cloudhub.APIToken, error) {
+	var tokens []cloudhub.APIToken
+	err := s.each(ctx, func(t *cloudhub.APIToken) bool {
+		tokens = append(tokens, *t)
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Delete the API token from the apiTokensStore
+func (s *apiTokensStore) Delete(ctx context.Context, t *cloudhub.APIToken) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		cur, err := getAPIToken(tx, t.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(apiTokensBucket).Delete([]byte(t.ID)); err != nil {
+			return err
+		}
+		return indexAPIToken(tx, cur, nil)
+	})
+}
+
+// Get returns an API token by ID or by the hash of its secret
+func (s *apiTokensStore) Get(ctx context.Context, q cloudhub.APITokenQuery) (*cloudhub.APIToken, error) {
+	if q.ID != nil {
+		return s.get(ctx, *q.ID)
+	}
+	if q.Hash == nil || *q.Hash == "" {
+		return nil, cloudhub.ErrAPITokenNotFound
+	}
+
+	var t *cloudhub.APIToken
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		// etcd errors for keys that are not found, bolt returns nil
+		id, _ := tx.Bucket(apiTokenHashesBucket).Get([]byte(*q.Hash))
+		if len(id) == 0 {
+			return cloudhub.ErrAPITokenNotFound
+		}
+		var err error
+		t, err = getAPIToken(tx, string(id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.Hash != *q.Hash {
+		return nil, cloudhub.ErrAPITokenNotFound
+	}
+
+	return t, nil
+}
+
+// Update the API token in the apiTokensStore
+func (s *apiTokensStore) Update(ctx context.Context, t *cloudhub.APIToken) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		cur, err := getAPIToken(tx, t.ID)
+		if err != nil {
+			return err
+		}
+		if v, err := internal.MarshalAPIToken(t); err != nil {
+			return err
+		} else if err := tx.Bucket(apiTokensBucket).Put([]byte(t.ID), v); err != nil {
+			return err
+		}
+		return indexAPIToken(tx, cur, t)
+	})
+}
+
+func (s *apiTokensStore) get(ctx context.Context, id string) (*cloudhub.APIToken, error) {
+	var t *cloudhub.APIToken
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		var err error
+		t, err = getAPIToken(tx, id)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func getAPIToken(tx Tx, id string) (*cloudhub.APIToken, error) {
+	var t cloudhub.APIToken
+	v, err := tx.Bucket(apiTokensBucket).Get([]byte(id))
+	if v == nil || err != nil {
+		return nil, cloudhub.ErrAPITokenNotFound
+	}
+	if err := internal.UnmarshalAPIToken(v, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// indexAPIToken replaces the hash index entry of the token from with the
+// one of the token to. Either may be nil.
+func indexAPIToken(tx Tx, from, to *cloudhub.APIToken) error {
+	b := tx.Bucket(apiTokenHashesBucket)
+	if from != nil && from.Hash != "" && (to == nil || to.Hash != from.Hash) {
+		if err := b.Delete([]byte(from.Hash)); err != nil {
+			return err
+		}
+	}
+	if to != nil && to.Hash != "" {
+		return b.Put([]byte(to.Hash), []byte(to.ID))
+	}
+	return nil
+}
+
+// each calls fn for every token until fn returns false
+func (s *apiTokensStore) each(ctx context.Context, fn func(*cloudhub.APIToken) bool) error {
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(apiTokensBucket).ForEach(func(k, v []byte) error {
+			var t cloudhub.APIToken
+			if err := internal.UnmarshalAPIToken(v, &t); err != nil {
+				return err
+			}
+			if !fn(&t) {
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if err == errStopIteration {
+		return nil
+	}
+	return err
+}
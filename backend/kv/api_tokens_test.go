@@ -0,0 +1,84 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure an APITokensStore can store, find, update and remove API tokens.
+func TestAPITokensStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.APITokensStore()
+
+	created := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	tokens := []cloudhub.APIToken{
+		{Name: "ci", Organization: "default", Role: "editor", Hash: "aaaa", Prefix: "chub_abcdef", CreatedBy: "alice", CreatedAt: created},
+		{Name: "backup", Organization: "1", Role: "viewer", Hash: "bbbb", CreatedAt: created, ExpiresAt: created.Add(24 * time.Hour)},
+	}
+	for i := range tokens {
+		tok, err := s.Add(ctx, &tokens[i])
+		if err != nil {
+			t.Fatalf("failed to add api token: %v", err)
+		}
+		if tok.ID == "" {
+			t.Fatalf("api token was not assigned an ID")
+		}
+	}
+
+	hash := "bbbb"
+	got, err := s.Get(ctx, cloudhub.APITokenQuery{Hash: &hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != tokens[1].ID || !got.ExpiresAt.Equal(tokens[1].ExpiresAt) || !got.LastUsedAt.IsZero() {
+		t.Fatalf("api token loaded is different than api token saved; actual: %+v, expected %+v", got, tokens[1])
+	}
+
+	got, err = s.Get(ctx, cloudhub.APITokenQuery{ID: &tokens[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "ci" || got.CreatedBy != "alice" || !got.CreatedAt.Equal(created) || !got.ExpiresAt.IsZero() {
+		t.Fatalf("api token loaded is different than api token saved; actual: %+v, expected %+v", got, tokens[0])
+	}
+
+	got.LastUsedAt = created.Add(time.Hour)
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.Get(ctx, cloudhub.APITokenQuery{ID: &tokens[0].ID}); err != nil || !got.LastUsedAt.Equal(created.Add(time.Hour)) {
+		t.Fatalf("Update() did not store the last used time: %+v, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, &tokens[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, cloudhub.APITokenQuery{ID: &tokens[0].ID}); err != cloudhub.ErrAPITokenNotFound {
+		t.Fatalf("Get() of a deleted token error = %v, want %v", err, cloudhub.ErrAPITokenNotFound)
+	}
+	deleted := "aaaa"
+	if _, err := s.Get(ctx, cloudhub.APITokenQuery{Hash: &deleted}); err != cloudhub.ErrAPITokenNotFound {
+		t.Fatalf("Get() of the hash of a deleted token error = %v, want %v", err, cloudhub.ErrAPITokenNotFound)
+	}
+	missing := "cccc"
+	if _, err := s.Get(ctx, cloudhub.APITokenQuery{Hash: &missing}); err != cloudhub.ErrAPITokenNotFound {
+		t.Fatalf("Get() of an unknown hash error = %v, want %v", err, cloudhub.ErrAPITokenNotFound)
+	}
+
+	all, err := s.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Name != "backup" {
+		t.Fatalf("All() = %v, want only backup", all)
+	}
+}
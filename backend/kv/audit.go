@@ -0,0 +1,170 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure auditStore implements cloudhub.AuditStore.
+var _ cloudhub.AuditStore = &auditStore{}
+
+// errStopIteration ends a ForEach early without reporting an error.
+var errStopIteration = fmt.Errorf("stop iteration")
+
+// auditStore is the bolt and etcd implementation of storing audit events.
+// Keys start with the zero padded unix nano time of the event so that
+// iterating the bucket visits the events in chronological order.
+type auditStore struct {
+	client *Service
+}
+
+// Add records a new audit event. The event time defaults to now.
+func (s *auditStore) Add(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	if err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(auditBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = fmt.Sprintf("%019d-%016x", e.Time.UnixNano(), seq)
+
+		v, err := internal.MarshalAuditEvent(e)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(e.ID), v)
+	}); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// All returns the audit events matching q, newest first. The bucket is read
+// backwards from the end of the time range so that only the events up to
+// the requested page are read.
+func (s *auditStore) All(ctx context.Context, q cloudhub.AuditQuery) ([]cloudhub.AuditEvent, error) {
+	var events []cloudhub.AuditEvent
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		events = nil
+		skip := q.Offset
+		start, end := auditKeyRange(q.Start, q.End)
+		err := tx.Bucket(auditBucket).ForEachReverse(start, end, func(k, v []byte) error {
+			var e cloudhub.AuditEvent
+			if err := internal.UnmarshalAuditEvent(v, &e); err != nil {
+				return err
+			}
+			if !auditMatches(&e, q) {
+				return nil
+			}
+			if skip > 0 {
+				skip--
+				return nil
+			}
+			events = append(events, e)
+			if q.Limit > 0 && len(events) >= q.Limit {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err == errStopIteration {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// auditPruneBatchSize is the number of events pruneBucket removes per
+// transaction.
+const auditPruneBatchSize = 100
+
+// Prune removes the audit events older than before, returning the number of
+// events removed.
+func (s *auditStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	return pruneBucket(ctx, s.client, auditBucket, before)
+}
+
+// pruneBucket removes the events older than before from a bucket keyed like
+// the audit one, returning the number of events removed.
+func pruneBucket(ctx context.Context, client *Service, bucket []byte, before time.Time) (int, error) {
+	_, end := auditKeyRange(time.Time{}, before)
+
+	removed := 0
+	for {
+		var keys [][]byte
+		if err := client.kv.Update(ctx, func(tx Tx) error {
+			keys = nil
+			b := tx.Bucket(bucket)
+			err := b.ForEachReverse(nil, end, func(k, v []byte) error {
+				keys = append(keys, append([]byte(nil), k...))
+				if len(keys) >= auditPruneBatchSize {
+					return errStopIteration
+				}
+				return nil
+			})
+			if err != nil && err != errStopIteration {
+				return err
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return removed, err
+		}
+
+		removed += len(keys)
+		if len(keys) < auditPruneBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// auditKeyRange returns the audit bucket keys bounding the events in
+// [start, end), nil for a zero time. The keys are the zero padded unix nano
+// times the event keys start with.
+func auditKeyRange(start, end time.Time) ([]byte, []byte) {
+	var startKey, endKey []byte
+	if !start.IsZero() {
+		startKey = []byte(fmt.Sprintf("%019d", start.UnixNano()))
+	}
+	if !end.IsZero() {
+		endKey = []byte(fmt.Sprintf("%019d", end.UnixNano()))
+	}
+	return startKey, endKey
+}
+
+func auditMatches(e *cloudhub.AuditEvent, q cloudhub.AuditQuery) bool {
+	if !q.Start.IsZero() && e.Time.Before(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && !e.Time.Before(q.End) {
+		return false
+	}
+	if q.Actor != "" && e.Actor != q.Actor {
+		return false
+	}
+	if q.Organization != "" && e.Organization != q.Organization {
+		return false
+	}
+	if q.Action != "" && e.Action != q.Action {
+		return false
+	}
+	return true
+}
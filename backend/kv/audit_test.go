@@ -0,0 +1,155 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure an AuditStore can record and query audit events.
+func TestAuditStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.AuditStore()
+
+	base := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	events := []cloudhub.AuditEvent{
+		{Time: base, Actor: "alice", Organization: "default", Action: "Sources", Message: "influx has been created."},
+		{Time: base.Add(time.Minute), Actor: "bob", Organization: "default", Action: "Dashboards", Message: "cpu has been created."},
+		{Time: base.Add(2 * time.Minute), Actor: "alice", Organization: "1", Action: "Sources", Message: "influx has been modified.",
+			Before: json.RawMessage(`{"name":"influx"}`), After: json.RawMessage(`{"name":"influx2"}`), RequestID: "req-1"},
+		{Time: base.Add(3 * time.Minute), Actor: "alice", Organization: "default", Action: "Users", Message: "carol has been deleted."},
+	}
+	for i := range events {
+		e, err := s.Add(ctx, &events[i])
+		if err != nil {
+			t.Fatalf("failed to add audit event: %v", err)
+		}
+		if e.ID == "" {
+			t.Fatalf("audit event was not assigned an ID")
+		}
+	}
+
+	all, err := s.All(ctx, cloudhub.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(events) {
+		t.Fatalf("All() returned %d events, want %d", len(all), len(events))
+	}
+	if all[0].Message != events[3].Message || all[3].Message != events[0].Message {
+		t.Fatalf("All() did not return the newest events first: %v", all)
+	}
+	if string(all[1].Before) != `{"name":"influx"}` || all[1].RequestID != "req-1" || !all[1].Time.Equal(events[2].Time) {
+		t.Fatalf("audit event loaded is different than audit event saved; actual: %v, expected %v", all[1], events[2])
+	}
+
+	tests := []struct {
+		name string
+		q    cloudhub.AuditQuery
+		want []string
+	}{
+		{
+			name: "by user",
+			q:    cloudhub.AuditQuery{Actor: "alice"},
+			want: []string{events[3].ID, events[2].ID, events[0].ID},
+		},
+		{
+			name: "by organization and action",
+			q:    cloudhub.AuditQuery{Organization: "default", Action: "Sources"},
+			want: []string{events[0].ID},
+		},
+		{
+			name: "by time range",
+			q:    cloudhub.AuditQuery{Start: base.Add(time.Minute), End: base.Add(3 * time.Minute)},
+			want: []string{events[2].ID, events[1].ID},
+		},
+		{
+			name: "paginated",
+			q:    cloudhub.AuditQuery{Offset: 1, Limit: 2},
+			want: []string{events[2].ID, events[1].ID},
+		},
+		{
+			name: "paginated by user",
+			q:    cloudhub.AuditQuery{Actor: "alice", Offset: 1, Limit: 1},
+			want: []string{events[2].ID},
+		},
+		{
+			name: "paginated by time range",
+			q:    cloudhub.AuditQuery{Start: base, End: base.Add(3 * time.Minute), Offset: 2, Limit: 5},
+			want: []string{events[0].ID},
+		},
+		{
+			name: "offset past the end",
+			q:    cloudhub.AuditQuery{Offset: 10},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.All(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, e := range got {
+				ids = append(ids, e.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("All() = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("All() = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// Ensure an AuditStore prunes the audit events older than a time.
+func TestAuditStore_Prune(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.AuditStore()
+
+	base := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 250; i++ {
+		if _, err := s.Add(ctx, &cloudhub.AuditEvent{Time: base.Add(time.Duration(i) * time.Minute), Action: "Sources"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := s.Prune(ctx, base.Add(220*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 220 {
+		t.Errorf("Prune() = %d, want 220", pruned)
+	}
+
+	all, err := s.All(ctx, cloudhub.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 30 || !all[len(all)-1].Time.Equal(base.Add(220*time.Minute)) {
+		t.Fatalf("All() after Prune() returned %d events, the oldest at %v", len(all), all[len(all)-1].Time)
+	}
+
+	if pruned, err := s.Prune(ctx, base); err != nil || pruned != 0 {
+		t.Errorf("Prune() of nothing = %d, %v", pruned, err)
+	}
+}
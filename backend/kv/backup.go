@@ -0,0 +1,335 @@
+package kv
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	// BackupFormat is the version of the layout of backup archives.
+	BackupFormat = 1
+
+	backupManifestName = "manifest.json"
+	backupBucketPrefix = "buckets/"
+)
+
+// BackupManifest describes the content of a backup archive. It is the first
+// file of the archive.
+type BackupManifest struct {
+	Format        int            `json:"format"`
+	SchemaVersion int            `json:"schemaVersion"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Buckets       []BackupBucket `json:"buckets"`
+}
+
+// BackupBucket describes a bucket of a backup archive.
+type BackupBucket struct {
+	Name     string `json:"name"`
+	Keys     int    `json:"keys"`
+	Sequence uint64 `json:"sequence,omitempty"` // Sequence is the last ID handed out by the bucket, if it counts them
+	Checksum string `json:"checksum"`
+}
+
+// Backup is a backup archive read into memory, to be restored.
+//
+// A backup archive is a gzip compressed tar file. Its first file is the
+// manifest as JSON, followed by a file named buckets/<name> for each bucket,
+// holding its keys and values in key order, each prefixed with its length
+// as an unsigned varint.
+type Backup struct {
+	Manifest BackupManifest
+	buckets  map[string]map[string][]byte
+}
+
+// Manifest describes every bucket of the store at the same point in time,
+// as the manifest of a backup taken then would.
+func (s *Service) Manifest(ctx context.Context) (BackupManifest, error) {
+	var m BackupManifest
+	err := s.kv.View(ctx, func(tx Tx) error {
+		var err error
+		m, _, err = readManifest(tx)
+		return err
+	})
+	return m, err
+}
+
+// WriteBackup writes a backup archive of every bucket of the store, read at
+// the same point in time, to w. Within one transaction the buckets are read
+// once for the manifest, then once more to write their keys and values to
+// the archive as they are read, so that the store is never held in memory.
+// It returns the number of bytes written to w.
+func (s *Service) WriteBackup(ctx context.Context, w io.Writer, createdAt time.Time) (int64, error) {
+	cw := &countingWriter{w: w}
+	written := false
+	err := s.kv.View(ctx, func(tx Tx) error {
+		// etcd runs the transaction again if the keys it read changed, when
+		// part of the archive may have been written already
+		if written {
+			return errors.New("the store changed while the backup was written")
+		}
+		manifest, sizes, err := readManifest(tx)
+		if err != nil {
+			return err
+		}
+		manifest.CreatedAt = createdAt.UTC()
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		written = true
+		zw := gzip.NewWriter(cw)
+		tw := tar.NewWriter(zw)
+		if err := writeTarFile(tw, backupManifestName, data, manifest.CreatedAt); err != nil {
+			return err
+		}
+		n := make([]byte, binary.MaxVarintLen64)
+		for i, name := range buckets {
+			if err := tw.WriteHeader(tarHeader(backupBucketPrefix+string(name), sizes[i], manifest.CreatedAt)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(name).ForEach(func(k, v []byte) error {
+				return writeRecord(tw, n, k, v)
+			}); err != nil {
+				return fmt.Errorf("unable to read bucket %s: %v", name, err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+	return cw.n, err
+}
+
+// readManifest reads the manifest of a backup of the buckets of tx, along
+// with the size each bucket has in the archive.
+func readManifest(tx Tx) (BackupManifest, []int64, error) {
+	m := BackupManifest{Format: BackupFormat}
+	v, _, err := readSchemaVersion(tx)
+	if err != nil {
+		return m, nil, err
+	}
+	m.SchemaVersion = v
+
+	sizes := make([]int64, 0, len(buckets))
+	for _, name := range buckets {
+		bkt := tx.Bucket(name)
+		var seq uint64
+		if sq, ok := bkt.(sequencer); ok {
+			seq = sq.Sequence()
+		}
+		c := newChecksummer()
+		keys, size := 0, int64(0)
+		if err := bkt.ForEach(func(k, v []byte) error {
+			keys++
+			size += recordSize(k) + recordSize(v)
+			c.add(k, v)
+			return nil
+		}); err != nil {
+			return m, nil, fmt.Errorf("unable to read bucket %s: %v", name, err)
+		}
+		m.Buckets = append(m.Buckets, BackupBucket{
+			Name:     string(name),
+			Keys:     keys,
+			Sequence: seq,
+			Checksum: c.sum(),
+		})
+		sizes = append(sizes, size)
+	}
+	return m, sizes, nil
+}
+
+// ReadBackup reads a backup archive. The format and the schema version of
+// the archive are checked first, and the checksum of every bucket is
+// verified, so a backup that is returned can be restored as is. Backups of
+// older schema versions are migrated once they are restored.
+func ReadBackup(r io.Reader) (*Backup, error) {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %v", err)
+	}
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %v", err)
+	}
+	if hdr.Name != backupManifestName {
+		return nil, fmt.Errorf("not a backup archive: %s is not the first file", backupManifestName)
+	}
+	b := &Backup{buckets: map[string]map[string][]byte{}}
+	if err := json.NewDecoder(tr).Decode(&b.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %v", err)
+	}
+	if b.Manifest.Format != BackupFormat {
+		return nil, fmt.Errorf("backup archive format %d is not supported, only %d is", b.Manifest.Format, BackupFormat)
+	}
+	if b.Manifest.SchemaVersion < 1 {
+		return nil, fmt.Errorf("backup has invalid schema version %d", b.Manifest.SchemaVersion)
+	}
+	if b.Manifest.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("backup has schema version %d, which is newer than version %d of this version of cloudhub", b.Manifest.SchemaVersion, SchemaVersion)
+	}
+
+	described := map[string]BackupBucket{}
+	for _, bkt := range b.Manifest.Buckets {
+		if !knownBucket([]byte(bkt.Name)) {
+			return nil, fmt.Errorf("backup has unknown bucket %q", bkt.Name)
+		}
+		described[bkt.Name] = bkt
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read backup archive: %v", err)
+		}
+		name := strings.TrimPrefix(hdr.Name, backupBucketPrefix)
+		bkt, ok := described[name]
+		if !ok || name == hdr.Name {
+			return nil, fmt.Errorf("backup has unexpected file %s", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read bucket %s of the backup: %v", name, err)
+		}
+		kvs, err := decodeBucket(data)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %s of the backup is corrupt: %v", name, err)
+		}
+		if len(kvs) != bkt.Keys || checksum(kvs) != bkt.Checksum {
+			return nil, fmt.Errorf("bucket %s of the backup does not match its checksum", name)
+		}
+		b.buckets[name] = kvs
+	}
+
+	for name := range described {
+		if _, ok := b.buckets[name]; !ok {
+			return nil, fmt.Errorf("bucket %s of the backup is missing", name)
+		}
+	}
+	return b, nil
+}
+
+// Restore makes every bucket of the store hold the keys and values of the
+// backup, then applies the migrations the backup is missing. Buckets that
+// are not in the backup are emptied. Keys that already match are not
+// written again, so a restore that failed part way is resumed by restoring
+// again.
+func (s *Service) Restore(ctx context.Context, b *Backup) error {
+	if latest := s.LatestSchemaVersion(); b.Manifest.SchemaVersion > latest {
+		return fmt.Errorf("backup has schema version %d, which is newer than version %d of this version of cloudhub", b.Manifest.SchemaVersion, latest)
+	}
+
+	seqs := map[string]uint64{}
+	for _, bkt := range b.Manifest.Buckets {
+		seqs[bkt.Name] = bkt.Sequence
+	}
+	for _, name := range buckets {
+		kvs := b.buckets[string(name)]
+		if kvs == nil {
+			kvs = map[string][]byte{}
+		}
+		if err := s.replace(ctx, name, kvs, seqs[string(name)]); err != nil {
+			return fmt.Errorf("unable to restore bucket %s: %v", name, err)
+		}
+	}
+
+	// backups taken before versions were recorded have no meta bucket
+	if err := s.setSchemaVersion(ctx, b.Manifest.SchemaVersion); err != nil {
+		return err
+	}
+	if s.skipMigrations {
+		return nil
+	}
+	_, err := s.Migrate(ctx, 0)
+	return err
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(tarHeader(name, int64(len(data)), modTime)); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func tarHeader(name string, size int64, modTime time.Time) *tar.Header {
+	return &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: modTime,
+	}
+}
+
+// writeRecord writes the key k and its value v to w, each prefixed with
+// its length. n is a buffer of binary.MaxVarintLen64 bytes.
+func writeRecord(w io.Writer, n []byte, k, v []byte) error {
+	for _, b := range [][]byte{k, v} {
+		if _, err := w.Write(n[:binary.PutUvarint(n, uint64(len(b)))]); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSize is the size of b in a bucket file of a backup archive
+func recordSize(b []byte) int64 {
+	var n [binary.MaxVarintLen64]byte
+	return int64(binary.PutUvarint(n[:], uint64(len(b))) + len(b))
+}
+
+func decodeBucket(data []byte) (map[string][]byte, error) {
+	kvs := map[string][]byte{}
+	next := func() ([]byte, error) {
+		n, i := binary.Uvarint(data)
+		if i <= 0 || n > uint64(len(data)-i) {
+			return nil, errors.New("truncated record")
+		}
+		v := data[i : i+int(n)]
+		data = data[i+int(n):]
+		return v, nil
+	}
+	for len(data) > 0 {
+		k, err := next()
+		if err != nil {
+			return nil, err
+		}
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		kvs[string(k)] = v
+	}
+	return kvs, nil
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
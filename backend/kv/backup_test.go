@@ -0,0 +1,237 @@
+package kv_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv"
+)
+
+func TestService_Backup(t *testing.T) {
+	ctx := context.Background()
+	from, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	to, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+
+	src, err := from.SourcesStore().Add(ctx, cloudhub.Source{Name: "Of Truth", Organization: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dash, err := from.DashboardsStore().Add(ctx, cloudhub.Dashboard{Name: "Lyon Estates", Organization: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the target has data of its own, which the restore removes
+	if _, err := to.VspheresStore().Add(ctx, cloudhub.Vsphere{Host: "hill-valley", Organization: "default"}); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := from.Manifest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.SchemaVersion != kv.SchemaVersion || len(manifest.Buckets) != len(kv.Buckets()) {
+		t.Fatalf("Manifest() = %+v", manifest)
+	}
+
+	var archive bytes.Buffer
+	createdAt := time.Date(1985, 10, 26, 1, 21, 0, 0, time.UTC)
+	if n, err := from.WriteBackup(ctx, &archive, createdAt); err != nil || n != int64(archive.Len()) {
+		t.Fatalf("WriteBackup() = %d, %v; wrote %d bytes", n, err, archive.Len())
+	}
+
+	backup, err := kv.ReadBackup(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadBackup() error = %v", err)
+	}
+	manifest.CreatedAt = createdAt
+	if !reflect.DeepEqual(backup.Manifest, manifest) {
+		t.Errorf("ReadBackup() manifest = %+v, want %+v", backup.Manifest, manifest)
+	}
+	if err := to.Restore(ctx, backup); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	diffs, err := from.Diff(ctx, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diffs {
+		if !d.InSync() {
+			t.Errorf("bucket %s differs after Restore(): %+v", d.Bucket, d)
+		}
+	}
+	if got, err := to.SourcesStore().Get(ctx, src.ID); err != nil || got.Name != src.Name {
+		t.Errorf("restored source %d = %+v, %v", src.ID, got, err)
+	}
+	if _, err := to.DashboardsStore().Get(ctx, dash.ID); err != nil {
+		t.Errorf("restored dashboard %d: %v", dash.ID, err)
+	}
+}
+
+func TestReadBackup(t *testing.T) {
+	svc, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	var backup bytes.Buffer
+	if _, err := svc.WriteBackup(context.Background(), &backup, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// archive rewrites the files of a backup archive of svc
+	archive := func(rewrite func(name string, data []byte) []byte) []byte {
+		zr, err := gzip.NewReader(bytes.NewReader(backup.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(zr)
+
+		var out bytes.Buffer
+		zw := gzip.NewWriter(&out)
+		tw := tar.NewWriter(zw)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			var data bytes.Buffer
+			data.ReadFrom(tr)
+			b := rewrite(hdr.Name, data.Bytes())
+			hdr.Size = int64(len(b))
+			tw.WriteHeader(hdr)
+			tw.Write(b)
+		}
+		tw.Close()
+		zw.Close()
+		return out.Bytes()
+	}
+	manifest := func(change func(m map[string]interface{})) func(string, []byte) []byte {
+		return func(name string, data []byte) []byte {
+			if name != "manifest.json" {
+				return data
+			}
+			m := map[string]interface{}{}
+			json.Unmarshal(data, &m)
+			change(m)
+			b, _ := json.Marshal(m)
+			return b
+		}
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr string
+	}{
+		{
+			name:    "not an archive",
+			archive: []byte("1.21 gigawatts"),
+			wantErr: "not a backup archive",
+		},
+		{
+			name:    "newer schema",
+			archive: archive(manifest(func(m map[string]interface{}) { m["schemaVersion"] = kv.SchemaVersion + 1 })),
+			wantErr: "newer than",
+		},
+		{
+			name:    "invalid schema",
+			archive: archive(manifest(func(m map[string]interface{}) { m["schemaVersion"] = 0 })),
+			wantErr: "invalid schema version 0",
+		},
+		{
+			name:    "unknown format",
+			archive: archive(manifest(func(m map[string]interface{}) { m["format"] = 0 })),
+			wantErr: "format",
+		},
+		{
+			name: "corrupt bucket",
+			archive: archive(func(name string, data []byte) []byte {
+				if name == "buckets/OrganizationsV1" {
+					data[len(data)-1]++
+				}
+				return data
+			}),
+			wantErr: "checksum",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kv.ReadBackup(bytes.NewReader(tt.archive))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadBackup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_Restore_Migrates(t *testing.T) {
+	ctx := context.Background()
+	tempFile := func() string {
+		f, err := ioutil.TempFile("", "cloudhub-bolt-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		return f.Name()
+	}
+
+	// the backup is taken from a store at the first schema version
+	fromPath := tempFile()
+	defer os.Remove(fromPath)
+	from, err := openTestService(t, fromPath, kv.WithMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	var archive bytes.Buffer
+	if _, err := from.WriteBackup(ctx, &archive, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := kv.ReadBackup(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := tempFile()
+	defer os.Remove(f)
+
+	runs := 0
+	to, err := openTestService(t, f, kv.WithMigrations(kv.Migration{
+		Version:     2,
+		Description: "count restores",
+		Up: func(ctx context.Context, s *kv.Service) error {
+			runs++
+			return nil
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+
+	if err := to.Restore(ctx, snap); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if v, err := to.SchemaVersion(ctx); err != nil || v != 2 || runs != 2 {
+		t.Errorf("SchemaVersion() after Restore() = %d, %v with %d runs; want 2 after running the migration again", v, err, runs)
+	}
+}
@@ -1,6 +1,7 @@
 package bolt
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -42,6 +43,7 @@ type client struct {
 	isNew      bool
 	logger     cloudhub.Logger
 	path       string
+	readOnly   bool
 }
 
 // NewClient initializes bolt client implementing the kv.Store interface.
@@ -90,20 +92,34 @@ func WithPath(path string) Option {
 	}
 }
 
+// WithReadOnly opens the boltdb without writing to it; the file has to exist.
+func WithReadOnly() Option {
+	return func(c *client) error {
+		c.readOnly = true
+		return nil
+	}
+}
+
 // Open opens or creates the boltDB file.
 func (c *client) open(ctx context.Context) error {
 	if _, err := os.Stat(c.path); os.IsNotExist(err) {
+		if c.readOnly {
+			return err
+		}
 		c.isNew = true
 	} else if err != nil {
 		return err
 	}
 
 	// Open database file.
-	db, err := bolt.Open(c.path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	db, err := bolt.Open(c.path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: c.readOnly})
 	if err != nil {
 		return fmt.Errorf(ErrUnableToOpen, err)
 	}
 	c.db = db
+	if c.readOnly {
+		return nil
+	}
 
 	if err = c.initialize(ctx); err != nil {
 		return fmt.Errorf(ErrUnableToInitialize, err)
@@ -193,6 +209,19 @@ func (b *Bucket) NextSequence() (uint64, error) {
 	return b.bucket.NextSequence()
 }
 
+// Sequence returns the last sequence handed out by NextSequence.
+func (b *Bucket) Sequence() uint64 {
+	if b.bucket == nil {
+		return 0
+	}
+	return b.bucket.Sequence()
+}
+
+// SetSequence sets the sequence NextSequence counts up from.
+func (b *Bucket) SetSequence(v uint64) error {
+	return b.bucket.SetSequence(v)
+}
+
 // Exists checks if the given key exists within the specified prefix and returns true if it does.
 func (b *Bucket) Exists(key []byte) (bool, error) {
 	value := b.bucket.Get(key)
@@ -206,10 +235,46 @@ func (b *Bucket) Exists(key []byte) (bool, error) {
 // If the provided function returns an error then the iteration is stopped and
 // the error is returned to the caller. The provided function must not modify
 // the bucket; this will result in undefined behavior.
+// A bucket that a read-only db does not have yet is empty.
 func (b *Bucket) ForEach(fn func(k, v []byte) error) error {
+	if b.bucket == nil {
+		return nil
+	}
 	return b.bucket.ForEach(fn)
 }
 
+// ForEachPrefix executes a function for each key/value pair in a bucket
+// whose key starts with prefix, in key order.
+func (b *Bucket) ForEachPrefix(prefix []byte, fn func(k, v []byte) error) error {
+	c := b.bucket.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachReverse executes a function for each key/value pair in a bucket
+// whose key is in [start, end), in reverse key order.
+func (b *Bucket) ForEachReverse(start, end []byte, fn func(k, v []byte) error) error {
+	c := b.bucket.Cursor()
+	k, v := c.Last()
+	if end != nil {
+		if k, v = c.Seek(end); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+	}
+	for ; k != nil && bytes.Compare(k, start) >= 0; k, v = c.Prev() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // initialize creates Buckets that are missing
 func (c *client) initialize(ctx context.Context) error {
 	if err := c.db.Update(func(tx *bolt.Tx) error {
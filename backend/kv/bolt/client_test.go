@@ -42,3 +42,49 @@ func NewService(t *testing.T) (cloudhub.KVClient, func()) {
 		s.Close()
 	}
 }
+
+func TestBucket_ForEachReverse(t *testing.T) {
+	c, err := NewTestClient()
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.TODO()
+	bucket := []byte("reverse")
+	require.NoError(t, c.Client.Update(ctx, func(tx kv.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "b", "c", "d"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	tests := []struct {
+		name       string
+		start, end []byte
+		want       string
+	}{
+		{name: "open", want: "dcba"},
+		{name: "start", start: []byte("b"), want: "dcb"},
+		{name: "end", end: []byte("c"), want: "ba"},
+		{name: "end between keys", start: []byte("a"), end: []byte("bb"), want: "ba"},
+		{name: "end past the last key", end: []byte("z"), want: "dcba"},
+		{name: "empty", start: []byte("c"), end: []byte("c"), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			require.NoError(t, c.Client.View(ctx, func(tx kv.Tx) error {
+				return tx.Bucket(bucket).ForEachReverse(tt.start, tt.end, func(k, v []byte) error {
+					got += string(k)
+					return nil
+				})
+			}))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
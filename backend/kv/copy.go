@@ -0,0 +1,291 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+)
+
+// copyBatchSize is the number of keys Copy writes in one transaction. etcd
+// refuses transactions of more than 128 operations by default.
+const copyBatchSize = 100
+
+// sequencer is implemented by buckets whose NextSequence counts up from
+// the last ID handed out, as bolt buckets do. A copy of such a bucket has
+// to carry the counter along, or new records would overwrite copied ones.
+type sequencer interface {
+	Sequence() uint64
+	SetSequence(uint64) error
+}
+
+// BucketDiff summarizes how a bucket of one service differs from the same
+// bucket of another.
+type BucketDiff struct {
+	Bucket         string
+	Keys           int    // Keys is the number of keys in the source bucket
+	Added          int    // Added is the number of keys missing from the target bucket
+	Updated        int    // Updated is the number of keys with another value in the target bucket
+	Deleted        int    // Deleted is the number of keys only found in the target bucket
+	Checksum       string // Checksum of the keys and values of the source bucket
+	TargetChecksum string // TargetChecksum of the keys and values of the target bucket
+}
+
+// InSync returns true if both buckets hold the same keys and values.
+func (d BucketDiff) InSync() bool {
+	return d.Checksum == d.TargetChecksum
+}
+
+// Buckets returns the names of all the buckets of the service.
+func Buckets() []string {
+	names := make([]string, len(buckets))
+	for i := range buckets {
+		names[i] = string(buckets[i])
+	}
+	return names
+}
+
+// Diff compares every bucket of s with the same bucket of to. A nil to is
+// compared as a service without any data.
+func (s *Service) Diff(ctx context.Context, to *Service) ([]BucketDiff, error) {
+	diffs := make([]BucketDiff, 0, len(buckets))
+	for _, b := range buckets {
+		src, _, err := s.dump(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		dst := map[string][]byte{}
+		if to != nil {
+			if dst, _, err = to.dump(ctx, b); err != nil {
+				return nil, err
+			}
+		}
+		diffs = append(diffs, diff(string(b), src, dst))
+	}
+	return diffs, nil
+}
+
+// copyOp is a key Copy writes or deletes.
+type copyOp struct {
+	key    string
+	delete bool
+}
+
+// Copy makes the bucket of to hold the same keys and values as the bucket
+// of s; keys only found in to are deleted. Keys that already match are not
+// written again, so a copy that failed part way is resumed by copying again.
+// It returns how the bucket of to differed before the copy, along with its
+// checksum after it.
+func (s *Service) Copy(ctx context.Context, to *Service, bucket string) (BucketDiff, error) {
+	b := []byte(bucket)
+	if !knownBucket(b) {
+		return BucketDiff{}, fmt.Errorf("unknown bucket %q", bucket)
+	}
+
+	src, seq, err := s.dump(ctx, b)
+	if err != nil {
+		return BucketDiff{}, err
+	}
+	dst, _, err := to.dump(ctx, b)
+	if err != nil {
+		return BucketDiff{}, err
+	}
+	d := diff(bucket, src, dst)
+
+	if err := to.replace(ctx, b, src, seq); err != nil {
+		return d, err
+	}
+
+	copied, _, err := to.dump(ctx, b)
+	if err != nil {
+		return d, err
+	}
+	d.TargetChecksum = checksum(copied)
+	return d, nil
+}
+
+// dump returns the keys and values of a bucket along with its sequence, if
+// the bucket has one.
+func (s *Service) dump(ctx context.Context, b []byte) (map[string][]byte, uint64, error) {
+	var kvs map[string][]byte
+	var seq uint64
+	err := s.kv.View(ctx, func(tx Tx) error {
+		var err error
+		kvs, seq, err = readBucket(tx, b)
+		return err
+	})
+	return kvs, seq, err
+}
+
+func readBucket(tx Tx, b []byte) (map[string][]byte, uint64, error) {
+	kvs := map[string][]byte{}
+	var seq uint64
+	bkt := tx.Bucket(b)
+	if sq, ok := bkt.(sequencer); ok {
+		seq = sq.Sequence()
+	}
+	if err := bkt.ForEach(func(k, v []byte) error {
+		// values of bolt are only valid during the transaction
+		kvs[string(k)] = append([]byte{}, v...)
+		return nil
+	}); err != nil {
+		return nil, 0, fmt.Errorf("unable to read bucket %s: %v", b, err)
+	}
+	return kvs, seq, nil
+}
+
+// replace makes the bucket b hold the keys and values of kvs, writing only
+// the keys that differ. The sequence of the bucket is raised to seq, so
+// that it hands out IDs after the ones of kvs.
+func (s *Service) replace(ctx context.Context, b []byte, kvs map[string][]byte, seq uint64) error {
+	cur, _, err := s.dump(ctx, b)
+	if err != nil {
+		return err
+	}
+
+	var ops []copyOp
+	for k, v := range kvs {
+		if w, ok := cur[k]; !ok || !bytes.Equal(v, w) {
+			ops = append(ops, copyOp{key: k})
+		}
+	}
+	for k := range cur {
+		if _, ok := kvs[k]; !ok {
+			ops = append(ops, copyOp{key: k, delete: true})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].key < ops[j].key })
+
+	for len(ops) > 0 {
+		batch := ops
+		if len(batch) > copyBatchSize {
+			batch = batch[:copyBatchSize]
+		}
+		if err := s.kv.Update(ctx, func(tx Tx) error {
+			bkt := tx.Bucket(b)
+			for _, op := range batch {
+				if op.delete {
+					if err := bkt.Delete([]byte(op.key)); err != nil {
+						return err
+					}
+				} else if err := bkt.Put([]byte(op.key), kvs[op.key]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		ops = ops[len(batch):]
+	}
+
+	return s.kv.Update(ctx, func(tx Tx) error {
+		bkt, ok := tx.Bucket(b).(sequencer)
+		if !ok {
+			return nil
+		}
+		next := seq
+		if next == 0 {
+			// kvs come from a store that does not count the IDs it
+			// hands out, so count up from the highest ID instead
+			next = lastID(kvs)
+		}
+		if next > bkt.Sequence() {
+			return bkt.SetSequence(next)
+		}
+		return nil
+	})
+}
+
+func diff(bucket string, src, dst map[string][]byte) BucketDiff {
+	d := BucketDiff{
+		Bucket:         bucket,
+		Keys:           len(src),
+		Checksum:       checksum(src),
+		TargetChecksum: checksum(dst),
+	}
+	for k, v := range src {
+		if w, ok := dst[k]; !ok {
+			d.Added++
+		} else if !bytes.Equal(v, w) {
+			d.Updated++
+		}
+	}
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			d.Deleted++
+		}
+	}
+	return d
+}
+
+// checksum returns the SHA-256 of the keys and values in key order. Each
+// key and value is prefixed with its length, so that moving bytes from a
+// value to the next key changes the checksum.
+func checksum(kvs map[string][]byte) string {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	c := newChecksummer()
+	for _, k := range keys {
+		c.add([]byte(k), kvs[k])
+	}
+	return c.sum()
+}
+
+// checksummer computes the checksum of keys and values added one at a time
+// in key order, for buckets that are not read into memory.
+type checksummer struct {
+	h hash.Hash
+	n []byte
+}
+
+func newChecksummer() *checksummer {
+	return &checksummer{h: sha256.New(), n: make([]byte, 8)}
+}
+
+func (c *checksummer) add(k, v []byte) {
+	binary.BigEndian.PutUint64(c.n, uint64(len(k)))
+	c.h.Write(c.n)
+	c.h.Write(k)
+	binary.BigEndian.PutUint64(c.n, uint64(len(v)))
+	c.h.Write(c.n)
+	c.h.Write(v)
+}
+
+func (c *checksummer) sum() string {
+	return hex.EncodeToString(c.h.Sum(nil))
+}
+
+// lastID returns the highest of the keys that are IDs, which are stored
+// either as 8-byte big endian integers or as decimal strings.
+func lastID(kvs map[string][]byte) uint64 {
+	var last uint64
+	for k := range kvs {
+		id, err := strconv.ParseUint(k, 10, 64)
+		if err != nil && len(k) == 8 {
+			id, err = binary.BigEndian.Uint64([]byte(k)), nil
+		}
+		if err == nil && id > last {
+			last = id
+		}
+	}
+	return last
+}
+
+func knownBucket(b []byte) bool {
+	for i := range buckets {
+		if bytes.Equal(buckets[i], b) {
+			return true
+		}
+	}
+	return false
+}
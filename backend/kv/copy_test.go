@@ -0,0 +1,131 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv"
+)
+
+func copyAll(t *testing.T, from, to *kv.Service) []kv.BucketDiff {
+	t.Helper()
+	var diffs []kv.BucketDiff
+	for _, b := range kv.Buckets() {
+		d, err := from.Copy(context.Background(), to, b)
+		if err != nil {
+			t.Fatalf("Copy(%s) error = %v", b, err)
+		}
+		if d.TargetChecksum != d.Checksum {
+			t.Errorf("Copy(%s) left checksum %s, want %s", b, d.TargetChecksum, d.Checksum)
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+func TestService_Copy(t *testing.T) {
+	ctx := context.Background()
+	from, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	to, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+
+	// leave a gap in the IDs of the sources, so they would be renumbered
+	// if they were added to the target
+	var srcs []cloudhub.Source
+	for _, name := range []string{"deleted", "Of Truth", "HipToBeSquare"} {
+		src, err := from.SourcesStore().Add(ctx, cloudhub.Source{Name: name, Organization: "default"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, src)
+	}
+	if err := from.SourcesStore().Delete(ctx, srcs[0]); err != nil {
+		t.Fatal(err)
+	}
+	dash, err := from.DashboardsStore().Add(ctx, cloudhub.Dashboard{Name: "Lyon Estates", Organization: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	topo, err := from.TopologiesStore().Add(ctx, &cloudhub.Topology{Organization: "default", Diagram: "<xml/>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := from.Diff(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != len(kv.Buckets()) {
+		t.Fatalf("Diff() returned %d buckets, want %d", len(diffs), len(kv.Buckets()))
+	}
+	for _, d := range diffs {
+		if d.Added != d.Keys || (d.Keys > 0 && d.InSync()) {
+			t.Errorf("Diff() against no target = %+v, want every key added", d)
+		}
+	}
+
+	copyAll(t, from, to)
+
+	got, err := to.SourcesStore().Get(ctx, srcs[2].ID)
+	if err != nil || got.Name != "HipToBeSquare" {
+		t.Errorf("copied source %d = %+v, %v", srcs[2].ID, got, err)
+	}
+	if _, err := to.DashboardsStore().Get(ctx, dash.ID); err != nil {
+		t.Errorf("copied dashboard %d: %v", dash.ID, err)
+	}
+	if _, err := to.TopologiesStore().Get(ctx, cloudhub.TopologyQuery{ID: &topo.ID}); err != nil {
+		t.Errorf("copied topology %s: %v", topo.ID, err)
+	}
+
+	// the target hands out IDs after the copied ones
+	next, err := to.SourcesStore().Add(ctx, cloudhub.Source{Name: "new", Organization: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID <= srcs[2].ID {
+		t.Errorf("source added after the copy got ID %d, want it after %d", next.ID, srcs[2].ID)
+	}
+
+	// a copy that is run again only writes what differs
+	if err := to.DashboardsStore().Delete(ctx, dash); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range copyAll(t, from, to) {
+		switch d.Bucket {
+		case "Sources":
+			if d.Added != 0 || d.Updated != 0 || d.Deleted != 1 {
+				t.Errorf("second Copy(Sources) = %+v, want the new source deleted", d)
+			}
+		case "Dashoard":
+			if d.Added != 1 || d.Updated != 0 || d.Deleted != 0 {
+				t.Errorf("second Copy(Dashoard) = %+v, want the dashboard added", d)
+			}
+		default:
+			if d.Added+d.Updated+d.Deleted != 0 {
+				t.Errorf("second Copy(%s) = %+v, want nothing copied", d.Bucket, d)
+			}
+		}
+	}
+
+	diffs, err = from.Diff(ctx, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diffs {
+		if !d.InSync() {
+			t.Errorf("Diff() after Copy = %+v, want it in sync", d)
+		}
+	}
+
+	if _, err := from.Copy(ctx, to, "Flux Capacitors"); err == nil {
+		t.Error("Copy() of an unknown bucket succeeded")
+	}
+}
@@ -27,7 +27,7 @@ func (s *cspStore) Add(ctx context.Context, csp *cloudhub.CSP) (*cloudhub.CSP, e
 		}
 		csp.ID = strconv.FormatUint(seq, 10)
 
-		if v, err := internal.MarshalCSP(csp); err != nil {
+		if v, err := s.marshal(*csp); err != nil {
 			return err
 		} else if err := b.Put([]byte(csp.ID), v); err != nil {
 			return err
@@ -57,7 +57,7 @@ func (s *cspStore) get(ctx context.Context, id string) (*cloudhub.CSP, error) {
 		if v == nil || err != nil {
 			return cloudhub.ErrCSPNotFound
 		}
-		return internal.UnmarshalCSP(v, &csp)
+		return s.unmarshal(v, &csp)
 	})
 
 	if err != nil {
@@ -95,7 +95,7 @@ func (s *cspStore) Update(ctx context.Context, csp *cloudhub.CSP) error {
 			return cloudhub.ErrCSPNotFound
 		}
 
-		if v, err := internal.MarshalCSP(csp); err != nil {
+		if v, err := s.marshal(*csp); err != nil {
 			return err
 		} else if err := tx.Bucket(cspBucket).Put([]byte(csp.ID), v); err != nil {
 			return err
@@ -126,7 +126,7 @@ func (s *cspStore) each(ctx context.Context, fn func(*cloudhub.CSP)) error {
 	return s.client.kv.View(ctx, func(tx Tx) error {
 		return tx.Bucket(cspBucket).ForEach(func(k, v []byte) error {
 			var csp cloudhub.CSP
-			if err := internal.UnmarshalCSP(v, &csp); err != nil {
+			if err := s.unmarshal(v, &csp); err != nil {
 				return err
 			}
 			fn(&csp)
@@ -134,3 +134,20 @@ func (s *cspStore) each(ctx context.Context, fn func(*cloudhub.CSP)) error {
 		})
 	})
 }
+
+// marshal encrypts the secrets of csp and encodes it to binary protobuf format.
+// csp is passed by value so the caller's copy keeps its cleartext secrets.
+func (s *cspStore) marshal(csp cloudhub.CSP) ([]byte, error) {
+	if err := s.client.sealSecrets(&csp.SecretKey); err != nil {
+		return nil, err
+	}
+	return internal.MarshalCSP(&csp)
+}
+
+// unmarshal decodes a CSP from binary protobuf data and decrypts its secrets.
+func (s *cspStore) unmarshal(v []byte, csp *cloudhub.CSP) error {
+	if err := internal.UnmarshalCSP(v, csp); err != nil {
+		return err
+	}
+	return s.client.openSecrets(&csp.SecretKey)
+}
@@ -0,0 +1,187 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure dashboardRevisionsStore implements cloudhub.DashboardRevisionsStore.
+var _ cloudhub.DashboardRevisionsStore = &dashboardRevisionsStore{}
+
+// dashboardRevisionsStore is the bolt and etcd implementation of storing
+// dashboard revisions. Keys are "<dashboard id>-<revision id>", both zero
+// padded, so the revisions of a dashboard share a key prefix.
+type dashboardRevisionsStore struct {
+	client     *Service
+	dashboards *dashboardsStore
+}
+
+func dashboardRevisionPrefix(id cloudhub.DashboardID) string {
+	return fmt.Sprintf("%020d-", id)
+}
+
+func dashboardRevisionKey(id cloudhub.DashboardID, revID int) []byte {
+	return []byte(fmt.Sprintf("%s%010d", dashboardRevisionPrefix(id), revID))
+}
+
+// all returns the revisions of a dashboard, oldest first.
+func (s *dashboardRevisionsStore) all(tx Tx, id cloudhub.DashboardID) ([]cloudhub.DashboardRevision, error) {
+	var revs []cloudhub.DashboardRevision
+	err := tx.Bucket(dashboardRevisionsBucket).ForEachPrefix([]byte(dashboardRevisionPrefix(id)), func(k, v []byte) error {
+		var rev cloudhub.DashboardRevision
+		if err := internal.UnmarshalDashboardRevision(v, &rev); err != nil {
+			return err
+		}
+		revs = append(revs, rev)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(revs, func(i, j int) bool { return revs[i].ID < revs[j].ID })
+	return revs, nil
+}
+
+// All returns the revisions of a dashboard, newest first.
+func (s *dashboardRevisionsStore) All(ctx context.Context, id cloudhub.DashboardID) ([]cloudhub.DashboardRevision, error) {
+	var revs []cloudhub.DashboardRevision
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		var err error
+		revs, err = s.all(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(revs)-1; i < j; i, j = i+1, j-1 {
+		revs[i], revs[j] = revs[j], revs[i]
+	}
+	return revs, nil
+}
+
+// Add saves a new revision of a dashboard and prunes the oldest revisions
+// so that at most keep revisions remain. The revision time defaults to now.
+func (s *dashboardRevisionsStore) Add(ctx context.Context, rev *cloudhub.DashboardRevision, keep int) (*cloudhub.DashboardRevision, error) {
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		revs, err := s.all(tx, rev.DashboardID)
+		if err != nil {
+			return err
+		}
+		_, err = s.add(tx, revs, rev, keep)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// UpdateDashboard changes a dashboard and saves the change as a new
+// revision in the same transaction. A dashboard without revisions has
+// its current version saved first.
+func (s *dashboardRevisionsStore) UpdateDashboard(ctx context.Context, dash cloudhub.Dashboard, author string, keep int) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		revs, err := s.all(tx, dash.ID)
+		if err != nil {
+			return err
+		}
+
+		cur, err := s.dashboards.update(ctx, tx, &dash)
+		if err != nil {
+			return err
+		}
+
+		if len(revs) == 0 {
+			orig := &cloudhub.DashboardRevision{DashboardID: cur.ID, Dashboard: cur}
+			if revs, err = s.add(tx, revs, orig, keep); err != nil {
+				return err
+			}
+		}
+		_, err = s.add(tx, revs, &cloudhub.DashboardRevision{
+			DashboardID: dash.ID,
+			Author:      author,
+			Dashboard:   dash,
+		}, keep)
+		return err
+	})
+}
+
+// add saves rev after revs, the revisions of its dashboard, and prunes
+// them to keep. It returns the revisions left, as etcd transactions do not
+// read their own writes.
+func (s *dashboardRevisionsStore) add(tx Tx, revs []cloudhub.DashboardRevision, rev *cloudhub.DashboardRevision, keep int) ([]cloudhub.DashboardRevision, error) {
+	if keep < 1 {
+		keep = 1
+	}
+	if rev.Time.IsZero() {
+		rev.Time = time.Now()
+	}
+	rev.Time = rev.Time.UTC()
+
+	rev.ID = 1
+	if len(revs) > 0 {
+		rev.ID = revs[len(revs)-1].ID + 1
+	}
+	rev.Dashboard.ID = rev.DashboardID
+
+	b := tx.Bucket(dashboardRevisionsBucket)
+	v, err := internal.MarshalDashboardRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Put(dashboardRevisionKey(rev.DashboardID, rev.ID), v); err != nil {
+		return nil, err
+	}
+
+	revs = append(revs, *rev)
+	for len(revs) > keep {
+		if err := b.Delete(dashboardRevisionKey(rev.DashboardID, revs[0].ID)); err != nil {
+			return nil, err
+		}
+		revs = revs[1:]
+	}
+	return revs, nil
+}
+
+// Get returns a revision of a dashboard.
+func (s *dashboardRevisionsStore) Get(ctx context.Context, id cloudhub.DashboardID, revID int) (*cloudhub.DashboardRevision, error) {
+	var rev cloudhub.DashboardRevision
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		v, err := tx.Bucket(dashboardRevisionsBucket).Get(dashboardRevisionKey(id, revID))
+		if v == nil || err != nil {
+			return cloudhub.ErrDashboardRevisionNotFound
+		}
+		return internal.UnmarshalDashboardRevision(v, &rev)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// Delete removes all revisions of a dashboard.
+func (s *dashboardRevisionsStore) Delete(ctx context.Context, id cloudhub.DashboardID) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		revs, err := s.all(tx, id)
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket(dashboardRevisionsBucket)
+		for _, rev := range revs {
+			if err := b.Delete(dashboardRevisionKey(id, rev.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a DashboardRevisionsStore keeps the newest revisions of each dashboard.
+func TestDashboardRevisionsStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.DashboardRevisionsStore()
+
+	for _, name := range []string{"v1", "v2", "v3", "v4"} {
+		rev, err := s.Add(ctx, &cloudhub.DashboardRevision{
+			DashboardID: 1,
+			Author:      "alice",
+			Dashboard:   cloudhub.Dashboard{Name: name, Organization: "default"},
+		}, 3)
+		if err != nil {
+			t.Fatalf("failed to add dashboard revision: %v", err)
+		}
+		if rev.Time.IsZero() {
+			t.Fatalf("dashboard revision was not given a time")
+		}
+	}
+	if _, err := s.Add(ctx, &cloudhub.DashboardRevision{
+		DashboardID: 2,
+		Dashboard:   cloudhub.Dashboard{Name: "other"},
+	}, 3); err != nil {
+		t.Fatalf("failed to add dashboard revision: %v", err)
+	}
+
+	revs, err := s.All(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 3 {
+		t.Fatalf("All() returned %d revisions, want 3", len(revs))
+	}
+	for i, want := range []int{4, 3, 2} {
+		if revs[i].ID != want {
+			t.Fatalf("All() revision %d has ID %d, want %d", i, revs[i].ID, want)
+		}
+	}
+
+	rev, err := s.Get(ctx, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Dashboard.Name != "v3" || rev.Author != "alice" || rev.Dashboard.ID != 1 {
+		t.Fatalf("dashboard revision loaded is different than revision saved: %+v", rev)
+	}
+	if _, err := s.Get(ctx, 1, 1); err != cloudhub.ErrDashboardRevisionNotFound {
+		t.Fatalf("Get() of a pruned revision error = %v, want %v", err, cloudhub.ErrDashboardRevisionNotFound)
+	}
+
+	if err := s.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if revs, err := s.All(ctx, 1); err != nil || len(revs) != 0 {
+		t.Fatalf("All() after Delete() = %v, %v", revs, err)
+	}
+	if revs, err := s.All(ctx, 2); err != nil || len(revs) != 1 {
+		t.Fatalf("Delete() removed the revisions of another dashboard: %v, %v", revs, err)
+	}
+}
+
+// Ensure UpdateDashboard saves the dashboard and its revisions together.
+func TestDashboardRevisionsStore_UpdateDashboard(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.DashboardRevisionsStore()
+
+	d, err := c.DashboardsStore().Add(ctx, cloudhub.Dashboard{Name: "cpu", Organization: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cpu2", "cpu3"} {
+		d.Name = name
+		if err := s.UpdateDashboard(ctx, d, "alice", 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := c.DashboardsStore().Get(ctx, d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "cpu3" {
+		t.Fatalf("UpdateDashboard() saved dashboard %q, want %q", got.Name, "cpu3")
+	}
+
+	revs, err := s.All(ctx, d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ name, author string }{
+		{"cpu3", "alice"},
+		{"cpu2", "alice"},
+		{"cpu", ""},
+	}
+	if len(revs) != len(want) {
+		t.Fatalf("All() returned %d revisions, want %d", len(revs), len(want))
+	}
+	for i, w := range want {
+		if revs[i].Dashboard.Name != w.name || revs[i].Author != w.author {
+			t.Errorf("revision %d = %s by %q, want %s by %q", i, revs[i].Dashboard.Name, revs[i].Author, w.name, w.author)
+		}
+	}
+
+	if err := s.UpdateDashboard(ctx, cloudhub.Dashboard{ID: 1000, Name: "missing"}, "alice", 5); err != cloudhub.ErrDashboardNotFound {
+		t.Fatalf("UpdateDashboard() of a missing dashboard error = %v, want %v", err, cloudhub.ErrDashboardNotFound)
+	}
+	if revs, err := s.All(ctx, 1000); err != nil || len(revs) != 0 {
+		t.Fatalf("UpdateDashboard() of a missing dashboard saved revisions: %v, %v", revs, err)
+	}
+}
@@ -49,6 +49,7 @@ func (d *dashboardsStore) Add(ctx context.Context, src cloudhub.Dashboard) (clou
 		}
 
 		src.ID = cloudhub.DashboardID(id)
+		src.Revision = 1
 		// TODO: use FormatInt
 		strID := strconv.FormatUint(id, 10)
 		for i, cell := range src.Cells {
@@ -96,36 +97,47 @@ func (d *dashboardsStore) Delete(ctx context.Context, dash cloudhub.Dashboard) e
 	})
 }
 
-// Update the dashboard in dashboardsStore
+// Update the dashboard in dashboardsStore. The update is conditional on the
+// revision in ctx, if any.
 func (d *dashboardsStore) Update(ctx context.Context, dash cloudhub.Dashboard) error {
-	if err := d.client.kv.Update(ctx, func(tx Tx) error {
-		// Get an existing dashboard with the same ID.
-		b := tx.Bucket(dashboardsBucket)
-		strID := strconv.Itoa(int(dash.ID))
-		if v, err := b.Get([]byte(strID)); v == nil || err != nil {
-			return cloudhub.ErrDashboardNotFound
-		}
+	return d.client.kv.Update(ctx, func(tx Tx) error {
+		_, err := d.update(ctx, tx, &dash)
+		return err
+	})
+}
 
-		for i, cell := range dash.Cells {
-			if cell.ID != "" {
-				continue
-			}
-			cid, err := d.IDs.Generate()
-			if err != nil {
-				return err
-			}
-			cell.ID = cid
-			dash.Cells[i] = cell
+// update replaces a dashboard within tx and returns the replaced version.
+func (d *dashboardsStore) update(ctx context.Context, tx Tx, dash *cloudhub.Dashboard) (cloudhub.Dashboard, error) {
+	// Get an existing dashboard with the same ID.
+	b := tx.Bucket(dashboardsBucket)
+	strID := strconv.Itoa(int(dash.ID))
+	var cur cloudhub.Dashboard
+	if v, err := b.Get([]byte(strID)); v == nil || err != nil {
+		return cur, cloudhub.ErrDashboardNotFound
+	} else if err := internal.UnmarshalDashboard(v, &cur); err != nil {
+		return cur, err
+	}
+	rev, err := nextRevision(ctx, cur.Revision)
+	if err != nil {
+		return cur, err
+	}
+	dash.Revision = rev
+
+	for i, cell := range dash.Cells {
+		if cell.ID != "" {
+			continue
 		}
-		if v, err := internal.MarshalDashboard(dash); err != nil {
-			return err
-		} else if err := b.Put([]byte(strID), v); err != nil {
-			return err
+		cid, err := d.IDs.Generate()
+		if err != nil {
+			return cur, err
 		}
-		return nil
-	}); err != nil {
-		return err
+		cell.ID = cid
+		dash.Cells[i] = cell
 	}
-
-	return nil
+	if v, err := internal.MarshalDashboard(*dash); err != nil {
+		return cur, err
+	} else if err := b.Put([]byte(strID), v); err != nil {
+		return cur, err
+	}
+	return cur, nil
 }
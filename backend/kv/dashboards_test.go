@@ -73,6 +73,7 @@ func TestDashboardsStore_Add(t *testing.T) {
 				},
 				Templates: []cloudhub.Template{},
 				Name:      "best name",
+				Revision:  1,
 			},
 		},
 	}
@@ -159,6 +160,7 @@ func TestDashboardStore_All(t *testing.T) {
 					},
 					Templates: []cloudhub.Template{},
 					Name:      "best name",
+					Revision:  1,
 				},
 			},
 		},
@@ -375,6 +377,7 @@ func TestDashboardStore_Get(t *testing.T) {
 					},
 					Templates: []cloudhub.Template{},
 					Name:      "best name1",
+					Revision:  1,
 				},
 				err: nil,
 			},
@@ -509,6 +512,7 @@ func TestDashboardStore_Update(t *testing.T) {
 					},
 					Templates: []cloudhub.Template{},
 					Name:      "best name2",
+					Revision:  2,
 				},
 
 				err: nil,
@@ -550,3 +554,43 @@ func TestDashboardStore_Update(t *testing.T) {
 		})
 	}
 }
+
+func TestDashboardsStore_Update_Revision(t *testing.T) {
+	client, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	s := client.DashboardsStore()
+	d, err := s.Add(ctx, cloudhub.Dashboard{Name: "Lyon Estates"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Revision != 1 {
+		t.Fatalf("Add() revision = %d, want 1", d.Revision)
+	}
+
+	at := func(rev int64) context.Context {
+		return context.WithValue(ctx, cloudhub.RevisionContextKey, rev)
+	}
+	d.Name = "Hill Valley"
+	if err := s.Update(at(1), d); err != nil {
+		t.Fatalf("Update() at the revision it was read at error = %v", err)
+	}
+	d.Name = "Hilldale"
+	if err := s.Update(at(1), d); err != cloudhub.ErrRevisionMismatch {
+		t.Fatalf("Update() at an outdated revision error = %v, want %v", err, cloudhub.ErrRevisionMismatch)
+	}
+	if got, err := s.Get(ctx, d.ID); err != nil || got.Name != "Hill Valley" || got.Revision != 2 {
+		t.Fatalf("Get() after a refused update = %+v, %v", got, err)
+	}
+
+	if err := s.Update(ctx, d); err != nil {
+		t.Fatalf("unconditional Update() error = %v", err)
+	}
+	if got, err := s.Get(ctx, d.ID); err != nil || got.Name != "Hilldale" || got.Revision != 3 {
+		t.Errorf("Get() after an unconditional update = %+v, %v", got, err)
+	}
+}
@@ -253,6 +253,7 @@ type Tx struct {
 	client   *client
 	ctx      context.Context
 	writable bool
+	rev      int64 // rev is the revision the reads of a view are made at
 }
 
 // Bucket creates a bucket struct with the provided bucket.
@@ -287,6 +288,10 @@ var (
 
 // Get gets the value at the provided key.
 func (b *Bucket) Get(key []byte) ([]byte, error) {
+	if !b.tx.writable {
+		return b.view(key)
+	}
+
 	v := b.tx.m.Get(b.encodeKey(key))
 	if len(v) == 0 {
 		return nil, ErrKeyNotFound
@@ -294,6 +299,27 @@ func (b *Bucket) Get(key []byte) ([]byte, error) {
 	return []byte(v), nil
 }
 
+// view gets the value at the provided key at the revision of the view.
+// The STM compares every key it read when it commits, so a view reading more
+// keys than etcd accepts operations in one transaction would fail.
+func (b *Bucket) view(key []byte) ([]byte, error) {
+	var opts []clientv3.OpOption
+	if b.tx.rev != 0 {
+		opts = append(opts, clientv3.WithRev(b.tx.rev))
+	}
+	r, err := b.tx.client.db.Get(b.tx.ctx, b.encodeKey(key), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if b.tx.rev == 0 {
+		b.tx.rev = r.Header.Revision
+	}
+	if len(r.Kvs) == 0 || len(r.Kvs[0].Value) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return r.Kvs[0].Value, nil
+}
+
 // Put puts the provided key and value in the store.
 func (b *Bucket) Put(key []byte, value []byte) error {
 	if b.tx.writable {
@@ -334,7 +360,13 @@ type Pair struct {
 
 // ForEach loops over all bucket entries and applies fn to them.
 func (b *Bucket) ForEach(fn func(k, v []byte) error) error {
-	pairs, err := b.getAll(string(b.prefix))
+	return b.ForEachPrefix(nil, fn)
+}
+
+// ForEachPrefix loops over the bucket entries whose keys start with prefix
+// and applies fn to them.
+func (b *Bucket) ForEachPrefix(prefix []byte, fn func(k, v []byte) error) error {
+	pairs, err := b.getAll(prefix)
 	if err != nil {
 		return err
 	}
@@ -349,25 +381,87 @@ func (b *Bucket) ForEach(fn func(k, v []byte) error) error {
 	return nil
 }
 
+// reverseBatchSize is the number of keys ForEachReverse reads at once.
+const reverseBatchSize = 500
+
+// ForEachReverse loops over the bucket entries whose keys are in
+// [start, end), last key first, and applies fn to them. The entries are read
+// in batches so that stopping early does not read the whole range.
+func (b *Bucket) ForEachReverse(start, end []byte, fn func(k, v []byte) error) error {
+	prefixBytes := []byte(b.encodeKey(nil))
+	from := b.encodeKey(start)
+	to := clientv3.GetPrefixRangeEnd(string(prefixBytes))
+	if end != nil {
+		to = b.encodeKey(end)
+	}
+
+	var rev int64
+	if !b.tx.writable {
+		rev = b.tx.rev
+	}
+	for {
+		kvOpts := []clientv3.OpOption{
+			clientv3.WithRange(to),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend),
+			clientv3.WithLimit(reverseBatchSize),
+		}
+		// every batch is read at the same revision as the first one
+		if rev != 0 {
+			kvOpts = append(kvOpts, clientv3.WithRev(rev))
+		}
+
+		r, err := b.tx.client.db.Get(context.TODO(), from, kvOpts...)
+		if err != nil {
+			return err
+		}
+		if rev == 0 {
+			rev = r.Header.Revision
+			if !b.tx.writable {
+				b.tx.rev = rev
+			}
+		}
+
+		for _, k := range r.Kvs {
+			if err := fn(bytes.TrimPrefix(k.Key, prefixBytes), k.Value); err != nil {
+				return err
+			}
+		}
+		if !r.More || len(r.Kvs) == 0 {
+			return nil
+		}
+		to = string(r.Kvs[len(r.Kvs)-1].Key)
+	}
+}
+
 // NextSequence generates a universally unique uint64.
 func (b *Bucket) NextSequence() (uint64, error) {
 	return generator.Next(), nil
 }
 
-func (b *Bucket) getAll(prefix string) ([]Pair, error) {
-	var startKey = prefix + "/"
+func (b *Bucket) getAll(prefix []byte) ([]Pair, error) {
+	var startKey = b.encodeKey(prefix)
 
 	kvOpts := []clientv3.OpOption{
 		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
 		clientv3.WithPrefix(),
 	}
 
+	// range reads are not part of the STM, so the ones of a view are all
+	// made at the revision of the first one to read every bucket at the
+	// same point in time
+	if !b.tx.writable && b.tx.rev != 0 {
+		kvOpts = append(kvOpts, clientv3.WithRev(b.tx.rev))
+	}
+
 	r, err := b.tx.client.db.Get(context.TODO(), startKey, kvOpts...)
 	if err != nil {
 		return nil, err
 	}
+	if !b.tx.writable && b.tx.rev == 0 {
+		b.tx.rev = r.Header.Revision
+	}
 
-	prefixBytes := []byte(startKey)
+	prefixBytes := []byte(b.encodeKey(nil))
 
 	ps := []Pair{}
 	for _, k := range r.Kvs {
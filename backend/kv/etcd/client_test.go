@@ -83,6 +83,77 @@ func TestEtcd(t *testing.T) {
 	require.NoError(t, s.SourcesStore().Delete(ctx, src))
 }
 
+// TestEtcd_DashboardRevisions updates dashboards on etcd, whose
+// transactions do not read the keys they write.
+func TestEtcd_DashboardRevisions(t *testing.T) {
+	s, closeFn := NewService(t)
+	defer closeFn()
+
+	ctx := context.TODO()
+	dash, err := s.DashboardsStore().Add(ctx, cloudhub.Dashboard{Name: "Lyon Estates", Organization: "default"})
+	require.NoError(t, err)
+
+	revisions := s.DashboardRevisionsStore()
+	dash.Name = "Hill Valley"
+	require.NoError(t, revisions.UpdateDashboard(ctx, dash, "doc", 10))
+
+	revs, err := revisions.All(ctx, dash.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(revs))
+	require.Equal(t, 2, revs[0].ID)
+	require.Equal(t, "Hill Valley", revs[0].Dashboard.Name)
+	require.Equal(t, 1, revs[1].ID)
+	require.Equal(t, "Lyon Estates", revs[1].Dashboard.Name)
+
+	// the revisions pruned include the ones written in the same transaction
+	other, err := s.DashboardsStore().Add(ctx, cloudhub.Dashboard{Name: "Twin Pines Mall", Organization: "default"})
+	require.NoError(t, err)
+	other.Name = "Lone Pine Mall"
+	require.NoError(t, revisions.UpdateDashboard(ctx, other, "marty", 1))
+
+	revs, err = revisions.All(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(revs))
+	require.Equal(t, 2, revs[0].ID)
+	require.Equal(t, "Lone Pine Mall", revs[0].Dashboard.Name)
+}
+
+// TestEtcd_NetworkDevices keeps an organization collecting more devices
+// than etcd accepts operations in one transaction.
+func TestEtcd_NetworkDevices(t *testing.T) {
+	s, closeFn := NewService(t)
+	defer closeFn()
+
+	ctx := context.TODO()
+	devices := s.NetworkDeviceStore()
+	org := &cloudhub.NetworkDeviceOrg{ID: "default", CollectorServer: "ch-collector-1"}
+	for i := 0; i < 150; i++ {
+		d, err := devices.Add(ctx, &cloudhub.NetworkDevice{
+			Organization: "default",
+			DeviceIP:     fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+		})
+		require.NoError(t, err)
+		org.CollectedDevicesIDs = append(org.CollectedDevicesIDs, d.ID)
+	}
+	orgs := s.NetworkDeviceOrgStore()
+	_, err := orgs.Add(ctx, org)
+	require.NoError(t, err)
+
+	org.CollectorServer = "ch-collector-2"
+	require.NoError(t, orgs.Update(ctx, org))
+
+	server := "ch-collector-2"
+	found, err := devices.Find(ctx, cloudhub.NetworkDeviceQuery{CollectorServer: &server})
+	require.NoError(t, err)
+	require.Equal(t, 150, len(found))
+
+	require.NoError(t, devices.(*kv.NetworkDeviceStore).DeleteAll(ctx))
+	all, err := devices.All(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(all))
+	require.NoError(t, orgs.Delete(ctx, org))
+}
+
 func Test_WithURL(t *testing.T) {
 	parse := func(val string) *url.URL {
 		url, err := url.Parse(val)
@@ -0,0 +1,144 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure hostKeysStore implements cloudhub.HostKeysStore.
+var _ cloudhub.HostKeysStore = &hostKeysStore{}
+
+// hostKeysStore uses a kv to store and retrieve SSH host keys
+type hostKeysStore struct {
+	client *Service
+}
+
+// Add creates a new HostKey in the hostKeysStore
+func (s *hostKeysStore) Add(ctx context.Context, k *cloudhub.HostKey) (*cloudhub.HostKey, error) {
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(hostKeysBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		k.ID = strconv.FormatUint(seq, 10)
+
+		v, err := internal.MarshalHostKey(k)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(k.ID), v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// All returns all known host keys
+func (s *hostKeysStore) All(ctx context.Context) ([]cloudhub.HostKey, error) {
+	var keys []cloudhub.HostKey
+	err := s.each(ctx, func(k *cloudhub.HostKey) bool {
+		keys = append(keys, *k)
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Delete the host key from the hostKeysStore
+func (s *hostKeysStore) Delete(ctx context.Context, k *cloudhub.HostKey) error {
+	_, err := s.get(ctx, k.ID)
+	if err != nil {
+		return err
+	}
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		return tx.Bucket(hostKeysBucket).Delete([]byte(k.ID))
+	})
+}
+
+// Get returns a host key by ID or by the organization and host it was seen on
+func (s *hostKeysStore) Get(ctx context.Context, q cloudhub.HostKeyQuery) (*cloudhub.HostKey, error) {
+	if q.ID != nil {
+		return s.get(ctx, *q.ID)
+	}
+	if q.Host == nil || q.Organization == nil {
+		return nil, cloudhub.ErrHostKeyNotFound
+	}
+
+	var found *cloudhub.HostKey
+	err := s.each(ctx, func(k *cloudhub.HostKey) bool {
+		if k.Host == *q.Host && k.Organization == *q.Organization {
+			found = k
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, cloudhub.ErrHostKeyNotFound
+	}
+
+	return found, nil
+}
+
+// Update the host key in the hostKeysStore
+func (s *hostKeysStore) Update(ctx context.Context, k *cloudhub.HostKey) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		if v, err := internal.MarshalHostKey(k); err != nil {
+			return err
+		} else if err := tx.Bucket(hostKeysBucket).Put([]byte(k.ID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *hostKeysStore) get(ctx context.Context, id string) (*cloudhub.HostKey, error) {
+	var k cloudhub.HostKey
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		v, err := tx.Bucket(hostKeysBucket).Get([]byte(id))
+		if v == nil || err != nil {
+			return cloudhub.ErrHostKeyNotFound
+		}
+		return internal.UnmarshalHostKey(v, &k)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &k, nil
+}
+
+// each calls fn for every host key until fn returns false
+func (s *hostKeysStore) each(ctx context.Context, fn func(*cloudhub.HostKey) bool) error {
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(hostKeysBucket).ForEach(func(k, v []byte) error {
+			var key cloudhub.HostKey
+			if err := internal.UnmarshalHostKey(v, &key); err != nil {
+				return err
+			}
+			if !fn(&key) {
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if err == errStopIteration {
+		return nil
+	}
+	return err
+}
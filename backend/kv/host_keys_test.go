@@ -0,0 +1,74 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a HostKeysStore can store, find, update and remove host keys.
+func TestHostKeysStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.HostKeysStore()
+
+	seen := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	keys := []cloudhub.HostKey{
+		{Organization: "default", Host: "10.0.0.1:22", KeyType: "ssh-ed25519", Fingerprint: "SHA256:aaaa", PublicKey: "ssh-ed25519 AAAA", FirstSeen: seen},
+		{Organization: "1", Host: "10.0.0.1:22", KeyType: "ssh-rsa", Fingerprint: "SHA256:bbbb", PublicKey: "ssh-rsa BBBB", FirstSeen: seen},
+	}
+	for i := range keys {
+		k, err := s.Add(ctx, &keys[i])
+		if err != nil {
+			t.Fatalf("failed to add host key: %v", err)
+		}
+		if k.ID == "" {
+			t.Fatalf("host key was not assigned an ID")
+		}
+	}
+
+	host, org := "10.0.0.1:22", "1"
+	got, err := s.Get(ctx, cloudhub.HostKeyQuery{Organization: &org, Host: &host})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != keys[1].ID || got.Fingerprint != "SHA256:bbbb" || !got.FirstSeen.Equal(seen) || got.Approved {
+		t.Fatalf("host key loaded is different than host key saved; actual: %+v, expected %+v", got, keys[1])
+	}
+
+	got.Approved = true
+	got.ApprovedBy = "alice"
+	got.ApprovedAt = seen.Add(time.Hour)
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.Get(ctx, cloudhub.HostKeyQuery{ID: &keys[1].ID}); err != nil || !got.Approved || got.ApprovedBy != "alice" || !got.ApprovedAt.Equal(seen.Add(time.Hour)) {
+		t.Fatalf("Update() did not store the approval: %+v, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, &keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, cloudhub.HostKeyQuery{ID: &keys[0].ID}); err != cloudhub.ErrHostKeyNotFound {
+		t.Fatalf("Get() of a deleted key error = %v, want %v", err, cloudhub.ErrHostKeyNotFound)
+	}
+	missing := "10.0.0.2:22"
+	if _, err := s.Get(ctx, cloudhub.HostKeyQuery{Organization: &org, Host: &missing}); err != cloudhub.ErrHostKeyNotFound {
+		t.Fatalf("Get() of an unknown host error = %v, want %v", err, cloudhub.ErrHostKeyNotFound)
+	}
+
+	all, err := s.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Organization != "1" {
+		t.Fatalf("All() = %v, want only the key of organization 1", all)
+	}
+}
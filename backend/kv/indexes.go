@@ -0,0 +1,192 @@
+package kv
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Secondary indexes map the value of a field of a record to the IDs of the
+// records holding it. An index entry is a key of an index bucket, made of
+// the field, the value and the ID of the record separated by zero bytes, so
+// that the records with a value are found with a prefix scan; the value of
+// the entry is the ID. Entries are written in the transaction that writes
+// the record.
+const indexSep = 0
+
+// Fields of the network device index. The entries of the collector field
+// point at organizations rather than devices.
+const (
+	deviceIPIndex        = "ip"
+	deviceOrgIndex       = "org"
+	deviceLearningIndex  = "learning"
+	deviceCollectorIndex = "collector"
+)
+
+// indexEntries are the entries of a record, keyed by the key of the entry.
+type indexEntries map[string]string
+
+// add adds the entry of field for value pointing at the record id.
+func (e indexEntries) add(field, value, id string) {
+	e[string(append(indexPrefix(field, value), id...))] = id
+}
+
+// indexPrefix is the prefix of the entries of field for value.
+func indexPrefix(field, value string) []byte {
+	k := make([]byte, 0, len(field)+len(value)+2)
+	k = append(k, field...)
+	k = append(k, indexSep)
+	k = append(k, value...)
+	return append(k, indexSep)
+}
+
+// indexLookup returns the IDs of the records of the index bucket b with
+// value for field, in key order.
+func indexLookup(tx Tx, b []byte, field, value string) ([]string, error) {
+	var ids []string
+	err := tx.Bucket(b).ForEachPrefix(indexPrefix(field, value), func(k, v []byte) error {
+		ids = append(ids, string(v))
+		return nil
+	})
+	return ids, err
+}
+
+// updateIndex replaces the entries from of a record with the entries to,
+// leaving the ones they have in common alone.
+func updateIndex(tx Tx, b []byte, from, to indexEntries) error {
+	bkt := tx.Bucket(b)
+	for k, id := range from {
+		if to[k] == id {
+			continue
+		}
+		if err := bkt.Delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+	for k, id := range to {
+		if from[k] == id {
+			continue
+		}
+		if err := bkt.Put([]byte(k), []byte(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceIndexEntries are the index entries of a network device.
+func deviceIndexEntries(device *cloudhub.NetworkDevice) indexEntries {
+	e := indexEntries{}
+	if device != nil {
+		e.add(deviceIPIndex, device.DeviceIP, device.ID)
+		e.add(deviceOrgIndex, device.Organization, device.ID)
+		e.add(deviceLearningIndex, device.LearningState, device.ID)
+	}
+	return e
+}
+
+// deviceOrgIndexEntries are the entries of the network device index for
+// org. Collector servers are set on the organizations along with the devices
+// they collect, so the organization is indexed by its collector server,
+// which keeps org to one entry however many devices it collects.
+func deviceOrgIndexEntries(org *cloudhub.NetworkDeviceOrg) indexEntries {
+	e := indexEntries{}
+	if org != nil && org.CollectorServer != "" {
+		e.add(deviceCollectorIndex, org.CollectorServer, org.ID)
+	}
+	return e
+}
+
+// collectorLookup returns the IDs of the devices collected by the collector
+// server, as listed by the organizations indexed by it.
+func collectorLookup(tx Tx, server string) ([]string, error) {
+	orgs, err := indexLookup(tx, networkDeviceIndexBucket, deviceCollectorIndex, server)
+	if err != nil {
+		return nil, err
+	}
+
+	b := tx.Bucket(networkDeviceOrgBucket)
+	var ids []string
+	for _, id := range orgs {
+		v, err := b.Get([]byte(id))
+		if v == nil || err != nil {
+			continue
+		}
+		var org cloudhub.NetworkDeviceOrg
+		if err := internal.UnmarshalNetworkDeviceOrg(v, &org); err != nil {
+			return nil, err
+		}
+		if org.CollectorServer == server {
+			ids = append(ids, org.CollectedDevicesIDs...)
+		}
+	}
+	return ids, nil
+}
+
+// RebuildIndexes writes the secondary indexes again from the records they
+// index, adding the entries that are missing and deleting the ones that are
+// stale. Keys that already match are left alone, so a rebuild that failed
+// part way is resumed by rebuilding again. It returns how the index buckets
+// differed from the rebuilt ones.
+func (s *Service) RebuildIndexes(ctx context.Context) ([]BucketDiff, error) {
+	devices := map[string][]byte{}
+	tokens := map[string][]byte{}
+	if err := s.kv.View(ctx, func(tx Tx) error {
+		if err := tx.Bucket(networkDeviceBucket).ForEach(func(k, v []byte) error {
+			var device cloudhub.NetworkDevice
+			if err := internal.UnmarshalNetworkDevice(v, &device); err != nil {
+				return err
+			}
+			for key, id := range deviceIndexEntries(&device) {
+				devices[key] = []byte(id)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := tx.Bucket(networkDeviceOrgBucket).ForEach(func(k, v []byte) error {
+			var org cloudhub.NetworkDeviceOrg
+			if err := internal.UnmarshalNetworkDeviceOrg(v, &org); err != nil {
+				return err
+			}
+			for key, id := range deviceOrgIndexEntries(&org) {
+				devices[key] = []byte(id)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return tx.Bucket(apiTokensBucket).ForEach(func(k, v []byte) error {
+			var t cloudhub.APIToken
+			if err := internal.UnmarshalAPIToken(v, &t); err != nil {
+				return err
+			}
+			if t.Hash != "" {
+				tokens[t.Hash] = []byte(t.ID)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	var diffs []BucketDiff
+	for _, idx := range []struct {
+		bucket []byte
+		want   map[string][]byte
+	}{
+		{networkDeviceIndexBucket, devices},
+		{apiTokenHashesBucket, tokens},
+	} {
+		cur, _, err := s.dump(ctx, idx.bucket)
+		if err != nil {
+			return diffs, err
+		}
+		diffs = append(diffs, diff(string(idx.bucket), idx.want, cur))
+		if err := s.replace(ctx, idx.bucket, idx.want, 0); err != nil {
+			return diffs, err
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,69 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+func TestService_RebuildIndexes(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.NetworkDeviceStore()
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if _, err := s.Add(ctx, &cloudhub.NetworkDevice{Organization: "default", DeviceIP: ip}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.APITokensStore().Add(ctx, &cloudhub.APIToken{Name: "ci", Hash: "aaaa"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the indexes are written along with the devices and tokens
+	diffs, err := c.RebuildIndexes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].Keys != 6 || diffs[0].Added != 0 || diffs[0].Deleted != 0 ||
+		diffs[1].Keys != 1 || diffs[1].Added != 0 || diffs[1].Deleted != 0 {
+		t.Fatalf("RebuildIndexes() of indexes in step = %+v", diffs)
+	}
+
+	// a store that has the devices and tokens but not their indexes finds
+	// them once the indexes are rebuilt
+	to, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	for _, b := range []string{"NetworkDevice", "APITokensV1"} {
+		if _, err := c.Copy(ctx, to, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ip := "10.0.0.2"
+	if devices, err := to.NetworkDeviceStore().Find(ctx, cloudhub.NetworkDeviceQuery{DeviceIP: &ip}); err != nil || len(devices) != 0 {
+		t.Fatalf("Find() without indexes = %v, %v", devices, err)
+	}
+	diffs, err = to.RebuildIndexes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs[0].Added != 6 || diffs[1].Added != 1 {
+		t.Errorf("RebuildIndexes() added %d and %d entries, want 6 and 1", diffs[0].Added, diffs[1].Added)
+	}
+	if devices, err := to.NetworkDeviceStore().Find(ctx, cloudhub.NetworkDeviceQuery{DeviceIP: &ip}); err != nil || len(devices) != 1 || devices[0].DeviceIP != ip {
+		t.Errorf("Find() after RebuildIndexes() = %v, %v", devices, err)
+	}
+	hash := "aaaa"
+	if tok, err := to.APITokensStore().Get(ctx, cloudhub.APITokenQuery{Hash: &hash}); err != nil || tok.Name != "ci" {
+		t.Errorf("Get() by hash after RebuildIndexes() = %v, %v", tok, err)
+	}
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
@@ -98,6 +99,7 @@ func MarshalServer(s cloudhub.Server) ([]byte, error) {
 		InsecureSkipVerify: s.InsecureSkipVerify,
 		Type:               s.Type,
 		MetadataJSON:       string(metadata),
+		AlertToken:         s.AlertToken,
 	})
 }
 
@@ -125,6 +127,7 @@ func UnmarshalServer(data []byte, s *cloudhub.Server) error {
 	s.Organization = pb.Organization
 	s.InsecureSkipVerify = pb.InsecureSkipVerify
 	s.Type = pb.Type
+	s.AlertToken = pb.AlertToken
 	return nil
 }
 
@@ -449,6 +452,7 @@ func MarshalDashboard(d cloudhub.Dashboard) ([]byte, error) {
 		Templates:    templates,
 		Name:         d.Name,
 		Organization: d.Organization,
+		Revision:     d.Revision,
 	})
 }
 
@@ -658,6 +662,7 @@ func UnmarshalDashboard(data []byte, d *cloudhub.Dashboard) error {
 	d.Templates = templates
 	d.Name = pb.Name
 	d.Organization = pb.Organization
+	d.Revision = pb.Revision
 	return nil
 }
 
@@ -722,6 +727,10 @@ func MarshalUser(u *cloudhub.User) ([]byte, error) {
 		RetryCount:         u.RetryCount,
 		LockedTime:         u.LockedTime,
 		Locked:             u.Locked,
+		TOTPSecret:         u.TOTPSecret,
+		TOTPEnabled:        u.TOTPEnabled,
+		TOTPLastCounter:    u.TOTPLastCounter,
+		RecoveryCodes:      u.RecoveryCodes,
 	})
 }
 
@@ -758,6 +767,10 @@ func UnmarshalUser(data []byte, u *cloudhub.User) error {
 	u.RetryCount = pb.RetryCount
 	u.LockedTime = pb.LockedTime
 	u.Locked = pb.Locked
+	u.TOTPSecret = pb.TOTPSecret
+	u.TOTPEnabled = pb.TOTPEnabled
+	u.TOTPLastCounter = pb.TOTPLastCounter
+	u.RecoveryCodes = pb.RecoveryCodes
 
 	return nil
 }
@@ -886,11 +899,34 @@ func MarshalOrganizationConfig(c *cloudhub.OrganizationConfig) ([]byte, error) {
 		}
 	}
 
+	rules := make([]*SaltRule, len(c.SaltPolicy.Rules))
+	for i, r := range c.SaltPolicy.Rules {
+		rules[i] = &SaltRule{
+			Role:      r.Role,
+			Clients:   r.Clients,
+			Functions: r.Functions,
+			Targets:   r.Targets,
+			Args:      r.Args,
+		}
+	}
+
 	return MarshalOrganizationConfigPB(&OrganizationConfig{
 		OrganizationID: c.OrganizationID,
 		LogViewer: &LogViewerConfig{
 			Columns: columns,
 		},
+		DashboardRevisions: &DashboardRevisionsConfig{
+			Retention: c.DashboardRevisions.Retention,
+		},
+		TwoFactor: &TwoFactorConfig{
+			RequiredForAdmins: c.TwoFactor.RequiredForAdmins,
+		},
+		TerminalRecordings: &TerminalRecordingsConfig{
+			Retention: c.TerminalRecordings.Retention,
+		},
+		SaltPolicy: &SaltPolicyConfig{
+			Rules: rules,
+		},
 	})
 }
 
@@ -931,6 +967,31 @@ func UnmarshalOrganizationConfig(data []byte, c *cloudhub.OrganizationConfig) er
 
 	c.LogViewer.Columns = columns
 
+	if pb.DashboardRevisions != nil {
+		c.DashboardRevisions.Retention = pb.DashboardRevisions.Retention
+	}
+
+	if pb.TwoFactor != nil {
+		c.TwoFactor.RequiredForAdmins = pb.TwoFactor.RequiredForAdmins
+	}
+
+	if pb.TerminalRecordings != nil {
+		c.TerminalRecordings.Retention = pb.TerminalRecordings.Retention
+	}
+
+	if pb.SaltPolicy != nil && len(pb.SaltPolicy.Rules) > 0 {
+		c.SaltPolicy.Rules = make([]cloudhub.SaltRule, len(pb.SaltPolicy.Rules))
+		for i, r := range pb.SaltPolicy.Rules {
+			c.SaltPolicy.Rules[i] = cloudhub.SaltRule{
+				Role:      r.Role,
+				Clients:   r.Clients,
+				Functions: r.Functions,
+				Targets:   r.Targets,
+				Args:      r.Args,
+			}
+		}
+	}
+
 	ensureHostnameColumn(c)
 
 	return nil
@@ -1060,6 +1121,7 @@ func MarshalTopology(t *cloudhub.Topology) ([]byte, error) {
 			IpmiVisible:       t.TopologyOptions.IPMIVisible,
 			LinkVisible:       t.TopologyOptions.LinkVisible,
 		},
+		Revision: t.Revision,
 	})
 }
 
@@ -1074,6 +1136,7 @@ func UnmarshalTopology(data []byte, t *cloudhub.Topology) error {
 	t.Organization = pb.Organization
 	t.Diagram = pb.Diagram
 	t.Preferences = pb.Preferences
+	t.Revision = pb.Revision
 
 	if pb.TopologyOptions != nil {
 		t.TopologyOptions = cloudhub.TopologyOptions{
@@ -1164,6 +1227,7 @@ func MarshalNetworkDevice(t *cloudhub.NetworkDevice) ([]byte, error) {
 		LearningBeginDatetime:  t.LearningBeginDatetime,
 		LearningFinishDatetime: t.LearningFinishDatetime,
 		IsLearning:             t.IsLearning,
+		Revision:               t.Revision,
 	})
 }
 
@@ -1215,6 +1279,7 @@ func UnmarshalNetworkDevice(data []byte, t *cloudhub.NetworkDevice) error {
 	t.LearningBeginDatetime = pb.LearningBeginDatetime
 	t.LearningFinishDatetime = pb.LearningFinishDatetime
 	t.IsLearning = pb.IsLearning
+	t.Revision = pb.Revision
 
 	return nil
 }
@@ -1239,6 +1304,7 @@ func MarshalNetworkDeviceOrg(t *cloudhub.NetworkDeviceOrg) ([]byte, error) {
 		},
 		LearningCron: t.LearningCron,
 		ProcCnt:      int32(t.ProcCnt),
+		Revision:     t.Revision,
 	})
 }
 
@@ -1269,6 +1335,7 @@ func UnmarshalNetworkDeviceOrg(data []byte, t *cloudhub.NetworkDeviceOrg) error
 	}
 	t.LearningCron = pb.LearningCron
 	t.ProcCnt = int(pb.ProcCnt)
+	t.Revision = pb.Revision
 	return nil
 }
 
@@ -1368,3 +1435,436 @@ func UnmarshalDLNxRstStg(data []byte, t *cloudhub.DLNxRstStg) error {
 
 	return nil
 }
+
+// MarshalAuditEvent encodes an AuditEvent struct to binary protobuf format.
+func MarshalAuditEvent(e *cloudhub.AuditEvent) ([]byte, error) {
+	return proto.Marshal(&AuditEvent{
+		ID:           e.ID,
+		Time:         e.Time.UnixNano(),
+		Actor:        e.Actor,
+		Provider:     e.Provider,
+		Organization: e.Organization,
+		Action:       e.Action,
+		Method:       e.Method,
+		Resource:     e.Resource,
+		Message:      e.Message,
+		Before:       e.Before,
+		After:        e.After,
+		RequestID:    e.RequestID,
+	})
+}
+
+// UnmarshalAuditEvent decodes an AuditEvent from binary protobuf data.
+func UnmarshalAuditEvent(data []byte, e *cloudhub.AuditEvent) error {
+	var pb AuditEvent
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	e.ID = pb.ID
+	e.Time = time.Unix(0, pb.Time).UTC()
+	e.Actor = pb.Actor
+	e.Provider = pb.Provider
+	e.Organization = pb.Organization
+	e.Action = pb.Action
+	e.Method = pb.Method
+	e.Resource = pb.Resource
+	e.Message = pb.Message
+	e.Before = pb.Before
+	e.After = pb.After
+	e.RequestID = pb.RequestID
+
+	return nil
+}
+
+// MarshalAlertEvent encodes an AlertEvent to binary protobuf format.
+func MarshalAlertEvent(e *cloudhub.AlertEvent) ([]byte, error) {
+	return proto.Marshal(&AlertEvent{
+		ID:            e.ID,
+		Time:          e.Time.UnixNano(),
+		Organization:  e.Organization,
+		KapacitorID:   int64(e.KapacitorID),
+		RuleID:        e.RuleID,
+		AlertID:       e.AlertID,
+		Level:         e.Level,
+		PreviousLevel: e.PreviousLevel,
+		Host:          e.Host,
+		Tags:          e.Tags,
+		Message:       e.Message,
+		Duration:      int64(e.Duration),
+	})
+}
+
+// UnmarshalAlertEvent decodes an AlertEvent from binary protobuf data.
+func UnmarshalAlertEvent(data []byte, e *cloudhub.AlertEvent) error {
+	var pb AlertEvent
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	e.ID = pb.ID
+	e.Time = time.Unix(0, pb.Time).UTC()
+	e.Organization = pb.Organization
+	e.KapacitorID = int(pb.KapacitorID)
+	e.RuleID = pb.RuleID
+	e.AlertID = pb.AlertID
+	e.Level = pb.Level
+	e.PreviousLevel = pb.PreviousLevel
+	e.Host = pb.Host
+	e.Tags = pb.Tags
+	e.Message = pb.Message
+	e.Duration = time.Duration(pb.Duration)
+
+	return nil
+}
+
+// MarshalMaintenanceWindow encodes a MaintenanceWindow struct to binary protobuf format.
+func MarshalMaintenanceWindow(w *cloudhub.MaintenanceWindow) ([]byte, error) {
+	return proto.Marshal(&MaintenanceWindow{
+		ID:            w.ID,
+		Name:          w.Name,
+		Organization:  w.Organization,
+		KapacitorID:   int64(w.KapacitorID),
+		RuleIDs:       w.RuleIDs,
+		Hosts:         w.Hosts,
+		Tags:          w.Tags,
+		Start:         unixNano(w.Start),
+		End:           unixNano(w.End),
+		Cron:          w.Cron,
+		Duration:      int64(w.Duration),
+		Timezone:      w.Timezone,
+		Annotate:      w.Annotate,
+		CreatedBy:     w.CreatedBy,
+		Active:        w.Active,
+		DisabledTasks: w.DisabledTasks,
+		PendingTasks:  w.PendingTasks,
+	})
+}
+
+// UnmarshalMaintenanceWindow decodes a MaintenanceWindow from binary protobuf data.
+func UnmarshalMaintenanceWindow(data []byte, w *cloudhub.MaintenanceWindow) error {
+	var pb MaintenanceWindow
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	w.ID = pb.ID
+	w.Name = pb.Name
+	w.Organization = pb.Organization
+	w.KapacitorID = int(pb.KapacitorID)
+	w.RuleIDs = pb.RuleIDs
+	w.Hosts = pb.Hosts
+	w.Tags = pb.Tags
+	w.Start = fromUnixNano(pb.Start)
+	w.End = fromUnixNano(pb.End)
+	w.Cron = pb.Cron
+	w.Duration = time.Duration(pb.Duration)
+	w.Timezone = pb.Timezone
+	w.Annotate = pb.Annotate
+	w.CreatedBy = pb.CreatedBy
+	w.Active = pb.Active
+	w.DisabledTasks = pb.DisabledTasks
+	w.PendingTasks = pb.PendingTasks
+
+	return nil
+}
+
+// MarshalRuleTemplate encodes a RuleTemplate struct to binary protobuf format.
+func MarshalRuleTemplate(t *cloudhub.RuleTemplate) ([]byte, error) {
+	rule, err := json.Marshal(t.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*RuleTemplateInstance, len(t.Instances))
+	for i, inst := range t.Instances {
+		instances[i] = &RuleTemplateInstance{
+			KapacitorID:  int64(inst.KapacitorID),
+			Organization: inst.Organization,
+			TaskID:       inst.TaskID,
+			Params:       inst.Params,
+		}
+	}
+
+	return proto.Marshal(&RuleTemplate{
+		ID:           t.ID,
+		Name:         t.Name,
+		Organization: t.Organization,
+		Rule:         rule,
+		Variables:    t.Variables,
+		Instances:    instances,
+		CreatedBy:    t.CreatedBy,
+	})
+}
+
+// UnmarshalRuleTemplate decodes a RuleTemplate from binary protobuf data.
+func UnmarshalRuleTemplate(data []byte, t *cloudhub.RuleTemplate) error {
+	var pb RuleTemplate
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	t.ID = pb.ID
+	t.Name = pb.Name
+	t.Organization = pb.Organization
+	if len(pb.Rule) > 0 {
+		if err := json.Unmarshal(pb.Rule, &t.Rule); err != nil {
+			return err
+		}
+	}
+	t.Variables = pb.Variables
+	t.Instances = nil
+	for _, inst := range pb.Instances {
+		t.Instances = append(t.Instances, cloudhub.RuleTemplateInstance{
+			KapacitorID:  int(inst.KapacitorID),
+			Organization: inst.Organization,
+			TaskID:       inst.TaskID,
+			Params:       inst.Params,
+		})
+	}
+	t.CreatedBy = pb.CreatedBy
+
+	return nil
+}
+
+// MarshalDashboardRevision encodes a DashboardRevision struct to binary protobuf format.
+func MarshalDashboardRevision(r *cloudhub.DashboardRevision) ([]byte, error) {
+	dash, err := MarshalDashboard(r.Dashboard)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&DashboardRevision{
+		ID:          int64(r.ID),
+		DashboardID: int64(r.DashboardID),
+		Author:      r.Author,
+		Time:        r.Time.UnixNano(),
+		Dashboard:   dash,
+	})
+}
+
+// UnmarshalDashboardRevision decodes a DashboardRevision from binary protobuf data.
+func UnmarshalDashboardRevision(data []byte, r *cloudhub.DashboardRevision) error {
+	var pb DashboardRevision
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	r.ID = int(pb.ID)
+	r.DashboardID = cloudhub.DashboardID(pb.DashboardID)
+	r.Author = pb.Author
+	r.Time = time.Unix(0, pb.Time).UTC()
+
+	return UnmarshalDashboard(pb.Dashboard, &r.Dashboard)
+}
+
+// MarshalAPIToken encodes an APIToken struct to binary protobuf format.
+func MarshalAPIToken(t *cloudhub.APIToken) ([]byte, error) {
+	return proto.Marshal(&APIToken{
+		ID:           t.ID,
+		Name:         t.Name,
+		Organization: t.Organization,
+		Role:         t.Role,
+		Hash:         t.Hash,
+		Prefix:       t.Prefix,
+		CreatedBy:    t.CreatedBy,
+		CreatedAt:    unixNano(t.CreatedAt),
+		ExpiresAt:    unixNano(t.ExpiresAt),
+		LastUsedAt:   unixNano(t.LastUsedAt),
+	})
+}
+
+// UnmarshalAPIToken decodes an APIToken from binary protobuf data.
+func UnmarshalAPIToken(data []byte, t *cloudhub.APIToken) error {
+	var pb APIToken
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	t.ID = pb.ID
+	t.Name = pb.Name
+	t.Organization = pb.Organization
+	t.Role = pb.Role
+	t.Hash = pb.Hash
+	t.Prefix = pb.Prefix
+	t.CreatedBy = pb.CreatedBy
+	t.CreatedAt = fromUnixNano(pb.CreatedAt)
+	t.ExpiresAt = fromUnixNano(pb.ExpiresAt)
+	t.LastUsedAt = fromUnixNano(pb.LastUsedAt)
+
+	return nil
+}
+
+// MarshalHostKey encodes a HostKey struct to binary protobuf format.
+func MarshalHostKey(k *cloudhub.HostKey) ([]byte, error) {
+	return proto.Marshal(&HostKey{
+		ID:           k.ID,
+		Organization: k.Organization,
+		Host:         k.Host,
+		KeyType:      k.KeyType,
+		Fingerprint:  k.Fingerprint,
+		PublicKey:    k.PublicKey,
+		Approved:     k.Approved,
+		FirstSeen:    unixNano(k.FirstSeen),
+		ApprovedBy:   k.ApprovedBy,
+		ApprovedAt:   unixNano(k.ApprovedAt),
+	})
+}
+
+// UnmarshalHostKey decodes a HostKey from binary protobuf data.
+func UnmarshalHostKey(data []byte, k *cloudhub.HostKey) error {
+	var pb HostKey
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	k.ID = pb.ID
+	k.Organization = pb.Organization
+	k.Host = pb.Host
+	k.KeyType = pb.KeyType
+	k.Fingerprint = pb.Fingerprint
+	k.PublicKey = pb.PublicKey
+	k.Approved = pb.Approved
+	k.FirstSeen = fromUnixNano(pb.FirstSeen)
+	k.ApprovedBy = pb.ApprovedBy
+	k.ApprovedAt = fromUnixNano(pb.ApprovedAt)
+
+	return nil
+}
+
+// MarshalTerminalRecording encodes a TerminalRecording struct to binary protobuf format.
+func MarshalTerminalRecording(r *cloudhub.TerminalRecording) ([]byte, error) {
+	return proto.Marshal(&TerminalRecording{
+		ID:           r.ID,
+		Organization: r.Organization,
+		User:         r.User,
+		Host:         r.Host,
+		SSHUser:      r.SSHUser,
+		StartedAt:    unixNano(r.StartedAt),
+		EndedAt:      unixNano(r.EndedAt),
+		Size:         r.Size,
+	})
+}
+
+// UnmarshalTerminalRecording decodes a TerminalRecording from binary protobuf data.
+func UnmarshalTerminalRecording(data []byte, r *cloudhub.TerminalRecording) error {
+	var pb TerminalRecording
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	r.ID = pb.ID
+	r.Organization = pb.Organization
+	r.User = pb.User
+	r.Host = pb.Host
+	r.SSHUser = pb.SSHUser
+	r.StartedAt = fromUnixNano(pb.StartedAt)
+	r.EndedAt = fromUnixNano(pb.EndedAt)
+	r.Size = pb.Size
+
+	return nil
+}
+
+// MarshalTerminalProfile encodes a TerminalProfile struct to binary protobuf format.
+func MarshalTerminalProfile(p *cloudhub.TerminalProfile) ([]byte, error) {
+	return proto.Marshal(&TerminalProfile{
+		ID:            p.ID,
+		Organization:  p.Organization,
+		Name:          p.Name,
+		Addr:          p.Addr,
+		Port:          int32(p.Port),
+		User:          p.User,
+		Password:      p.Password,
+		PrivateKey:    p.PrivateKey,
+		Passphrase:    p.Passphrase,
+		NetworkDevice: p.NetworkDevice,
+		JumpProfile:   p.JumpProfile,
+	})
+}
+
+// UnmarshalTerminalProfile decodes a TerminalProfile from binary protobuf data.
+func UnmarshalTerminalProfile(data []byte, p *cloudhub.TerminalProfile) error {
+	var pb TerminalProfile
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	p.ID = pb.ID
+	p.Organization = pb.Organization
+	p.Name = pb.Name
+	p.Addr = pb.Addr
+	p.Port = int(pb.Port)
+	p.User = pb.User
+	p.Password = pb.Password
+	p.PrivateKey = pb.PrivateKey
+	p.Passphrase = pb.Passphrase
+	p.NetworkDevice = pb.NetworkDevice
+	p.JumpProfile = pb.JumpProfile
+
+	return nil
+}
+
+// MarshalSaltJob encodes a SaltJob struct to binary protobuf format.
+func MarshalSaltJob(j *cloudhub.SaltJob) ([]byte, error) {
+	return proto.Marshal(&SaltJob{
+		JID:          j.JID,
+		Organization: j.Organization,
+		Client:       j.Client,
+		Function:     j.Function,
+		Target:       j.Target,
+		Arg:          j.Arg,
+		Kwarg:        j.Kwarg,
+		Minions:      j.Minions,
+		Requester:    j.Requester,
+		Status:       j.Status,
+		Result:       string(j.Result),
+		Error:        j.Error,
+		RerunOf:      j.RerunOf,
+		CreatedAt:    unixNano(j.CreatedAt),
+		FinishedAt:   unixNano(j.FinishedAt),
+	})
+}
+
+// UnmarshalSaltJob decodes a SaltJob from binary protobuf data.
+func UnmarshalSaltJob(data []byte, j *cloudhub.SaltJob) error {
+	var pb SaltJob
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	j.JID = pb.JID
+	j.Organization = pb.Organization
+	j.Client = pb.Client
+	j.Function = pb.Function
+	j.Target = pb.Target
+	j.Arg = pb.Arg
+	j.Kwarg = pb.Kwarg
+	j.Minions = pb.Minions
+	j.Requester = pb.Requester
+	j.Status = pb.Status
+	if pb.Result != "" {
+		j.Result = json.RawMessage(pb.Result)
+	}
+	j.Error = pb.Error
+	j.RerunOf = pb.RerunOf
+	j.CreatedAt = fromUnixNano(pb.CreatedAt)
+	j.FinishedAt = fromUnixNano(pb.FinishedAt)
+
+	return nil
+}
+
+// unixNano encodes t as unix nanoseconds, keeping the zero time as zero.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of unixNano.
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
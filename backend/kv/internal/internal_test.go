@@ -701,3 +701,30 @@ func TestMarshalDLNxRstStg(t *testing.T) {
 		t.Fatalf("Mismatch in original and copied DLNxRstStg struct: got %#v, want %#v", vv, v)
 	}
 }
+
+func TestMarshalUser(t *testing.T) {
+	v := cloudhub.User{
+		ID:       1,
+		Name:     "marty",
+		Provider: "cloudhub",
+		Scheme:   "basic",
+		Roles: []cloudhub.Role{
+			{Organization: "1", Name: "admin"},
+		},
+		Passwd:            "hash",
+		PasswordResetFlag: "N",
+		TOTPSecret:        "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		TOTPEnabled:       true,
+		TOTPLastCounter:   37037036,
+		RecoveryCodes:     []string{"a1", "b2"},
+	}
+
+	var vv cloudhub.User
+	if buf, err := internal.MarshalUser(&v); err != nil {
+		t.Fatal("Marshal failed:", err)
+	} else if err := internal.UnmarshalUser(buf, &vv); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	} else if !reflect.DeepEqual(v, vv) {
+		t.Fatalf("Mismatch in original and copied User struct: got %#v, want %#v", vv, v)
+	}
+}
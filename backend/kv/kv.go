@@ -26,11 +26,59 @@ var (
 	cspBucket                = []byte("CSP")
 	networkDeviceBucket      = []byte("NetworkDevice")
 	networkDeviceOrgBucket   = []byte("NetworkDeviceOrg")
+	networkDeviceIndexBucket = []byte("NetworkDeviceIndexV1")
 	mlNxRstBucket            = []byte("MLNxRst")
 	dlNxRstBucket            = []byte("DLNxRst")
 	dLNxRstStgBucket         = []byte("DLNxRstStg")
+	auditBucket              = []byte("AuditV1")
+	dashboardRevisionsBucket = []byte("DashboardRevisionsV1")
+	apiTokensBucket          = []byte("APITokensV1")
+	apiTokenHashesBucket     = []byte("APITokenHashesV1")
+	hostKeysBucket           = []byte("HostKeysV1")
+	terminalRecordingsBucket = []byte("TerminalRecordingsV1")
+	terminalProfilesBucket   = []byte("TerminalProfilesV1")
+	saltJobsBucket           = []byte("SaltJobsV1")
+	alertEventsBucket        = []byte("AlertEventsV1")
+	maintenanceWindowsBucket = []byte("MaintenanceWindowsV1")
+	ruleTemplatesBucket      = []byte("RuleTemplatesV1")
+	metaBucket               = []byte("MetaV1")
 )
 
+// buckets are all the buckets of the service. Buckets that are added have
+// to be listed here, so they are created on start up and copied by Copy.
+var buckets = [][]byte{
+	cellBucket,
+	configBucket,
+	dashboardsBucket,
+	mappingsBucket,
+	organizationConfigBucket,
+	organizationsBucket,
+	serversBucket,
+	sourcesBucket,
+	usersBucket,
+	vSpheresBucket,
+	topologyBucket,
+	cspBucket,
+	networkDeviceBucket,
+	networkDeviceOrgBucket,
+	networkDeviceIndexBucket,
+	mlNxRstBucket,
+	dlNxRstBucket,
+	dLNxRstStgBucket,
+	auditBucket,
+	dashboardRevisionsBucket,
+	apiTokensBucket,
+	apiTokenHashesBucket,
+	hostKeysBucket,
+	terminalRecordingsBucket,
+	terminalProfilesBucket,
+	saltJobsBucket,
+	alertEventsBucket,
+	maintenanceWindowsBucket,
+	ruleTemplatesBucket,
+	metaBucket,
+}
+
 // Store is an interface for a generic key value store. It is modeled after
 // the boltdb database struct.
 type Store interface {
@@ -69,14 +117,25 @@ type Bucket interface {
 	// the error is returned to the caller. The provided function must not modify
 	// the bucket; this will result in undefined behavior.
 	ForEach(fn func(k, v []byte) error) error
+	// ForEachPrefix executes a function for each key/value pair in a bucket
+	// whose key starts with prefix, like ForEach.
+	ForEachPrefix(prefix []byte, fn func(k, v []byte) error) error
+	// ForEachReverse executes a function for each key/value pair in a bucket
+	// whose key is in [start, end), last key first. A nil start or end leaves
+	// that side of the range open.
+	ForEachReverse(start, end []byte, fn func(k, v []byte) error) error
 	// Exists returns a key within this bucket. Errors if key does not exist.
 	Exists(key []byte) (bool, error)
 }
 
 // Service is the struct that cloudhub services are implemented on.
 type Service struct {
-	kv  Store
-	log cloudhub.Logger
+	kv             Store
+	log            cloudhub.Logger
+	secrets        keyring
+	migrations     []Migration
+	skipMigrations bool
+	readOnly       bool
 }
 
 // Option to change behavior of Open()
@@ -90,11 +149,22 @@ func WithLogger(logger cloudhub.Logger) Option {
 	}
 }
 
+// ReadOnly opens the store without writing to it: buckets are not created,
+// migrations are not applied and no default organization is added. Buckets
+// the store does not have yet read as empty.
+func ReadOnly() Option {
+	return func(s *Service) error {
+		s.readOnly = true
+		return nil
+	}
+}
+
 // NewService returns an instance of a Service.
 func NewService(ctx context.Context, kv Store, opts ...Option) (*Service, error) {
 	s := &Service{
-		log: mocks.NewLogger(),
-		kv:  kv,
+		log:        mocks.NewLogger(),
+		kv:         kv,
+		migrations: migrations,
 	}
 
 	for i := range opts {
@@ -103,12 +173,22 @@ func NewService(ctx context.Context, kv Store, opts ...Option) (*Service, error)
 		}
 	}
 
+	if s.readOnly {
+		return s, nil
+	}
+
 	if err := s.kv.Update(ctx, func(tx Tx) error {
 		return s.initialize(ctx, tx)
 	}); err != nil {
 		return nil, err
 	}
 
+	if !s.skipMigrations {
+		if _, err := s.Migrate(ctx, 0); err != nil {
+			return nil, err
+		}
+	}
+
 	return s, s.OrganizationsStore().CreateDefault(ctx)
 }
 
@@ -118,26 +198,6 @@ func (s *Service) Close() error {
 }
 
 func (s *Service) initialize(ctx context.Context, tx Tx) error {
-	buckets := [][]byte{
-		cellBucket,
-		configBucket,
-		dashboardsBucket,
-		mappingsBucket,
-		organizationConfigBucket,
-		organizationsBucket,
-		serversBucket,
-		sourcesBucket,
-		usersBucket,
-		vSpheresBucket,
-		topologyBucket,
-		cspBucket,
-		networkDeviceBucket,
-		networkDeviceOrgBucket,
-		mlNxRstBucket,
-		dlNxRstBucket,
-		dLNxRstStgBucket,
-	}
-
 	for i := range buckets {
 		if _, err := tx.CreateBucketIfNotExists(buckets[i]); err != nil {
 			return err
@@ -240,3 +300,68 @@ func (s *Service) DLNxRstStore() cloudhub.DLNxRstStore {
 func (s *Service) DLNxRstStgStore() cloudhub.DLNxRstStgStore {
 	return &DLNxRstStgStore{client: s}
 }
+
+// AuditStore returns a cloudhub.AuditStore.
+func (s *Service) AuditStore() cloudhub.AuditStore {
+	return &auditStore{client: s}
+}
+
+// DashboardRevisionsStore returns a cloudhub.DashboardRevisionsStore.
+func (s *Service) DashboardRevisionsStore() cloudhub.DashboardRevisionsStore {
+	return &dashboardRevisionsStore{
+		client:     s,
+		dashboards: &dashboardsStore{client: s, IDs: &id.UUID{}},
+	}
+}
+
+// APITokensStore returns a cloudhub.APITokensStore.
+func (s *Service) APITokensStore() cloudhub.APITokensStore {
+	return &apiTokensStore{client: s}
+}
+
+// HostKeysStore returns a cloudhub.HostKeysStore.
+func (s *Service) HostKeysStore() cloudhub.HostKeysStore {
+	return &hostKeysStore{client: s}
+}
+
+// TerminalRecordingsStore returns a cloudhub.TerminalRecordingsStore.
+func (s *Service) TerminalRecordingsStore() cloudhub.TerminalRecordingsStore {
+	return &terminalRecordingsStore{client: s}
+}
+
+// TerminalProfilesStore returns a cloudhub.TerminalProfilesStore.
+func (s *Service) TerminalProfilesStore() cloudhub.TerminalProfilesStore {
+	return &terminalProfilesStore{client: s}
+}
+
+// SaltJobsStore returns a cloudhub.SaltJobsStore.
+func (s *Service) SaltJobsStore() cloudhub.SaltJobsStore {
+	return &saltJobsStore{client: s}
+}
+
+// AlertEventsStore returns a cloudhub.AlertEventsStore.
+func (s *Service) AlertEventsStore() cloudhub.AlertEventsStore {
+	return &alertEventsStore{client: s}
+}
+
+// MaintenanceWindowsStore returns a cloudhub.MaintenanceWindowsStore.
+func (s *Service) MaintenanceWindowsStore() cloudhub.MaintenanceWindowsStore {
+	return &maintenanceWindowsStore{client: s}
+}
+
+// RuleTemplatesStore returns a cloudhub.RuleTemplatesStore.
+func (s *Service) RuleTemplatesStore() cloudhub.RuleTemplatesStore {
+	return &ruleTemplatesStore{client: s}
+}
+
+// nextRevision returns the revision of a record updated from revision cur,
+// or ErrRevisionMismatch if ctx asks for the record to be at another one.
+// It is called in the update transaction, so the check cannot race with
+// other updates: bolt runs them one at a time, and etcd retries a
+// transaction when the mod revision of a key it read changes under it.
+func nextRevision(ctx context.Context, cur int64) (int64, error) {
+	if want, ok := ctx.Value(cloudhub.RevisionContextKey).(int64); ok && want != cur {
+		return 0, cloudhub.ErrRevisionMismatch
+	}
+	return cur + 1, nil
+}
@@ -0,0 +1,158 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure maintenanceWindowsStore implements cloudhub.MaintenanceWindowsStore.
+var _ cloudhub.MaintenanceWindowsStore = &maintenanceWindowsStore{}
+
+// maintenanceWindowsStore uses a kv to store and retrieve maintenance windows
+type maintenanceWindowsStore struct {
+	client *Service
+}
+
+// Add creates a new MaintenanceWindow in the maintenanceWindowsStore
+func (s *maintenanceWindowsStore) Add(ctx context.Context, w *cloudhub.MaintenanceWindow) (*cloudhub.MaintenanceWindow, error) {
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(maintenanceWindowsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		w.ID = strconv.FormatUint(seq, 10)
+
+		v, err := internal.MarshalMaintenanceWindow(w)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(w.ID), v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// All returns all known maintenance windows
+func (s *maintenanceWindowsStore) All(ctx context.Context) ([]cloudhub.MaintenanceWindow, error) {
+	var windows []cloudhub.MaintenanceWindow
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(maintenanceWindowsBucket).ForEach(func(k, v []byte) error {
+			var w cloudhub.MaintenanceWindow
+			if err := internal.UnmarshalMaintenanceWindow(v, &w); err != nil {
+				return err
+			}
+			windows = append(windows, w)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// Delete the maintenance window from the maintenanceWindowsStore
+func (s *maintenanceWindowsStore) Delete(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	_, err := s.Get(ctx, w.ID)
+	if err != nil {
+		return err
+	}
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		return tx.Bucket(maintenanceWindowsBucket).Delete([]byte(w.ID))
+	})
+}
+
+// Get returns a maintenance window by ID
+func (s *maintenanceWindowsStore) Get(ctx context.Context, id string) (*cloudhub.MaintenanceWindow, error) {
+	var w cloudhub.MaintenanceWindow
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		v, err := tx.Bucket(maintenanceWindowsBucket).Get([]byte(id))
+		if v == nil || err != nil {
+			return cloudhub.ErrMaintenanceWindowNotFound
+		}
+		return internal.UnmarshalMaintenanceWindow(v, &w)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// Update the maintenance window in the maintenanceWindowsStore
+func (s *maintenanceWindowsStore) Update(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(maintenanceWindowsBucket)
+		if v, err := b.Get([]byte(w.ID)); v == nil || err != nil {
+			return cloudhub.ErrMaintenanceWindowNotFound
+		}
+		if v, err := internal.MarshalMaintenanceWindow(w); err != nil {
+			return err
+		} else if err := b.Put([]byte(w.ID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// UpdateSettings updates the maintenance window in the
+// maintenanceWindowsStore, keeping the state of its tasks as stored, as the
+// scheduler may have started or ended the window since w was read.
+func (s *maintenanceWindowsStore) UpdateSettings(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(maintenanceWindowsBucket)
+		v, err := b.Get([]byte(w.ID))
+		if v == nil || err != nil {
+			return cloudhub.ErrMaintenanceWindowNotFound
+		}
+		var cur cloudhub.MaintenanceWindow
+		if err := internal.UnmarshalMaintenanceWindow(v, &cur); err != nil {
+			return err
+		}
+		w.Active, w.DisabledTasks, w.PendingTasks = cur.Active, cur.DisabledTasks, cur.PendingTasks
+
+		if v, err := internal.MarshalMaintenanceWindow(w); err != nil {
+			return err
+		} else if err := b.Put([]byte(w.ID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// UpdateState updates the state of the tasks of the maintenance window in
+// the maintenanceWindowsStore, keeping its settings as stored, as they may
+// have been changed since w was read.
+func (s *maintenanceWindowsStore) UpdateState(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(maintenanceWindowsBucket)
+		v, err := b.Get([]byte(w.ID))
+		if v == nil || err != nil {
+			return cloudhub.ErrMaintenanceWindowNotFound
+		}
+		var cur cloudhub.MaintenanceWindow
+		if err := internal.UnmarshalMaintenanceWindow(v, &cur); err != nil {
+			return err
+		}
+		cur.Active, cur.DisabledTasks, cur.PendingTasks = w.Active, w.DisabledTasks, w.PendingTasks
+
+		if v, err := internal.MarshalMaintenanceWindow(&cur); err != nil {
+			return err
+		} else if err := b.Put([]byte(w.ID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
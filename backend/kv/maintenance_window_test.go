@@ -0,0 +1,97 @@
+package kv_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a MaintenanceWindowsStore can store, find, update and remove windows.
+func TestMaintenanceWindowsStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.MaintenanceWindowsStore()
+
+	windows := []cloudhub.MaintenanceWindow{
+		{Name: "db upgrade", Organization: "default", KapacitorID: 1, Hosts: []string{"db1", "db2"},
+			Start: time.Date(2023, 4, 1, 22, 0, 0, 0, time.UTC), End: time.Date(2023, 4, 2, 2, 0, 0, 0, time.UTC), Annotate: true, CreatedBy: "alice"},
+		{Name: "nightly backup", Organization: "default", KapacitorID: 1, RuleIDs: []string{"cloudhub-v1-a"}, Tags: map[string]string{"role": "backup"},
+			Cron: "0 2 * * 1-5", Duration: 30 * time.Minute, Timezone: "Asia/Seoul"},
+	}
+	for i := range windows {
+		w, err := s.Add(ctx, &windows[i])
+		if err != nil {
+			t.Fatalf("failed to add maintenance window: %v", err)
+		}
+		if w.ID == "" {
+			t.Fatalf("maintenance window was not assigned an ID")
+		}
+	}
+
+	for i := range windows {
+		got, err := s.Get(ctx, windows[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, windows[i]) {
+			t.Fatalf("maintenance window loaded is different than maintenance window saved; actual: %+v, expected %+v", *got, windows[i])
+		}
+	}
+
+	windows[1].Active = true
+	windows[1].DisabledTasks = []string{"cloudhub-v1-a"}
+	if err := s.Update(ctx, &windows[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, windows[1].ID); err != nil || !got.Active || !reflect.DeepEqual(got.DisabledTasks, windows[1].DisabledTasks) {
+		t.Fatalf("Update() did not store the state of the window: %+v, %v", got, err)
+	}
+
+	// settings read before the window started do not end it
+	settings := windows[1]
+	settings.Name = "nightly backups"
+	settings.Active, settings.DisabledTasks = false, nil
+	if err := s.UpdateSettings(ctx, &settings); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, windows[1].ID); err != nil || got.Name != "nightly backups" || !got.Active || !reflect.DeepEqual(got.DisabledTasks, windows[1].DisabledTasks) {
+		t.Fatalf("UpdateSettings() did not keep the state of the window: %+v, %v", got, err)
+	}
+	windows[1] = settings
+
+	state := windows[1]
+	state.Name = "stale name"
+	state.Active, state.DisabledTasks, state.PendingTasks = true, []string{"cloudhub-v1-a"}, []string{"cloudhub-v1-b"}
+	if err := s.UpdateState(ctx, &state); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, windows[1].ID); err != nil || got.Name != "nightly backups" || !reflect.DeepEqual(got.PendingTasks, state.PendingTasks) {
+		t.Fatalf("UpdateState() did not keep the settings of the window: %+v, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, &windows[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, windows[0].ID); err != cloudhub.ErrMaintenanceWindowNotFound {
+		t.Fatalf("Get() of a deleted window error = %v, want %v", err, cloudhub.ErrMaintenanceWindowNotFound)
+	}
+	if err := s.Update(ctx, &windows[0]); err != cloudhub.ErrMaintenanceWindowNotFound {
+		t.Fatalf("Update() of a deleted window error = %v, want %v", err, cloudhub.ErrMaintenanceWindowNotFound)
+	}
+
+	all, err := s.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Name != "nightly backups" {
+		t.Fatalf("All() = %v, want only the nightly backups window", all)
+	}
+}
@@ -0,0 +1,180 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// SchemaVersion is the version of the way records are stored in the buckets
+// by this version of cloudhub. It is the version of the last migration.
+// Stores created before schema versions were recorded are at version 1.
+const SchemaVersion = 4
+
+// schemaVersionKey is the key of the meta bucket holding the schema version
+// of the store.
+var schemaVersionKey = []byte("schemaVersion")
+
+// Migration changes the way records are stored in the buckets, bringing the
+// schema of the store from Version-1 to Version. A migration is run again if
+// the store stops before its version is recorded, so it has to be idempotent.
+// It has to keep etcd transactions under 128 operations, as Copy does.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, s *Service) error
+}
+
+// migrations are applied in order when the service is opened. Adding one
+// bumps SchemaVersion to its version.
+var migrations = []Migration{
+	{
+		Version:     2,
+		Description: "index network devices by IP, organization, learning state and collector server",
+		Up: func(ctx context.Context, s *Service) error {
+			_, err := s.RebuildIndexes(ctx)
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "index API tokens by the hash of their secret",
+		Up: func(ctx context.Context, s *Service) error {
+			_, err := s.RebuildIndexes(ctx)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "index network device organizations, rather than their devices, by collector server",
+		Up: func(ctx context.Context, s *Service) error {
+			_, err := s.RebuildIndexes(ctx)
+			return err
+		},
+	},
+}
+
+// WithMigrations replaces the migrations applied by the service (for testing).
+func WithMigrations(ms ...Migration) Option {
+	return func(s *Service) error {
+		for i := range ms {
+			if ms[i].Version != i+2 {
+				return fmt.Errorf("migration %q has version %d, want %d", ms[i].Description, ms[i].Version, i+2)
+			}
+		}
+		s.migrations = ms
+		return nil
+	}
+}
+
+// WithoutMigrations opens the store without applying pending migrations, so
+// that they can be listed and applied with Migrate.
+func WithoutMigrations() Option {
+	return func(s *Service) error {
+		s.skipMigrations = true
+		return nil
+	}
+}
+
+// Migrations returns the migrations of the service in the order they are
+// applied.
+func (s *Service) Migrations() []Migration {
+	return append([]Migration{}, s.migrations...)
+}
+
+// LatestSchemaVersion returns the schema version the service migrates the
+// store to.
+func (s *Service) LatestSchemaVersion() int {
+	if len(s.migrations) == 0 {
+		return 1
+	}
+	return s.migrations[len(s.migrations)-1].Version
+}
+
+// SchemaVersion returns the schema version the store is at.
+func (s *Service) SchemaVersion(ctx context.Context) (int, error) {
+	v, _, err := s.schemaVersion(ctx)
+	return v, err
+}
+
+// Migrate applies the migrations the store is missing, in order, up to
+// version to; 0 applies all of them. The schema version is recorded after
+// each migration, so a migration that fails is resumed by migrating again.
+// It returns the migrations that were applied. Stores with a schema version
+// newer than the latest one of the service are refused.
+func (s *Service) Migrate(ctx context.Context, to int) ([]Migration, error) {
+	v, recorded, err := s.schemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := s.LatestSchemaVersion()
+	if v > latest {
+		return nil, fmt.Errorf("store is at schema version %d, which is newer than version %d of this version of cloudhub", v, latest)
+	}
+	if to == 0 {
+		to = latest
+	}
+	if to > latest {
+		return nil, fmt.Errorf("unknown schema version %d, the latest one is %d", to, latest)
+	}
+	if to < v {
+		return nil, fmt.Errorf("store is at schema version %d; migrations cannot be reverted", v)
+	}
+
+	var applied []Migration
+	for _, m := range s.migrations {
+		if m.Version <= v || m.Version > to {
+			continue
+		}
+		s.log.
+			WithField("component", "kv").
+			Info(fmt.Sprintf("Migrating the schema to version %d: %s", m.Version, m.Description))
+		if err := m.Up(ctx, s); err != nil {
+			return applied, fmt.Errorf("migration to schema version %d failed: %v", m.Version, err)
+		}
+		if err := s.setSchemaVersion(ctx, m.Version); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+
+	if !recorded && len(applied) == 0 {
+		return nil, s.setSchemaVersion(ctx, v)
+	}
+	return applied, nil
+}
+
+// schemaVersion returns the schema version of the store, and whether it has
+// been recorded.
+func (s *Service) schemaVersion(ctx context.Context) (int, bool, error) {
+	var v int
+	var recorded bool
+	err := s.kv.View(ctx, func(tx Tx) error {
+		var err error
+		v, recorded, err = readSchemaVersion(tx)
+		return err
+	})
+	return v, recorded, err
+}
+
+// readSchemaVersion returns the schema version recorded in the meta bucket.
+// Stores that were created before versions were recorded are at version 1.
+func readSchemaVersion(tx Tx) (int, bool, error) {
+	// etcd errors for keys that are not found, bolt returns nil
+	b, _ := tx.Bucket(metaBucket).Get(schemaVersionKey)
+	if len(b) == 0 {
+		return 1, false, nil
+	}
+	v, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid schema version %q", b)
+	}
+	return v, true, nil
+}
+
+func (s *Service) setSchemaVersion(ctx context.Context, v int) error {
+	return s.kv.Update(ctx, func(tx Tx) error {
+		return tx.Bucket(metaBucket).Put(schemaVersionKey, []byte(strconv.Itoa(v)))
+	})
+}
@@ -0,0 +1,155 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv"
+	"github.com/snetsystems/cloudhub/backend/kv/bolt"
+)
+
+// openTestService opens the bolt file at path
+func openTestService(t *testing.T, path string, opts ...kv.Option) (*kv.Service, error) {
+	t.Helper()
+	ctx := context.Background()
+	b, err := bolt.NewClient(ctx, bolt.WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := kv.NewService(ctx, b, opts...)
+	if err != nil {
+		b.Close()
+	}
+	return svc, err
+}
+
+func TestService_SchemaVersion(t *testing.T) {
+	svc, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	if got := svc.LatestSchemaVersion(); got != kv.SchemaVersion {
+		t.Errorf("LatestSchemaVersion() = %d, want SchemaVersion %d", got, kv.SchemaVersion)
+	}
+	for i, m := range svc.Migrations() {
+		if m.Version != i+2 || m.Up == nil {
+			t.Errorf("migration %d %q has version %d, want %d", i, m.Description, m.Version, i+2)
+		}
+	}
+	if v, err := svc.SchemaVersion(context.Background()); err != nil || v != kv.SchemaVersion {
+		t.Errorf("SchemaVersion() of a new store = %d, %v; want %d", v, err, kv.SchemaVersion)
+	}
+}
+
+func TestService_Migrate(t *testing.T) {
+	ctx := context.Background()
+	f, err := ioutil.TempFile("", "cloudhub-bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// the first version of the store has a single source
+	svc, err := openTestService(t, f.Name(), kv.WithMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SourcesStore().Add(ctx, cloudhub.Source{Name: "Of Truth", Organization: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	svc.Close()
+
+	runs := map[int]int{}
+	fail := true
+	ms := []kv.Migration{
+		{
+			Version:     2,
+			Description: "rename sources",
+			Up: func(ctx context.Context, s *kv.Service) error {
+				runs[2]++
+				srcs, err := s.SourcesStore().All(ctx)
+				if err != nil {
+					return err
+				}
+				for _, src := range srcs {
+					src.Name = strings.ToUpper(src.Name)
+					if err := s.SourcesStore().Update(ctx, src); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     3,
+			Description: "add a server",
+			Up: func(ctx context.Context, s *kv.Service) error {
+				runs[3]++
+				if fail {
+					return errors.New("flux capacitor is not fluxing")
+				}
+				_, err := s.ServersStore().Add(ctx, cloudhub.Server{Name: "Doc", Organization: "default"})
+				return err
+			},
+		},
+	}
+
+	// a migration that fails stops at the version before it
+	if _, err := openTestService(t, f.Name(), kv.WithMigrations(ms...)); err == nil {
+		t.Fatal("NewService() with a failing migration succeeded")
+	}
+	svc, err = openTestService(t, f.Name(), kv.WithMigrations(ms...), kv.WithoutMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := svc.SchemaVersion(ctx); err != nil || v != 2 {
+		t.Errorf("SchemaVersion() after a failed migration = %d, %v; want 2", v, err)
+	}
+	if _, err := svc.Migrate(ctx, 1); err == nil {
+		t.Error("Migrate() to an older version succeeded")
+	}
+	svc.Close()
+
+	// opening the store again resumes the migrations
+	fail = false
+	svc, err = openTestService(t, f.Name(), kv.WithMigrations(ms...))
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	if runs[2] != 1 || runs[3] != 2 {
+		t.Errorf("migrations ran %v times, want each applied once", runs)
+	}
+	if v, err := svc.SchemaVersion(ctx); err != nil || v != 3 {
+		t.Errorf("SchemaVersion() = %d, %v; want 3", v, err)
+	}
+	srcs, err := svc.SourcesStore().All(ctx)
+	if err != nil || len(srcs) != 1 || srcs[0].Name != "OF TRUTH" {
+		t.Errorf("sources after the migrations = %+v, %v", srcs, err)
+	}
+	if applied, err := svc.Migrate(ctx, 0); err != nil || len(applied) != 0 {
+		t.Errorf("Migrate() of a migrated store applied %v, %v", applied, err)
+	}
+	svc.Close()
+
+	// an older version of cloudhub does not open the store
+	if _, err := openTestService(t, f.Name(), kv.WithMigrations(ms[0])); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("NewService() of a newer store error = %v", err)
+	}
+	// but can still tell the version of the store
+	svc, err = openTestService(t, f.Name(), kv.WithMigrations(ms[0]), kv.WithoutMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	if v, err := svc.SchemaVersion(ctx); err != nil || v != 3 {
+		t.Errorf("SchemaVersion() = %d, %v; want 3", v, err)
+	}
+}
@@ -25,7 +25,7 @@ func (s *NetworkDeviceStore) get(ctx context.Context, id string) (*cloudhub.Netw
 		if v == nil || err != nil {
 			return cloudhub.ErrDeviceNotFound
 		}
-		return internal.UnmarshalNetworkDevice(v, &device)
+		return s.unmarshal(v, &device)
 	})
 
 	if err != nil {
@@ -40,8 +40,8 @@ func (s *NetworkDeviceStore) each(ctx context.Context, fn func(*cloudhub.Network
 	return s.client.kv.View(ctx, func(tx Tx) error {
 		return tx.Bucket(networkDeviceBucket).ForEach(func(k, v []byte) error {
 			var device cloudhub.NetworkDevice
-			if err := internal.UnmarshalNetworkDevice(v, &device); err != nil {
-				return nil
+			if err := s.unmarshal(v, &device); err != nil {
+				return err
 			}
 			fn(&device)
 			return nil
@@ -69,13 +69,14 @@ func (s *NetworkDeviceStore) Add(ctx context.Context, device *cloudhub.NetworkDe
 
 		strID := strconv.FormatUint(seq, 10)
 		device.ID = strID
+		device.Revision = 1
 
-		if v, err := internal.MarshalNetworkDevice(device); err != nil {
+		if v, err := s.marshal(*device); err != nil {
 			return err
 		} else if err := b.Put([]byte(strID), v); err != nil {
 			return err
 		}
-		return nil
+		return updateIndex(tx, networkDeviceIndexBucket, nil, deviceIndexEntries(device))
 	}); err != nil {
 		return nil, err
 	}
@@ -86,16 +87,18 @@ func (s *NetworkDeviceStore) Add(ctx context.Context, device *cloudhub.NetworkDe
 // Delete removes the Device from the deviceStore.
 func (s *NetworkDeviceStore) Delete(ctx context.Context, device *cloudhub.NetworkDevice) error {
 	if err := s.client.kv.Update(ctx, func(tx Tx) error {
-
-		_, err := s.get(ctx, device.ID)
-		if err != nil {
+		b := tx.Bucket(networkDeviceBucket)
+		var cur cloudhub.NetworkDevice
+		if v, err := b.Get([]byte(device.ID)); v == nil || err != nil {
 			return cloudhub.ErrDeviceNotFound
+		} else if err := internal.UnmarshalNetworkDevice(v, &cur); err != nil {
+			return err
 		}
 
-		if err := tx.Bucket(networkDeviceBucket).Delete([]byte(device.ID)); err != nil {
+		if err := b.Delete([]byte(device.ID)); err != nil {
 			return err
 		}
-		return nil
+		return updateIndex(tx, networkDeviceIndexBucket, deviceIndexEntries(&cur), nil)
 	}); err != nil {
 		return err
 	}
@@ -103,25 +106,38 @@ func (s *NetworkDeviceStore) Delete(ctx context.Context, device *cloudhub.Networ
 	return nil
 }
 
-// Update modifies an existing Device in the deviceStore.
+// Update modifies an existing Device in the deviceStore. The update is
+// conditional on the revision in ctx, if any, and sets the revision of
+// device to the new one.
 func (s *NetworkDeviceStore) Update(ctx context.Context, device *cloudhub.NetworkDevice) error {
+	var rev int64
 	if err := s.client.kv.Update(ctx, func(tx Tx) error {
 		// Get an existing Device with the same ID.
-		_, err := s.get(ctx, device.ID)
-		if err != nil {
+		b := tx.Bucket(networkDeviceBucket)
+		var cur cloudhub.NetworkDevice
+		if v, err := b.Get([]byte(device.ID)); v == nil || err != nil {
 			return cloudhub.ErrDeviceNotFound
+		} else if err := internal.UnmarshalNetworkDevice(v, &cur); err != nil {
+			return err
+		}
+		var err error
+		if rev, err = nextRevision(ctx, cur.Revision); err != nil {
+			return err
 		}
 
-		if v, err := internal.MarshalNetworkDevice(device); err != nil {
+		up := *device
+		up.Revision = rev
+		if v, err := s.marshal(up); err != nil {
 			return err
-		} else if err := tx.Bucket(networkDeviceBucket).Put([]byte(device.ID), v); err != nil {
+		} else if err := b.Put([]byte(device.ID), v); err != nil {
 			return err
 		}
-		return nil
+		return updateIndex(tx, networkDeviceIndexBucket, deviceIndexEntries(&cur), deviceIndexEntries(&up))
 	}); err != nil {
 		return err
 	}
 
+	device.Revision = rev
 	return nil
 }
 
@@ -139,15 +155,117 @@ func (s *NetworkDeviceStore) All(ctx context.Context) ([]cloudhub.NetworkDevice,
 	return devices, nil
 }
 
+// Find returns the Devices matching every attribute set in q, looking them
+// up in the device index. A query without attributes returns all Devices.
+func (s *NetworkDeviceStore) Find(ctx context.Context, q cloudhub.NetworkDeviceQuery) ([]cloudhub.NetworkDevice, error) {
+	lookups := []struct {
+		field string
+		value *string
+	}{
+		{deviceIPIndex, q.DeviceIP},
+		{deviceOrgIndex, q.Organization},
+		{deviceLearningIndex, q.LearningState},
+		{deviceCollectorIndex, q.CollectorServer},
+	}
+
+	var devices []cloudhub.NetworkDevice
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		// ids is nil until an attribute restricts the devices
+		var ids []string
+		if q.ID != nil {
+			ids = []string{*q.ID}
+		}
+		for _, l := range lookups {
+			if l.value == nil {
+				continue
+			}
+			var found []string
+			var err error
+			if l.field == deviceCollectorIndex {
+				found, err = collectorLookup(tx, *l.value)
+			} else {
+				found, err = indexLookup(tx, networkDeviceIndexBucket, l.field, *l.value)
+			}
+			if err != nil {
+				return err
+			}
+			ids = intersectIDs(ids, found)
+		}
+
+		b := tx.Bucket(networkDeviceBucket)
+		if ids == nil {
+			return b.ForEach(func(k, v []byte) error {
+				var device cloudhub.NetworkDevice
+				if err := s.unmarshal(v, &device); err != nil {
+					return err
+				}
+				devices = append(devices, device)
+				return nil
+			})
+		}
+		for _, id := range ids {
+			// entries of devices that are gone are skipped until the
+			// indexes are rebuilt
+			v, err := b.Get([]byte(id))
+			if v == nil || err != nil {
+				continue
+			}
+			var device cloudhub.NetworkDevice
+			if err := s.unmarshal(v, &device); err != nil {
+				return err
+			}
+			devices = append(devices, device)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// intersectIDs returns the IDs of found that are in ids, in the order of
+// found and without duplicates. A nil ids does not restrict found.
+func intersectIDs(ids, found []string) []string {
+	var in map[string]bool
+	if ids != nil {
+		in = map[string]bool{}
+		for _, id := range ids {
+			in[id] = true
+		}
+	}
+	seen := map[string]bool{}
+	res := []string{}
+	for _, id := range found {
+		if seen[id] || (in != nil && !in[id]) {
+			continue
+		}
+		seen[id] = true
+		res = append(res, id)
+	}
+	return res
+}
+
 // DeleteAll all known Devices delete
 func (s *NetworkDeviceStore) DeleteAll(ctx context.Context) error {
 
 	// Fetch all keys with the specified prefix
-	var keys [][]byte
+	type deviceKey struct {
+		key     []byte
+		entries indexEntries
+	}
+	var keys []deviceKey
 	err := s.client.kv.View(ctx, func(tx Tx) error {
 		bucket := tx.Bucket(networkDeviceBucket)
 		return bucket.ForEach(func(k, v []byte) error {
-			keys = append(keys, k)
+			dk := deviceKey{key: append([]byte{}, k...)}
+			var device cloudhub.NetworkDevice
+			if err := internal.UnmarshalNetworkDevice(v, &device); err == nil {
+				dk.entries = deviceIndexEntries(&device)
+			}
+			keys = append(keys, dk)
 			return nil
 		})
 	})
@@ -156,19 +274,62 @@ func (s *NetworkDeviceStore) DeleteAll(ctx context.Context) error {
 		return fmt.Errorf("failed to get keys: %v", err)
 	}
 
-	err = s.client.kv.Update(ctx, func(tx Tx) error {
-		bucket := tx.Bucket(networkDeviceBucket)
-		for _, k := range keys {
-			if err := bucket.Delete(k); err != nil {
-				return fmt.Errorf("failed to delete key %s: %v", k, err)
-			}
+	// each device is deleted along with its index entries, in batches that
+	// etcd accepts in one transaction
+	for len(keys) > 0 {
+		n, ops := 1, 1+len(keys[0].entries)
+		for n < len(keys) && ops+1+len(keys[n].entries) <= copyBatchSize {
+			ops += 1 + len(keys[n].entries)
+			n++
 		}
-		return nil
-	})
+		batch := keys[:n]
+		keys = keys[n:]
 
-	if err != nil {
-		return fmt.Errorf("failed to delete keys: %v", err)
+		err = s.client.kv.Update(ctx, func(tx Tx) error {
+			bucket := tx.Bucket(networkDeviceBucket)
+			for _, dk := range batch {
+				if err := bucket.Delete(dk.key); err != nil {
+					return fmt.Errorf("failed to delete key %s: %v", dk.key, err)
+				}
+				if err := updateIndex(tx, networkDeviceIndexBucket, dk.entries, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to delete keys: %v", err)
+		}
 	}
 
 	return nil
 }
+
+// deviceSecrets returns the credential fields of device that are encrypted at rest.
+func deviceSecrets(device *cloudhub.NetworkDevice) []*string {
+	return []*string{
+		&device.SSHConfig.Password,
+		&device.SSHConfig.EnPassword,
+		&device.SNMPConfig.Community,
+		&device.SNMPConfig.AuthPass,
+		&device.SNMPConfig.PrivPass,
+	}
+}
+
+// marshal encrypts the secrets of device and encodes it to binary protobuf format.
+// device is passed by value so the caller's copy keeps its cleartext secrets.
+func (s *NetworkDeviceStore) marshal(device cloudhub.NetworkDevice) ([]byte, error) {
+	if err := s.client.sealSecrets(deviceSecrets(&device)...); err != nil {
+		return nil, err
+	}
+	return internal.MarshalNetworkDevice(&device)
+}
+
+// unmarshal decodes a device from binary protobuf data and decrypts its secrets.
+func (s *NetworkDeviceStore) unmarshal(v []byte, device *cloudhub.NetworkDevice) error {
+	if err := internal.UnmarshalNetworkDevice(v, device); err != nil {
+		return err
+	}
+	return s.client.openSecrets(deviceSecrets(device)...)
+}
@@ -16,17 +16,26 @@ type NetworkDeviceOrgStore struct {
 	client *Service
 }
 
-// Add creates a new Device in the deviceStore
+// Add creates a new Device in the deviceStore. An org that is added again
+// replaces the stored one at its next revision.
 func (s *NetworkDeviceOrgStore) Add(ctx context.Context, org *cloudhub.NetworkDeviceOrg) (*cloudhub.NetworkDeviceOrg, error) {
 	if err := s.client.kv.Update(ctx, func(tx Tx) error {
 		b := tx.Bucket(networkDeviceOrgBucket)
 
+		var cur cloudhub.NetworkDeviceOrg
+		if v, err := b.Get([]byte(org.ID)); err == nil && v != nil {
+			if err := internal.UnmarshalNetworkDeviceOrg(v, &cur); err != nil {
+				return err
+			}
+		}
+		org.Revision = cur.Revision + 1
+
 		if v, err := internal.MarshalNetworkDeviceOrg(org); err != nil {
 			return err
 		} else if err := b.Put([]byte(org.ID), v); err != nil {
 			return err
 		}
-		return nil
+		return updateIndex(tx, networkDeviceIndexBucket, deviceOrgIndexEntries(&cur), deviceOrgIndexEntries(org))
 	}); err != nil {
 		return nil, err
 	}
@@ -64,16 +73,18 @@ func (s *NetworkDeviceOrgStore) get(ctx context.Context, id string) (*cloudhub.N
 // Delete removes the Device from the deviceStore.
 func (s *NetworkDeviceOrgStore) Delete(ctx context.Context, org *cloudhub.NetworkDeviceOrg) error {
 	if err := s.client.kv.Update(ctx, func(tx Tx) error {
-
-		_, err := s.get(ctx, org.ID)
-		if err != nil {
+		b := tx.Bucket(networkDeviceOrgBucket)
+		var cur cloudhub.NetworkDeviceOrg
+		if v, err := b.Get([]byte(org.ID)); v == nil || err != nil {
 			return cloudhub.ErrDeviceOrgNotFound
+		} else if err := internal.UnmarshalNetworkDeviceOrg(v, &cur); err != nil {
+			return err
 		}
 
-		if err := tx.Bucket(networkDeviceOrgBucket).Delete([]byte(org.ID)); err != nil {
+		if err := b.Delete([]byte(org.ID)); err != nil {
 			return err
 		}
-		return nil
+		return updateIndex(tx, networkDeviceIndexBucket, deviceOrgIndexEntries(&cur), nil)
 	}); err != nil {
 		return err
 	}
@@ -81,26 +92,39 @@ func (s *NetworkDeviceOrgStore) Delete(ctx context.Context, org *cloudhub.Networ
 	return nil
 }
 
-// Update modifies an existing Device in the deviceStore.
+// Update modifies an existing Device in the deviceStore. The update is
+// conditional on the revision in ctx, if any, and sets the revision of org
+// to the new one.
 func (s *NetworkDeviceOrgStore) Update(ctx context.Context, org *cloudhub.NetworkDeviceOrg) error {
+	var rev int64
 	if err := s.client.kv.Update(ctx, func(tx Tx) error {
 
 		// Get an existing Device with the same ID.
-		_, err := s.get(ctx, org.ID)
-		if err != nil {
+		b := tx.Bucket(networkDeviceOrgBucket)
+		var cur cloudhub.NetworkDeviceOrg
+		if v, err := b.Get([]byte(org.ID)); v == nil || err != nil {
 			return cloudhub.ErrDeviceOrgNotFound
+		} else if err := internal.UnmarshalNetworkDeviceOrg(v, &cur); err != nil {
+			return err
+		}
+		var err error
+		if rev, err = nextRevision(ctx, cur.Revision); err != nil {
+			return err
 		}
 
-		if v, err := internal.MarshalNetworkDeviceOrg(org); err != nil {
+		up := *org
+		up.Revision = rev
+		if v, err := internal.MarshalNetworkDeviceOrg(&up); err != nil {
 			return err
-		} else if err := tx.Bucket(networkDeviceOrgBucket).Put([]byte(org.ID), v); err != nil {
+		} else if err := b.Put([]byte(org.ID), v); err != nil {
 			return err
 		}
-		return nil
+		return updateIndex(tx, networkDeviceIndexBucket, deviceOrgIndexEntries(&cur), deviceOrgIndexEntries(&up))
 	}); err != nil {
 		return err
 	}
 
+	org.Revision = rev
 	return nil
 }
 
@@ -72,6 +72,7 @@ func TestNetworkDeviceStore(t *testing.T) {
 			t.Fatal(err)
 		}
 		devices[i].ID = rtnDevice.ID
+		devices[i].Revision = 1
 
 		// Check out first device in the store is the same as the original.
 		if actual, err := s.Get(ctx, cloudhub.NetworkDeviceQuery{ID: &rtnDevice.ID}); err != nil {
@@ -123,3 +124,86 @@ func TestNetworkDeviceStore(t *testing.T) {
 		t.Fatalf("Device delete error: got %v, expected %v", err, cloudhub.ErrDeviceNotFound)
 	}
 }
+
+func TestNetworkDeviceStore_Find(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.NetworkDeviceStore()
+
+	var ids []string
+	for _, d := range []cloudhub.NetworkDevice{
+		{Organization: "default", DeviceIP: "10.0.0.1", LearningState: "Ready"},
+		{Organization: "default", DeviceIP: "10.0.0.2", LearningState: "Learning"},
+		{Organization: "1", DeviceIP: "10.0.0.3", LearningState: "Ready"},
+	} {
+		d := d
+		added, err := s.Add(ctx, &d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, added.ID)
+	}
+	if _, err := c.NetworkDeviceOrgStore().Add(ctx, &cloudhub.NetworkDeviceOrg{
+		ID:                  "default",
+		CollectorServer:     "collector01",
+		CollectedDevicesIDs: []string{ids[0], ids[1]},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second device moves to the other organization and starts learning
+	moved, err := s.Get(ctx, cloudhub.NetworkDeviceQuery{ID: &ids[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved.Organization = "1"
+	moved.LearningState = "Ready"
+	if err := s.Update(ctx, moved); err != nil {
+		t.Fatal(err)
+	}
+	// the third device is deleted
+	if err := s.Delete(ctx, &cloudhub.NetworkDevice{ID: ids[2]}); err != nil {
+		t.Fatal(err)
+	}
+
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name string
+		q    cloudhub.NetworkDeviceQuery
+		want []string
+	}{
+		{name: "all devices", want: []string{ids[0], ids[1]}},
+		{name: "by IP", q: cloudhub.NetworkDeviceQuery{DeviceIP: str("10.0.0.1")}, want: []string{ids[0]}},
+		{name: "by deleted IP", q: cloudhub.NetworkDeviceQuery{DeviceIP: str("10.0.0.3")}},
+		{name: "by organization", q: cloudhub.NetworkDeviceQuery{Organization: str("1")}, want: []string{ids[1]}},
+		{name: "by learning state", q: cloudhub.NetworkDeviceQuery{LearningState: str("Ready")}, want: []string{ids[0], ids[1]}},
+		{name: "by old learning state", q: cloudhub.NetworkDeviceQuery{LearningState: str("Learning")}},
+		{name: "by collector server", q: cloudhub.NetworkDeviceQuery{CollectorServer: str("collector01")}, want: []string{ids[0], ids[1]}},
+		{
+			name: "by collector server and organization",
+			q:    cloudhub.NetworkDeviceQuery{CollectorServer: str("collector01"), Organization: str("default")},
+			want: []string{ids[0]},
+		},
+		{name: "by ID and IP", q: cloudhub.NetworkDeviceQuery{ID: &ids[1], DeviceIP: str("10.0.0.1")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, err := s.Find(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range devices {
+				got = append(got, d.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
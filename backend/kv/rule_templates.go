@@ -0,0 +1,141 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure ruleTemplatesStore implements cloudhub.RuleTemplatesStore.
+var _ cloudhub.RuleTemplatesStore = &ruleTemplatesStore{}
+
+// ruleTemplatesStore uses a kv to store and retrieve rule templates
+type ruleTemplatesStore struct {
+	client *Service
+}
+
+// Add creates a new RuleTemplate in the ruleTemplatesStore
+func (s *ruleTemplatesStore) Add(ctx context.Context, t *cloudhub.RuleTemplate) (*cloudhub.RuleTemplate, error) {
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(ruleTemplatesBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		t.ID = strconv.FormatUint(seq, 10)
+
+		v, err := internal.MarshalRuleTemplate(t)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(t.ID), v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// All returns all known rule templates
+func (s *ruleTemplatesStore) All(ctx context.Context) ([]cloudhub.RuleTemplate, error) {
+	var templates []cloudhub.RuleTemplate
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(ruleTemplatesBucket).ForEach(func(k, v []byte) error {
+			var t cloudhub.RuleTemplate
+			if err := internal.UnmarshalRuleTemplate(v, &t); err != nil {
+				return err
+			}
+			templates = append(templates, t)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// Delete the rule template from the ruleTemplatesStore
+func (s *ruleTemplatesStore) Delete(ctx context.Context, t *cloudhub.RuleTemplate) error {
+	_, err := s.Get(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		return tx.Bucket(ruleTemplatesBucket).Delete([]byte(t.ID))
+	})
+}
+
+// Get returns a rule template by ID
+func (s *ruleTemplatesStore) Get(ctx context.Context, id string) (*cloudhub.RuleTemplate, error) {
+	var t cloudhub.RuleTemplate
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		v, err := tx.Bucket(ruleTemplatesBucket).Get([]byte(id))
+		if v == nil || err != nil {
+			return cloudhub.ErrRuleTemplateNotFound
+		}
+		return internal.UnmarshalRuleTemplate(v, &t)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Update the rule template in the ruleTemplatesStore, keeping its instances
+// as stored, as they may have been instantiated or synced since t was read.
+func (s *ruleTemplatesStore) Update(ctx context.Context, t *cloudhub.RuleTemplate) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(ruleTemplatesBucket)
+		v, err := b.Get([]byte(t.ID))
+		if v == nil || err != nil {
+			return cloudhub.ErrRuleTemplateNotFound
+		}
+		var cur cloudhub.RuleTemplate
+		if err := internal.UnmarshalRuleTemplate(v, &cur); err != nil {
+			return err
+		}
+		t.Instances = cur.Instances
+
+		if v, err := internal.MarshalRuleTemplate(t); err != nil {
+			return err
+		} else if err := b.Put([]byte(t.ID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// UpdateInstances updates the instances of the rule template in the
+// ruleTemplatesStore from the stored ones, in the same transaction, so that
+// the instances added or synced concurrently are kept.
+func (s *ruleTemplatesStore) UpdateInstances(ctx context.Context, id string, fn func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(ruleTemplatesBucket)
+		v, err := b.Get([]byte(id))
+		if v == nil || err != nil {
+			return cloudhub.ErrRuleTemplateNotFound
+		}
+		var t cloudhub.RuleTemplate
+		if err := internal.UnmarshalRuleTemplate(v, &t); err != nil {
+			return err
+		}
+		t.Instances = fn(t.Instances)
+
+		if v, err := internal.MarshalRuleTemplate(&t); err != nil {
+			return err
+		} else if err := b.Put([]byte(id), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+package kv_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a RuleTemplatesStore can store, find, update and remove templates.
+func TestRuleTemplatesStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.RuleTemplatesStore()
+
+	templates := []cloudhub.RuleTemplate{
+		{Name: "high cpu", Organization: "default", CreatedBy: "alice",
+			Rule: cloudhub.AlertRule{
+				Name:          "high cpu of [[ .host ]]",
+				Trigger:       "threshold",
+				TriggerValues: cloudhub.TriggerValues{Operator: "greater than", Value: "[[ .threshold ]]"},
+				Query: &cloudhub.QueryConfig{
+					Database:    "telegraf",
+					Measurement: "cpu",
+					Tags:        map[string][]string{"host": {"[[ .host ]]"}},
+				},
+			},
+			Variables: map[string]string{"host": "", "threshold": "90"}},
+		{Name: "deadman", Organization: "default",
+			Rule: cloudhub.AlertRule{Name: "deadman", TICKScript: "stream|from()"}},
+	}
+	for i := range templates {
+		tmpl, err := s.Add(ctx, &templates[i])
+		if err != nil {
+			t.Fatalf("failed to add rule template: %v", err)
+		}
+		if tmpl.ID == "" {
+			t.Fatalf("rule template was not assigned an ID")
+		}
+	}
+
+	for i := range templates {
+		got, err := s.Get(ctx, templates[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, templates[i]) {
+			t.Fatalf("rule template loaded is different than rule template saved; actual: %+v, expected %+v", *got, templates[i])
+		}
+	}
+
+	instances := []cloudhub.RuleTemplateInstance{
+		{KapacitorID: 1, Organization: "default", TaskID: "cloudhub-v1-a", Params: map[string]string{"host": "web1"}},
+	}
+	if err := s.UpdateInstances(ctx, templates[0].ID, func(insts []cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance {
+		return append(insts, instances...)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, templates[0].ID); err != nil || !reflect.DeepEqual(got.Instances, instances) {
+		t.Fatalf("UpdateInstances() did not store the instances of the template: %+v, %v", got, err)
+	}
+
+	templates[0].CreatedBy = "bob"
+	if err := s.Update(ctx, &templates[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, templates[0].ID); err != nil || got.CreatedBy != "bob" || !reflect.DeepEqual(got.Instances, instances) {
+		t.Fatalf("Update() did not keep the instances of the template: %+v, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, &templates[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, templates[1].ID); err != cloudhub.ErrRuleTemplateNotFound {
+		t.Fatalf("Get() of a deleted template error = %v, want %v", err, cloudhub.ErrRuleTemplateNotFound)
+	}
+	if err := s.Update(ctx, &templates[1]); err != cloudhub.ErrRuleTemplateNotFound {
+		t.Fatalf("Update() of a deleted template error = %v, want %v", err, cloudhub.ErrRuleTemplateNotFound)
+	}
+
+	all, err := s.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Name != "high cpu" {
+		t.Fatalf("All() = %v, want only the high cpu template", all)
+	}
+}
@@ -0,0 +1,127 @@
+package kv
+
+import (
+	"context"
+	"errors"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure saltJobsStore implements cloudhub.SaltJobsStore.
+var _ cloudhub.SaltJobsStore = &saltJobsStore{}
+
+// saltJobsStore uses a kv to store and retrieve Salt jobs
+type saltJobsStore struct {
+	client *Service
+}
+
+// Add creates a new SaltJob in the saltJobsStore
+func (s *saltJobsStore) Add(ctx context.Context, j *cloudhub.SaltJob) (*cloudhub.SaltJob, error) {
+	if j.JID == "" {
+		return nil, errors.New("salt job has no jid")
+	}
+
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		v, err := s.marshal(*j)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(saltJobsBucket).Put([]byte(j.JID), v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// All returns all known Salt jobs
+func (s *saltJobsStore) All(ctx context.Context) ([]cloudhub.SaltJob, error) {
+	var jobs []cloudhub.SaltJob
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(saltJobsBucket).ForEach(func(k, v []byte) error {
+			var j cloudhub.SaltJob
+			if err := s.unmarshal(v, &j); err != nil {
+				return err
+			}
+			jobs = append(jobs, j)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Delete the Salt job from the saltJobsStore
+func (s *saltJobsStore) Delete(ctx context.Context, j *cloudhub.SaltJob) error {
+	_, err := s.Get(ctx, j.JID)
+	if err != nil {
+		return err
+	}
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		return tx.Bucket(saltJobsBucket).Delete([]byte(j.JID))
+	})
+}
+
+// Get returns a Salt job by JID
+func (s *saltJobsStore) Get(ctx context.Context, jid string) (*cloudhub.SaltJob, error) {
+	var j cloudhub.SaltJob
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		v, err := tx.Bucket(saltJobsBucket).Get([]byte(jid))
+		if v == nil || err != nil {
+			return cloudhub.ErrSaltJobNotFound
+		}
+		return s.unmarshal(v, &j)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+// Update the Salt job in the saltJobsStore
+func (s *saltJobsStore) Update(ctx context.Context, j *cloudhub.SaltJob) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		if v, err := s.marshal(*j); err != nil {
+			return err
+		} else if err := tx.Bucket(saltJobsBucket).Put([]byte(j.JID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// saltJobSecrets lists the arguments of a job that are encrypted at rest, as
+// they may hold the contents of configuration files with credentials.
+func saltJobSecrets(j *cloudhub.SaltJob) []*string {
+	secrets := []*string{&j.Kwarg}
+	for i := range j.Arg {
+		secrets = append(secrets, &j.Arg[i])
+	}
+	return secrets
+}
+
+// marshal encrypts the arguments of j and encodes it to binary protobuf format.
+func (s *saltJobsStore) marshal(j cloudhub.SaltJob) ([]byte, error) {
+	j.Arg = append([]string(nil), j.Arg...)
+	if err := s.client.sealSecrets(saltJobSecrets(&j)...); err != nil {
+		return nil, err
+	}
+	return internal.MarshalSaltJob(&j)
+}
+
+// unmarshal decodes a job from binary protobuf data and decrypts its arguments.
+func (s *saltJobsStore) unmarshal(v []byte, j *cloudhub.SaltJob) error {
+	if err := internal.UnmarshalSaltJob(v, j); err != nil {
+		return err
+	}
+	return s.client.openSecrets(saltJobSecrets(j)...)
+}
@@ -0,0 +1,71 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a SaltJobsStore can store, find, update and remove jobs.
+func TestSaltJobsStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.SaltJobsStore()
+
+	if _, err := s.Add(ctx, &cloudhub.SaltJob{Function: "test.ping"}); err == nil {
+		t.Fatalf("Add() of a job without a jid succeeded")
+	}
+
+	created := time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+	jobs := []cloudhub.SaltJob{
+		{JID: "20151021162900000001", Organization: "default", Client: "local_async", Function: "file.write", Target: "ch-collector-1", Arg: []string{"/etc/logstash/conf.d/default.rb", "password => \"88mph\""}, Minions: []string{"ch-collector-1"}, Requester: "doc", Status: cloudhub.SaltJobPending, CreatedAt: created},
+		{JID: "20151021162900000002", Organization: "default", Client: "runner_async", Function: "service.reload", Kwarg: `{"name":"telegraf.service"}`, Requester: "doc", Status: cloudhub.SaltJobPending, CreatedAt: created},
+	}
+	for i := range jobs {
+		if _, err := s.Add(ctx, &jobs[i]); err != nil {
+			t.Fatalf("failed to add salt job: %v", err)
+		}
+	}
+
+	got, err := s.Get(ctx, jobs[0].JID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, jobs[0]) {
+		t.Fatalf("salt job loaded is different than salt job saved; actual: %+v, expected %+v", *got, jobs[0])
+	}
+
+	got.Status = cloudhub.SaltJobSucceeded
+	got.Result = json.RawMessage(`{"ch-collector-1":"Wrote 1 lines"}`)
+	got.FinishedAt = created.Add(time.Minute)
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.Get(ctx, jobs[0].JID); err != nil || !got.Finished() || string(got.Result) != `{"ch-collector-1":"Wrote 1 lines"}` {
+		t.Fatalf("Update() did not store the result: %+v, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, &jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, jobs[0].JID); err != cloudhub.ErrSaltJobNotFound {
+		t.Fatalf("Get() of a deleted job error = %v, want %v", err, cloudhub.ErrSaltJobNotFound)
+	}
+
+	all, err := s.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Kwarg != `{"name":"telegraf.service"}` {
+		t.Fatalf("All() = %v, want only the service.reload job", all)
+	}
+}
@@ -0,0 +1,338 @@
+package kv
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// MasterKeySize is the size in bytes of a master key.
+const MasterKeySize = 32
+
+// secretPrefix marks a field value that has been sealed by the envelope
+// encryption layer. The remainder of a sealed value is
+// "<master key id>$<wrapped data key>$<ciphertext>".
+const secretPrefix = "$chenc1$"
+
+var (
+	// ErrInvalidMasterKey is returned when a master key is not a base64 or hex encoded 32-byte key.
+	ErrInvalidMasterKey = fmt.Errorf("master key must be %d bytes encoded as base64 or hex", MasterKeySize)
+	// ErrMasterKeyRequired is returned when an encrypted secret is read without a master key configured.
+	ErrMasterKeyRequired = errors.New("encrypted secret found but no master key is configured")
+	// ErrMasterKeyUnknown is returned when a secret was sealed with a master key that is not configured.
+	ErrMasterKeyUnknown = errors.New("secret was encrypted with an unknown master key")
+	// ErrInvalidSecret is returned when a sealed secret cannot be decoded.
+	ErrInvalidSecret = errors.New("malformed encrypted secret")
+)
+
+// masterKey is a key-encryption key used to wrap per-record data keys.
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func newMasterKey(key []byte) (*masterKey, error) {
+	if len(key) != MasterKeySize {
+		return nil, ErrInvalidMasterKey
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &masterKey{
+		id:   hex.EncodeToString(sum[:4]),
+		aead: aead,
+	}, nil
+}
+
+// keyring holds the master key that seals new secrets along with any
+// previous master keys that are still accepted when opening old ones.
+type keyring struct {
+	primary *masterKey
+	keys    map[string]*masterKey
+}
+
+func (k *keyring) add(key []byte, primary bool) error {
+	mk, err := newMasterKey(key)
+	if err != nil {
+		return err
+	}
+	if k.keys == nil {
+		k.keys = map[string]*masterKey{}
+	}
+	k.keys[mk.id] = mk
+	if primary {
+		k.primary = mk
+	}
+	return nil
+}
+
+// WithMasterKey sets the master key used to encrypt secrets at rest.
+// Without a master key secrets are stored in cleartext.
+func WithMasterKey(key []byte) Option {
+	return func(s *Service) error {
+		if len(key) == 0 {
+			return nil
+		}
+		return s.secrets.add(key, true)
+	}
+}
+
+// WithPreviousMasterKeys allows secrets encrypted with older master keys to be
+// read. New secrets are always encrypted with the key set by WithMasterKey.
+func WithPreviousMasterKeys(keys ...[]byte) Option {
+	return func(s *Service) error {
+		for _, key := range keys {
+			if err := s.secrets.add(key, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// GenerateMasterKey returns a new random master key encoded as base64.
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// DecodeMasterKey decodes a base64 or hex encoded master key.
+func DecodeMasterKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == MasterKeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == MasterKeySize {
+		return key, nil
+	}
+	return nil, ErrInvalidMasterKey
+}
+
+// ReadMasterKeyFile reads a base64 or hex encoded master key from path.
+func ReadMasterKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeMasterKey(string(b))
+}
+
+// sealSecrets encrypts the non-empty fields of a single record in place.
+// All fields of the record share one freshly generated data key, which is
+// itself wrapped by the primary master key. It is a no-op without a master key.
+func (s *Service) sealSecrets(fields ...*string) error {
+	if s.secrets.primary == nil {
+		return nil
+	}
+
+	dek := make([]byte, MasterKeySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return err
+	}
+	wrapped, err := sealBytes(s.secrets.primary.aead, dek)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return err
+	}
+
+	header := secretPrefix + s.secrets.primary.id + "$" + base64.RawStdEncoding.EncodeToString(wrapped) + "$"
+	for _, f := range fields {
+		if *f == "" {
+			continue
+		}
+		ct, err := sealBytes(aead, []byte(*f))
+		if err != nil {
+			return err
+		}
+		*f = header + base64.RawStdEncoding.EncodeToString(ct)
+	}
+	return nil
+}
+
+// openSecrets decrypts in place any of the fields that were sealed by
+// sealSecrets. Cleartext values written before encryption was enabled are
+// left untouched.
+func (s *Service) openSecrets(fields ...*string) error {
+	deks := map[string]cipher.AEAD{}
+	for _, f := range fields {
+		if !strings.HasPrefix(*f, secretPrefix) {
+			continue
+		}
+		if len(s.secrets.keys) == 0 {
+			return ErrMasterKeyRequired
+		}
+
+		parts := strings.Split(strings.TrimPrefix(*f, secretPrefix), "$")
+		if len(parts) != 3 {
+			return ErrInvalidSecret
+		}
+		id, wrapped, ct := parts[0], parts[1], parts[2]
+
+		aead, ok := deks[id+wrapped]
+		if !ok {
+			mk, ok := s.secrets.keys[id]
+			if !ok {
+				return ErrMasterKeyUnknown
+			}
+			w, err := base64.RawStdEncoding.DecodeString(wrapped)
+			if err != nil {
+				return ErrInvalidSecret
+			}
+			dek, err := openBytes(mk.aead, w)
+			if err != nil {
+				return err
+			}
+			if aead, err = newAEAD(dek); err != nil {
+				return err
+			}
+			deks[id+wrapped] = aead
+		}
+
+		b, err := base64.RawStdEncoding.DecodeString(ct)
+		if err != nil {
+			return ErrInvalidSecret
+		}
+		pt, err := openBytes(aead, b)
+		if err != nil {
+			return err
+		}
+		*f = string(pt)
+	}
+	return nil
+}
+
+// RotateSecrets re-encrypts every stored secret with the current master key.
+// Secrets that are still in cleartext are encrypted as well. It returns the
+// number of records rewritten.
+func (s *Service) RotateSecrets(ctx context.Context) (int, error) {
+	if s.secrets.primary == nil {
+		return 0, errors.New("a master key is required to rotate secrets")
+	}
+
+	n := 0
+	sources, err := s.SourcesStore().All(ctx)
+	if err != nil {
+		return n, err
+	}
+	for _, src := range sources {
+		if err := s.SourcesStore().Update(ctx, src); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	servers, err := s.ServersStore().All(ctx)
+	if err != nil {
+		return n, err
+	}
+	for _, srv := range servers {
+		if err := s.ServersStore().Update(ctx, srv); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	csps, err := s.CSPStore().All(ctx)
+	if err != nil {
+		return n, err
+	}
+	for i := range csps {
+		if err := s.CSPStore().Update(ctx, &csps[i]); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	vspheres, err := s.VspheresStore().All(ctx)
+	if err != nil {
+		return n, err
+	}
+	for _, vs := range vspheres {
+		if err := s.VspheresStore().Update(ctx, vs); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	devices, err := s.NetworkDeviceStore().All(ctx)
+	if err != nil {
+		return n, err
+	}
+	for i := range devices {
+		if err := s.NetworkDeviceStore().Update(ctx, &devices[i]); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	profiles, err := s.TerminalProfilesStore().All(ctx)
+	if err != nil {
+		return n, err
+	}
+	for i := range profiles {
+		if err := s.TerminalProfilesStore().Update(ctx, &profiles[i]); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	jobs, err := s.SaltJobsStore().All(ctx)
+	if err != nil {
+		return n, err
+	}
+	for i := range jobs {
+		if err := s.SaltJobsStore().Update(ctx, &jobs[i]); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBytes encrypts plaintext and prepends the random nonce.
+func sealBytes(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openBytes decrypts data produced by sealBytes.
+func openBytes(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrInvalidSecret
+	}
+	nonce, ct := data[:aead.NonceSize()], data[aead.NonceSize():]
+	pt, err := aead.Open(nil, nonce, ct, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt secret: %v", err)
+	}
+	return pt, nil
+}
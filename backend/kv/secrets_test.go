@@ -0,0 +1,247 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv"
+	"github.com/snetsystems/cloudhub/backend/kv/bolt"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func newSecretsTestClient(t *testing.T, path string, opts ...kv.Option) *kv.Service {
+	t.Helper()
+	ctx := context.TODO()
+	b, err := bolt.NewClient(ctx, bolt.WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := kv.NewService(ctx, b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// rawBucket returns every value stored in bucket of the bolt file at path.
+func rawBucket(t *testing.T, path, bucket string) []byte {
+	t.Helper()
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var raw []byte
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			raw = append(raw, v...)
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func mustMasterKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := kv.GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := kv.DecodeMasterKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSecrets_EncryptedAtRest(t *testing.T) {
+	f, err := ioutil.TempFile("", "cloudhub-bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	ctx := context.Background()
+	key := mustMasterKey(t)
+	s := newSecretsTestClient(t, f.Name(), kv.WithMasterKey(key))
+
+	src, err := s.SourcesStore().Add(ctx, cloudhub.Source{Name: "influx", Password: "source-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := &cloudhub.NetworkDevice{
+		DeviceIP:   "10.0.0.1",
+		SSHConfig:  cloudhub.SSHConfig{Password: "ssh-secret", EnPassword: "enable-secret"},
+		SNMPConfig: cloudhub.SNMPConfig{Community: "community-secret", AuthPass: "auth-secret"},
+	}
+	if _, err := s.NetworkDeviceStore().Add(ctx, device); err != nil {
+		t.Fatal(err)
+	}
+	if device.SSHConfig.Password != "ssh-secret" {
+		t.Fatalf("Add modified the caller's device: %q", device.SSHConfig.Password)
+	}
+	profile := &cloudhub.TerminalProfile{Addr: "10.0.0.2", Password: "profile-secret", PrivateKey: "profile-key", Passphrase: "profile-passphrase"}
+	if _, err := s.TerminalProfilesStore().Add(ctx, profile); err != nil {
+		t.Fatal(err)
+	}
+	job := &cloudhub.SaltJob{JID: "20151021162900000001", Function: "file.write", Arg: []string{"/etc/logstash.rb", "job-secret"}, Kwarg: `{"password":"kwarg-secret"}`}
+	if _, err := s.SaltJobsStore().Add(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Arg[1] != "job-secret" {
+		t.Fatalf("Add modified the caller's job: %q", job.Arg[1])
+	}
+
+	got, err := s.SourcesStore().Get(ctx, src.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != "source-secret" {
+		t.Fatalf("source password = %q, want %q", got.Password, "source-secret")
+	}
+	gotDevice, err := s.NetworkDeviceStore().Get(ctx, cloudhub.NetworkDeviceQuery{ID: &device.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gotDevice != *device {
+		t.Fatalf("device = %+v, want %+v", *gotDevice, *device)
+	}
+	gotProfile, err := s.TerminalProfilesStore().Get(ctx, profile.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gotProfile != *profile {
+		t.Fatalf("profile = %+v, want %+v", *gotProfile, *profile)
+	}
+	gotJob, err := s.SaltJobsStore().Get(ctx, job.JID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*gotJob, *job) {
+		t.Fatalf("job = %+v, want %+v", *gotJob, *job)
+	}
+	s.Close()
+
+	for bucket, secrets := range map[string][]string{
+		"Sources":            {"source-secret"},
+		"NetworkDevice":      {"ssh-secret", "enable-secret", "community-secret", "auth-secret"},
+		"TerminalProfilesV1": {"profile-secret", "profile-key", "profile-passphrase"},
+		"SaltJobsV1":         {"job-secret", "kwarg-secret"},
+	} {
+		raw := rawBucket(t, f.Name(), bucket)
+		for _, secret := range secrets {
+			if bytes.Contains(raw, []byte(secret)) {
+				t.Errorf("bucket %s contains cleartext %q", bucket, secret)
+			}
+		}
+	}
+
+	// Without the master key encrypted secrets cannot be read.
+	s = newSecretsTestClient(t, f.Name())
+	if _, err := s.SourcesStore().Get(ctx, src.ID); err != kv.ErrMasterKeyRequired {
+		t.Fatalf("Get without master key: err = %v, want %v", err, kv.ErrMasterKeyRequired)
+	}
+	// nor are the devices holding them skipped from lists
+	if _, err := s.NetworkDeviceStore().All(ctx); err != kv.ErrMasterKeyRequired {
+		t.Fatalf("All devices without master key: err = %v, want %v", err, kv.ErrMasterKeyRequired)
+	}
+	ip := "10.0.0.1"
+	if _, err := s.NetworkDeviceStore().Find(ctx, cloudhub.NetworkDeviceQuery{DeviceIP: &ip}); err != kv.ErrMasterKeyRequired {
+		t.Fatalf("Find devices without master key: err = %v, want %v", err, kv.ErrMasterKeyRequired)
+	}
+	s.Close()
+}
+
+func TestSecrets_RotateSecrets(t *testing.T) {
+	f, err := ioutil.TempFile("", "cloudhub-bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	ctx := context.Background()
+
+	// Secrets written before encryption was enabled are stored in cleartext.
+	s := newSecretsTestClient(t, f.Name())
+	srv, err := s.ServersStore().Add(ctx, cloudhub.Server{Name: "kapa", Password: "server-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if !bytes.Contains(rawBucket(t, f.Name(), "Servers"), []byte("server-secret")) {
+		t.Fatal("expected cleartext secret without a master key")
+	}
+
+	oldKey := mustMasterKey(t)
+	s = newSecretsTestClient(t, f.Name(), kv.WithMasterKey(oldKey))
+	if n, err := s.RotateSecrets(ctx); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("RotateSecrets rewrote %d records, want 1", n)
+	}
+	s.Close()
+	if bytes.Contains(rawBucket(t, f.Name(), "Servers"), []byte("server-secret")) {
+		t.Fatal("secret still in cleartext after rotation")
+	}
+
+	newKey := mustMasterKey(t)
+	s = newSecretsTestClient(t, f.Name(), kv.WithMasterKey(newKey), kv.WithPreviousMasterKeys(oldKey))
+	if _, err := s.RotateSecrets(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Only the new key is required once rotation has completed.
+	s = newSecretsTestClient(t, f.Name(), kv.WithMasterKey(newKey))
+	defer s.Close()
+	got, err := s.ServersStore().Get(ctx, srv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != "server-secret" {
+		t.Fatalf("server password = %q, want %q", got.Password, "server-secret")
+	}
+}
+
+func TestDecodeMasterKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{
+			name:    "base64",
+			encoded: "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=\n",
+		},
+		{
+			name:    "hex",
+			encoded: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		},
+		{
+			name:    "too short",
+			encoded: "AAECAwQFBgcICQoLDA0ODw==",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := kv.DecodeMasterKey(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeMasterKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && key[31] != 0x1f {
+				t.Fatalf("DecodeMasterKey() = %x", key)
+			}
+		})
+	}
+}
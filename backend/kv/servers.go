@@ -21,7 +21,7 @@ func (s *serversStore) All(ctx context.Context) ([]cloudhub.Server, error) {
 	var srcs []cloudhub.Server
 	if err := s.client.kv.View(ctx, func(tx Tx) error {
 		var err error
-		srcs, err = allServers(ctx, tx)
+		srcs, err = s.all(ctx, tx)
 		if err != nil {
 			return err
 		}
@@ -33,11 +33,11 @@ func (s *serversStore) All(ctx context.Context) ([]cloudhub.Server, error) {
 	return srcs, nil
 }
 
-func allServers(ctx context.Context, tx Tx) ([]cloudhub.Server, error) {
+func (s *serversStore) all(ctx context.Context, tx Tx) ([]cloudhub.Server, error) {
 	var srcs []cloudhub.Server
 	if err := tx.Bucket(serversBucket).ForEach(func(k, v []byte) error {
 		var src cloudhub.Server
-		if err := internal.UnmarshalServer(v, &src); err != nil {
+		if err := s.unmarshal(v, &src); err != nil {
 			return err
 		}
 		srcs = append(srcs, src)
@@ -58,7 +58,7 @@ func (s *serversStore) Add(ctx context.Context, src cloudhub.Server) (cloudhub.S
 		}
 		src.ID = int(seq)
 
-		if v, err := internal.MarshalServer(src); err != nil {
+		if v, err := s.marshal(src); err != nil {
 			return err
 		} else if err := b.Put(itob(src.ID), v); err != nil {
 			return err
@@ -91,7 +91,7 @@ func (s *serversStore) Get(ctx context.Context, id int) (cloudhub.Server, error)
 	if err := s.client.kv.View(ctx, func(tx Tx) error {
 		if v, err := tx.Bucket(serversBucket).Get(itob(id)); v == nil || err != nil {
 			return cloudhub.ErrServerNotFound
-		} else if err := internal.UnmarshalServer(v, &src); err != nil {
+		} else if err := s.unmarshal(v, &src); err != nil {
 			return err
 		}
 		return nil
@@ -111,7 +111,7 @@ func (s *serversStore) Update(ctx context.Context, src cloudhub.Server) error {
 			return cloudhub.ErrServerNotFound
 		}
 
-		if v, err := internal.MarshalServer(src); err != nil {
+		if v, err := s.marshal(src); err != nil {
 			return err
 		} else if err := b.Put(itob(src.ID), v); err != nil {
 			return err
@@ -123,3 +123,19 @@ func (s *serversStore) Update(ctx context.Context, src cloudhub.Server) error {
 
 	return nil
 }
+
+// marshal encrypts the secrets of src and encodes it to binary protobuf format.
+func (s *serversStore) marshal(src cloudhub.Server) ([]byte, error) {
+	if err := s.client.sealSecrets(&src.Password, &src.AlertToken); err != nil {
+		return nil, err
+	}
+	return internal.MarshalServer(src)
+}
+
+// unmarshal decodes a server from binary protobuf data and decrypts its secrets.
+func (s *serversStore) unmarshal(v []byte, src *cloudhub.Server) error {
+	if err := internal.UnmarshalServer(v, src); err != nil {
+		return err
+	}
+	return s.client.openSecrets(&src.Password, &src.AlertToken)
+}
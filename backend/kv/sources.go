@@ -97,7 +97,7 @@ func (s *sourcesStore) all(ctx context.Context, tx Tx) ([]cloudhub.Source, error
 	var srcs []cloudhub.Source
 	if err := tx.Bucket(sourcesBucket).ForEach(func(k, v []byte) error {
 		var src cloudhub.Source
-		if err := internal.UnmarshalSource(v, &src); err != nil {
+		if err := s.unmarshal(v, &src); err != nil {
 			return err
 		}
 		srcs = append(srcs, src)
@@ -122,7 +122,7 @@ func (s *sourcesStore) add(ctx context.Context, src *cloudhub.Source, tx Tx) err
 		}
 	}
 
-	if v, err := internal.MarshalSource(*src); err != nil {
+	if v, err := s.marshal(*src); err != nil {
 		return err
 	} else if err := b.Put(itob(src.ID), v); err != nil {
 		return err
@@ -141,7 +141,7 @@ func (s *sourcesStore) get(ctx context.Context, id int, tx Tx) (cloudhub.Source,
 	var src cloudhub.Source
 	if v, err := tx.Bucket(sourcesBucket).Get(itob(id)); v == nil || err != nil {
 		return src, cloudhub.ErrSourceNotFound
-	} else if err := internal.UnmarshalSource(v, &src); err != nil {
+	} else if err := s.unmarshal(v, &src); err != nil {
 		return src, err
 	}
 	return src, nil
@@ -160,7 +160,7 @@ func (s *sourcesStore) update(ctx context.Context, src cloudhub.Source, tx Tx) e
 		}
 	}
 
-	if v, err := internal.MarshalSource(src); err != nil {
+	if v, err := s.marshal(src); err != nil {
 		return err
 	} else if err := b.Put(itob(src.ID), v); err != nil {
 		return err
@@ -179,7 +179,7 @@ func (s *sourcesStore) resetDefaultSource(ctx context.Context, tx Tx) error {
 	for _, other := range srcs {
 		if other.Default {
 			other.Default = false
-			if v, err := internal.MarshalSource(other); err != nil {
+			if v, err := s.marshal(other); err != nil {
 				return err
 			} else if err := b.Put(itob(other.ID), v); err != nil {
 				return err
@@ -220,3 +220,19 @@ func (s *sourcesStore) setRandomDefault(ctx context.Context, src cloudhub.Source
 	}
 	return nil
 }
+
+// marshal encrypts the secrets of src and encodes it to binary protobuf format.
+func (s *sourcesStore) marshal(src cloudhub.Source) ([]byte, error) {
+	if err := s.client.sealSecrets(&src.Password); err != nil {
+		return nil, err
+	}
+	return internal.MarshalSource(src)
+}
+
+// unmarshal decodes a source from binary protobuf data and decrypts its secrets.
+func (s *sourcesStore) unmarshal(v []byte, src *cloudhub.Source) error {
+	if err := internal.UnmarshalSource(v, src); err != nil {
+		return err
+	}
+	return s.client.openSecrets(&src.Password)
+}
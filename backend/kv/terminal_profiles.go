@@ -0,0 +1,129 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure terminalProfilesStore implements cloudhub.TerminalProfilesStore.
+var _ cloudhub.TerminalProfilesStore = &terminalProfilesStore{}
+
+// terminalProfilesStore uses a kv to store and retrieve terminal profiles
+type terminalProfilesStore struct {
+	client *Service
+}
+
+// Add creates a new TerminalProfile in the terminalProfilesStore
+func (s *terminalProfilesStore) Add(ctx context.Context, p *cloudhub.TerminalProfile) (*cloudhub.TerminalProfile, error) {
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(terminalProfilesBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		p.ID = strconv.FormatUint(seq, 10)
+
+		v, err := s.marshal(*p)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(p.ID), v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// All returns all known terminal profiles
+func (s *terminalProfilesStore) All(ctx context.Context) ([]cloudhub.TerminalProfile, error) {
+	var profiles []cloudhub.TerminalProfile
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(terminalProfilesBucket).ForEach(func(k, v []byte) error {
+			var p cloudhub.TerminalProfile
+			if err := s.unmarshal(v, &p); err != nil {
+				return err
+			}
+			profiles = append(profiles, p)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// Delete the terminal profile from the terminalProfilesStore
+func (s *terminalProfilesStore) Delete(ctx context.Context, p *cloudhub.TerminalProfile) error {
+	_, err := s.Get(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		return tx.Bucket(terminalProfilesBucket).Delete([]byte(p.ID))
+	})
+}
+
+// Get returns a terminal profile by ID
+func (s *terminalProfilesStore) Get(ctx context.Context, id string) (*cloudhub.TerminalProfile, error) {
+	var p cloudhub.TerminalProfile
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		v, err := tx.Bucket(terminalProfilesBucket).Get([]byte(id))
+		if v == nil || err != nil {
+			return cloudhub.ErrTerminalProfileNotFound
+		}
+		return s.unmarshal(v, &p)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Update the terminal profile in the terminalProfilesStore
+func (s *terminalProfilesStore) Update(ctx context.Context, p *cloudhub.TerminalProfile) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		if v, err := s.marshal(*p); err != nil {
+			return err
+		} else if err := tx.Bucket(terminalProfilesBucket).Put([]byte(p.ID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// profileSecrets lists the credentials of a profile that are encrypted at rest.
+func profileSecrets(p *cloudhub.TerminalProfile) []*string {
+	return []*string{
+		&p.Password,
+		&p.PrivateKey,
+		&p.Passphrase,
+	}
+}
+
+// marshal encrypts the credentials of p and encodes it to binary protobuf format.
+func (s *terminalProfilesStore) marshal(p cloudhub.TerminalProfile) ([]byte, error) {
+	if err := s.client.sealSecrets(profileSecrets(&p)...); err != nil {
+		return nil, err
+	}
+	return internal.MarshalTerminalProfile(&p)
+}
+
+// unmarshal decodes a profile from binary protobuf data and decrypts its credentials.
+func (s *terminalProfilesStore) unmarshal(v []byte, p *cloudhub.TerminalProfile) error {
+	if err := internal.UnmarshalTerminalProfile(v, p); err != nil {
+		return err
+	}
+	return s.client.openSecrets(profileSecrets(p)...)
+}
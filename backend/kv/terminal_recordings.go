@@ -0,0 +1,104 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/kv/internal"
+)
+
+// Ensure terminalRecordingsStore implements cloudhub.TerminalRecordingsStore.
+var _ cloudhub.TerminalRecordingsStore = &terminalRecordingsStore{}
+
+// terminalRecordingsStore uses a kv to store and retrieve terminal recording metadata
+type terminalRecordingsStore struct {
+	client *Service
+}
+
+// Add creates a new TerminalRecording in the terminalRecordingsStore
+func (s *terminalRecordingsStore) Add(ctx context.Context, r *cloudhub.TerminalRecording) (*cloudhub.TerminalRecording, error) {
+	err := s.client.kv.Update(ctx, func(tx Tx) error {
+		b := tx.Bucket(terminalRecordingsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.ID = strconv.FormatUint(seq, 10)
+
+		v, err := internal.MarshalTerminalRecording(r)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(r.ID), v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// All returns all known terminal recordings
+func (s *terminalRecordingsStore) All(ctx context.Context) ([]cloudhub.TerminalRecording, error) {
+	var recordings []cloudhub.TerminalRecording
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		return tx.Bucket(terminalRecordingsBucket).ForEach(func(k, v []byte) error {
+			var r cloudhub.TerminalRecording
+			if err := internal.UnmarshalTerminalRecording(v, &r); err != nil {
+				return err
+			}
+			recordings = append(recordings, r)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return recordings, nil
+}
+
+// Delete the terminal recording from the terminalRecordingsStore
+func (s *terminalRecordingsStore) Delete(ctx context.Context, r *cloudhub.TerminalRecording) error {
+	_, err := s.Get(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		return tx.Bucket(terminalRecordingsBucket).Delete([]byte(r.ID))
+	})
+}
+
+// Get returns a terminal recording by ID
+func (s *terminalRecordingsStore) Get(ctx context.Context, id string) (*cloudhub.TerminalRecording, error) {
+	var r cloudhub.TerminalRecording
+	err := s.client.kv.View(ctx, func(tx Tx) error {
+		v, err := tx.Bucket(terminalRecordingsBucket).Get([]byte(id))
+		if v == nil || err != nil {
+			return cloudhub.ErrTerminalRecordingNotFound
+		}
+		return internal.UnmarshalTerminalRecording(v, &r)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Update the terminal recording in the terminalRecordingsStore
+func (s *terminalRecordingsStore) Update(ctx context.Context, r *cloudhub.TerminalRecording) error {
+	return s.client.kv.Update(ctx, func(tx Tx) error {
+		if v, err := internal.MarshalTerminalRecording(r); err != nil {
+			return err
+		} else if err := tx.Bucket(terminalRecordingsBucket).Put([]byte(r.ID), v); err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// Ensure a TerminalRecordingsStore can store, find, update and remove recordings.
+func TestTerminalRecordingsStore(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.TerminalRecordingsStore()
+
+	started := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	recordings := []cloudhub.TerminalRecording{
+		{Organization: "default", User: "alice", Host: "10.0.0.1:22", SSHUser: "root", StartedAt: started},
+		{Organization: "1", User: "bob", Host: "10.0.0.2:22", SSHUser: "admin", StartedAt: started, EndedAt: started.Add(time.Minute), Size: 2048},
+	}
+	for i := range recordings {
+		r, err := s.Add(ctx, &recordings[i])
+		if err != nil {
+			t.Fatalf("failed to add terminal recording: %v", err)
+		}
+		if r.ID == "" {
+			t.Fatalf("terminal recording was not assigned an ID")
+		}
+	}
+
+	got, err := s.Get(ctx, recordings[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.User != "bob" || got.SSHUser != "admin" || !got.EndedAt.Equal(started.Add(time.Minute)) || got.Size != 2048 {
+		t.Fatalf("terminal recording loaded is different than terminal recording saved; actual: %+v, expected %+v", got, recordings[1])
+	}
+
+	got, err = s.Get(ctx, recordings[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.EndedAt.IsZero() {
+		t.Fatalf("open recording has an end: %+v", got)
+	}
+	got.EndedAt = started.Add(time.Hour)
+	got.Size = 512
+	if err := s.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.Get(ctx, recordings[0].ID); err != nil || !got.EndedAt.Equal(started.Add(time.Hour)) || got.Size != 512 {
+		t.Fatalf("Update() did not store the end of the session: %+v, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, &recordings[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, recordings[0].ID); err != cloudhub.ErrTerminalRecordingNotFound {
+		t.Fatalf("Get() of a deleted recording error = %v, want %v", err, cloudhub.ErrTerminalRecordingNotFound)
+	}
+
+	all, err := s.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].User != "bob" {
+		t.Fatalf("All() = %v, want only the recording of bob", all)
+	}
+}
@@ -48,6 +48,7 @@ func (s *topologiesStore) Add(ctx context.Context, tp *cloudhub.Topology) (*clou
 			return err
 		}
 		tp.ID = strconv.FormatUint(seq, 10)
+		tp.Revision = 1
 
 		if v, err := internal.MarshalTopology(tp); err != nil {
 			return err
@@ -112,18 +113,29 @@ func (s *topologiesStore) Delete(ctx context.Context, tp *cloudhub.Topology) err
 	return nil
 }
 
-// Update the topology in topologiesStore
+// Update the topology in topologiesStore. The update is conditional on the
+// revision in ctx, if any, and sets the revision of tp to the new one.
 func (s *topologiesStore) Update(ctx context.Context, tp *cloudhub.Topology) error {
+	var rev int64
 	if err := s.client.kv.Update(ctx, func(tx Tx) error {
 		// Get an existing topology with the same ID.
-		_, err := s.get(ctx, tp.ID)
-		if err != nil {
+		b := tx.Bucket(topologyBucket)
+		var cur cloudhub.Topology
+		if v, err := b.Get([]byte(tp.ID)); v == nil || err != nil {
 			return cloudhub.ErrTopologyNotFound
+		} else if err := internal.UnmarshalTopology(v, &cur); err != nil {
+			return err
+		}
+		var err error
+		if rev, err = nextRevision(ctx, cur.Revision); err != nil {
+			return err
 		}
 
-		if v, err := internal.MarshalTopology(tp); err != nil {
+		up := *tp
+		up.Revision = rev
+		if v, err := internal.MarshalTopology(&up); err != nil {
 			return err
-		} else if err := tx.Bucket(topologyBucket).Put([]byte(tp.ID), v); err != nil {
+		} else if err := b.Put([]byte(tp.ID), v); err != nil {
 			return err
 		}
 		return nil
@@ -131,6 +143,7 @@ func (s *topologiesStore) Update(ctx context.Context, tp *cloudhub.Topology) err
 		return err
 	}
 
+	tp.Revision = rev
 	return nil
 }
 
@@ -54,6 +54,7 @@ func TestTopologiesStore(t *testing.T) {
 			t.Fatal(err)
 		}
 		tss[i].ID = rtnTs.ID
+		tss[i].Revision = 1
 
 		// Confirm first ts in the store is the same as the original.
 		if actual, err := s.Get(ctx, cloudhub.TopologyQuery{ID: &rtnTs.ID}); err != nil {
@@ -101,3 +102,36 @@ func TestTopologiesStore(t *testing.T) {
 		t.Fatalf("topology delete error: got %v, expected %v", err, cloudhub.ErrTopologyNotFound)
 	}
 }
+
+func TestTopologiesStore_Update_Revision(t *testing.T) {
+	c, err := NewTestClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	s := c.TopologiesStore()
+	tp, err := s.Add(ctx, &cloudhub.Topology{Organization: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := *tp
+	tp.Diagram = "<mxGraphModel><root></root></mxGraphModel>"
+	if err := s.Update(context.WithValue(ctx, cloudhub.RevisionContextKey, tp.Revision), tp); err != nil {
+		t.Fatal(err)
+	}
+	if tp.Revision != 2 {
+		t.Errorf("Update() set revision %d, want 2", tp.Revision)
+	}
+
+	// a topology read before the update cannot overwrite it
+	read.Diagram = ""
+	if err := s.Update(context.WithValue(ctx, cloudhub.RevisionContextKey, read.Revision), &read); err != cloudhub.ErrRevisionMismatch {
+		t.Errorf("Update() at an outdated revision error = %v, want %v", err, cloudhub.ErrRevisionMismatch)
+	}
+	if got, err := s.Get(ctx, cloudhub.TopologyQuery{ID: &tp.ID}); err != nil || got.Diagram != tp.Diagram || got.Revision != 2 {
+		t.Errorf("Get() = %+v, %v; want the first update", got, err)
+	}
+}
@@ -22,7 +22,7 @@ func (s *vspheresStore) All(ctx context.Context) ([]cloudhub.Vsphere, error) {
 	if err := s.client.kv.View(ctx, func(tx Tx) error {
 		return tx.Bucket(vSpheresBucket).ForEach(func(k, v []byte) error {
 			var vs cloudhub.Vsphere
-			if err := internal.UnmarshalVsphere(v, &vs); err != nil {
+			if err := s.unmarshal(v, &vs); err != nil {
 				return err
 			}
 			vss = append(vss, vs)
@@ -45,7 +45,7 @@ func (s *vspheresStore) Add(ctx context.Context, vs cloudhub.Vsphere) (cloudhub.
 		}
 		vs.ID = strconv.FormatUint(seq, 10)
 
-		if v, err := internal.MarshalVsphere(vs); err != nil {
+		if v, err := s.marshal(vs); err != nil {
 			return err
 		} else if err := b.Put([]byte(vs.ID), v); err != nil {
 			return err
@@ -78,7 +78,7 @@ func (s *vspheresStore) Get(ctx context.Context, id string) (cloudhub.Vsphere, e
 	if err := s.client.kv.View(ctx, func(tx Tx) error {
 		if v, err := tx.Bucket(vSpheresBucket).Get([]byte(id)); v == nil || err != nil {
 			return cloudhub.ErrVsphereNotFound
-		} else if err := internal.UnmarshalVsphere(v, &vs); err != nil {
+		} else if err := s.unmarshal(v, &vs); err != nil {
 			return err
 		}
 		return nil
@@ -98,7 +98,7 @@ func (s *vspheresStore) Update(ctx context.Context, vs cloudhub.Vsphere) error {
 			return cloudhub.ErrVsphereNotFound
 		}
 
-		if v, err := internal.MarshalVsphere(vs); err != nil {
+		if v, err := s.marshal(vs); err != nil {
 			return err
 		} else if err := b.Put([]byte(vs.ID), v); err != nil {
 			return err
@@ -109,4 +109,19 @@ func (s *vspheresStore) Update(ctx context.Context, vs cloudhub.Vsphere) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+// marshal encrypts the secrets of vs and encodes it to binary protobuf format.
+func (s *vspheresStore) marshal(vs cloudhub.Vsphere) ([]byte, error) {
+	if err := s.client.sealSecrets(&vs.Password); err != nil {
+		return nil, err
+	}
+	return internal.MarshalVsphere(vs)
+}
+
+// unmarshal decodes a vSphere from binary protobuf data and decrypts its secrets.
+func (s *vspheresStore) unmarshal(v []byte, vs *cloudhub.Vsphere) error {
+	if err := internal.UnmarshalVsphere(v, vs); err != nil {
+		return err
+	}
+	return s.client.openSecrets(&vs.Password)
+}
@@ -0,0 +1,192 @@
+// Package mail sends mail through an SMTP server.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// TLS modes of the connection to the SMTP server
+const (
+	// StartTLS upgrades a plain connection with the STARTTLS command
+	StartTLS = "starttls"
+	// TLS connects with implicit TLS, usually to port 465
+	TLS = "tls"
+	// None sends mail over a plain connection
+	None = "none"
+)
+
+const defaultTimeout = 30 * time.Second
+
+var _ cloudhub.Mailer = &SMTP{}
+
+// ErrStartTLS is returned when the server does not offer STARTTLS in the
+// StartTLS mode
+var ErrStartTLS = errors.New("smtp server does not support STARTTLS")
+
+// SMTP sends mail through an SMTP server
+type SMTP struct {
+	Host               string
+	Port               int
+	Username           string // Username authenticates with PLAIN auth if set
+	Password           string
+	From               string
+	TLS                string // TLS is one of StartTLS, TLS or None; StartTLS if empty
+	InsecureSkipVerify bool
+	Timeout            time.Duration // Timeout of the whole conversation; 30 seconds if zero
+	Now                func() time.Time
+}
+
+// Send sends a plain text mail to the recipients
+func (m *SMTP) Send(ctx context.Context, to []string, subject, body string) error {
+	if len(to) == 0 {
+		return errors.New("no recipients")
+	}
+	from, err := netmail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %v", m.From, err)
+	}
+	rcpts := make([]string, len(to))
+	for i, addr := range to {
+		a, err := netmail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %v", addr, err)
+		}
+		rcpts[i] = a.Address
+	}
+
+	msg, err := m.message(from, rcpts, subject, body)
+	if err != nil {
+		return err
+	}
+
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if m.tlsMode() == StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrStartTLS
+		}
+		if err := c.StartTLS(m.tlsConfig()); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range rcpts {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (m *SMTP) tlsMode() string {
+	if m.TLS == "" {
+		return StartTLS
+	}
+	return m.TLS
+}
+
+func (m *SMTP) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         m.Host,
+		InsecureSkipVerify: m.InsecureSkipVerify,
+	}
+}
+
+func (m *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	switch m.tlsMode() {
+	case TLS:
+		d := &tls.Dialer{Config: m.tlsConfig()}
+		return d.DialContext(ctx, "tcp", addr)
+	case StartTLS, None:
+		d := &net.Dialer{}
+		return d.DialContext(ctx, "tcp", addr)
+	default:
+		return nil, fmt.Errorf("invalid smtp tls mode %q", m.TLS)
+	}
+}
+
+func (m *SMTP) now() time.Time {
+	if m.Now == nil {
+		return time.Now()
+	}
+	return m.Now()
+}
+
+// message returns the headers and quoted-printable body of a mail
+func (m *SMTP) message(from *netmail.Address, to []string, subject, body string) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", m.now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body = strings.Replace(strings.Replace(body, "\r\n", "\n", -1), "\n", "\r\n", -1)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,203 @@
+package mail_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snetsystems/cloudhub/backend/mail"
+)
+
+// fakeSMTP is an SMTP server that accepts a single session and records it
+type fakeSMTP struct {
+	ln       net.Listener
+	reject   string // reject is a recipient that is refused
+	auth     string // auth is the decoded PLAIN response that was sent
+	from     string
+	rcpts    []string
+	data     string
+	sessions chan struct{}
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, sessions: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// wait blocks until the session is over
+func (s *fakeSMTP) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("smtp session did not end")
+	}
+}
+
+func (s *fakeSMTP) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer close(s.sessions)
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			parts := strings.Fields(line)
+			b, _ := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+			s.auth = string(b)
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			s.from = line
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if s.reject != "" && strings.Contains(line, s.reject) {
+				tp.PrintfLine("550 no such user")
+				continue
+			}
+			s.rcpts = append(s.rcpts, line)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			b, err := ioutil.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.data = string(b)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func TestSMTP_Send(t *testing.T) {
+	srv := newFakeSMTP(t)
+	m := &mail.SMTP{
+		Host:     "127.0.0.1",
+		Port:     srv.port(),
+		Username: "cloudhub",
+		Password: "s3cret",
+		From:     "CloudHub <cloudhub@example.com>",
+		TLS:      mail.None,
+		Now:      func() time.Time { return time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC) },
+	}
+
+	body := "Hello marty,\nopen https://cloudhub.example.com/password-reset?token=1.2.abc to reset your password."
+	if err := m.Send(context.Background(), []string{"Marty <marty@example.com>"}, "Password reset\r\nBcc: biff@example.com", body); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	srv.wait(t)
+
+	if srv.auth != "\x00cloudhub\x00s3cret" {
+		t.Errorf("Send() auth = %q", srv.auth)
+	}
+	if srv.from != "MAIL FROM:<cloudhub@example.com>" && !strings.HasPrefix(srv.from, "MAIL FROM:<cloudhub@example.com> ") {
+		t.Errorf("Send() from = %q", srv.from)
+	}
+	if len(srv.rcpts) != 1 || srv.rcpts[0] != "RCPT TO:<marty@example.com>" {
+		t.Errorf("Send() recipients = %q", srv.rcpts)
+	}
+
+	msg, err := netmail.ReadMessage(bufio.NewReader(strings.NewReader(srv.data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("Date"); got != "Wed, 21 Oct 2015 16:29:00 +0000" {
+		t.Errorf("Send() date = %q", got)
+	}
+	if got := msg.Header.Get("Bcc"); got != "" {
+		t.Errorf("Send() subject injected a Bcc header: %q", got)
+	}
+	got, err := ioutil.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the DATA reader of the server turns line endings into \n
+	if string(got) != body+"\n" {
+		t.Errorf("Send() body = %q, want %q", got, body)
+	}
+}
+
+func TestSMTP_Send_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  string
+		from string
+		to   string
+	}{
+		{name: "STARTTLS not offered", tls: mail.StartTLS, from: "cloudhub@example.com", to: "marty@example.com"},
+		{name: "Recipient refused", tls: mail.None, from: "cloudhub@example.com", to: "biff@example.com"},
+		{name: "Invalid recipient", tls: mail.None, from: "cloudhub@example.com", to: "marty"},
+		{name: "Invalid sender", tls: mail.None, from: "", to: "marty@example.com"},
+		{name: "Invalid TLS mode", tls: "ssl", from: "cloudhub@example.com", to: "marty@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeSMTP(t)
+			srv.reject = "biff@example.com"
+			m := &mail.SMTP{
+				Host: "127.0.0.1",
+				Port: srv.port(),
+				From: tt.from,
+				TLS:  tt.tls,
+			}
+			if err := m.Send(context.Background(), []string{tt.to}, "Password reset", "body"); err == nil {
+				t.Errorf("Send() succeeded")
+			}
+			if srv.data != "" {
+				t.Errorf("Send() delivered %q", srv.data)
+			}
+		})
+	}
+}
+
+func TestSMTP_Send_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := &mail.SMTP{Host: "127.0.0.1", Port: port, From: "cloudhub@example.com", TLS: mail.None}
+	err = m.Send(context.Background(), []string{"marty@example.com"}, "Password reset", "body")
+	if err == nil || !strings.Contains(err.Error(), strconv.Itoa(port)) {
+		t.Errorf("Send() error = %v", err)
+	}
+}
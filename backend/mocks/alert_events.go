@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.AlertEventsStore = &AlertEventsStore{}
+
+// AlertEventsStore mock allows all functions to be set for testing
+type AlertEventsStore struct {
+	AddF   func(context.Context, *cloudhub.AlertEvent) (*cloudhub.AlertEvent, error)
+	AllF   func(context.Context, cloudhub.AlertEventQuery) ([]cloudhub.AlertEvent, error)
+	PruneF func(context.Context, time.Time) (int, error)
+}
+
+// Add ...
+func (s *AlertEventsStore) Add(ctx context.Context, e *cloudhub.AlertEvent) (*cloudhub.AlertEvent, error) {
+	return s.AddF(ctx, e)
+}
+
+// All ...
+func (s *AlertEventsStore) All(ctx context.Context, q cloudhub.AlertEventQuery) ([]cloudhub.AlertEvent, error) {
+	return s.AllF(ctx, q)
+}
+
+// Prune ...
+func (s *AlertEventsStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	return s.PruneF(ctx, before)
+}
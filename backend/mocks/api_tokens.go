@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.APITokensStore = &APITokensStore{}
+
+// APITokensStore mock allows all functions to be set for testing
+type APITokensStore struct {
+	AllF    func(context.Context) ([]cloudhub.APIToken, error)
+	AddF    func(context.Context, *cloudhub.APIToken) (*cloudhub.APIToken, error)
+	DeleteF func(context.Context, *cloudhub.APIToken) error
+	GetF    func(context.Context, cloudhub.APITokenQuery) (*cloudhub.APIToken, error)
+	UpdateF func(context.Context, *cloudhub.APIToken) error
+}
+
+// All ...
+func (s *APITokensStore) All(ctx context.Context) ([]cloudhub.APIToken, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *APITokensStore) Add(ctx context.Context, t *cloudhub.APIToken) (*cloudhub.APIToken, error) {
+	return s.AddF(ctx, t)
+}
+
+// Delete ...
+func (s *APITokensStore) Delete(ctx context.Context, t *cloudhub.APIToken) error {
+	return s.DeleteF(ctx, t)
+}
+
+// Get ...
+func (s *APITokensStore) Get(ctx context.Context, q cloudhub.APITokenQuery) (*cloudhub.APIToken, error) {
+	return s.GetF(ctx, q)
+}
+
+// Update ...
+func (s *APITokensStore) Update(ctx context.Context, t *cloudhub.APIToken) error {
+	return s.UpdateF(ctx, t)
+}
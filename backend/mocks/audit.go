@@ -0,0 +1,32 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.AuditStore = &AuditStore{}
+
+// AuditStore mock allows all functions to be set for testing
+type AuditStore struct {
+	AddF   func(context.Context, *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error)
+	AllF   func(context.Context, cloudhub.AuditQuery) ([]cloudhub.AuditEvent, error)
+	PruneF func(context.Context, time.Time) (int, error)
+}
+
+// Add ...
+func (s *AuditStore) Add(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+	return s.AddF(ctx, e)
+}
+
+// All ...
+func (s *AuditStore) All(ctx context.Context, q cloudhub.AuditQuery) ([]cloudhub.AuditEvent, error) {
+	return s.AllF(ctx, q)
+}
+
+// Prune ...
+func (s *AuditStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	return s.PruneF(ctx, before)
+}
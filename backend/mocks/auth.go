@@ -49,3 +49,19 @@ func (a *Authenticator) ValidAuthorization(ctx context.Context, serializedAuthor
 func (a *Authenticator) Serialize(context.Context, oauth2.Principal) (string, error) {
 	return a.Serialized, nil
 }
+
+// PasswordProvider is a mock oauth2.PasswordProvider
+type PasswordProvider struct {
+	ProviderName  string
+	AuthenticateF func(ctx context.Context, username, password string) (oauth2.Principal, error)
+}
+
+// Name is the issuer of the principals returned by Authenticate
+func (p *PasswordProvider) Name() string {
+	return p.ProviderName
+}
+
+// Authenticate returns the principal of the user
+func (p *PasswordProvider) Authenticate(ctx context.Context, username, password string) (oauth2.Principal, error) {
+	return p.AuthenticateF(ctx, username, password)
+}
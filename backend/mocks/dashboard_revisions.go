@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.DashboardRevisionsStore = &DashboardRevisionsStore{}
+
+// DashboardRevisionsStore mock allows all functions to be set for testing
+type DashboardRevisionsStore struct {
+	AllF             func(context.Context, cloudhub.DashboardID) ([]cloudhub.DashboardRevision, error)
+	AddF             func(context.Context, *cloudhub.DashboardRevision, int) (*cloudhub.DashboardRevision, error)
+	UpdateDashboardF func(context.Context, cloudhub.Dashboard, string, int) error
+	GetF             func(context.Context, cloudhub.DashboardID, int) (*cloudhub.DashboardRevision, error)
+	DeleteF          func(context.Context, cloudhub.DashboardID) error
+}
+
+// All ...
+func (s *DashboardRevisionsStore) All(ctx context.Context, id cloudhub.DashboardID) ([]cloudhub.DashboardRevision, error) {
+	return s.AllF(ctx, id)
+}
+
+// Add ...
+func (s *DashboardRevisionsStore) Add(ctx context.Context, rev *cloudhub.DashboardRevision, keep int) (*cloudhub.DashboardRevision, error) {
+	return s.AddF(ctx, rev, keep)
+}
+
+// UpdateDashboard ...
+func (s *DashboardRevisionsStore) UpdateDashboard(ctx context.Context, d cloudhub.Dashboard, author string, keep int) error {
+	return s.UpdateDashboardF(ctx, d, author, keep)
+}
+
+// Get ...
+func (s *DashboardRevisionsStore) Get(ctx context.Context, id cloudhub.DashboardID, revID int) (*cloudhub.DashboardRevision, error) {
+	return s.GetF(ctx, id, revID)
+}
+
+// Delete ...
+func (s *DashboardRevisionsStore) Delete(ctx context.Context, id cloudhub.DashboardID) error {
+	return s.DeleteF(ctx, id)
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.HostKeysStore = &HostKeysStore{}
+
+// HostKeysStore mock allows all functions to be set for testing
+type HostKeysStore struct {
+	AllF    func(context.Context) ([]cloudhub.HostKey, error)
+	AddF    func(context.Context, *cloudhub.HostKey) (*cloudhub.HostKey, error)
+	DeleteF func(context.Context, *cloudhub.HostKey) error
+	GetF    func(context.Context, cloudhub.HostKeyQuery) (*cloudhub.HostKey, error)
+	UpdateF func(context.Context, *cloudhub.HostKey) error
+}
+
+// All ...
+func (s *HostKeysStore) All(ctx context.Context) ([]cloudhub.HostKey, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *HostKeysStore) Add(ctx context.Context, k *cloudhub.HostKey) (*cloudhub.HostKey, error) {
+	return s.AddF(ctx, k)
+}
+
+// Delete ...
+func (s *HostKeysStore) Delete(ctx context.Context, k *cloudhub.HostKey) error {
+	return s.DeleteF(ctx, k)
+}
+
+// Get ...
+func (s *HostKeysStore) Get(ctx context.Context, q cloudhub.HostKeyQuery) (*cloudhub.HostKey, error) {
+	return s.GetF(ctx, q)
+}
+
+// Update ...
+func (s *HostKeysStore) Update(ctx context.Context, k *cloudhub.HostKey) error {
+	return s.UpdateF(ctx, k)
+}
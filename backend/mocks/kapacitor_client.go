@@ -14,6 +14,14 @@ type KapaClient struct {
 	ListTasksF  func(opts *client.ListTasksOptions) ([]client.Task, error)
 	TaskF       func(link client.Link, opts *client.TaskOptions) (client.Task, error)
 	UpdateTaskF func(link client.Link, opts client.UpdateTaskOptions) (client.Task, error)
+
+	ListTopicsF          func(opts *client.ListTopicsOptions) (client.Topics, error)
+	ListTopicEventsF     func(link client.Link, opts *client.ListTopicEventsOptions) (client.TopicEvents, error)
+	ListTopicHandlersF   func(link client.Link, opts *client.ListTopicHandlersOptions) (client.TopicHandlers, error)
+	TopicHandlerF        func(link client.Link) (client.TopicHandler, error)
+	CreateTopicHandlerF  func(link client.Link, opts client.TopicHandlerOptions) (client.TopicHandler, error)
+	ReplaceTopicHandlerF func(link client.Link, opts client.TopicHandlerOptions) (client.TopicHandler, error)
+	DeleteTopicHandlerF  func(link client.Link) error
 }
 
 // CreateTask ...
@@ -40,3 +48,38 @@ func (p *KapaClient) Task(link client.Link, opts *client.TaskOptions) (client.Ta
 func (p *KapaClient) UpdateTask(link client.Link, opts client.UpdateTaskOptions) (client.Task, error) {
 	return p.UpdateTaskF(link, opts)
 }
+
+// ListTopics ...
+func (p *KapaClient) ListTopics(opts *client.ListTopicsOptions) (client.Topics, error) {
+	return p.ListTopicsF(opts)
+}
+
+// ListTopicEvents ...
+func (p *KapaClient) ListTopicEvents(link client.Link, opts *client.ListTopicEventsOptions) (client.TopicEvents, error) {
+	return p.ListTopicEventsF(link, opts)
+}
+
+// ListTopicHandlers ...
+func (p *KapaClient) ListTopicHandlers(link client.Link, opts *client.ListTopicHandlersOptions) (client.TopicHandlers, error) {
+	return p.ListTopicHandlersF(link, opts)
+}
+
+// TopicHandler ...
+func (p *KapaClient) TopicHandler(link client.Link) (client.TopicHandler, error) {
+	return p.TopicHandlerF(link)
+}
+
+// CreateTopicHandler ...
+func (p *KapaClient) CreateTopicHandler(link client.Link, opts client.TopicHandlerOptions) (client.TopicHandler, error) {
+	return p.CreateTopicHandlerF(link, opts)
+}
+
+// ReplaceTopicHandler ...
+func (p *KapaClient) ReplaceTopicHandler(link client.Link, opts client.TopicHandlerOptions) (client.TopicHandler, error) {
+	return p.ReplaceTopicHandlerF(link, opts)
+}
+
+// DeleteTopicHandler ...
+func (p *KapaClient) DeleteTopicHandler(link client.Link) error {
+	return p.DeleteTopicHandlerF(link)
+}
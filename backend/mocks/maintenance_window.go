@@ -0,0 +1,55 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.MaintenanceWindowsStore = &MaintenanceWindowsStore{}
+
+// MaintenanceWindowsStore mock allows all functions to be set for testing
+type MaintenanceWindowsStore struct {
+	AddF            func(context.Context, *cloudhub.MaintenanceWindow) (*cloudhub.MaintenanceWindow, error)
+	AllF            func(context.Context) ([]cloudhub.MaintenanceWindow, error)
+	DeleteF         func(context.Context, *cloudhub.MaintenanceWindow) error
+	GetF            func(context.Context, string) (*cloudhub.MaintenanceWindow, error)
+	UpdateF         func(context.Context, *cloudhub.MaintenanceWindow) error
+	UpdateSettingsF func(context.Context, *cloudhub.MaintenanceWindow) error
+	UpdateStateF    func(context.Context, *cloudhub.MaintenanceWindow) error
+}
+
+// Add ...
+func (s *MaintenanceWindowsStore) Add(ctx context.Context, w *cloudhub.MaintenanceWindow) (*cloudhub.MaintenanceWindow, error) {
+	return s.AddF(ctx, w)
+}
+
+// All ...
+func (s *MaintenanceWindowsStore) All(ctx context.Context) ([]cloudhub.MaintenanceWindow, error) {
+	return s.AllF(ctx)
+}
+
+// Delete ...
+func (s *MaintenanceWindowsStore) Delete(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	return s.DeleteF(ctx, w)
+}
+
+// Get ...
+func (s *MaintenanceWindowsStore) Get(ctx context.Context, id string) (*cloudhub.MaintenanceWindow, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *MaintenanceWindowsStore) Update(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	return s.UpdateF(ctx, w)
+}
+
+// UpdateSettings ...
+func (s *MaintenanceWindowsStore) UpdateSettings(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	return s.UpdateSettingsF(ctx, w)
+}
+
+// UpdateState ...
+func (s *MaintenanceWindowsStore) UpdateState(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	return s.UpdateStateF(ctx, w)
+}
@@ -14,6 +14,7 @@ type NetworkDeviceStore struct {
 	AddF    func(context.Context, *cloudhub.NetworkDevice) (*cloudhub.NetworkDevice, error)
 	DeleteF func(context.Context, *cloudhub.NetworkDevice) error
 	GetF    func(ctx context.Context, q cloudhub.NetworkDeviceQuery) (*cloudhub.NetworkDevice, error)
+	FindF   func(ctx context.Context, q cloudhub.NetworkDeviceQuery) ([]cloudhub.NetworkDevice, error)
 	UpdateF func(context.Context, *cloudhub.NetworkDevice) error
 }
 
@@ -37,6 +38,11 @@ func (s *NetworkDeviceStore) Get(ctx context.Context, q cloudhub.NetworkDeviceQu
 	return s.GetF(ctx, q)
 }
 
+// Find ...
+func (s *NetworkDeviceStore) Find(ctx context.Context, q cloudhub.NetworkDeviceQuery) ([]cloudhub.NetworkDevice, error) {
+	return s.FindF(ctx, q)
+}
+
 // Update ...
 func (s *NetworkDeviceStore) Update(ctx context.Context, Device *cloudhub.NetworkDevice) error {
 	return s.UpdateF(ctx, Device)
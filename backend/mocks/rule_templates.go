@@ -0,0 +1,50 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.RuleTemplatesStore = &RuleTemplatesStore{}
+
+// RuleTemplatesStore mock allows all functions to be set for testing
+type RuleTemplatesStore struct {
+	AddF    func(context.Context, *cloudhub.RuleTemplate) (*cloudhub.RuleTemplate, error)
+	AllF    func(context.Context) ([]cloudhub.RuleTemplate, error)
+	DeleteF func(context.Context, *cloudhub.RuleTemplate) error
+	GetF    func(context.Context, string) (*cloudhub.RuleTemplate, error)
+	UpdateF func(context.Context, *cloudhub.RuleTemplate) error
+
+	UpdateInstancesF func(context.Context, string, func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) error
+}
+
+// Add ...
+func (s *RuleTemplatesStore) Add(ctx context.Context, t *cloudhub.RuleTemplate) (*cloudhub.RuleTemplate, error) {
+	return s.AddF(ctx, t)
+}
+
+// All ...
+func (s *RuleTemplatesStore) All(ctx context.Context) ([]cloudhub.RuleTemplate, error) {
+	return s.AllF(ctx)
+}
+
+// Delete ...
+func (s *RuleTemplatesStore) Delete(ctx context.Context, t *cloudhub.RuleTemplate) error {
+	return s.DeleteF(ctx, t)
+}
+
+// Get ...
+func (s *RuleTemplatesStore) Get(ctx context.Context, id string) (*cloudhub.RuleTemplate, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *RuleTemplatesStore) Update(ctx context.Context, t *cloudhub.RuleTemplate) error {
+	return s.UpdateF(ctx, t)
+}
+
+// UpdateInstances ...
+func (s *RuleTemplatesStore) UpdateInstances(ctx context.Context, id string, fn func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) error {
+	return s.UpdateInstancesF(ctx, id, fn)
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.SaltJobsStore = &SaltJobsStore{}
+
+// SaltJobsStore mock allows all functions to be set for testing
+type SaltJobsStore struct {
+	AllF    func(context.Context) ([]cloudhub.SaltJob, error)
+	AddF    func(context.Context, *cloudhub.SaltJob) (*cloudhub.SaltJob, error)
+	DeleteF func(context.Context, *cloudhub.SaltJob) error
+	GetF    func(context.Context, string) (*cloudhub.SaltJob, error)
+	UpdateF func(context.Context, *cloudhub.SaltJob) error
+}
+
+// All ...
+func (s *SaltJobsStore) All(ctx context.Context) ([]cloudhub.SaltJob, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *SaltJobsStore) Add(ctx context.Context, j *cloudhub.SaltJob) (*cloudhub.SaltJob, error) {
+	return s.AddF(ctx, j)
+}
+
+// Delete ...
+func (s *SaltJobsStore) Delete(ctx context.Context, j *cloudhub.SaltJob) error {
+	return s.DeleteF(ctx, j)
+}
+
+// Get ...
+func (s *SaltJobsStore) Get(ctx context.Context, jid string) (*cloudhub.SaltJob, error) {
+	return s.GetF(ctx, jid)
+}
+
+// Update ...
+func (s *SaltJobsStore) Update(ctx context.Context, j *cloudhub.SaltJob) error {
+	return s.UpdateF(ctx, j)
+}
@@ -26,6 +26,16 @@ type Store struct {
 	MLNxRstStore            cloudhub.MLNxRstStore
 	DLNxRstStore            cloudhub.DLNxRstStore
 	DLNxRstStgStore         cloudhub.DLNxRstStgStore
+	AuditStore              cloudhub.AuditStore
+	DashboardRevisionsStore cloudhub.DashboardRevisionsStore
+	APITokensStore          cloudhub.APITokensStore
+	HostKeysStore           cloudhub.HostKeysStore
+	TerminalRecordingsStore cloudhub.TerminalRecordingsStore
+	TerminalProfilesStore   cloudhub.TerminalProfilesStore
+	SaltJobsStore           cloudhub.SaltJobsStore
+	AlertEventsStore        cloudhub.AlertEventsStore
+	MaintenanceWindowsStore cloudhub.MaintenanceWindowsStore
+	RuleTemplatesStore      cloudhub.RuleTemplatesStore
 }
 
 // Sources ...
@@ -117,3 +127,53 @@ func (s *Store) DLNxRst(ctx context.Context) cloudhub.DLNxRstStore {
 func (s *Store) DLNxRstStg(ctx context.Context) cloudhub.DLNxRstStgStore {
 	return s.DLNxRstStgStore
 }
+
+// Audit ...
+func (s *Store) Audit(ctx context.Context) cloudhub.AuditStore {
+	return s.AuditStore
+}
+
+// DashboardRevisions ...
+func (s *Store) DashboardRevisions(ctx context.Context) cloudhub.DashboardRevisionsStore {
+	return s.DashboardRevisionsStore
+}
+
+// APITokens ...
+func (s *Store) APITokens(ctx context.Context) cloudhub.APITokensStore {
+	return s.APITokensStore
+}
+
+// HostKeys ...
+func (s *Store) HostKeys(ctx context.Context) cloudhub.HostKeysStore {
+	return s.HostKeysStore
+}
+
+// TerminalRecordings ...
+func (s *Store) TerminalRecordings(ctx context.Context) cloudhub.TerminalRecordingsStore {
+	return s.TerminalRecordingsStore
+}
+
+// TerminalProfiles ...
+func (s *Store) TerminalProfiles(ctx context.Context) cloudhub.TerminalProfilesStore {
+	return s.TerminalProfilesStore
+}
+
+// SaltJobs ...
+func (s *Store) SaltJobs(ctx context.Context) cloudhub.SaltJobsStore {
+	return s.SaltJobsStore
+}
+
+// AlertEvents ...
+func (s *Store) AlertEvents(ctx context.Context) cloudhub.AlertEventsStore {
+	return s.AlertEventsStore
+}
+
+// MaintenanceWindows ...
+func (s *Store) MaintenanceWindows(ctx context.Context) cloudhub.MaintenanceWindowsStore {
+	return s.MaintenanceWindowsStore
+}
+
+// RuleTemplates ...
+func (s *Store) RuleTemplates(ctx context.Context) cloudhub.RuleTemplatesStore {
+	return s.RuleTemplatesStore
+}
@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.TerminalProfilesStore = &TerminalProfilesStore{}
+
+// TerminalProfilesStore mock allows all functions to be set for testing
+type TerminalProfilesStore struct {
+	AllF    func(context.Context) ([]cloudhub.TerminalProfile, error)
+	AddF    func(context.Context, *cloudhub.TerminalProfile) (*cloudhub.TerminalProfile, error)
+	DeleteF func(context.Context, *cloudhub.TerminalProfile) error
+	GetF    func(context.Context, string) (*cloudhub.TerminalProfile, error)
+	UpdateF func(context.Context, *cloudhub.TerminalProfile) error
+}
+
+// All ...
+func (s *TerminalProfilesStore) All(ctx context.Context) ([]cloudhub.TerminalProfile, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *TerminalProfilesStore) Add(ctx context.Context, p *cloudhub.TerminalProfile) (*cloudhub.TerminalProfile, error) {
+	return s.AddF(ctx, p)
+}
+
+// Delete ...
+func (s *TerminalProfilesStore) Delete(ctx context.Context, p *cloudhub.TerminalProfile) error {
+	return s.DeleteF(ctx, p)
+}
+
+// Get ...
+func (s *TerminalProfilesStore) Get(ctx context.Context, id string) (*cloudhub.TerminalProfile, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *TerminalProfilesStore) Update(ctx context.Context, p *cloudhub.TerminalProfile) error {
+	return s.UpdateF(ctx, p)
+}
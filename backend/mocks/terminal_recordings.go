@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.TerminalRecordingsStore = &TerminalRecordingsStore{}
+
+// TerminalRecordingsStore mock allows all functions to be set for testing
+type TerminalRecordingsStore struct {
+	AllF    func(context.Context) ([]cloudhub.TerminalRecording, error)
+	AddF    func(context.Context, *cloudhub.TerminalRecording) (*cloudhub.TerminalRecording, error)
+	DeleteF func(context.Context, *cloudhub.TerminalRecording) error
+	GetF    func(context.Context, string) (*cloudhub.TerminalRecording, error)
+	UpdateF func(context.Context, *cloudhub.TerminalRecording) error
+}
+
+// All ...
+func (s *TerminalRecordingsStore) All(ctx context.Context) ([]cloudhub.TerminalRecording, error) {
+	return s.AllF(ctx)
+}
+
+// Add ...
+func (s *TerminalRecordingsStore) Add(ctx context.Context, r *cloudhub.TerminalRecording) (*cloudhub.TerminalRecording, error) {
+	return s.AddF(ctx, r)
+}
+
+// Delete ...
+func (s *TerminalRecordingsStore) Delete(ctx context.Context, r *cloudhub.TerminalRecording) error {
+	return s.DeleteF(ctx, r)
+}
+
+// Get ...
+func (s *TerminalRecordingsStore) Get(ctx context.Context, id string) (*cloudhub.TerminalRecording, error) {
+	return s.GetF(ctx, id)
+}
+
+// Update ...
+func (s *TerminalRecordingsStore) Update(ctx context.Context, r *cloudhub.TerminalRecording) error {
+	return s.UpdateF(ctx, r)
+}
@@ -0,0 +1,30 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure AlertEventsStore implements cloudhub.AlertEventsStore
+var _ cloudhub.AlertEventsStore = &AlertEventsStore{}
+
+// AlertEventsStore ...
+type AlertEventsStore struct{}
+
+// Add ...
+func (s *AlertEventsStore) Add(context.Context, *cloudhub.AlertEvent) (*cloudhub.AlertEvent, error) {
+	return nil, fmt.Errorf("failed to add alert event")
+}
+
+// All ...
+func (s *AlertEventsStore) All(context.Context, cloudhub.AlertEventQuery) ([]cloudhub.AlertEvent, error) {
+	return nil, fmt.Errorf("no alert events found")
+}
+
+// Prune ...
+func (s *AlertEventsStore) Prune(context.Context, time.Time) (int, error) {
+	return 0, fmt.Errorf("failed to prune alert events")
+}
@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure APITokensStore implements cloudhub.APITokensStore
+var _ cloudhub.APITokensStore = &APITokensStore{}
+
+// APITokensStore ...
+type APITokensStore struct{}
+
+// All ...
+func (s *APITokensStore) All(context.Context) ([]cloudhub.APIToken, error) {
+	return nil, fmt.Errorf("no api tokens found")
+}
+
+// Add ...
+func (s *APITokensStore) Add(context.Context, *cloudhub.APIToken) (*cloudhub.APIToken, error) {
+	return nil, fmt.Errorf("failed to add api token")
+}
+
+// Delete ...
+func (s *APITokensStore) Delete(context.Context, *cloudhub.APIToken) error {
+	return fmt.Errorf("failed to delete api token")
+}
+
+// Get ...
+func (s *APITokensStore) Get(context.Context, cloudhub.APITokenQuery) (*cloudhub.APIToken, error) {
+	return nil, cloudhub.ErrAPITokenNotFound
+}
+
+// Update ...
+func (s *APITokensStore) Update(context.Context, *cloudhub.APIToken) error {
+	return fmt.Errorf("failed to update api token")
+}
@@ -0,0 +1,30 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure AuditStore implements cloudhub.AuditStore
+var _ cloudhub.AuditStore = &AuditStore{}
+
+// AuditStore ...
+type AuditStore struct{}
+
+// Add ...
+func (s *AuditStore) Add(context.Context, *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+	return nil, fmt.Errorf("failed to add audit event")
+}
+
+// All ...
+func (s *AuditStore) All(context.Context, cloudhub.AuditQuery) ([]cloudhub.AuditEvent, error) {
+	return nil, fmt.Errorf("no audit events found")
+}
+
+// Prune ...
+func (s *AuditStore) Prune(context.Context, time.Time) (int, error) {
+	return 0, fmt.Errorf("failed to prune audit events")
+}
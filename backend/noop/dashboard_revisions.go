@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure DashboardRevisionsStore implements cloudhub.DashboardRevisionsStore
+var _ cloudhub.DashboardRevisionsStore = &DashboardRevisionsStore{}
+
+// DashboardRevisionsStore ...
+type DashboardRevisionsStore struct{}
+
+// All ...
+func (s *DashboardRevisionsStore) All(context.Context, cloudhub.DashboardID) ([]cloudhub.DashboardRevision, error) {
+	return nil, fmt.Errorf("no dashboard revisions found")
+}
+
+// Add ...
+func (s *DashboardRevisionsStore) Add(context.Context, *cloudhub.DashboardRevision, int) (*cloudhub.DashboardRevision, error) {
+	return nil, fmt.Errorf("failed to add dashboard revision")
+}
+
+// UpdateDashboard ...
+func (s *DashboardRevisionsStore) UpdateDashboard(context.Context, cloudhub.Dashboard, string, int) error {
+	return fmt.Errorf("failed to update dashboard")
+}
+
+// Get ...
+func (s *DashboardRevisionsStore) Get(context.Context, cloudhub.DashboardID, int) (*cloudhub.DashboardRevision, error) {
+	return nil, cloudhub.ErrDashboardRevisionNotFound
+}
+
+// Delete ...
+func (s *DashboardRevisionsStore) Delete(context.Context, cloudhub.DashboardID) error {
+	return fmt.Errorf("failed to delete dashboard revisions")
+}
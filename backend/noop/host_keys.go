@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure HostKeysStore implements cloudhub.HostKeysStore
+var _ cloudhub.HostKeysStore = &HostKeysStore{}
+
+// HostKeysStore ...
+type HostKeysStore struct{}
+
+// All ...
+func (s *HostKeysStore) All(context.Context) ([]cloudhub.HostKey, error) {
+	return nil, fmt.Errorf("no host keys found")
+}
+
+// Add ...
+func (s *HostKeysStore) Add(context.Context, *cloudhub.HostKey) (*cloudhub.HostKey, error) {
+	return nil, fmt.Errorf("failed to add host key")
+}
+
+// Delete ...
+func (s *HostKeysStore) Delete(context.Context, *cloudhub.HostKey) error {
+	return fmt.Errorf("failed to delete host key")
+}
+
+// Get ...
+func (s *HostKeysStore) Get(context.Context, cloudhub.HostKeyQuery) (*cloudhub.HostKey, error) {
+	return nil, cloudhub.ErrHostKeyNotFound
+}
+
+// Update ...
+func (s *HostKeysStore) Update(context.Context, *cloudhub.HostKey) error {
+	return fmt.Errorf("failed to update host key")
+}
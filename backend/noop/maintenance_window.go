@@ -0,0 +1,49 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure MaintenanceWindowsStore implements cloudhub.MaintenanceWindowsStore
+var _ cloudhub.MaintenanceWindowsStore = &MaintenanceWindowsStore{}
+
+// MaintenanceWindowsStore ...
+type MaintenanceWindowsStore struct{}
+
+// All ...
+func (s *MaintenanceWindowsStore) All(context.Context) ([]cloudhub.MaintenanceWindow, error) {
+	return nil, fmt.Errorf("no maintenance windows found")
+}
+
+// Add ...
+func (s *MaintenanceWindowsStore) Add(context.Context, *cloudhub.MaintenanceWindow) (*cloudhub.MaintenanceWindow, error) {
+	return nil, fmt.Errorf("failed to add maintenance window")
+}
+
+// Delete ...
+func (s *MaintenanceWindowsStore) Delete(context.Context, *cloudhub.MaintenanceWindow) error {
+	return fmt.Errorf("failed to delete maintenance window")
+}
+
+// Get ...
+func (s *MaintenanceWindowsStore) Get(context.Context, string) (*cloudhub.MaintenanceWindow, error) {
+	return nil, cloudhub.ErrMaintenanceWindowNotFound
+}
+
+// Update ...
+func (s *MaintenanceWindowsStore) Update(context.Context, *cloudhub.MaintenanceWindow) error {
+	return fmt.Errorf("failed to update maintenance window")
+}
+
+// UpdateSettings ...
+func (s *MaintenanceWindowsStore) UpdateSettings(context.Context, *cloudhub.MaintenanceWindow) error {
+	return fmt.Errorf("failed to update maintenance window")
+}
+
+// UpdateState ...
+func (s *MaintenanceWindowsStore) UpdateState(context.Context, *cloudhub.MaintenanceWindow) error {
+	return fmt.Errorf("failed to update maintenance window")
+}
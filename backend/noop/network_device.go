@@ -33,6 +33,11 @@ func (s *NetworkDeviceStore) Get(ctx context.Context, q cloudhub.NetworkDeviceQu
 	return nil, cloudhub.ErrDeviceNotFound
 }
 
+// Find ...
+func (s *NetworkDeviceStore) Find(ctx context.Context, q cloudhub.NetworkDeviceQuery) ([]cloudhub.NetworkDevice, error) {
+	return nil, fmt.Errorf("no Network Device found")
+}
+
 // Update ...
 func (s *NetworkDeviceStore) Update(context.Context, *cloudhub.NetworkDevice) error {
 	return fmt.Errorf("failed to update Network Device")
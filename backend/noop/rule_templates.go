@@ -0,0 +1,44 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure RuleTemplatesStore implements cloudhub.RuleTemplatesStore
+var _ cloudhub.RuleTemplatesStore = &RuleTemplatesStore{}
+
+// RuleTemplatesStore ...
+type RuleTemplatesStore struct{}
+
+// All ...
+func (s *RuleTemplatesStore) All(context.Context) ([]cloudhub.RuleTemplate, error) {
+	return nil, fmt.Errorf("no rule templates found")
+}
+
+// Add ...
+func (s *RuleTemplatesStore) Add(context.Context, *cloudhub.RuleTemplate) (*cloudhub.RuleTemplate, error) {
+	return nil, fmt.Errorf("failed to add rule template")
+}
+
+// Delete ...
+func (s *RuleTemplatesStore) Delete(context.Context, *cloudhub.RuleTemplate) error {
+	return fmt.Errorf("failed to delete rule template")
+}
+
+// Get ...
+func (s *RuleTemplatesStore) Get(context.Context, string) (*cloudhub.RuleTemplate, error) {
+	return nil, cloudhub.ErrRuleTemplateNotFound
+}
+
+// Update ...
+func (s *RuleTemplatesStore) Update(context.Context, *cloudhub.RuleTemplate) error {
+	return fmt.Errorf("failed to update rule template")
+}
+
+// UpdateInstances ...
+func (s *RuleTemplatesStore) UpdateInstances(context.Context, string, func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) error {
+	return fmt.Errorf("failed to update rule template")
+}
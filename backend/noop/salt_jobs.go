@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure SaltJobsStore implements cloudhub.SaltJobsStore
+var _ cloudhub.SaltJobsStore = &SaltJobsStore{}
+
+// SaltJobsStore ...
+type SaltJobsStore struct{}
+
+// All ...
+func (s *SaltJobsStore) All(context.Context) ([]cloudhub.SaltJob, error) {
+	return nil, fmt.Errorf("no Salt jobs found")
+}
+
+// Add ...
+func (s *SaltJobsStore) Add(context.Context, *cloudhub.SaltJob) (*cloudhub.SaltJob, error) {
+	return nil, fmt.Errorf("failed to add Salt job")
+}
+
+// Delete ...
+func (s *SaltJobsStore) Delete(context.Context, *cloudhub.SaltJob) error {
+	return fmt.Errorf("failed to delete Salt job")
+}
+
+// Get ...
+func (s *SaltJobsStore) Get(context.Context, string) (*cloudhub.SaltJob, error) {
+	return nil, cloudhub.ErrSaltJobNotFound
+}
+
+// Update ...
+func (s *SaltJobsStore) Update(context.Context, *cloudhub.SaltJob) error {
+	return fmt.Errorf("failed to update Salt job")
+}
@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure TerminalProfilesStore implements cloudhub.TerminalProfilesStore
+var _ cloudhub.TerminalProfilesStore = &TerminalProfilesStore{}
+
+// TerminalProfilesStore ...
+type TerminalProfilesStore struct{}
+
+// All ...
+func (s *TerminalProfilesStore) All(context.Context) ([]cloudhub.TerminalProfile, error) {
+	return nil, fmt.Errorf("no terminal profiles found")
+}
+
+// Add ...
+func (s *TerminalProfilesStore) Add(context.Context, *cloudhub.TerminalProfile) (*cloudhub.TerminalProfile, error) {
+	return nil, fmt.Errorf("failed to add terminal profile")
+}
+
+// Delete ...
+func (s *TerminalProfilesStore) Delete(context.Context, *cloudhub.TerminalProfile) error {
+	return fmt.Errorf("failed to delete terminal profile")
+}
+
+// Get ...
+func (s *TerminalProfilesStore) Get(context.Context, string) (*cloudhub.TerminalProfile, error) {
+	return nil, cloudhub.ErrTerminalProfileNotFound
+}
+
+// Update ...
+func (s *TerminalProfilesStore) Update(context.Context, *cloudhub.TerminalProfile) error {
+	return fmt.Errorf("failed to update terminal profile")
+}
@@ -0,0 +1,39 @@
+package noop
+
+import (
+	"context"
+	"fmt"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure TerminalRecordingsStore implements cloudhub.TerminalRecordingsStore
+var _ cloudhub.TerminalRecordingsStore = &TerminalRecordingsStore{}
+
+// TerminalRecordingsStore ...
+type TerminalRecordingsStore struct{}
+
+// All ...
+func (s *TerminalRecordingsStore) All(context.Context) ([]cloudhub.TerminalRecording, error) {
+	return nil, fmt.Errorf("no terminal recordings found")
+}
+
+// Add ...
+func (s *TerminalRecordingsStore) Add(context.Context, *cloudhub.TerminalRecording) (*cloudhub.TerminalRecording, error) {
+	return nil, fmt.Errorf("failed to add terminal recording")
+}
+
+// Delete ...
+func (s *TerminalRecordingsStore) Delete(context.Context, *cloudhub.TerminalRecording) error {
+	return fmt.Errorf("failed to delete terminal recording")
+}
+
+// Get ...
+func (s *TerminalRecordingsStore) Get(context.Context, string) (*cloudhub.TerminalRecording, error) {
+	return nil, cloudhub.ErrTerminalRecordingNotFound
+}
+
+// Update ...
+func (s *TerminalRecordingsStore) Update(context.Context, *cloudhub.TerminalRecording) error {
+	return fmt.Errorf("failed to update terminal recording")
+}
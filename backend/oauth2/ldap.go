@@ -0,0 +1,255 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// LDAPProviderName is the issuer of principals authenticated by an LDAP
+// directory. Mappings for LDAP groups use it as both provider and scheme,
+// e.g. ldap:ldap:<group>.
+const LDAPProviderName = "ldap"
+
+// ErrLDAPConfig means that the LDAP provider is missing required settings
+var ErrLDAPConfig = errors.New("ldap provider requires a url and a user base dn")
+
+// PasswordProvider authenticates a user by name and password against a
+// directory outside of CloudHub.
+type PasswordProvider interface {
+	// Name is the issuer of the principals returned by Authenticate
+	Name() string
+	// Authenticate returns the principal of the user, with the groups
+	// they belong to, or ErrAuthentication if the credentials are wrong.
+	Authenticate(ctx context.Context, username, password string) (Principal, error)
+}
+
+var _ PasswordProvider = &LDAP{}
+
+// LDAP authenticates users by binding to an LDAP or Active Directory server.
+// A service account looks up the DN of the user with UserFilter, the user's
+// password is checked by binding as that DN, and the groups of the user are
+// read with GroupFilter.
+type LDAP struct {
+	URL                string // ldap://host:389 or ldaps://host:636
+	StartTLS           bool   // Upgrade an ldap:// connection with StartTLS
+	InsecureSkipVerify bool   // Do not verify the certificate of the server
+	RootCAs            *x509.CertPool
+	BindDN             string // DN of the service account; anonymous if empty
+	BindPassword       string
+	UserBaseDN         string
+	UserFilter         string // %s is replaced by the escaped user name, e.g. (uid=%s)
+	GroupBaseDN        string // Defaults to UserBaseDN
+	GroupFilter        string // %s is replaced by the escaped user DN, e.g. (member=%s)
+	GroupAttribute     string // Attribute holding the group name, e.g. cn
+	Timeout            time.Duration
+	Logger             cloudhub.Logger
+}
+
+// Name is the name of the provider
+func (l *LDAP) Name() string {
+	return LDAPProviderName
+}
+
+// Valid reports whether the provider has the settings needed to authenticate
+func (l *LDAP) Valid() error {
+	if l.URL == "" || l.UserBaseDN == "" {
+		return ErrLDAPConfig
+	}
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "ldap":
+	case "ldaps":
+		if l.StartTLS {
+			return fmt.Errorf("ldap StartTLS cannot be used with an ldaps url")
+		}
+	default:
+		return fmt.Errorf("unsupported ldap url scheme %q", u.Scheme)
+	}
+	if l.UserFilter != "" && strings.Count(l.UserFilter, "%s") != 1 {
+		return fmt.Errorf("ldap user filter must contain %%s once")
+	}
+	if l.GroupFilter != "" && strings.Count(l.GroupFilter, "%s") != 1 {
+		return fmt.Errorf("ldap group filter must contain %%s once")
+	}
+	return nil
+}
+
+// Authenticate binds as the user and returns a principal whose Group is the
+// comma delimited list of the user's LDAP groups.
+func (l *LDAP) Authenticate(ctx context.Context, username, password string) (Principal, error) {
+	// An empty password is an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return Principal{}, ErrAuthentication
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return Principal{}, err
+	}
+	defer conn.Close()
+
+	if err := l.bindService(conn); err != nil {
+		return Principal{}, fmt.Errorf("ldap service bind: %v", err)
+	}
+
+	userDN, err := l.findUser(conn, username)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Principal{}, ErrAuthentication
+		}
+		return Principal{}, fmt.Errorf("ldap user bind: %v", err)
+	}
+
+	groups, err := l.groups(conn, userDN)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return Principal{
+		Subject: username,
+		Issuer:  l.Name(),
+		Group:   strings.Join(groups, ","),
+	}, nil
+}
+
+func (l *LDAP) tlsConfig() (*tls.Config, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: l.InsecureSkipVerify,
+		RootCAs:            l.RootCAs,
+	}, nil
+}
+
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	cfg, err := l.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ldap.DialURL(l.URL, ldap.DialWithTLSConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %v", err)
+	}
+	if l.Timeout > 0 {
+		conn.SetTimeout(l.Timeout)
+	}
+
+	if l.StartTLS {
+		if err := conn.StartTLS(cfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap StartTLS: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func (l *LDAP) bindService(conn *ldap.Conn) error {
+	if l.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(l.BindDN, l.BindPassword)
+}
+
+func (l *LDAP) userFilter() string {
+	if l.UserFilter == "" {
+		return "(uid=%s)"
+	}
+	return l.UserFilter
+}
+
+func (l *LDAP) groupFilter() string {
+	if l.GroupFilter == "" {
+		return "(member=%s)"
+	}
+	return l.GroupFilter
+}
+
+func (l *LDAP) groupAttribute() string {
+	if l.GroupAttribute == "" {
+		return "cn"
+	}
+	return l.GroupAttribute
+}
+
+func (l *LDAP) groupBaseDN() string {
+	if l.GroupBaseDN == "" {
+		return l.UserBaseDN
+	}
+	return l.GroupBaseDN
+}
+
+// findUser returns the DN of the only entry matching the user filter
+func (l *LDAP) findUser(conn *ldap.Conn, username string) (string, error) {
+	req := ldap.NewSearchRequest(
+		l.UserBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(l.userFilter(), ldap.EscapeFilter(username)),
+		[]string{"dn"},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return "", fmt.Errorf("ldap user search: %v", err)
+	}
+
+	switch {
+	case res == nil || len(res.Entries) == 0:
+		return "", ErrAuthentication
+	case len(res.Entries) > 1:
+		l.Logger.Error(fmt.Sprintf("LDAP user filter matched more than one entry for %s", username))
+		return "", ErrAuthentication
+	}
+	return res.Entries[0].DN, nil
+}
+
+// groups returns the names of the groups the user is a member of
+func (l *LDAP) groups(conn *ldap.Conn, userDN string) ([]string, error) {
+	// Group lookups run as the service account, which may see more than the user
+	if err := l.bindService(conn); err != nil {
+		return nil, fmt.Errorf("ldap service bind: %v", err)
+	}
+
+	attr := l.groupAttribute()
+	req := ldap.NewSearchRequest(
+		l.groupBaseDN(),
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(l.groupFilter(), ldap.EscapeFilter(userDN)),
+		[]string{attr},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search: %v", err)
+	}
+
+	groups := []string{}
+	for _, e := range res.Entries {
+		for _, g := range e.GetAttributeValues(attr) {
+			// Group names are joined with commas on the principal
+			if g != "" && !strings.Contains(g, ",") {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups, nil
+}
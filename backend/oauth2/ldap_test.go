@@ -0,0 +1,386 @@
+package oauth2_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	clog "github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+)
+
+// ldapEntry is an entry of the in-process directory
+type ldapEntry struct {
+	DN    string
+	Attrs map[string][]string
+}
+
+// ldapStandIn is a minimal LDAP server answering simple binds, subtree
+// searches with and/or/not/equality/present filters and StartTLS.
+type ldapStandIn struct {
+	t       *testing.T
+	ln      net.Listener
+	entries []ldapEntry
+	tls     *tls.Config
+
+	mu    sync.Mutex
+	binds []string
+}
+
+func newLDAPStandIn(t *testing.T, entries []ldapEntry, cfg *tls.Config) *ldapStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ldapStandIn{t: t, ln: ln, entries: entries, tls: cfg}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *ldapStandIn) URL() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+func (s *ldapStandIn) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.binds...)
+}
+
+func (s *ldapStandIn) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *ldapStandIn) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			s.mu.Lock()
+			s.binds = append(s.binds, name)
+			s.mu.Unlock()
+			code := ldap.LDAPResultInvalidCredentials
+			if name == "" && password == "" {
+				code = ldap.LDAPResultSuccess
+			} else if e := s.find(name); e != nil && len(e.Attrs["userPassword"]) > 0 && e.Attrs["userPassword"][0] == password {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, id, ldapResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(op.Children[0].Value.(string))
+			filter := op.Children[6]
+			for _, e := range s.entries {
+				if !strings.HasSuffix(strings.ToLower(e.DN), base) || !matchFilter(filter, e) {
+					continue
+				}
+				s.write(conn, id, searchEntry(e, op.Children[7]))
+			}
+			s.write(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationExtendedRequest:
+			if s.tls == nil {
+				s.write(conn, id, ldapResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+				continue
+			}
+			s.write(conn, id, ldapResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+			conn = tls.Server(conn, s.tls)
+		default:
+			return
+		}
+	}
+}
+
+func (s *ldapStandIn) find(dn string) *ldapEntry {
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].DN, dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *ldapStandIn) write(conn net.Conn, id int64, op *ber.Packet) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	envelope.AppendChild(op)
+	if _, err := conn.Write(envelope.Bytes()); err != nil {
+		s.t.Logf("ldap stand-in write: %v", err)
+	}
+}
+
+func ldapResult(app ber.Tag, code int) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, app, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return p
+}
+
+func searchEntry(e ldapEntry, attrs *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, a := range attrs.Children {
+		name := a.Value.(string)
+		vals, ok := e.Attrs[name]
+		if !ok {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	p.AppendChild(list)
+	return p
+}
+
+func matchFilter(f *ber.Packet, e ldapEntry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !matchFilter(c, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if matchFilter(c, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(f.Children[0], e)
+	case ldap.FilterPresent:
+		_, ok := e.Attrs[f.Data.String()]
+		return ok
+	case ldap.FilterEqualityMatch:
+		attr, want := f.Children[0].Value.(string), f.Children[1].Value.(string)
+		for _, v := range e.Attrs[attr] {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var testDirectory = []ldapEntry{
+	{DN: "cn=svc,dc=example,dc=com", Attrs: map[string][]string{"userPassword": {"svc-pass"}}},
+	{DN: "uid=alice,ou=people,dc=example,dc=com", Attrs: map[string][]string{"uid": {"alice"}, "userPassword": {"alice-pass"}}},
+	{DN: "uid=bob,ou=people,dc=example,dc=com", Attrs: map[string][]string{"uid": {"bob"}, "userPassword": {"bob-pass"}}},
+	{DN: "cn=ops,ou=groups,dc=example,dc=com", Attrs: map[string][]string{"cn": {"ops"}, "member": {"uid=alice,ou=people,dc=example,dc=com"}}},
+	{DN: "cn=dba,ou=groups,dc=example,dc=com", Attrs: map[string][]string{"cn": {"dba"}, "member": {"uid=alice,ou=people,dc=example,dc=com", "uid=bob,ou=people,dc=example,dc=com"}}},
+}
+
+func TestLDAP_Authenticate(t *testing.T) {
+	srv := newLDAPStandIn(t, testDirectory, nil)
+
+	tests := []struct {
+		name         string
+		bindPassword string
+		username     string
+		password     string
+		want         oauth2.Principal
+		wantErr      error
+		wantAnyErr   bool
+	}{
+		{
+			name:     "User with groups",
+			username: "alice",
+			password: "alice-pass",
+			want:     oauth2.Principal{Subject: "alice", Issuer: "ldap", Group: "ops,dba"},
+		},
+		{
+			name:     "User with one group",
+			username: "bob",
+			password: "bob-pass",
+			want:     oauth2.Principal{Subject: "bob", Issuer: "ldap", Group: "dba"},
+		},
+		{
+			name:     "Wrong password",
+			username: "alice",
+			password: "bob-pass",
+			wantErr:  oauth2.ErrAuthentication,
+		},
+		{
+			name:     "Unknown user",
+			username: "carol",
+			password: "carol-pass",
+			wantErr:  oauth2.ErrAuthentication,
+		},
+		{
+			name:     "Empty password",
+			username: "alice",
+			wantErr:  oauth2.ErrAuthentication,
+		},
+		{
+			name:     "Filter metacharacters",
+			username: "*",
+			password: "alice-pass",
+			wantErr:  oauth2.ErrAuthentication,
+		},
+		{
+			name:         "Wrong service account password",
+			bindPassword: "nope",
+			username:     "alice",
+			password:     "alice-pass",
+			wantAnyErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bindPassword := "svc-pass"
+			if tt.bindPassword != "" {
+				bindPassword = tt.bindPassword
+			}
+			l := &oauth2.LDAP{
+				URL:          srv.URL(),
+				BindDN:       "cn=svc,dc=example,dc=com",
+				BindPassword: bindPassword,
+				UserBaseDN:   "ou=people,dc=example,dc=com",
+				UserFilter:   "(&(uid=%s)(userPassword=*))",
+				GroupBaseDN:  "ou=groups,dc=example,dc=com",
+				Timeout:      5 * time.Second,
+				Logger:       clog.New(clog.DebugLevel),
+			}
+			if err := l.Valid(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := l.Authenticate(context.Background(), tt.username, tt.password)
+			if tt.wantAnyErr {
+				if err == nil || err == oauth2.ErrAuthentication {
+					t.Fatalf("LDAP.Authenticate() error = %v, want a service bind error", err)
+				}
+				return
+			}
+			if err != tt.wantErr {
+				t.Fatalf("LDAP.Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LDAP.Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAP_StartTLS(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	srv := newLDAPStandIn(t, testDirectory, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	l := &oauth2.LDAP{
+		URL:          srv.URL(),
+		StartTLS:     true,
+		BindDN:       "cn=svc,dc=example,dc=com",
+		BindPassword: "svc-pass",
+		UserBaseDN:   "ou=people,dc=example,dc=com",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+		Timeout:      5 * time.Second,
+		Logger:       clog.New(clog.DebugLevel),
+	}
+
+	if _, err := l.Authenticate(context.Background(), "bob", "bob-pass"); err == nil {
+		t.Fatal("LDAP.Authenticate() trusted an unknown certificate")
+	}
+
+	l.RootCAs = pool
+	got, err := l.Authenticate(context.Background(), "bob", "bob-pass")
+	if err != nil {
+		t.Fatalf("LDAP.Authenticate() over StartTLS error = %v", err)
+	}
+	if got.Group != "dba" {
+		t.Errorf("LDAP.Authenticate() over StartTLS = %+v", got)
+	}
+
+	// Everything after the first, failed attempt ran over TLS
+	binds := srv.Binds()
+	if len(binds) != 3 || binds[1] != "uid=bob,ou=people,dc=example,dc=com" {
+		t.Errorf("LDAP binds = %q", binds)
+	}
+}
+
+func TestLDAP_Valid(t *testing.T) {
+	tests := []struct {
+		name    string
+		ldap    oauth2.LDAP
+		wantErr bool
+	}{
+		{name: "ldap", ldap: oauth2.LDAP{URL: "ldap://dc:389", UserBaseDN: "dc=example,dc=com", StartTLS: true}},
+		{name: "ldaps", ldap: oauth2.LDAP{URL: "ldaps://dc:636", UserBaseDN: "dc=example,dc=com"}},
+		{name: "No base DN", ldap: oauth2.LDAP{URL: "ldap://dc:389"}, wantErr: true},
+		{name: "StartTLS over ldaps", ldap: oauth2.LDAP{URL: "ldaps://dc:636", UserBaseDN: "dc=example,dc=com", StartTLS: true}, wantErr: true},
+		{name: "Other scheme", ldap: oauth2.LDAP{URL: "http://dc", UserBaseDN: "dc=example,dc=com"}, wantErr: true},
+		{name: "Filter without user", ldap: oauth2.LDAP{URL: "ldap://dc", UserBaseDN: "dc=example,dc=com", UserFilter: "(uid=alice)"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ldap.Valid(); (err != nil) != tt.wantErr {
+				t.Errorf("LDAP.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ldap stand-in"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
@@ -0,0 +1,284 @@
+package oauth2
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// SAMLProviderName is the default issuer of principals authenticated by a SAML
+// identity provider. SAML users use the oauth2 scheme, so mappings for SAML
+// groups look like saml:oauth2:<group>.
+const SAMLProviderName = "saml"
+
+// SAMLRequestCookie holds the signed ID of the pending AuthnRequest until the
+// identity provider posts its response back to the ACS URL.
+const SAMLRequestCookie = "saml_request"
+
+// ErrSAMLMetadata means that the identity provider metadata has no
+// EntityDescriptor with an IDPSSODescriptor.
+var ErrSAMLMetadata = errors.New("saml metadata does not describe an identity provider")
+
+// Check to ensure SAML is an oauth2.Mux
+var _ Mux = &SAML{}
+
+// NewSAMLMux constructs a Mux handler for a SAML 2.0 service provider
+func NewSAMLMux(sp *saml.ServiceProvider, a Authenticator, t Tokenizer, basepath string, l cloudhub.Logger) *SAML {
+	return &SAML{
+		SP:         sp,
+		Auth:       a,
+		Tokens:     t,
+		SuccessURL: path.Join(basepath, "/"),
+		FailureURL: path.Join(basepath, "/login"),
+		Now:        DefaultNowTime,
+		Logger:     l,
+	}
+}
+
+// SAML is a SAML 2.0 service provider. Login redirects the browser to the
+// identity provider with an AuthnRequest, and Callback is the assertion
+// consumer service (ACS) that receives the signed response with the HTTP-POST
+// binding. The ID of the AuthnRequest is kept in a short lived signed cookie
+// so that only responses to requests made by this browser are accepted.
+type SAML struct {
+	PageName       string                // PageName is the name shown on the login page; defaults to saml
+	SP             *saml.ServiceProvider // SP holds the keys and the identity provider metadata
+	EmailAttribute string                // EmailAttribute is the attribute used as the subject; the NameID is used if empty
+	GroupAttribute string                // GroupAttribute is the attribute whose values are the groups of the user
+	Auth           Authenticator         // Auth is used to Authorize after a valid assertion and Expire on Logout
+	Tokens         Tokenizer             // Tokens is used to sign the pending AuthnRequest ID
+	SuccessURL     string                // SuccessURL is redirect location after successful authorization
+	FailureURL     string                // FailureURL is redirect location after authorization failure
+	Now            func() time.Time      // Now returns the current time (for testing)
+	Logger         cloudhub.Logger       // Logger is used to give some more information about the SAML process
+}
+
+// Name is the name of the provider
+func (s *SAML) Name() string {
+	if s.PageName == "" {
+		return SAMLProviderName
+	}
+	return s.PageName
+}
+
+// Login redirects the user to the identity provider with a new AuthnRequest
+func (s *SAML) Login() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := s.log(r)
+
+		idpURL := s.SP.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+		req, err := s.SP.MakeAuthenticationRequest(idpURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+		if err != nil {
+			log.Error("Unable to create SAML AuthnRequest ", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		now := s.Now()
+		token, err := s.Tokens.Create(r.Context(), Principal{
+			Subject:   req.ID,
+			IssuedAt:  now,
+			ExpiresAt: now.Add(TenMinutes),
+		})
+		if err != nil {
+			log.Error("Unable to sign SAML AuthnRequest ID ", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		redirect, err := req.Redirect("", s.SP)
+		if err != nil {
+			log.Error("Unable to encode SAML AuthnRequest ", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, s.requestCookie(string(token), now.Add(TenMinutes)))
+		http.Redirect(w, r, redirect.String(), http.StatusTemporaryRedirect)
+	})
+}
+
+// Callback validates the signed SAML response posted by the identity
+// provider and authorizes the user of the assertion.
+func (s *SAML) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := s.log(r)
+
+		cookie, err := r.Cookie(SAMLRequestCookie)
+		if err != nil {
+			log.Error("SAML response without a pending AuthnRequest")
+			http.Redirect(w, r, s.FailureURL, http.StatusSeeOther)
+			return
+		}
+		// The request ID is single use
+		http.SetCookie(w, s.requestCookie("", time.Unix(0, 0)))
+
+		pending, err := s.Tokens.ValidPrincipal(r.Context(), Token(cookie.Value), TenMinutes)
+		if err != nil {
+			log.Error("Invalid SAML AuthnRequest cookie ", err.Error())
+			http.Redirect(w, r, s.FailureURL, http.StatusSeeOther)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			log.Error("Unable to parse SAML response form ", err.Error())
+			http.Redirect(w, r, s.FailureURL, http.StatusSeeOther)
+			return
+		}
+		assertion, err := s.SP.ParseResponse(r, []string{pending.Subject})
+		if err != nil {
+			// The reason is only in the private error, which is not shown to the user
+			if ire, ok := err.(*saml.InvalidResponseError); ok {
+				err = ire.PrivateErr
+			}
+			log.Error("Invalid SAML response ", err.Error())
+			http.Redirect(w, r, s.FailureURL, http.StatusSeeOther)
+			return
+		}
+
+		p, err := s.principal(assertion)
+		if err != nil {
+			log.Error("Unable to get principal from SAML assertion ", err.Error())
+			http.Redirect(w, r, s.FailureURL, http.StatusSeeOther)
+			return
+		}
+
+		if err := s.Auth.Authorize(r.Context(), w, p); err != nil {
+			log.Error("Unable to get add session to response ", err.Error())
+			http.Redirect(w, r, s.FailureURL, http.StatusSeeOther)
+			return
+		}
+		log.Info("User ", p.Subject, " is authenticated")
+		http.Redirect(w, r, s.SuccessURL, http.StatusSeeOther)
+	})
+}
+
+// Logout expires the CloudHub session. The session at the identity provider
+// is left as is.
+func (s *SAML) Logout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Auth.Expire(w)
+		http.Redirect(w, r, s.SuccessURL, http.StatusTemporaryRedirect)
+	})
+}
+
+// Metadata serves the service provider metadata to register with the
+// identity provider.
+func (s *SAML) Metadata() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := xml.MarshalIndent(s.SP.Metadata(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		w.Write(buf)
+	})
+}
+
+// principal returns the principal of the assertion whose Group is the comma
+// delimited list of the values of GroupAttribute.
+func (s *SAML) principal(a *saml.Assertion) (Principal, error) {
+	var subject string
+	if s.EmailAttribute != "" {
+		if values := attributeValues(a, s.EmailAttribute); len(values) > 0 {
+			subject = values[0]
+		}
+	}
+	if subject == "" && a.Subject != nil && a.Subject.NameID != nil {
+		subject = a.Subject.NameID.Value
+	}
+	if subject == "" {
+		return Principal{}, fmt.Errorf("assertion has no %q attribute and no NameID", s.EmailAttribute)
+	}
+
+	groups := []string{}
+	if s.GroupAttribute != "" {
+		for _, g := range attributeValues(a, s.GroupAttribute) {
+			// Group names are joined with commas on the principal
+			if g != "" && !strings.Contains(g, ",") {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	return Principal{
+		Subject: subject,
+		Issuer:  s.Name(),
+		Group:   strings.Join(groups, ","),
+	}, nil
+}
+
+// attributeValues returns the values of the attribute with the given name or
+// friendly name.
+func attributeValues(a *saml.Assertion, name string) []string {
+	values := []string{}
+	for _, stmt := range a.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			for _, v := range attr.Values {
+				values = append(values, strings.TrimSpace(v.Value))
+			}
+		}
+	}
+	return values
+}
+
+// requestCookie returns the cookie holding the pending AuthnRequest ID.
+// The identity provider posts to the ACS URL from another site, so browsers
+// only send the cookie along if it is SameSite=None, which requires https.
+func (s *SAML) requestCookie(value string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     SAMLRequestCookie,
+		Value:    value,
+		Path:     s.SP.AcsURL.Path,
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.SP.AcsURL.Scheme == "https" {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+func (s *SAML) log(r *http.Request) cloudhub.Logger {
+	return s.Logger.
+		WithField("component", "auth").
+		WithField("remote_addr", r.RemoteAddr).
+		WithField("method", r.Method).
+		WithField("url", r.URL)
+}
+
+// ParseSAMLMetadata returns the identity provider from SAML metadata, which
+// is either an EntityDescriptor or an EntitiesDescriptor listing it.
+func ParseSAMLMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	entity := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(data, entity); err == nil {
+		if len(entity.IDPSSODescriptors) == 0 {
+			return nil, ErrSAMLMetadata
+		}
+		return entity, nil
+	}
+
+	entities := &saml.EntitiesDescriptor{}
+	if err := xml.Unmarshal(data, entities); err != nil {
+		return nil, err
+	}
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, ErrSAMLMetadata
+}
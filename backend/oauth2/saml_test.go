@@ -0,0 +1,297 @@
+package oauth2
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	clog "github.com/snetsystems/cloudhub/backend/log"
+)
+
+func newSAMLKeyPair(t *testing.T, cn string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func mustParseURL(t *testing.T, s string) url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *u
+}
+
+// spMetadata serves the metadata of the service provider to the test identity
+// provider without its encryption key, so that assertions are sent in the
+// clear and can be tampered with.
+type spMetadata struct {
+	sp *saml.ServiceProvider
+}
+
+func (m spMetadata) GetServiceProvider(r *http.Request, id string) (*saml.EntityDescriptor, error) {
+	md := m.sp.Metadata()
+	for i := range md.SPSSODescriptors {
+		keys := []saml.KeyDescriptor{}
+		for _, k := range md.SPSSODescriptors[i].KeyDescriptors {
+			if k.Use != "encryption" {
+				keys = append(keys, k)
+			}
+		}
+		md.SPSSODescriptors[i].KeyDescriptors = keys
+	}
+	return md, nil
+}
+
+func newTestIDP(t *testing.T, sp *saml.ServiceProvider) *saml.IdentityProvider {
+	key, cert := newSAMLKeyPair(t, "idp.example.com")
+	return &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		Logger:                  logger.DefaultLogger,
+		MetadataURL:             mustParseURL(t, "https://idp.example.com/metadata"),
+		SSOURL:                  mustParseURL(t, "https://idp.example.com/sso"),
+		ServiceProviderProvider: spMetadata{sp},
+	}
+}
+
+func setupSAMLTest(t *testing.T) (*SAML, *saml.IdentityProvider, Authenticator) {
+	key, cert := newSAMLKeyPair(t, "cloudhub.example.com")
+	sp := &saml.ServiceProvider{
+		EntityID:    "https://cloudhub.example.com/oauth/saml/metadata",
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: mustParseURL(t, "https://cloudhub.example.com/oauth/saml/metadata"),
+		AcsURL:      mustParseURL(t, "https://cloudhub.example.com/oauth/saml/callback"),
+	}
+	idp := newTestIDP(t, sp)
+	sp.IDPMetadata = idp.Metadata()
+
+	tokens := NewJWT("secret", "")
+	auth := &cookie{
+		Name:       DefaultCookieName,
+		Lifespan:   time.Hour,
+		Inactivity: defaultInactivityDuration,
+		Now:        time.Now,
+		Tokens:     tokens,
+	}
+	s := NewSAMLMux(sp, auth, tokens, "", clog.New(clog.ParseLevel("debug")))
+	s.EmailAttribute = "email"
+	s.GroupAttribute = "groups"
+	return s, idp, auth
+}
+
+// samlLogin runs Login and returns the AuthnRequest redirect and the cookie
+// with the pending request ID.
+func samlLogin(t *testing.T, s *SAML) (*http.Request, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.Login().ServeHTTP(w, httptest.NewRequest("GET", "https://cloudhub.example.com/oauth/saml/login", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Login() status = %d, want %d", w.Code, http.StatusTemporaryRedirect)
+	}
+	loc := w.Header().Get("Location")
+	if !strings.HasPrefix(loc, "https://idp.example.com/sso?SAMLRequest=") {
+		t.Fatalf("Login() redirected to %s", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SAMLRequestCookie || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteNoneMode {
+		t.Fatalf("Login() cookies = %+v", cookies)
+	}
+	return httptest.NewRequest("GET", loc, nil), cookies[0]
+}
+
+// samlResponse returns the base64 encoded response of the identity provider
+// to the AuthnRequest.
+func samlResponse(t *testing.T, idp *saml.IdentityProvider, authn *http.Request) string {
+	t.Helper()
+	req, err := saml.NewIdpAuthnRequest(idp, authn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	session := &saml.Session{
+		NameID: "u12345",
+		CustomAttributes: []saml.Attribute{
+			{Name: "email", Values: []saml.AttributeValue{{Type: "xs:string", Value: "marty@example.com"}}},
+			{Name: "groups", Values: []saml.AttributeValue{
+				{Type: "xs:string", Value: "ops"},
+				{Type: "xs:string", Value: "dev"},
+			}},
+		},
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.SAMLResponse
+}
+
+func samlCallback(s *SAML, response string, c *http.Cookie) *httptest.ResponseRecorder {
+	body := url.Values{"SAMLResponse": {response}}.Encode()
+	r := httptest.NewRequest("POST", "https://cloudhub.example.com/oauth/saml/callback", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c != nil {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	s.Callback().ServeHTTP(w, r)
+	return w
+}
+
+func Test_SAML_Callback(t *testing.T) {
+	s, idp, auth := setupSAMLTest(t)
+
+	authn, pending := samlLogin(t, s)
+	w := samlCallback(s, samlResponse(t, idp, authn), pending)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != s.SuccessURL {
+		t.Fatalf("Callback() = %d to %s, want %d to %s", w.Code, w.Header().Get("Location"), http.StatusSeeOther, s.SuccessURL)
+	}
+
+	r := httptest.NewRequest("GET", "https://cloudhub.example.com/cloudhub/v1/me", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == DefaultCookieName {
+			r.AddCookie(c)
+		}
+	}
+	p, err := auth.Validate(context.Background(), r)
+	if err != nil {
+		t.Fatalf("Callback() did not set a valid session: %v", err)
+	}
+	if p.Subject != "marty@example.com" || p.Issuer != "saml" || p.Group != "ops,dev" {
+		t.Errorf("Callback() principal = %+v", p)
+	}
+}
+
+func Test_SAML_Callback_Rejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		response func(t *testing.T, s *SAML, idp *saml.IdentityProvider) (string, *http.Cookie)
+	}{
+		{
+			name: "No pending request",
+			response: func(t *testing.T, s *SAML, idp *saml.IdentityProvider) (string, *http.Cookie) {
+				authn, _ := samlLogin(t, s)
+				return samlResponse(t, idp, authn), nil
+			},
+		},
+		{
+			name: "Response to another request",
+			response: func(t *testing.T, s *SAML, idp *saml.IdentityProvider) (string, *http.Cookie) {
+				authn, _ := samlLogin(t, s)
+				_, other := samlLogin(t, s)
+				return samlResponse(t, idp, authn), other
+			},
+		},
+		{
+			name: "Tampered assertion",
+			response: func(t *testing.T, s *SAML, idp *saml.IdentityProvider) (string, *http.Cookie) {
+				authn, pending := samlLogin(t, s)
+				xml, err := base64.StdEncoding.DecodeString(samlResponse(t, idp, authn))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(xml, []byte(">ops<")) {
+					t.Fatalf("response has no ops group: %s", xml)
+				}
+				xml = bytes.Replace(xml, []byte(">ops<"), []byte(">admins<"), 1)
+				return base64.StdEncoding.EncodeToString(xml), pending
+			},
+		},
+		{
+			name: "Signed by an unknown identity provider",
+			response: func(t *testing.T, s *SAML, idp *saml.IdentityProvider) (string, *http.Cookie) {
+				authn, pending := samlLogin(t, s)
+				return samlResponse(t, newTestIDP(t, s.SP), authn), pending
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, idp, _ := setupSAMLTest(t)
+			response, pending := tt.response(t, s, idp)
+
+			w := samlCallback(s, response, pending)
+			if w.Code != http.StatusSeeOther || w.Header().Get("Location") != s.FailureURL {
+				t.Errorf("Callback() = %d to %s, want %d to %s", w.Code, w.Header().Get("Location"), http.StatusSeeOther, s.FailureURL)
+			}
+			for _, c := range w.Result().Cookies() {
+				if c.Name == DefaultCookieName {
+					t.Errorf("Callback() set a session cookie")
+				}
+			}
+		})
+	}
+}
+
+func Test_SAML_Metadata(t *testing.T) {
+	s, idp, _ := setupSAMLTest(t)
+
+	w := httptest.NewRecorder()
+	s.Metadata().ServeHTTP(w, httptest.NewRequest("GET", "https://cloudhub.example.com/oauth/saml/metadata", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/samlmetadata+xml" {
+		t.Fatalf("Metadata() = %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), `Location="https://cloudhub.example.com/oauth/saml/callback"`) {
+		t.Errorf("Metadata() has no ACS location: %s", w.Body.String())
+	}
+
+	// Identity providers often publish an EntitiesDescriptor
+	md := xmlMetadata(idp)
+	wrapped := `<EntitiesDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata">` + md + `</EntitiesDescriptor>`
+	for _, data := range []string{md, wrapped} {
+		got, err := ParseSAMLMetadata([]byte(data))
+		if err != nil {
+			t.Fatalf("ParseSAMLMetadata() error = %v", err)
+		}
+		if got.EntityID != "https://idp.example.com/metadata" {
+			t.Errorf("ParseSAMLMetadata() entity = %s", got.EntityID)
+		}
+	}
+
+	if _, err := ParseSAMLMetadata(w.Body.Bytes()); err != ErrSAMLMetadata {
+		t.Errorf("ParseSAMLMetadata() of service provider error = %v, want %v", err, ErrSAMLMetadata)
+	}
+}
+
+func xmlMetadata(idp *saml.IdentityProvider) string {
+	w := httptest.NewRecorder()
+	idp.ServeMetadata(w, httptest.NewRequest("GET", idp.MetadataURL.String(), nil))
+	return w.Body.String()
+}
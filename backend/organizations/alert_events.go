@@ -0,0 +1,58 @@
+package organizations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that AlertEventsStore implements cloudhub.AlertEventsStore
+var _ cloudhub.AlertEventsStore = &AlertEventsStore{}
+
+// AlertEventsStore facade on an AlertEventsStore that filters alert events
+// by organization.
+type AlertEventsStore struct {
+	store        cloudhub.AlertEventsStore
+	organization string
+}
+
+// NewAlertEventsStore creates a new AlertEventsStore from an existing
+// cloudhub.AlertEventsStore and an organization string
+func NewAlertEventsStore(s cloudhub.AlertEventsStore, org string) *AlertEventsStore {
+	return &AlertEventsStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// Add records an alert event in the AlertEventsStore with event.Organization
+// set to be the organization from the alert events store.
+func (s *AlertEventsStore) Add(ctx context.Context, e *cloudhub.AlertEvent) (*cloudhub.AlertEvent, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Organization = s.organization
+	return s.store.Add(ctx, e)
+}
+
+// All retrieves the alert events of the organization matching q.
+// Any organization set on q is replaced with the store's organization.
+func (s *AlertEventsStore) All(ctx context.Context, q cloudhub.AlertEventQuery) ([]cloudhub.AlertEvent, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Organization = s.organization
+	return s.store.All(ctx, q)
+}
+
+// Prune is not supported by the facade, alert events are retained across
+// all organizations.
+func (s *AlertEventsStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	return 0, fmt.Errorf("cannot prune the alert events of an organization")
+}
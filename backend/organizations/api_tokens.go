@@ -0,0 +1,111 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that APITokensStore implements cloudhub.APITokensStore
+var _ cloudhub.APITokensStore = &APITokensStore{}
+
+// APITokensStore facade on an APITokensStore that filters API tokens
+// by organization.
+type APITokensStore struct {
+	store        cloudhub.APITokensStore
+	organization string
+}
+
+// NewAPITokensStore creates a new APITokensStore from an existing
+// cloudhub.APITokensStore and an organization string
+func NewAPITokensStore(s cloudhub.APITokensStore, org string) *APITokensStore {
+	return &APITokensStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all API tokens from the underlying APITokensStore and filters them
+// by organization.
+func (s *APITokensStore) All(ctx context.Context) ([]cloudhub.APIToken, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// This filters tokens without allocating
+	// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+	tokens := ts[:0]
+	for _, t := range ts {
+		if t.Organization == s.organization {
+			tokens = append(tokens, t)
+		}
+	}
+
+	return tokens, nil
+}
+
+// Add creates a new APIToken in the APITokensStore with token.Organization set to be the
+// organization from the token store.
+func (s *APITokensStore) Add(ctx context.Context, t *cloudhub.APIToken) (*cloudhub.APIToken, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Organization = s.organization
+	return s.store.Add(ctx, t)
+}
+
+// Delete the API token from APITokensStore
+func (s *APITokensStore) Delete(ctx context.Context, t *cloudhub.APIToken) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	t, err = s.Get(ctx, cloudhub.APITokenQuery{ID: &t.ID})
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, t)
+}
+
+// Get returns an API token if it exists and belongs to the organization that is set.
+func (s *APITokensStore) Get(ctx context.Context, q cloudhub.APITokenQuery) (*cloudhub.APIToken, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.store.Get(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Organization != s.organization {
+		return nil, cloudhub.ErrAPITokenNotFound
+	}
+
+	return t, nil
+}
+
+// Update the API token in APITokensStore.
+func (s *APITokensStore) Update(ctx context.Context, t *cloudhub.APIToken) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, cloudhub.APITokenQuery{ID: &t.ID}); err != nil {
+		return err
+	}
+
+	t.Organization = s.organization
+	return s.store.Update(ctx, t)
+}
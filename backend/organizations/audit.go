@@ -0,0 +1,58 @@
+package organizations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that AuditStore implements cloudhub.AuditStore
+var _ cloudhub.AuditStore = &AuditStore{}
+
+// AuditStore facade on an AuditStore that filters audit events
+// by organization.
+type AuditStore struct {
+	store        cloudhub.AuditStore
+	organization string
+}
+
+// NewAuditStore creates a new AuditStore from an existing
+// cloudhub.AuditStore and an organization string
+func NewAuditStore(s cloudhub.AuditStore, org string) *AuditStore {
+	return &AuditStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// Add records an audit event in the AuditStore with event.Organization
+// set to be the organization from the audit store.
+func (s *AuditStore) Add(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Organization = s.organization
+	return s.store.Add(ctx, e)
+}
+
+// All retrieves the audit events of the organization matching q.
+// Any organization set on q is replaced with the store's organization.
+func (s *AuditStore) All(ctx context.Context, q cloudhub.AuditQuery) ([]cloudhub.AuditEvent, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Organization = s.organization
+	return s.store.All(ctx, q)
+}
+
+// Prune is not supported by the facade, audit events are retained across
+// all organizations.
+func (s *AuditStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	return 0, fmt.Errorf("cannot prune the audit events of an organization")
+}
@@ -0,0 +1,113 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that HostKeysStore implements cloudhub.HostKeysStore
+var _ cloudhub.HostKeysStore = &HostKeysStore{}
+
+// HostKeysStore facade on a HostKeysStore that filters host keys
+// by organization.
+type HostKeysStore struct {
+	store        cloudhub.HostKeysStore
+	organization string
+}
+
+// NewHostKeysStore creates a new HostKeysStore from an existing
+// cloudhub.HostKeysStore and an organization string
+func NewHostKeysStore(s cloudhub.HostKeysStore, org string) *HostKeysStore {
+	return &HostKeysStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all host keys from the underlying HostKeysStore and filters them
+// by organization.
+func (s *HostKeysStore) All(ctx context.Context) ([]cloudhub.HostKey, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// This filters host keys without allocating
+	// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+	keys := ks[:0]
+	for _, k := range ks {
+		if k.Organization == s.organization {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+// Add creates a new HostKey in the HostKeysStore with key.Organization set to be the
+// organization from the host key store.
+func (s *HostKeysStore) Add(ctx context.Context, k *cloudhub.HostKey) (*cloudhub.HostKey, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	k.Organization = s.organization
+	return s.store.Add(ctx, k)
+}
+
+// Delete the host key from HostKeysStore
+func (s *HostKeysStore) Delete(ctx context.Context, k *cloudhub.HostKey) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	k, err = s.Get(ctx, cloudhub.HostKeyQuery{ID: &k.ID})
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, k)
+}
+
+// Get returns a host key if it exists and belongs to the organization that is set.
+// Host lookups are always made within that organization.
+func (s *HostKeysStore) Get(ctx context.Context, q cloudhub.HostKeyQuery) (*cloudhub.HostKey, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Organization = &s.organization
+	k, err := s.store.Get(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.Organization != s.organization {
+		return nil, cloudhub.ErrHostKeyNotFound
+	}
+
+	return k, nil
+}
+
+// Update the host key in HostKeysStore.
+func (s *HostKeysStore) Update(ctx context.Context, k *cloudhub.HostKey) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, cloudhub.HostKeyQuery{ID: &k.ID}); err != nil {
+		return err
+	}
+
+	k.Organization = s.organization
+	return s.store.Update(ctx, k)
+}
@@ -0,0 +1,142 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that MaintenanceWindowsStore implements cloudhub.MaintenanceWindowsStore
+var _ cloudhub.MaintenanceWindowsStore = &MaintenanceWindowsStore{}
+
+// MaintenanceWindowsStore facade on a MaintenanceWindowsStore that filters
+// maintenance windows by organization.
+type MaintenanceWindowsStore struct {
+	store        cloudhub.MaintenanceWindowsStore
+	organization string
+}
+
+// NewMaintenanceWindowsStore creates a new MaintenanceWindowsStore from an existing
+// cloudhub.MaintenanceWindowsStore and an organization string
+func NewMaintenanceWindowsStore(s cloudhub.MaintenanceWindowsStore, org string) *MaintenanceWindowsStore {
+	return &MaintenanceWindowsStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all maintenance windows from the underlying MaintenanceWindowsStore
+// and filters them by organization.
+func (s *MaintenanceWindowsStore) All(ctx context.Context) ([]cloudhub.MaintenanceWindow, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// This filters windows without allocating
+	// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+	windows := ws[:0]
+	for _, w := range ws {
+		if w.Organization == s.organization {
+			windows = append(windows, w)
+		}
+	}
+
+	return windows, nil
+}
+
+// Add creates a new MaintenanceWindow in the MaintenanceWindowsStore with
+// window.Organization set to be the organization from the window store.
+func (s *MaintenanceWindowsStore) Add(ctx context.Context, w *cloudhub.MaintenanceWindow) (*cloudhub.MaintenanceWindow, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Organization = s.organization
+	return s.store.Add(ctx, w)
+}
+
+// Delete the maintenance window from MaintenanceWindowsStore
+func (s *MaintenanceWindowsStore) Delete(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	w, err = s.Get(ctx, w.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, w)
+}
+
+// Get returns a maintenance window if it exists and belongs to the organization that is set.
+func (s *MaintenanceWindowsStore) Get(ctx context.Context, id string) (*cloudhub.MaintenanceWindow, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Organization != s.organization {
+		return nil, cloudhub.ErrMaintenanceWindowNotFound
+	}
+
+	return w, nil
+}
+
+// Update the maintenance window in MaintenanceWindowsStore.
+func (s *MaintenanceWindowsStore) Update(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, w.ID); err != nil {
+		return err
+	}
+
+	w.Organization = s.organization
+	return s.store.Update(ctx, w)
+}
+
+// UpdateSettings updates the maintenance window in MaintenanceWindowsStore,
+// keeping the state of its tasks as stored.
+func (s *MaintenanceWindowsStore) UpdateSettings(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, w.ID); err != nil {
+		return err
+	}
+
+	w.Organization = s.organization
+	return s.store.UpdateSettings(ctx, w)
+}
+
+// UpdateState updates the state of the tasks of the maintenance window in
+// MaintenanceWindowsStore, keeping its settings as stored.
+func (s *MaintenanceWindowsStore) UpdateState(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, w.ID); err != nil {
+		return err
+	}
+
+	return s.store.UpdateState(ctx, w)
+}
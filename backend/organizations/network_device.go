@@ -73,6 +73,24 @@ func (s *NetworkDeviceStore) Get(ctx context.Context, q cloudhub.NetworkDeviceQu
 	return t, nil
 }
 
+// Find returns the Devices of the underlying NetworkDeviceStore matching q
+// that belong to the organization, or of any organization for super admins.
+func (s *NetworkDeviceStore) Find(ctx context.Context, q cloudhub.NetworkDeviceQuery) ([]cloudhub.NetworkDevice, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.isSuperAdmin {
+		return s.store.Find(ctx, q)
+	}
+	if q.Organization != nil && *q.Organization != s.organization {
+		return []cloudhub.NetworkDevice{}, nil
+	}
+	q.Organization = &s.organization
+	return s.store.Find(ctx, q)
+}
+
 // Add creates a new Device in the NetworkDeviceStore with NetworkDevice.Organization set to be the
 // organization from the Device store.
 func (s *NetworkDeviceStore) Add(ctx context.Context, t *cloudhub.NetworkDevice) (*cloudhub.NetworkDevice, error) {
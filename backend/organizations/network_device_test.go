@@ -0,0 +1,59 @@
+package organizations_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+)
+
+func TestNetworkDevices_Find(t *testing.T) {
+	devices := []cloudhub.NetworkDevice{
+		{ID: "1", Organization: "1337", DeviceIP: "10.0.0.1"},
+		{ID: "2", Organization: "default", DeviceIP: "10.0.0.1"},
+	}
+	store := &mocks.NetworkDeviceStore{
+		FindF: func(ctx context.Context, q cloudhub.NetworkDeviceQuery) ([]cloudhub.NetworkDevice, error) {
+			var found []cloudhub.NetworkDevice
+			for _, d := range devices {
+				if (q.Organization == nil || d.Organization == *q.Organization) &&
+					(q.DeviceIP == nil || d.DeviceIP == *q.DeviceIP) {
+					found = append(found, d)
+				}
+			}
+			return found, nil
+		},
+	}
+
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name         string
+		isSuperAdmin bool
+		q            cloudhub.NetworkDeviceQuery
+		want         []string
+	}{
+		{name: "devices of the organization", q: cloudhub.NetworkDeviceQuery{DeviceIP: str("10.0.0.1")}, want: []string{"1"}},
+		{name: "devices of another organization", q: cloudhub.NetworkDeviceQuery{Organization: str("default")}},
+		{name: "devices of every organization for super admins", isSuperAdmin: true, q: cloudhub.NetworkDeviceQuery{DeviceIP: str("10.0.0.1")}, want: []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), organizations.ContextKey, "1337")
+			s := organizations.NewNetworkDeviceStore(store, "1337", tt.isSuperAdmin)
+			found, err := s.Find(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range found {
+				got = append(got, d.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
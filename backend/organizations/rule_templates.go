@@ -0,0 +1,126 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that RuleTemplatesStore implements cloudhub.RuleTemplatesStore
+var _ cloudhub.RuleTemplatesStore = &RuleTemplatesStore{}
+
+// RuleTemplatesStore facade on a RuleTemplatesStore that filters
+// rule templates by organization.
+type RuleTemplatesStore struct {
+	store        cloudhub.RuleTemplatesStore
+	organization string
+}
+
+// NewRuleTemplatesStore creates a new RuleTemplatesStore from an existing
+// cloudhub.RuleTemplatesStore and an organization string
+func NewRuleTemplatesStore(s cloudhub.RuleTemplatesStore, org string) *RuleTemplatesStore {
+	return &RuleTemplatesStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all rule templates from the underlying RuleTemplatesStore
+// and filters them by organization.
+func (s *RuleTemplatesStore) All(ctx context.Context) ([]cloudhub.RuleTemplate, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// This filters templates without allocating
+	// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+	templates := ts[:0]
+	for _, t := range ts {
+		if t.Organization == s.organization {
+			templates = append(templates, t)
+		}
+	}
+
+	return templates, nil
+}
+
+// Add creates a new RuleTemplate in the RuleTemplatesStore with
+// template.Organization set to be the organization from the template store.
+func (s *RuleTemplatesStore) Add(ctx context.Context, t *cloudhub.RuleTemplate) (*cloudhub.RuleTemplate, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Organization = s.organization
+	return s.store.Add(ctx, t)
+}
+
+// Delete the rule template from RuleTemplatesStore
+func (s *RuleTemplatesStore) Delete(ctx context.Context, t *cloudhub.RuleTemplate) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	t, err = s.Get(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, t)
+}
+
+// Get returns a rule template if it exists and belongs to the organization that is set.
+func (s *RuleTemplatesStore) Get(ctx context.Context, id string) (*cloudhub.RuleTemplate, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Organization != s.organization {
+		return nil, cloudhub.ErrRuleTemplateNotFound
+	}
+
+	return t, nil
+}
+
+// Update the rule template in RuleTemplatesStore.
+func (s *RuleTemplatesStore) Update(ctx context.Context, t *cloudhub.RuleTemplate) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, t.ID); err != nil {
+		return err
+	}
+
+	t.Organization = s.organization
+	return s.store.Update(ctx, t)
+}
+
+// UpdateInstances updates the instances of the rule template in
+// RuleTemplatesStore if it belongs to the organization that is set.
+func (s *RuleTemplatesStore) UpdateInstances(ctx context.Context, id string, fn func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+
+	return s.store.UpdateInstances(ctx, id, fn)
+}
@@ -0,0 +1,111 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that SaltJobsStore implements cloudhub.SaltJobsStore
+var _ cloudhub.SaltJobsStore = &SaltJobsStore{}
+
+// SaltJobsStore facade on a SaltJobsStore that filters
+// Salt jobs by organization.
+type SaltJobsStore struct {
+	store        cloudhub.SaltJobsStore
+	organization string
+}
+
+// NewSaltJobsStore creates a new SaltJobsStore from an existing
+// cloudhub.SaltJobsStore and an organization string
+func NewSaltJobsStore(s cloudhub.SaltJobsStore, org string) *SaltJobsStore {
+	return &SaltJobsStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all Salt jobs from the underlying SaltJobsStore
+// and filters them by organization.
+func (s *SaltJobsStore) All(ctx context.Context) ([]cloudhub.SaltJob, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	js, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// This filters jobs without allocating
+	// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+	jobs := js[:0]
+	for _, j := range js {
+		if j.Organization == s.organization {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs, nil
+}
+
+// Add creates a new SaltJob in the SaltJobsStore with
+// job.Organization set to be the organization from the store.
+func (s *SaltJobsStore) Add(ctx context.Context, j *cloudhub.SaltJob) (*cloudhub.SaltJob, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	j.Organization = s.organization
+	return s.store.Add(ctx, j)
+}
+
+// Delete the Salt job from SaltJobsStore
+func (s *SaltJobsStore) Delete(ctx context.Context, j *cloudhub.SaltJob) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	j, err = s.Get(ctx, j.JID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, j)
+}
+
+// Get returns a Salt job if it exists and belongs to the organization that is set.
+func (s *SaltJobsStore) Get(ctx context.Context, jid string) (*cloudhub.SaltJob, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := s.store.Get(ctx, jid)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.Organization != s.organization {
+		return nil, cloudhub.ErrSaltJobNotFound
+	}
+
+	return j, nil
+}
+
+// Update the Salt job in SaltJobsStore.
+func (s *SaltJobsStore) Update(ctx context.Context, j *cloudhub.SaltJob) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, j.JID); err != nil {
+		return err
+	}
+
+	j.Organization = s.organization
+	return s.store.Update(ctx, j)
+}
@@ -0,0 +1,111 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that TerminalProfilesStore implements cloudhub.TerminalProfilesStore
+var _ cloudhub.TerminalProfilesStore = &TerminalProfilesStore{}
+
+// TerminalProfilesStore facade on a TerminalProfilesStore that filters
+// terminal profiles by organization.
+type TerminalProfilesStore struct {
+	store        cloudhub.TerminalProfilesStore
+	organization string
+}
+
+// NewTerminalProfilesStore creates a new TerminalProfilesStore from an existing
+// cloudhub.TerminalProfilesStore and an organization string
+func NewTerminalProfilesStore(s cloudhub.TerminalProfilesStore, org string) *TerminalProfilesStore {
+	return &TerminalProfilesStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all terminal profiles from the underlying TerminalProfilesStore
+// and filters them by organization.
+func (s *TerminalProfilesStore) All(ctx context.Context) ([]cloudhub.TerminalProfile, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// This filters profiles without allocating
+	// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+	profiles := ps[:0]
+	for _, p := range ps {
+		if p.Organization == s.organization {
+			profiles = append(profiles, p)
+		}
+	}
+
+	return profiles, nil
+}
+
+// Add creates a new TerminalProfile in the TerminalProfilesStore with
+// profile.Organization set to be the organization from the store.
+func (s *TerminalProfilesStore) Add(ctx context.Context, p *cloudhub.TerminalProfile) (*cloudhub.TerminalProfile, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Organization = s.organization
+	return s.store.Add(ctx, p)
+}
+
+// Delete the terminal profile from TerminalProfilesStore
+func (s *TerminalProfilesStore) Delete(ctx context.Context, p *cloudhub.TerminalProfile) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	p, err = s.Get(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, p)
+}
+
+// Get returns a terminal profile if it exists and belongs to the organization that is set.
+func (s *TerminalProfilesStore) Get(ctx context.Context, id string) (*cloudhub.TerminalProfile, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Organization != s.organization {
+		return nil, cloudhub.ErrTerminalProfileNotFound
+	}
+
+	return p, nil
+}
+
+// Update the terminal profile in TerminalProfilesStore.
+func (s *TerminalProfilesStore) Update(ctx context.Context, p *cloudhub.TerminalProfile) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, p.ID); err != nil {
+		return err
+	}
+
+	p.Organization = s.organization
+	return s.store.Update(ctx, p)
+}
@@ -0,0 +1,111 @@
+package organizations
+
+import (
+	"context"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// ensure that TerminalRecordingsStore implements cloudhub.TerminalRecordingsStore
+var _ cloudhub.TerminalRecordingsStore = &TerminalRecordingsStore{}
+
+// TerminalRecordingsStore facade on a TerminalRecordingsStore that filters
+// terminal recordings by organization.
+type TerminalRecordingsStore struct {
+	store        cloudhub.TerminalRecordingsStore
+	organization string
+}
+
+// NewTerminalRecordingsStore creates a new TerminalRecordingsStore from an existing
+// cloudhub.TerminalRecordingsStore and an organization string
+func NewTerminalRecordingsStore(s cloudhub.TerminalRecordingsStore, org string) *TerminalRecordingsStore {
+	return &TerminalRecordingsStore{
+		store:        s,
+		organization: org,
+	}
+}
+
+// All retrieves all terminal recordings from the underlying TerminalRecordingsStore
+// and filters them by organization.
+func (s *TerminalRecordingsStore) All(ctx context.Context) ([]cloudhub.TerminalRecording, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := s.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// This filters recordings without allocating
+	// https://github.com/golang/go/wiki/SliceTricks#filtering-without-allocating
+	recordings := rs[:0]
+	for _, r := range rs {
+		if r.Organization == s.organization {
+			recordings = append(recordings, r)
+		}
+	}
+
+	return recordings, nil
+}
+
+// Add creates a new TerminalRecording in the TerminalRecordingsStore with
+// recording.Organization set to be the organization from the store.
+func (s *TerminalRecordingsStore) Add(ctx context.Context, r *cloudhub.TerminalRecording) (*cloudhub.TerminalRecording, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Organization = s.organization
+	return s.store.Add(ctx, r)
+}
+
+// Delete the terminal recording from TerminalRecordingsStore
+func (s *TerminalRecordingsStore) Delete(ctx context.Context, r *cloudhub.TerminalRecording) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	r, err = s.Get(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, r)
+}
+
+// Get returns a terminal recording if it exists and belongs to the organization that is set.
+func (s *TerminalRecordingsStore) Get(ctx context.Context, id string) (*cloudhub.TerminalRecording, error) {
+	err := validOrganization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Organization != s.organization {
+		return nil, cloudhub.ErrTerminalRecordingNotFound
+	}
+
+	return r, nil
+}
+
+// Update the terminal recording in TerminalRecordingsStore.
+func (s *TerminalRecordingsStore) Update(ctx context.Context, r *cloudhub.TerminalRecording) error {
+	err := validOrganization(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Get(ctx, r.ID); err != nil {
+		return err
+	}
+
+	r.Organization = s.organization
+	return s.store.Update(ctx, r)
+}
@@ -0,0 +1,134 @@
+// Package passwd hashes the passwords of basic users with argon2id.
+//
+// Hashes are stored in the PHC string format,
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//
+// so that the algorithm and its parameters travel with each hash. Hashes
+// written before argon2id are the bare hex HMAC-SHA512 digests of the
+// password; Verify still accepts them and reports that they need a rehash.
+//
+// The input of argon2id is that same digest rather than the password
+// itself. Clients that send the digest instead of the password (isEncoded
+// logins) keep working, and a legacy hash upgrades without the password.
+package passwd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Algorithm is the identifier of hashes made by Hash
+	Algorithm = "argon2id"
+
+	// argon2id parameters of RFC 9106, section 4, second recommended option
+	memory     = 64 * 1024
+	iterations = 3
+	threads    = 2
+	saltLen    = 16
+	keyLen     = 32
+)
+
+// ErrInvalidHash is returned for stored hashes that cannot be parsed
+var ErrInvalidHash = errors.New("invalid password hash")
+
+var encoding = base64.RawStdEncoding
+
+type params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+var current = params{memory: memory, time: iterations, threads: threads}
+
+// Hash returns the argon2id hash of the digest of a password
+func Hash(digest string) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return encode(current, salt, key(current, salt, digest, keyLen)), nil
+}
+
+// Verify checks the digest of a password against a stored hash. rehash is
+// true when the digest matches a hash that is not argon2id with the current
+// parameters, and the caller should store a new Hash of the digest.
+func Verify(hash, digest string) (ok bool, rehash bool, err error) {
+	if IsLegacy(hash) {
+		want, _ := hex.DecodeString(hash)
+		got, err := hex.DecodeString(digest)
+		if err != nil {
+			return false, false, nil
+		}
+		ok := hmac.Equal(want, got)
+		return ok, ok, nil
+	}
+
+	p, salt, want, err := decode(hash)
+	if err != nil {
+		return false, false, err
+	}
+	got := key(p, salt, digest, uint32(len(want)))
+	if !hmac.Equal(want, got) {
+		return false, false, nil
+	}
+	return true, p != current || len(want) != keyLen, nil
+}
+
+// IsLegacy reports whether hash is a hex HMAC-SHA512 digest written before
+// passwords were hashed with argon2id.
+func IsLegacy(hash string) bool {
+	if len(hash) != hex.EncodedLen(64) {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func key(p params, salt []byte, digest string, n uint32) []byte {
+	return argon2.IDKey([]byte(strings.ToLower(digest)), salt, p.time, p.memory, p.threads, n)
+}
+
+func encode(p params, salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		Algorithm, argon2.Version, p.memory, p.time, p.threads,
+		encoding.EncodeToString(salt), encoding.EncodeToString(key))
+}
+
+func decode(hash string) (params, []byte, []byte, error) {
+	var p params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != Algorithm {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,89 @@
+package passwd_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/snetsystems/cloudhub/backend/passwd"
+	"golang.org/x/crypto/argon2"
+)
+
+// Two HMAC-SHA512 sized hex digests that differ in their first character
+const (
+	digest      = "9d1d3b8e6a3a0bd4e7bd0f6b4b3a0bde93f34e1b69dcd8f4b1d8a0a76e1a32c5b6ab29a1fb6ac7c3e1a2d6c94b6ef7a1d8c3a9c8e2c6b0f7d4e3a1b2c3d4e5f6"
+	otherDigest = "1d1d3b8e6a3a0bd4e7bd0f6b4b3a0bde93f34e1b69dcd8f4b1d8a0a76e1a32c5b6ab29a1fb6ac7c3e1a2d6c94b6ef7a1d8c3a9c8e2c6b0f7d4e3a1b2c3d4e5f6"
+)
+
+func TestHash(t *testing.T) {
+	hash, err := passwd.Hash(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("Hash() = %s, want the argon2id PHC format", hash)
+	}
+	if passwd.IsLegacy(hash) {
+		t.Errorf("IsLegacy(%s) = true", hash)
+	}
+
+	other, err := passwd.Hash(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Errorf("Hash() is not salted")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	hash, err := passwd.Hash(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		hash       string
+		digest     string
+		wantOK     bool
+		wantRehash bool
+		wantErr    bool
+	}{
+		{name: "argon2id", hash: hash, digest: digest, wantOK: true},
+		{name: "argon2id upper case digest", hash: hash, digest: strings.ToUpper(digest), wantOK: true},
+		{name: "argon2id wrong password", hash: hash, digest: otherDigest},
+		{name: "Legacy", hash: digest, digest: digest, wantOK: true, wantRehash: true},
+		{name: "Legacy wrong password", hash: digest, digest: otherDigest},
+		{name: "Legacy digest not hex", hash: digest, digest: "hoverboard"},
+		{
+			name:       "Outdated parameters",
+			hash:       "$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHQ$" + rehashKey(t),
+			digest:     digest,
+			wantOK:     true,
+			wantRehash: true,
+		},
+		{name: "Unknown algorithm", hash: "$2a$10$abcdefghijklmnopqrstuv", digest: digest, wantErr: true},
+		{name: "Unknown version", hash: strings.Replace(hash, "v=19", "v=16", 1), digest: digest, wantErr: true},
+		{name: "Empty", hash: "", digest: digest, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := passwd.Verify(tt.hash, tt.digest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("Verify() = %v, %v, want %v, %v", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
+
+// rehashKey is the argon2id key of digest with the salt "somesalt" and the
+// parameters m=1024, t=1, p=1
+func rehashKey(t *testing.T) string {
+	t.Helper()
+	key := argon2.IDKey([]byte(digest), []byte("somesalt"), 1, 1024, 1, 32)
+	return base64.RawStdEncoding.EncodeToString(key)
+}
@@ -0,0 +1,222 @@
+// Package recordings writes and reads terminal sessions in the asciicast v2
+// format (https://docs.asciinema.org/manual/asciicast/v2/) and keeps them on
+// disk.
+package recordings
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Event codes of asciicast v2
+const (
+	Output = "o" // Output is data written to the terminal
+	Input  = "i" // Input is data typed by the user
+	Resize = "r" // Resize is a change of the terminal size, as COLSxROWS
+)
+
+// ErrVersion is returned when decoding a recording that is not asciicast v2
+var ErrVersion = errors.New("recording is not in asciicast v2 format")
+
+// ErrClosed is returned when recording to a closed Writer
+var ErrClosed = errors.New("recording is closed")
+
+// Header is the first line of an asciicast v2 recording
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"` // Timestamp is the unix time the session started
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a line of an asciicast v2 recording after the header
+type Event struct {
+	Time float64 // Time is the number of seconds since the session started
+	Code string
+	Data string
+}
+
+// MarshalJSON encodes the event as a [time, code, data] array. Terminal
+// output is full of < and >, so HTML characters are not escaped.
+func (e Event) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode([]interface{}{e.Time, e.Code, e.Data}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// UnmarshalJSON decodes an event from a [time, code, data] array
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("asciicast event has %d fields, want 3", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &e.Code); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// Writer records a session as asciicast v2. It is safe for concurrent use,
+// so the input and output of a session can be recorded from their own
+// goroutines.
+type Writer struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	start   time.Time
+	partial map[string][]byte // partial holds the start of a UTF-8 sequence split between writes
+	err     error
+}
+
+// NewWriter writes the header of a session that started at start to w
+func NewWriter(w io.Writer, h Header, start time.Time) (*Writer, error) {
+	h.Version = 2
+	if h.Timestamp == 0 {
+		h.Timestamp = start.Unix()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(h); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		enc:     enc,
+		start:   start,
+		partial: map[string][]byte{},
+	}, nil
+}
+
+// Output records data written to the terminal at t
+func (w *Writer) Output(t time.Time, data []byte) error {
+	return w.write(t, Output, data)
+}
+
+// Input records data typed by the user at t
+func (w *Writer) Input(t time.Time, data []byte) error {
+	return w.write(t, Input, data)
+}
+
+// Resize records a change of the terminal size at t
+func (w *Writer) Resize(t time.Time, cols, rows int) error {
+	return w.write(t, Resize, []byte(fmt.Sprintf("%dx%d", cols, rows)))
+}
+
+// Close stops the recording; later events are dropped with ErrClosed. It
+// returns the error of the first event that could not be written, if any.
+// The underlying writer is not closed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	if err == ErrClosed {
+		return nil
+	}
+	w.err = ErrClosed
+	return err
+}
+
+// write records an event. Events are strings, so a UTF-8 sequence that is
+// split between two reads of the session is held back until it is complete.
+func (w *Writer) write(t time.Time, code string, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+
+	if p := w.partial[code]; len(p) > 0 {
+		data = append(p, data...)
+	}
+	data, w.partial[code] = splitIncomplete(data)
+	if len(data) == 0 {
+		return nil
+	}
+
+	w.err = w.enc.Encode(Event{
+		Time: t.Sub(w.start).Seconds(),
+		Code: code,
+		Data: string(data),
+	})
+	return w.err
+}
+
+// splitIncomplete splits an incomplete UTF-8 sequence off the end of b
+func splitIncomplete(b []byte) ([]byte, []byte) {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		if utf8.FullRune(b[i:]) {
+			return b, nil
+		}
+		rest := make([]byte, len(b)-i)
+		copy(rest, b[i:])
+		return b[:i], rest
+	}
+	return b, nil
+}
+
+// Decoder reads the events of an asciicast v2 recording
+type Decoder struct {
+	scanner *bufio.Scanner
+	header  Header
+}
+
+// NewDecoder reads the header of the recording in r
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	d := &Decoder{scanner: scanner}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersion
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &d.header); err != nil || d.header.Version != 2 {
+		return nil, ErrVersion
+	}
+	return d, nil
+}
+
+// Header returns the header of the recording
+func (d *Decoder) Header() Header {
+	return d.header
+}
+
+// Next returns the next event of the recording, or io.EOF after the last one
+func (d *Decoder) Next() (Event, error) {
+	for d.scanner.Scan() {
+		line := d.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return Event{}, err
+		}
+		return e, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
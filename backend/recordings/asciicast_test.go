@@ -0,0 +1,119 @@
+package recordings_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/recordings"
+)
+
+func TestWriter(t *testing.T) {
+	start := time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	w, err := recordings.NewWriter(&buf, recordings.Header{Width: 82, Height: 24, Title: "root@10.0.0.1:22", Env: map[string]string{"TERM": "xterm-256color"}}, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	euro := []byte("€ <ok>\r\n")
+	steps := []func() error{
+		func() error { return w.Output(start.Add(500*time.Millisecond), []byte("$ ")) },
+		func() error { return w.Input(start.Add(time.Second), []byte("ls\r")) },
+		// the euro sign is split between two reads of the session
+		func() error { return w.Output(start.Add(1500*time.Millisecond), euro[:2]) },
+		func() error { return w.Output(start.Add(2*time.Second), euro[2:]) },
+		func() error { return w.Resize(start.Add(3*time.Second), 120, 40) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := `{"version":2,"width":82,"height":24,"timestamp":1445444940,"title":"root@10.0.0.1:22","env":{"TERM":"xterm-256color"}}
+[0.5,"o","$ "]
+[1,"i","ls\r"]
+[2,"o","€ <ok>\r\n"]
+[3,"r","120x40"]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Writer wrote\n%s\nwant\n%s", got, want)
+	}
+
+	d, err := recordings.NewDecoder(strings.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := d.Header(); h.Width != 82 || h.Height != 24 || h.Timestamp != start.Unix() {
+		t.Errorf("Header() = %+v", h)
+	}
+	var events []recordings.Event
+	for {
+		e, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 4 || events[2] != (recordings.Event{Time: 2, Code: recordings.Output, Data: "€ <ok>\r\n"}) {
+		t.Errorf("Next() = %+v", events)
+	}
+}
+
+func TestNewDecoder_NotAsciicast(t *testing.T) {
+	for _, s := range []string{"", `{"version":1,"width":80,"height":24,"stdout":[]}`, "Script started on 2015-10-21"} {
+		if _, err := recordings.NewDecoder(strings.NewReader(s)); err != recordings.ErrVersion {
+			t.Errorf("NewDecoder(%q) error = %v, want %v", s, err, recordings.ErrVersion)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	ctx := context.Background()
+	d := &recordings.Dir{Path: t.TempDir() + "/recordings"}
+
+	w, err := d.Create(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("cast"))
+	w.Close()
+
+	if _, err := d.Create(ctx, "1"); err == nil {
+		t.Errorf("Create() overwrote an existing recording")
+	}
+	for _, id := range []string{"", "..", "../1", "a/b"} {
+		if _, err := d.Create(ctx, id); err == nil {
+			t.Errorf("Create(%q) succeeded", id)
+		}
+	}
+
+	r, err := d.Open(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(b) != "cast" {
+		t.Errorf("Open() read %q", b)
+	}
+
+	if err := d.Delete(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(ctx, "1"); err != nil {
+		t.Errorf("Delete() of a missing recording error = %v", err)
+	}
+	if _, err := d.Open(ctx, "1"); err != cloudhub.ErrTerminalRecordingNotFound {
+		t.Errorf("Open() of a deleted recording error = %v, want %v", err, cloudhub.ErrTerminalRecordingNotFound)
+	}
+}
@@ -0,0 +1,64 @@
+package recordings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var _ cloudhub.TerminalRecordingStorage = &Dir{}
+
+// Dir keeps recordings as <id>.cast files in a directory
+type Dir struct {
+	Path string
+}
+
+// Create creates the file of a new recording. An existing recording is never
+// overwritten.
+func (d *Dir) Create(ctx context.Context, id string) (io.WriteCloser, error) {
+	name, err := d.file(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(d.Path, 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+// Open opens the file of a recording
+func (d *Dir) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	name, err := d.file(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, cloudhub.ErrTerminalRecordingNotFound
+	}
+	return f, err
+}
+
+// Delete removes the file of a recording. Deleting a missing recording is not
+// an error.
+func (d *Dir) Delete(ctx context.Context, id string) error {
+	name, err := d.file(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *Dir) file(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || filepath.Base(id) != id {
+		return "", fmt.Errorf("invalid recording id %q", id)
+	}
+	return filepath.Join(d.Path, id+".cast"), nil
+}
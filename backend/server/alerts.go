@@ -0,0 +1,317 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+const (
+	defaultAlertEventsLimit = 500
+	maxAlertEventsLimit     = 5000
+
+	alertStateOpen     = "open"
+	alertStateResolved = "resolved"
+)
+
+// alertIngest returns where the rules of srv post their alerts, generating
+// the token of srv the first time. It returns nil if CloudHub has no public
+// URL for kapacitor to reach it.
+func (s *Service) alertIngest(ctx context.Context, srv *cloudhub.Server) (*kapa.AlertIngest, error) {
+	if s.AlertsURL == "" {
+		return nil, nil
+	}
+	if srv.AlertToken == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		srv.AlertToken = base64.RawURLEncoding.EncodeToString(b)
+		if err := s.Store.Servers(ctx).Update(ctx, *srv); err != nil {
+			return nil, err
+		}
+	}
+	return s.existingAlertIngest(*srv), nil
+}
+
+// existingAlertIngest returns where the rules of srv post their alerts, or
+// nil if srv has no token yet, in which case its rules do not post them.
+func (s *Service) existingAlertIngest(srv cloudhub.Server) *kapa.AlertIngest {
+	if s.AlertsURL == "" || srv.AlertToken == "" {
+		return nil
+	}
+	return &kapa.AlertIngest{
+		URL:   fmt.Sprintf("%s/%d", s.AlertsURL, srv.ID),
+		Token: srv.AlertToken,
+	}
+}
+
+// kapacitorAlert is the JSON kapacitor posts for an alert
+type kapacitorAlert struct {
+	ID            string        `json:"id"`
+	Message       string        `json:"message"`
+	Time          time.Time     `json:"time"`
+	Duration      time.Duration `json:"duration"`
+	Level         string        `json:"level"`
+	PreviousLevel string        `json:"previousLevel"`
+	Data          struct {
+		Series []struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"series"`
+	} `json:"data"`
+}
+
+// IngestAlert records an alert posted by a rule of a kapacitor. Kapacitor
+// authenticates with the token of the kapacitor, rather than a session, so
+// the route is outside of the API.
+func (s *Service) IngestAlert(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("kid", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := serverContext(r.Context())
+	srv, err := s.Store.Servers(ctx).Get(ctx, id)
+	if err != nil || srv.Type != "" {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	token := r.Header.Get(kapa.AlertIngestHeader)
+	if srv.AlertToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(srv.AlertToken)) != 1 {
+		Error(w, http.StatusUnauthorized, "invalid alert token", s.Logger)
+		return
+	}
+
+	var req kapacitorAlert
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if req.Level == "" {
+		invalidData(w, fmt.Errorf("level required in alert"), s.Logger)
+		return
+	}
+
+	tags := map[string]string{}
+	for _, series := range req.Data.Series {
+		for k, v := range series.Tags {
+			tags[k] = v
+		}
+	}
+
+	e := &cloudhub.AlertEvent{
+		Time:          req.Time,
+		Organization:  srv.Organization,
+		KapacitorID:   srv.ID,
+		RuleID:        httprouter.GetParamFromContext(ctx, "tid"),
+		AlertID:       req.ID,
+		Level:         req.Level,
+		PreviousLevel: req.PreviousLevel,
+		Host:          tags["host"],
+		Tags:          tags,
+		Message:       req.Message,
+		Duration:      req.Duration,
+	}
+	if _, err := s.Store.AlertEvents(ctx).Add(ctx, e); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validAlertEventsQuery parses the filters of the alert timeline. Times are
+// RFC3339.
+func validAlertEventsQuery(query url.Values) (cloudhub.AlertEventQuery, string, error) {
+	q := cloudhub.AlertEventQuery{
+		RuleID: query.Get("rule"),
+		Level:  query.Get("level"),
+		Host:   query.Get("host"),
+		Limit:  defaultAlertEventsLimit,
+	}
+
+	state := query.Get("state")
+	if state != "" && state != alertStateOpen && state != alertStateResolved {
+		return q, "", fmt.Errorf("state must be %s or %s", alertStateOpen, alertStateResolved)
+	}
+
+	var err error
+	if start := query.Get("start"); start != "" {
+		if q.Start, err = time.Parse(time.RFC3339Nano, start); err != nil {
+			return q, "", fmt.Errorf("invalid start time: %v", err)
+		}
+	}
+	if end := query.Get("end"); end != "" {
+		if q.End, err = time.Parse(time.RFC3339Nano, end); err != nil {
+			return q, "", fmt.Errorf("invalid end time: %v", err)
+		}
+	}
+	if !q.Start.IsZero() && !q.End.IsZero() && q.End.Before(q.Start) {
+		return q, "", fmt.Errorf("end time must not be before start time")
+	}
+
+	if limit := query.Get(limitQuery); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 {
+			return q, "", fmt.Errorf("limit must be a positive integer")
+		}
+		if q.Limit > maxAlertEventsLimit {
+			q.Limit = maxAlertEventsLimit
+		}
+	}
+
+	return q, state, nil
+}
+
+// alertGroup is the latest state of an alert of a rule
+type alertGroup struct {
+	RuleID     string     `json:"ruleID"`
+	AlertID    string     `json:"alertID"`
+	Host       string     `json:"host,omitempty"`
+	Level      string     `json:"level"`
+	Message    string     `json:"message"`
+	Since      time.Time  `json:"since"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	Events     int        `json:"events"`
+}
+
+type alertEventsResponse struct {
+	Links    selfLinks             `json:"links"`
+	Events   []cloudhub.AlertEvent `json:"events"`
+	Open     []alertGroup          `json:"open"`
+	Resolved []alertGroup          `json:"resolved"`
+}
+
+// groupAlertEvents groups events, newest first, by rule and alert. An alert
+// is resolved if its latest level is OK and open otherwise. Kapacitor sets
+// the duration of an event to how long the alert has been in a level other
+// than OK, so the start of an alert is known from its latest event.
+func groupAlertEvents(events []cloudhub.AlertEvent) (open, resolved []alertGroup) {
+	open, resolved = []alertGroup{}, []alertGroup{}
+
+	type key struct{ rule, alert string }
+	groups := map[key]*alertGroup{}
+	var order []key
+	for _, e := range events {
+		k := key{e.RuleID, e.AlertID}
+		if g, ok := groups[k]; ok {
+			g.Events++
+			continue
+		}
+		g := &alertGroup{
+			RuleID:  e.RuleID,
+			AlertID: e.AlertID,
+			Host:    e.Host,
+			Level:   e.Level,
+			Message: e.Message,
+			Since:   e.Time.Add(-e.Duration),
+			Events:  1,
+		}
+		if e.Level == cloudhub.AlertLevelOK {
+			t := e.Time
+			g.ResolvedAt = &t
+		}
+		groups[k] = g
+		order = append(order, k)
+	}
+
+	for _, k := range order {
+		if g := groups[k]; g.ResolvedAt != nil {
+			resolved = append(resolved, *g)
+		} else {
+			open = append(open, *g)
+		}
+	}
+	sort.SliceStable(open, func(i, j int) bool { return open[i].Since.After(open[j].Since) })
+	return open, resolved
+}
+
+// KapacitorAlerts returns the timeline of the alerts posted by the rules of a
+// kapacitor, filtered by time range, level, rule and host, along with the
+// alerts grouped into the open and resolved ones.
+func (s *Service) KapacitorAlerts(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("kid", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	srv, err := s.Store.Servers(ctx).Get(ctx, id)
+	if err != nil || srv.SrcID != srcID || srv.Type != "" {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	q, state, err := validAlertEventsQuery(r.URL.Query())
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+	q.KapacitorID = srv.ID
+
+	events, err := s.Store.AlertEvents(ctx).All(ctx, q)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	if events == nil {
+		events = []cloudhub.AlertEvent{}
+	}
+
+	open, resolved := groupAlertEvents(events)
+	switch state {
+	case alertStateOpen:
+		resolved = []alertGroup{}
+	case alertStateResolved:
+		open = []alertGroup{}
+	}
+
+	res := alertEventsResponse{
+		Links: selfLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/sources/%d/kapacitors/%d/alerts", srcID, srv.ID),
+		},
+		Events:   events,
+		Open:     open,
+		Resolved: resolved,
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// pruneAlertEvents removes the alert events older than retention
+func (s *Service) pruneAlertEvents(ctx context.Context, retention time.Duration) error {
+	pruned, err := s.Store.AlertEvents(serverContext(ctx)).Prune(ctx, time.Now().Add(-retention))
+	if pruned > 0 {
+		s.Logger.
+			WithField("component", "alerts").
+			Info(fmt.Sprintf("Deleted %d alert events past their retention", pruned))
+	}
+	return err
+}
+
+// retainAlertEvents prunes the alert events older than retention every
+// interval until ctx is done
+func (s *Service) retainAlertEvents(ctx context.Context, retention, interval time.Duration) {
+	s.retainEvents(ctx, "alerts", interval, func(ctx context.Context) error {
+		return s.pruneAlertEvents(ctx, retention)
+	})
+}
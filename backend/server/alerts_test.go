@@ -0,0 +1,268 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_IngestAlert(t *testing.T) {
+	const body = `{
+		"id": "cpu:host=web1",
+		"message": "cpu is high on web1",
+		"time": "2023-04-01T00:02:00Z",
+		"duration": 120000000000,
+		"level": "CRITICAL",
+		"previousLevel": "WARNING",
+		"data": {"series": [{"name": "cpu", "tags": {"host": "web1", "cpu": "cpu-total"}}]}
+	}`
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+		want       *cloudhub.AlertEvent
+	}{
+		{
+			name:       "Records the alert",
+			token:      "secret",
+			body:       body,
+			wantStatus: http.StatusNoContent,
+			want: &cloudhub.AlertEvent{
+				Time:          time.Date(2023, 4, 1, 0, 2, 0, 0, time.UTC),
+				Organization:  "1337",
+				KapacitorID:   1,
+				RuleID:        "cloudhub-v1-a",
+				AlertID:       "cpu:host=web1",
+				Level:         cloudhub.AlertLevelCritical,
+				PreviousLevel: cloudhub.AlertLevelWarning,
+				Host:          "web1",
+				Tags:          map[string]string{"host": "web1", "cpu": "cpu-total"},
+				Message:       "cpu is high on web1",
+				Duration:      2 * time.Minute,
+			},
+		},
+		{
+			name:       "Wrong token",
+			token:      "guess",
+			body:       body,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Missing level",
+			token:      "secret",
+			body:       `{"id": "cpu:host=web1"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *cloudhub.AlertEvent
+			s := &Service{
+				Store: &mocks.Store{
+					ServersStore: &mocks.ServersStore{
+						GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+							return cloudhub.Server{ID: ID, Organization: "1337", AlertToken: "secret"}, nil
+						},
+					},
+					AlertEventsStore: &mocks.AlertEventsStore{
+						AddF: func(ctx context.Context, e *cloudhub.AlertEvent) (*cloudhub.AlertEvent, error) {
+							got = e
+							return e, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/alerts/kapacitors/1/rules/cloudhub-v1-a", strings.NewReader(tt.body))
+			r.Header.Set(kapa.AlertIngestHeader, tt.token)
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "kid", Value: "1"},
+				{Key: "tid", Value: "cloudhub-v1-a"},
+			}))
+			s.IngestAlert(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("IngestAlert() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("IngestAlert() recorded %+v", got)
+				}
+				return
+			}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("IngestAlert() time = %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time = tt.want.Time
+			if gotJSON, _ := json.Marshal(got); string(gotJSON) != mustMarshal(t, tt.want) {
+				t.Errorf("IngestAlert() event = %s, want %s", gotJSON, mustMarshal(t, tt.want))
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestService_KapacitorAlerts(t *testing.T) {
+	base := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	events := []cloudhub.AlertEvent{
+		{ID: "4", Time: base.Add(4 * time.Minute), RuleID: "a", AlertID: "web2", Level: "WARNING", Duration: time.Minute},
+		{ID: "3", Time: base.Add(3 * time.Minute), RuleID: "a", AlertID: "web1", Level: "OK", Duration: 2 * time.Minute},
+		{ID: "2", Time: base.Add(2 * time.Minute), RuleID: "a", AlertID: "web1", Level: "CRITICAL", Duration: time.Minute},
+		{ID: "1", Time: base.Add(time.Minute), RuleID: "a", AlertID: "web1", Level: "WARNING"},
+	}
+
+	tests := []struct {
+		name         string
+		url          string
+		wantQuery    cloudhub.AlertEventQuery
+		wantStatus   int
+		wantOpen     []string
+		wantResolved []string
+	}{
+		{
+			name: "Grouped by alert",
+			url:  "/cloudhub/v1/sources/1/kapacitors/2/alerts?rule=a&host=web1&level=CRITICAL&limit=10",
+			wantQuery: cloudhub.AlertEventQuery{
+				KapacitorID: 2,
+				RuleID:      "a",
+				Host:        "web1",
+				Level:       "CRITICAL",
+				Limit:       10,
+			},
+			wantStatus:   http.StatusOK,
+			wantOpen:     []string{"web2"},
+			wantResolved: []string{"web1"},
+		},
+		{
+			name:         "Only open",
+			url:          "/cloudhub/v1/sources/1/kapacitors/2/alerts?state=open",
+			wantQuery:    cloudhub.AlertEventQuery{KapacitorID: 2, Limit: defaultAlertEventsLimit},
+			wantStatus:   http.StatusOK,
+			wantOpen:     []string{"web2"},
+			wantResolved: []string{},
+		},
+		{
+			name:       "Invalid state",
+			url:        "/cloudhub/v1/sources/1/kapacitors/2/alerts?state=closed",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Kapacitor of another source",
+			url:        "/cloudhub/v1/sources/3/kapacitors/2/alerts",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery cloudhub.AlertEventQuery
+			s := &Service{
+				Store: &mocks.Store{
+					ServersStore: &mocks.ServersStore{
+						GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+							return cloudhub.Server{ID: ID, SrcID: 1}, nil
+						},
+					},
+					AlertEventsStore: &mocks.AlertEventsStore{
+						AllF: func(ctx context.Context, q cloudhub.AlertEventQuery) ([]cloudhub.AlertEvent, error) {
+							gotQuery = q
+							return events, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://any.url"+tt.url, nil)
+			parts := strings.Split(tt.url, "/")
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: parts[4]},
+				{Key: "kid", Value: parts[6]},
+			}))
+			s.KapacitorAlerts(w, r)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("KapacitorAlerts() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if gotQuery != tt.wantQuery {
+				t.Errorf("KapacitorAlerts() query = %+v, want %+v", gotQuery, tt.wantQuery)
+			}
+
+			var res alertEventsResponse
+			body, _ := ioutil.ReadAll(resp.Body)
+			if err := json.Unmarshal(body, &res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Events) != len(events) {
+				t.Errorf("KapacitorAlerts() returned %d events, want %d", len(res.Events), len(events))
+			}
+			alerts := func(groups []alertGroup) string {
+				ids := []string{}
+				for _, g := range groups {
+					ids = append(ids, g.AlertID)
+				}
+				return strings.Join(ids, ",")
+			}
+			if got := alerts(res.Open); got != strings.Join(tt.wantOpen, ",") {
+				t.Errorf("KapacitorAlerts() open = %v, want %v", got, tt.wantOpen)
+			}
+			if got := alerts(res.Resolved); got != strings.Join(tt.wantResolved, ",") {
+				t.Errorf("KapacitorAlerts() resolved = %v, want %v", got, tt.wantResolved)
+			}
+			for _, g := range res.Resolved {
+				if g.Events != 3 || !g.Since.Equal(base.Add(time.Minute)) || g.ResolvedAt == nil || !g.ResolvedAt.Equal(base.Add(3*time.Minute)) {
+					t.Errorf("KapacitorAlerts() resolved group = %+v", g)
+				}
+			}
+		})
+	}
+}
+
+func TestService_pruneAlertEvents(t *testing.T) {
+	var got time.Time
+	s := &Service{
+		Store: &mocks.Store{
+			AlertEventsStore: &mocks.AlertEventsStore{
+				PruneF: func(ctx context.Context, before time.Time) (int, error) {
+					got = before
+					return 3, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	if err := s.pruneAlertEvents(context.Background(), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Now().Add(-24 * time.Hour); got.After(want) || got.Before(want.Add(-time.Minute)) {
+		t.Errorf("pruneAlertEvents() pruned the events before %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+const (
+	// APITokenProvider is the issuer of principals authenticated by an API token
+	APITokenProvider = "api-token"
+	// APITokenScheme is the scheme of users acting through an API token
+	APITokenScheme = "token"
+
+	// apiTokenSecretPrefix marks a bearer token as a CloudHub API token
+	apiTokenSecretPrefix = "chub_"
+	// apiTokenPrefixLength is how much of the secret is kept to tell tokens apart
+	apiTokenPrefixLength = len(apiTokenSecretPrefix) + 6
+	// apiTokenTouchInterval limits how often the last used time is written
+	apiTokenTouchInterval = time.Minute
+)
+
+// newAPITokenSecret generates the secret handed to the creator of a token
+func newAPITokenSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiTokenSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAPIToken is the digest of a token secret kept at rest. The secrets are
+// random 256 bit values, so an unsalted hash is enough to make a leaked
+// store useless for authentication.
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerAPIToken returns the API token secret of the Authorization header
+func bearerAPIToken(r *http.Request) (string, bool) {
+	const bearer = "Bearer "
+	h := r.Header.Get("Authorization")
+	if len(h) < len(bearer) || !strings.EqualFold(h[:len(bearer)], bearer) {
+		return "", false
+	}
+	secret := strings.TrimSpace(h[len(bearer):])
+	if !strings.HasPrefix(secret, apiTokenSecretPrefix) {
+		return "", false
+	}
+	return secret, true
+}
+
+// APITokenAuthenticator accepts API tokens sent as an Authorization Bearer
+// header and defers every other request to the wrapped Authenticator.
+type APITokenAuthenticator struct {
+	oauth2.Authenticator
+	Store  DataStore
+	Logger cloudhub.Logger
+	Now    func() time.Time
+}
+
+func (a *APITokenAuthenticator) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// Validate returns the principal of the API token of the request, or of the
+// wrapped Authenticator if the request has no API token.
+func (a *APITokenAuthenticator) Validate(ctx context.Context, r *http.Request) (oauth2.Principal, error) {
+	secret, ok := bearerAPIToken(r)
+	if !ok {
+		return a.Authenticator.Validate(ctx, r)
+	}
+
+	serverCtx := serverContext(ctx)
+	hash := hashAPIToken(secret)
+	t, err := a.Store.APITokens(serverCtx).Get(serverCtx, cloudhub.APITokenQuery{Hash: &hash})
+	if err != nil {
+		return oauth2.Principal{}, oauth2.ErrAuthentication
+	}
+
+	now := a.now()
+	if t.Expired(now) {
+		return oauth2.Principal{}, cloudhub.ErrAPITokenExpired
+	}
+
+	if now.Sub(t.LastUsedAt) >= apiTokenTouchInterval {
+		t.LastUsedAt = now.UTC()
+		if err := a.Store.APITokens(serverCtx).Update(serverCtx, t); err != nil {
+			a.Logger.
+				WithField("component", "token_auth").
+				Error(fmt.Sprintf("Unable to record use of api token %s: %v", t.ID, err))
+		}
+	}
+
+	return oauth2.Principal{
+		Subject:      t.ID,
+		Issuer:       APITokenProvider,
+		Organization: t.Organization,
+		IssuedAt:     t.CreatedAt,
+		ExpiresAt:    t.ExpiresAt,
+	}, nil
+}
+
+// Extend leaves API token principals as they are since a token lives until
+// it expires or is revoked.
+func (a *APITokenAuthenticator) Extend(ctx context.Context, w http.ResponseWriter, p oauth2.Principal) (oauth2.Principal, error) {
+	if p.Issuer == APITokenProvider {
+		return p, nil
+	}
+	return a.Authenticator.Extend(ctx, w, p)
+}
+
+// isAPITokenPrincipal reports whether the request was authenticated by an API token
+func isAPITokenPrincipal(ctx context.Context) bool {
+	p, err := getPrincipal(ctx)
+	return err == nil && p.Issuer == APITokenProvider
+}
+
+// apiTokenUser looks up the token of an API token principal and returns a
+// user holding the role of the token in its organization.
+func apiTokenUser(ctx context.Context, store DataStore, p oauth2.Principal) (*cloudhub.User, error) {
+	serverCtx := serverContext(ctx)
+	t, err := store.APITokens(serverCtx).Get(serverCtx, cloudhub.APITokenQuery{ID: &p.Subject})
+	if err != nil {
+		return nil, err
+	}
+	if t.Organization != p.Organization {
+		return nil, cloudhub.ErrAPITokenNotFound
+	}
+	if t.Expired(time.Now()) {
+		return nil, cloudhub.ErrAPITokenExpired
+	}
+
+	return &cloudhub.User{
+		Name:     t.Name,
+		Provider: APITokenProvider,
+		Scheme:   APITokenScheme,
+		Roles: []cloudhub.Role{
+			{
+				Organization: t.Organization,
+				Name:         t.Role,
+			},
+		},
+	}, nil
+}
+
+type apiTokenLinks struct {
+	Self string `json:"self"` // Self link mapping to this resource
+}
+
+type apiTokenResponse struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Organization string        `json:"organization"`
+	Role         string        `json:"role"`
+	Prefix       string        `json:"prefix"`
+	CreatedBy    string        `json:"createdBy"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	ExpiresAt    *time.Time    `json:"expiresAt,omitempty"`
+	LastUsedAt   *time.Time    `json:"lastUsedAt,omitempty"`
+	Token        string        `json:"token,omitempty"` // Token is the secret, only returned on creation
+	Links        apiTokenLinks `json:"links"`
+}
+
+func newAPITokenResponse(t *cloudhub.APIToken) *apiTokenResponse {
+	res := &apiTokenResponse{
+		ID:           t.ID,
+		Name:         t.Name,
+		Organization: t.Organization,
+		Role:         t.Role,
+		Prefix:       t.Prefix,
+		CreatedBy:    t.CreatedBy,
+		CreatedAt:    t.CreatedAt,
+		Links: apiTokenLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/organizations/%s/tokens/%s", t.Organization, t.ID),
+		},
+	}
+	if !t.ExpiresAt.IsZero() {
+		expires := t.ExpiresAt
+		res.ExpiresAt = &expires
+	}
+	if !t.LastUsedAt.IsZero() {
+		used := t.LastUsedAt
+		res.LastUsedAt = &used
+	}
+	return res
+}
+
+type apiTokensResponse struct {
+	Links  selfLinks           `json:"links"`
+	Tokens []*apiTokenResponse `json:"tokens"`
+}
+
+type apiTokenRequest struct {
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (r *apiTokenRequest) ValidCreate(now time.Time) error {
+	if r.Name == "" {
+		return fmt.Errorf("name required on API token request body")
+	}
+	switch r.Role {
+	case roles.MemberRoleName, roles.ViewerRoleName, roles.EditorRoleName, roles.AdminRoleName:
+	case "":
+		return fmt.Errorf("role required on API token request body")
+	default:
+		return fmt.Errorf("unknown role %s. Valid roles are 'member', 'viewer', 'editor', and 'admin'", r.Role)
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(now) {
+		return fmt.Errorf("expiresAt must be in the future")
+	}
+	return nil
+}
+
+// APITokens lists the API tokens of an organization. Secrets are never returned.
+func (s *Service) APITokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	orgID := httprouter.GetParamFromContext(ctx, "oid")
+
+	tokens, err := s.Store.APITokens(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := apiTokensResponse{
+		Links: selfLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/organizations/%s/tokens", orgID),
+		},
+		Tokens: []*apiTokenResponse{},
+	}
+	for i := range tokens {
+		res.Tokens = append(res.Tokens, newAPITokenResponse(&tokens[i]))
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// NewAPIToken creates an API token of the organization. The response holds
+// the token secret, which cannot be retrieved again.
+func (s *Service) NewAPIToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if isAPITokenPrincipal(ctx) {
+		Error(w, http.StatusForbidden, "API tokens cannot create API tokens", s.Logger)
+		return
+	}
+
+	var req apiTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := req.ValidCreate(now); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	secret, err := newAPITokenSecret()
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	t := &cloudhub.APIToken{
+		Name:      req.Name,
+		Role:      req.Role,
+		Hash:      hashAPIToken(secret),
+		Prefix:    secret[:apiTokenPrefixLength],
+		CreatedAt: now,
+	}
+	if req.ExpiresAt != nil {
+		t.ExpiresAt = req.ExpiresAt.UTC()
+	}
+	if u, ok := hasUserContext(ctx); ok {
+		t.CreatedBy = u.Name
+	}
+
+	t, err = s.Store.APITokens(ctx).Add(ctx, t)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgAPITokenCreated.String(), t.Name)
+	s.logChange(ctx, "APITokens", msg, nil, t)
+
+	res := newAPITokenResponse(t)
+	res.Token = secret
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// RemoveAPIToken revokes an API token of the organization
+func (s *Service) RemoveAPIToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "tid")
+
+	t, err := s.Store.APITokens(ctx).Get(ctx, cloudhub.APITokenQuery{ID: &id})
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	if err := s.Store.APITokens(ctx).Delete(ctx, t); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgAPITokenDeleted.String(), t.Name)
+	s.logChange(ctx, "APITokens", msg, t, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
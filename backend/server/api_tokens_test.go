@@ -0,0 +1,292 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+func TestAPITokenAuthenticator_Validate(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	secret := "chub_secret"
+	cookie := oauth2.Principal{Subject: "alice", Issuer: "github"}
+
+	tests := []struct {
+		name          string
+		header        string
+		token         *cloudhub.APIToken
+		wantPrincipal oauth2.Principal
+		wantErr       bool
+		wantTouched   bool
+	}{
+		{
+			name:   "Valid token",
+			header: "Bearer " + secret,
+			token: &cloudhub.APIToken{
+				ID: "3", Organization: "1337", Role: roles.EditorRoleName, Hash: hashAPIToken(secret),
+			},
+			wantPrincipal: oauth2.Principal{Subject: "3", Issuer: APITokenProvider, Organization: "1337"},
+			wantTouched:   true,
+		},
+		{
+			name:   "Recently used token",
+			header: "bearer " + secret,
+			token: &cloudhub.APIToken{
+				ID: "3", Organization: "1337", Hash: hashAPIToken(secret), LastUsedAt: now.Add(-time.Second),
+			},
+			wantPrincipal: oauth2.Principal{Subject: "3", Issuer: APITokenProvider, Organization: "1337"},
+		},
+		{
+			name:   "Expired token",
+			header: "Bearer " + secret,
+			token: &cloudhub.APIToken{
+				ID: "3", Organization: "1337", Hash: hashAPIToken(secret), ExpiresAt: now,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown token",
+			header:  "Bearer chub_other",
+			wantErr: true,
+		},
+		{
+			name:          "Not an API token",
+			header:        "Bearer eyJhbGciOi",
+			wantPrincipal: cookie,
+		},
+		{
+			name:          "No header",
+			wantPrincipal: cookie,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var touched *cloudhub.APIToken
+			a := &APITokenAuthenticator{
+				Authenticator: &mocks.Authenticator{Principal: cookie},
+				Store: &mocks.Store{
+					APITokensStore: &mocks.APITokensStore{
+						GetF: func(ctx context.Context, q cloudhub.APITokenQuery) (*cloudhub.APIToken, error) {
+							if tt.token == nil || q.Hash == nil || *q.Hash != tt.token.Hash {
+								return nil, cloudhub.ErrAPITokenNotFound
+							}
+							tok := *tt.token
+							return &tok, nil
+						},
+						UpdateF: func(ctx context.Context, tok *cloudhub.APIToken) error {
+							touched = tok
+							return nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+				Now:    func() time.Time { return now },
+			}
+
+			r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/dashboards", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			p, err := a.Validate(context.Background(), r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			p.IssuedAt, p.ExpiresAt = time.Time{}, time.Time{}
+			if p != tt.wantPrincipal {
+				t.Errorf("Validate() principal = %+v, want %+v", p, tt.wantPrincipal)
+			}
+			if (touched != nil) != tt.wantTouched {
+				t.Errorf("Validate() touched = %v, want %v", touched != nil, tt.wantTouched)
+			}
+			if touched != nil && !touched.LastUsedAt.Equal(now) {
+				t.Errorf("Validate() last used = %v, want %v", touched.LastUsedAt, now)
+			}
+		})
+	}
+}
+
+func TestAuthorizedUser_APIToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      *cloudhub.APIToken
+		role       string
+		wantAuthed bool
+	}{
+		{
+			name:       "Editor token on editor route",
+			token:      &cloudhub.APIToken{ID: "3", Name: "ci", Organization: "1337", Role: roles.EditorRoleName},
+			role:       roles.EditorRoleName,
+			wantAuthed: true,
+		},
+		{
+			name:  "Viewer token on editor route",
+			token: &cloudhub.APIToken{ID: "3", Name: "ci", Organization: "1337", Role: roles.ViewerRoleName},
+			role:  roles.EditorRoleName,
+		},
+		{
+			name:  "Admin token on super admin route",
+			token: &cloudhub.APIToken{ID: "3", Name: "ci", Organization: "1337", Role: roles.AdminRoleName},
+			role:  roles.SuperAdminStatus,
+		},
+		{
+			name:  "Revoked token",
+			role:  roles.ViewerRoleName,
+			token: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mocks.Store{
+				OrganizationsStore: &mocks.OrganizationsStore{
+					DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{ID: "0"}, nil
+					},
+					GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{ID: *q.ID}, nil
+					},
+				},
+				APITokensStore: &mocks.APITokensStore{
+					GetF: func(ctx context.Context, q cloudhub.APITokenQuery) (*cloudhub.APIToken, error) {
+						if tt.token == nil {
+							return nil, cloudhub.ErrAPITokenNotFound
+						}
+						return tt.token, nil
+					},
+				},
+			}
+
+			var authed bool
+			var gotUser *cloudhub.User
+			var gotRole string
+			next := func(w http.ResponseWriter, r *http.Request) {
+				authed = true
+				gotUser, _ = hasUserContext(r.Context())
+				gotRole, _ = hasRoleContext(r.Context())
+			}
+			fn := AuthorizedUser(store, true, tt.role, log.New(log.DebugLevel), next)
+
+			ctx := context.WithValue(context.Background(), oauth2.PrincipalKey, oauth2.Principal{
+				Subject:      "3",
+				Issuer:       APITokenProvider,
+				Organization: "1337",
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://any.url", nil).WithContext(ctx)
+			fn(w, r)
+
+			if authed != tt.wantAuthed {
+				t.Fatalf("AuthorizedUser() authorized = %v, want %v", authed, tt.wantAuthed)
+			}
+			if !authed {
+				if w.Code != http.StatusForbidden {
+					t.Errorf("AuthorizedUser() status = %d, want %d", w.Code, http.StatusForbidden)
+				}
+				return
+			}
+			if gotUser.Name != "ci" || gotUser.Provider != APITokenProvider || gotRole != tt.token.Role {
+				t.Errorf("AuthorizedUser() user = %+v with role %q", gotUser, gotRole)
+			}
+		})
+	}
+}
+
+func TestService_NewAPIToken(t *testing.T) {
+	var stored *cloudhub.APIToken
+	s := &Service{
+		Store: &mocks.Store{
+			APITokensStore: &mocks.APITokensStore{
+				AddF: func(ctx context.Context, tok *cloudhub.APIToken) (*cloudhub.APIToken, error) {
+					tok.ID = "5"
+					tok.Organization = "1337"
+					stored = tok
+					return tok, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		principal  string
+		wantStatus int
+	}{
+		{
+			name:       "Valid token",
+			body:       `{"name":"ci","role":"editor","expiresAt":"2999-01-01T00:00:00Z"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Unknown role",
+			body:       `{"name":"ci","role":"superadmin"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Expiry in the past",
+			body:       `{"name":"ci","role":"viewer","expiresAt":"2000-01-01T00:00:00Z"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Created by an API token",
+			body:       `{"name":"ci","role":"viewer"}`,
+			principal:  APITokenProvider,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored = nil
+			ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "oid", Value: "1337"}})
+			ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{Name: "alice"})
+			if tt.principal != "" {
+				ctx = context.WithValue(ctx, oauth2.PrincipalKey, oauth2.Principal{Subject: "3", Issuer: tt.principal})
+			}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/organizations/1337/tokens", bytes.NewBufferString(tt.body)).WithContext(ctx)
+			s.NewAPIToken(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("NewAPIToken() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if stored != nil {
+					t.Errorf("NewAPIToken() stored a token despite failing")
+				}
+				return
+			}
+
+			var res apiTokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(res.Token, apiTokenSecretPrefix) || res.Prefix != res.Token[:apiTokenPrefixLength] {
+				t.Errorf("NewAPIToken() token = %q, prefix = %q", res.Token, res.Prefix)
+			}
+			if stored.Hash != hashAPIToken(res.Token) || strings.Contains(stored.Hash, res.Token) {
+				t.Errorf("NewAPIToken() did not store the hash of the secret")
+			}
+			if stored.CreatedBy != "alice" || res.ExpiresAt == nil || res.LastUsedAt != nil {
+				t.Errorf("NewAPIToken() = %+v", res)
+			}
+			if strings.Contains(w.Body.String(), stored.Hash) {
+				t.Errorf("NewAPIToken() returned the hash of the secret")
+			}
+			if w.Header().Get("Location") != "/cloudhub/v1/organizations/1337/tokens/5" {
+				t.Errorf("NewAPIToken() location = %s", w.Header().Get("Location"))
+			}
+		})
+	}
+}
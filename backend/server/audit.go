@@ -0,0 +1,456 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/id"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+const (
+	// RequestIDHeader carries the ID that ties audit events to a request
+	RequestIDHeader = "X-Request-Id"
+
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type requestContextKey string
+
+// RequestContextKey is the context key for retrieving the request info off of context
+const RequestContextKey = requestContextKey("request")
+
+// requestInfo identifies the request that caused an audit event
+type requestInfo struct {
+	ID     string
+	Method string
+	Path   string
+}
+
+// hasRequestContext retrieves the requestInfo stored on context by RequestID
+func hasRequestContext(ctx context.Context) (requestInfo, bool) {
+	// prevents panic in case of nil context
+	if ctx == nil {
+		return requestInfo{}, false
+	}
+	info, ok := ctx.Value(RequestContextKey).(requestInfo)
+	return info, ok
+}
+
+// RequestID is middleware that assigns every request an ID, reusing the
+// X-Request-Id header of the request if present, and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	ids := &id.UUID{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID := r.Header.Get(RequestIDHeader)
+		if reqID == "" {
+			reqID, _ = ids.Generate()
+		}
+		w.Header().Set(RequestIDHeader, reqID)
+
+		ctx := context.WithValue(r.Context(), RequestContextKey, requestInfo{
+			ID:     reqID,
+			Method: r.Method,
+			Path:   r.URL.Path,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newAuditEvent creates an audit event of action by user, filling in the
+// organization and request details found on the context.
+func newAuditEvent(ctx context.Context, user *cloudhub.User, action, message string) cloudhub.AuditEvent {
+	e := cloudhub.AuditEvent{
+		Time:     time.Now().UTC(),
+		Actor:    user.Name,
+		Provider: user.Provider,
+		Action:   action,
+		Message:  message,
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		e.Organization = org
+	} else if p, err := getValidPrincipal(ctx); err == nil {
+		e.Organization = p.Organization
+	}
+	if info, ok := hasRequestContext(ctx); ok {
+		e.RequestID = info.ID
+		e.Method = info.Method
+		e.Resource = info.Path
+	}
+	return e
+}
+
+// logChange records an audit event along with the state of the changed
+// resource before and after the change. Either state may be nil.
+func (s *Service) logChange(ctx context.Context, action, message string, before, after interface{}) {
+	logs := s.Logger.
+		WithField("component", "activity_logging").
+		WithField("action", action)
+
+	user, ok := hasUserContext(ctx)
+	if !ok {
+		logs.Error("Empty user in context")
+		return
+	}
+
+	e := newAuditEvent(ctx, user, action, message)
+	var err error
+	if e.Before, err = auditState(before); err != nil {
+		logs.Error(fmt.Sprintf("Error encoding audit state : %v", err))
+	}
+	if e.After, err = auditState(after); err != nil {
+		logs.Error(fmt.Sprintf("Error encoding audit state : %v", err))
+	}
+
+	s.recordAudit(ctx, e)
+}
+
+// auditState encodes a resource for an audit event. Resources holding
+// secrets are passed by value so that their secrets can be redacted.
+func auditState(v interface{}) (json.RawMessage, error) {
+	switch r := v.(type) {
+	case nil:
+		return nil, nil
+	case cloudhub.Source:
+		r.Password, r.SharedSecret = redacted(r.Password), redacted(r.SharedSecret)
+		v = r
+	case cloudhub.Server:
+		r.Password = redacted(r.Password)
+		v = r
+	case cloudhub.Vsphere:
+		r.Password = redacted(r.Password)
+		v = r
+	case cloudhub.CSP:
+		r.SecretKey = redacted(r.SecretKey)
+		v = r
+	case cloudhub.User:
+		r.Passwd = redacted(r.Passwd)
+		v = r
+	case cloudhub.TerminalProfile:
+		r.Password, r.PrivateKey, r.Passphrase = redacted(r.Password), redacted(r.PrivateKey), redacted(r.Passphrase)
+		v = r
+	case cloudhub.NetworkDevice:
+		r.SSHConfig.Password, r.SSHConfig.EnPassword = redacted(r.SSHConfig.Password), redacted(r.SSHConfig.EnPassword)
+		r.SNMPConfig.Community = redacted(r.SNMPConfig.Community)
+		r.SNMPConfig.AuthPass, r.SNMPConfig.PrivPass = redacted(r.SNMPConfig.AuthPass), redacted(r.SNMPConfig.PrivPass)
+		v = r
+	case cloudhub.NetworkDeviceOrg:
+		r.AIKapacitor.Password = redacted(r.AIKapacitor.Password)
+		v = r
+	case cloudhub.AlertRule:
+		var secrets []string
+		r.AlertNodes, secrets = redactedAlertNodes(r.AlertNodes)
+		// the TICKscript generated from the rule holds the secrets too
+		script := string(r.TICKScript)
+		for _, secret := range secrets {
+			script = strings.ReplaceAll(script, secret, redacted(secret))
+		}
+		r.TICKScript = cloudhub.TICKScript(script)
+		v = r
+	case *kapa.TopicHandler:
+		if r == nil {
+			return nil, nil
+		}
+		h := *r
+		h.AlertNodes, _ = redactedAlertNodes(h.AlertNodes)
+		if h.Options != nil {
+			h.Options = map[string]interface{}{}
+			// options are those of the kapacitor configuration, which may
+			// be credentials of any kind
+			for k, o := range r.Options {
+				h.Options[k] = redacted(fmt.Sprint(o))
+			}
+		}
+		v = h
+	}
+	return json.Marshal(v)
+}
+
+// redactedAlertNodes returns a copy of n with the credentials of its
+// handlers redacted, along with the credentials.
+func redactedAlertNodes(n cloudhub.AlertNodes) (cloudhub.AlertNodes, []string) {
+	var secrets []string
+	redact := func(secret string) string {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+		return redacted(secret)
+	}
+
+	posts := make([]*cloudhub.Post, len(n.Posts))
+	for i, p := range n.Posts {
+		post := *p
+		post.Headers = map[string]string{}
+		for k, v := range p.Headers {
+			post.Headers[k] = redact(v)
+		}
+		posts[i] = &post
+	}
+	alertas := make([]*cloudhub.Alerta, len(n.Alerta))
+	for i, a := range n.Alerta {
+		alerta := *a
+		alerta.Token = redact(a.Token)
+		alertas[i] = &alerta
+	}
+	pagerDuty := func(nodes []*cloudhub.PagerDuty) []*cloudhub.PagerDuty {
+		res := make([]*cloudhub.PagerDuty, len(nodes))
+		for i, p := range nodes {
+			res[i] = &cloudhub.PagerDuty{ServiceKey: redact(p.ServiceKey)}
+		}
+		return res
+	}
+	pushovers := make([]*cloudhub.Pushover, len(n.Pushover))
+	for i, p := range n.Pushover {
+		pushover := *p
+		pushover.UserKey = redact(p.UserKey)
+		pushovers[i] = &pushover
+	}
+	victorOps := make([]*cloudhub.VictorOps, len(n.VictorOps))
+	for i, v := range n.VictorOps {
+		victorOps[i] = &cloudhub.VictorOps{RoutingKey: redact(v.RoutingKey)}
+	}
+
+	n.Posts, n.Alerta, n.Pushover, n.VictorOps = posts, alertas, pushovers, victorOps
+	n.PagerDuty, n.PagerDuty2 = pagerDuty(n.PagerDuty), pagerDuty(n.PagerDuty2)
+	return n, secrets
+}
+
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
+// recordAudit stores the event in the audit store and hands it to every
+// configured sink. Failures are logged and never fail the request.
+func (s *Service) recordAudit(ctx context.Context, e cloudhub.AuditEvent) {
+	logs := s.Logger.
+		WithField("component", "activity_logging").
+		WithField("action", e.Action)
+
+	serverCtx := serverContext(ctx)
+	if store := s.Store.Audit(serverCtx); store != nil {
+		if _, err := store.Add(serverCtx, &e); err != nil {
+			logs.Error(fmt.Sprintf("Error storing audit event : %v", err))
+		}
+	}
+
+	for _, sink := range s.AuditSinks {
+		if err := sink.Write(serverCtx, e); err != nil {
+			logs.Error(err.Error())
+		}
+	}
+}
+
+// InfluxAuditSink writes audit events as activity_logging points into
+// _internal.monitor of the InfluxDB source set by server option.
+type InfluxAuditSink struct {
+	Store  DataStore
+	Logger cloudhub.Logger
+}
+
+// Write writes the audit event to InfluxDB
+func (s *InfluxAuditSink) Write(ctx context.Context, e cloudhub.AuditEvent) error {
+	// The id of influxdb set as server option is 0
+	id := 0
+	src, err := s.Store.Sources(ctx).Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("Not setting influxdb server option")
+	}
+
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return fmt.Errorf("Error parsing source url : %v", err)
+	}
+
+	nanos := e.Time.UnixNano()
+	data := cloudhub.Point{
+		Database:        "_internal",
+		RetentionPolicy: "monitor",
+		Measurement:     "activity_logging",
+		Time:            nanos,
+		Tags: map[string]string{
+			"severity": "info",
+			"action":   e.Action,
+			"user":     e.Actor,
+			"db":       "",
+		},
+		Fields: map[string]interface{}{
+			"timestamp": nanos,
+			"message":   e.Message,
+		},
+	}
+
+	client := &influx.Client{
+		URL:                u,
+		Authorizer:         influx.DefaultAuthorization(&src),
+		InsecureSkipVerify: src.InsecureSkipVerify,
+		Logger:             s.Logger,
+	}
+
+	if err := client.Write(ctx, []cloudhub.Point{data}); err != nil {
+		return fmt.Errorf("Error influxdb log write : %v", err)
+	}
+	return nil
+}
+
+type auditLinks struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+type auditEventsResponse struct {
+	Events []cloudhub.AuditEvent `json:"events"`
+	Links  auditLinks            `json:"links"`
+}
+
+func newAuditLinks(query url.Values, q cloudhub.AuditQuery, more bool) auditLinks {
+	page := func(offset int) string {
+		v := url.Values{}
+		for k, vs := range query {
+			v[k] = vs
+		}
+		v.Set(limitQuery, strconv.Itoa(q.Limit))
+		v.Set(offsetQuery, strconv.Itoa(offset))
+		return "/cloudhub/v1/audit?" + v.Encode()
+	}
+
+	links := auditLinks{Self: page(q.Offset)}
+	if more {
+		links.Next = page(q.Offset + q.Limit)
+	}
+	if q.Offset > 0 {
+		prev := q.Offset - q.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links.Prev = page(prev)
+	}
+	return links
+}
+
+// validAuditQuery parses the filters of an audit query. Times are RFC3339.
+func validAuditQuery(query url.Values) (cloudhub.AuditQuery, error) {
+	q := cloudhub.AuditQuery{
+		Actor:        query.Get("user"),
+		Organization: query.Get("org"),
+		Action:       query.Get("action"),
+		Limit:        defaultAuditLimit,
+	}
+
+	var err error
+	if start := query.Get("start"); start != "" {
+		if q.Start, err = time.Parse(time.RFC3339Nano, start); err != nil {
+			return q, fmt.Errorf("invalid start time: %v", err)
+		}
+	}
+	if end := query.Get("end"); end != "" {
+		if q.End, err = time.Parse(time.RFC3339Nano, end); err != nil {
+			return q, fmt.Errorf("invalid end time: %v", err)
+		}
+	}
+	if !q.Start.IsZero() && !q.End.IsZero() && q.End.Before(q.Start) {
+		return q, fmt.Errorf("end time must not be before start time")
+	}
+
+	if limit := query.Get(limitQuery); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+		if q.Limit > maxAuditLimit {
+			q.Limit = maxAuditLimit
+		}
+	}
+	if offset := query.Get(offsetQuery); offset != "" {
+		if q.Offset, err = strconv.Atoi(offset); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+
+	return q, nil
+}
+
+// AuditEvents returns the audit log filtered by time range, user, organization
+// and action. Only super admins may see the events of other organizations.
+func (s *Service) AuditEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	q, err := validAuditQuery(r.URL.Query())
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	// Ask for one more event than the page holds to know if there is a next page.
+	limit := q.Limit
+	q.Limit++
+	events, err := s.Store.Audit(ctx).All(ctx, q)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	q.Limit = limit
+
+	more := len(events) > limit
+	if more {
+		events = events[:limit]
+	}
+	if events == nil {
+		events = []cloudhub.AuditEvent{}
+	}
+
+	res := auditEventsResponse{
+		Events: events,
+		Links:  newAuditLinks(r.URL.Query(), q, more),
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// pruneAuditEvents removes the audit events older than retention
+func (s *Service) pruneAuditEvents(ctx context.Context, retention time.Duration) error {
+	pruned, err := s.Store.Audit(serverContext(ctx)).Prune(ctx, time.Now().Add(-retention))
+	if pruned > 0 {
+		s.Logger.
+			WithField("component", "audit").
+			Info(fmt.Sprintf("Deleted %d audit events past their retention", pruned))
+	}
+	return err
+}
+
+// retainAuditEvents prunes the audit events older than retention every
+// interval until ctx is done
+func (s *Service) retainAuditEvents(ctx context.Context, retention, interval time.Duration) {
+	s.retainEvents(ctx, "audit", interval, func(ctx context.Context) error {
+		return s.pruneAuditEvents(ctx, retention)
+	})
+}
+
+// retainEvents calls prune every interval until ctx is done, logging its
+// errors for component
+func (s *Service) retainEvents(ctx context.Context, component string, interval time.Duration, prune func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := prune(ctx); err != nil {
+			s.Logger.
+				WithField("component", component).
+				Error(err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_AuditEvents(t *testing.T) {
+	events := []cloudhub.AuditEvent{
+		{ID: "3", Actor: "alice", Action: "Sources", Message: "influx has been modified."},
+		{ID: "2", Actor: "alice", Action: "Sources", Message: "influx has been created."},
+		{ID: "1", Actor: "alice", Action: "Sources", Message: "telegraf has been created."},
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantQuery  cloudhub.AuditQuery
+		wantStatus int
+		wantIDs    []string
+		wantNext   string
+	}{
+		{
+			name: "Filtered first page",
+			url:  "/cloudhub/v1/audit?user=alice&action=Sources&start=2023-04-01T00:00:00Z&limit=2",
+			wantQuery: cloudhub.AuditQuery{
+				Start:  time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+				Actor:  "alice",
+				Action: "Sources",
+				Limit:  3,
+			},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"3", "2"},
+			wantNext:   "/cloudhub/v1/audit?action=Sources&limit=2&offset=2&start=2023-04-01T00%3A00%3A00Z&user=alice",
+		},
+		{
+			name:       "Last page",
+			url:        "/cloudhub/v1/audit?offset=1",
+			wantQuery:  cloudhub.AuditQuery{Offset: 1, Limit: defaultAuditLimit + 1},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"3", "2", "1"},
+		},
+		{
+			name:       "Invalid time",
+			url:        "/cloudhub/v1/audit?start=yesterday",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Invalid limit",
+			url:        "/cloudhub/v1/audit?limit=-1",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery cloudhub.AuditQuery
+			s := &Service{
+				Store: &mocks.Store{
+					AuditStore: &mocks.AuditStore{
+						AllF: func(ctx context.Context, q cloudhub.AuditQuery) ([]cloudhub.AuditEvent, error) {
+							gotQuery = q
+							if q.Limit < len(events) {
+								return events[:q.Limit], nil
+							}
+							return events, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://any.url"+tt.url, nil)
+			s.AuditEvents(w, r)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("AuditEvents() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !gotQuery.Start.Equal(tt.wantQuery.Start) {
+				t.Errorf("AuditEvents() start = %v, want %v", gotQuery.Start, tt.wantQuery.Start)
+			}
+			gotQuery.Start, tt.wantQuery.Start = time.Time{}, time.Time{}
+			if gotQuery != tt.wantQuery {
+				t.Errorf("AuditEvents() query = %+v, want %+v", gotQuery, tt.wantQuery)
+			}
+
+			var res auditEventsResponse
+			body, _ := ioutil.ReadAll(resp.Body)
+			if err := json.Unmarshal(body, &res); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, e := range res.Events {
+				ids = append(ids, e.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("AuditEvents() events = %v, want %v", ids, tt.wantIDs)
+			}
+			if res.Links.Next != tt.wantNext {
+				t.Errorf("AuditEvents() next = %q, want %q", res.Links.Next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestService_logChange(t *testing.T) {
+	var got cloudhub.AuditEvent
+	var sunk []cloudhub.AuditEvent
+	s := &Service{
+		Store: &mocks.Store{
+			AuditStore: &mocks.AuditStore{
+				AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+					got = *e
+					return e, nil
+				},
+			},
+		},
+		AuditSinks: []cloudhub.AuditSink{auditSinkFunc(func(ctx context.Context, e cloudhub.AuditEvent) error {
+			sunk = append(sunk, e)
+			return nil
+		})},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	var ctx context.Context
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	r := httptest.NewRequest("PATCH", "http://any.url/cloudhub/v1/sources/1", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("RequestID() did not echo the request ID")
+	}
+
+	ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{Name: "alice", Provider: "cloudhub"})
+	before := cloudhub.Source{ID: 1, Name: "influx", Password: "secret"}
+	after := cloudhub.Source{ID: 1, Name: "influx2", Password: "secret"}
+	s.logChange(ctx, "Sources", "influx2 has been modified.", before, after)
+
+	if got.Actor != "alice" || got.Action != "Sources" || got.Method != "PATCH" ||
+		got.Resource != "/cloudhub/v1/sources/1" || got.RequestID != "req-1" {
+		t.Errorf("logChange() recorded %+v", got)
+	}
+	if strings.Contains(string(got.Before), "secret") || strings.Contains(string(got.After), "secret") {
+		t.Errorf("logChange() recorded a secret: %s %s", got.Before, got.After)
+	}
+	if !strings.Contains(string(got.After), `"influx2"`) {
+		t.Errorf("logChange() after = %s", got.After)
+	}
+	if len(sunk) != 1 || sunk[0].Message != got.Message {
+		t.Errorf("logChange() did not write to the audit sinks: %v", sunk)
+	}
+}
+
+type auditSinkFunc func(context.Context, cloudhub.AuditEvent) error
+
+func (f auditSinkFunc) Write(ctx context.Context, e cloudhub.AuditEvent) error {
+	return f(ctx, e)
+}
+
+func Test_auditState_networkDevices(t *testing.T) {
+	device := cloudhub.NetworkDevice{
+		DeviceIP:   "10.0.0.1",
+		SSHConfig:  cloudhub.SSHConfig{UserID: "admin", Password: "secret", EnPassword: "secret"},
+		SNMPConfig: cloudhub.SNMPConfig{Community: "secret", AuthPass: "secret", PrivPass: "secret"},
+	}
+	deviceOrg := cloudhub.NetworkDeviceOrg{ID: "default", AIKapacitor: cloudhub.AIKapacitor{Password: "secret"}}
+	for _, v := range []interface{}{device, deviceOrg} {
+		got, err := auditState(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(got), "secret") {
+			t.Errorf("auditState() = %s, want the secrets redacted", got)
+		}
+	}
+}
+
+func Test_auditState_alertHandlers(t *testing.T) {
+	nodes := cloudhub.AlertNodes{
+		Posts:     []*cloudhub.Post{{URL: "https://alerts.example.com", Headers: map[string]string{"Authorization": "Bearer secret-post"}}},
+		Alerta:    []*cloudhub.Alerta{{Token: "secret-alerta", Resource: "cpu"}},
+		PagerDuty: []*cloudhub.PagerDuty{{ServiceKey: "secret-pagerduty"}},
+		Pushover:  []*cloudhub.Pushover{{UserKey: "secret-pushover", Device: "phone"}},
+		VictorOps: []*cloudhub.VictorOps{{RoutingKey: "secret-victorops"}},
+	}
+	rule := cloudhub.AlertRule{
+		ID:         "cloudhub-v1-a",
+		AlertNodes: nodes,
+		TICKScript: `.alerta().token('secret-alerta').resource('cpu')`,
+	}
+	handler := &kapa.TopicHandler{
+		ID:         "ops",
+		Topic:      "main:cpu:alert",
+		AlertNodes: nodes,
+		Options:    map[string]interface{}{"api-key": "secret-option"},
+	}
+	for _, v := range []interface{}{rule, handler} {
+		got, err := auditState(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(got), "secret") {
+			t.Errorf("auditState() = %s, want the secrets redacted", got)
+		}
+	}
+	if nodes.Alerta[0].Token != "secret-alerta" || nodes.Posts[0].Headers["Authorization"] != "Bearer secret-post" {
+		t.Errorf("auditState() redacted the alert handlers of the rule itself")
+	}
+	if got, err := auditState((*kapa.TopicHandler)(nil)); err != nil || got != nil {
+		t.Errorf("auditState() of no topic handler = %s, %v", got, err)
+	}
+}
+
+func TestService_UpdateService_audit(t *testing.T) {
+	var got []cloudhub.AuditEvent
+	s := &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{ID: ID, SrcID: 1, Name: "flux", Type: "flux", Password: "secret"}, nil
+				},
+				UpdateF: func(ctx context.Context, srv cloudhub.Server) error {
+					return nil
+				},
+			},
+			AuditStore: &mocks.AuditStore{
+				AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+					got = append(got, *e)
+					return e, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PATCH", "http://any.url/cloudhub/v1/sources/1/services/2", strings.NewReader(`{"name": "flux2"}`))
+	ctx := context.WithValue(context.Background(), UserContextKey, &cloudhub.User{Name: "alice", Provider: "cloudhub"})
+	r = r.WithContext(httprouter.WithParams(ctx, httprouter.Params{
+		{Key: "id", Value: "1"},
+		{Key: "kid", Value: "2"},
+	}))
+	s.UpdateService(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("UpdateService() = %d %s", w.Code, w.Body.String())
+	}
+	if len(got) != 1 || got[0].Action != "Services" {
+		t.Fatalf("UpdateService() audited %+v", got)
+	}
+	if !strings.Contains(string(got[0].Before), `"flux"`) || !strings.Contains(string(got[0].After), `"flux2"`) {
+		t.Errorf("UpdateService() audited before %s, after %s", got[0].Before, got[0].After)
+	}
+	if strings.Contains(string(got[0].Before), "secret") || strings.Contains(string(got[0].After), "secret") {
+		t.Errorf("UpdateService() audited a secret: %s %s", got[0].Before, got[0].After)
+	}
+}
+
+func TestService_pruneAuditEvents(t *testing.T) {
+	var got time.Time
+	s := &Service{
+		Store: &mocks.Store{
+			AuditStore: &mocks.AuditStore{
+				PruneF: func(ctx context.Context, before time.Time) (int, error) {
+					got = before
+					return 3, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	if err := s.pruneAuditEvents(context.Background(), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Now().Add(-24 * time.Hour); got.After(want) || got.Before(want.Add(-time.Minute)) {
+		t.Errorf("pruneAuditEvents() pruned the events before %v, want %v", got, want)
+	}
+}
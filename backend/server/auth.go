@@ -149,6 +149,25 @@ func AuthorizedUser(
 			return
 		}
 		ctx = context.WithValue(ctx, organizations.ContextKey, p.Organization)
+
+		// API tokens act with the role they were created with and have no user
+		if p.Issuer == APITokenProvider {
+			u, err := apiTokenUser(ctx, store, p)
+			if err != nil {
+				log.Error(fmt.Sprintf("Failed to retrieve api token: %v", err))
+				Error(w, http.StatusForbidden, "User is not authorized", logger)
+				return
+			}
+			if !hasAuthorizedRole(u, role) {
+				Error(w, http.StatusForbidden, "User is not authorized", logger)
+				return
+			}
+			ctx = context.WithValue(ctx, UserContextKey, u)
+			ctx = context.WithValue(ctx, roles.ContextKey, u.Roles[0].Name)
+			next(w, r.WithContext(ctx))
+			return
+		}
+
 		// TODO: seems silly to look up a user twice
 		u, err := store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{
 			Name:     &p.Subject,
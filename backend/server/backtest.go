@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+// maxBacktestRange bounds the history a rule is backtested on
+const maxBacktestRange = 90 * 24 * time.Hour
+
+type backtestRequest struct {
+	Rule  cloudhub.AlertRule `json:"rule"`
+	Start time.Time          `json:"start"`
+	End   time.Time          `json:"end"`
+}
+
+func (r *backtestRequest) Valid() error {
+	if r.Rule.Name == "" {
+		r.Rule.Name = r.Rule.ID
+	}
+	if err := ValidRuleRequest(r.Rule); err != nil {
+		return err
+	}
+	if _, err := (&kapa.Alert{}).Generate(r.Rule); err != nil {
+		return err
+	}
+	if r.Start.IsZero() || r.End.IsZero() {
+		return fmt.Errorf("start and end required in backtest")
+	}
+	if !r.End.After(r.Start) {
+		return fmt.Errorf("end time must be after start time")
+	}
+	if r.End.Sub(r.Start) > maxBacktestRange {
+		return fmt.Errorf("backtest range must not exceed %s", maxBacktestRange)
+	}
+	return nil
+}
+
+type backtestResponse struct {
+	Query       string                    `json:"query"`
+	Start       time.Time                 `json:"start"`
+	End         time.Time                 `json:"end"`
+	Series      int                       `json:"series"`
+	Points      int                       `json:"points"`
+	Alerts      int                       `json:"alerts"` // Alerts is the number of alerts that became CRITICAL at least once
+	Counts      map[string]int            `json:"counts"` // Counts are the transitions by level
+	Transitions []kapa.BacktestTransition `json:"transitions"`
+}
+
+// backtestResults is the JSON of an InfluxDB response queried with epoch ns
+type backtestResults []struct {
+	Error  string `json:"error"`
+	Series []struct {
+		Tags    map[string]string `json:"tags"`
+		Columns []string          `json:"columns"`
+		Values  [][]interface{}   `json:"values"`
+	} `json:"series"`
+}
+
+// Series converts the results into the data of a rule. The value of a row
+// is its value column or, for the counts of deadman rules, the greatest of
+// its columns.
+func (r backtestResults) Series() ([]kapa.BacktestSeries, error) {
+	series := []kapa.BacktestSeries{}
+	for _, res := range r {
+		if res.Error != "" {
+			return nil, errors.New(res.Error)
+		}
+		for _, s := range res.Series {
+			bs := kapa.BacktestSeries{Tags: s.Tags}
+			for _, row := range s.Values {
+				if len(row) != len(s.Columns) {
+					return nil, fmt.Errorf("expected %d columns, got %d", len(s.Columns), len(row))
+				}
+
+				var p kapa.BacktestPoint
+				var ok bool
+				for i, col := range s.Columns {
+					n, isNumber := row[i].(json.Number)
+					if !isNumber {
+						continue
+					}
+					if col == "time" {
+						ns, err := n.Int64()
+						if err != nil {
+							return nil, err
+						}
+						p.Time = time.Unix(0, ns).UTC()
+						continue
+					}
+					v, err := n.Float64()
+					if err != nil {
+						return nil, err
+					}
+					if col == "value" || !ok || v > p.Value {
+						p.Value, ok = v, true
+					}
+					if col == "value" {
+						break
+					}
+				}
+				if ok {
+					bs.Points = append(bs.Points, p)
+				}
+			}
+			series = append(series, bs)
+		}
+	}
+	return series, nil
+}
+
+// Backtest evaluates an alert rule against the history of a source, without
+// kapacitor, returning the alerts the rule would have raised.
+func (s *Service) Backtest(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	var req backtestRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err = req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	query, err := kapa.BacktestQuery(req.Rule, req.Start, req.End)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	src, err := s.Store.Sources(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	ts, err := s.TimeSeries(src)
+	if err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", id, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+	if err = ts.Connect(ctx, &src); err != nil {
+		msg := fmt.Sprintf("Unable to connect to source %d: %v", id, err)
+		Error(w, http.StatusBadRequest, msg, s.Logger)
+		return
+	}
+
+	res, err := ts.Query(ctx, cloudhub.Query{
+		Command: query,
+		DB:      req.Rule.Query.Database,
+		RP:      req.Rule.Query.RetentionPolicy,
+		Epoch:   "ns",
+	})
+	if err != nil {
+		if err == cloudhub.ErrUpstreamTimeout {
+			Error(w, http.StatusRequestTimeout, "Timeout waiting for Influx response", s.Logger)
+			return
+		}
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	octets, err := res.MarshalJSON()
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	var results backtestResults
+	d := json.NewDecoder(bytes.NewReader(octets))
+	d.UseNumber()
+	if err := d.Decode(&results); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	series, err := results.Series()
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	transitions, err := kapa.Backtest(req.Rule, series, req.Start, req.End)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	resp := backtestResponse{
+		Query:       query,
+		Start:       req.Start,
+		End:         req.End,
+		Series:      len(series),
+		Counts:      map[string]int{},
+		Transitions: transitions,
+	}
+	for _, s := range series {
+		resp.Points += len(s.Points)
+	}
+	alerts := map[string]bool{}
+	for _, t := range transitions {
+		resp.Counts[t.Level]++
+		if t.Level == cloudhub.AlertLevelCritical {
+			alerts[t.ID] = true
+		}
+	}
+	resp.Alerts = len(alerts)
+	encodeJSON(w, http.StatusOK, resp, s.Logger)
+}
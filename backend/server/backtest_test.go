@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_Backtest(t *testing.T) {
+	const rule = `{
+		"name": "cpu",
+		"trigger": "threshold",
+		"values": {"operator": "greater than", "value": "90"},
+		"every": "1m",
+		"query": {
+			"database": "telegraf",
+			"retentionPolicy": "autogen",
+			"measurement": "cpu",
+			"fields": [{"value": "mean", "type": "func", "args": [{"value": "usage_user", "type": "field"}]}],
+			"groupBy": {"time": "1m", "tags": ["host"]},
+			"tags": {},
+			"areTagsAccepted": true
+		}
+	}`
+	// 2023-04-01T00:00:00Z and the three minutes after it
+	const influx = `[{"series": [
+		{"name": "cpu", "tags": {"host": "web1"}, "columns": ["time", "value"], "values": [
+			[1680307200000000000, 95], [1680307260000000000, 10], [1680307320000000000, 91.5]
+		]},
+		{"name": "cpu", "tags": {"host": "web2"}, "columns": ["time", "value"], "values": [
+			[1680307200000000000, 5], [1680307260000000000, null]
+		]}
+	]}]`
+
+	tests := []struct {
+		name        string
+		body        string
+		influx      string
+		wantStatus  int
+		wantCounts  map[string]int
+		wantAlerts  int
+		wantQueried bool
+	}{
+		{
+			name:        "Fires and recovers",
+			body:        `{"rule": ` + rule + `, "start": "2023-04-01T00:00:00Z", "end": "2023-04-01T01:00:00Z"}`,
+			influx:      influx,
+			wantStatus:  http.StatusOK,
+			wantCounts:  map[string]int{"CRITICAL": 2, "OK": 1},
+			wantAlerts:  1,
+			wantQueried: true,
+		},
+		{
+			name:       "Influx error",
+			body:       `{"rule": ` + rule + `, "start": "2023-04-01T00:00:00Z", "end": "2023-04-01T01:00:00Z"}`,
+			influx:     `[{"error": "database not found: telegraf"}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "End before start",
+			body:       `{"rule": ` + rule + `, "start": "2023-04-01T01:00:00Z", "end": "2023-04-01T00:00:00Z"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Range too long",
+			body:       `{"rule": ` + rule + `, "start": "2023-01-01T00:00:00Z", "end": "2023-04-02T00:00:00Z"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Invalid rule",
+			body:       `{"rule": {"name": "cpu", "trigger": "sometimes", "query": {"database": "telegraf"}}, "start": "2023-04-01T00:00:00Z", "end": "2023-04-01T01:00:00Z"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queried cloudhub.Query
+			s := &Service{
+				Store: &mocks.Store{
+					SourcesStore: &mocks.SourcesStore{
+						GetF: func(ctx context.Context, ID int) (cloudhub.Source, error) {
+							return cloudhub.Source{ID: ID}, nil
+						},
+					},
+				},
+				TimeSeriesClient: &mocks.TimeSeries{
+					ConnectF: func(context.Context, *cloudhub.Source) error {
+						return nil
+					},
+					QueryF: func(ctx context.Context, q cloudhub.Query) (cloudhub.Response, error) {
+						queried = q
+						return mocks.NewResponse(tt.influx, nil), nil
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/sources/1/backtest", strings.NewReader(tt.body))
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+			}))
+			s.Backtest(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Backtest() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if queried.DB != "telegraf" || queried.RP != "autogen" || queried.Epoch != "ns" {
+				t.Errorf("Backtest() queried %+v", queried)
+			}
+
+			var res backtestResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Series != 2 || res.Points != 4 {
+				t.Errorf("Backtest() evaluated %d series of %d points, want 2 of 4", res.Series, res.Points)
+			}
+			if res.Alerts != tt.wantAlerts || mustMarshal(t, res.Counts) != mustMarshal(t, tt.wantCounts) {
+				t.Errorf("Backtest() alerts = %d, counts = %v, want %d, %v", res.Alerts, res.Counts, tt.wantAlerts, tt.wantCounts)
+			}
+			for _, tr := range res.Transitions {
+				if tr.ID != "cpu-host=web1" {
+					t.Errorf("Backtest() transition of %s", tr.ID)
+				}
+			}
+		})
+	}
+}
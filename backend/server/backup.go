@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Snapshotter writes a backup archive of every bucket of the store, read
+// at the same point in time, as it reads them
+type Snapshotter interface {
+	WriteBackup(ctx context.Context, w io.Writer, createdAt time.Time) (int64, error)
+}
+
+// Backup streams a backup archive of the whole store, which cloudhubctl
+// restore writes back to a bolt or etcd store
+func (s *Service) Backup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.Backups == nil {
+		Error(w, http.StatusNotFound, "backups are not supported by this store", s.Logger)
+		return
+	}
+
+	createdAt := s.now().UTC()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="cloudhub-backup-%s.tar.gz"`, createdAt.Format("20060102T150405Z")))
+	n, err := s.Backups.WriteBackup(ctx, w, createdAt)
+	if err != nil && n == 0 {
+		w.Header().Del("Content-Disposition")
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	if err != nil {
+		// the archive is cut short, which its reader notices
+		s.Logger.
+			WithField("component", "backup").
+			Error(err.Error())
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgBackupDownloaded.String(), createdAt.Format(time.RFC3339))
+	s.logChange(ctx, "Backup", msg, nil, nil)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+type snapshotterF func(ctx context.Context, w io.Writer, createdAt time.Time) (int64, error)
+
+func (f snapshotterF) WriteBackup(ctx context.Context, w io.Writer, createdAt time.Time) (int64, error) {
+	return f(ctx, w, createdAt)
+}
+
+func TestService_Backup(t *testing.T) {
+	tests := []struct {
+		name       string
+		backups    Snapshotter
+		wantStatus int
+		wantBody   string
+		wantAudit  bool
+	}{
+		{
+			name: "backup of the store",
+			backups: snapshotterF(func(ctx context.Context, w io.Writer, createdAt time.Time) (int64, error) {
+				n, err := io.WriteString(w, "archive")
+				return int64(n), err
+			}),
+			wantStatus: http.StatusOK,
+			wantBody:   "archive",
+			wantAudit:  true,
+		},
+		{
+			name: "store cannot be read",
+			backups: snapshotterF(func(ctx context.Context, w io.Writer, createdAt time.Time) (int64, error) {
+				return 0, errors.New("bucket is on fire")
+			}),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "store fails part way",
+			backups: snapshotterF(func(ctx context.Context, w io.Writer, createdAt time.Time) (int64, error) {
+				n, _ := io.WriteString(w, "arch")
+				return int64(n), errors.New("bucket is on fire")
+			}),
+			wantStatus: http.StatusOK,
+			wantBody:   "arch",
+		},
+		{
+			name:       "store without backups",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var audited []cloudhub.AuditEvent
+			s := &Service{
+				Store: &mocks.Store{
+					AuditStore: &mocks.AuditStore{
+						AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+							audited = append(audited, *e)
+							return e, nil
+						},
+					},
+				},
+				Logger:  log.New(log.DebugLevel),
+				Backups: tt.backups,
+			}
+
+			ctx := context.WithValue(context.Background(), UserContextKey, &cloudhub.User{Name: "doc", SuperAdmin: true})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/backup", nil).WithContext(ctx)
+			s.Backup(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Backup() = %d %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if (len(audited) == 1) != tt.wantAudit {
+				t.Errorf("Backup() audited %v", audited)
+			}
+			if w.Code != http.StatusOK {
+				if cd := w.Header().Get("Content-Disposition"); cd != "" {
+					t.Errorf("Backup() failed with Content-Disposition %q", cd)
+				}
+				return
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("Backup() body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
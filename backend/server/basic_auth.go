@@ -4,9 +4,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/hmac"
-	"crypto/sha512"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,6 +17,7 @@ import (
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/passwd"
 )
 
 type emailKey string
@@ -50,6 +48,8 @@ type loginRequest struct {
 
 type loginResponse struct {
 	PasswordResetFlag string `json:"passwordResetFlag"`
+	TwoFactor         string `json:"twoFactor,omitempty"`      // TwoFactor is the step required before a session is issued
+	TwoFactorToken    string `json:"twoFactorToken,omitempty"` // TwoFactorToken carries the accepted password over to the TOTP step
 }
 
 type resetResponse struct {
@@ -146,6 +146,12 @@ func (s *Service) UserPwdReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// setting smtp server option (user call)
+	if s.Mailer != nil && !pwrtnBool {
+		s.mailResetLink(ctx, w, user, pwrtn)
+		return
+	}
+
 	// The id of kapacitor set as server option is 0
 	id := 0
 	serverKapacitor, err := s.Store.Servers(ctx).Get(ctx, id)
@@ -159,7 +165,12 @@ func (s *Service) UserPwdReset(w http.ResponseWriter, r *http.Request) {
 		resetPassword := randResetPassword()
 
 		user.PasswordResetFlag = "Y"
-		user.Passwd = getPasswordToSHA512(resetPassword, SecretKey)
+		hash, err := hashPassword(resetPassword)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		user.Passwd = hash
 		user.RetryCount = 0
 		user.Locked = false
 		user.LockedTime = ""
@@ -205,7 +216,12 @@ func (s *Service) UserPwdReset(w http.ResponseWriter, r *http.Request) {
 		}
 
 		user.PasswordResetFlag = "Y"
-		user.Passwd = getPasswordToSHA512(resetPassword, SecretKey)
+		hash, err := hashPassword(resetPassword)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		user.Passwd = hash
 		user.RetryCount = 0
 		user.Locked = false
 		user.LockedTime = ""
@@ -314,7 +330,12 @@ func (s *Service) UserPwdReset(w http.ResponseWriter, r *http.Request) {
 		}
 
 		user.PasswordResetFlag = "Y"
-		user.Passwd = getPasswordToSHA512(resetPassword, SecretKey)
+		hash, err := hashPassword(resetPassword)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		user.Passwd = hash
 		user.RetryCount = 0
 		user.Locked = false
 		user.LockedTime = ""
@@ -420,12 +441,6 @@ func (s *Service) Login(auth oauth2.Authenticator, basePath string) http.Handler
 			}
 		}
 
-		orgID := "default"
-		for _, role := range user.Roles {
-			orgID = role.Organization
-			break
-		}
-
 		if user.Passwd == "" {
 			msg := fmt.Sprintf(MsgEmptyPassword.String())
 			s.logRegistration(ctx, "Login", msg, user.Name)
@@ -433,60 +448,56 @@ func (s *Service) Login(auth oauth2.Authenticator, basePath string) http.Handler
 			return
 		}
 
-		strTohex, err := hex.DecodeString(user.Passwd)
-		if err != nil {
-			Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
-			return
-		}
-
-		// valid password - sha512
-		isValid := false
+		// the digest of the password is what the stored hash is made of
+		digest := ""
 		if req.IsEncoded == "" || strings.ToLower(req.IsEncoded) == "false" {
-			isValid = validPassword([]byte(req.Password), strTohex, []byte(SecretKey))
+			digest = getPasswordToSHA512(req.Password, SecretKey)
 		} else if strings.ToLower(req.IsEncoded) == "true" {
-			isValid = validEncodedPassword(req.Password, strTohex)
+			digest = req.Password
 		} else {
 			invalidData(w, fmt.Errorf("isEncoded must be true or false"), s.Logger)
 			return
 		}
 
-		// valid password - sha512
+		isValid, rehash, err := passwd.Verify(user.Passwd, digest)
+		if err != nil {
+			Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+			return
+		}
+
 		if !isValid {
 			msg := fmt.Sprintf(MsgDifferentPassword.String())
 			s.logRegistration(ctx, "Login", msg, user.Name)
 
-			retryCnt, err := strconv.Atoi(s.RetryPolicy["count"])
-			httpCode := http.StatusUnauthorized
-			errMsg := "Passwords do not match."
-
-			if err == nil {
-				user.RetryCount++
-				if user.RetryCount >= int32(retryCnt) {
-					user.Locked = true
-					user.LockedTime = getNowDate()
-					httpCode = http.StatusLocked
-					errMsg += "Login is locked."
-				}
+			s.loginFailed(ctx, w, user, "Passwords do not match.")
+			return
+		}
 
-				err := s.Store.Users(ctx).Update(ctx, user)
-				if err == nil && user.Locked {
-					msg := fmt.Sprintf(MsgRetryCountOver.String(), user.Name)
-					s.logRegistration(ctx, "Retry", msg, user.Name)
+		// upgrade legacy hashes now that the password is known to match
+		if rehash {
+			if hash, err := passwd.Hash(digest); err != nil {
+				s.Logger.Error("Unable to rehash password of ", user.Name, ": ", err)
+			} else {
+				user.Passwd = hash
+				if err := s.Store.Users(ctx).Update(ctx, user); err != nil {
+					s.Logger.Error("Unable to store rehashed password of ", user.Name, ": ", err)
 				}
 			}
-
-			ErrorBasic(w, httpCode, errMsg, user.RetryCount, user.LockedTime, user.Locked, s.Logger)
-			return
 		}
 
-		principal := oauth2.Principal{
-			Subject:      user.Name,
-			Issuer:       BasicProvider,
-			Organization: orgID,
-			Group:        "",
-		}
+		principal := basicPrincipal(user)
 
 		if user.PasswordResetFlag == "N" {
+			step, err := s.twoFactorStep(ctx, user)
+			if err != nil {
+				unknownErrorWithMessage(w, err, s.Logger)
+				return
+			}
+			if step != "" {
+				s.requireTOTP(ctx, w, user, step)
+				return
+			}
+
 			if err := auth.Authorize(ctx, w, principal); err != nil {
 				Error(w, http.StatusInternalServerError, fmt.Sprintf("Failed auth.Authorize: %v, %v", err, principal), s.Logger)
 				return
@@ -515,16 +526,59 @@ func (s *Service) Login(auth oauth2.Authenticator, basePath string) http.Handler
 	}
 }
 
+// loginFailed counts a failed login against the retry policy, locking the
+// user when the retries run out, and writes the error response.
+func (s *Service) loginFailed(ctx context.Context, w http.ResponseWriter, user *cloudhub.User, errMsg string) {
+	retryCnt, err := strconv.Atoi(s.RetryPolicy["count"])
+	httpCode := http.StatusUnauthorized
+
+	if err == nil {
+		user.RetryCount++
+		if user.RetryCount >= int32(retryCnt) {
+			user.Locked = true
+			user.LockedTime = getNowDate()
+			httpCode = http.StatusLocked
+			errMsg += "Login is locked."
+		}
+
+		err := s.Store.Users(ctx).Update(ctx, user)
+		if err == nil && user.Locked {
+			msg := fmt.Sprintf(MsgRetryCountOver.String(), user.Name)
+			s.logRegistration(ctx, "Retry", msg, user.Name)
+		}
+	}
+
+	ErrorBasic(w, httpCode, errMsg, user.RetryCount, user.LockedTime, user.Locked, s.Logger)
+}
+
+// basicPrincipal returns the session principal of a basic user, in the first
+// organization they have a role in.
+func basicPrincipal(user *cloudhub.User) oauth2.Principal {
+	orgID := "default"
+	for _, role := range user.Roles {
+		orgID = role.Organization
+		break
+	}
+
+	return oauth2.Principal{
+		Subject:      user.Name,
+		Issuer:       BasicProvider,
+		Organization: orgID,
+		Group:        "",
+	}
+}
+
 // Logout provider=cloudhub
 func (s *Service) Logout(auth oauth2.Authenticator, basePath string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := serverContext(r.Context())
 		principal, err := auth.Validate(ctx, r)
 		if err == nil {
+			scheme := principalScheme(principal)
 			user, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{
 				Name:     &principal.Subject,
-				Provider: &BasicProvider,
-				Scheme:   &BasicScheme,
+				Provider: &principal.Issuer,
+				Scheme:   &scheme,
 			})
 
 			if user == nil || err != nil {
@@ -540,20 +594,6 @@ func (s *Service) Logout(auth oauth2.Authenticator, basePath string) http.Handle
 	}
 }
 
-func validPassword(reqPassword, hashPassword, key []byte) bool {
-	mac := hmac.New(sha512.New, key)
-	mac.Write(reqPassword)
-	expectedPassword := mac.Sum(nil)
-
-	return hmac.Equal(hashPassword, expectedPassword)
-}
-
-func validEncodedPassword(reqPassword string, hashPassword []byte) bool {
-	strTohex, _ := hex.DecodeString(reqPassword)
-
-	return hmac.Equal(hashPassword, strTohex)
-}
-
 func randResetPassword() string {
 	chars := []rune("ABCDEFGHJKMNOPQRSTUVWXYZabcdefghjkmnopqrstuvwxyz0123456789")
 	length := 8
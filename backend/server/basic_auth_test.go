@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/passwd"
+)
+
+func TestService_Login_PasswordHash(t *testing.T) {
+	legacy := getPasswordToSHA512("hoverboard", SecretKey)
+	argon, err := hashPassword("hoverboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		stored     string
+		body       string
+		wantStatus int
+		wantRehash bool
+	}{
+		{
+			name:       "Legacy hash is upgraded",
+			stored:     legacy,
+			body:       `{"name":"marty","password":"hoverboard"}`,
+			wantStatus: http.StatusOK,
+			wantRehash: true,
+		},
+		{
+			name:       "Legacy hash with encoded password is upgraded",
+			stored:     legacy,
+			body:       `{"name":"marty","password":"` + strings.ToUpper(legacy) + `","isEncoded":"true"}`,
+			wantStatus: http.StatusOK,
+			wantRehash: true,
+		},
+		{
+			name:       "Legacy hash with wrong password",
+			stored:     legacy,
+			body:       `{"name":"marty","password":"delorean"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "argon2id hash",
+			stored:     argon,
+			body:       `{"name":"marty","password":"hoverboard"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "argon2id hash with encoded password",
+			stored:     argon,
+			body:       `{"name":"marty","password":"` + legacy + `","isEncoded":"true"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "argon2id hash with wrong password",
+			stored:     argon,
+			body:       `{"name":"marty","password":"delorean"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &cloudhub.User{
+				ID:                1,
+				Name:              "marty",
+				Passwd:            tt.stored,
+				Provider:          BasicProvider,
+				Scheme:            BasicScheme,
+				PasswordResetFlag: "N",
+			}
+			s := &Service{
+				Store: &mocks.Store{
+					UsersStore: &mocks.UsersStore{
+						GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+							u := *user
+							return &u, nil
+						},
+						UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+							*user = *u
+							return nil
+						},
+					},
+				},
+				Logger:      log.New(log.DebugLevel),
+				RetryPolicy: map[string]string{},
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/basic/login", bytes.NewBufferString(tt.body))
+			s.Login(&recordingAuthenticator{}, "")(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Login() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if rehashed := user.Passwd != tt.stored; rehashed != tt.wantRehash {
+				t.Fatalf("Login() rehashed = %v, want %v", rehashed, tt.wantRehash)
+			}
+			if tt.wantRehash && passwd.IsLegacy(user.Passwd) {
+				t.Errorf("Login() stored %s", user.Passwd)
+			}
+			if ok, _, _ := passwd.Verify(user.Passwd, legacy); !ok {
+				t.Errorf("Login() stored a hash that does not verify the password")
+			}
+		})
+	}
+}
@@ -251,6 +251,7 @@ func (s *Service) DashboardCells(w http.ResponseWriter, r *http.Request) {
 
 	boards := newDashboardResponse(e)
 	cells := boards.Cells
+	setETag(w, e.Revision)
 	encodeJSON(w, http.StatusOK, cells, s.Logger)
 }
 
@@ -297,7 +298,7 @@ func (s *Service) NewDashboardCell(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardCellCreated.String(), cell.Name, dash.Name)
-	s.logRegistration(ctx, "Dashboards Cells", msg)
+	s.logChange(ctx, "Dashboards Cells", msg, nil, cell)
 
 	boards := newDashboardResponse(dash)
 	for _, cell := range boards.Cells {
@@ -327,6 +328,7 @@ func (s *Service) DashboardCellID(w http.ResponseWriter, r *http.Request) {
 	cid := httprouter.GetParamFromContext(ctx, "cid")
 	for _, cell := range boards.Cells {
 		if cell.ID == cid {
+			setETag(w, dash.Revision)
 			encodeJSON(w, http.StatusOK, cell, s.Logger)
 			return
 		}
@@ -373,7 +375,7 @@ func (s *Service) RemoveDashboardCell(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardCellDeleted.String(), dashCell.Name, dash.Name)
-	s.logRegistration(ctx, "Dashboards Cells", msg)
+	s.logChange(ctx, "Dashboards Cells", msg, dashCell, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -392,6 +394,10 @@ func (s *Service) ReplaceDashboardCell(w http.ResponseWriter, r *http.Request) {
 		notFound(w, id, s.Logger)
 		return
 	}
+	if ctx, err = ifMatch(ctx, r, dash.Revision); err != nil {
+		revisionConflict(w, r, s.Logger)
+		return
+	}
 
 	cid := httprouter.GetParamFromContext(ctx, "cid")
 	cellid := -1
@@ -428,7 +434,10 @@ func (s *Service) ReplaceDashboardCell(w http.ResponseWriter, r *http.Request) {
 	cell.ID = cid
 
 	dash.Cells[cellid] = cell
-	if err := s.Store.Dashboards(ctx).Update(ctx, dash); err != nil {
+	if err := s.Store.Dashboards(ctx).Update(ctx, dash); err == cloudhub.ErrRevisionMismatch {
+		revisionConflict(w, r, s.Logger)
+		return
+	} else if err != nil {
 		msg := fmt.Sprintf("Error updating cell %s in dashboard %d: %v", cid, id, err)
 		Error(w, http.StatusInternalServerError, msg, s.Logger)
 		return
@@ -436,8 +445,9 @@ func (s *Service) ReplaceDashboardCell(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardCellModified.String(), dashCell.Name, dash.Name)
-	s.logRegistration(ctx, "Dashboards Cells", msg)
+	s.logChange(ctx, "Dashboards Cells", msg, dashCell, cell)
 
 	res := newCellResponse(dash.ID, cell)
+	setETag(w, dash.Revision+1)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
@@ -100,6 +100,7 @@ func (s *Service) ReplaceAuthConfig(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, "Configuration object was nil", s.Logger)
 		return
 	}
+	before := config.Auth
 	config.Auth = authConfig
 
 	res := newAuthConfigResponse(*config)
@@ -110,7 +111,7 @@ func (s *Service) ReplaceAuthConfig(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgSuperAdminNewUserModified.String())
-	s.logRegistration(ctx, "SuperAdminNewUsers", msg)
+	s.logChange(ctx, "SuperAdminNewUsers", msg, before, config.Auth)
 
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseCron(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) error = nil, want an error", expr)
+		}
+	}
+}
+
+func Test_cronSchedule_next(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2023-04-01 is a Saturday
+	from := time.Date(2023, 4, 1, 10, 30, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2023, 4, 1, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", from.Truncate(time.Minute), time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2023, 4, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * 1-5", from, time.Date(2023, 4, 3, 2, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", from, time.Date(2023, 4, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", from, time.Date(2023, 4, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 22 * * 7", from, time.Date(2023, 4, 2, 22, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 2 * * *", from.In(seoul), time.Date(2023, 4, 2, 2, 0, 0, 0, seoul)},
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) error = %v", tt.expr, err)
+		}
+		if got := s.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("next(%q, %v) = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
@@ -180,7 +180,7 @@ func (s *Service) NewCSP(w http.ResponseWriter, r *http.Request) {
 	switch csp.Provider {
 	case cloudhub.OSP:
 		// It does not need to call generateSaltConfigForOSP no longer.
-		// statusCode, resp, err := s.generateSaltConfigForOSP(csp)
+		// statusCode, resp, err := s.generateSaltConfigForOSP(ctx, csp)
 		// if err != nil {
 		// 	unknownErrorWithMessage(w, err, s.Logger)
 		// 	return
@@ -201,7 +201,7 @@ func (s *Service) NewCSP(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgCSPCreated.String(), res.Provider)
-	s.logRegistration(ctx, "CSP", msg)
+	s.logChange(ctx, "CSP", msg, nil, *res)
 
 	resCSP := newCSPResponse(res)
 	location(w, resCSP.Links.Self)
@@ -226,7 +226,7 @@ func (s *Service) RemoveCSP(w http.ResponseWriter, r *http.Request) {
 	// If the provider is osp, remove firstly the salt and telegraf config.
 	switch csp.Provider {
 	case cloudhub.OSP:
-		statusCode, resp, err := s.removeSaltConfigForOSP(csp)
+		statusCode, resp, err := s.removeSaltConfigForOSP(ctx, csp)
 		if err != nil {
 			unknownErrorWithMessage(w, err, s.Logger)
 			return
@@ -235,7 +235,7 @@ func (s *Service) RemoveCSP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		statusCode, resp, err = s.removeTelegrafConfigForOSP(csp)
+		statusCode, resp, err = s.removeTelegrafConfigForOSP(ctx, csp)
 		if err != nil {
 			unknownErrorWithMessage(w, err, s.Logger)
 			return
@@ -252,7 +252,7 @@ func (s *Service) RemoveCSP(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgCSPDeleted.String(), csp.Provider)
-	s.logRegistration(ctx, "CSP", msg)
+	s.logChange(ctx, "CSP", msg, *csp, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -288,6 +288,7 @@ func (s *Service) UpdateCSP(w http.ResponseWriter, r *http.Request) {
 		notFound(w, id, s.Logger)
 		return
 	}
+	before := *oriCSP
 
 	if req.NameSpace != "" {
 		oriCSP.NameSpace = req.NameSpace
@@ -310,7 +311,7 @@ func (s *Service) UpdateCSP(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgCSPModified.String(), oriCSP.Provider)
-	s.logRegistration(ctx, "CSP", msg)
+	s.logChange(ctx, "CSP", msg, before, *oriCSP)
 
 	res := newCSPResponse(oriCSP)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -333,20 +334,20 @@ func (s *Service) existsCSPInOrg(ctx context.Context, provider string, namespace
 }
 
 // Deprecated: It does not need to call generateSaltConfigForOSP no longer.
-func (s *Service) generateSaltConfigForOSP(csp *cloudhub.CSP) (int, []byte, error) {
+func (s *Service) generateSaltConfigForOSP(ctx context.Context, csp *cloudhub.CSP) (int, []byte, error) {
 	fileName := fmt.Sprintf("osp_%s.conf", csp.NameSpace)
 	saltConfigPath := path.Join(s.AddonURLs["salt-env-path"], "etc/salt/cloud.providers.d", fileName)
 	authURLforSalt := strings.TrimRight(s.OSP.AuthURL, "/") + "/v3"
 	textYaml := fmt.Sprintf("%s:\n  driver: openstack\n  region_name: RegionOne\n  auth:\n    username: '%s'\n    password: '%s'\n    project_name: '%s'\n    user_domain_name: %s\n    project_domain_name: %s\n    auth_url: '%s'", csp.NameSpace, s.OSP.AdminUser, s.OSP.AdminPW, csp.NameSpace, s.OSP.UserDomain, s.OSP.ProjectDomain, authURLforSalt)
 
-	return s.CreateFile(saltConfigPath, []string{textYaml})
+	return saltJobResult(s.CreateFile(ctx, saltConfigPath, []string{textYaml}))
 }
 
-func (s *Service) removeSaltConfigForOSP(csp *cloudhub.CSP) (int, []byte, error) {
+func (s *Service) removeSaltConfigForOSP(ctx context.Context, csp *cloudhub.CSP) (int, []byte, error) {
 	fileName := fmt.Sprintf("osp_%s.conf", csp.NameSpace)
 	path := path.Join(s.AddonURLs["salt-env-path"], "etc/salt/cloud.providers.d", fileName)
 
-	return s.RemoveFile(path)
+	return saltJobResult(s.RemoveFile(ctx, path))
 }
 
 type telegrafConfig struct {
@@ -410,8 +411,8 @@ func (s *Service) generateTelegrafConfigForOSP(ctx context.Context, csp *cloudhu
 			}
 
 			if !r.Return[0][s.AddonTokens["osp"]] {
-				if statusCode, _, err := s.MkdirWithLocalClient(dirPath, s.AddonTokens["osp"]); err != nil || statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
-					return statusCode, nil, err
+				if _, err := s.MkdirWithLocalClient(ctx, dirPath, s.AddonTokens["osp"]); err != nil {
+					return http.StatusInternalServerError, nil, err
 				}
 			}
 		} else {
@@ -430,8 +431,8 @@ func (s *Service) generateTelegrafConfigForOSP(ctx context.Context, csp *cloudhu
 			}
 
 			if !r.Return[0] {
-				if statusCode, _, err := s.Mkdir(dirPath); err != nil || statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
-					return statusCode, nil, err
+				if _, err := s.Mkdir(ctx, dirPath); err != nil {
+					return http.StatusInternalServerError, nil, err
 				}
 			}
 		} else {
@@ -493,9 +494,9 @@ func (s *Service) generateTelegrafConfigForOSP(ctx context.Context, csp *cloudhu
 	b, _ := toml.Marshal(telegrafConfig)
 
 	if useLocalModule {
-		statusCode, resp, err = s.CreateFileWithLocalClient(filePath, []string{string(b)}, s.AddonTokens["osp"])
+		statusCode, resp, err = saltJobResult(s.CreateFileWithLocalClient(ctx, filePath, []string{string(b)}, s.AddonTokens["osp"]))
 	} else {
-		statusCode, resp, err = s.CreateFile(filePath, []string{string(b)})
+		statusCode, resp, err = saltJobResult(s.CreateFile(ctx, filePath, []string{string(b)}))
 	}
 
 	if err != nil {
@@ -504,10 +505,10 @@ func (s *Service) generateTelegrafConfigForOSP(ctx context.Context, csp *cloudhu
 		return statusCode, resp, err
 	}
 
-	return s.DaemonReload("telegraf.service")
+	return saltJobResult(s.DaemonReload(ctx, "telegraf.service"))
 }
 
-func (s *Service) removeTelegrafConfigForOSP(csp *cloudhub.CSP) (int, []byte, error) {
+func (s *Service) removeTelegrafConfigForOSP(ctx context.Context, csp *cloudhub.CSP) (int, []byte, error) {
 	fileName := fmt.Sprintf("%s.conf", csp.NameSpace)
 	dirPath := "/etc/telegraf/telegraf.d/tenant/osp"
 	filePath := path.Join(dirPath, fileName)
@@ -520,9 +521,9 @@ func (s *Service) removeTelegrafConfigForOSP(csp *cloudhub.CSP) (int, []byte, er
 	}
 
 	if useLocalModule {
-		statusCode, resp, err = s.RemoveFileWithLocalClient(filePath, s.AddonTokens["osp"])
+		statusCode, resp, err = saltJobResult(s.RemoveFileWithLocalClient(ctx, filePath, s.AddonTokens["osp"]))
 	} else {
-		statusCode, resp, err = s.RemoveFile(filePath)
+		statusCode, resp, err = saltJobResult(s.RemoveFile(ctx, filePath))
 	}
 
 	if err != nil {
@@ -531,7 +532,7 @@ func (s *Service) removeTelegrafConfigForOSP(csp *cloudhub.CSP) (int, []byte, er
 		return statusCode, resp, err
 	}
 
-	return s.DaemonReload("telegraf.service")
+	return saltJobResult(s.DaemonReload(ctx, "telegraf.service"))
 }
 
 // IsMinionActive checks if the specified minion is active by sending a ping request.
@@ -1223,7 +1223,7 @@ func TestService_generateSaltConfigForOSP(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			statusCode, resp, err := tt.s.generateSaltConfigForOSP(tt.csp)
+			statusCode, resp, err := tt.s.generateSaltConfigForOSP(context.Background(), tt.csp)
 			if err != nil {
 				t.Errorf("Service.generateSaltConfigForOSP() error = %v\n", err)
 			} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
@@ -1262,7 +1262,7 @@ func TestService_removeSaltConfigForOSP(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			statusCode, resp, err := tt.s.removeSaltConfigForOSP(tt.csp)
+			statusCode, resp, err := tt.s.removeSaltConfigForOSP(context.Background(), tt.csp)
 			if err != nil {
 				t.Errorf("Service.removeSaltConfigForOSP() error = %v\n", err)
 			} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
@@ -1378,7 +1378,7 @@ func TestService_removeTelegrafConfigForOSP(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			statusCode, resp, err := tt.s.removeTelegrafConfigForOSP(tt.csp)
+			statusCode, resp, err := tt.s.removeTelegrafConfigForOSP(context.Background(), tt.csp)
 			if err != nil {
 				t.Errorf("Service.removeTelegrafConfigForOSP() error = %v\n", err)
 			} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// dashboardBundleVersion is the version of the export format. Imports of
+// any other version are rejected.
+const dashboardBundleVersion = 1
+
+// dashboardBundle is a self-contained export of a dashboard that can be
+// imported into another CloudHub. Sources are described by name and type
+// because their IDs differ between instances.
+type dashboardBundle struct {
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exportedAt"`
+	Dashboard  cloudhub.Dashboard `json:"dashboard"`
+	Sources    []bundleSource     `json:"sources"`
+}
+
+// bundleSource is a source referenced by the queries of a bundled dashboard
+type bundleSource struct {
+	ID   string `json:"id"`   // ID of the source in the exporting CloudHub
+	Link string `json:"link"` // Link is the source URI as it appears in the queries
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+type importDashboardRequest struct {
+	Bundle dashboardBundle `json:"bundle"`
+	// SourceMappings maps the ID or name of a bundled source to the ID of a
+	// source of the current organization. Unmapped sources are matched by name.
+	SourceMappings map[string]string `json:"sourceMappings,omitempty"`
+	// Strict rejects the import if any source cannot be resolved
+	Strict bool `json:"strict,omitempty"`
+}
+
+// resolvedSource reports where a bundled source was mapped to on import
+type resolvedSource struct {
+	bundleSource
+	Target string `json:"target,omitempty"` // Target is the ID of the source the queries now use
+	By     string `json:"by,omitempty"`     // By is either mapping or name
+}
+
+type importDashboardResponse struct {
+	Dashboard  *dashboardResponse `json:"dashboard,omitempty"`
+	Sources    []resolvedSource   `json:"sources"`
+	Unresolved []bundleSource     `json:"unresolved"`
+}
+
+// sourceIDFromLink returns the source ID of a query source link such as
+// /cloudhub/v1/sources/1. A bare ID is accepted as well.
+func sourceIDFromLink(link string) (string, bool) {
+	id := link
+	if i := strings.LastIndex(link, "/sources/"); i >= 0 {
+		id = strings.SplitN(link[i+len("/sources/"):], "/", 2)[0]
+	}
+	if _, err := strconv.Atoi(id); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// ExportDashboard returns a dashboard as a bundle that can be imported into
+// another CloudHub along with the names and types of the sources it queries.
+func (s *Service) ExportDashboard(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	dash, err := s.Store.Dashboards(ctx).Get(ctx, cloudhub.DashboardID(id))
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	bundle := dashboardBundle{
+		Version:    dashboardBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Dashboard:  dash,
+		Sources:    []bundleSource{},
+	}
+	bundle.Dashboard.ID = 0
+	bundle.Dashboard.Organization = ""
+
+	seen := map[string]bool{}
+	for _, cell := range dash.Cells {
+		for _, q := range cell.Queries {
+			if q.Source == "" || seen[q.Source] {
+				continue
+			}
+			seen[q.Source] = true
+
+			src := bundleSource{Link: q.Source}
+			if srcID, ok := sourceIDFromLink(q.Source); ok {
+				src.ID = srcID
+				id, _ := strconv.Atoi(srcID)
+				if found, err := s.Store.Sources(ctx).Get(ctx, id); err == nil {
+					src.Name = found.Name
+					src.Type = found.Type
+				}
+			}
+			bundle.Sources = append(bundle.Sources, src)
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dashboard-%d.json"`, id))
+	encodeJSON(w, http.StatusOK, bundle, s.Logger)
+}
+
+// ImportDashboard creates a dashboard from an exported bundle, pointing its
+// queries at the sources of the current organization.
+func (s *Service) ImportDashboard(w http.ResponseWriter, r *http.Request) {
+	var req importDashboardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if req.Bundle.Version != dashboardBundleVersion {
+		invalidData(w, fmt.Errorf("unsupported dashboard bundle version %d", req.Bundle.Version), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	sources, err := s.Store.Sources(ctx).All(ctx)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	resolved, unresolved := resolveBundleSources(req.Bundle.Sources, req.SourceMappings, sources)
+	res := importDashboardResponse{
+		Sources:    resolved,
+		Unresolved: unresolved,
+	}
+	if req.Strict && len(unresolved) > 0 {
+		encodeJSON(w, http.StatusUnprocessableEntity, res, s.Logger)
+		return
+	}
+
+	links := map[string]string{}
+	for _, src := range resolved {
+		if src.Target != "" {
+			links[src.Link] = fmt.Sprintf("/cloudhub/v1/sources/%s", src.Target)
+		}
+	}
+
+	dashboard := req.Bundle.Dashboard
+	dashboard.ID = 0
+	dashboard.Organization = ""
+	for i, cell := range dashboard.Cells {
+		for j, q := range cell.Queries {
+			// Queries of unresolved sources fall back to the default source
+			cell.Queries[j].Source = links[q.Source]
+		}
+		dashboard.Cells[i] = cell
+	}
+
+	defaultOrg, err := s.Store.Organizations(ctx).DefaultOrganization(ctx)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	if err := ValidDashboardRequest(&dashboard, defaultOrg.ID); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	if dashboard, err = s.Store.Dashboards(ctx).Add(ctx, dashboard); err != nil {
+		msg := fmt.Errorf("Error storing dashboard %v: %v", dashboard, err)
+		unknownErrorWithMessage(w, msg, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgDashboardImported.String(), dashboard.Name)
+	s.logChange(ctx, "Dashboards", msg, nil, dashboard)
+
+	res.Dashboard = newDashboardResponse(dashboard)
+	location(w, res.Dashboard.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// resolveBundleSources maps each bundled source to one of sources, first by
+// the explicit mappings, keyed by bundled source ID or name, then by name.
+func resolveBundleSources(bundled []bundleSource, mappings map[string]string, sources []cloudhub.Source) ([]resolvedSource, []bundleSource) {
+	byID := map[string]cloudhub.Source{}
+	byName := map[string]cloudhub.Source{}
+	for _, src := range sources {
+		byID[strconv.Itoa(src.ID)] = src
+		if _, ok := byName[src.Name]; !ok {
+			byName[src.Name] = src
+		}
+	}
+
+	resolved := []resolvedSource{}
+	unresolved := []bundleSource{}
+	for _, b := range bundled {
+		res := resolvedSource{bundleSource: b}
+
+		target, ok := mappings[b.ID]
+		if !ok && b.Name != "" {
+			target, ok = mappings[b.Name]
+		}
+		if ok {
+			if _, found := byID[target]; found {
+				res.Target, res.By = target, "mapping"
+			}
+		} else if src, found := byName[b.Name]; found && b.Name != "" {
+			res.Target, res.By = strconv.Itoa(src.ID), "name"
+		}
+
+		resolved = append(resolved, res)
+		if res.Target == "" {
+			unresolved = append(unresolved, b)
+		}
+	}
+	return resolved, unresolved
+}
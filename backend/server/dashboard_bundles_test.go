@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_ExportDashboard(t *testing.T) {
+	s := &Service{
+		Store: &mocks.Store{
+			DashboardsStore: &mocks.DashboardsStore{
+				GetF: func(ctx context.Context, id cloudhub.DashboardID) (cloudhub.Dashboard, error) {
+					return cloudhub.Dashboard{
+						ID:           id,
+						Name:         "hosts",
+						Organization: "1337",
+						Cells: []cloudhub.DashboardCell{
+							{
+								Name: "cpu",
+								Queries: []cloudhub.DashboardQuery{
+									{Command: "SELECT 1", Source: "/cloudhub/v1/sources/1"},
+									{Command: "SELECT 2", Source: "/cloudhub/v1/sources/2"},
+								},
+							},
+							{
+								Name: "mem",
+								Queries: []cloudhub.DashboardQuery{
+									{Command: "SELECT 3", Source: "/cloudhub/v1/sources/1"},
+									{Command: "SELECT 4"},
+								},
+							},
+						},
+					}, nil
+				},
+			},
+			SourcesStore: &mocks.SourcesStore{
+				GetF: func(ctx context.Context, id int) (cloudhub.Source, error) {
+					if id != 1 {
+						return cloudhub.Source{}, cloudhub.ErrSourceNotFound
+					}
+					return cloudhub.Source{ID: 1, Name: "influx-prod", Type: "influx", Password: "secret"}, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: "4"}})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/dashboards/4/export", nil).WithContext(ctx)
+	s.ExportDashboard(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ExportDashboard() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("secret")) {
+		t.Fatalf("ExportDashboard() leaked a source secret: %s", w.Body.String())
+	}
+
+	var bundle dashboardBundle
+	if err := json.Unmarshal(w.Body.Bytes(), &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Version != dashboardBundleVersion || bundle.Dashboard.ID != 0 || bundle.Dashboard.Organization != "" {
+		t.Errorf("ExportDashboard() bundle = %+v", bundle)
+	}
+	want := []bundleSource{
+		{ID: "1", Link: "/cloudhub/v1/sources/1", Name: "influx-prod", Type: "influx"},
+		{ID: "2", Link: "/cloudhub/v1/sources/2"},
+	}
+	if fmt.Sprint(bundle.Sources) != fmt.Sprint(want) {
+		t.Errorf("ExportDashboard() sources = %v, want %v", bundle.Sources, want)
+	}
+}
+
+func TestService_ImportDashboard(t *testing.T) {
+	bundle := dashboardBundle{
+		Version: dashboardBundleVersion,
+		Dashboard: cloudhub.Dashboard{
+			Name: "hosts",
+			Cells: []cloudhub.DashboardCell{
+				{
+					Name: "cpu",
+					Queries: []cloudhub.DashboardQuery{
+						{Command: "SELECT 1", Source: "/cloudhub/v1/sources/1"},
+						{Command: "SELECT 2", Source: "/cloudhub/v1/sources/2"},
+					},
+				},
+			},
+		},
+		Sources: []bundleSource{
+			{ID: "1", Link: "/cloudhub/v1/sources/1", Name: "influx-prod", Type: "influx"},
+			{ID: "2", Link: "/cloudhub/v1/sources/2", Name: "influx-logs", Type: "influx"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		mappings       map[string]string
+		strict         bool
+		version        int
+		wantStatus     int
+		wantSources    []string
+		wantUnresolved int
+	}{
+		{
+			name:           "By name",
+			wantStatus:     http.StatusCreated,
+			wantSources:    []string{"/cloudhub/v1/sources/7", ""},
+			wantUnresolved: 1,
+		},
+		{
+			name:        "By mapping table",
+			mappings:    map[string]string{"1": "8", "influx-logs": "7"},
+			wantStatus:  http.StatusCreated,
+			wantSources: []string{"/cloudhub/v1/sources/8", "/cloudhub/v1/sources/7"},
+		},
+		{
+			name:           "Mapping to an unknown source",
+			mappings:       map[string]string{"1": "99"},
+			wantStatus:     http.StatusCreated,
+			wantSources:    []string{"", ""},
+			wantUnresolved: 2,
+		},
+		{
+			name:           "Strict with unresolved sources",
+			strict:         true,
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantUnresolved: 1,
+		},
+		{
+			name:       "Unsupported version",
+			version:    2,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added *cloudhub.Dashboard
+			s := &Service{
+				Store: &mocks.Store{
+					DashboardsStore: &mocks.DashboardsStore{
+						AddF: func(ctx context.Context, d cloudhub.Dashboard) (cloudhub.Dashboard, error) {
+							d.ID = 12
+							added = &d
+							return d, nil
+						},
+					},
+					SourcesStore: &mocks.SourcesStore{
+						AllF: func(ctx context.Context) ([]cloudhub.Source, error) {
+							return []cloudhub.Source{
+								{ID: 7, Name: "influx-prod", Type: "influx"},
+								{ID: 8, Name: "influx-staging", Type: "influx"},
+							}, nil
+						},
+					},
+					OrganizationsStore: &mocks.OrganizationsStore{
+						DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+							return &cloudhub.Organization{ID: "default"}, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			b := bundle
+			b.Dashboard.Cells = []cloudhub.DashboardCell{bundle.Dashboard.Cells[0]}
+			b.Dashboard.Cells[0].Queries = append([]cloudhub.DashboardQuery{}, bundle.Dashboard.Cells[0].Queries...)
+			if tt.version != 0 {
+				b.Version = tt.version
+			}
+			body, _ := json.Marshal(importDashboardRequest{Bundle: b, SourceMappings: tt.mappings, Strict: tt.strict})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/dashboards/import", bytes.NewReader(body))
+			s.ImportDashboard(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ImportDashboard() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.version != 0 {
+				return
+			}
+
+			var res importDashboardResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Unresolved) != tt.wantUnresolved {
+				t.Errorf("ImportDashboard() unresolved = %v, want %d", res.Unresolved, tt.wantUnresolved)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if added != nil {
+					t.Errorf("ImportDashboard() stored a dashboard despite failing")
+				}
+				return
+			}
+
+			var got []string
+			for _, q := range added.Cells[0].Queries {
+				got = append(got, q.Source)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantSources) {
+				t.Errorf("ImportDashboard() query sources = %q, want %q", got, tt.wantSources)
+			}
+			if added.Organization != "default" || w.Header().Get("Location") != "/cloudhub/v1/dashboards/12" {
+				t.Errorf("ImportDashboard() added %+v at %s", added, w.Header().Get("Location"))
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+const maxDashboardRevisionRetention = 100
+
+// revisionedDashboardsStore saves a revision of a dashboard every time
+// the dashboard is created or changed, so that it can be rolled back.
+type revisionedDashboardsStore struct {
+	cloudhub.DashboardsStore
+	revisions cloudhub.DashboardRevisionsStore
+	configs   cloudhub.OrganizationConfigStore
+}
+
+// Add creates a new dashboard and saves it as its first revision. A
+// failure to save the revision does not fail the creation, since the
+// next update saves the current version of a dashboard without revisions.
+func (s *revisionedDashboardsStore) Add(ctx context.Context, d cloudhub.Dashboard) (cloudhub.Dashboard, error) {
+	d, err := s.DashboardsStore.Add(ctx, d)
+	if err != nil {
+		return d, err
+	}
+	_ = s.addRevision(ctx, d, author(ctx))
+	return d, nil
+}
+
+// Delete removes a dashboard along with its revisions
+func (s *revisionedDashboardsStore) Delete(ctx context.Context, d cloudhub.Dashboard) error {
+	if err := s.DashboardsStore.Delete(ctx, d); err != nil {
+		return err
+	}
+	return s.revisions.Delete(ctx, d.ID)
+}
+
+// Update changes a dashboard and saves the change as a new revision in
+// the same transaction. Dashboards created before revisions were kept have
+// their current version saved first so that the update can still be rolled back.
+func (s *revisionedDashboardsStore) Update(ctx context.Context, d cloudhub.Dashboard) error {
+	// the wrapped store ensures the dashboard belongs to the organization
+	cur, err := s.DashboardsStore.Get(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+	return s.revisions.UpdateDashboard(ctx, d, author(ctx), s.retention(ctx, cur.Organization))
+}
+
+func (s *revisionedDashboardsStore) addRevision(ctx context.Context, d cloudhub.Dashboard, author string) error {
+	_, err := s.revisions.Add(ctx, &cloudhub.DashboardRevision{
+		DashboardID: d.ID,
+		Author:      author,
+		Dashboard:   d,
+	}, s.retention(ctx, d.Organization))
+	return err
+}
+
+// retention is the number of revisions the organization keeps per dashboard
+func (s *revisionedDashboardsStore) retention(ctx context.Context, orgID string) int {
+	if s.configs == nil {
+		return cloudhub.DefaultDashboardRevisionRetention
+	}
+	config, err := s.configs.FindOrCreate(ctx, orgID)
+	if err != nil {
+		return cloudhub.DefaultDashboardRevisionRetention
+	}
+	return config.DashboardRevisions.Keep()
+}
+
+func author(ctx context.Context) string {
+	if u, ok := hasUserContext(ctx); ok {
+		return u.Name
+	}
+	return ""
+}
+
+type dashboardRevisionLinks struct {
+	Self    string `json:"self"`    // Self link mapping to this resource
+	Diff    string `json:"diff"`    // Diff link to the diff of this revision against the current dashboard
+	Restore string `json:"restore"` // Restore link to roll the dashboard back to this revision
+}
+
+type dashboardRevisionResponse struct {
+	ID          int                    `json:"id"`
+	DashboardID cloudhub.DashboardID   `json:"dashboardID,string"`
+	Author      string                 `json:"author"`
+	Time        time.Time              `json:"time"`
+	Dashboard   *dashboardResponse     `json:"dashboard,omitempty"`
+	Links       dashboardRevisionLinks `json:"links"`
+}
+
+type dashboardRevisionsResponse struct {
+	Revisions []dashboardRevisionResponse `json:"revisions"`
+	Links     selfLinks                   `json:"links"`
+}
+
+func newDashboardRevisionResponse(rev cloudhub.DashboardRevision, withDashboard bool) dashboardRevisionResponse {
+	base := fmt.Sprintf("/cloudhub/v1/dashboards/%d/revisions/%d", rev.DashboardID, rev.ID)
+	res := dashboardRevisionResponse{
+		ID:          rev.ID,
+		DashboardID: rev.DashboardID,
+		Author:      rev.Author,
+		Time:        rev.Time,
+		Links: dashboardRevisionLinks{
+			Self:    base,
+			Diff:    base + "/diff",
+			Restore: base + "/restore",
+		},
+	}
+	if withDashboard {
+		res.Dashboard = newDashboardResponse(rev.Dashboard)
+	}
+	return res
+}
+
+type dashboardDiff struct {
+	Op   string `json:"op"` // Op is one of equal, insert or delete
+	Text string `json:"text"`
+}
+
+type dashboardDiffResponse struct {
+	From  int             `json:"from"`
+	To    string          `json:"to"` // To is a revision ID or "current"
+	Diffs []dashboardDiff `json:"diffs"`
+	Patch string          `json:"patch"`
+}
+
+// DashboardRevisions lists the saved revisions of a dashboard, newest first
+func (s *Service) DashboardRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := s.Store.Dashboards(ctx).Get(ctx, cloudhub.DashboardID(id)); err != nil {
+		notFound(w, id, s.Logger)
+		return
+	}
+
+	revs, err := s.Store.DashboardRevisions(ctx).All(ctx, cloudhub.DashboardID(id))
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	res := dashboardRevisionsResponse{
+		Revisions: []dashboardRevisionResponse{},
+		Links: selfLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/dashboards/%d/revisions", id),
+		},
+	}
+	for _, rev := range revs {
+		res.Revisions = append(res.Revisions, newDashboardRevisionResponse(rev, false))
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// dashboardRevision retrieves the revision named in the request after
+// checking that the dashboard is visible to the caller. It writes the
+// error response and returns false on failure.
+func (s *Service) dashboardRevision(w http.ResponseWriter, r *http.Request) (cloudhub.Dashboard, *cloudhub.DashboardRevision, bool) {
+	id, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return cloudhub.Dashboard{}, nil, false
+	}
+	revID, err := paramID("rid", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return cloudhub.Dashboard{}, nil, false
+	}
+
+	ctx := r.Context()
+	dash, err := s.Store.Dashboards(ctx).Get(ctx, cloudhub.DashboardID(id))
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return cloudhub.Dashboard{}, nil, false
+	}
+
+	rev, err := s.Store.DashboardRevisions(ctx).Get(ctx, dash.ID, revID)
+	if err != nil {
+		notFound(w, revID, s.Logger)
+		return cloudhub.Dashboard{}, nil, false
+	}
+	return dash, rev, true
+}
+
+// DashboardRevisionID returns a single revision of a dashboard
+func (s *Service) DashboardRevisionID(w http.ResponseWriter, r *http.Request) {
+	_, rev, ok := s.dashboardRevision(w, r)
+	if !ok {
+		return
+	}
+
+	res := newDashboardRevisionResponse(*rev, true)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// DashboardRevisionDiff compares a revision of a dashboard with the revision
+// given by the "to" query parameter, or with the current dashboard if none.
+func (s *Service) DashboardRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	dash, rev, ok := s.dashboardRevision(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	to, target := "current", dash
+	if q := r.URL.Query().Get("to"); q != "" {
+		toID, err := strconv.Atoi(q)
+		if err != nil {
+			Error(w, http.StatusUnprocessableEntity, fmt.Sprintf("Error converting ID %s", q), s.Logger)
+			return
+		}
+		toRev, err := s.Store.DashboardRevisions(ctx).Get(ctx, dash.ID, toID)
+		if err != nil {
+			notFound(w, toID, s.Logger)
+			return
+		}
+		to, target = q, toRev.Dashboard
+	}
+
+	res, err := diffDashboards(rev.Dashboard, target)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	res.From, res.To = rev.ID, to
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// diffDashboards line diffs the indented JSON of two dashboards
+func diffDashboards(from, to cloudhub.Dashboard) (*dashboardDiffResponse, error) {
+	a, err := json.MarshalIndent(from, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(to, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	dmp := diffmatchpatch.New()
+	ca, cb, lines := dmp.DiffLinesToChars(string(a), string(b))
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(ca, cb, false), lines)
+
+	res := &dashboardDiffResponse{
+		Diffs: make([]dashboardDiff, 0, len(diffs)),
+		Patch: dmp.PatchToText(dmp.PatchMake(string(a), diffs)),
+	}
+	for _, d := range diffs {
+		op := "equal"
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = "insert"
+		case diffmatchpatch.DiffDelete:
+			op = "delete"
+		}
+		res.Diffs = append(res.Diffs, dashboardDiff{Op: op, Text: d.Text})
+	}
+	return res, nil
+}
+
+// RestoreDashboardRevision rolls a dashboard back to one of its revisions.
+// The restore is itself saved as a new revision.
+func (s *Service) RestoreDashboardRevision(w http.ResponseWriter, r *http.Request) {
+	dash, rev, ok := s.dashboardRevision(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	restored := rev.Dashboard
+	restored.ID = dash.ID
+	restored.Organization = dash.Organization
+	if err := s.Store.Dashboards(ctx).Update(ctx, restored); err != nil {
+		msg := fmt.Sprintf("Error updating dashboard ID %d: %v", dash.ID, err)
+		Error(w, http.StatusInternalServerError, msg, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgDashboardRestored.String(), restored.Name, rev.ID)
+	s.logChange(ctx, "Dashboards", msg, dash, restored)
+
+	res := newDashboardResponse(restored)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+type dashboardRevisionsConfigResponse struct {
+	Links selfLinks `json:"links"`
+	cloudhub.DashboardRevisionsConfig
+}
+
+func newDashboardRevisionsConfigResponse(c cloudhub.DashboardRevisionsConfig) *dashboardRevisionsConfigResponse {
+	return &dashboardRevisionsConfigResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/org_config/dashboard_revisions",
+		},
+		DashboardRevisionsConfig: c,
+	}
+}
+
+// OrganizationDashboardRevisionsConfig retrieves the dashboard revisions section of the organization config
+func (s *Service) OrganizationDashboardRevisionsConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := newDashboardRevisionsConfigResponse(config.DashboardRevisions)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ReplaceOrganizationDashboardRevisionsConfig replaces the dashboard revisions section of the organization config
+func (s *Service) ReplaceOrganizationDashboardRevisionsConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	var revisionsConfig cloudhub.DashboardRevisionsConfig
+	if err := json.NewDecoder(r.Body).Decode(&revisionsConfig); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err := validDashboardRevisionsConfig(revisionsConfig); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	before := config.DashboardRevisions
+	config.DashboardRevisions = revisionsConfig
+	if err := s.Store.OrganizationConfig(ctx).Put(ctx, config); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgDashboardRevisionsPolicy.String(), orgID)
+	s.logChange(ctx, "Organizations", msg, before, config.DashboardRevisions)
+
+	res := newDashboardRevisionsConfigResponse(config.DashboardRevisions)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+func validDashboardRevisionsConfig(c cloudhub.DashboardRevisionsConfig) error {
+	if c.Retention < 1 || c.Retention > maxDashboardRevisionRetention {
+		return fmt.Errorf("retention must be between 1 and %d", maxDashboardRevisionRetention)
+	}
+	return nil
+}
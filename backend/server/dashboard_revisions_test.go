@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func Test_revisionedDashboardsStore_Update(t *testing.T) {
+	current := cloudhub.Dashboard{ID: 1, Name: "cpu", Organization: "default"}
+	var author string
+	var keep int
+
+	s := &revisionedDashboardsStore{
+		DashboardsStore: &mocks.DashboardsStore{
+			GetF: func(ctx context.Context, id cloudhub.DashboardID) (cloudhub.Dashboard, error) {
+				if id != current.ID {
+					return cloudhub.Dashboard{}, cloudhub.ErrDashboardNotFound
+				}
+				return current, nil
+			},
+		},
+		revisions: &mocks.DashboardRevisionsStore{
+			UpdateDashboardF: func(ctx context.Context, d cloudhub.Dashboard, a string, k int) error {
+				current, author, keep = d, a, k
+				return nil
+			},
+		},
+		configs: &mocks.OrganizationConfigStore{
+			FindOrCreateF: func(ctx context.Context, orgID string) (*cloudhub.OrganizationConfig, error) {
+				return &cloudhub.OrganizationConfig{
+					OrganizationID:     orgID,
+					DashboardRevisions: cloudhub.DashboardRevisionsConfig{Retention: 5},
+				}, nil
+			},
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), UserContextKey, &cloudhub.User{Name: "alice"})
+	if err := s.Update(ctx, cloudhub.Dashboard{ID: 1, Name: "cpu2", Organization: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if current.Name != "cpu2" || author != "alice" || keep != 5 {
+		t.Errorf("Update() saved %s by %q keeping %d revisions, want cpu2 by %q keeping 5", current.Name, author, keep, "alice")
+	}
+
+	if err := s.Update(ctx, cloudhub.Dashboard{ID: 2, Name: "mem"}); err != cloudhub.ErrDashboardNotFound {
+		t.Errorf("Update() of a missing dashboard error = %v, want %v", err, cloudhub.ErrDashboardNotFound)
+	}
+}
+
+func TestService_DashboardRevisionDiff(t *testing.T) {
+	revs := map[int]cloudhub.Dashboard{
+		1: {ID: 1, Name: "cpu", Organization: "default"},
+		2: {ID: 1, Name: "cpu2", Organization: "default"},
+	}
+	current := cloudhub.Dashboard{ID: 1, Name: "cpu3", Organization: "default"}
+
+	tests := []struct {
+		name       string
+		url        string
+		rid        string
+		wantStatus int
+		wantTo     string
+		wantDelete string
+		wantInsert string
+	}{
+		{
+			name:       "Against the current dashboard",
+			url:        "/cloudhub/v1/dashboards/1/revisions/1/diff",
+			rid:        "1",
+			wantStatus: http.StatusOK,
+			wantTo:     "current",
+			wantDelete: `"cpu"`,
+			wantInsert: `"cpu3"`,
+		},
+		{
+			name:       "Against another revision",
+			url:        "/cloudhub/v1/dashboards/1/revisions/1/diff?to=2",
+			rid:        "1",
+			wantStatus: http.StatusOK,
+			wantTo:     "2",
+			wantDelete: `"cpu"`,
+			wantInsert: `"cpu2"`,
+		},
+		{
+			name:       "Unknown revision",
+			url:        "/cloudhub/v1/dashboards/1/revisions/3/diff",
+			rid:        "3",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				Store: &mocks.Store{
+					DashboardsStore: &mocks.DashboardsStore{
+						GetF: func(ctx context.Context, id cloudhub.DashboardID) (cloudhub.Dashboard, error) {
+							return current, nil
+						},
+					},
+					DashboardRevisionsStore: &mocks.DashboardRevisionsStore{
+						GetF: func(ctx context.Context, id cloudhub.DashboardID, revID int) (*cloudhub.DashboardRevision, error) {
+							d, ok := revs[revID]
+							if !ok {
+								return nil, cloudhub.ErrDashboardRevisionNotFound
+							}
+							return &cloudhub.DashboardRevision{ID: revID, DashboardID: id, Dashboard: d}, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			ctx := httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+				{Key: "rid", Value: tt.rid},
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://any.url"+tt.url, nil).WithContext(ctx)
+			s.DashboardRevisionDiff(w, r)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("DashboardRevisionDiff() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var res dashboardDiffResponse
+			body, _ := ioutil.ReadAll(resp.Body)
+			if err := json.Unmarshal(body, &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.From != 1 || res.To != tt.wantTo {
+				t.Errorf("DashboardRevisionDiff() compared %d to %s, want 1 to %s", res.From, res.To, tt.wantTo)
+			}
+			var deleted, inserted string
+			for _, d := range res.Diffs {
+				switch d.Op {
+				case "delete":
+					deleted += d.Text
+				case "insert":
+					inserted += d.Text
+				}
+			}
+			if !strings.Contains(deleted, tt.wantDelete) || !strings.Contains(inserted, tt.wantInsert) {
+				t.Errorf("DashboardRevisionDiff() deleted %q and inserted %q", deleted, inserted)
+			}
+			if res.Patch == "" {
+				t.Errorf("DashboardRevisionDiff() returned no patch")
+			}
+		})
+	}
+}
+
+func TestService_RestoreDashboardRevision(t *testing.T) {
+	var updated cloudhub.Dashboard
+	s := &Service{
+		Store: &mocks.Store{
+			DashboardsStore: &mocks.DashboardsStore{
+				GetF: func(ctx context.Context, id cloudhub.DashboardID) (cloudhub.Dashboard, error) {
+					return cloudhub.Dashboard{ID: id, Name: "broken", Organization: "1337"}, nil
+				},
+				UpdateF: func(ctx context.Context, d cloudhub.Dashboard) error {
+					updated = d
+					return nil
+				},
+			},
+			DashboardRevisionsStore: &mocks.DashboardRevisionsStore{
+				GetF: func(ctx context.Context, id cloudhub.DashboardID, revID int) (*cloudhub.DashboardRevision, error) {
+					return &cloudhub.DashboardRevision{
+						ID:          revID,
+						DashboardID: id,
+						Dashboard: cloudhub.Dashboard{
+							ID:           id,
+							Name:         "working",
+							Organization: "1337",
+							Cells:        []cloudhub.DashboardCell{{ID: "1", Name: "cpu"}},
+						},
+					}, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	ctx := httprouter.WithParams(context.Background(), httprouter.Params{
+		{Key: "id", Value: "7"},
+		{Key: "rid", Value: "2"},
+	})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/dashboards/7/revisions/2/restore", nil).WithContext(ctx)
+	s.RestoreDashboardRevision(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("RestoreDashboardRevision() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if updated.ID != 7 || updated.Name != "working" || len(updated.Cells) != 1 {
+		t.Errorf("RestoreDashboardRevision() updated the dashboard to %+v", updated)
+	}
+}
@@ -82,6 +82,7 @@ func (s *Service) DashboardID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := newDashboardResponse(e)
+	setETag(w, e.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -114,7 +115,7 @@ func (s *Service) NewDashboard(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardCreated.String(), dashboard.Name)
-	s.logRegistration(ctx, "Dashboards", msg)
+	s.logChange(ctx, "Dashboards", msg, nil, dashboard)
 
 	res := newDashboardResponse(dashboard)
 	location(w, res.Links.Self)
@@ -143,7 +144,7 @@ func (s *Service) RemoveDashboard(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardDeleted.String(), dashboard.Name)
-	s.logRegistration(ctx, "Dashboards", msg)
+	s.logChange(ctx, "Dashboards", msg, dashboard, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -163,6 +164,10 @@ func (s *Service) ReplaceDashboard(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusNotFound, fmt.Sprintf("ID %d not found", id), s.Logger)
 		return
 	}
+	if ctx, err = ifMatch(ctx, r, dashboard.Revision); err != nil {
+		revisionConflict(w, r, s.Logger)
+		return
+	}
 
 	var req cloudhub.Dashboard
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -182,7 +187,10 @@ func (s *Service) ReplaceDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.Store.Dashboards(ctx).Update(ctx, req); err != nil {
+	if err := s.Store.Dashboards(ctx).Update(ctx, req); err == cloudhub.ErrRevisionMismatch {
+		revisionConflict(w, r, s.Logger)
+		return
+	} else if err != nil {
 		msg := fmt.Sprintf("Error updating dashboard ID %d: %v", id, err)
 		Error(w, http.StatusInternalServerError, msg, s.Logger)
 		return
@@ -190,9 +198,10 @@ func (s *Service) ReplaceDashboard(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardModified.String(), dashboard.Name)
-	s.logRegistration(ctx, "Dashboards", msg)
+	s.logChange(ctx, "Dashboards", msg, dashboard, req)
 
 	res := newDashboardResponse(req)
+	setETag(w, dashboard.Revision+1)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -212,6 +221,11 @@ func (s *Service) UpdateDashboard(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusNotFound, fmt.Sprintf("ID %d not found", id), s.Logger)
 		return
 	}
+	if ctx, err = ifMatch(ctx, r, orig.Revision); err != nil {
+		revisionConflict(w, r, s.Logger)
+		return
+	}
+	before := orig
 
 	var req cloudhub.Dashboard
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -238,7 +252,10 @@ func (s *Service) UpdateDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.Store.Dashboards(ctx).Update(ctx, orig); err != nil {
+	if err := s.Store.Dashboards(ctx).Update(ctx, orig); err == cloudhub.ErrRevisionMismatch {
+		revisionConflict(w, r, s.Logger)
+		return
+	} else if err != nil {
 		msg := fmt.Sprintf("Error updating dashboard ID %d: %v", id, err)
 		Error(w, http.StatusInternalServerError, msg, s.Logger)
 		return
@@ -246,9 +263,10 @@ func (s *Service) UpdateDashboard(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardModified.String(), orig.Name)
-	s.logRegistration(ctx, "Dashboards", msg)
+	s.logChange(ctx, "Dashboards", msg, before, orig)
 
 	res := newDashboardResponse(orig)
+	setETag(w, orig.Revision+1)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
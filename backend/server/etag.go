@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+// etag is the entity tag of revision rev of a resource
+func etag(rev int64) string {
+	return `"` + strconv.FormatInt(rev, 10) + `"`
+}
+
+// setETag sets the ETag of the response to revision rev of the resource
+func setETag(w http.ResponseWriter, rev int64) {
+	w.Header().Set("ETag", etag(rev))
+}
+
+// ifMatch checks the If-Match header of r against revision rev, the one the
+// handler read the resource at. It returns a context that makes the update
+// of the resource conditional on it still being at rev, so that a change
+// made since the client, or the handler, read the resource is not lost.
+func ifMatch(ctx context.Context, r *http.Request, rev int64) (context.Context, error) {
+	if tags, ok := r.Header["If-Match"]; ok && !matchETag(strings.Join(tags, ","), etag(rev)) {
+		return ctx, cloudhub.ErrRevisionMismatch
+	}
+	return context.WithValue(ctx, cloudhub.RevisionContextKey, rev), nil
+}
+
+// matchETag reports whether the list of entity tags of an If-Match header
+// matches tag. Weak tags never match, as If-Match compares tags strongly.
+func matchETag(tags, tag string) bool {
+	for _, t := range strings.Split(tags, ",") {
+		if t = strings.TrimSpace(t); t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// revisionConflict responds to an update of a resource that has been
+// modified since it was read: with 412 when the client asked for the
+// revision it read with If-Match, and with 409 otherwise.
+func revisionConflict(w http.ResponseWriter, r *http.Request, logger cloudhub.Logger) {
+	if _, ok := r.Header["If-Match"]; ok {
+		Error(w, http.StatusPreconditionFailed, "resource has been modified; get it again for its current ETag", logger)
+		return
+	}
+	Error(w, http.StatusConflict, "resource was modified while it was being updated; try again", logger)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func Test_matchETag(t *testing.T) {
+	tests := []struct {
+		tags string
+		want bool
+	}{
+		{tags: `"3"`, want: true},
+		{tags: `"1", "3"`, want: true},
+		{tags: `*`, want: true},
+		{tags: `"2"`},
+		{tags: `W/"3"`},
+		{tags: `3`},
+	}
+	for _, tt := range tests {
+		if got := matchETag(tt.tags, etag(3)); got != tt.want {
+			t.Errorf("matchETag(%s, %s) = %v, want %v", tt.tags, etag(3), got, tt.want)
+		}
+	}
+}
+
+func TestService_UpdateDashboard_IfMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		ifMatch    string
+		conflict   bool
+		wantStatus int
+		wantETag   string
+		wantUpdate bool
+	}{
+		{
+			name:       "without If-Match",
+			wantStatus: http.StatusOK,
+			wantETag:   `"4"`,
+			wantUpdate: true,
+		},
+		{
+			name:       "at the current revision",
+			ifMatch:    `"3"`,
+			wantStatus: http.StatusOK,
+			wantETag:   `"4"`,
+			wantUpdate: true,
+		},
+		{
+			name:       "at an outdated revision",
+			ifMatch:    `"2"`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "modified after it was checked",
+			ifMatch:    `"3"`,
+			conflict:   true,
+			wantStatus: http.StatusPreconditionFailed,
+			wantUpdate: true,
+		},
+		{
+			name:       "modified while the handler updated it",
+			conflict:   true,
+			wantStatus: http.StatusConflict,
+			wantUpdate: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := false
+			s := &Service{
+				Store: &mocks.Store{
+					DashboardsStore: &mocks.DashboardsStore{
+						GetF: func(ctx context.Context, id cloudhub.DashboardID) (cloudhub.Dashboard, error) {
+							return cloudhub.Dashboard{ID: id, Name: "Lyon Estates", Revision: 3}, nil
+						},
+						UpdateF: func(ctx context.Context, d cloudhub.Dashboard) error {
+							updated = true
+							if rev, ok := ctx.Value(cloudhub.RevisionContextKey).(int64); !ok || rev != 3 {
+								t.Errorf("Update() conditional on revision %v, want 3", ctx.Value(cloudhub.RevisionContextKey))
+							}
+							if tt.conflict {
+								return cloudhub.ErrRevisionMismatch
+							}
+							return nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			body := `{"name":"Hill Valley"}`
+			r := httptest.NewRequest("PATCH", "http://any.url/cloudhub/v1/dashboards/1", nil)
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: "1"}}))
+			r.Body = ioutil.NopCloser(bytes.NewReader([]byte(body)))
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			s.UpdateDashboard(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("UpdateDashboard() = %d %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("UpdateDashboard() ETag = %s, want %s", got, tt.wantETag)
+			}
+			if updated != tt.wantUpdate {
+				t.Errorf("UpdateDashboard() updated the store: %v, want %v", updated, tt.wantUpdate)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Websocket close codes of the web terminal when the host key is not trusted.
+// They are in the private range of RFC 6455 so the UI can tell them apart.
+const (
+	hostKeyPendingCloseCode = 4001
+	hostKeyChangedCloseCode = 4002
+	// maxCloseReasonLength is the longest reason that fits a close frame
+	maxCloseReasonLength = 123
+)
+
+// hostKeyError is returned by ssh.Connect when the host presents a key that
+// is not approved in the organization
+type hostKeyError struct {
+	changed     bool
+	host        string
+	fingerprint string
+}
+
+func (e *hostKeyError) Error() string {
+	if e.changed {
+		return fmt.Sprintf("host key of %s changed to %s; refusing to connect", e.host, e.fingerprint)
+	}
+	return fmt.Sprintf("host key %s of %s awaits admin approval", e.fingerprint, e.host)
+}
+
+// closeCode is the websocket close code sent to the web terminal
+func (e *hostKeyError) closeCode() int {
+	if e.changed {
+		return hostKeyChangedCloseCode
+	}
+	return hostKeyPendingCloseCode
+}
+
+// closeReason is the error truncated to the length of a close frame reason
+func (e *hostKeyError) closeReason() string {
+	reason := e.Error()
+	if len(reason) > maxCloseReasonLength {
+		reason = reason[:maxCloseReasonLength]
+	}
+	return reason
+}
+
+// hostKeyVerifier checks the key an SSH host presents against the known
+// hosts of an organization. The first key of a host is recorded but trusted
+// only after an admin approves it; a key that differs from the approved one
+// is refused.
+type hostKeyVerifier struct {
+	ctx   context.Context
+	store cloudhub.HostKeysStore
+	host  string // host is the address and port that is dialed
+	now   func() time.Time
+	known *cloudhub.HostKey // known is the recorded key of the host, if any
+	err   error             // err is why the callback refused the key
+}
+
+// newHostKeyVerifier loads the recorded key of host from store
+func newHostKeyVerifier(ctx context.Context, store cloudhub.HostKeysStore, host string, now func() time.Time) (*hostKeyVerifier, error) {
+	v := &hostKeyVerifier{
+		ctx:   ctx,
+		store: store,
+		host:  host,
+		now:   now,
+	}
+	known, err := store.Get(ctx, cloudhub.HostKeyQuery{Host: &host})
+	if err != nil && err != cloudhub.ErrHostKeyNotFound {
+		return nil, err
+	}
+	v.known = known
+	return v, nil
+}
+
+// algorithms pins the host key algorithms to the type of the approved key, so
+// a host cannot sidestep verification by offering a key of another type.
+func (v *hostKeyVerifier) algorithms() []string {
+	if v.known == nil || !v.known.Approved {
+		return nil
+	}
+	if v.known.KeyType == gossh.KeyAlgoRSA {
+		return []string{gossh.KeyAlgoRSASHA512, gossh.KeyAlgoRSASHA256, gossh.KeyAlgoRSA}
+	}
+	return []string{v.known.KeyType}
+}
+
+// callback is the gossh.HostKeyCallback of the verifier
+func (v *hostKeyVerifier) callback(hostname string, remote net.Addr, key gossh.PublicKey) error {
+	v.err = v.verify(key)
+	return v.err
+}
+
+func (v *hostKeyVerifier) verify(key gossh.PublicKey) error {
+	fingerprint := gossh.FingerprintSHA256(key)
+	if v.known != nil && v.known.Fingerprint == fingerprint {
+		if v.known.Approved {
+			return nil
+		}
+		return &hostKeyError{host: v.host, fingerprint: fingerprint}
+	}
+	if v.known != nil && v.known.Approved {
+		return &hostKeyError{changed: true, host: v.host, fingerprint: fingerprint}
+	}
+
+	// Record the key for approval, replacing a pending key of the host
+	seen := &cloudhub.HostKey{
+		Host:        v.host,
+		KeyType:     key.Type(),
+		Fingerprint: fingerprint,
+		PublicKey:   strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key))),
+		FirstSeen:   v.now().UTC(),
+	}
+	if v.known != nil {
+		seen.ID = v.known.ID
+		seen.Organization = v.known.Organization
+		if err := v.store.Update(v.ctx, seen); err != nil {
+			return err
+		}
+	} else if _, err := v.store.Add(v.ctx, seen); err != nil {
+		return err
+	}
+	v.known = seen
+	return &hostKeyError{host: v.host, fingerprint: fingerprint}
+}
+
+type hostKeyLinks struct {
+	Self    string `json:"self"`    // Self link mapping to this resource
+	Approve string `json:"approve"` // Approve link to trust the key
+}
+
+type hostKeyResponse struct {
+	ID           string       `json:"id"`
+	Organization string       `json:"organization"`
+	Host         string       `json:"host"`
+	KeyType      string       `json:"keyType"`
+	Fingerprint  string       `json:"fingerprint"`
+	PublicKey    string       `json:"publicKey"`
+	Approved     bool         `json:"approved"`
+	FirstSeen    time.Time    `json:"firstSeen"`
+	ApprovedBy   string       `json:"approvedBy,omitempty"`
+	ApprovedAt   *time.Time   `json:"approvedAt,omitempty"`
+	Links        hostKeyLinks `json:"links"`
+}
+
+func newHostKeyResponse(k *cloudhub.HostKey) *hostKeyResponse {
+	selfLink := fmt.Sprintf("/cloudhub/v1/host_keys/%s", k.ID)
+	res := &hostKeyResponse{
+		ID:           k.ID,
+		Organization: k.Organization,
+		Host:         k.Host,
+		KeyType:      k.KeyType,
+		Fingerprint:  k.Fingerprint,
+		PublicKey:    k.PublicKey,
+		Approved:     k.Approved,
+		FirstSeen:    k.FirstSeen,
+		ApprovedBy:   k.ApprovedBy,
+		Links: hostKeyLinks{
+			Self:    selfLink,
+			Approve: selfLink + "/approve",
+		},
+	}
+	if !k.ApprovedAt.IsZero() {
+		approved := k.ApprovedAt
+		res.ApprovedAt = &approved
+	}
+	return res
+}
+
+type hostKeysResponse struct {
+	Links    selfLinks          `json:"links"`
+	HostKeys []*hostKeyResponse `json:"hostKeys"`
+}
+
+type approveHostKeyRequest struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// HostKeys lists the SSH host keys known to the organization, approved or not
+func (s *Service) HostKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	keys, err := s.Store.HostKeys(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := hostKeysResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/host_keys",
+		},
+		HostKeys: []*hostKeyResponse{},
+	}
+	for i := range keys {
+		res.HostKeys = append(res.HostKeys, newHostKeyResponse(&keys[i]))
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ApproveHostKey trusts a recorded host key. The request has to repeat the
+// fingerprint, which the admin compares with the host out of band, so a key
+// that was swapped after it was listed is not approved by accident.
+func (s *Service) ApproveHostKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+
+	var req approveHostKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if req.Fingerprint == "" {
+		invalidData(w, fmt.Errorf("fingerprint required on host key approval request body"), s.Logger)
+		return
+	}
+
+	k, err := s.Store.HostKeys(ctx).Get(ctx, cloudhub.HostKeyQuery{ID: &id})
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	if k.Fingerprint != req.Fingerprint {
+		Error(w, http.StatusConflict, fmt.Sprintf("fingerprint does not match the key %s presented by %s", k.Fingerprint, k.Host), s.Logger)
+		return
+	}
+
+	before := *k
+	k.Approved = true
+	k.ApprovedAt = s.now().UTC()
+	if u, ok := hasUserContext(ctx); ok {
+		k.ApprovedBy = u.Name
+	}
+	if err := s.Store.HostKeys(ctx).Update(ctx, k); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgHostKeyApproved.String(), k.Fingerprint, k.Host)
+	s.logChange(ctx, "HostKeys", msg, &before, k)
+
+	encodeJSON(w, http.StatusOK, newHostKeyResponse(k), s.Logger)
+}
+
+// RemoveHostKey revokes a host key. The next connection to the host records
+// the key it presents for approval again.
+func (s *Service) RemoveHostKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+
+	k, err := s.Store.HostKeys(ctx).Get(ctx, cloudhub.HostKeyQuery{ID: &id})
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	if err := s.Store.HostKeys(ctx).Delete(ctx, k); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgHostKeyRevoked.String(), k.Fingerprint, k.Host)
+	s.logChange(ctx, "HostKeys", msg, k, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
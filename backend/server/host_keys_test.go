@@ -0,0 +1,308 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// fakeSSHServer accepts password logins and session channels with the host
+// key that is currently set. Logins with the authorized key are accepted as
+// well, and direct-tcpip channels are forwarded as a jump host does.
+type fakeSSHServer struct {
+	ln         net.Listener
+	mu         sync.Mutex
+	key        gossh.Signer
+	authorized gossh.PublicKey
+	logins     []string
+}
+
+func newFakeSSHServer(t *testing.T) *fakeSSHServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSSHServer{ln: ln}
+	s.rotate(t)
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// rotate gives the server a new host key
+func (s *fakeSSHServer) rotate(t *testing.T) gossh.PublicKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.key = signer
+	s.mu.Unlock()
+	return signer.PublicKey()
+}
+
+func (s *fakeSSHServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// login records how a user logged in, e.g. password:marty
+func (s *fakeSSHServer) login(method string, c gossh.ConnMetadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logins = append(s.logins, method+":"+c.User())
+}
+
+func (s *fakeSSHServer) loggedIn() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.logins...)
+}
+
+func (s *fakeSSHServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		config := &gossh.ServerConfig{
+			PasswordCallback: func(c gossh.ConnMetadata, _ []byte) (*gossh.Permissions, error) {
+				s.login("password", c)
+				return nil, nil
+			},
+			PublicKeyCallback: func(c gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+				s.mu.Lock()
+				authorized := s.authorized
+				s.mu.Unlock()
+				if authorized == nil || !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+					return nil, fmt.Errorf("unknown public key")
+				}
+				s.login("publickey", c)
+				return nil, nil
+			},
+		}
+		s.mu.Lock()
+		config.AddHostKey(s.key)
+		s.mu.Unlock()
+		go func() {
+			defer conn.Close()
+			_, chans, reqs, err := gossh.NewServerConn(conn, config)
+			if err != nil {
+				return
+			}
+			go gossh.DiscardRequests(reqs)
+			for ch := range chans {
+				if ch.ChannelType() == "direct-tcpip" {
+					go forwardFakeSSH(ch)
+					continue
+				}
+				c, reqs, err := ch.Accept()
+				if err != nil {
+					return
+				}
+				go gossh.DiscardRequests(reqs)
+				defer c.Close()
+			}
+		}()
+	}
+}
+
+// forwardFakeSSH connects a direct-tcpip channel to the address it asks for
+func forwardFakeSSH(ch gossh.NewChannel) {
+	var to struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := gossh.Unmarshal(ch.ExtraData(), &to); err != nil {
+		ch.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(to.Host, strconv.Itoa(int(to.Port))))
+	if err != nil {
+		ch.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	c, reqs, err := ch.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	go func() {
+		io.Copy(c, conn)
+		c.Close()
+	}()
+	io.Copy(conn, c)
+	conn.Close()
+}
+
+// memHostKeys is a HostKeysStore of a single organization kept in memory
+func memHostKeys() (*mocks.HostKeysStore, map[string]*cloudhub.HostKey) {
+	keys := map[string]*cloudhub.HostKey{}
+	return &mocks.HostKeysStore{
+		AddF: func(ctx context.Context, k *cloudhub.HostKey) (*cloudhub.HostKey, error) {
+			k.ID = strconv.Itoa(len(keys) + 1)
+			k.Organization = "default"
+			keys[k.ID] = k
+			return k, nil
+		},
+		GetF: func(ctx context.Context, q cloudhub.HostKeyQuery) (*cloudhub.HostKey, error) {
+			for _, k := range keys {
+				if (q.ID != nil && *q.ID == k.ID) || (q.Host != nil && *q.Host == k.Host) {
+					found := *k
+					return &found, nil
+				}
+			}
+			return nil, cloudhub.ErrHostKeyNotFound
+		},
+		UpdateF: func(ctx context.Context, k *cloudhub.HostKey) error {
+			keys[k.ID] = k
+			return nil
+		},
+		DeleteF: func(ctx context.Context, k *cloudhub.HostKey) error {
+			delete(keys, k.ID)
+			return nil
+		},
+	}, keys
+}
+
+func connectFakeSSH(t *testing.T, store cloudhub.HostKeysStore, port int) error {
+	t.Helper()
+	host := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	v, err := newHostKeyVerifier(context.Background(), store, host, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := &ssh{user: "marty", pwd: "hoverboard", addr: "127.0.0.1", port: port, hostKeys: v}
+	if _, err := sh.Connect(); err != nil {
+		return err
+	}
+	sh.Close()
+	return nil
+}
+
+func TestSSH_Connect_HostKeys(t *testing.T) {
+	srv := newFakeSSHServer(t)
+	store, keys := memHostKeys()
+	key := srv.rotate(t)
+
+	// The first key of the host is recorded and waits for approval
+	for i := 0; i < 2; i++ {
+		err := connectFakeSSH(t, store, srv.port())
+		hkErr, ok := err.(*hostKeyError)
+		if !ok || hkErr.closeCode() != hostKeyPendingCloseCode {
+			t.Fatalf("Connect() of an unknown host error = %v, want a pending host key", err)
+		}
+	}
+	if len(keys) != 1 || keys["1"].Fingerprint != gossh.FingerprintSHA256(key) || keys["1"].Approved {
+		t.Fatalf("Connect() recorded %+v", keys)
+	}
+
+	// A pending key is replaced by the key the host presents now
+	key = srv.rotate(t)
+	if err := connectFakeSSH(t, store, srv.port()); err == nil {
+		t.Fatal("Connect() with a pending key succeeded")
+	}
+	if len(keys) != 1 || keys["1"].Fingerprint != gossh.FingerprintSHA256(key) {
+		t.Fatalf("Connect() did not replace the pending key: %+v", keys["1"])
+	}
+
+	keys["1"].Approved = true
+	if err := connectFakeSSH(t, store, srv.port()); err != nil {
+		t.Fatalf("Connect() with an approved key error = %v", err)
+	}
+
+	srv.rotate(t)
+	err := connectFakeSSH(t, store, srv.port())
+	hkErr, ok := err.(*hostKeyError)
+	if !ok || hkErr.closeCode() != hostKeyChangedCloseCode {
+		t.Fatalf("Connect() with a changed key error = %v, want a changed host key", err)
+	}
+	if len(hkErr.closeReason()) > maxCloseReasonLength {
+		t.Errorf("closeReason() is %d bytes long", len(hkErr.closeReason()))
+	}
+	if keys["1"].Fingerprint != gossh.FingerprintSHA256(key) || !keys["1"].Approved {
+		t.Errorf("Connect() with a changed key modified the approved key: %+v", keys["1"])
+	}
+}
+
+func TestSSH_Connect_NoVerifier(t *testing.T) {
+	srv := newFakeSSHServer(t)
+	sh := &ssh{user: "marty", pwd: "hoverboard", addr: "127.0.0.1", port: srv.port()}
+	if _, err := sh.Connect(); err != errNoHostKeyVerifier {
+		t.Errorf("Connect() error = %v, want %v", err, errNoHostKeyVerifier)
+	}
+}
+
+func TestService_ApproveHostKey(t *testing.T) {
+	store, keys := memHostKeys()
+	keys["1"] = &cloudhub.HostKey{ID: "1", Organization: "default", Host: "10.0.0.1:22", KeyType: "ssh-ed25519", Fingerprint: "SHA256:aaaa"}
+	s := &Service{
+		Store:  &mocks.Store{HostKeysStore: store},
+		Logger: log.New(log.DebugLevel),
+		Now:    func() time.Time { return time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC) },
+	}
+
+	tests := []struct {
+		name         string
+		id           string
+		body         string
+		wantStatus   int
+		wantApproved bool
+	}{
+		{name: "Missing fingerprint", id: "1", body: `{}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "Other fingerprint", id: "1", body: `{"fingerprint":"SHA256:bbbb"}`, wantStatus: http.StatusConflict},
+		{name: "Unknown key", id: "2", body: `{"fingerprint":"SHA256:aaaa"}`, wantStatus: http.StatusNotFound},
+		{name: "Approved", id: "1", body: `{"fingerprint":"SHA256:aaaa"}`, wantStatus: http.StatusOK, wantApproved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: tt.id}})
+			ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{Name: "alice"})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/host_keys/"+tt.id+"/approve", bytes.NewBufferString(tt.body)).WithContext(ctx)
+
+			s.ApproveHostKey(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ApproveHostKey() = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if keys["1"].Approved != tt.wantApproved {
+				t.Errorf("ApproveHostKey() approved = %v, want %v", keys["1"].Approved, tt.wantApproved)
+			}
+		})
+	}
+	if keys["1"].ApprovedBy != "alice" || keys["1"].ApprovedAt.IsZero() {
+		t.Errorf("ApproveHostKey() stored %+v", keys["1"])
+	}
+
+	ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: "1"}})
+	ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{Name: "alice"})
+	w := httptest.NewRecorder()
+	s.RemoveHostKey(w, httptest.NewRequest("DELETE", "http://any.url/cloudhub/v1/host_keys/1", nil).WithContext(ctx))
+	if w.Code != http.StatusNoContent || len(keys) != 0 {
+		t.Errorf("RemoveHostKey() = %d, left %+v", w.Code, keys)
+	}
+}
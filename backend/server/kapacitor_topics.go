@@ -0,0 +1,285 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+// validTopicMinLevel returns the min-level of the query, OK if not set
+func validTopicMinLevel(query url.Values) (string, error) {
+	level := query.Get("min-level")
+	switch level {
+	case "":
+		return cloudhub.AlertLevelOK, nil
+	case cloudhub.AlertLevelOK, cloudhub.AlertLevelInfo, cloudhub.AlertLevelWarning, cloudhub.AlertLevelCritical:
+		return level, nil
+	}
+	return "", fmt.Errorf("min-level must be one of OK, INFO, WARNING or CRITICAL")
+}
+
+func topicsHref(srv cloudhub.Server, elem ...string) string {
+	href := fmt.Sprintf("/cloudhub/v1/sources/%d/kapacitors/%d/topics", srv.SrcID, srv.ID)
+	for _, e := range elem {
+		href += "/" + url.PathEscape(e)
+	}
+	return href
+}
+
+type topicLinks struct {
+	Events   string `json:"events"`
+	Handlers string `json:"handlers"`
+}
+
+type topicResponse struct {
+	kapa.Topic
+	Links topicLinks `json:"links"`
+}
+
+type topicsResponse struct {
+	Links  selfLinks       `json:"links"`
+	Topics []topicResponse `json:"topics"`
+}
+
+type topicEventsResponse struct {
+	Links  selfLinks         `json:"links"`
+	Topic  string            `json:"topic"`
+	Events []kapa.TopicEvent `json:"events"`
+}
+
+type topicHandlerResponse struct {
+	*kapa.TopicHandler
+	Links selfLinks `json:"links"`
+}
+
+func newTopicHandlerResponse(srv cloudhub.Server, h *kapa.TopicHandler) *topicHandlerResponse {
+	return &topicHandlerResponse{
+		TopicHandler: h,
+		Links:        selfLinks{Self: topicsHref(srv, h.Topic, "handlers", h.ID)},
+	}
+}
+
+type topicHandlersResponse struct {
+	Links    selfLinks               `json:"links"`
+	Topic    string                  `json:"topic"`
+	Handlers []*topicHandlerResponse `json:"handlers"`
+}
+
+// KapacitorTopics lists the topics of a kapacitor, filtered by the pattern
+// and min-level of the query.
+func (s *Service) KapacitorTopics(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+	minLevel, err := validTopicMinLevel(r.URL.Query())
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	topics, err := c.Topics(ctx, r.URL.Query().Get("pattern"), minLevel)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := topicsResponse{
+		Links:  selfLinks{Self: topicsHref(srv)},
+		Topics: make([]topicResponse, len(topics)),
+	}
+	for i, t := range topics {
+		res.Topics[i] = topicResponse{
+			Topic: t,
+			Links: topicLinks{
+				Events:   topicsHref(srv, t.ID, "events"),
+				Handlers: topicsHref(srv, t.ID, "handlers"),
+			},
+		}
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// KapacitorTopicEvents lists the events of a topic of a kapacitor
+func (s *Service) KapacitorTopicEvents(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+	minLevel, err := validTopicMinLevel(r.URL.Query())
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	topic := httprouter.GetParamFromContext(ctx, "topic")
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	events, err := c.TopicEvents(ctx, topic, minLevel)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := topicEventsResponse{
+		Links:  selfLinks{Self: topicsHref(srv, topic, "events")},
+		Topic:  topic,
+		Events: events,
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// KapacitorTopicHandlers lists the handlers of a topic of a kapacitor
+func (s *Service) KapacitorTopicHandlers(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	topic := httprouter.GetParamFromContext(ctx, "topic")
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	handlers, err := c.TopicHandlers(ctx, topic)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	res := topicHandlersResponse{
+		Links:    selfLinks{Self: topicsHref(srv, topic, "handlers")},
+		Topic:    topic,
+		Handlers: make([]*topicHandlerResponse, len(handlers)),
+	}
+	for i, h := range handlers {
+		res.Handlers[i] = newTopicHandlerResponse(srv, h)
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// KapacitorTopicHandlerID returns a handler of a topic of a kapacitor
+func (s *Service) KapacitorTopicHandlerID(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	topic := httprouter.GetParamFromContext(ctx, "topic")
+	hid := httprouter.GetParamFromContext(ctx, "hid")
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	h, err := c.TopicHandler(ctx, topic, hid)
+	if err != nil {
+		notFound(w, hid, s.Logger)
+		return
+	}
+	encodeJSON(w, http.StatusOK, newTopicHandlerResponse(srv, h), s.Logger)
+}
+
+// KapacitorTopicHandlersPost creates a handler of a topic of a kapacitor
+func (s *Service) KapacitorTopicHandlersPost(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	var req kapa.TopicHandler
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	ctx := r.Context()
+	req.Topic = httprouter.GetParamFromContext(ctx, "topic")
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	h, err := c.CreateTopicHandler(ctx, &req)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgKapacitorTopicHandlerCreated.String(), h.ID, h.Topic, srv.Name)
+	s.logChange(ctx, "Kapacitors Topics", msg, nil, h)
+
+	res := newTopicHandlerResponse(srv, h)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// KapacitorTopicHandlersPut replaces a handler of a topic of a kapacitor
+func (s *Service) KapacitorTopicHandlersPut(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	var req kapa.TopicHandler
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	ctx := r.Context()
+	req.Topic = httprouter.GetParamFromContext(ctx, "topic")
+	req.ID = httprouter.GetParamFromContext(ctx, "hid")
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	before, err := c.TopicHandler(ctx, req.Topic, req.ID)
+	if err != nil {
+		notFound(w, req.ID, s.Logger)
+		return
+	}
+	h, err := c.UpdateTopicHandler(ctx, &req)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgKapacitorTopicHandlerModified.String(), h.ID, h.Topic, srv.Name)
+	s.logChange(ctx, "Kapacitors Topics", msg, before, h)
+
+	encodeJSON(w, http.StatusOK, newTopicHandlerResponse(srv, h), s.Logger)
+}
+
+// KapacitorTopicHandlersDelete removes a handler of a topic of a kapacitor
+func (s *Service) KapacitorTopicHandlersDelete(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	topic := httprouter.GetParamFromContext(ctx, "topic")
+	hid := httprouter.GetParamFromContext(ctx, "hid")
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	before, err := c.TopicHandler(ctx, topic, hid)
+	if err != nil {
+		notFound(w, hid, s.Logger)
+		return
+	}
+	if err := c.DeleteTopicHandler(ctx, topic, hid); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgKapacitorTopicHandlerDeleted.String(), hid, topic, srv.Name)
+	s.logChange(ctx, "Kapacitors Topics", msg, before, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
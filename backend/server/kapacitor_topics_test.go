@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func TestService_KapacitorTopicHandlers(t *testing.T) {
+	handlers := map[string]map[string]interface{}{}
+	kapaSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "/kapacitor/v1/alerts/topics/cpu/handlers"
+		switch {
+		case r.URL.Path == "/kapacitor/v1/alerts/topics":
+			json.NewEncoder(w).Encode(map[string]interface{}{"topics": []map[string]interface{}{
+				{"id": "cpu", "level": "CRITICAL", "collected": 3},
+			}})
+		case r.URL.Path == prefix && r.Method == http.MethodPost:
+			var h map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&h)
+			handlers[h["id"].(string)] = h
+			json.NewEncoder(w).Encode(h)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			h, ok := handlers[strings.TrimPrefix(r.URL.Path, prefix+"/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"error": "handler does not exist"})
+				return
+			}
+			json.NewEncoder(w).Encode(h)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+		}
+	}))
+	defer kapaSrv.Close()
+
+	s := &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{ID: ID, SrcID: 1, Name: "kapa", URL: kapaSrv.URL}, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+	serve := func(handler http.HandlerFunc, method, path, body string, params ...httprouter.Param) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "http://any.url"+path, strings.NewReader(body))
+		params = append(params, httprouter.Param{Key: "id", Value: "1"}, httprouter.Param{Key: "kid", Value: "2"})
+		r = r.WithContext(httprouter.WithParams(context.Background(), params))
+		handler(w, r)
+		return w
+	}
+	topic := httprouter.Param{Key: "topic", Value: "cpu"}
+
+	w := serve(s.KapacitorTopics, "GET", "/cloudhub/v1/sources/1/kapacitors/2/topics?min-level=WARNING", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"handlers":"/cloudhub/v1/sources/1/kapacitors/2/topics/cpu/handlers"`) {
+		t.Fatalf("KapacitorTopics() = %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(s.KapacitorTopics, "GET", "/cloudhub/v1/sources/1/kapacitors/2/topics?min-level=SEVERE", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("KapacitorTopics() of an unknown level status = %d", w.Code)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "Slack handler",
+			body:       `{"id": "ops-slack", "match": "\"level\" == 'CRITICAL'", "alertNodes": {"slack": [{"channel": "#ops"}]}}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Two handlers",
+			body:       `{"id": "ops", "alertNodes": {"slack": [{"channel": "#ops"}], "pagerDuty": [{"serviceKey": "key"}]}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Missing id",
+			body:       `{"alertNodes": {"slack": [{"channel": "#ops"}]}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s.KapacitorTopicHandlersPost, "POST", "/cloudhub/v1/sources/1/kapacitors/2/topics/cpu/handlers", tt.body, topic)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("KapacitorTopicHandlersPost() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	if h := handlers["ops-slack"]; h["kind"] != "slack" || h["options"].(map[string]interface{})["channel"] != "#ops" {
+		t.Fatalf("kapacitor handler = %v, want a slack handler of #ops", h)
+	}
+
+	w = serve(s.KapacitorTopicHandlerID, "GET", "/cloudhub/v1/sources/1/kapacitors/2/topics/cpu/handlers/ops-slack", "", topic, httprouter.Param{Key: "hid", Value: "ops-slack"})
+	var res topicHandlerResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(res.AlertNodes.Slack) != 1 || res.AlertNodes.Slack[0].Channel != "#ops" ||
+		res.Links.Self != "/cloudhub/v1/sources/1/kapacitors/2/topics/cpu/handlers/ops-slack" {
+		t.Errorf("KapacitorTopicHandlerID() = %d %s", w.Code, w.Body.String())
+	}
+
+	w = serve(s.KapacitorTopicHandlersPut, "PUT", "/cloudhub/v1/sources/1/kapacitors/2/topics/cpu/handlers/missing",
+		`{"alertNodes": {"slack": [{"channel": "#ops"}]}}`, topic, httprouter.Param{Key: "hid", Value: "missing"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("KapacitorTopicHandlersPut() of a missing handler status = %d", w.Code)
+	}
+}
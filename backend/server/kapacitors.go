@@ -124,7 +124,7 @@ func (s *Service) NewKapacitor(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorCreated.String(), srv.Name)
-	s.logRegistration(ctx, "Kapacitors", msg)
+	s.logChange(ctx, "Kapacitors", msg, nil, srv)
 
 	res := newKapacitor(srv)
 	location(w, res.Links.Self)
@@ -236,7 +236,7 @@ func (s *Service) RemoveKapacitor(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorDeleted.String(), srv.Name)
-	s.logRegistration(ctx, "Kapacitors", msg)
+	s.logChange(ctx, "Kapacitors", msg, srv, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -283,6 +283,7 @@ func (s *Service) UpdateKapacitor(w http.ResponseWriter, r *http.Request) {
 		notFound(w, id, s.Logger)
 		return
 	}
+	before := srv
 
 	var req patchKapacitorRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -333,7 +334,7 @@ func (s *Service) UpdateKapacitor(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorModified.String(), srv.Name)
-	s.logRegistration(ctx, "Kapacitors", msg)
+	s.logChange(ctx, "Kapacitors", msg, before, srv)
 
 	res := newKapacitor(srv)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -388,6 +389,12 @@ func (s *Service) KapacitorRulesPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	ingest, err := s.alertIngest(ctx, &srv)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	c.Ticker = &kapa.Alert{Ingest: ingest}
 
 	var req cloudhub.AlertRule
 	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -415,7 +422,7 @@ func (s *Service) KapacitorRulesPost(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorRuleCreated.String(), task.Rule.Name, srv.Name)
-	s.logRegistration(ctx, "Kapacitors Rules", msg)
+	s.logChange(ctx, "Kapacitors Rules", msg, nil, task.Rule)
 
 	res := newAlertResponse(task, srv.SrcID, srv.ID)
 	location(w, res.Links.Self)
@@ -787,6 +794,12 @@ func (s *Service) KapacitorRulesPut(w http.ResponseWriter, r *http.Request) {
 
 	tid := httprouter.GetParamFromContext(ctx, "tid")
 	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	ingest, err := s.alertIngest(ctx, &srv)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	c.Ticker = &kapa.Alert{Ingest: ingest}
 	var req cloudhub.AlertRule
 	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
 		invalidData(w, err, s.Logger)
@@ -801,7 +814,8 @@ func (s *Service) KapacitorRulesPut(w http.ResponseWriter, r *http.Request) {
 	*/
 
 	// Check if the rule exists and is scoped correctly
-	if _, err = c.Get(ctx, tid); err != nil {
+	before, err := c.Get(ctx, tid)
+	if err != nil {
 		if err == cloudhub.ErrAlertNotFound {
 			notFound(w, id, s.Logger)
 			return
@@ -820,7 +834,7 @@ func (s *Service) KapacitorRulesPut(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorRuleModified.String(), task.Rule.Name, srv.Name)
-	s.logRegistration(ctx, "Kapacitors Rules", msg)
+	s.logChange(ctx, "Kapacitors Rules", msg, before.Rule, task.Rule)
 
 	res := newAlertResponse(task, srv.SrcID, srv.ID)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -874,7 +888,7 @@ func (s *Service) KapacitorRulesStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the rule exists and is scoped correctly
-	_, err = c.Get(ctx, tid)
+	before, err := c.Get(ctx, tid)
 	if err != nil {
 		if err == cloudhub.ErrAlertNotFound {
 			notFound(w, id, s.Logger)
@@ -902,7 +916,7 @@ func (s *Service) KapacitorRulesStatus(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorRuleStatus.String(), task.Rule.Name, ruleStatus, srv.Name)
-	s.logRegistration(ctx, "Kapacitors Rules", msg)
+	s.logChange(ctx, "Kapacitors Rules", msg, before.Rule, task.Rule)
 
 	res := newAlertResponse(task, srv.SrcID, srv.ID)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -1030,7 +1044,7 @@ func (s *Service) KapacitorRulesDelete(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorRuleDeleted.String(), task.Rule.Name, srv.Name)
-	s.logRegistration(ctx, "Kapacitors Rules", msg)
+	s.logChange(ctx, "Kapacitors Rules", msg, task.Rule, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1125,7 +1139,7 @@ func (s *Service) CreateKapacitorTask(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgKapacitorRuleCreated.String(), task.Rule.Name, org.Name)
-	s.logRegistration(ctx, "Kapacitors Task", msg)
+	s.logChange(ctx, "Kapacitors Task", msg, nil, task.TICKScript)
 
 	res := newAlertResponse(task, deviceOrg.AIKapacitor.SrcID, deviceOrg.AIKapacitor.KapaID)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -1263,6 +1277,15 @@ func (s *Service) UpdateKapacitorTask(w http.ResponseWriter, r *http.Request) {
 		TICKscript: script,
 		Status:     status,
 	}
+	before, err := c.Get(ctx, kapaID)
+	if err != nil {
+		if err == cloudhub.ErrAlertNotFound {
+			notFound(w, kapaID, s.Logger)
+			return
+		}
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+		return
+	}
 	aiConfig := s.InternalENV.AIConfig
 	newAITaskProcessor := kapa.NewAITaskProcess{Regex: aiConfig.PredictionRegex}
 	task, err := c.AutoGenerateUpdate(ctx, createTaskOptions, c.Href(kapaID), newAITaskProcessor)
@@ -1272,7 +1295,7 @@ func (s *Service) UpdateKapacitorTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	msg := fmt.Sprintf(MsgKapacitorRuleModified.String(), task.Rule.Name, org.Name)
-	s.logRegistration(ctx, "Kapacitors Task", msg)
+	s.logChange(ctx, "Kapacitors Task", msg, before.TICKScript, task.TICKScript)
 
 	res := newAlertResponse(task, deviceOrg.AIKapacitor.SrcID, deviceOrg.AIKapacitor.KapaID)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+)
+
+// LDAPScheme is the scheme of users authenticated by an LDAP directory
+const LDAPScheme = "ldap"
+
+// ldapRoute returns the LDAP login routes for the client, or nil when no
+// LDAP directory is configured.
+func ldapRoute(provider oauth2.PasswordProvider) *BasicAuthRoute {
+	if provider == nil {
+		return nil
+	}
+	return &BasicAuthRoute{
+		Name:   provider.Name(),
+		Login:  "/ldap/login",
+		Logout: "/ldap/logout",
+	}
+}
+
+// LDAPLogin authenticates a user against the LDAP directory and issues the
+// same session cookie as the OAuth2 providers. The user itself is found or
+// created by Me, which maps the LDAP groups of the principal to
+// organizations with ldap:ldap:<group> mappings.
+func (s *Service) LDAPLogin(auth oauth2.Authenticator, provider oauth2.PasswordProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := serverContext(r.Context())
+
+		var req loginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidJSON(w, s.Logger)
+			return
+		}
+
+		if err := req.ValidCreate(); err != nil {
+			invalidData(w, err, s.Logger)
+			return
+		}
+
+		// The directory checks the password itself, so it must be sent as is
+		if strings.ToLower(req.IsEncoded) == "true" {
+			invalidData(w, fmt.Errorf("isEncoded is not supported by LDAP login"), s.Logger)
+			return
+		}
+
+		principal, err := provider.Authenticate(ctx, req.Name, req.Password)
+		if err == oauth2.ErrAuthentication {
+			msg := fmt.Sprintf(MsgLDAPLoginFailed.String())
+			s.logRegistration(ctx, "Login", msg, req.Name)
+			Error(w, http.StatusUnauthorized, "Invalid user name or password.", s.Logger)
+			return
+		}
+		if err != nil {
+			s.Logger.
+				WithField("component", "ldap").
+				Error(fmt.Sprintf("Unable to authenticate %s: %v", req.Name, err))
+			Error(w, http.StatusBadGateway, "Unable to authenticate with the LDAP server.", s.Logger)
+			return
+		}
+
+		if err := auth.Authorize(ctx, w, principal); err != nil {
+			Error(w, http.StatusInternalServerError, fmt.Sprintf("Failed auth.Authorize: %v, %v", err, principal), s.Logger)
+			return
+		}
+		s.Logger.Info("User ", principal.Subject, " is authenticated by LDAP")
+
+		// log registration
+		msg := fmt.Sprintf(MsgLDAPLogin.String())
+		s.logRegistration(ctx, "Login", msg, principal.Subject)
+
+		// Passwords of directory users are managed by the directory
+		res := &loginResponse{
+			PasswordResetFlag: "N",
+		}
+		encodeJSON(w, http.StatusOK, res, s.Logger)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+)
+
+// recordingAuthenticator remembers the principal it was asked to authorize
+type recordingAuthenticator struct {
+	mocks.Authenticator
+	authorized *oauth2.Principal
+}
+
+func (a *recordingAuthenticator) Authorize(ctx context.Context, w http.ResponseWriter, p oauth2.Principal) error {
+	a.authorized = &p
+	return a.Authenticator.Authorize(ctx, w, p)
+}
+
+func TestService_LDAPLogin(t *testing.T) {
+	provider := &mocks.PasswordProvider{
+		ProviderName: oauth2.LDAPProviderName,
+		AuthenticateF: func(ctx context.Context, username, password string) (oauth2.Principal, error) {
+			switch {
+			case username == "alice" && password == "alice-pass":
+				return oauth2.Principal{Subject: "alice", Issuer: oauth2.LDAPProviderName, Group: "ops,dba"}, nil
+			case username == "down":
+				return oauth2.Principal{}, errors.New("ldap dial: connection refused")
+			}
+			return oauth2.Principal{}, oauth2.ErrAuthentication
+		},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantGroup  string
+	}{
+		{
+			name:       "Valid credentials",
+			body:       `{"name":"alice","password":"alice-pass"}`,
+			wantStatus: http.StatusOK,
+			wantGroup:  "ops,dba",
+		},
+		{
+			name:       "Wrong password",
+			body:       `{"name":"alice","password":"nope"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Missing password",
+			body:       `{"name":"alice"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Encoded password",
+			body:       `{"name":"alice","password":"ab12","isEncoded":"true"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Directory unavailable",
+			body:       `{"name":"down","password":"x"}`,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &recordingAuthenticator{}
+			s := &Service{
+				Store:  &mocks.Store{},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/ldap/login", bytes.NewBufferString(tt.body))
+			s.LDAPLogin(auth, provider)(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("LDAPLogin() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if auth.authorized != nil {
+					t.Errorf("LDAPLogin() authorized %+v despite failing", auth.authorized)
+				}
+				return
+			}
+			if auth.authorized == nil || auth.authorized.Issuer != oauth2.LDAPProviderName || auth.authorized.Group != tt.wantGroup {
+				t.Errorf("LDAPLogin() authorized %+v", auth.authorized)
+			}
+		})
+	}
+}
+
+func Test_principalScheme(t *testing.T) {
+	tests := []struct {
+		issuer string
+		want   string
+	}{
+		{issuer: BasicProvider, want: BasicScheme},
+		{issuer: oauth2.LDAPProviderName, want: LDAPScheme},
+		{issuer: "github", want: "oauth2"},
+	}
+	for _, tt := range tests {
+		if got := principalScheme(oauth2.Principal{Issuer: tt.issuer}); got != tt.want {
+			t.Errorf("principalScheme(%q) = %q, want %q", tt.issuer, got, tt.want)
+		}
+	}
+}
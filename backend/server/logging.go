@@ -5,11 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/url"
-	"time"
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
-	"github.com/snetsystems/cloudhub/backend/influx"
 )
 
 // General Acitivity Logging
@@ -20,11 +17,33 @@ const (
 	MsgDifferentPassword = logMessage("Password does not match.")
 	MsgEmptyPassword     = logMessage("Empty user table password")
 
+	// Password reset
+	MsgPasswordResetMailed = logMessage("Password reset link has been sent to %s.")
+	MsgPasswordResetDone   = logMessage("Password has been reset with a reset link.")
+
+	// Two-factor authentication
+	MsgTOTPRequired      = logMessage("Password accepted, waiting for the TOTP code.")
+	MsgTOTPLogin         = logMessage("TOTP Login Success")
+	MsgTOTPInvalid       = logMessage("TOTP code does not match.")
+	MsgRecoveryCodeLogin = logMessage("Recovery Code Login Success")
+	MsgTOTPEnabled       = logMessage("Two-factor authentication of %s has been enabled.")
+	MsgTOTPDisabled      = logMessage("Two-factor authentication of %s has been disabled.")
+	MsgTOTPReset         = logMessage("Two-factor authentication of %s has been reset by an administrator.")
+	MsgTOTPPolicy        = logMessage("Two-factor authentication policy of organization %s has been modified.")
+
+	// LDAP Login
+	MsgLDAPLogin       = logMessage("LDAP Login Success")
+	MsgLDAPLoginFailed = logMessage("LDAP authentication failed.")
+
 	// Organizations
 	MsgOrganizationCreated  = logMessage("%s has been created.")
 	MsgOrganizationModified = logMessage("%s has been modified.")
 	MsgOrganizationDeleted  = logMessage("%s has been deleted.")
 
+	// Organizations Config
+	MsgLogViewerConfigModified  = logMessage("Log viewer config of organization %s has been modified.")
+	MsgDashboardRevisionsPolicy = logMessage("Dashboard revision retention of organization %s has been modified.")
+
 	// Mappings
 	MsgMappingCreated  = logMessage("%s Mapping has been created.")
 	MsgMappingModified = logMessage("%s Mapping has been modified.")
@@ -50,12 +69,36 @@ const (
 	MsgKapacitorModified = logMessage("%s has been modified.")
 	MsgKapacitorDeleted  = logMessage("%s has been deleted.")
 
+	// Services
+	MsgServiceCreated  = logMessage("%s has been created.")
+	MsgServiceModified = logMessage("%s has been modified.")
+	MsgServiceDeleted  = logMessage("%s has been deleted.")
+
 	// Kapacitors Rules
 	MsgKapacitorRuleCreated  = logMessage("%s has been created in %s.")
 	MsgKapacitorRuleModified = logMessage("%s has been modified in %s.")
 	MsgKapacitorRuleStatus   = logMessage("%s has been %s in %s.")
 	MsgKapacitorRuleDeleted  = logMessage("%s has been deleted from %s.")
 
+	// Maintenance Windows
+	MsgMaintenanceWindowCreated  = logMessage("%s has been created in %s.")
+	MsgMaintenanceWindowModified = logMessage("%s has been modified in %s.")
+	MsgMaintenanceWindowDeleted  = logMessage("%s has been deleted from %s.")
+	MsgMaintenanceWindowStarted  = logMessage("Maintenance window %s has started, disabling %d rules of %s.")
+	MsgMaintenanceWindowEnded    = logMessage("Maintenance window %s has ended.")
+
+	// Kapacitors Topic Handlers
+	MsgKapacitorTopicHandlerCreated  = logMessage("Handler %s of topic %s has been created in %s.")
+	MsgKapacitorTopicHandlerModified = logMessage("Handler %s of topic %s has been modified in %s.")
+	MsgKapacitorTopicHandlerDeleted  = logMessage("Handler %s of topic %s has been deleted from %s.")
+
+	// Rule Templates
+	MsgRuleTemplateCreated      = logMessage("Rule template %s has been created.")
+	MsgRuleTemplateModified     = logMessage("Rule template %s has been modified.")
+	MsgRuleTemplateDeleted      = logMessage("Rule template %s has been deleted.")
+	MsgRuleTemplateInstantiated = logMessage("Rule template %s has been instantiated as %d rules.")
+	MsgRuleTemplateSynced       = logMessage("Rule template %s has been synced to %d rules.")
+
 	// Organizations Users
 	MsgOrganizationUserCreated  = logMessage("%s has been created in %s.")
 	MsgOrganizationUserModified = logMessage("%s has been modified in %s.")
@@ -66,10 +109,36 @@ const (
 	MsgUserModified = logMessage("%s has been modified.")
 	MsgUserDeleted  = logMessage("%s has been deleted.")
 
+	// API Tokens
+	MsgAPITokenCreated = logMessage("%s has been created.")
+	MsgAPITokenDeleted = logMessage("%s has been revoked.")
+
+	// Host Keys
+	MsgHostKeyApproved = logMessage("Host key %s of %s has been approved.")
+	MsgHostKeyRevoked  = logMessage("Host key %s of %s has been revoked.")
+
+	// Terminal Profiles
+	MsgTerminalProfileCreated  = logMessage("Terminal profile %s has been created.")
+	MsgTerminalProfileModified = logMessage("Terminal profile %s has been modified.")
+	MsgTerminalProfileDeleted  = logMessage("Terminal profile %s has been deleted.")
+
+	// Terminal Recordings
+	MsgTerminalRecordingsPolicy = logMessage("Terminal recording retention of organization %s has been modified.")
+
+	// Salt
+	MsgSaltCallDenied     = logMessage("Salt call %s has been denied for role %s.")
+	MsgSaltPolicyModified = logMessage("Salt policy of organization %s has been modified.")
+	MsgSaltJobRerun       = logMessage("Salt job %s has been re-run as %s.")
+
+	// Backups
+	MsgBackupDownloaded = logMessage("Backup of the store taken at %s has been downloaded.")
+
 	// Dashboards
 	MsgDashboardCreated  = logMessage("%s has been created.")
 	MsgDashboardModified = logMessage("%s has been modified.")
 	MsgDashboardDeleted  = logMessage("%s has been deleted.")
+	MsgDashboardRestored = logMessage("%s has been restored to revision %d.")
+	MsgDashboardImported = logMessage("%s has been imported.")
 
 	// Dashboards Cells
 	MsgDashboardCellCreated  = logMessage("%s has been created in %s.")
@@ -178,14 +247,13 @@ func (s *Service) HTTPLogging(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// logRegistration log db insert
+// logRegistration records an activity event
 // parameters = action, message, userName
 func (s *Service) logRegistration(ctx context.Context, parameters ...string) {
 	logs := s.Logger.
 		WithField("component", "activity_logging").
 		WithField("parameters", fmt.Sprintf("%q", parameters))
 
-	serverCtx := serverContext(ctx)
 	user, ok := hasUserContext(ctx)
 	if !ok {
 		if len(parameters) < 3 {
@@ -198,55 +266,5 @@ func (s *Service) logRegistration(ctx context.Context, parameters ...string) {
 		}
 	}
 
-	// The id of influxdb set as server option is 0
-	id := 0
-	src, err := s.Store.Sources(serverCtx).Get(serverCtx, id)
-	if err != nil {
-		msg := fmt.Sprintf("Not setting influxdb server option")
-		logs.Error(msg)
-		return
-	}
-
-	u, err := url.Parse(src.URL)
-	if err != nil {
-		msg := fmt.Sprintf("Error parsing source url : %v", err)
-		logs.Error(msg)
-		return
-	}
-
-	var rp, dbname string
-	dbname = "_internal"
-	rp = "monitor"
-
-	// UTC time
-	nanos := time.Now().UnixNano()
-	data := cloudhub.Point{
-		Database:        dbname,
-		RetentionPolicy: rp,
-		Measurement:     "activity_logging",
-		Time:            nanos,
-		Tags: map[string]string{
-			"severity": "info",
-			"action":   parameters[0],
-			"user":     user.Name,
-			"db":       "",
-		},
-		Fields: map[string]interface{}{
-			"timestamp": nanos,
-			"message":   parameters[1],
-		},
-	}
-
-	client := &influx.Client{
-		URL:                u,
-		Authorizer:         influx.DefaultAuthorization(&src),
-		InsecureSkipVerify: src.InsecureSkipVerify,
-		Logger:             s.Logger,
-	}
-
-	if err := client.Write(ctx, []cloudhub.Point{data}); err != nil {
-		msg := fmt.Sprintf("Error influxdb log write : %v", err)
-		logs.Error(msg)
-		return
-	}
+	s.recordAudit(ctx, newAuditEvent(ctx, user, parameters[0], parameters[1]))
 }
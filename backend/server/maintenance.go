@@ -0,0 +1,717 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/influx"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+)
+
+const (
+	// maintenanceActor is the actor of the audit events of windows starting and ending
+	maintenanceActor = "maintenance scheduler"
+	// maintenanceAnnotationTag tags the annotations of windows with the window ID
+	maintenanceAnnotationTag = "maintenance"
+
+	maintenanceStateActive    = "active"
+	maintenanceStateScheduled = "scheduled"
+	maintenanceStateExpired   = "expired"
+)
+
+// maintenanceOccurrence returns the occurrence of w that is under way at now
+// or, if there is none, the next one. ok is false if w does not happen
+// again.
+func maintenanceOccurrence(w *cloudhub.MaintenanceWindow, now time.Time) (start, end time.Time, ok bool) {
+	if w.Cron == "" {
+		return w.Start, w.End, now.Before(w.End)
+	}
+
+	sched, err := parseCron(w.Cron)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	// the occurrence under way started less than a duration ago
+	from := now.Add(-w.Duration).Add(time.Nanosecond)
+	if from.Before(w.Start) {
+		from = w.Start
+	}
+	start = sched.next(from.In(loc))
+	if start.IsZero() || (!w.End.IsZero() && !start.Before(w.End)) {
+		return time.Time{}, time.Time{}, false
+	}
+	end = start.Add(w.Duration)
+	if !w.End.IsZero() && end.After(w.End) {
+		// the last occurrence is cut short by the end of w
+		end = w.End
+		if !end.After(now) {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	return start.UTC(), end.UTC(), true
+}
+
+// maintenanceActive returns whether the tasks of w should be disabled at now
+func maintenanceActive(w *cloudhub.MaintenanceWindow, now time.Time) bool {
+	start, _, ok := maintenanceOccurrence(w, now)
+	return ok && !start.After(now)
+}
+
+// maintenanceCovers returns whether rule is in the scope of w. Hosts and
+// tags are matched against the tags the query of a rule filters on, so
+// rules written as TICKscripts are only covered by ID.
+func maintenanceCovers(w *cloudhub.MaintenanceWindow, rule cloudhub.AlertRule) bool {
+	if len(w.RuleIDs) == 0 && len(w.Hosts) == 0 && len(w.Tags) == 0 {
+		return true
+	}
+	for _, id := range w.RuleIDs {
+		if rule.ID == id {
+			return true
+		}
+	}
+
+	q := rule.Query
+	if q == nil || !q.AreTagsAccepted {
+		return false
+	}
+	has := func(k, v string) bool {
+		for _, tv := range q.Tags[k] {
+			if tv == v {
+				return true
+			}
+		}
+		return false
+	}
+	for _, h := range w.Hosts {
+		if has("host", h) {
+			return true
+		}
+	}
+	if len(w.Tags) == 0 {
+		return false
+	}
+	for k, v := range w.Tags {
+		if !has(k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// maintenanceClaims returns the tasks disabled by the windows under way on
+// the kapacitor of w other than w. A task covered by windows that overlap is
+// recorded on each of them, and enabled when the last of them ends.
+func maintenanceClaims(w *cloudhub.MaintenanceWindow, windows []cloudhub.MaintenanceWindow) map[string]bool {
+	claims := map[string]bool{}
+	for _, o := range windows {
+		if o.ID == w.ID || o.KapacitorID != w.KapacitorID || !o.Active {
+			continue
+		}
+		for _, id := range o.DisabledTasks {
+			claims[id] = true
+		}
+	}
+	return claims
+}
+
+// startMaintenance disables the enabled tasks of c covered by w, recording
+// them on w so that they are the ones enabled when w ends. Covered tasks
+// already disabled by the windows under way, claimed, are recorded too.
+// Tasks that could not be disabled are recorded as pending, to be disabled
+// again by retryMaintenance.
+func startMaintenance(ctx context.Context, c *kapa.Client, w *cloudhub.MaintenanceWindow, claimed map[string]bool) error {
+	tasks, err := c.All(ctx)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(tasks))
+	for id := range tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w.Active = true
+	var lastErr error
+	for _, id := range ids {
+		task := tasks[id]
+		if !maintenanceCovers(w, task.Rule) {
+			continue
+		}
+		if err := disableMaintenanceTask(ctx, c, w, id, task, claimed); err != nil {
+			w.PendingTasks = append(w.PendingTasks, id)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// retryMaintenance disables the pending tasks of w, the ones it could not
+// disable so far. Tasks deleted in the meantime are dropped.
+func retryMaintenance(ctx context.Context, c *kapa.Client, w *cloudhub.MaintenanceWindow, claimed map[string]bool) error {
+	var pending []string
+	var lastErr error
+	for _, id := range w.PendingTasks {
+		task, err := c.Get(ctx, id)
+		if err == cloudhub.ErrAlertNotFound {
+			continue
+		}
+		if err == nil {
+			err = disableMaintenanceTask(ctx, c, w, id, task, claimed)
+		}
+		if err != nil {
+			pending = append(pending, id)
+			lastErr = err
+		}
+	}
+	w.PendingTasks = pending
+	return lastErr
+}
+
+// disableMaintenanceTask disables task if it is enabled, recording it on w
+// along with the tasks disabled by the windows under way.
+func disableMaintenanceTask(ctx context.Context, c *kapa.Client, w *cloudhub.MaintenanceWindow, id string, task *kapa.Task, claimed map[string]bool) error {
+	if task.Rule.Status == "enabled" {
+		if _, err := c.Disable(ctx, task.Href); err != nil {
+			return err
+		}
+	} else if !claimed[id] {
+		return nil
+	}
+	w.DisabledTasks = append(w.DisabledTasks, id)
+	return nil
+}
+
+// endMaintenance enables the tasks disabled by w, but for the ones claimed
+// by the windows still under way. Tasks that could not be enabled stay on w,
+// and w active, to be enabled again later; tasks deleted in the meantime are
+// dropped.
+func endMaintenance(ctx context.Context, c *kapa.Client, w *cloudhub.MaintenanceWindow, claimed map[string]bool) error {
+	var failed []string
+	var lastErr error
+	for _, id := range w.DisabledTasks {
+		if claimed[id] {
+			continue
+		}
+		if _, err := c.Enable(ctx, c.Href(id)); err != nil {
+			if _, err := c.Get(ctx, id); err == cloudhub.ErrAlertNotFound {
+				continue
+			}
+			failed = append(failed, id)
+			lastErr = err
+		}
+	}
+	w.DisabledTasks = failed
+	w.PendingTasks = nil
+	w.Active = len(failed) > 0
+	return lastErr
+}
+
+// applyMaintenanceWindows starts and ends the maintenance windows whose state
+// differs from the one they should be in at now.
+func (s *Service) applyMaintenanceWindows(ctx context.Context, now time.Time) error {
+	ctx = serverContext(ctx)
+	windows, err := s.Store.MaintenanceWindows(ctx).All(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range windows {
+		// windows are applied in place, so that each sees the tasks
+		// disabled by the ones applied before it
+		if err := s.applyMaintenanceWindow(ctx, &windows[i], windows, now); err != nil {
+			s.Logger.
+				WithField("component", "kapacitor > maintenance").
+				WithField("window", windows[i].ID).
+				Error(err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *Service) applyMaintenanceWindow(ctx context.Context, w *cloudhub.MaintenanceWindow, windows []cloudhub.MaintenanceWindow, now time.Time) error {
+	active := maintenanceActive(w, now)
+	retry := active && w.Active && len(w.PendingTasks) > 0
+	if active == w.Active && !retry {
+		return nil
+	}
+
+	srv, err := s.Store.Servers(ctx).Get(ctx, w.KapacitorID)
+	if err != nil && active {
+		return err
+	}
+
+	var applyErr error
+	if err != nil {
+		// the kapacitor is gone along with its tasks
+		w.Active, w.DisabledTasks, w.PendingTasks = false, nil, nil
+	} else {
+		c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+		claimed := maintenanceClaims(w, windows)
+		switch {
+		case retry:
+			applyErr = retryMaintenance(ctx, c, w, claimed)
+		case active:
+			applyErr = startMaintenance(ctx, c, w, claimed)
+		default:
+			applyErr = endMaintenance(ctx, c, w, claimed)
+		}
+	}
+	// the settings of the window may have been changed meanwhile
+	if err := s.Store.MaintenanceWindows(ctx).UpdateState(ctx, w); err != nil {
+		return err
+	}
+	if retry {
+		return applyErr
+	}
+
+	octx := context.WithValue(ctx, organizations.ContextKey, w.Organization)
+	if active && w.Active {
+		msg := fmt.Sprintf(MsgMaintenanceWindowStarted.String(), w.Name, len(w.DisabledTasks), srv.Name)
+		s.logRegistration(octx, "Maintenance Windows", msg, maintenanceActor)
+
+		if w.Annotate {
+			start, end, _ := maintenanceOccurrence(w, now)
+			if err := s.annotateMaintenance(ctx, srv, w, start, end); err != nil {
+				applyErr = err
+			}
+		}
+	} else if !active && !w.Active {
+		msg := fmt.Sprintf(MsgMaintenanceWindowEnded.String(), w.Name)
+		s.logRegistration(octx, "Maintenance Windows", msg, maintenanceActor)
+	}
+	return applyErr
+}
+
+// annotateMaintenance marks an occurrence of w on the source of its kapacitor
+func (s *Service) annotateMaintenance(ctx context.Context, srv cloudhub.Server, w *cloudhub.MaintenanceWindow, start, end time.Time) error {
+	src, err := s.Store.Sources(ctx).Get(ctx, srv.SrcID)
+	if err != nil {
+		return err
+	}
+	ts, err := s.TimeSeries(src)
+	if err != nil {
+		return err
+	}
+	if err := ts.Connect(ctx, &src); err != nil {
+		return err
+	}
+
+	_, err = influx.NewAnnotationStore(ts).Add(ctx, &cloudhub.Annotation{
+		StartTime: start,
+		EndTime:   end,
+		Text:      fmt.Sprintf("Maintenance: %s", w.Name),
+		Tags:      cloudhub.AnnotationTags{maintenanceAnnotationTag: w.ID},
+	})
+	return err
+}
+
+// runMaintenanceWindows applies the maintenance windows every interval until
+// ctx is done.
+func (s *Service) runMaintenanceWindows(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.applyMaintenanceWindows(ctx, s.now()); err != nil {
+			s.Logger.
+				WithField("component", "kapacitor > maintenance").
+				Error(err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type maintenanceWindowRequest struct {
+	Name     *string            `json:"name"`
+	Rules    *[]string          `json:"rules"`
+	Hosts    *[]string          `json:"hosts"`
+	Tags     *map[string]string `json:"tags"`
+	Start    *time.Time         `json:"start"`
+	End      *time.Time         `json:"end"`
+	Cron     *string            `json:"cron"`
+	Duration *string            `json:"duration"`
+	Timezone *string            `json:"timezone"`
+	Annotate *bool              `json:"annotate"`
+}
+
+// apply sets the fields of w that are set in the request
+func (r *maintenanceWindowRequest) apply(w *cloudhub.MaintenanceWindow) error {
+	if r.Name != nil {
+		w.Name = *r.Name
+	}
+	if r.Rules != nil {
+		w.RuleIDs = *r.Rules
+	}
+	if r.Hosts != nil {
+		w.Hosts = *r.Hosts
+	}
+	if r.Tags != nil {
+		w.Tags = *r.Tags
+	}
+	if r.Start != nil {
+		w.Start = r.Start.UTC()
+	}
+	if r.End != nil {
+		w.End = r.End.UTC()
+	}
+	if r.Cron != nil {
+		w.Cron = *r.Cron
+	}
+	if r.Duration != nil {
+		w.Duration = 0
+		if *r.Duration != "" {
+			d, err := time.ParseDuration(*r.Duration)
+			if err != nil {
+				return fmt.Errorf("invalid duration: %v", err)
+			}
+			w.Duration = d
+		}
+	}
+	if r.Timezone != nil {
+		w.Timezone = *r.Timezone
+	}
+	if r.Annotate != nil {
+		w.Annotate = *r.Annotate
+	}
+	return nil
+}
+
+// validMaintenanceWindow checks that w is either a one-off window with a
+// start and an end, or a recurring one with a cron expression and a duration.
+func validMaintenanceWindow(w *cloudhub.MaintenanceWindow) error {
+	if w.Name == "" {
+		return fmt.Errorf("name required in maintenance window")
+	}
+	if !w.Start.IsZero() && !w.End.IsZero() && !w.End.After(w.Start) {
+		return fmt.Errorf("end of maintenance window must be after its start")
+	}
+	if w.Cron == "" {
+		if w.Start.IsZero() || w.End.IsZero() {
+			return fmt.Errorf("start and end required in a maintenance window without cron")
+		}
+		return nil
+	}
+
+	if _, err := parseCron(w.Cron); err != nil {
+		return err
+	}
+	if w.Duration <= 0 {
+		return fmt.Errorf("duration required in a maintenance window with cron")
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %v", err)
+	}
+	return nil
+}
+
+type maintenanceWindowResponse struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	KapacitorID   int               `json:"kapacitorID,string"`
+	Rules         []string          `json:"rules"`
+	Hosts         []string          `json:"hosts"`
+	Tags          map[string]string `json:"tags"`
+	Start         *time.Time        `json:"start,omitempty"`
+	End           *time.Time        `json:"end,omitempty"`
+	Cron          string            `json:"cron,omitempty"`
+	Duration      string            `json:"duration,omitempty"`
+	Timezone      string            `json:"timezone,omitempty"`
+	Annotate      bool              `json:"annotate"`
+	CreatedBy     string            `json:"createdBy"`
+	State         string            `json:"state"`
+	NextStart     *time.Time        `json:"nextStart,omitempty"`
+	NextEnd       *time.Time        `json:"nextEnd,omitempty"`
+	DisabledTasks []string          `json:"disabledTasks"`
+	PendingTasks  []string          `json:"pendingTasks"`
+	Links         selfLinks         `json:"links"`
+}
+
+func newMaintenanceWindowResponse(srcID int, w *cloudhub.MaintenanceWindow, now time.Time) *maintenanceWindowResponse {
+	res := &maintenanceWindowResponse{
+		ID:            w.ID,
+		Name:          w.Name,
+		KapacitorID:   w.KapacitorID,
+		Rules:         w.RuleIDs,
+		Hosts:         w.Hosts,
+		Tags:          w.Tags,
+		Cron:          w.Cron,
+		Timezone:      w.Timezone,
+		Annotate:      w.Annotate,
+		CreatedBy:     w.CreatedBy,
+		DisabledTasks: w.DisabledTasks,
+		PendingTasks:  w.PendingTasks,
+		Links: selfLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/sources/%d/kapacitors/%d/maintenance/%s", srcID, w.KapacitorID, w.ID),
+		},
+	}
+	if res.Rules == nil {
+		res.Rules = []string{}
+	}
+	if res.Hosts == nil {
+		res.Hosts = []string{}
+	}
+	if res.Tags == nil {
+		res.Tags = map[string]string{}
+	}
+	if res.DisabledTasks == nil {
+		res.DisabledTasks = []string{}
+	}
+	if res.PendingTasks == nil {
+		res.PendingTasks = []string{}
+	}
+	if !w.Start.IsZero() {
+		t := w.Start
+		res.Start = &t
+	}
+	if !w.End.IsZero() {
+		t := w.End
+		res.End = &t
+	}
+	if w.Duration > 0 {
+		res.Duration = w.Duration.String()
+	}
+
+	start, end, ok := maintenanceOccurrence(w, now)
+	switch {
+	case w.Active:
+		res.State = maintenanceStateActive
+	case ok:
+		res.State = maintenanceStateScheduled
+	default:
+		res.State = maintenanceStateExpired
+	}
+	if ok {
+		res.NextStart, res.NextEnd = &start, &end
+	}
+	return res
+}
+
+type maintenanceWindowsResponse struct {
+	Links   selfLinks                    `json:"links"`
+	Windows []*maintenanceWindowResponse `json:"windows"`
+}
+
+// sourceKapacitor returns the kapacitor of the request, writing a not
+// found error if it is not a kapacitor of the source of the request.
+func (s *Service) sourceKapacitor(w http.ResponseWriter, r *http.Request) (cloudhub.Server, bool) {
+	id, err := paramID("kid", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return cloudhub.Server{}, false
+	}
+
+	srcID, err := paramID("id", r)
+	if err != nil {
+		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
+		return cloudhub.Server{}, false
+	}
+
+	ctx := r.Context()
+	srv, err := s.Store.Servers(ctx).Get(ctx, id)
+	if err != nil || srv.SrcID != srcID || srv.Type != "" {
+		notFound(w, id, s.Logger)
+		return cloudhub.Server{}, false
+	}
+	return srv, true
+}
+
+// maintenanceWindow returns the window of the request if it belongs to srv
+func (s *Service) maintenanceWindow(w http.ResponseWriter, r *http.Request, srv cloudhub.Server) (*cloudhub.MaintenanceWindow, bool) {
+	ctx := r.Context()
+	wid := httprouter.GetParamFromContext(ctx, "wid")
+	mw, err := s.Store.MaintenanceWindows(ctx).Get(ctx, wid)
+	if err != nil || mw.KapacitorID != srv.ID {
+		notFound(w, wid, s.Logger)
+		return nil, false
+	}
+	return mw, true
+}
+
+// MaintenanceWindows lists the maintenance windows of a kapacitor with their state
+func (s *Service) MaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	windows, err := s.Store.MaintenanceWindows(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	now := s.now()
+	res := maintenanceWindowsResponse{
+		Links: selfLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/sources/%d/kapacitors/%d/maintenance", srv.SrcID, srv.ID),
+		},
+		Windows: []*maintenanceWindowResponse{},
+	}
+	for i := range windows {
+		if windows[i].KapacitorID == srv.ID {
+			res.Windows = append(res.Windows, newMaintenanceWindowResponse(srv.SrcID, &windows[i], now))
+		}
+	}
+	sort.SliceStable(res.Windows, func(i, j int) bool {
+		return res.Windows[i].Name < res.Windows[j].Name
+	})
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// MaintenanceWindowByID returns a maintenance window of a kapacitor
+func (s *Service) MaintenanceWindowByID(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+	mw, ok := s.maintenanceWindow(w, r, srv)
+	if !ok {
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newMaintenanceWindowResponse(srv.SrcID, mw, s.now()), s.Logger)
+}
+
+// NewMaintenanceWindow schedules a maintenance window on a kapacitor
+func (s *Service) NewMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	var req maintenanceWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	mw := &cloudhub.MaintenanceWindow{KapacitorID: srv.ID}
+	if err := req.apply(mw); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if err := validMaintenanceWindow(mw); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if user, ok := hasUserContext(ctx); ok {
+		mw.CreatedBy = user.Name
+	}
+
+	mw, err := s.Store.MaintenanceWindows(ctx).Add(ctx, mw)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgMaintenanceWindowCreated.String(), mw.Name, srv.Name)
+	s.logChange(ctx, "Maintenance Windows", msg, nil, *mw)
+
+	res := newMaintenanceWindowResponse(srv.SrcID, mw, s.now())
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// UpdateMaintenanceWindow changes the fields of a maintenance window set in
+// the request. The scope of a window under way applies from its next start.
+func (s *Service) UpdateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+
+	var req maintenanceWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	mw, ok := s.maintenanceWindow(w, r, srv)
+	if !ok {
+		return
+	}
+	before := *mw
+
+	if err := req.apply(mw); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if err := validMaintenanceWindow(mw); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	// the scheduler may start or end the window meanwhile
+	ctx := r.Context()
+	if err := s.Store.MaintenanceWindows(ctx).UpdateSettings(ctx, mw); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgMaintenanceWindowModified.String(), mw.Name, srv.Name)
+	s.logChange(ctx, "Maintenance Windows", msg, before, *mw)
+
+	encodeJSON(w, http.StatusOK, newMaintenanceWindowResponse(srv.SrcID, mw, s.now()), s.Logger)
+}
+
+// RemoveMaintenanceWindow deletes a maintenance window, first enabling the
+// tasks it disabled if it is under way.
+func (s *Service) RemoveMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	srv, ok := s.sourceKapacitor(w, r)
+	if !ok {
+		return
+	}
+	mw, ok := s.maintenanceWindow(w, r, srv)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if mw.Active {
+		// windows of every organization may cover the tasks of the kapacitor
+		sctx := serverContext(ctx)
+		windows, err := s.Store.MaintenanceWindows(sctx).All(sctx)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+		if err := endMaintenance(ctx, c, mw, maintenanceClaims(mw, windows)); err != nil {
+			if uerr := s.Store.MaintenanceWindows(ctx).UpdateState(ctx, mw); uerr != nil {
+				s.Logger.Error(uerr.Error())
+			}
+			Error(w, http.StatusBadGateway, fmt.Sprintf("unable to enable the tasks of maintenance window %s: %v", mw.Name, err), s.Logger)
+			return
+		}
+	}
+
+	if err := s.Store.MaintenanceWindows(ctx).Delete(ctx, mw); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgMaintenanceWindowDeleted.String(), mw.Name, srv.Name)
+	s.logChange(ctx, "Maintenance Windows", msg, *mw, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,533 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func Test_maintenanceOccurrence(t *testing.T) {
+	base := time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC) // a Monday
+	oneOff := &cloudhub.MaintenanceWindow{Start: base.Add(2 * time.Hour), End: base.Add(4 * time.Hour)}
+	nightly := &cloudhub.MaintenanceWindow{Cron: "0 2 * * 1-5", Duration: 2 * time.Hour, End: base.Add(4*24*time.Hour + 3*time.Hour)}
+
+	tests := []struct {
+		name       string
+		w          *cloudhub.MaintenanceWindow
+		now        time.Time
+		wantStart  time.Time
+		wantEnd    time.Time
+		wantOK     bool
+		wantActive bool
+	}{
+		{"one-off before", oneOff, base, base.Add(2 * time.Hour), base.Add(4 * time.Hour), true, false},
+		{"one-off under way", oneOff, base.Add(2 * time.Hour), base.Add(2 * time.Hour), base.Add(4 * time.Hour), true, true},
+		{"one-off over", oneOff, base.Add(4 * time.Hour), base.Add(2 * time.Hour), base.Add(4 * time.Hour), false, false},
+		{"recurring under way", nightly, base.Add(3 * time.Hour), base.Add(2 * time.Hour), base.Add(4 * time.Hour), true, true},
+		{"recurring next", nightly, base.Add(4 * time.Hour), base.Add(26 * time.Hour), base.Add(28 * time.Hour), true, false},
+		{"recurring cut by end", nightly, base.Add(4*24*time.Hour + 2*time.Hour), base.Add(4*24*time.Hour + 2*time.Hour), base.Add(4*24*time.Hour + 3*time.Hour), true, true},
+		{"recurring over", nightly, base.Add(4*24*time.Hour + 3*time.Hour), time.Time{}, time.Time{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := maintenanceOccurrence(tt.w, tt.now)
+			if ok != tt.wantOK || !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("maintenanceOccurrence() = %v, %v, %v, want %v, %v, %v", start, end, ok, tt.wantStart, tt.wantEnd, tt.wantOK)
+			}
+			if got := maintenanceActive(tt.w, tt.now); got != tt.wantActive {
+				t.Errorf("maintenanceActive() = %v, want %v", got, tt.wantActive)
+			}
+		})
+	}
+}
+
+func Test_maintenanceCovers(t *testing.T) {
+	rule := cloudhub.AlertRule{
+		ID: "cloudhub-v1-a",
+		Query: &cloudhub.QueryConfig{
+			Tags:            map[string][]string{"host": {"web1", "web2"}, "role": {"web"}},
+			AreTagsAccepted: true,
+		},
+	}
+	tests := []struct {
+		name string
+		w    cloudhub.MaintenanceWindow
+		want bool
+	}{
+		{"whole kapacitor", cloudhub.MaintenanceWindow{}, true},
+		{"by rule", cloudhub.MaintenanceWindow{RuleIDs: []string{"other", "cloudhub-v1-a"}}, true},
+		{"other rule", cloudhub.MaintenanceWindow{RuleIDs: []string{"other"}}, false},
+		{"by host", cloudhub.MaintenanceWindow{Hosts: []string{"web2"}}, true},
+		{"other host", cloudhub.MaintenanceWindow{Hosts: []string{"db1"}}, false},
+		{"by tags", cloudhub.MaintenanceWindow{Tags: map[string]string{"host": "web1", "role": "web"}}, true},
+		{"some tags", cloudhub.MaintenanceWindow{Tags: map[string]string{"host": "web1", "role": "db"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maintenanceCovers(&tt.w, rule); got != tt.want {
+				t.Errorf("maintenanceCovers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	rule.Query.AreTagsAccepted = false
+	if maintenanceCovers(&cloudhub.MaintenanceWindow{Hosts: []string{"web1"}}, rule) {
+		t.Errorf("maintenanceCovers() covered a rule excluding the host")
+	}
+}
+
+// fakeKapacitor serves the tasks API of kapacitor for the given rules, and
+// for the tasks created and updated through it
+type fakeKapacitor struct {
+	mu      sync.Mutex
+	scripts map[string]string
+	status  map[string]string
+	broken  map[string]bool // requests of broken tasks fail
+}
+
+func newFakeKapacitor(t *testing.T, rules ...cloudhub.AlertRule) *fakeKapacitor {
+	k := &fakeKapacitor{scripts: map[string]string{}, status: map[string]string{}, broken: map[string]bool{}}
+	for _, rule := range rules {
+		script, err := (&kapa.Alert{}).Generate(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k.scripts[rule.ID] = string(script)
+		k.status[rule.ID] = rule.Status
+	}
+	return k
+}
+
+func (k *fakeKapacitor) task(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     id,
+		"script": k.scripts[id],
+		"status": k.status[id],
+		"type":   "stream",
+		"dbrps":  []map[string]string{{"db": "telegraf", "rp": "autogen"}},
+		"link":   map[string]string{"rel": "self", "href": "/kapacitor/v1/tasks/" + id},
+	}
+}
+
+func (k *fakeKapacitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var req struct {
+		ID     string `json:"id"`
+		Script string `json:"script"`
+		Status string `json:"status"`
+	}
+	if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/kapacitor/v1/tasks")
+	id = strings.TrimPrefix(id, "/")
+	if id == "" && r.Method == http.MethodPost {
+		k.scripts[req.ID] = req.Script
+		k.status[req.ID] = req.Status
+		json.NewEncoder(w).Encode(k.task(req.ID))
+		return
+	}
+	if id == "" {
+		tasks := []map[string]interface{}{}
+		if r.URL.Query().Get("offset") == "0" {
+			for id := range k.scripts {
+				tasks = append(tasks, k.task(id))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tasks": tasks})
+		return
+	}
+	if _, ok := k.scripts[id]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "no task exists"})
+		return
+	}
+	if k.broken[id] {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "internal error"})
+		return
+	}
+	if r.Method == http.MethodDelete {
+		delete(k.scripts, id)
+		delete(k.status, id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method == http.MethodPatch {
+		if req.Script != "" {
+			k.scripts[id] = req.Script
+		}
+		if req.Status != "" {
+			k.status[id] = req.Status
+		}
+	}
+	json.NewEncoder(w).Encode(k.task(id))
+}
+
+// maintenanceRule is a threshold rule on the cpu of host
+func maintenanceRule(id, host, status string) cloudhub.AlertRule {
+	return cloudhub.AlertRule{
+		ID:            id,
+		Name:          id,
+		Status:        status,
+		Trigger:       "threshold",
+		TriggerValues: cloudhub.TriggerValues{Operator: "greater than", Value: "90"},
+		Query: &cloudhub.QueryConfig{
+			Database:        "telegraf",
+			RetentionPolicy: "autogen",
+			Measurement:     "cpu",
+			Fields:          []cloudhub.Field{{Value: "usage_user", Type: "field"}},
+			Tags:            map[string][]string{"host": {host}},
+			AreTagsAccepted: true,
+		},
+	}
+}
+
+func (k *fakeKapacitor) setBroken(id string, broken bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.broken[id] = broken
+}
+
+func (k *fakeKapacitor) statuses() map[string]string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	st := map[string]string{}
+	for id, v := range k.status {
+		st[id] = v
+	}
+	return st
+}
+
+func TestService_applyMaintenanceWindows(t *testing.T) {
+	k := newFakeKapacitor(t,
+		maintenanceRule("web1-cpu", "web1", "enabled"),
+		maintenanceRule("web2-cpu", "web2", "enabled"),
+		maintenanceRule("web1-old", "web1", "disabled"),
+	)
+	kapaSrv := httptest.NewServer(k)
+	defer kapaSrv.Close()
+
+	base := time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC)
+	window := cloudhub.MaintenanceWindow{
+		ID:           "1",
+		Name:         "web1 upgrade",
+		Organization: "default",
+		KapacitorID:  1,
+		Hosts:        []string{"web1"},
+		Start:        base.Add(time.Hour),
+		End:          base.Add(2 * time.Hour),
+	}
+	var audit []string
+	s := &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{ID: ID, Name: "kapa", URL: kapaSrv.URL}, nil
+				},
+			},
+			MaintenanceWindowsStore: &mocks.MaintenanceWindowsStore{
+				AllF: func(ctx context.Context) ([]cloudhub.MaintenanceWindow, error) {
+					return []cloudhub.MaintenanceWindow{window}, nil
+				},
+				UpdateStateF: func(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+					window = *w
+					return nil
+				},
+			},
+			AuditStore: &mocks.AuditStore{
+				AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+					if e.Actor != maintenanceActor || e.Organization != "default" {
+						t.Errorf("audit event = %+v, want one of the scheduler in organization default", e)
+					}
+					audit = append(audit, e.Message)
+					return e, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	if err := s.applyMaintenanceWindows(context.Background(), base); err != nil {
+		t.Fatal(err)
+	}
+	if window.Active || len(audit) != 0 {
+		t.Fatalf("window started before its start: %+v", window)
+	}
+
+	if err := s.applyMaintenanceWindows(context.Background(), base.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !window.Active || !reflect.DeepEqual(window.DisabledTasks, []string{"web1-cpu"}) {
+		t.Fatalf("window after its start = %+v, want web1-cpu disabled", window)
+	}
+	if got, want := k.statuses(), map[string]string{"web1-cpu": "disabled", "web2-cpu": "enabled", "web1-old": "disabled"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("task status = %v, want %v", got, want)
+	}
+
+	if err := s.applyMaintenanceWindows(context.Background(), base.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if window.Active || len(window.DisabledTasks) != 0 {
+		t.Fatalf("window after its end = %+v, want it inactive", window)
+	}
+	if got, want := k.statuses(), map[string]string{"web1-cpu": "enabled", "web2-cpu": "enabled", "web1-old": "disabled"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("task status = %v, want %v", got, want)
+	}
+
+	want := []string{
+		"Maintenance window web1 upgrade has started, disabling 1 rules of kapa.",
+		"Maintenance window web1 upgrade has ended.",
+	}
+	if !reflect.DeepEqual(audit, want) {
+		t.Errorf("audit = %q, want %q", audit, want)
+	}
+}
+
+func TestService_applyMaintenanceWindows_Retry(t *testing.T) {
+	k := newFakeKapacitor(t,
+		maintenanceRule("web1-cpu", "web1", "enabled"),
+		maintenanceRule("web2-cpu", "web2", "enabled"),
+	)
+	k.setBroken("web2-cpu", true)
+	kapaSrv := httptest.NewServer(k)
+	defer kapaSrv.Close()
+
+	base := time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC)
+	window := cloudhub.MaintenanceWindow{ID: "1", Name: "rack move", Organization: "default", KapacitorID: 1,
+		Hosts: []string{"web1", "web2"}, Start: base.Add(time.Hour), End: base.Add(2 * time.Hour)}
+	s := &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{ID: ID, Name: "kapa", URL: kapaSrv.URL}, nil
+				},
+			},
+			MaintenanceWindowsStore: &mocks.MaintenanceWindowsStore{
+				AllF: func(ctx context.Context) ([]cloudhub.MaintenanceWindow, error) {
+					return []cloudhub.MaintenanceWindow{window}, nil
+				},
+				UpdateStateF: func(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+					window = *w
+					return nil
+				},
+			},
+			AuditStore: &mocks.AuditStore{
+				AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+					return e, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	if err := s.applyMaintenanceWindows(context.Background(), base.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !window.Active || !reflect.DeepEqual(window.DisabledTasks, []string{"web1-cpu"}) || !reflect.DeepEqual(window.PendingTasks, []string{"web2-cpu"}) {
+		t.Fatalf("window after its start = %+v, want web1-cpu disabled and web2-cpu pending", window)
+	}
+
+	k.setBroken("web2-cpu", false)
+	if err := s.applyMaintenanceWindows(context.Background(), base.Add(90*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(window.DisabledTasks, []string{"web1-cpu", "web2-cpu"}) || len(window.PendingTasks) != 0 {
+		t.Fatalf("window after the retry = %+v, want both tasks disabled", window)
+	}
+	if got, want := k.statuses(), map[string]string{"web1-cpu": "disabled", "web2-cpu": "disabled"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("task status = %v, want %v", got, want)
+	}
+
+	if err := s.applyMaintenanceWindows(context.Background(), base.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := k.statuses(), map[string]string{"web1-cpu": "enabled", "web2-cpu": "enabled"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("task status after the end = %v, want %v", got, want)
+	}
+}
+
+func TestService_applyMaintenanceWindows_Overlapping(t *testing.T) {
+	k := newFakeKapacitor(t,
+		maintenanceRule("web1-cpu", "web1", "enabled"),
+		maintenanceRule("web2-cpu", "web2", "enabled"),
+	)
+	kapaSrv := httptest.NewServer(k)
+	defer kapaSrv.Close()
+
+	// the web1 upgrade runs from 1h to 3h, and the rack move of both web
+	// servers from 2h to 4h
+	base := time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC)
+	windows := []cloudhub.MaintenanceWindow{
+		{ID: "1", Name: "web1 upgrade", Organization: "default", KapacitorID: 1, Hosts: []string{"web1"},
+			Start: base.Add(time.Hour), End: base.Add(3 * time.Hour)},
+		{ID: "2", Name: "rack move", Organization: "default", KapacitorID: 1, Hosts: []string{"web1", "web2"},
+			Start: base.Add(2 * time.Hour), End: base.Add(4 * time.Hour)},
+	}
+	s := &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{ID: ID, Name: "kapa", URL: kapaSrv.URL}, nil
+				},
+			},
+			MaintenanceWindowsStore: &mocks.MaintenanceWindowsStore{
+				AllF: func(ctx context.Context) ([]cloudhub.MaintenanceWindow, error) {
+					return append([]cloudhub.MaintenanceWindow{}, windows...), nil
+				},
+				UpdateStateF: func(ctx context.Context, w *cloudhub.MaintenanceWindow) error {
+					for i := range windows {
+						if windows[i].ID == w.ID {
+							windows[i] = *w
+						}
+					}
+					return nil
+				},
+			},
+			AuditStore: &mocks.AuditStore{
+				AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+					return e, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	steps := []struct {
+		at   time.Duration
+		want map[string]string
+	}{
+		{at: time.Hour, want: map[string]string{"web1-cpu": "disabled", "web2-cpu": "enabled"}},
+		{at: 2 * time.Hour, want: map[string]string{"web1-cpu": "disabled", "web2-cpu": "disabled"}},
+		// the rack move is still under way
+		{at: 3 * time.Hour, want: map[string]string{"web1-cpu": "disabled", "web2-cpu": "disabled"}},
+		{at: 4 * time.Hour, want: map[string]string{"web1-cpu": "enabled", "web2-cpu": "enabled"}},
+	}
+	for _, step := range steps {
+		if err := s.applyMaintenanceWindows(context.Background(), base.Add(step.at)); err != nil {
+			t.Fatal(err)
+		}
+		if got := k.statuses(); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("task status at %s = %v, want %v; windows %+v", step.at, got, step.want, windows)
+		}
+	}
+	for _, w := range windows {
+		if w.Active || len(w.DisabledTasks) != 0 {
+			t.Errorf("window %s after its end = %+v, want it inactive", w.Name, w)
+		}
+	}
+}
+
+func TestService_NewMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantState  string
+	}{
+		{
+			name:       "One-off window",
+			body:       `{"name": "db upgrade", "hosts": ["db1"], "start": "2023-04-03T01:00:00Z", "end": "2023-04-03T02:00:00Z"}`,
+			wantStatus: http.StatusCreated,
+			wantState:  maintenanceStateScheduled,
+		},
+		{
+			name:       "Recurring window",
+			body:       `{"name": "nightly", "cron": "0 2 * * *", "duration": "30m", "timezone": "Asia/Seoul"}`,
+			wantStatus: http.StatusCreated,
+			wantState:  maintenanceStateScheduled,
+		},
+		{
+			name:       "Past window",
+			body:       `{"name": "past", "start": "2023-04-01T01:00:00Z", "end": "2023-04-01T02:00:00Z"}`,
+			wantStatus: http.StatusCreated,
+			wantState:  maintenanceStateExpired,
+		},
+		{
+			name:       "Missing end",
+			body:       `{"name": "db upgrade", "start": "2023-04-03T01:00:00Z"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Invalid cron",
+			body:       `{"name": "nightly", "cron": "0 25 * * *", "duration": "30m"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Cron without duration",
+			body:       `{"name": "nightly", "cron": "0 2 * * *"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added *cloudhub.MaintenanceWindow
+			s := &Service{
+				Store: &mocks.Store{
+					ServersStore: &mocks.ServersStore{
+						GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+							return cloudhub.Server{ID: ID, SrcID: 1, Name: "kapa"}, nil
+						},
+					},
+					MaintenanceWindowsStore: &mocks.MaintenanceWindowsStore{
+						AddF: func(ctx context.Context, w *cloudhub.MaintenanceWindow) (*cloudhub.MaintenanceWindow, error) {
+							w.ID = "1"
+							added = w
+							return w, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+				Now:    func() time.Time { return time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC) },
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/sources/1/kapacitors/2/maintenance", bytes.NewBufferString(tt.body))
+			r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+				{Key: "id", Value: "1"},
+				{Key: "kid", Value: "2"},
+			}))
+			s.NewMaintenanceWindow(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("NewMaintenanceWindow() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			if added.KapacitorID != 2 {
+				t.Errorf("NewMaintenanceWindow() kapacitor = %d, want 2", added.KapacitorID)
+			}
+
+			var res maintenanceWindowResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.State != tt.wantState {
+				t.Errorf("NewMaintenanceWindow() state = %q, want %q", res.State, tt.wantState)
+			}
+			if res.Links.Self != "/cloudhub/v1/sources/1/kapacitors/2/maintenance/1" {
+				t.Errorf("NewMaintenanceWindow() self = %q", res.Links.Self)
+			}
+			if tt.wantState == maintenanceStateScheduled && (res.NextStart == nil || res.NextEnd == nil) {
+				t.Errorf("NewMaintenanceWindow() of a scheduled window without its next occurrence")
+			}
+		})
+	}
+}
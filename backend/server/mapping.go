@@ -62,7 +62,7 @@ func applyMapping(m cloudhub.Mapping, p oauth2.Principal) bool {
 	}
 
 	switch m.Scheme {
-	case cloudhub.MappingWildcard, "oauth2":
+	case cloudhub.MappingWildcard, principalScheme(p):
 	default:
 		return false
 	}
@@ -188,7 +188,7 @@ func (s *Service) NewMapping(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &req.Organization});
 	msg := fmt.Sprintf(MsgMappingCreated.String(), org.Name)
-	s.logRegistration(ctx, "Mappings", msg)
+	s.logChange(ctx, "Mappings", msg, nil, m)
 
 	cu := newMappingResponse(*m)
 	location(w, cu.Links.Self)
@@ -216,6 +216,16 @@ func (s *Service) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := s.Store.Mappings(ctx).Get(ctx, req.ID)
+	if err == cloudhub.ErrMappingNotFound {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "failed to retrieve mapping from database", s.Logger)
+		return
+	}
+
 	mapping := &cloudhub.Mapping{
 		ID:                   req.ID,
 		Organization:         req.Organization,
@@ -224,7 +234,7 @@ func (s *Service) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 		ProviderOrganization: req.ProviderOrganization,
 	}
 
-	err := s.Store.Mappings(ctx).Update(ctx, mapping)
+	err = s.Store.Mappings(ctx).Update(ctx, mapping)
 	if err != nil {
 		Error(w, http.StatusInternalServerError, "failed to update mapping in database", s.Logger)
 		return
@@ -233,7 +243,7 @@ func (s *Service) UpdateMapping(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &mapping.Organization});
 	msg := fmt.Sprintf(MsgMappingModified.String(), org.Name)
-	s.logRegistration(ctx, "Mappings", msg)
+	s.logChange(ctx, "Mappings", msg, before, mapping)
 	
 	cu := newMappingResponse(*mapping)
 	location(w, cu.Links.Self)
@@ -264,7 +274,7 @@ func (s *Service) RemoveMapping(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &mapping.Organization});
 	msg := fmt.Sprintf(MsgMappingDeleted.String(), org.Name)
-	s.logRegistration(ctx, "Mappings", msg)
+	s.logChange(ctx, "Mappings", msg, mapping, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -210,6 +210,15 @@ func TestMappings_Update(t *testing.T) {
 					},
 				},
 				MappingsStore: &mocks.MappingsStore{
+					GetF: func(ctx context.Context, id string) (*cloudhub.Mapping, error) {
+						return &cloudhub.Mapping{
+							ID:                   "1",
+							Organization:         "0",
+							Provider:             "github",
+							Scheme:               "oauth2",
+							ProviderOrganization: "*",
+						}, nil
+					},
 					UpdateF: func(ctx context.Context, m *cloudhub.Mapping) error {
 						return nil
 					},
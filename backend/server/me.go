@@ -59,12 +59,18 @@ func newMeResponse(usr *cloudhub.User, org string) meResponse {
 // support for other authentication schemes.
 func getScheme(ctx context.Context) (string, error) {
 	principal, _ := getPrincipal(ctx)
-	
-	if principal.Issuer == "cloudhub" {
-		return "basic", nil
-	} 
-	
-	return "oauth2", nil
+	return principalScheme(principal), nil
+}
+
+// principalScheme is the scheme of the users the principal authenticates as
+func principalScheme(p oauth2.Principal) string {
+	switch p.Issuer {
+	case BasicProvider:
+		return BasicScheme
+	case oauth2.LDAPProviderName:
+		return LDAPScheme
+	}
+	return "oauth2"
 }
 
 func getPrincipal(ctx context.Context) (oauth2.Principal, error) {
@@ -107,6 +113,10 @@ func (s *Service) UpdateMe(auth oauth2.Authenticator) func(http.ResponseWriter,
 			Error(w, http.StatusForbidden, "invalid principal", s.Logger)
 			return
 		}
+		if principal.Issuer == APITokenProvider {
+			Error(w, http.StatusForbidden, "API tokens have no user", s.Logger)
+			return
+		}
 		var req meRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			invalidJSON(w, s.Logger)
@@ -211,6 +221,11 @@ func (s *Service) Me(w http.ResponseWriter, r *http.Request) {
 		invalidData(w, err, s.Logger)
 		return
 	}
+	// API tokens are not users; never create a user for one
+	if p.Issuer == APITokenProvider {
+		Error(w, http.StatusForbidden, "API tokens have no user", s.Logger)
+		return
+	}
 	scheme, err := getScheme(ctx)
 	if err != nil {
 		invalidData(w, err, s.Logger)
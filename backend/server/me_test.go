@@ -330,6 +330,190 @@ func TestService_Me(t *testing.T) {
 			wantContentType: "application/json",
 			wantBody:        `{"name":"secret","superAdmin":true,"roles":[{"name":"viewer","organization":"0"}],"provider":"auth0","scheme":"oauth2","links":{"self":"/cloudhub/v1/organizations/0/users/0"},"organizations":[{"id":"0","name":"The Gnarly Default","defaultRole":"viewer"}],"currentOrganization":{"id":"0","name":"The Gnarly Default","defaultRole":"viewer"}}`,
 		},
+		{
+			name: "new LDAP user - mapped by LDAP group",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest("GET", "http://example.com/foo", nil),
+			},
+			fields: fields{
+				UseAuth: true,
+				Logger:  log.New(log.DebugLevel),
+				ConfigStore: &mocks.ConfigStore{
+					Config: &cloudhub.Config{
+						Auth: cloudhub.AuthConfig{
+							SuperAdminNewUsers: false,
+						},
+					},
+				},
+				MappingsStore: &mocks.MappingsStore{
+					AllF: func(ctx context.Context) ([]cloudhub.Mapping, error) {
+						return []cloudhub.Mapping{
+							{
+								Organization:         "1",
+								Provider:             "ldap",
+								Scheme:               "ldap",
+								ProviderOrganization: "ops",
+							},
+							{
+								Organization:         "2",
+								Provider:             "ldap",
+								Scheme:               "ldap",
+								ProviderOrganization: "hr",
+							},
+							{
+								Organization:         "3",
+								Provider:             cloudhub.MappingWildcard,
+								Scheme:               "oauth2",
+								ProviderOrganization: cloudhub.MappingWildcard,
+							},
+						}, nil
+					},
+				},
+				OrganizationsStore: &mocks.OrganizationsStore{
+					DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{
+							ID:          "0",
+							Name:        "Default",
+							DefaultRole: roles.ViewerRoleName,
+						}, nil
+					},
+					GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{
+							ID:          *q.ID,
+							Name:        "Org " + *q.ID,
+							DefaultRole: roles.EditorRoleName,
+						}, nil
+					},
+					AllF: func(ctx context.Context) ([]cloudhub.Organization, error) {
+						return []cloudhub.Organization{
+							{
+								ID:          "1",
+								Name:        "Org 1",
+								DefaultRole: roles.EditorRoleName,
+							},
+						}, nil
+					},
+				},
+				UsersStore: &mocks.UsersStore{
+					NumF: func(ctx context.Context) (int, error) {
+						return 1, nil
+					},
+					GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+						if *q.Provider != "ldap" || *q.Scheme != "ldap" {
+							return nil, fmt.Errorf("Invalid user query: want provider ldap and scheme ldap")
+						}
+						return nil, cloudhub.ErrUserNotFound
+					},
+					AddF: func(ctx context.Context, u *cloudhub.User) (*cloudhub.User, error) {
+						return u, nil
+					},
+					UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+						return nil
+					},
+				},
+			},
+			principal: oauth2.Principal{
+				Subject: "alice",
+				Issuer:  "ldap",
+				Group:   "ops,dba",
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"alice","roles":[{"name":"editor","organization":"1"}],"provider":"ldap","scheme":"ldap","links":{"self":"/cloudhub/v1/organizations/0/users/0"},"organizations":[{"id":"1","name":"Org 1","defaultRole":"editor"}],"currentOrganization":{"id":"0","name":"Org 0","defaultRole":"editor"}}`,
+		},
+		{
+			name: "new SAML user - mapped by SAML group",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest("GET", "http://example.com/foo", nil),
+			},
+			fields: fields{
+				UseAuth: true,
+				Logger:  log.New(log.DebugLevel),
+				ConfigStore: &mocks.ConfigStore{
+					Config: &cloudhub.Config{
+						Auth: cloudhub.AuthConfig{
+							SuperAdminNewUsers: false,
+						},
+					},
+				},
+				MappingsStore: &mocks.MappingsStore{
+					AllF: func(ctx context.Context) ([]cloudhub.Mapping, error) {
+						return []cloudhub.Mapping{
+							{
+								Organization:         "1",
+								Provider:             "saml",
+								Scheme:               "oauth2",
+								ProviderOrganization: "ops",
+							},
+							{
+								Organization:         "2",
+								Provider:             "saml",
+								Scheme:               "oauth2",
+								ProviderOrganization: "hr",
+							},
+							{
+								Organization:         "3",
+								Provider:             "ldap",
+								Scheme:               "ldap",
+								ProviderOrganization: "ops",
+							},
+						}, nil
+					},
+				},
+				OrganizationsStore: &mocks.OrganizationsStore{
+					DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{
+							ID:          "0",
+							Name:        "Default",
+							DefaultRole: roles.ViewerRoleName,
+						}, nil
+					},
+					GetF: func(ctx context.Context, q cloudhub.OrganizationQuery) (*cloudhub.Organization, error) {
+						return &cloudhub.Organization{
+							ID:          *q.ID,
+							Name:        "Org " + *q.ID,
+							DefaultRole: roles.EditorRoleName,
+						}, nil
+					},
+					AllF: func(ctx context.Context) ([]cloudhub.Organization, error) {
+						return []cloudhub.Organization{
+							{
+								ID:          "1",
+								Name:        "Org 1",
+								DefaultRole: roles.EditorRoleName,
+							},
+						}, nil
+					},
+				},
+				UsersStore: &mocks.UsersStore{
+					NumF: func(ctx context.Context) (int, error) {
+						return 1, nil
+					},
+					GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+						if *q.Provider != "saml" || *q.Scheme != "oauth2" {
+							return nil, fmt.Errorf("Invalid user query: want provider saml and scheme oauth2")
+						}
+						return nil, cloudhub.ErrUserNotFound
+					},
+					AddF: func(ctx context.Context, u *cloudhub.User) (*cloudhub.User, error) {
+						return u, nil
+					},
+					UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+						return nil
+					},
+				},
+			},
+			principal: oauth2.Principal{
+				Subject: "marty@example.com",
+				Issuer:  "saml",
+				Group:   "ops,dev",
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"name":"marty@example.com","roles":[{"name":"editor","organization":"1"}],"provider":"saml","scheme":"oauth2","links":{"self":"/cloudhub/v1/organizations/0/users/0"},"organizations":[{"id":"1","name":"Org 1","defaultRole":"editor"}],"currentOrganization":{"id":"0","name":"Org 0","defaultRole":"editor"}}`,
+		},
 		{
 			name: "New user - New users not super admin, not first user",
 			args: args{
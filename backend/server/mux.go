@@ -34,13 +34,15 @@ type MuxOpts struct {
 	UseAuth               bool                 // UseAuth turns on Github OAuth and JWT
 	Auth                  oauth2.Authenticator // Auth is used to authenticate and authorize
 	ProviderFuncs         []func(func(oauth2.Provider, oauth2.Mux))
-	StatusFeedURL         string               // JSON Feed URL for the client Status page News Feed
-	CustomLinks           []CustomLink         // Any custom external links for client's User menu
-	PprofEnabled          bool                 // Mount pprof routes for profiling
-	DisableGZip           bool                 // Optionally disable gzip.
-	BasicAuth             *basicAuth.BasicAuth // HTTP basic authentication provider
-	PasswordPolicy        string               // Password validity rules
-	PasswordPolicyMessage string               // Password validity rule description
+	StatusFeedURL         string                  // JSON Feed URL for the client Status page News Feed
+	CustomLinks           []CustomLink            // Any custom external links for client's User menu
+	PprofEnabled          bool                    // Mount pprof routes for profiling
+	DisableGZip           bool                    // Optionally disable gzip.
+	BasicAuth             *basicAuth.BasicAuth    // HTTP basic authentication provider
+	LDAP                  oauth2.PasswordProvider // LDAP directory authenticating users by password
+	SAML                  *oauth2.SAML            // SAML 2.0 service provider for single sign-on
+	PasswordPolicy        string                  // Password validity rules
+	PasswordPolicyMessage string                  // Password validity rule description
 }
 
 // NewMux attaches all the route handlers; handler returned servers cloudhub.
@@ -159,14 +161,39 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	// websocket
 	router.GET("/cloudhub/v1/WebTerminalHandler", EnsureAdmin(service.WebTerminalHandler))
 
+	// SSH host keys of the web terminal
+	router.GET("/cloudhub/v1/host_keys", EnsureAdmin(service.HostKeys))
+	router.POST("/cloudhub/v1/host_keys/:id/approve", EnsureAdmin(service.ApproveHostKey))
+	router.DELETE("/cloudhub/v1/host_keys/:id", EnsureAdmin(service.RemoveHostKey))
+
+	// Saved web terminal connections
+	router.GET("/cloudhub/v1/terminal_profiles", EnsureAdmin(service.TerminalProfiles))
+	router.POST("/cloudhub/v1/terminal_profiles", EnsureAdmin(service.NewTerminalProfile))
+	router.GET("/cloudhub/v1/terminal_profiles/:id", EnsureAdmin(service.TerminalProfileByID))
+	router.PATCH("/cloudhub/v1/terminal_profiles/:id", EnsureAdmin(service.UpdateTerminalProfile))
+	router.DELETE("/cloudhub/v1/terminal_profiles/:id", EnsureAdmin(service.RemoveTerminalProfile))
+
+	// Recorded web terminal sessions
+	router.GET("/cloudhub/v1/terminal_recordings", EnsureAdmin(service.TerminalRecordings))
+	router.GET("/cloudhub/v1/terminal_recordings/:id", EnsureAdmin(service.TerminalRecordingByID))
+	router.GET("/cloudhub/v1/terminal_recordings/:id/download", EnsureAdmin(service.DownloadTerminalRecording))
+	router.GET("/cloudhub/v1/terminal_recordings/:id/replay", EnsureAdmin(service.ReplayTerminalRecording))
+
 	/* Health */
 	router.GET("/ping", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
 
+	/* Kapacitor alert ingestion, authenticated by the token of the kapacitor */
+	router.POST("/alerts/kapacitors/:kid/rules/:tid", service.IngestAlert)
+
 	/* API (Provider=cloudhub, Scheme=basic)  */
 	// Login, Logout
 	router.POST("/basic/login", service.Login(opts.Auth, opts.Basepath))
 	router.GET("/basic/logout", service.Logout(opts.Auth, opts.Basepath))
 
+	// Second login step of users with two-factor authentication
+	router.POST("/basic/login/totp", service.LoginTOTP(opts.Auth))
+	router.POST("/basic/login/totp/enroll", service.LoginTOTPEnroll)
+
 	// User sign up
 	router.POST("/basic/users", service.NewBasicUser)
 
@@ -178,8 +205,16 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 
 	// User password reset
 	router.GET("/basic/password/reset", service.UserPwdReset)
+	router.POST("/basic/password/reset/confirm", service.UserPwdResetConfirm)
 	router.GET("/cloudhub/v1/password/reset", EnsureAdmin(service.UserPwdAdminReset))
 
+	/* API (Provider=ldap, Scheme=ldap) */
+	// Login, Logout
+	if opts.LDAP != nil {
+		router.POST("/ldap/login", service.LDAPLogin(opts.Auth, opts.LDAP))
+		router.GET("/ldap/logout", service.Logout(opts.Auth, opts.Basepath))
+	}
+
 	/* API */
 	// Organizations
 	router.GET("/cloudhub/v1/organizations", EnsureViewer(service.Organizations))
@@ -230,6 +265,10 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	// intended for CloudHub Users with the Viewer Role type.
 	router.POST("/cloudhub/v1/sources/:id/queries", EnsureViewer(service.Queries))
 
+	// Backtest evaluates an alert rule against the history of the source
+	// without creating it in any kapacitor
+	router.POST("/cloudhub/v1/sources/:id/backtest", EnsureViewer(service.Backtest))
+
 	// Annotations are user-defined events associated with this source
 	router.GET("/cloudhub/v1/sources/:id/annotations", EnsureViewer(service.Annotations))
 	router.POST("/cloudhub/v1/sources/:id/annotations", EnsureEditor(service.NewAnnotation))
@@ -272,6 +311,11 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	// Salt Proxy
 	router.POST("/cloudhub/v1/proxy/salt", EnsureViewer(service.SaltProxyPost))
 
+	// Salt jobs submitted by CloudHub
+	router.GET("/cloudhub/v1/salt/jobs", EnsureAdmin(service.SaltJobs))
+	router.GET("/cloudhub/v1/salt/jobs/:jid", EnsureAdmin(service.SaltJobByID))
+	router.POST("/cloudhub/v1/salt/jobs/:jid/rerun", EnsureAdmin(service.RerunSaltJob))
+
 	// Kapacitor
 	router.GET("/cloudhub/v1/sources/:id/kapacitors", EnsureViewer(service.Kapacitors))
 	router.POST("/cloudhub/v1/sources/:id/kapacitors", EnsureEditor(service.NewKapacitor))
@@ -289,6 +333,35 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", EnsureEditor(service.KapacitorRulesStatus))
 	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/rules/:tid", EnsureEditor(service.KapacitorRulesDelete))
 
+	// Kapacitor topics and their handlers
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/topics", EnsureViewer(service.KapacitorTopics))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/events", EnsureViewer(service.KapacitorTopicEvents))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers", EnsureViewer(service.KapacitorTopicHandlers))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers", EnsureEditor(service.KapacitorTopicHandlersPost))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers/:hid", EnsureViewer(service.KapacitorTopicHandlerID))
+	router.PUT("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers/:hid", EnsureEditor(service.KapacitorTopicHandlersPut))
+	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/topics/:topic/handlers/:hid", EnsureEditor(service.KapacitorTopicHandlersDelete))
+
+	// Kapacitor alert timeline
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/alerts", EnsureViewer(service.KapacitorAlerts))
+
+	// Kapacitor maintenance windows
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/maintenance", EnsureViewer(service.MaintenanceWindows))
+	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/maintenance", EnsureEditor(service.NewMaintenanceWindow))
+	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/maintenance/:wid", EnsureViewer(service.MaintenanceWindowByID))
+	router.PATCH("/cloudhub/v1/sources/:id/kapacitors/:kid/maintenance/:wid", EnsureEditor(service.UpdateMaintenanceWindow))
+	router.DELETE("/cloudhub/v1/sources/:id/kapacitors/:kid/maintenance/:wid", EnsureEditor(service.RemoveMaintenanceWindow))
+
+	// Rule Templates
+	router.GET("/cloudhub/v1/rule-templates", EnsureViewer(service.RuleTemplates))
+	router.POST("/cloudhub/v1/rule-templates", EnsureEditor(service.NewRuleTemplate))
+	router.GET("/cloudhub/v1/rule-templates/:id", EnsureViewer(service.RuleTemplateByID))
+	router.PATCH("/cloudhub/v1/rule-templates/:id", EnsureEditor(service.UpdateRuleTemplate))
+	router.DELETE("/cloudhub/v1/rule-templates/:id", EnsureEditor(service.RemoveRuleTemplate))
+	router.POST("/cloudhub/v1/rule-templates/:id/instances", EnsureEditor(service.NewRuleTemplateInstances))
+	router.GET("/cloudhub/v1/rule-templates/:id/drift", EnsureViewer(service.RuleTemplateDrift))
+	router.POST("/cloudhub/v1/rule-templates/:id/sync", EnsureEditor(service.SyncRuleTemplate))
+
 	// Kapacitor Proxy
 	router.GET("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", EnsureViewer(service.ProxyGet))
 	router.POST("/cloudhub/v1/sources/:id/kapacitors/:kid/proxy", EnsureEditor(service.ProxyPost))
@@ -309,6 +382,11 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	// Set current cloudhub organization the user is logged into
 	router.PUT("/cloudhub/v1/me", service.UpdateMe(opts.Auth))
 
+	// Two-factor authentication of the current basic user
+	router.POST("/cloudhub/v1/me/totp", service.EnrollMeTOTP)
+	router.POST("/cloudhub/v1/me/totp/verify", service.VerifyMeTOTP)
+	router.DELETE("/cloudhub/v1/me/totp", service.DisableMeTOTP)
+
 	// TODO: what to do about admin's being able to set superadmin
 	router.GET("/cloudhub/v1/organizations/:oid/users", EnsureAdmin(ensureOrgMatches(service.Users)))
 	router.POST("/cloudhub/v1/organizations/:oid/users", EnsureAdmin(ensureOrgMatches(service.OrganizationNewUser)))
@@ -316,6 +394,12 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.GET("/cloudhub/v1/organizations/:oid/users/:id", EnsureAdmin(ensureOrgMatches(service.UserID)))
 	router.DELETE("/cloudhub/v1/organizations/:oid/users/:id", EnsureAdmin(ensureOrgMatches(service.OrganizationRemoveUser)))
 	router.PATCH("/cloudhub/v1/organizations/:oid/users/:id", EnsureAdmin(ensureOrgMatches(service.OrganizationUpdateUser)))
+	router.DELETE("/cloudhub/v1/organizations/:oid/users/:id/totp", EnsureAdmin(ensureOrgMatches(service.ResetUserTOTP)))
+
+	// API tokens of service accounts
+	router.GET("/cloudhub/v1/organizations/:oid/tokens", EnsureAdmin(ensureOrgMatches(service.APITokens)))
+	router.POST("/cloudhub/v1/organizations/:oid/tokens", EnsureAdmin(ensureOrgMatches(service.NewAPIToken)))
+	router.DELETE("/cloudhub/v1/organizations/:oid/tokens/:tid", EnsureAdmin(ensureOrgMatches(service.RemoveAPIToken)))
 
 	router.GET("/cloudhub/v1/users", EnsureSuperAdmin(rawStoreAccess(service.Users)))
 	router.POST("/cloudhub/v1/users", EnsureSuperAdmin(rawStoreAccess(service.NewUser)))
@@ -323,6 +407,7 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.GET("/cloudhub/v1/users/:id", EnsureViewer(service.UserID))
 	router.DELETE("/cloudhub/v1/users/:id", EnsureSuperAdmin(rawStoreAccess(service.RemoveUser)))
 	router.PATCH("/cloudhub/v1/users/:id", EnsureViewer(service.UpdateUser))
+	router.DELETE("/cloudhub/v1/users/:id/totp", EnsureSuperAdmin(rawStoreAccess(service.ResetUserTOTP)))
 
 	// Dashboards
 	router.GET("/cloudhub/v1/dashboards", EnsureViewer(service.Dashboards))
@@ -333,6 +418,11 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.PUT("/cloudhub/v1/dashboards/:id", EnsureEditor(service.ReplaceDashboard))
 	router.PATCH("/cloudhub/v1/dashboards/:id", EnsureEditor(service.UpdateDashboard))
 
+	// Dashboard Bundles
+	router.GET("/cloudhub/v1/dashboards/:id/export", EnsureViewer(service.ExportDashboard))
+	// POST /cloudhub/v1/dashboards/import
+	router.POST("/cloudhub/v1/dashboards/:id", EnsureEditor(paramEquals("id", "import", service.ImportDashboard, opts.Logger)))
+
 	// Dashboard Cells
 	router.GET("/cloudhub/v1/dashboards/:id/cells", EnsureViewer(service.DashboardCells))
 	router.POST("/cloudhub/v1/dashboards/:id/cells", EnsureEditor(service.NewDashboardCell))
@@ -349,6 +439,12 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.DELETE("/cloudhub/v1/dashboards/:id/templates/:tid", EnsureEditor(service.RemoveTemplate))
 	router.PUT("/cloudhub/v1/dashboards/:id/templates/:tid", EnsureEditor(service.ReplaceTemplate))
 
+	// Dashboard Revisions
+	router.GET("/cloudhub/v1/dashboards/:id/revisions", EnsureViewer(service.DashboardRevisions))
+	router.GET("/cloudhub/v1/dashboards/:id/revisions/:rid", EnsureViewer(service.DashboardRevisionID))
+	router.GET("/cloudhub/v1/dashboards/:id/revisions/:rid/diff", EnsureViewer(service.DashboardRevisionDiff))
+	router.POST("/cloudhub/v1/dashboards/:id/revisions/:rid/restore", EnsureEditor(service.RestoreDashboardRevision))
+
 	// Databases
 	router.GET("/cloudhub/v1/sources/:id/dbs", EnsureViewer(service.GetDatabases))
 	router.POST("/cloudhub/v1/sources/:id/dbs", EnsureEditor(service.NewDatabase))
@@ -370,10 +466,21 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	router.GET("/cloudhub/v1/config/auth", EnsureSuperAdmin(service.AuthConfig))
 	router.PUT("/cloudhub/v1/config/auth", EnsureSuperAdmin(service.ReplaceAuthConfig))
 
+	// Online backup of the whole store
+	router.GET("/cloudhub/v1/backup", EnsureSuperAdmin(service.Backup))
+
 	// Organization config settings for CloudHub
 	router.GET("/cloudhub/v1/org_config", EnsureViewer(service.OrganizationConfig))
 	router.GET("/cloudhub/v1/org_config/logviewer", EnsureViewer(service.OrganizationLogViewerConfig))
 	router.PUT("/cloudhub/v1/org_config/logviewer", EnsureEditor(service.ReplaceOrganizationLogViewerConfig))
+	router.GET("/cloudhub/v1/org_config/dashboard_revisions", EnsureViewer(service.OrganizationDashboardRevisionsConfig))
+	router.PUT("/cloudhub/v1/org_config/dashboard_revisions", EnsureAdmin(service.ReplaceOrganizationDashboardRevisionsConfig))
+	router.GET("/cloudhub/v1/org_config/two_factor", EnsureViewer(service.OrganizationTwoFactorConfig))
+	router.PUT("/cloudhub/v1/org_config/two_factor", EnsureAdmin(service.ReplaceOrganizationTwoFactorConfig))
+	router.GET("/cloudhub/v1/org_config/terminal_recordings", EnsureViewer(service.OrganizationTerminalRecordingsConfig))
+	router.PUT("/cloudhub/v1/org_config/terminal_recordings", EnsureAdmin(service.ReplaceOrganizationTerminalRecordingsConfig))
+	router.GET("/cloudhub/v1/org_config/salt_policy", EnsureViewer(service.OrganizationSaltPolicyConfig))
+	router.PUT("/cloudhub/v1/org_config/salt_policy", EnsureAdmin(service.ReplaceOrganizationSaltPolicyConfig))
 
 	router.GET("/cloudhub/v1/env", EnsureViewer(service.Environment))
 
@@ -433,6 +540,9 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	// http logging
 	router.POST("/cloudhub/v1/logging", EnsureViewer(service.HTTPLogging))
 
+	// Audit log
+	router.GET("/cloudhub/v1/audit", EnsureAdmin(service.AuditEvents))
+
 	// login locked
 	router.PATCH("/cloudhub/v1/login/locked", EnsureAdmin(service.LockedUser))
 
@@ -452,6 +562,7 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 			Logout: "/basic/logout",
 		},
 		BasicLogoutLink:        "/basic/logout",
+		LDAPRoute:              ldapRoute(opts.LDAP),
 		LoginAuthType:          service.LoginAuthType,
 		BasicPasswordResetType: service.BasicPasswordResetType,
 		RetryPolicys:           service.RetryPolicy,
@@ -483,7 +594,7 @@ func NewMux(opts MuxOpts, service Service) http.Handler {
 	} else {
 		out = router
 	}
-	out = Logger(opts.Logger, FlushingHandler(out))
+	out = Logger(opts.Logger, RequestID(FlushingHandler(out)))
 
 	return out
 }
@@ -516,6 +627,29 @@ func AuthAPI(opts MuxOpts, router cloudhub.Router) (http.Handler, AuthRoutes) {
 		})
 	}
 
+	// The identity provider posts its response to the callback, and reads
+	// the keys of CloudHub from the metadata
+	if opts.SAML != nil {
+		urlName := url.PathEscape(strings.ToLower(opts.SAML.Name()))
+
+		loginPath := path.Join("/oauth", urlName, "login")
+		logoutPath := path.Join("/oauth", urlName, "logout")
+		callbackPath := path.Join("/oauth", urlName, "callback")
+		metadataPath := path.Join("/oauth", urlName, "metadata")
+
+		router.Handler("GET", loginPath, opts.SAML.Login())
+		router.Handler("GET", logoutPath, opts.SAML.Logout())
+		router.Handler("POST", callbackPath, opts.SAML.Callback())
+		router.Handler("GET", metadataPath, opts.SAML.Metadata())
+		routes = append(routes, AuthRoute{
+			Name:     opts.SAML.Name(),
+			Label:    strings.Title(opts.SAML.Name()),
+			Login:    path.Join(opts.Basepath, loginPath),
+			Logout:   path.Join(opts.Basepath, logoutPath),
+			Callback: path.Join(opts.Basepath, callbackPath),
+		})
+	}
+
 	rootPath := path.Join(opts.Basepath, "/cloudhub/v1")
 	logoutPath := path.Join(opts.Basepath, "/oauth/logout")
 
@@ -652,6 +786,19 @@ func paramInt64(key string, r *http.Request) (int64, error) {
 	return v, nil
 }
 
+// paramEquals serves next only if the route parameter key equals value.
+// httprouter does not allow a static path segment next to a wildcard, so
+// such routes are registered on the wildcard and matched here instead.
+func paramEquals(key, value string, next http.HandlerFunc, logger cloudhub.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if param := httprouter.GetParamFromContext(r.Context(), key); param != value {
+			Error(w, http.StatusNotFound, fmt.Sprintf("%s not found", r.URL.Path), logger)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func paramStr(key string, r *http.Request) (string, error) {
 	ctx := r.Context()
 	param := httprouter.GetParamFromContext(ctx, key)
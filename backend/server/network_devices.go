@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"path"
 	"reflect"
-	"regexp"
 	"strings"
 	"sync"
 
@@ -44,6 +43,9 @@ type updateDeviceRequest struct {
 type updateDeviceData struct {
 	id string
 	updateDeviceRequest
+	// r is the HTTP request of the update, if any; its If-Match header
+	// makes the update conditional
+	r *http.Request
 }
 
 type deleteDevicesRequest struct {
@@ -246,7 +248,7 @@ func (s *Service) createDevice(ctx context.Context, req createDeviceRequest) (*c
 		return nil, err
 	}
 	msg := fmt.Sprintf(MsgNetWorkDeviceCreated.String(), res.ID)
-	s.logRegistration(ctx, "NetWorkDevice", msg)
+	s.logChange(ctx, "NetWorkDevice", msg, nil, *res)
 
 	return res, nil
 }
@@ -260,20 +262,15 @@ func (s *Service) NewDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	allDevices, err := s.Store.NetworkDevice(ctx).All(ctx)
-	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
-		return
-	}
-
-	existingIPs := make(map[string]bool)
-	for _, device := range allDevices {
-		existingIPs[device.DeviceIP] = true
-	}
-
 	var failedDeviceList []createDeviceError
 	for i, req := range reqs {
-		if _, exists := existingIPs[req.DeviceIP]; exists {
+		// device IPs are unique across organizations
+		existing, err := s.Store.NetworkDevice(serverContext(ctx)).Find(ctx, cloudhub.NetworkDeviceQuery{DeviceIP: &req.DeviceIP})
+		if err != nil {
+			Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+			return
+		}
+		if len(existing) > 0 {
 			failedDeviceList = append(failedDeviceList, createDeviceError{
 				Index:        i,
 				DeviceIP:     req.DeviceIP,
@@ -310,24 +307,18 @@ func (s *Service) NewDevices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	allDevices, err := s.Store.NetworkDevice(ctx).All(ctx)
-	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
-		return
-	}
-
 	var failedDeviceList []createDeviceError
-	existingIPs := make(map[string]string)
-
-	for _, device := range allDevices {
-		existingIPs[device.DeviceIP] = device.ID
-	}
-
 	for i, req := range reqs {
 		currentReq := req
-		if id, exists := existingIPs[currentReq.DeviceIP]; exists {
+		// device IPs are unique across organizations
+		existing, err := s.Store.NetworkDevice(serverContext(ctx)).Find(ctx, cloudhub.NetworkDeviceQuery{DeviceIP: &currentReq.DeviceIP})
+		if err != nil {
+			Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
+			return
+		}
+		if len(existing) > 0 {
 			_, err := s.UpdateDevice(ctx, &updateDeviceData{
-				id: id,
+				id: existing[0].ID,
 				updateDeviceRequest: updateDeviceRequest{
 					Organization: &currentReq.Organization,
 					DeviceIP:     &currentReq.DeviceIP,
@@ -370,26 +361,19 @@ func (s *Service) NewDevices(w http.ResponseWriter, r *http.Request) {
 // AllDevices returns all devices within the store.
 func (s *Service) AllDevices(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	devices, err := s.Store.NetworkDevice(ctx).All(ctx)
-	if err != nil {
-		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
-		return
-	}
 	isSuperAdmin := hasSuperAdminContext(ctx)
 	currentOrg, ok := hasOrganizationContext(ctx)
 	if !ok {
 		Error(w, http.StatusInternalServerError, string(cloudhub.ErrOrganizationNotFound), s.Logger)
 		return
 	}
+	var q cloudhub.NetworkDeviceQuery
 	if !(isSuperAdmin && currentOrg == DefaultOrganizationID) {
-		devicesByOrg := devices[:0]
-		for _, d := range devices {
-			if d.Organization == currentOrg {
-				devicesByOrg = append(devicesByOrg, d)
-			}
-		}
-		res := newDevicesResponse(ctx, s, devicesByOrg)
-		encodeJSON(w, http.StatusOK, res, s.Logger)
+		q.Organization = &currentOrg
+	}
+	devices, err := s.Store.NetworkDevice(ctx).Find(ctx, q)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
 		return
 	}
 	res := newDevicesResponse(ctx, s, devices)
@@ -417,6 +401,7 @@ func (s *Service) DeviceID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, device.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -505,7 +490,7 @@ func (s *Service) RemoveDevices(w http.ResponseWriter, r *http.Request) {
 			}
 			if _, exists := restartCollectorServers[org.CollectorServer]; !exists {
 				restartCollectorServers[org.CollectorServer] = org.CollectorServer
-				_, _, err := s.restartDocker(org.CollectorServer)
+				_, err := s.restartDocker(ctx, org.CollectorServer)
 				if err != nil {
 					for _, devicesIDs := range devicesGroupByOrg {
 						for _, id := range devicesIDs {
@@ -518,8 +503,6 @@ func (s *Service) RemoveDevices(w http.ResponseWriter, r *http.Request) {
 		}
 		if currentOrg != nil {
 			err = s.Store.NetworkDeviceOrg(ctx).Update(ctx, &org)
-			msg := fmt.Sprintf(MsgNetWorkDeviceOrgModified.String(), org.ID)
-			s.logRegistration(ctx, "NetWorkDeviceOrg", msg)
 			if err != nil {
 				for _, devicesIDs := range devicesGroupByOrg {
 					for _, id := range devicesIDs {
@@ -528,6 +511,8 @@ func (s *Service) RemoveDevices(w http.ResponseWriter, r *http.Request) {
 				}
 				continue
 			}
+			msg := fmt.Sprintf(MsgNetWorkDeviceOrgModified.String(), org.ID)
+			s.logChange(ctx, "NetWorkDeviceOrg", msg, *currentOrg, org)
 		}
 	}
 
@@ -573,7 +558,7 @@ func (s *Service) RemoveDevices(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		msg := fmt.Sprintf(MsgNetWorkDeviceDeleted.String(), id)
-		s.logRegistration(ctx, "NetWorkDevice", msg)
+		s.logChange(ctx, "NetWorkDevice", msg, *device, nil)
 	}
 
 	response := make(map[string]interface{})
@@ -606,9 +591,13 @@ func (s *Service) UpdateNetworkDevice(w http.ResponseWriter, r *http.Request) {
 	updateData := updateDeviceData{
 		id:                  id,
 		updateDeviceRequest: req,
+		r:                   r,
 	}
 	device, err := s.UpdateDevice(ctx, &updateData)
-	if err != nil {
+	if err == cloudhub.ErrRevisionMismatch {
+		revisionConflict(w, r, s.Logger)
+		return
+	} else if err != nil {
 		Error(w, http.StatusUnprocessableEntity, err.Error(), s.Logger)
 		return
 	}
@@ -619,6 +608,7 @@ func (s *Service) UpdateNetworkDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, device.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -628,6 +618,12 @@ func (s *Service) UpdateDevice(ctx context.Context, req *updateDeviceData) (*clo
 	if err != nil {
 		return nil, fmt.Errorf("device not found: %v", err)
 	}
+	if req.r != nil {
+		if ctx, err = ifMatch(ctx, req.r, device.Revision); err != nil {
+			return nil, err
+		}
+	}
+	before := *device
 
 	isModified := false
 	if req.DeviceIP != nil && device.DeviceIP != *req.DeviceIP {
@@ -743,10 +739,16 @@ func (s *Service) UpdateDevice(ctx context.Context, req *updateDeviceData) (*clo
 	if err := s.OrganizationExists(ctx, device.Organization); err != nil {
 		return nil, fmt.Errorf("organization does not exist: %v", err)
 	}
-	if err := s.Store.NetworkDevice(ctx).Update(ctx, device); err != nil {
+	if err := s.Store.NetworkDevice(ctx).Update(ctx, device); err == cloudhub.ErrRevisionMismatch {
+		return nil, err
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to update device: %v", err)
 	}
 
+	// log registrationte
+	msg := fmt.Sprintf(MsgNetWorkDeviceModified.String(), device.ID)
+	s.logChange(ctx, "NetWorkDevice", msg, before, *device)
+
 	return device, nil
 }
 
@@ -789,6 +791,7 @@ func (s *Service) MonitoringConfigManagement(w http.ResponseWriter, r *http.Requ
 	devicesData := getDevicesGroupByOrg(ctx, s, request.CollectingDevices)
 	failedDevices := devicesData.failedDevices
 	restartCollectorServers := map[string]string{}
+	jobs := []*saltJobResponse{}
 
 	if len(devicesData.devicesGroupByOrg) < 1 {
 		for _, device := range request.CollectingDevices {
@@ -906,7 +909,7 @@ func (s *Service) MonitoringConfigManagement(w http.ResponseWriter, r *http.Requ
 		// Save unique collector servers to restartCollectorServers map
 		if _, exists := restartCollectorServers[orgInfo.CollectorServer]; !exists {
 			restartCollectorServers[orgInfo.CollectorServer] = orgInfo.CollectorServer
-			_, _, err := s.restartDocker(orgInfo.CollectorServer)
+			job, err := s.restartDocker(ctx, orgInfo.CollectorServer)
 			if err != nil {
 				for _, device := range devicesData.devicesGroupByOrg[org] {
 					if _, exists := failedDevices[device.ID]; !exists {
@@ -915,6 +918,7 @@ func (s *Service) MonitoringConfigManagement(w http.ResponseWriter, r *http.Requ
 				}
 				continue
 			}
+			jobs = append(jobs, newSaltJobResponse(job))
 		}
 
 		existOrg, err := s.Store.NetworkDeviceOrg(ctx).Get(ctx, cloudhub.NetworkDeviceOrgQuery{ID: &org})
@@ -941,6 +945,7 @@ func (s *Service) MonitoringConfigManagement(w http.ResponseWriter, r *http.Requ
 
 	response := map[string]interface{}{
 		"failed_devices": convertFailedDevicesToArray(failedDevices),
+		"jobs":           jobs,
 	}
 	encodeJSON(w, http.StatusCreated, response, s.Logger)
 }
@@ -1296,8 +1301,8 @@ func (s *Service) manageLogstashConfig(ctx context.Context, devOrg *cloudhub.Net
 		}
 
 		if !r.Return[0][devOrg.CollectorServer] {
-			if statusCode, _, err := s.MkdirWithLocalClient(dirPath, devOrg.CollectorServer); err != nil || statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
-				return statusCode, nil, err
+			if _, err := s.MkdirWithLocalClient(ctx, dirPath, devOrg.CollectorServer); err != nil {
+				return http.StatusInternalServerError, nil, err
 			}
 		}
 	} else {
@@ -1306,7 +1311,7 @@ func (s *Service) manageLogstashConfig(ctx context.Context, devOrg *cloudhub.Net
 
 	// If there are no devices to collect data from, remove the configuration file
 	if len(devicesIDs) < 1 {
-		statusCode, resp, err = s.RemoveFileWithLocalClient(filePath, devOrg.CollectorServer)
+		statusCode, resp, err = saltJobResult(s.RemoveFileWithLocalClient(ctx, filePath, devOrg.CollectorServer))
 		if err != nil {
 			return http.StatusInternalServerError, nil, err
 		} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
@@ -1395,7 +1400,7 @@ func (s *Service) manageLogstashConfig(ctx context.Context, devOrg *cloudhub.Net
 		return http.StatusInternalServerError, nil, err
 	}
 
-	statusCode, resp, err = s.CreateFileWithLocalClient(filePath, []string{configString}, devOrg.CollectorServer)
+	statusCode, resp, err = saltJobResult(s.CreateFileWithLocalClient(ctx, filePath, []string{configString}, devOrg.CollectorServer))
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
@@ -1407,36 +1412,12 @@ func (s *Service) manageLogstashConfig(ctx context.Context, devOrg *cloudhub.Net
 	return http.StatusOK, nil, err
 }
 
-func (s *Service) restartDocker(collectorServer string) (int, []byte, error) {
+// restartDocker submits the restart of the collector containers on
+// collectorServer without waiting for it, so a Logstash redeploy does not
+// hold the request open. The restart is followed as a Salt job.
+func (s *Service) restartDocker(ctx context.Context, collectorServer string) (*cloudhub.SaltJob, error) {
 	aiConfig := s.InternalENV.AIConfig
-	dockerPath := aiConfig.DockerPath
-	dockerCmd := aiConfig.DockerCmd
-
-	statusCode, resp, err := s.DockerRestart(dockerPath, collectorServer, dockerCmd)
-	if err != nil || statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
-		return statusCode, nil, err
-	} else if resp != nil {
-		r := &struct {
-			Return []map[string]string `json:"return"`
-		}{}
-		if err := json.Unmarshal(resp, r); err != nil {
-			return http.StatusInternalServerError, nil, err
-		}
-		// Check for the success message using regex
-		re := regexp.MustCompile(`(?i)(Restarting.*Started|Stopping .* done|Starting .* done)`)
-		for _, item := range r.Return {
-			for _, value := range item {
-				cleanedValue := strings.ReplaceAll(strings.ReplaceAll(value, "\n", ""), " ", "")
-				if !re.MatchString(cleanedValue) {
-					message := fmt.Errorf(value)
-					return http.StatusInternalServerError, nil, message
-				}
-			}
-		}
-	} else {
-		return http.StatusInternalServerError, nil, fmt.Errorf("Unknown error occurred at DirectoryExists() func")
-	}
-	return statusCode, resp, nil
+	return s.DockerRestart(ctx, aiConfig.DockerPath, collectorServer, aiConfig.DockerCmd)
 }
 
 // RemoveElements removes elements from the origin slice that are present in the delete slice.
@@ -323,7 +323,7 @@ func (s *Service) AddNetworkDeviceOrg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	msg := fmt.Sprintf(MsgNetWorkDeviceOrgCreated.String(), deviceOrg.ID)
-	s.logRegistration(ctx, "NetWorkDeviceOrg", msg)
+	s.logChange(ctx, "NetWorkDeviceOrg", msg, nil, *deviceOrg)
 	encodeJSON(w, http.StatusCreated, res, s.Logger)
 }
 
@@ -349,6 +349,7 @@ func (s *Service) NetworkDeviceOrgID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, deviceOrg.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -382,11 +383,16 @@ func (s *Service) UpdateNetworkDeviceOrg(w http.ResponseWriter, r *http.Request)
 		notFound(w, idStr, s.Logger)
 		return
 	}
+	if ctx, err = ifMatch(ctx, r, deviceOrg.Revision); err != nil {
+		revisionConflict(w, r, s.Logger)
+		return
+	}
 	org, err := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &idStr})
 	if err != nil {
 		notFound(w, idStr, s.Logger)
 		return
 	}
+	before := *deviceOrg
 	previousAIKapacitor = deviceOrg.AIKapacitor
 	deviceOrg.ProcCnt = req.ProcCnt
 
@@ -445,23 +451,24 @@ func (s *Service) UpdateNetworkDeviceOrg(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := s.Store.NetworkDeviceOrg(ctx).Update(ctx, deviceOrg); err != nil {
+	if err := s.Store.NetworkDeviceOrg(ctx).Update(ctx, deviceOrg); err == cloudhub.ErrRevisionMismatch {
+		revisionConflict(w, r, s.Logger)
+		return
+	} else if err != nil {
 		msg := fmt.Sprintf("Error updating Device Org ID %s: %v", idStr, err)
 		Error(w, http.StatusInternalServerError, msg, s.Logger)
 		return
 	}
 
-	msg := fmt.Sprintf(MsgNetWorkDeviceModified.String(), idStr)
-	s.logRegistration(ctx, "NetWorkDevice", msg)
-
 	res, err := newDeviceOrgResponse(deviceOrg)
 	if err != nil {
 		notFound(w, idStr, s.Logger)
 		return
 	}
 
-	msg = fmt.Sprintf(MsgNetWorkDeviceOrgModified.String(), idStr)
-	s.logRegistration(ctx, "NetWorkDeviceOrg", msg)
+	msg := fmt.Sprintf(MsgNetWorkDeviceOrgModified.String(), idStr)
+	s.logChange(ctx, "NetWorkDeviceOrg", msg, before, *deviceOrg)
+	setETag(w, deviceOrg.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -487,7 +494,7 @@ func (s *Service) RemoveNetworkDeviceOrg(w http.ResponseWriter, r *http.Request)
 	}
 
 	msg := fmt.Sprintf("Network Device Org with ID %s removed successfully", idStr)
-	s.logRegistration(ctx, "NetWorkDeviceOrg", msg)
+	s.logChange(ctx, "NetWorkDeviceOrg", msg, *deviceOrg, nil)
 	encodeJSON(w, http.StatusOK, map[string]string{"message": msg}, s.Logger)
 }
 
@@ -618,7 +625,7 @@ func manageLearningTask(ctx context.Context, s *Service, org *cloudhub.Organizat
 			return err
 		}
 		msg := fmt.Sprintf(MsgKapacitorModified.String(), updateTaskOptions.ID, org.Name)
-		s.logRegistration(ctx, "Kapacitors Task", msg)
+		s.logChange(ctx, "Kapacitors Task", msg, isExist.TICKScript, updateTaskOptions.TICKscript)
 		return nil
 	}
 	createTaskOptions := &client.CreateTaskOptions{
@@ -633,7 +640,7 @@ func manageLearningTask(ctx context.Context, s *Service, org *cloudhub.Organizat
 		return err
 	}
 	msg := fmt.Sprintf(MsgKapacitorRuleCreated.String(), createTaskOptions.ID, org.Name)
-	s.logRegistration(ctx, "Kapacitors Task", msg)
+	s.logChange(ctx, "Kapacitors Task", msg, nil, createTaskOptions.TICKscript)
 	return nil
 
 }
@@ -661,7 +668,7 @@ func deleteLearningTask(ctx context.Context, s *Service, org *cloudhub.Organizat
 	}
 
 	msg := fmt.Sprintf("Kapacitor task %s for organization %s deleted", kapaID, org.Name)
-	s.logRegistration(ctx, "Kapacitors Task", msg)
+	s.logChange(ctx, "Kapacitors Task", msg, task.TICKScript, nil)
 	return nil
 }
 
@@ -9,8 +9,12 @@ import (
 )
 
 type organizationConfigLinks struct {
-	Self      string `json:"self"`      // Self link mapping to this resource
-	LogViewer string `json:"logViewer"` // LogViewer link to the organization log viewer config endpoint
+	Self               string `json:"self"`               // Self link mapping to this resource
+	LogViewer          string `json:"logViewer"`          // LogViewer link to the organization log viewer config endpoint
+	DashboardRevisions string `json:"dashboardRevisions"` // DashboardRevisions link to the organization dashboard revisions config endpoint
+	TwoFactor          string `json:"twoFactor"`          // TwoFactor link to the organization two-factor authentication policy endpoint
+	TerminalRecordings string `json:"terminalRecordings"` // TerminalRecordings link to the organization terminal recordings config endpoint
+	SaltPolicy         string `json:"saltPolicy"`         // SaltPolicy link to the organization Salt policy endpoint
 }
 
 type organizationConfigResponse struct {
@@ -21,8 +25,12 @@ type organizationConfigResponse struct {
 func newOrganizationConfigResponse(c cloudhub.OrganizationConfig) *organizationConfigResponse {
 	return &organizationConfigResponse{
 		Links: organizationConfigLinks{
-			Self:      "/cloudhub/v1/org_config",
-			LogViewer: "/cloudhub/v1/org_config/logviewer",
+			Self:               "/cloudhub/v1/org_config",
+			LogViewer:          "/cloudhub/v1/org_config/logviewer",
+			DashboardRevisions: "/cloudhub/v1/org_config/dashboard_revisions",
+			TwoFactor:          "/cloudhub/v1/org_config/two_factor",
+			TerminalRecordings: "/cloudhub/v1/org_config/terminal_recordings",
+			SaltPolicy:         "/cloudhub/v1/org_config/salt_policy",
 		},
 		OrganizationConfig: c,
 	}
@@ -110,12 +118,17 @@ func (s *Service) ReplaceOrganizationLogViewerConfig(w http.ResponseWriter, r *h
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
 		return
 	}
+	before := config.LogViewer
 	config.LogViewer = logViewerConfig
 	if err := s.Store.OrganizationConfig(ctx).Put(ctx, config); err != nil {
 		unknownErrorWithMessage(w, err, s.Logger)
 		return
 	}
 
+	// log registrationte
+	msg := fmt.Sprintf(MsgLogViewerConfigModified.String(), orgID)
+	s.logChange(ctx, "Organizations", msg, before, config.LogViewer)
+
 	res := newLogViewerConfigResponse(config.LogViewer)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
@@ -153,7 +153,7 @@ func (s *Service) NewOrganization(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgOrganizationCreated.String(), res.Name)
-	s.logRegistration(ctx, "Organizations", msg)
+	s.logChange(ctx, "Organizations", msg, nil, res)
 
 	co := newOrganizationResponse(res)
 	location(w, co.Links.Self)
@@ -197,6 +197,7 @@ func (s *Service) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
 		return
 	}
+	before := *org
 
 	if req.Name != "" {
 		org.Name = req.Name
@@ -214,7 +215,7 @@ func (s *Service) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgOrganizationModified.String(), org.Name)
-	s.logRegistration(ctx, "Organizations", msg)
+	s.logChange(ctx, "Organizations", msg, before, org)
 
 	res := newOrganizationResponse(org)
 	location(w, res.Links.Self)
@@ -232,17 +233,15 @@ func (s *Service) RemoveOrganization(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusNotFound, err.Error(), s.Logger)
 		return
 	}
-	devices, err := s.Store.NetworkDevice(ctx).All(ctx)
+	devices, err := s.Store.NetworkDevice(ctx).Find(ctx, cloudhub.NetworkDeviceQuery{Organization: &org.ID})
 	if err != nil {
 		Error(w, http.StatusInternalServerError, err.Error(), s.Logger)
 		return
 	}
-	for _, device := range devices {
-		if device.Organization == org.ID {
-			msg := "The organization cannot be deleted because there are registered devices associated with it."
-			Error(w, http.StatusConflict, msg, s.Logger)
-			return
-		}
+	if len(devices) > 0 {
+		msg := "The organization cannot be deleted because there are registered devices associated with it."
+		Error(w, http.StatusConflict, msg, s.Logger)
+		return
 	}
 
 	if err := s.Store.Organizations(ctx).Delete(ctx, org); err != nil {
@@ -252,7 +251,7 @@ func (s *Service) RemoveOrganization(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgOrganizationDeleted.String(), org.Name)
-	s.logRegistration(ctx, "Organizations", msg)
+	s.logChange(ctx, "Organizations", msg, org, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrPasswordPolicy is returned for passwords the password policy rejects
+var ErrPasswordPolicy = fmt.Errorf("password does not satisfy the password policy")
+
+// PasswordPolicy checks passwords against the --password-policy regular
+// expression, as the UI does. The expression is a JavaScript one tested
+// case insensitively; the lookaheads it opens with, which Go does not
+// support, are checked one by one at every position of the password.
+type PasswordPolicy struct {
+	anchored   bool
+	lookaheads []policyLookahead
+	pattern    *regexp.Regexp
+}
+
+type policyLookahead struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// NewPasswordPolicy compiles the password policy expr
+func NewPasswordPolicy(expr string) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{}
+	rest := expr
+	if strings.HasPrefix(rest, "^") {
+		p.anchored = true
+		rest = rest[1:]
+	}
+
+	for strings.HasPrefix(rest, "(?=") || strings.HasPrefix(rest, "(?!") {
+		end := closingParen(rest)
+		if end < 0 {
+			return nil, fmt.Errorf("invalid password policy %q: unbalanced parentheses", expr)
+		}
+		re, err := regexp.Compile(`(?i)^(?:` + rest[3:end] + `)`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid password policy %q: %v", expr, err)
+		}
+		p.lookaheads = append(p.lookaheads, policyLookahead{re: re, negate: rest[2] == '!'})
+		rest = rest[end+1:]
+	}
+
+	re, err := regexp.Compile(`(?i)^(?:` + rest + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password policy %q: %v", expr, err)
+	}
+	p.pattern = re
+	return p, nil
+}
+
+// Allows reports whether password satisfies the policy
+func (p *PasswordPolicy) Allows(password string) bool {
+	for i := 0; i <= len(password); i++ {
+		if p.matchesAt(password[i:]) {
+			return true
+		}
+		if p.anchored {
+			break
+		}
+	}
+	return false
+}
+
+func (p *PasswordPolicy) matchesAt(s string) bool {
+	for _, l := range p.lookaheads {
+		if l.re.MatchString(s) == l.negate {
+			return false
+		}
+	}
+	return p.pattern.MatchString(s)
+}
+
+// closingParen returns the index of the parenthesis closing the group s
+// opens with, skipping escapes and character classes, or -1.
+func closingParen(s string) int {
+	depth := 0
+	inClass := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+			// a ] right after the opening bracket is literal
+			if i+1 < len(s) && s[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(s) && s[i+1] == ']' {
+				i++
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
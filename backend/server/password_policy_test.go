@@ -0,0 +1,65 @@
+package server
+
+import "testing"
+
+func TestPasswordPolicy_Allows(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		password string
+		want     bool
+	}{
+		{
+			name:     "Digit, special character and letters",
+			policy:   `(?=.*[0-9]{1,50})(?=.*[~!@#$%\^&*()-+=]{1,50})(?=.*[a-zA-Z]{2,50}).{8,50}$`,
+			password: "cloud!hub2",
+			want:     true,
+		},
+		{
+			name:     "Missing a special character",
+			policy:   `(?=.*[0-9]{1,50})(?=.*[~!@#$%\^&*()-+=]{1,50})(?=.*[a-zA-Z]{2,50}).{8,50}$`,
+			password: "cloudhub22",
+		},
+		{
+			name:     "Too short",
+			policy:   `(?=.*[0-9]{1,50})(?=.*[~!@#$%\^&*()-+=]{1,50})(?=.*[a-zA-Z]{2,50}).{8,50}$`,
+			password: "c!ub2",
+		},
+		{
+			name:     "Anchored negative lookahead",
+			policy:   `^(?!.*password)(?=.*\d).{6,}$`,
+			password: "myPassword1",
+		},
+		{
+			name:     "Case insensitive as in the UI",
+			policy:   `^[a-z]{4,}[0-9]$`,
+			password: "ABCD1",
+			want:     true,
+		},
+		{
+			name:     "Unanchored match inside the password",
+			policy:   `[0-9]{3}`,
+			password: "ab123cd",
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPasswordPolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("NewPasswordPolicy() error = %v", err)
+			}
+			if got := p.Allows(tt.password); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPasswordPolicy_Invalid(t *testing.T) {
+	for _, policy := range []string{`(?=.*[0-9]`, `.{8,}(?<=\d)`} {
+		if _, err := NewPasswordPolicy(policy); err == nil {
+			t.Errorf("NewPasswordPolicy(%q) succeeded", policy)
+		}
+	}
+}
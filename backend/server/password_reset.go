@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+const (
+	// DefaultResetMailSubject is the subject of password reset mails when
+	// --mail-subject is not set
+	DefaultResetMailSubject = "CloudHub password reset"
+	// DefaultResetMailBody is the body of password reset mails when
+	// --mail-body-message is not set
+	DefaultResetMailBody = "Hello $user_id,\n\nOpen the following link to set a new password. The link can be used once and expires in $expires.\n\n$reset_link\n\nIf you did not ask for a password reset, you can ignore this mail."
+)
+
+// ErrInvalidResetToken is returned for reset tokens that are malformed,
+// expired, or already used
+var ErrInvalidResetToken = fmt.Errorf("invalid or expired password reset link")
+
+// ResetLinks signs the links of password reset mails. A token names the user
+// and its expiry, and its signature covers the current password hash of the
+// user, so it stops working once the password has been changed.
+type ResetLinks struct {
+	Secret   []byte
+	URL      string        // URL of the password reset page; the token is added as the token query parameter
+	Lifespan time.Duration // Lifespan of a link
+}
+
+// NewResetLinks returns the reset links of the page under publicURL. Their
+// key is derived from the token secret.
+func NewResetLinks(tokenSecret, publicURL string, lifespan time.Duration) *ResetLinks {
+	mac := hmac.New(sha256.New, []byte(tokenSecret))
+	mac.Write([]byte("cloudhub password reset"))
+	return &ResetLinks{
+		Secret:   mac.Sum(nil),
+		URL:      publicURL,
+		Lifespan: lifespan,
+	}
+}
+
+// Link returns a reset link for the user that expires after the lifespan
+func (l *ResetLinks) Link(u *cloudhub.User, now time.Time) string {
+	token := l.Token(u, now.Add(l.Lifespan))
+	sep := "?"
+	if strings.Contains(l.URL, "?") {
+		sep = "&"
+	}
+	return l.URL + sep + url.Values{"token": {token}}.Encode()
+}
+
+// Token returns the token of a link for the user that expires at expires
+func (l *ResetLinks) Token(u *cloudhub.User, expires time.Time) string {
+	payload := fmt.Sprintf("%d.%d", u.ID, expires.Unix())
+	return payload + "." + base64.RawURLEncoding.EncodeToString(l.sign(u, payload))
+}
+
+// UserID returns the ID of the user a token was issued for. The token still
+// has to be checked with Valid against that user.
+func (l *ResetLinks) UserID(token string) (uint64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalidResetToken
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidResetToken
+	}
+	return id, nil
+}
+
+// Valid reports whether token was issued for the user, has not expired, and
+// the password of the user has not changed since.
+func (l *ResetLinks) Valid(u *cloudhub.User, token string, now time.Time) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal(sig, l.sign(u, payload)) {
+		return false
+	}
+	if payload != fmt.Sprintf("%d.%s", u.ID, parts[1]) {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	return now.Before(time.Unix(expires, 0))
+}
+
+func (l *ResetLinks) sign(u *cloudhub.User, payload string) []byte {
+	mac := hmac.New(sha256.New, l.Secret)
+	fmt.Fprintf(mac, "%s\x00%s\x00%s\x00%s", payload, u.Name, u.Passwd, u.PasswordUpdateDate)
+	return mac.Sum(nil)
+}
+
+type resetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// mailResetLink sends a password reset link to the email address of a basic
+// user. The password stays as it is until the link is used.
+func (s *Service) mailResetLink(ctx context.Context, w http.ResponseWriter, user *cloudhub.User, pwrtn string) {
+	if user.Email == "" {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("no email address for password reset of %s", user.Name), s.Logger)
+		return
+	}
+
+	subject := s.MailSubject
+	if subject == "" {
+		subject = DefaultResetMailSubject
+	}
+	body := s.MailBody
+	if body == "" {
+		body = DefaultResetMailBody
+	} else if !strings.Contains(body, "$reset_link") {
+		body += "\n\n$reset_link"
+	}
+	replacer := strings.NewReplacer(
+		"$user_id", user.Name,
+		"$reset_link", s.ResetLinks.Link(user, s.now()),
+		"$expires", s.ResetLinks.Lifespan.String(),
+	)
+
+	if err := s.Mailer.Send(ctx, []string{user.Email}, replacer.Replace(subject), replacer.Replace(body)); err != nil {
+		Error(w, http.StatusBadGateway, fmt.Sprintf("fail send mail : %s", err.Error()), s.Logger)
+		return
+	}
+
+	// log registration
+	msg := fmt.Sprintf(MsgPasswordResetMailed.String(), user.Email)
+	s.logRegistration(ctx, "Password", msg, user.Name)
+
+	res := &resetResponse{
+		Name:              user.Name,
+		Provider:          BasicProvider,
+		Scheme:            BasicScheme,
+		Pwrtn:             pwrtn,
+		Email:             user.Email,
+		SendKind:          "email",
+		PasswordResetFlag: user.PasswordResetFlag,
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// UserPwdResetConfirm sets the password of a basic user with the token of a
+// password reset link.
+func (s *Service) UserPwdResetConfirm(w http.ResponseWriter, r *http.Request) {
+	ctx := serverContext(r.Context())
+
+	if s.ResetLinks == nil {
+		Error(w, http.StatusNotFound, "password reset links are not enabled", s.Logger)
+		return
+	}
+
+	var req resetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if req.Token == "" || req.Password == "" {
+		invalidData(w, fmt.Errorf("token and password required on password reset request body"), s.Logger)
+		return
+	}
+	if s.PasswordPolicy != nil && !s.PasswordPolicy.Allows(req.Password) {
+		invalidData(w, ErrPasswordPolicy, s.Logger)
+		return
+	}
+
+	id, err := s.ResetLinks.UserID(req.Token)
+	if err != nil {
+		Error(w, http.StatusUnauthorized, err.Error(), s.Logger)
+		return
+	}
+	user, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id})
+	if err != nil || user.Provider != BasicProvider || !s.ResetLinks.Valid(user, req.Token, s.now()) {
+		Error(w, http.StatusUnauthorized, ErrInvalidResetToken.Error(), s.Logger)
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	user.Passwd = hash
+	user.PasswordUpdateDate = getNowDate()
+	user.PasswordResetFlag = "N"
+	user.RetryCount = 0
+	user.Locked = false
+	user.LockedTime = ""
+
+	if err := s.Store.Users(ctx).Update(ctx, user); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registration
+	msg := fmt.Sprintf(MsgPasswordResetDone.String())
+	s.logRegistration(ctx, "Password", msg, user.Name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
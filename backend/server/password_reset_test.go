@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/passwd"
+)
+
+type sentMail struct {
+	to      []string
+	subject string
+	body    string
+}
+
+// recordingMailer remembers the mail it was asked to send
+type recordingMailer struct {
+	sent []sentMail
+	err  error
+}
+
+func (m *recordingMailer) Send(ctx context.Context, to []string, subject, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+var resetLinkRe = regexp.MustCompile(`https://cloudhub\.example\.com/password-reset\?token=\S+`)
+
+func newResetTestService(user *cloudhub.User, mailer *recordingMailer, clock *fakeClock) *Service {
+	return &Service{
+		Store: &mocks.Store{
+			UsersStore: &mocks.UsersStore{
+				GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+					if (q.ID != nil && *q.ID == user.ID) || (q.Name != nil && *q.Name == user.Name) {
+						u := *user
+						return &u, nil
+					}
+					return nil, cloudhub.ErrUserNotFound
+				},
+				UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+					*user = *u
+					return nil
+				},
+			},
+		},
+		Logger:     log.New(log.DebugLevel),
+		Mailer:     mailer,
+		ResetLinks: NewResetLinks("token-secret", "https://cloudhub.example.com/password-reset", time.Hour),
+		Now:        clock.Now,
+	}
+}
+
+func requestReset(s *Service, name string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://any.url/basic/password/reset?path=/kapacitor&pwrtn=false&name="+name, nil)
+	s.UserPwdReset(w, r)
+	return w
+}
+
+func confirmReset(s *Service, token, password string) int {
+	w := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"token":%q,"password":%q}`, token, password)
+	s.UserPwdResetConfirm(w, httptest.NewRequest("POST", "http://any.url/basic/password/reset/confirm", bytes.NewBufferString(body)))
+	return w.Code
+}
+
+func mailedToken(t *testing.T, m sentMail) string {
+	t.Helper()
+	link := resetLinkRe.FindString(m.body)
+	if link == "" {
+		t.Fatalf("mail has no reset link: %s", m.body)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestService_UserPwdReset_Mail(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	mailer := &recordingMailer{}
+	user := newTOTPTestUser(false)
+	user.Email = "marty@example.com"
+	user.Locked = true
+	user.RetryCount = 5
+	s := newResetTestService(user, mailer, clock)
+	s.MailSubject = "Password reset for $user_id"
+	s.MailBody = "Hi $user_id, your new password is $user_pw"
+
+	w := requestReset(s, "marty")
+	if w.Code != http.StatusOK {
+		t.Fatalf("UserPwdReset() = %d: %s", w.Code, w.Body.String())
+	}
+	var res resetResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.SendKind != "email" || res.Password != "" || res.Email != "marty@example.com" {
+		t.Errorf("UserPwdReset() = %+v", res)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("UserPwdReset() sent %d mails", len(mailer.sent))
+	}
+	m := mailer.sent[0]
+	if len(m.to) != 1 || m.to[0] != "marty@example.com" || m.subject != "Password reset for marty" {
+		t.Errorf("UserPwdReset() sent %+v", m)
+	}
+	if !strings.HasPrefix(m.body, "Hi marty, your new password is $user_pw\n\nhttps://") {
+		t.Errorf("UserPwdReset() body = %q", m.body)
+	}
+	if ok, _, _ := passwd.Verify(user.Passwd, getPasswordToSHA512("hoverboard", SecretKey)); !ok {
+		t.Errorf("UserPwdReset() changed the password before the link was used")
+	}
+	token := mailedToken(t, m)
+
+	if got := confirmReset(s, token+"x", "delorean"); got != http.StatusUnauthorized {
+		t.Errorf("UserPwdResetConfirm() with a tampered token = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := confirmReset(s, token, "delorean"); got != http.StatusNoContent {
+		t.Fatalf("UserPwdResetConfirm() = %d, want %d", got, http.StatusNoContent)
+	}
+	if ok, _, _ := passwd.Verify(user.Passwd, getPasswordToSHA512("delorean", SecretKey)); !ok {
+		t.Errorf("UserPwdResetConfirm() did not set the password")
+	}
+	if user.Locked || user.RetryCount != 0 || user.PasswordResetFlag != "N" {
+		t.Errorf("UserPwdResetConfirm() left %+v", user)
+	}
+
+	// The link works once
+	if got := confirmReset(s, token, "biff"); got != http.StatusUnauthorized {
+		t.Errorf("UserPwdResetConfirm() with a used token = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestService_UserPwdResetConfirm_Expired(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	mailer := &recordingMailer{}
+	user := newTOTPTestUser(false)
+	user.Email = "marty@example.com"
+	s := newResetTestService(user, mailer, clock)
+
+	if w := requestReset(s, "marty"); w.Code != http.StatusOK {
+		t.Fatalf("UserPwdReset() = %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(mailer.sent[0].body, "expires in 1h0m0s") {
+		t.Errorf("UserPwdReset() default body = %q", mailer.sent[0].body)
+	}
+	token := mailedToken(t, mailer.sent[0])
+
+	clock.now = clock.now.Add(time.Hour)
+	if got := confirmReset(s, token, "delorean"); got != http.StatusUnauthorized {
+		t.Errorf("UserPwdResetConfirm() with an expired token = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestService_UserPwdReset_MailErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		mailErr    error
+		wantStatus int
+	}{
+		{name: "No email address", wantStatus: http.StatusBadRequest},
+		{name: "SMTP failure", email: "marty@example.com", mailErr: fmt.Errorf("554 rejected"), wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newTOTPTestUser(false)
+			user.Email = tt.email
+			s := newResetTestService(user, &recordingMailer{err: tt.mailErr}, &fakeClock{now: time.Unix(1700000000, 0)})
+
+			if w := requestReset(s, "marty"); w.Code != tt.wantStatus {
+				t.Errorf("UserPwdReset() = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestResetLinks_Valid(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	links := NewResetLinks("token-secret", "https://cloudhub.example.com/password-reset", time.Hour)
+	marty := &cloudhub.User{ID: 1, Name: "marty", Passwd: "hash"}
+	biff := &cloudhub.User{ID: 2, Name: "biff", Passwd: "hash"}
+	token := links.Token(marty, now.Add(time.Hour))
+
+	if !links.Valid(marty, token, now) {
+		t.Errorf("Valid() = false for a fresh token")
+	}
+	if links.Valid(biff, token, now) {
+		t.Errorf("Valid() = true for another user")
+	}
+	if other := NewResetLinks("other-secret", links.URL, time.Hour); other.Valid(marty, token, now) {
+		t.Errorf("Valid() = true with another secret")
+	}
+	forged := strings.Replace(token, fmt.Sprint(now.Add(time.Hour).Unix()), fmt.Sprint(now.Add(48*time.Hour).Unix()), 1)
+	if links.Valid(marty, forged, now.Add(2*time.Hour)) {
+		t.Errorf("Valid() = true with a forged expiry")
+	}
+	if id, err := links.UserID(token); err != nil || id != 1 {
+		t.Errorf("UserID() = %d, %v", id, err)
+	}
+	if _, err := links.UserID("garbage"); err != ErrInvalidResetToken {
+		t.Errorf("UserID() error = %v, want %v", err, ErrInvalidResetToken)
+	}
+}
+
+func TestService_UserPwdResetConfirm_PasswordPolicy(t *testing.T) {
+	mailer := &recordingMailer{}
+	user := newTOTPTestUser(false)
+	user.Email = "marty@example.com"
+	s := newResetTestService(user, mailer, &fakeClock{now: time.Unix(1700000000, 0)})
+	policy, err := NewPasswordPolicy(`(?=.*[0-9]{1,50})(?=.*[~!@#$%\^&*()-+=]{1,50})(?=.*[a-zA-Z]{2,50}).{8,50}$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.PasswordPolicy = policy
+
+	if w := requestReset(s, "marty"); w.Code != http.StatusOK {
+		t.Fatalf("UserPwdReset() = %d: %s", w.Code, w.Body.String())
+	}
+	token := mailedToken(t, mailer.sent[0])
+
+	if got := confirmReset(s, token, "delorean"); got != http.StatusUnprocessableEntity {
+		t.Errorf("UserPwdResetConfirm() with a password against the policy = %d, want %d", got, http.StatusUnprocessableEntity)
+	}
+	if ok, _, _ := passwd.Verify(user.Passwd, getPasswordToSHA512("delorean", SecretKey)); ok {
+		t.Errorf("UserPwdResetConfirm() set a password against the policy")
+	}
+	if got := confirmReset(s, token, "deLorean88!"); got != http.StatusNoContent {
+		t.Errorf("UserPwdResetConfirm() = %d, want %d", got, http.StatusNoContent)
+	}
+}
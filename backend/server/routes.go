@@ -51,6 +51,7 @@ type getRoutesResponse struct {
 	Config                  getConfigLinksResponse             `json:"config"`                  // Location of the config endpoint and its various sections
 	Auth                    []AuthRoute                        `json:"auth"`                    // Location of all auth routes.
 	BasicAuth               BasicAuthRoute                     `json:"basicauth"`               // Location of basic auth routes.
+	LDAPAuth                *BasicAuthRoute                    `json:"ldapauth,omitempty"`      // Location of LDAP auth routes, if LDAP is configured.
 	Logout                  *string                            `json:"logout,omitempty"`        // Location of the logout route for all auth routes
 	BasicLogout             *string                            `json:"basicLogout,omitempty"`   // Location of the logout route for basic auth routes
 	BasicPasswordReset      string                             `json:"basicPasswordReset"`      // Location of basic password reset.
@@ -81,6 +82,7 @@ type AllRoutes struct {
 	GetPrincipal           func(r *http.Request) oauth2.Principal // GetPrincipal is used to retrieve the principal on http request.
 	AuthRoutes             []AuthRoute                            // Location of all auth routes. If no auth, this can be empty.
 	BasicRoute             BasicAuthRoute                         // Location of basic auth routes. If no auth, this can be empty.
+	LDAPRoute              *BasicAuthRoute                        // Location of LDAP auth routes. If LDAP is not configured, this is nil.
 	LogoutLink             string                                 // Location of the logout route for all auth routes. If no auth, this can be empty.
 	BasicLogoutLink        string                                 // Location of the logout route for basic auth routes. If no auth, this can be empty.
 	StatusFeed             string                                 // External link to the JSON Feed for the News Feed on the client's Status Page
@@ -128,6 +130,7 @@ func (a *AllRoutes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		},
 		Auth:                    make([]AuthRoute, len(a.AuthRoutes)), // We want to return at least an empty array, rather than null
 		BasicAuth:               a.BasicRoute,
+		LDAPAuth:                a.LDAPRoute,
 		BasicPasswordReset:      "/basic/password/reset",
 		BasicPasswordAdminReset: "/cloudhub/v1/password/reset",
 		BasicPassword:           "/basic/password",
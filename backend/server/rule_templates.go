@@ -0,0 +1,696 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	kapa "github.com/snetsystems/cloudhub/backend/kapacitor"
+)
+
+const (
+	ruleTemplateInSync  = "in-sync"
+	ruleTemplateDrifted = "drifted"
+	ruleTemplateMissing = "missing"
+	ruleTemplateError   = "error"
+)
+
+// ruleTemplateVariable matches the variables a rule template refers to
+var ruleTemplateVariable = regexp.MustCompile(`\[\[-?\s*\.([A-Za-z_][A-Za-z0-9_]*)\s*-?\]\]`)
+
+// renderRuleTemplate returns the rule of t with its variables set to params,
+// or to their defaults if not in params.
+func renderRuleTemplate(t *cloudhub.RuleTemplate, params map[string]string) (cloudhub.AlertRule, error) {
+	for name := range params {
+		if _, ok := t.Variables[name]; !ok {
+			return cloudhub.AlertRule{}, fmt.Errorf("%s is not a variable of rule template %s", name, t.Name)
+		}
+	}
+
+	tmplParams := cloudhub.TemplateParamsMap{}
+	for name, def := range t.Variables {
+		v, ok := params[name]
+		if !ok {
+			v = def
+		}
+		if v == "" {
+			return cloudhub.AlertRule{}, fmt.Errorf("variable %s of rule template %s required", name, t.Name)
+		}
+		// values are rendered inside of the JSON strings of the rule
+		quoted, err := json.Marshal(v)
+		if err != nil {
+			return cloudhub.AlertRule{}, err
+		}
+		tmplParams[name] = string(quoted[1 : len(quoted)-1])
+	}
+
+	octets, err := json.Marshal(t.Rule)
+	if err != nil {
+		return cloudhub.AlertRule{}, err
+	}
+	templateService := &TemplateService{}
+	rendered, err := templateService.LoadTemplate(cloudhub.LoadTemplateConfig{
+		Field:          RuleTemplateField,
+		TemplateString: string(octets),
+		LeftDelim:      "[[",
+		RightDelim:     "]]",
+	}, []cloudhub.TemplateBlock{{Name: string(RuleTemplateField), Params: tmplParams}})
+	if err != nil {
+		return cloudhub.AlertRule{}, err
+	}
+
+	var rule cloudhub.AlertRule
+	if err := json.Unmarshal([]byte(rendered), &rule); err != nil {
+		return cloudhub.AlertRule{}, fmt.Errorf("rule template %s renders an invalid rule: %v", t.Name, err)
+	}
+	if rule.Name == "" {
+		rule.Name = t.Name
+	}
+	return rule, nil
+}
+
+// validRuleTemplate checks that t declares the variables its rule refers to
+// and renders a rule, with its required variables set to their names.
+func validRuleTemplate(t *cloudhub.RuleTemplate) error {
+	if t.Name == "" {
+		return fmt.Errorf("name required in rule template")
+	}
+	if t.Rule.Query == nil && t.Rule.TICKScript == "" {
+		return fmt.Errorf("query or tickscript required in the rule of a rule template")
+	}
+
+	octets, err := json.Marshal(t.Rule)
+	if err != nil {
+		return err
+	}
+	for _, m := range ruleTemplateVariable.FindAllStringSubmatch(string(octets), -1) {
+		if _, ok := t.Variables[m[1]]; !ok {
+			return fmt.Errorf("variable %s of the rule is not declared in rule template %s", m[1], t.Name)
+		}
+	}
+
+	params := map[string]string{}
+	for name, def := range t.Variables {
+		if def == "" {
+			params[name] = name
+		}
+	}
+	_, err = renderRuleTemplate(t, params)
+	return err
+}
+
+type ruleTemplateRequest struct {
+	Name      *string             `json:"name"`
+	Rule      *cloudhub.AlertRule `json:"rule"`
+	Variables *map[string]string  `json:"variables"`
+}
+
+// apply sets the fields of t that are set in the request
+func (r *ruleTemplateRequest) apply(t *cloudhub.RuleTemplate) {
+	if r.Name != nil {
+		t.Name = *r.Name
+	}
+	if r.Rule != nil {
+		t.Rule = *r.Rule
+		// a template is not a kapacitor task
+		t.Rule.ID = ""
+	}
+	if r.Variables != nil {
+		t.Variables = *r.Variables
+	}
+}
+
+type ruleTemplateLinks struct {
+	Self      string `json:"self"`
+	Instances string `json:"instances"`
+	Drift     string `json:"drift"`
+	Sync      string `json:"sync"`
+}
+
+type ruleTemplateResponse struct {
+	*cloudhub.RuleTemplate
+	Links ruleTemplateLinks `json:"links"`
+}
+
+func newRuleTemplateResponse(t *cloudhub.RuleTemplate) *ruleTemplateResponse {
+	if t.Variables == nil {
+		t.Variables = map[string]string{}
+	}
+	if t.Instances == nil {
+		t.Instances = []cloudhub.RuleTemplateInstance{}
+	}
+	self := fmt.Sprintf("/cloudhub/v1/rule-templates/%s", t.ID)
+	return &ruleTemplateResponse{
+		RuleTemplate: t,
+		Links: ruleTemplateLinks{
+			Self:      self,
+			Instances: self + "/instances",
+			Drift:     self + "/drift",
+			Sync:      self + "/sync",
+		},
+	}
+}
+
+type ruleTemplatesResponse struct {
+	Links     selfLinks               `json:"links"`
+	Templates []*ruleTemplateResponse `json:"templates"`
+}
+
+type ruleTemplateInstanceLinks struct {
+	Rule string `json:"rule,omitempty"`
+}
+
+type ruleTemplateInstanceResponse struct {
+	cloudhub.RuleTemplateInstance
+	State string                    `json:"state"`
+	Error string                    `json:"error,omitempty"`
+	Links ruleTemplateInstanceLinks `json:"links"`
+}
+
+func newRuleTemplateInstanceResponse(inst cloudhub.RuleTemplateInstance, srcID int, state string, err error) ruleTemplateInstanceResponse {
+	res := ruleTemplateInstanceResponse{
+		RuleTemplateInstance: inst,
+		State:                state,
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if inst.TaskID != "" && srcID != 0 {
+		res.Links.Rule = fmt.Sprintf("/cloudhub/v1/sources/%d/kapacitors/%d/rules/%s", srcID, inst.KapacitorID, inst.TaskID)
+	}
+	return res
+}
+
+type ruleTemplateInstancesResponse struct {
+	Links     selfLinks                      `json:"links"`
+	Instances []ruleTemplateInstanceResponse `json:"instances"`
+}
+
+// ruleTemplateStoreContext returns the context to look up kapacitors of
+// instances with. Super admins reach the kapacitors of every organization.
+func ruleTemplateStoreContext(ctx context.Context) context.Context {
+	if hasSuperAdminContext(ctx) {
+		return serverContext(ctx)
+	}
+	return ctx
+}
+
+// ruleTemplateRule is the rule a template renders for a kapacitor
+type ruleTemplateRule struct {
+	srv    cloudhub.Server
+	client *kapa.Client
+	rule   cloudhub.AlertRule
+}
+
+func (s *Service) newRuleTemplateRule(ctx context.Context, t *cloudhub.RuleTemplate, srv cloudhub.Server, params map[string]string) (*ruleTemplateRule, error) {
+	ingest, err := s.alertIngest(ctx, &srv)
+	if err != nil {
+		return nil, err
+	}
+	return renderRuleTemplateRule(t, srv, params, ingest)
+}
+
+// renderRuleTemplateRule renders the rule of t for srv, posting its alerts
+// to ingest
+func renderRuleTemplateRule(t *cloudhub.RuleTemplate, srv cloudhub.Server, params map[string]string, ingest *kapa.AlertIngest) (*ruleTemplateRule, error) {
+	rule, err := renderRuleTemplate(t, params)
+	if err != nil {
+		return nil, err
+	}
+
+	c := kapa.NewClient(srv.URL, srv.Username, srv.Password, srv.InsecureSkipVerify)
+	c.Ticker = &kapa.Alert{Ingest: ingest}
+
+	return &ruleTemplateRule{srv: srv, client: c, rule: rule}, nil
+}
+
+// script returns the TICKscript of the rule as the task taskID
+func (r *ruleTemplateRule) script(taskID string) (string, error) {
+	if r.rule.Query == nil {
+		return string(r.rule.TICKScript), nil
+	}
+	rule := r.rule
+	rule.ID = taskID
+	script, err := r.client.Ticker.Generate(rule)
+	return string(script), err
+}
+
+func (r *ruleTemplateRule) create(ctx context.Context) (*kapa.Task, error) {
+	rule := r.rule
+	rule.ID = ""
+	return r.client.Create(ctx, rule)
+}
+
+func (r *ruleTemplateRule) update(ctx context.Context, taskID string) (*kapa.Task, error) {
+	rule := r.rule
+	rule.ID = taskID
+	return r.client.Update(ctx, r.client.Href(taskID), rule)
+}
+
+// ruleTemplateInstance compares the task of inst with the rule t renders for
+// it, returning whether it is in sync, drifted or missing. If readOnly, the
+// alert token of a kapacitor without one is not generated, as its tasks do
+// not post alerts then.
+func (s *Service) ruleTemplateInstance(ctx context.Context, t *cloudhub.RuleTemplate, inst cloudhub.RuleTemplateInstance, readOnly bool) (*ruleTemplateRule, string, error) {
+	storeCtx := ruleTemplateStoreContext(ctx)
+	srv, err := s.Store.Servers(storeCtx).Get(storeCtx, inst.KapacitorID)
+	if err != nil || srv.Type != "" {
+		return nil, ruleTemplateError, fmt.Errorf("kapacitor %d not found", inst.KapacitorID)
+	}
+
+	var r *ruleTemplateRule
+	if readOnly {
+		r, err = renderRuleTemplateRule(t, srv, inst.Params, s.existingAlertIngest(srv))
+	} else {
+		r, err = s.newRuleTemplateRule(storeCtx, t, srv, inst.Params)
+	}
+	if err != nil {
+		return nil, ruleTemplateError, err
+	}
+	want, err := r.script(inst.TaskID)
+	if err != nil {
+		return r, ruleTemplateError, err
+	}
+
+	task, err := r.client.Get(ctx, inst.TaskID)
+	if err == cloudhub.ErrAlertNotFound {
+		return r, ruleTemplateMissing, nil
+	} else if err != nil {
+		return r, ruleTemplateError, err
+	}
+	if strings.TrimSpace(string(task.Rule.TICKScript)) != strings.TrimSpace(want) {
+		return r, ruleTemplateDrifted, nil
+	}
+	return r, ruleTemplateInSync, nil
+}
+
+// ruleTemplateTarget is where a template is instantiated: a kapacitor, every
+// kapacitor of a source, or every kapacitor of an organization.
+type ruleTemplateTarget struct {
+	KapacitorID  int               `json:"kapacitorID,string,omitempty"`
+	SourceID     int               `json:"sourceID,string,omitempty"`
+	Organization string            `json:"organization,omitempty"`
+	Params       map[string]string `json:"params"`
+}
+
+type ruleTemplateInstancesRequest struct {
+	Targets []ruleTemplateTarget `json:"targets"`
+}
+
+// Valid checks that each target has one of a kapacitor, a source or an organization
+func (r *ruleTemplateInstancesRequest) Valid() error {
+	if len(r.Targets) == 0 {
+		return fmt.Errorf("targets required")
+	}
+	for i, target := range r.Targets {
+		n := 0
+		if target.KapacitorID != 0 {
+			n++
+		}
+		if target.SourceID != 0 {
+			n++
+		}
+		if target.Organization != "" {
+			n++
+		}
+		if n != 1 {
+			return fmt.Errorf("target %d must have one of kapacitorID, sourceID or organization", i)
+		}
+	}
+	return nil
+}
+
+// ruleTemplateKapacitors returns the kapacitors of target
+func (s *Service) ruleTemplateKapacitors(ctx context.Context, target ruleTemplateTarget) ([]cloudhub.Server, error) {
+	ctx = ruleTemplateStoreContext(ctx)
+	if target.KapacitorID != 0 {
+		srv, err := s.Store.Servers(ctx).Get(ctx, target.KapacitorID)
+		if err != nil || srv.Type != "" {
+			return nil, fmt.Errorf("kapacitor %d not found", target.KapacitorID)
+		}
+		return []cloudhub.Server{srv}, nil
+	}
+
+	all, err := s.Store.Servers(ctx).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kapacitors := []cloudhub.Server{}
+	for _, srv := range all {
+		if srv.Type != "" {
+			continue
+		}
+		if (target.SourceID != 0 && srv.SrcID == target.SourceID) ||
+			(target.Organization != "" && srv.Organization == target.Organization) {
+			kapacitors = append(kapacitors, srv)
+		}
+	}
+	if len(kapacitors) == 0 {
+		if target.SourceID != 0 {
+			return nil, fmt.Errorf("no kapacitors of source %d", target.SourceID)
+		}
+		return nil, fmt.Errorf("no kapacitors in organization %s", target.Organization)
+	}
+	return kapacitors, nil
+}
+
+// ruleTemplate returns the template of the request
+func (s *Service) ruleTemplate(w http.ResponseWriter, r *http.Request) (*cloudhub.RuleTemplate, bool) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+	t, err := s.Store.RuleTemplates(ctx).Get(ctx, id)
+	if err != nil {
+		notFound(w, id, s.Logger)
+		return nil, false
+	}
+	return t, true
+}
+
+// RuleTemplates lists the rule templates of the organization
+func (s *Service) RuleTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	templates, err := s.Store.RuleTemplates(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := ruleTemplatesResponse{
+		Links:     selfLinks{Self: "/cloudhub/v1/rule-templates"},
+		Templates: []*ruleTemplateResponse{},
+	}
+	for i := range templates {
+		res.Templates = append(res.Templates, newRuleTemplateResponse(&templates[i]))
+	}
+	sort.SliceStable(res.Templates, func(i, j int) bool {
+		return res.Templates[i].Name < res.Templates[j].Name
+	})
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// RuleTemplateByID returns a rule template with its instances
+func (s *Service) RuleTemplateByID(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.ruleTemplate(w, r)
+	if !ok {
+		return
+	}
+	encodeJSON(w, http.StatusOK, newRuleTemplateResponse(t), s.Logger)
+}
+
+// NewRuleTemplate creates a rule template
+func (s *Service) NewRuleTemplate(w http.ResponseWriter, r *http.Request) {
+	var req ruleTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	t := &cloudhub.RuleTemplate{}
+	req.apply(t)
+	if err := validRuleTemplate(t); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if user, ok := hasUserContext(ctx); ok {
+		t.CreatedBy = user.Name
+	}
+
+	t, err := s.Store.RuleTemplates(ctx).Add(ctx, t)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgRuleTemplateCreated.String(), t.Name)
+	s.logChange(ctx, "Rule Templates", msg, nil, *t)
+
+	res := newRuleTemplateResponse(t)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// UpdateRuleTemplate changes the fields of a rule template set in the
+// request. Its instances drift until they are synced.
+func (s *Service) UpdateRuleTemplate(w http.ResponseWriter, r *http.Request) {
+	var req ruleTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	t, ok := s.ruleTemplate(w, r)
+	if !ok {
+		return
+	}
+	before := *t
+
+	req.apply(t)
+	if err := validRuleTemplate(t); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.Store.RuleTemplates(ctx).Update(ctx, t); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgRuleTemplateModified.String(), t.Name)
+	s.logChange(ctx, "Rule Templates", msg, before, *t)
+
+	encodeJSON(w, http.StatusOK, newRuleTemplateResponse(t), s.Logger)
+}
+
+// RemoveRuleTemplate deletes a rule template, leaving the rules created from it
+func (s *Service) RemoveRuleTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.ruleTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.Store.RuleTemplates(ctx).Delete(ctx, t); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgRuleTemplateDeleted.String(), t.Name)
+	s.logChange(ctx, "Rule Templates", msg, *t, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NewRuleTemplateInstances creates the rule of a template in every kapacitor
+// of the targets of the request. A kapacitor the rule cannot be created in
+// is reported with the error, and the others are still created.
+func (s *Service) NewRuleTemplateInstances(w http.ResponseWriter, r *http.Request) {
+	var req ruleTemplateInstancesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err := req.Valid(); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	t, ok := s.ruleTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	res := ruleTemplateInstancesResponse{
+		Links:     selfLinks{Self: fmt.Sprintf("/cloudhub/v1/rule-templates/%s/instances", t.ID)},
+		Instances: []ruleTemplateInstanceResponse{},
+	}
+	var created []cloudhub.RuleTemplateInstance
+	for _, target := range req.Targets {
+		kapacitors, err := s.ruleTemplateKapacitors(ctx, target)
+		if err != nil {
+			inst := cloudhub.RuleTemplateInstance{KapacitorID: target.KapacitorID, Params: target.Params}
+			res.Instances = append(res.Instances, newRuleTemplateInstanceResponse(inst, 0, ruleTemplateError, err))
+			continue
+		}
+
+		for _, srv := range kapacitors {
+			inst := cloudhub.RuleTemplateInstance{
+				KapacitorID:  srv.ID,
+				Organization: srv.Organization,
+				Params:       target.Params,
+			}
+
+			rule, err := s.newRuleTemplateRule(ruleTemplateStoreContext(ctx), t, srv, target.Params)
+			if err != nil {
+				res.Instances = append(res.Instances, newRuleTemplateInstanceResponse(inst, srv.SrcID, ruleTemplateError, err))
+				continue
+			}
+			task, err := rule.create(ctx)
+			if err != nil {
+				res.Instances = append(res.Instances, newRuleTemplateInstanceResponse(inst, srv.SrcID, ruleTemplateError, err))
+				continue
+			}
+
+			inst.TaskID = task.ID
+			created = append(created, inst)
+			res.Instances = append(res.Instances, newRuleTemplateInstanceResponse(inst, srv.SrcID, ruleTemplateInSync, nil))
+		}
+	}
+
+	if len(created) > 0 {
+		// the instances added or synced meanwhile are kept
+		err := s.Store.RuleTemplates(ctx).UpdateInstances(ctx, t.ID, func(insts []cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance {
+			return append(insts, created...)
+		})
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+
+		// log registrationte
+		msg := fmt.Sprintf(MsgRuleTemplateInstantiated.String(), t.Name, len(created))
+		s.logRegistration(ctx, "Rule Templates", msg)
+	}
+
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// RuleTemplateDrift lists the instances of a rule template whose TICKscript
+// no longer matches the template, or whose task is missing.
+func (s *Service) RuleTemplateDrift(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.ruleTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	res := ruleTemplateInstancesResponse{
+		Links:     selfLinks{Self: fmt.Sprintf("/cloudhub/v1/rule-templates/%s/drift", t.ID)},
+		Instances: []ruleTemplateInstanceResponse{},
+	}
+	for _, inst := range t.Instances {
+		// viewers read the drift, which writes nothing
+		rule, state, err := s.ruleTemplateInstance(ctx, t, inst, true)
+		if state == ruleTemplateInSync {
+			continue
+		}
+		srcID := 0
+		if rule != nil {
+			srcID = rule.srv.SrcID
+		}
+		res.Instances = append(res.Instances, newRuleTemplateInstanceResponse(inst, srcID, state, err))
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ruleTemplateTask is the task of an instance of a rule template
+type ruleTemplateTask struct {
+	kapacitorID int
+	taskID      string
+}
+
+// ruleTemplateRecreated is a task created again for an instance whose task
+// was missing
+type ruleTemplateRecreated struct {
+	rule *ruleTemplateRule
+	task *kapa.Task
+	res  int // res is the index of the instance in the response
+}
+
+// SyncRuleTemplate updates the drifted instances of a rule template to the
+// rule it renders for them, and creates again those whose task is missing.
+func (s *Service) SyncRuleTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.ruleTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	res := ruleTemplateInstancesResponse{
+		Links:     selfLinks{Self: fmt.Sprintf("/cloudhub/v1/rule-templates/%s/sync", t.ID)},
+		Instances: []ruleTemplateInstanceResponse{},
+	}
+	synced := 0
+	recreated := map[ruleTemplateTask]ruleTemplateRecreated{}
+	for _, inst := range t.Instances {
+		rule, state, err := s.ruleTemplateInstance(ctx, t, inst, false)
+		switch state {
+		case ruleTemplateDrifted:
+			if _, err = rule.update(ctx, inst.TaskID); err == nil {
+				state = ruleTemplateInSync
+				synced++
+			}
+		case ruleTemplateMissing:
+			var task *kapa.Task
+			if task, err = rule.create(ctx); err == nil {
+				recreated[ruleTemplateTask{inst.KapacitorID, inst.TaskID}] = ruleTemplateRecreated{rule, task, len(res.Instances)}
+				inst.TaskID = task.ID
+				state = ruleTemplateInSync
+				synced++
+			}
+		}
+		if err != nil {
+			state = ruleTemplateError
+		}
+
+		srcID := 0
+		if rule != nil {
+			srcID = rule.srv.SrcID
+		}
+		res.Instances = append(res.Instances, newRuleTemplateInstanceResponse(inst, srcID, state, err))
+	}
+
+	if len(recreated) > 0 {
+		// the instances added or synced meanwhile are kept
+		var replaced map[ruleTemplateTask]bool
+		err := s.Store.RuleTemplates(ctx).UpdateInstances(ctx, t.ID, func(insts []cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance {
+			replaced = map[ruleTemplateTask]bool{}
+			for i, inst := range insts {
+				k := ruleTemplateTask{inst.KapacitorID, inst.TaskID}
+				if re, ok := recreated[k]; ok {
+					insts[i].TaskID = re.task.ID
+					replaced[k] = true
+				}
+			}
+			return insts
+		})
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+
+		// an instance synced or removed meanwhile no longer has the missing
+		// task, so the task created again for it is removed
+		for k, re := range recreated {
+			if replaced[k] {
+				continue
+			}
+			err := fmt.Errorf("instance was changed while it was being synced")
+			if derr := re.rule.client.Delete(ctx, re.task.Href); derr != nil {
+				err = fmt.Errorf("%v; unable to remove task %s: %v", err, re.task.ID, derr)
+			}
+			res.Instances[re.res].State = ruleTemplateError
+			res.Instances[re.res].Error = err.Error()
+			synced--
+		}
+	}
+
+	if synced > 0 {
+		// log registrationte
+		msg := fmt.Sprintf(MsgRuleTemplateSynced.String(), t.Name, synced)
+		s.logRegistration(ctx, "Rule Templates", msg)
+	}
+
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
@@ -0,0 +1,405 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+)
+
+func newTestRuleTemplate() *cloudhub.RuleTemplate {
+	return &cloudhub.RuleTemplate{
+		ID:           "1",
+		Name:         "high cpu",
+		Organization: "default",
+		Rule: cloudhub.AlertRule{
+			Name:          "high cpu of [[ .host ]]",
+			Trigger:       "threshold",
+			TriggerValues: cloudhub.TriggerValues{Operator: "greater than", Value: "[[ .threshold ]]"},
+			Message:       `{{ .ID }} is {{ .Level }} on [[ .host ]]`,
+			Every:         "1m",
+			Query: &cloudhub.QueryConfig{
+				Database:        "telegraf",
+				RetentionPolicy: "autogen",
+				Measurement:     "cpu",
+				Fields:          []cloudhub.Field{{Value: "usage_user", Type: "field"}},
+				Tags:            map[string][]string{"host": {"[[ .host ]]"}},
+				AreTagsAccepted: true,
+			},
+		},
+		Variables: map[string]string{"host": "", "threshold": "90"},
+	}
+}
+
+func Test_renderRuleTemplate(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        map[string]string
+		wantName      string
+		wantHost      string
+		wantThreshold string
+		wantErr       bool
+	}{
+		{
+			name:          "Defaults",
+			params:        map[string]string{"host": "web1"},
+			wantName:      "high cpu of web1",
+			wantHost:      "web1",
+			wantThreshold: "90",
+		},
+		{
+			name:          "Escaped value",
+			params:        map[string]string{"host": `web"1`, "threshold": "80"},
+			wantName:      `high cpu of web"1`,
+			wantHost:      `web"1`,
+			wantThreshold: "80",
+		},
+		{
+			name:    "Missing required",
+			params:  map[string]string{"threshold": "80"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown variable",
+			params:  map[string]string{"host": "web1", "db": "telegraf"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderRuleTemplate(newTestRuleTemplate(), tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderRuleTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Name != tt.wantName || got.Query.Tags["host"][0] != tt.wantHost || got.TriggerValues.Value != tt.wantThreshold {
+				t.Errorf("renderRuleTemplate() = %+v, want %s on %s over %s", got, tt.wantName, tt.wantHost, tt.wantThreshold)
+			}
+			if want := `{{ .ID }} is {{ .Level }} on ` + tt.wantHost; got.Message != want {
+				t.Errorf("renderRuleTemplate() message = %q, want %q", got.Message, want)
+			}
+		})
+	}
+}
+
+func Test_validRuleTemplate(t *testing.T) {
+	if err := validRuleTemplate(newTestRuleTemplate()); err != nil {
+		t.Errorf("validRuleTemplate() error = %v", err)
+	}
+
+	undeclared := newTestRuleTemplate()
+	undeclared.Rule.Every = "[[ .every ]]"
+	if err := validRuleTemplate(undeclared); err == nil {
+		t.Errorf("validRuleTemplate() of an undeclared variable is valid")
+	}
+
+	malformed := newTestRuleTemplate()
+	malformed.Rule.Details = "[[ if .host ]]"
+	if err := validRuleTemplate(malformed); err == nil {
+		t.Errorf("validRuleTemplate() of a malformed template is valid")
+	}
+}
+
+func TestService_RuleTemplateInstances(t *testing.T) {
+	k := newFakeKapacitor(t)
+	kapaSrv := httptest.NewServer(k)
+	defer kapaSrv.Close()
+
+	servers := []cloudhub.Server{
+		{ID: 1, SrcID: 1, Name: "kapa1", URL: kapaSrv.URL, Organization: "default"},
+		{ID: 2, SrcID: 1, Name: "kapa2", URL: kapaSrv.URL, Organization: "default"},
+		{ID: 4, SrcID: 1, Name: "flux", URL: kapaSrv.URL, Organization: "default", Type: "flux"},
+	}
+	template := newTestRuleTemplate()
+	s := &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				AllF: func(ctx context.Context) ([]cloudhub.Server, error) {
+					return servers, nil
+				},
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					for _, srv := range servers {
+						if srv.ID == ID {
+							return srv, nil
+						}
+					}
+					return cloudhub.Server{}, cloudhub.ErrServerNotFound
+				},
+			},
+			RuleTemplatesStore: &mocks.RuleTemplatesStore{
+				GetF: func(ctx context.Context, id string) (*cloudhub.RuleTemplate, error) {
+					t := *template
+					t.Instances = append([]cloudhub.RuleTemplateInstance(nil), template.Instances...)
+					return &t, nil
+				},
+				UpdateInstancesF: func(ctx context.Context, id string, fn func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) error {
+					template.Instances = fn(append([]cloudhub.RuleTemplateInstance(nil), template.Instances...))
+					return nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	serve := func(handler http.HandlerFunc, method, path, body string) ruleTemplateInstancesResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "http://any.url"+path, strings.NewReader(body))
+		r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+			{Key: "id", Value: "1"},
+		}))
+		handler(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s status = %d: %s", method, path, w.Code, w.Body.String())
+		}
+		var res ruleTemplateInstancesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	states := func(res ruleTemplateInstancesResponse) string {
+		got := []string{}
+		for _, inst := range res.Instances {
+			got = append(got, fmt.Sprintf("%d:%s", inst.KapacitorID, inst.State))
+		}
+		return strings.Join(got, ",")
+	}
+
+	res := serve(s.NewRuleTemplateInstances, "POST", "/cloudhub/v1/rule-templates/1/instances",
+		`{"targets": [{"sourceID": "1", "params": {"host": "web1"}}, {"kapacitorID": "3", "params": {"host": "web2"}}]}`)
+	if got, want := states(res), "1:in-sync,2:in-sync,3:error"; got != want {
+		t.Fatalf("NewRuleTemplateInstances() = %s, want %s", got, want)
+	}
+	if len(template.Instances) != 2 || len(k.scripts) != 2 {
+		t.Fatalf("NewRuleTemplateInstances() created %v, kapacitor has %d tasks", template.Instances, len(k.scripts))
+	}
+	for _, inst := range template.Instances {
+		if !strings.Contains(k.scripts[inst.TaskID], `'web1'`) {
+			t.Errorf("task %s of kapacitor %d is not rendered for web1:\n%s", inst.TaskID, inst.KapacitorID, k.scripts[inst.TaskID])
+		}
+	}
+	if want := fmt.Sprintf("/cloudhub/v1/sources/1/kapacitors/1/rules/%s", template.Instances[0].TaskID); res.Instances[0].Links.Rule != want {
+		t.Errorf("NewRuleTemplateInstances() rule link = %s, want %s", res.Instances[0].Links.Rule, want)
+	}
+
+	if res := serve(s.RuleTemplateDrift, "GET", "/cloudhub/v1/rule-templates/1/drift", ""); len(res.Instances) != 0 {
+		t.Fatalf("RuleTemplateDrift() of new instances = %s, want none", states(res))
+	}
+
+	first, second := template.Instances[0].TaskID, template.Instances[1].TaskID
+	k.scripts[first] = "stream|from()"
+	delete(k.scripts, second)
+	if got, want := states(serve(s.RuleTemplateDrift, "GET", "/cloudhub/v1/rule-templates/1/drift", "")), "1:drifted,2:missing"; got != want {
+		t.Fatalf("RuleTemplateDrift() = %s, want %s", got, want)
+	}
+
+	if got, want := states(serve(s.SyncRuleTemplate, "POST", "/cloudhub/v1/rule-templates/1/sync", "")), "1:in-sync,2:in-sync"; got != want {
+		t.Fatalf("SyncRuleTemplate() = %s, want %s", got, want)
+	}
+	if template.Instances[0].TaskID != first || template.Instances[1].TaskID == second {
+		t.Errorf("SyncRuleTemplate() instances = %v, want %s kept and %s created again", template.Instances, first, second)
+	}
+	if res := serve(s.RuleTemplateDrift, "GET", "/cloudhub/v1/rule-templates/1/drift", ""); len(res.Instances) != 0 {
+		t.Fatalf("RuleTemplateDrift() after sync = %s, want none", states(res))
+	}
+
+	template.Variables["threshold"] = "95"
+	if got, want := states(serve(s.RuleTemplateDrift, "GET", "/cloudhub/v1/rule-templates/1/drift", "")), "1:drifted,2:drifted"; got != want {
+		t.Fatalf("RuleTemplateDrift() after changing a default = %s, want %s", got, want)
+	}
+}
+
+// ruleTemplateService serves the rule template t, whose instances are on
+// kapacitor kapaURL, updating the stored instances with update
+func ruleTemplateService(t *cloudhub.RuleTemplate, kapaURL string, update func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) *Service {
+	return &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{ID: ID, SrcID: 1, Name: "kapa1", URL: kapaURL, Organization: "default"}, nil
+				},
+			},
+			RuleTemplatesStore: &mocks.RuleTemplatesStore{
+				GetF: func(ctx context.Context, id string) (*cloudhub.RuleTemplate, error) {
+					return t, nil
+				},
+				UpdateInstancesF: func(ctx context.Context, id string, fn func([]cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance) error {
+					t.Instances = fn(update(t.Instances))
+					return nil
+				},
+			},
+			AuditStore: &mocks.AuditStore{
+				AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+					return e, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+}
+
+func serveRuleTemplate(t *testing.T, handler http.HandlerFunc, method, path, body string) ruleTemplateInstancesResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "http://any.url"+path, strings.NewReader(body))
+	r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{Key: "id", Value: "1"},
+	}))
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s status = %d: %s", method, path, w.Code, w.Body.String())
+	}
+	var res ruleTemplateInstancesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestService_SyncRuleTemplate_KapacitorError(t *testing.T) {
+	template := newTestRuleTemplate()
+	params := map[string]string{"host": "web1"}
+	rule, err := renderRuleTemplate(template, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule.ID, rule.Status = "cloudhub-v1-web1", "enabled"
+	k := newFakeKapacitor(t, rule)
+	k.setBroken(rule.ID, true)
+	kapaSrv := httptest.NewServer(k)
+	defer kapaSrv.Close()
+	template.Instances = []cloudhub.RuleTemplateInstance{
+		{KapacitorID: 1, Organization: "default", TaskID: rule.ID, Params: params},
+	}
+
+	s := ruleTemplateService(template, kapaSrv.URL, func(insts []cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance {
+		t.Errorf("SyncRuleTemplate() updated the instances of the template")
+		return insts
+	})
+	res := serveRuleTemplate(t, s.SyncRuleTemplate, "POST", "/cloudhub/v1/rule-templates/1/sync", "")
+	if len(res.Instances) != 1 || res.Instances[0].State != ruleTemplateError {
+		t.Fatalf("SyncRuleTemplate() = %+v, want the instance in error", res.Instances)
+	}
+	if len(k.scripts) != 1 || template.Instances[0].TaskID != rule.ID {
+		t.Errorf("SyncRuleTemplate() created a task while kapacitor failed: %v, %v", k.scripts, template.Instances)
+	}
+}
+
+func TestService_RuleTemplateInstances_Concurrent(t *testing.T) {
+	k := newFakeKapacitor(t)
+	kapaSrv := httptest.NewServer(k)
+	defer kapaSrv.Close()
+
+	template := newTestRuleTemplate()
+	template.Instances = []cloudhub.RuleTemplateInstance{
+		{KapacitorID: 1, Organization: "default", TaskID: "cloudhub-v1-gone", Params: map[string]string{"host": "web1"}},
+	}
+	// another request adds an instance, and syncs the missing one, while
+	// this one is being served
+	other := cloudhub.RuleTemplateInstance{KapacitorID: 2, Organization: "default", TaskID: "cloudhub-v1-other", Params: map[string]string{"host": "web3"}}
+	s := ruleTemplateService(template, kapaSrv.URL, func(insts []cloudhub.RuleTemplateInstance) []cloudhub.RuleTemplateInstance {
+		insts = append([]cloudhub.RuleTemplateInstance(nil), insts...)
+		for i := range insts {
+			if insts[i].TaskID == "cloudhub-v1-gone" {
+				insts[i].TaskID = "cloudhub-v1-synced"
+			}
+		}
+		for _, inst := range insts {
+			if inst.TaskID == other.TaskID {
+				return insts
+			}
+		}
+		return append(insts, other)
+	})
+
+	res := serveRuleTemplate(t, s.NewRuleTemplateInstances, "POST", "/cloudhub/v1/rule-templates/1/instances",
+		`{"targets": [{"kapacitorID": "1", "params": {"host": "web2"}}]}`)
+	if len(res.Instances) != 1 || res.Instances[0].State != ruleTemplateInSync {
+		t.Fatalf("NewRuleTemplateInstances() = %+v, want the instance in sync", res.Instances)
+	}
+	if len(template.Instances) != 3 || template.Instances[1].TaskID != other.TaskID || template.Instances[2].TaskID != res.Instances[0].TaskID {
+		t.Fatalf("NewRuleTemplateInstances() stored %+v, want the instances added meanwhile kept", template.Instances)
+	}
+
+	template.Instances[0].TaskID = "cloudhub-v1-gone"
+	res = serveRuleTemplate(t, s.SyncRuleTemplate, "POST", "/cloudhub/v1/rule-templates/1/sync", "")
+	if template.Instances[0].TaskID != "cloudhub-v1-synced" {
+		t.Fatalf("SyncRuleTemplate() stored %+v, want the instance synced meanwhile kept", template.Instances)
+	}
+	for _, inst := range res.Instances {
+		if inst.Params["host"] == "web1" && inst.State != ruleTemplateError {
+			t.Errorf("SyncRuleTemplate() instance synced meanwhile = %+v, want it in error", inst)
+		}
+	}
+	if _, ok := k.scripts[res.Instances[0].TaskID]; ok {
+		t.Errorf("SyncRuleTemplate() left the task %s it created again behind", res.Instances[0].TaskID)
+	}
+}
+
+func TestService_RuleTemplateDrift_WithoutAlertToken(t *testing.T) {
+	template := newTestRuleTemplate()
+	params := map[string]string{"host": "web1"}
+	rule, err := renderRuleTemplate(template, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the task was created before cloudhub had a public URL for kapacitor,
+	// so it does not post its alerts
+	rule.ID, rule.Status = "cloudhub-v1-web1", "enabled"
+	k := newFakeKapacitor(t, rule)
+	kapaSrv := httptest.NewServer(k)
+	defer kapaSrv.Close()
+	template.Instances = []cloudhub.RuleTemplateInstance{
+		{KapacitorID: 1, Organization: "default", TaskID: rule.ID, Params: params},
+	}
+
+	s := &Service{
+		Store: &mocks.Store{
+			ServersStore: &mocks.ServersStore{
+				GetF: func(ctx context.Context, ID int) (cloudhub.Server, error) {
+					return cloudhub.Server{ID: ID, SrcID: 1, Name: "kapa1", URL: kapaSrv.URL, Organization: "default"}, nil
+				},
+				UpdateF: func(ctx context.Context, srv cloudhub.Server) error {
+					t.Errorf("RuleTemplateDrift() updated kapacitor %d", srv.ID)
+					return nil
+				},
+			},
+			RuleTemplatesStore: &mocks.RuleTemplatesStore{
+				GetF: func(ctx context.Context, id string) (*cloudhub.RuleTemplate, error) {
+					return template, nil
+				},
+			},
+		},
+		Logger:    log.New(log.DebugLevel),
+		AlertsURL: "https://cloudhub.example.com/alerts",
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/rule-templates/1/drift", nil)
+	r = r.WithContext(httprouter.WithParams(context.Background(), httprouter.Params{
+		{Key: "id", Value: "1"},
+	}))
+	s.RuleTemplateDrift(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("RuleTemplateDrift() status = %d: %s", w.Code, w.Body.String())
+	}
+	var res ruleTemplateInstancesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Instances) != 0 {
+		t.Errorf("RuleTemplateDrift() = %+v, want the instance in sync", res.Instances)
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,8 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"time"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
 )
 
 func (s *Service) saltProxyServe(body []byte, u *url.URL, w http.ResponseWriter, r *http.Request) {
@@ -130,6 +133,10 @@ func (s *Service) SaltProxy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	t := r.URL.Query().Get("type")
+	if !s.authorizeSaltCalls(w, r, body, t == "array") {
+		return
+	}
+
 	if t == "array" {
 		s.saltArrayProxyServe(body, u, w, r)
 	} else {
@@ -172,121 +179,56 @@ func (s *Service) SaltHTTPPost(payload []byte) (int, []byte, error) {
 	return resp.StatusCode, respBody, nil
 }
 
-// CreateFile creates the file using salt
-func (s *Service) CreateFile(path string, contents []string) (int, []byte, error) {
-	type kwarg struct {
-		Fun  string   `json:"fun"`
-		Path string   `json:"path"`
-		Args []string `json:"args"`
-	}
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Kwarg  kwarg  `json:"kwarg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Client: "runner",
-		Fun:    "salt.cmd",
-		Kwarg: kwarg{
-			Fun:  "file.write",
-			Path: path,
-			Args: contents,
-		},
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
+// CreateFile writes the file on the salt master as a runner_async job and
+// waits for it to finish
+func (s *Service) CreateFile(ctx context.Context, path string, contents []string) (*cloudhub.SaltJob, error) {
+	return s.runSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "runner_async",
+		Function: "salt.cmd",
+		Kwarg: saltJobKwarg(map[string]interface{}{
+			"fun":  "file.write",
+			"path": path,
+			"args": contents,
+		}),
+	})
 }
 
-// CreateFileWithLocalClient creates a file with the specified contents on the target minion.
-func (s *Service) CreateFileWithLocalClient(path string, contents []string, targetMinion string) (int, []byte, error) {
-
-	type kwarg struct {
-		Path string   `json:"path"`
-		Args []string `json:"args"`
-	}
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Target string `json:"tgt"`
-		Kwarg  kwarg  `json:"kwarg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Fun:    "file.write",
-		Client: "local",
-		Target: targetMinion,
-		Kwarg: kwarg{
-			Path: path,
-			Args: contents,
-		},
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
-
+// CreateFileWithLocalClient writes a file with the specified contents on the
+// target minion as a local_async job and waits for it to finish.
+func (s *Service) CreateFileWithLocalClient(ctx context.Context, path string, contents []string, targetMinion string) (*cloudhub.SaltJob, error) {
+	return s.runSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "local_async",
+		Function: "file.write",
+		Target:   targetMinion,
+		Kwarg: saltJobKwarg(map[string]interface{}{
+			"path": path,
+			"args": contents,
+		}),
+	})
 }
 
-// RemoveFile removes the file using salt
-func (s *Service) RemoveFile(path string) (int, []byte, error) {
-	type kwarg struct {
-		Fun  string `json:"fun"`
-		Path string `json:"path"`
-	}
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Kwarg  kwarg  `json:"kwarg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Client: "runner",
-		Fun:    "salt.cmd",
-		Kwarg: kwarg{
-			Fun:  "file.remove",
-			Path: path,
-		},
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
+// RemoveFile removes the file on the salt master as a runner_async job and
+// waits for it to finish
+func (s *Service) RemoveFile(ctx context.Context, path string) (*cloudhub.SaltJob, error) {
+	return s.runSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "runner_async",
+		Function: "salt.cmd",
+		Kwarg: saltJobKwarg(map[string]interface{}{
+			"fun":  "file.remove",
+			"path": path,
+		}),
+	})
 }
 
-// RemoveFileWithLocalClient removes a file at the specified path on the target minion.
-func (s *Service) RemoveFileWithLocalClient(path string, targetMinion string) (int, []byte, error) {
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Target string `json:"tgt"`
-		Arg    string `json:"arg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Client: "local",
-		Fun:    "file.remove",
-		Target: targetMinion,
-		Arg:    path,
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
+// RemoveFileWithLocalClient removes a file at the specified path on the target
+// minion as a local_async job and waits for it to finish.
+func (s *Service) RemoveFileWithLocalClient(ctx context.Context, path string, targetMinion string) (*cloudhub.SaltJob, error) {
+	return s.runSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "local_async",
+		Function: "file.remove",
+		Target:   targetMinion,
+		Arg:      []string{path},
+	})
 }
 
 // DirectoryExists is tests to see if path is a valid directory
@@ -343,87 +285,41 @@ func (s *Service) DirectoryExistsWithLocalClient(path string, targetMinion strin
 	return s.SaltHTTPPost(payload)
 }
 
-// Mkdir make the path to ensure that a directory is available
-func (s *Service) Mkdir(path string) (int, []byte, error) {
-	type kwarg struct {
-		Fun  string `json:"fun"`
-		Path string `json:"dir_path"`
-	}
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Kwarg  kwarg  `json:"kwarg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Client: "runner",
-		Fun:    "salt.cmd",
-		Kwarg: kwarg{
-			Fun:  "file.mkdir",
-			Path: path,
-		},
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
+// Mkdir makes the path on the salt master to ensure that a directory is
+// available, as a runner_async job it waits for
+func (s *Service) Mkdir(ctx context.Context, path string) (*cloudhub.SaltJob, error) {
+	return s.runSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "runner_async",
+		Function: "salt.cmd",
+		Kwarg: saltJobKwarg(map[string]interface{}{
+			"fun":      "file.mkdir",
+			"dir_path": path,
+		}),
+	})
 }
 
-// MkdirWithLocalClient creates a directory at the specified path on the target minion.
-func (s *Service) MkdirWithLocalClient(path string, targetMinion string) (int, []byte, error) {
-
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Target string `json:"tgt"`
-		Arg    string `json:"arg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Client: "local",
-		Fun:    "file.mkdir",
-		Target: targetMinion,
-		Arg:    path,
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
+// MkdirWithLocalClient creates a directory at the specified path on the target
+// minion as a local_async job and waits for it to finish.
+func (s *Service) MkdirWithLocalClient(ctx context.Context, path string, targetMinion string) (*cloudhub.SaltJob, error) {
+	return s.runSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "local_async",
+		Function: "file.mkdir",
+		Target:   targetMinion,
+		Arg:      []string{path},
+	})
 }
 
-// DaemonReload reloads the config of the specified service with systemd
-func (s *Service) DaemonReload(name string) (int, []byte, error) {
-	type kwarg struct {
-		Fun  string `json:"fun"`
-		Name string `json:"name"`
-	}
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Kwarg  kwarg  `json:"kwarg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Client: "runner",
-		Fun:    "salt.cmd",
-		Kwarg: kwarg{
-			Fun:  "service.reload",
-			Name: name,
-		},
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
+// DaemonReload reloads the config of the specified service with systemd. It
+// submits a runner_async job and returns without waiting for the reload.
+func (s *Service) DaemonReload(ctx context.Context, name string) (*cloudhub.SaltJob, error) {
+	return s.submitSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "runner_async",
+		Function: "salt.cmd",
+		Kwarg: saltJobKwarg(map[string]interface{}{
+			"fun":  "service.reload",
+			"name": name,
+		}),
+	})
 }
 
 // IsActiveMinionPingTest checks if the specified minion is active by sending a ping request.
@@ -493,34 +389,16 @@ func (s *Service) GetWheelKeyAcceptedListAll() (int, []byte, error) {
 	return s.SaltHTTPPost(payload)
 }
 
-// DockerRestart is tests to see if path is a valid directory
-func (s *Service) DockerRestart(path string, targetMinion string, dockerCommand string) (int, []byte, error) {
-	type kwarg struct {
-		Cmd string `json:"cmd"`
-		Cwd string `json:"cwd"`
-	}
-
-	type param struct {
-		Token  string `json:"token"`
-		Eauth  string `json:"eauth"`
-		Client string `json:"client"`
-		Fun    string `json:"fun"`
-		Target string `json:"tgt"`
-		Kwarg  kwarg  `json:"kwarg"`
-	}
-
-	body := &param{
-		Token:  s.AddonTokens["salt"],
-		Eauth:  "pam",
-		Client: "local",
-		Target: targetMinion,
-		Fun:    "cmd.run",
-		Kwarg: kwarg{
-			Cmd: dockerCommand,
-			Cwd: path,
-		},
-	}
-
-	payload, _ := json.Marshal(body)
-	return s.SaltHTTPPost(payload)
+// DockerRestart runs the docker command in path on the target minion. It
+// submits a local_async job and returns without waiting for the restart.
+func (s *Service) DockerRestart(ctx context.Context, path string, targetMinion string, dockerCommand string) (*cloudhub.SaltJob, error) {
+	return s.submitSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   "local_async",
+		Function: "cmd.run",
+		Target:   targetMinion,
+		Kwarg: saltJobKwarg(map[string]interface{}{
+			"cmd": dockerCommand,
+			"cwd": path,
+		}),
+	})
 }
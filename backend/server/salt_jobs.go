@@ -0,0 +1,402 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+)
+
+var (
+	// saltJobFirstPoll is how soon a job that is waited for is first looked
+	// up again; the wait doubles up to saltJobPollInterval
+	saltJobFirstPoll = 100 * time.Millisecond
+	// saltJobPollInterval is the longest wait between lookups of a job
+	saltJobPollInterval = 2 * time.Second
+	// saltJobWait is how long a request waits for a job before leaving it
+	// to be followed through the salt jobs endpoints
+	saltJobWait = 10 * time.Second
+	// saltJobTimeout is how long minions have to return before a job fails
+	saltJobTimeout = 10 * time.Minute
+)
+
+// saltJobLowstate is the lowstate j is submitted to the Salt API with
+func (s *Service) saltJobLowstate(j *cloudhub.SaltJob) (map[string]interface{}, error) {
+	low := map[string]interface{}{
+		"token":  s.AddonTokens["salt"],
+		"eauth":  "pam",
+		"client": j.Client,
+		"fun":    j.Function,
+	}
+	if j.Target != "" {
+		low["tgt"] = j.Target
+	}
+	if len(j.Arg) > 0 {
+		low["arg"] = j.Arg
+	}
+	if j.Kwarg != "" {
+		var kwarg map[string]interface{}
+		if err := json.Unmarshal([]byte(j.Kwarg), &kwarg); err != nil {
+			return nil, fmt.Errorf("invalid kwarg of salt job: %v", err)
+		}
+		low["kwarg"] = kwarg
+	}
+	return low, nil
+}
+
+// saltJobKwarg encodes the keyword arguments of a job
+func saltJobKwarg(kwarg map[string]interface{}) string {
+	octets, _ := json.Marshal(kwarg)
+	return string(octets)
+}
+
+// submitSaltJob submits j to the Salt API without waiting for it and saves
+// it with the JID and minions Salt assigned.
+func (s *Service) submitSaltJob(ctx context.Context, j *cloudhub.SaltJob) (*cloudhub.SaltJob, error) {
+	low, err := s.saltJobLowstate(j)
+	if err != nil {
+		return nil, err
+	}
+	payload, _ := json.Marshal(low)
+	statusCode, resp, err := s.SaltHTTPPost(payload)
+	if err != nil {
+		return nil, err
+	} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("salt api responded %d to %s: %s", statusCode, j.Function, resp)
+	}
+
+	r := &struct {
+		Return []struct {
+			JID     string   `json:"jid"`
+			Minions []string `json:"minions"`
+		} `json:"return"`
+	}{}
+	if err := json.Unmarshal(resp, r); err != nil {
+		return nil, fmt.Errorf("invalid salt api response: %v", err)
+	}
+	// Salt returns no job when the target matches no minion
+	if len(r.Return) == 0 || r.Return[0].JID == "" {
+		return nil, fmt.Errorf("no minion matched %q for %s", j.Target, j.Function)
+	}
+
+	j.JID = r.Return[0].JID
+	j.Minions = r.Return[0].Minions
+	j.Status = cloudhub.SaltJobPending
+	j.CreatedAt = s.now()
+	if user, ok := hasUserContext(ctx); ok {
+		j.Requester = user.Name
+	}
+
+	return s.Store.SaltJobs(ctx).Add(ctx, j)
+}
+
+// refreshSaltJob looks up the returns of an unfinished job and saves its
+// status and result.
+func (s *Service) refreshSaltJob(ctx context.Context, j *cloudhub.SaltJob) error {
+	if j.Finished() {
+		return nil
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"token":  s.AddonTokens["salt"],
+		"eauth":  "pam",
+		"client": "runner",
+		"fun":    "jobs.list_job",
+		"kwarg":  map[string]string{"jid": j.JID},
+	})
+	statusCode, resp, err := s.SaltHTTPPost(payload)
+	if err != nil {
+		return err
+	} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("salt api responded %d to jobs.list_job: %s", statusCode, resp)
+	}
+
+	type minionReturn struct {
+		Return  json.RawMessage `json:"return"`
+		Retcode int             `json:"retcode"`
+		Success *bool           `json:"success"`
+	}
+	r := &struct {
+		Return []struct {
+			Minions []string                `json:"Minions"`
+			Result  map[string]minionReturn `json:"Result"`
+		} `json:"return"`
+	}{}
+	if err := json.Unmarshal(resp, r); err != nil {
+		return fmt.Errorf("invalid salt api response: %v", err)
+	}
+	if len(r.Return) == 0 {
+		return fmt.Errorf("salt api returned no lookup of job %s", j.JID)
+	}
+
+	// Runner jobs only learn the minion they run on from the job cache
+	expected := j.Minions
+	if len(expected) == 0 {
+		expected = r.Return[0].Minions
+	}
+
+	returns := map[string]json.RawMessage{}
+	var failed, missing []string
+	for minion, ret := range r.Return[0].Result {
+		returns[minion] = ret.Return
+		if ret.Retcode != 0 || (ret.Success != nil && !*ret.Success) {
+			failed = append(failed, minion)
+		}
+	}
+	for _, minion := range expected {
+		if _, ok := returns[minion]; !ok {
+			missing = append(missing, minion)
+		}
+	}
+	sort.Strings(failed)
+
+	if len(returns) > 0 {
+		j.Result, _ = json.Marshal(returns)
+	}
+	switch {
+	case len(missing) == 0 && len(returns) > 0:
+		j.Status = cloudhub.SaltJobSucceeded
+		if len(failed) > 0 {
+			j.Status = cloudhub.SaltJobFailed
+			j.Error = fmt.Sprintf("failed on %s", strings.Join(failed, ", "))
+		}
+		j.FinishedAt = s.now()
+	case s.now().Sub(j.CreatedAt) > saltJobTimeout:
+		j.Status = cloudhub.SaltJobFailed
+		j.Error = fmt.Sprintf("timed out waiting for %s", strings.Join(missing, ", "))
+		if len(expected) == 0 {
+			j.Error = "timed out waiting for the job to return"
+		}
+		j.FinishedAt = s.now()
+	case len(returns) > 0:
+		j.Status = cloudhub.SaltJobRunning
+	}
+
+	return s.Store.SaltJobs(ctx).Update(ctx, j)
+}
+
+// waitSaltJob polls j until it finishes or ctx is done
+func (s *Service) waitSaltJob(ctx context.Context, j *cloudhub.SaltJob) error {
+	poll := saltJobFirstPoll
+	for {
+		if err := s.refreshSaltJob(ctx, j); err != nil {
+			return err
+		}
+		if j.Finished() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+		if poll *= 2; poll > saltJobPollInterval {
+			poll = saltJobPollInterval
+		}
+	}
+}
+
+// runSaltJob submits j and waits up to saltJobWait for it, failing if the
+// job does. A job that is still running is left to be followed by its JID.
+func (s *Service) runSaltJob(ctx context.Context, j *cloudhub.SaltJob) (*cloudhub.SaltJob, error) {
+	j, err := s.submitSaltJob(ctx, j)
+	if err != nil {
+		return nil, err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, saltJobWait)
+	defer cancel()
+	if err := s.waitSaltJob(waitCtx, j); err == context.DeadlineExceeded && ctx.Err() == nil {
+		return j, fmt.Errorf("salt job %s of %s is still %s after %s; follow it at /cloudhub/v1/salt/jobs/%s", j.JID, j.Function, j.Status, saltJobWait, j.JID)
+	} else if err != nil {
+		return j, err
+	}
+	if j.Status == cloudhub.SaltJobFailed {
+		return j, fmt.Errorf("salt job %s of %s %s: %s", j.JID, j.Function, j.Status, j.Error)
+	}
+	return j, nil
+}
+
+// saltJobResult returns the status code, result and error of a job the way
+// the synchronous Salt API helpers do
+func saltJobResult(j *cloudhub.SaltJob, err error) (int, []byte, error) {
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, j.Result, nil
+}
+
+type saltJobLinks struct {
+	Self  string `json:"self"`  // Self link mapping to this resource
+	Rerun string `json:"rerun"` // Rerun link to submit the job again
+}
+
+// saltJobResponse leaves out the arguments of a job, which may hold
+// configuration files with credentials.
+type saltJobResponse struct {
+	JID          string          `json:"jid"`
+	Organization string          `json:"organization"`
+	Client       string          `json:"client"`
+	Function     string          `json:"function"`
+	Target       string          `json:"target,omitempty"`
+	Minions      []string        `json:"minions"`
+	Requester    string          `json:"requester"`
+	Status       string          `json:"status"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	RerunOf      string          `json:"rerunOf,omitempty"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	FinishedAt   *time.Time      `json:"finishedAt,omitempty"`
+	Links        saltJobLinks    `json:"links"`
+}
+
+func newSaltJobResponse(j *cloudhub.SaltJob) *saltJobResponse {
+	minions := j.Minions
+	if minions == nil {
+		minions = []string{}
+	}
+	res := &saltJobResponse{
+		JID:          j.JID,
+		Organization: j.Organization,
+		Client:       j.Client,
+		Function:     j.Function,
+		Target:       j.Target,
+		Minions:      minions,
+		Requester:    j.Requester,
+		Status:       j.Status,
+		Result:       j.Result,
+		Error:        j.Error,
+		RerunOf:      j.RerunOf,
+		CreatedAt:    j.CreatedAt,
+		Links: saltJobLinks{
+			Self:  fmt.Sprintf("/cloudhub/v1/salt/jobs/%s", j.JID),
+			Rerun: fmt.Sprintf("/cloudhub/v1/salt/jobs/%s/rerun", j.JID),
+		},
+	}
+	if !j.FinishedAt.IsZero() {
+		res.FinishedAt = &j.FinishedAt
+	}
+	return res
+}
+
+type saltJobsResponse struct {
+	Links selfLinks          `json:"links"`
+	Jobs  []*saltJobResponse `json:"jobs"`
+}
+
+// ranOn reports whether j was submitted to minion
+func (j saltJobResponse) ranOn(minion string) bool {
+	if j.Target == minion {
+		return true
+	}
+	for _, m := range j.Minions {
+		if m == minion {
+			return true
+		}
+	}
+	return false
+}
+
+// SaltJobs lists the Salt jobs of the current organization, newest first.
+// The minion query parameter limits the history to the jobs of a minion.
+func (s *Service) SaltJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	minion := r.URL.Query().Get("minion")
+
+	all, err := s.Store.SaltJobs(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "Error loading salt jobs", s.Logger)
+		return
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+
+	res := saltJobsResponse{
+		Links: selfLinks{Self: "/cloudhub/v1/salt/jobs"},
+		Jobs:  []*saltJobResponse{},
+	}
+	for i := range all {
+		job := newSaltJobResponse(&all[i])
+		if minion == "" || job.ranOn(minion) {
+			res.Jobs = append(res.Jobs, job)
+		}
+	}
+
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// SaltJobByID returns the status and result of a Salt job, looking up the
+// returns of minions from the Salt API while it is unfinished.
+func (s *Service) SaltJobByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	jid := httprouter.GetParamFromContext(ctx, "jid")
+
+	j, err := s.Store.SaltJobs(ctx).Get(ctx, jid)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	if err := s.refreshSaltJob(ctx, j); err != nil {
+		Error(w, http.StatusBadGateway, fmt.Sprintf("unable to look up salt job %s: %v", jid, err), s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newSaltJobResponse(j), s.Logger)
+}
+
+// RerunSaltJob submits a Salt job again with the same function, target and
+// arguments. The call is checked against the Salt policy of the organization
+// as if the current user had made it through the Salt proxy.
+func (s *Service) RerunSaltJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	jid := httprouter.GetParamFromContext(ctx, "jid")
+
+	prev, err := s.Store.SaltJobs(ctx).Get(ctx, jid)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	// The lowstate is checked as the Salt proxy would read it off the wire
+	low, err := s.saltJobLowstate(prev)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	payload, _ := json.Marshal(low)
+	calls, err := parseSaltCalls(payload, false)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	if !s.allowSaltCalls(ctx, w, calls) {
+		return
+	}
+
+	j, err := s.submitSaltJob(ctx, &cloudhub.SaltJob{
+		Client:   prev.Client,
+		Function: prev.Function,
+		Target:   prev.Target,
+		Arg:      prev.Arg,
+		Kwarg:    prev.Kwarg,
+		RerunOf:  prev.JID,
+	})
+	if err != nil {
+		Error(w, http.StatusBadGateway, fmt.Sprintf("unable to rerun salt job %s: %v", jid, err), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgSaltJobRerun.String(), prev.JID, j.JID)
+	s.logChange(ctx, "Salt", msg, nil, nil)
+
+	res := newSaltJobResponse(j)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusAccepted, res, s.Logger)
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+// memSaltJobs is a SaltJobsStore kept in memory
+func memSaltJobs(jobs ...cloudhub.SaltJob) *mocks.SaltJobsStore {
+	var mu sync.Mutex
+	js := map[string]cloudhub.SaltJob{}
+	for _, j := range jobs {
+		js[j.JID] = j
+	}
+	return &mocks.SaltJobsStore{
+		AddF: func(ctx context.Context, j *cloudhub.SaltJob) (*cloudhub.SaltJob, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			js[j.JID] = *j
+			return j, nil
+		},
+		AllF: func(ctx context.Context) ([]cloudhub.SaltJob, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var all []cloudhub.SaltJob
+			for _, j := range js {
+				all = append(all, j)
+			}
+			return all, nil
+		},
+		GetF: func(ctx context.Context, jid string) (*cloudhub.SaltJob, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			j, ok := js[jid]
+			if !ok {
+				return nil, cloudhub.ErrSaltJobNotFound
+			}
+			return &j, nil
+		},
+		UpdateF: func(ctx context.Context, j *cloudhub.SaltJob) error {
+			mu.Lock()
+			defer mu.Unlock()
+			js[j.JID] = *j
+			return nil
+		},
+	}
+}
+
+// fakeSaltAPI answers async submissions with a new job and returns the
+// result of a job on the lookup after the one that finds it pending, unless
+// it is silent.
+type fakeSaltAPI struct {
+	*httptest.Server
+	mu        sync.Mutex
+	submitted []map[string]interface{}
+	lookups   map[string]int
+	retcode   int
+	silent    bool
+}
+
+func newFakeSaltAPI(t *testing.T) *fakeSaltAPI {
+	f := &fakeSaltAPI{lookups: map[string]int{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var low map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&low); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch low["client"] {
+		case "local_async", "runner_async":
+			f.submitted = append(f.submitted, low)
+			jid := fmt.Sprintf("2015102116290000000%d", len(f.submitted))
+			minions := []string{}
+			if tgt, ok := low["tgt"].(string); ok {
+				minions = append(minions, tgt)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"return": []interface{}{map[string]interface{}{"jid": jid, "minions": minions}},
+			})
+		case "runner":
+			jid := low["kwarg"].(map[string]interface{})["jid"].(string)
+			f.lookups[jid]++
+			result := map[string]interface{}{}
+			if f.lookups[jid] > 1 && !f.silent {
+				result["ch-collector-1"] = map[string]interface{}{"return": "Wrote 1 lines", "retcode": f.retcode, "success": f.retcode == 0}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"return": []interface{}{map[string]interface{}{"jid": jid, "Minions": []string{"ch-collector-1"}, "Result": result}},
+			})
+		default:
+			http.Error(w, "unexpected client", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestService_runSaltJob(t *testing.T) {
+	defer func(first, interval, wait time.Duration) {
+		saltJobFirstPoll, saltJobPollInterval, saltJobWait = first, interval, wait
+	}(saltJobFirstPoll, saltJobPollInterval, saltJobWait)
+	saltJobFirstPoll, saltJobPollInterval, saltJobWait = time.Millisecond, time.Millisecond, 50*time.Millisecond
+
+	tests := []struct {
+		name       string
+		retcode    int
+		silent     bool
+		wantErr    bool
+		wantStatus string
+	}{
+		{name: "minion returns", wantStatus: cloudhub.SaltJobSucceeded},
+		{name: "minion fails", retcode: 1, wantErr: true, wantStatus: cloudhub.SaltJobFailed},
+		{name: "minion is down", silent: true, wantErr: true, wantStatus: cloudhub.SaltJobPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			salt := newFakeSaltAPI(t)
+			salt.retcode = tt.retcode
+			salt.silent = tt.silent
+			jobs := memSaltJobs()
+			s := &Service{
+				Store:       &mocks.Store{SaltJobsStore: jobs},
+				Logger:      log.New(log.DebugLevel),
+				AddonURLs:   map[string]string{"salt": salt.URL},
+				AddonTokens: map[string]string{"salt": "1.21-gigawatts"},
+			}
+			ctx := context.WithValue(context.Background(), UserContextKey, &cloudhub.User{Name: "doc"})
+
+			j, err := s.CreateFileWithLocalClient(ctx, "/etc/logstash/default.rb", []string{"input {}"}, "ch-collector-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateFileWithLocalClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(salt.submitted) != 1 || salt.submitted[0]["client"] != "local_async" || salt.submitted[0]["fun"] != "file.write" {
+				t.Fatalf("CreateFileWithLocalClient() submitted %v, want a local_async file.write", salt.submitted)
+			}
+
+			saved, getErr := jobs.Get(ctx, j.JID)
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+			if saved.Status != tt.wantStatus || saved.Requester != "doc" || saved.Target != "ch-collector-1" {
+				t.Errorf("saved job = %+v, want %s by doc", saved, tt.wantStatus)
+			}
+			if tt.silent {
+				// the request gives up on the job but the job is still followed
+				if !strings.Contains(err.Error(), "/cloudhub/v1/salt/jobs/"+j.JID) || !saved.FinishedAt.IsZero() {
+					t.Errorf("CreateFileWithLocalClient() of a job still running = %v, saved %+v", err, saved)
+				}
+				return
+			}
+			if saved.FinishedAt.IsZero() {
+				t.Errorf("saved job = %+v, want it finished", saved)
+			}
+			if !strings.Contains(string(saved.Result), "Wrote 1 lines") {
+				t.Errorf("saved job result = %s", saved.Result)
+			}
+		})
+	}
+}
+
+func TestService_DockerRestart(t *testing.T) {
+	salt := newFakeSaltAPI(t)
+	s := &Service{
+		Store:       &mocks.Store{SaltJobsStore: memSaltJobs()},
+		Logger:      log.New(log.DebugLevel),
+		AddonURLs:   map[string]string{"salt": salt.URL},
+		AddonTokens: map[string]string{"salt": "1.21-gigawatts"},
+	}
+
+	j, err := s.DockerRestart(context.Background(), "/opt/logstash", "ch-collector-1", "docker compose restart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Status != cloudhub.SaltJobPending || len(salt.lookups) != 0 {
+		t.Errorf("DockerRestart() waited for the job: %+v, lookups %v", j, salt.lookups)
+	}
+}
+
+func TestService_SaltJobByID(t *testing.T) {
+	salt := newFakeSaltAPI(t)
+	created := time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+	jobs := memSaltJobs(
+		cloudhub.SaltJob{JID: "1", Client: "local_async", Function: "cmd.run", Target: "ch-collector-1", Minions: []string{"ch-collector-1"}, Status: cloudhub.SaltJobPending, CreatedAt: created},
+		cloudhub.SaltJob{JID: "2", Client: "local_async", Function: "cmd.run", Target: "ch-collector-2", Minions: []string{"ch-collector-2"}, Status: cloudhub.SaltJobPending, CreatedAt: created},
+	)
+	s := &Service{
+		Store:       &mocks.Store{SaltJobsStore: jobs},
+		Logger:      log.New(log.DebugLevel),
+		AddonURLs:   map[string]string{"salt": salt.URL},
+		AddonTokens: map[string]string{"salt": "1.21-gigawatts"},
+		Now:         func() time.Time { return created.Add(time.Minute) },
+	}
+
+	get := func(jid string) *saltJobResponse {
+		t.Helper()
+		ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "jid", Value: jid}})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/salt/jobs/"+jid, nil).WithContext(ctx)
+		s.SaltJobByID(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("SaltJobByID() = %d %s", w.Code, w.Body.String())
+		}
+		var res saltJobResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return &res
+	}
+
+	if res := get("1"); res.Status != cloudhub.SaltJobPending {
+		t.Errorf("first SaltJobByID() status = %s, want %s", res.Status, cloudhub.SaltJobPending)
+	}
+	if res := get("1"); res.Status != cloudhub.SaltJobSucceeded || res.FinishedAt == nil {
+		t.Errorf("second SaltJobByID() = %+v, want it succeeded", res)
+	}
+
+	// ch-collector-2 never returns
+	s.Now = func() time.Time { return created.Add(saltJobTimeout + time.Minute) }
+	if res := get("2"); res.Status != cloudhub.SaltJobFailed || !strings.Contains(res.Error, "ch-collector-2") {
+		t.Errorf("SaltJobByID() of a timed out job = %+v", res)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://any.url/cloudhub/v1/salt/jobs?minion=ch-collector-2", nil)
+	s.SaltJobs(w, r)
+	var list saltJobsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Jobs) != 1 || list.Jobs[0].JID != "2" {
+		t.Errorf("SaltJobs() of ch-collector-2 = %s", w.Body.String())
+	}
+}
+
+func TestService_RerunSaltJob(t *testing.T) {
+	restricted := cloudhub.SaltPolicyConfig{
+		Rules: []cloudhub.SaltRule{
+			{Role: roles.EditorRoleName, Clients: []string{"local*"}, Functions: []string{"cmd.run"}, Args: []string{"uptime", "cwd=/opt/*"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		role       string
+		policy     cloudhub.SaltPolicyConfig
+		job        cloudhub.SaltJob
+		wantStatus int
+	}{
+		{
+			name:       "admin",
+			role:       roles.AdminRoleName,
+			job:        cloudhub.SaltJob{Kwarg: `{"cmd":"docker compose restart","cwd":"/opt/logstash"}`},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "editor may not run commands",
+			role:       roles.EditorRoleName,
+			job:        cloudhub.SaltJob{Kwarg: `{"cmd":"docker compose restart","cwd":"/opt/logstash"}`},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "policy of the organization allows the arguments",
+			role:       roles.EditorRoleName,
+			policy:     restricted,
+			job:        cloudhub.SaltJob{Arg: []string{"uptime"}, Kwarg: `{"cwd":"/opt/logstash"}`},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "policy of the organization limits the arguments",
+			role:       roles.EditorRoleName,
+			policy:     restricted,
+			job:        cloudhub.SaltJob{Arg: []string{"rm -rf /"}, Kwarg: `{"cwd":"/opt/logstash"}`},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			salt := newFakeSaltAPI(t)
+			prev := tt.job
+			prev.JID, prev.Client, prev.Function, prev.Target, prev.Status = "1", "local_async", "cmd.run", "ch-collector-1", cloudhub.SaltJobFailed
+			jobs := memSaltJobs(prev)
+			s := &Service{
+				Store: &mocks.Store{
+					SaltJobsStore: jobs,
+					OrganizationConfigStore: &mocks.OrganizationConfigStore{
+						FindOrCreateF: func(ctx context.Context, id string) (*cloudhub.OrganizationConfig, error) {
+							return &cloudhub.OrganizationConfig{OrganizationID: id, SaltPolicy: tt.policy}, nil
+						},
+					},
+					AuditStore: &mocks.AuditStore{
+						AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+							return e, nil
+						},
+					},
+				},
+				Logger:      log.New(log.DebugLevel),
+				AddonURLs:   map[string]string{"salt": salt.URL},
+				AddonTokens: map[string]string{"salt": "1.21-gigawatts"},
+			}
+
+			ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "jid", Value: "1"}})
+			ctx = context.WithValue(ctx, organizations.ContextKey, "default")
+			ctx = context.WithValue(ctx, roles.ContextKey, tt.role)
+			ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{Name: "marty"})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/salt/jobs/1/rerun", nil).WithContext(ctx)
+			s.RerunSaltJob(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("RerunSaltJob() = %d %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if w.Code != http.StatusAccepted {
+				if len(salt.submitted) != 0 {
+					t.Errorf("RerunSaltJob() submitted a denied job")
+				}
+				return
+			}
+			if len(salt.submitted) != 1 {
+				t.Fatalf("RerunSaltJob() submitted %v", salt.submitted)
+			}
+			kwarg := salt.submitted[0]["kwarg"].(map[string]interface{})
+			if salt.submitted[0]["fun"] != "cmd.run" || kwarg["cwd"] != "/opt/logstash" || len(prev.Arg) != len(saltStrings(salt.submitted[0]["arg"])) {
+				t.Errorf("RerunSaltJob() submitted %v", salt.submitted[0])
+			}
+			var res saltJobResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.RerunOf != "1" || res.Requester != "marty" || w.Header().Get("Location") != res.Links.Self {
+				t.Errorf("RerunSaltJob() = %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+// defaultSaltRules apply to organizations without Salt policy rules of their
+// own. Viewers may only read, though not cluster secrets, editors may also
+// manage services, files, packages and Kubernetes, and running commands or
+// managing minion keys is left to admins.
+var defaultSaltRules = []cloudhub.SaltRule{
+	{
+		Role:    roles.ViewerRoleName,
+		Clients: []string{"local*", "runner*", "wheel*"},
+		Functions: []string{
+			"test.ping",
+			"grains.get", "grains.item", "grains.items", "grains.ls",
+			"key.finger", "key.list", "key.list_all", "key.name_match",
+			"service.available", "service.enabled", "service.get_all", "service.get_running", "service.status",
+			"ipmi.get_*",
+			"manage.allowed", "jobs.*",
+			"boto_secgroup.get_*",
+			"kubernetes.show_cluster_role", "kubernetes.show_cluster_role_binding", "kubernetes.show_configmap",
+			"kubernetes.show_cron_job", "kubernetes.show_daemon_set", "kubernetes.show_deployment",
+			"kubernetes.show_ingress", "kubernetes.show_job", "kubernetes.show_namespace",
+			"kubernetes.show_persistent_volume", "kubernetes.show_persistent_volume_claim", "kubernetes.show_pod",
+			"kubernetes.show_replica_set", "kubernetes.show_replication_controller", "kubernetes.show_role",
+			"kubernetes.show_role_binding", "kubernetes.show_service", "kubernetes.show_service_account",
+			"kubernetes.show_stateful_set", "kubernetes.node", "kubernetes.node_labels",
+			"kubernetes.cluster_role_bindings", "kubernetes.cluster_roles", "kubernetes.configmaps",
+			"kubernetes.cron_jobs", "kubernetes.daemon_sets", "kubernetes.deployments", "kubernetes.ingresses",
+			"kubernetes.jobs", "kubernetes.namespaces", "kubernetes.nodes", "kubernetes.persistent_volume_claims",
+			"kubernetes.persistent_volumes", "kubernetes.pods", "kubernetes.replica_sets",
+			"kubernetes.replication_controllers", "kubernetes.role_bindings", "kubernetes.roles",
+			"kubernetes.service_accounts", "kubernetes.services", "kubernetes.stateful_sets",
+		},
+	},
+	{
+		Role:    roles.EditorRoleName,
+		Clients: []string{"local*", "runner*", "wheel*"},
+		Functions: []string{
+			"service.*", "file.*", "pkg.*", "cp.*", "ipmi.*",
+			"cloud.*", "vsphere.*", "kubernetes.*", "boto_*", "http.query",
+		},
+	},
+	{
+		Role:      roles.AdminRoleName,
+		Clients:   []string{"*"},
+		Functions: []string{"*"},
+	},
+}
+
+// saltLowstateKeys are the keys of a Salt lowstate that are not passed on to
+// the called function as keyword arguments.
+var saltLowstateKeys = map[string]bool{
+	"client":      true,
+	"fun":         true,
+	"arg":         true,
+	"kwarg":       true,
+	"tgt":         true,
+	"tgt_type":    true,
+	"expr_form":   true,
+	"match":       true,
+	"token":       true,
+	"eauth":       true,
+	"username":    true,
+	"password":    true,
+	"timeout":     true,
+	"full_return": true,
+}
+
+// saltRoleRanks orders the roles so that a rule also applies to the roles
+// above its own
+var saltRoleRanks = map[string]int{
+	roles.MemberRoleName: 1,
+	roles.ViewerRoleName: 2,
+	roles.EditorRoleName: 3,
+	roles.AdminRoleName:  4,
+}
+
+// saltCall is a single Salt API lowstate reduced to what a policy checks
+type saltCall struct {
+	Client     string
+	Functions  []string
+	Targets    []string
+	TargetType string
+	Args       []string
+}
+
+func (c saltCall) String() string {
+	s := fmt.Sprintf("%s %s", c.Client, strings.Join(c.Functions, ","))
+	if len(c.Targets) > 0 {
+		s += " on " + strings.Join(c.Targets, ",")
+	}
+	return s
+}
+
+// parseSaltCalls reads the lowstates of a Salt API request body, which holds
+// a list of them when array is set and a single one otherwise.
+func parseSaltCalls(body []byte, array bool) ([]saltCall, error) {
+	var lows []map[string]interface{}
+	if array {
+		if err := json.Unmarshal(body, &lows); err != nil {
+			return nil, err
+		}
+	} else {
+		var low map[string]interface{}
+		if err := json.Unmarshal(body, &low); err != nil {
+			return nil, err
+		}
+		lows = append(lows, low)
+	}
+
+	calls := make([]saltCall, len(lows))
+	for i, low := range lows {
+		calls[i] = newSaltCall(low)
+	}
+	return calls, nil
+}
+
+func newSaltCall(low map[string]interface{}) saltCall {
+	c := saltCall{}
+	c.Client, _ = low["client"].(string)
+	c.TargetType, _ = low["tgt_type"].(string)
+	if c.TargetType == "" {
+		c.TargetType, _ = low["expr_form"].(string)
+	}
+	c.Targets = saltStrings(low["tgt"])
+	if match, ok := low["match"]; ok {
+		c.Targets = append(c.Targets, saltStrings(match)...)
+	}
+
+	args, _ := low["arg"].([]interface{})
+	kwarg, _ := low["kwarg"].(map[string]interface{})
+	c.Functions = saltStrings(low["fun"])
+
+	// The runner salt.cmd calls an execution module function on the master
+	if strings.HasPrefix(c.Client, "runner") && len(c.Functions) == 1 && c.Functions[0] == "salt.cmd" {
+		if fun, ok := kwarg["fun"]; ok {
+			c.Functions = saltStrings(fun)
+			delete(kwarg, "fun")
+		} else if len(args) > 0 {
+			c.Functions = saltStrings(args[0])
+			args = args[1:]
+		} else {
+			c.Functions = nil
+		}
+	}
+
+	// Compound commands call several functions with a list of arguments each
+	if _, ok := low["fun"].([]interface{}); ok {
+		var flat []interface{}
+		for _, a := range args {
+			if list, ok := a.([]interface{}); ok {
+				flat = append(flat, list...)
+			} else {
+				flat = append(flat, a)
+			}
+		}
+		args = flat
+	}
+
+	for _, a := range args {
+		c.Args = append(c.Args, saltArg(a))
+	}
+	for k, v := range kwarg {
+		c.Args = append(c.Args, k+"="+saltArg(v))
+	}
+	for k, v := range low {
+		if !saltLowstateKeys[k] {
+			c.Args = append(c.Args, k+"="+saltArg(v))
+		}
+	}
+	sort.Strings(c.Args[len(args):])
+	return c
+}
+
+// saltStrings reads a lowstate value that is either a string or a list
+func saltStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var s []string
+		for _, e := range v {
+			s = append(s, saltArg(e))
+		}
+		return s
+	}
+	return nil
+}
+
+// saltArg renders an argument for matching; anything but a string is JSON
+func saltArg(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	octets, _ := json.Marshal(v)
+	return string(octets)
+}
+
+// matchesAny reports whether s matches one of patterns
+func matchesAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAll reports whether every value matches one of patterns
+func matchesAll(patterns, values []string) bool {
+	for _, v := range values {
+		if !matchesAny(patterns, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowedBy reports whether the rule lets role make the call
+func (c saltCall) allowedBy(r cloudhub.SaltRule, role string) bool {
+	if saltRoleRanks[role] < saltRoleRanks[r.Role] {
+		return false
+	}
+	if !matchesAny(r.Clients, c.Client) {
+		return false
+	}
+	if len(c.Functions) == 0 {
+		if !matchesAny(r.Functions, "") {
+			return false
+		}
+	} else if !matchesAll(r.Functions, c.Functions) {
+		return false
+	}
+	if len(r.Targets) > 0 {
+		// A target expression other than a glob or list cannot be matched
+		// against the patterns, say a compound one naming extra minions
+		switch c.TargetType {
+		case "", "glob", "list":
+		default:
+			return false
+		}
+		if !matchesAll(r.Targets, c.Targets) {
+			return false
+		}
+	}
+	if len(r.Args) > 0 && !matchesAll(r.Args, c.Args) {
+		return false
+	}
+	return true
+}
+
+// saltRules returns the Salt policy rules of config, or the default ones
+func saltRules(config cloudhub.SaltPolicyConfig) []cloudhub.SaltRule {
+	if len(config.Rules) == 0 {
+		return defaultSaltRules
+	}
+	return config.Rules
+}
+
+// deniedSaltCall returns the first of calls that no rule allows role to make
+func deniedSaltCall(rules []cloudhub.SaltRule, role string, calls []saltCall) (saltCall, bool) {
+	for _, c := range calls {
+		allowed := false
+		for _, r := range rules {
+			if c.allowedBy(r, role) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return c, true
+		}
+	}
+	return saltCall{}, false
+}
+
+// saltPolicyRules returns the Salt policy rules of the organization on ctx
+func (s *Service) saltPolicyRules(ctx context.Context) ([]cloudhub.SaltRule, error) {
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		return defaultSaltRules, nil
+	}
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return saltRules(config.SaltPolicy), nil
+}
+
+// authorizeSaltCalls checks the lowstates of body against the Salt policy of
+// the organization. It responds and returns false if a call is not allowed.
+func (s *Service) authorizeSaltCalls(w http.ResponseWriter, r *http.Request, body []byte, array bool) bool {
+	calls, err := parseSaltCalls(body, array)
+	if err != nil {
+		invalidData(w, fmt.Errorf("invalid salt lowstate: %v", err), s.Logger)
+		return false
+	}
+	return s.allowSaltCalls(r.Context(), w, calls)
+}
+
+// allowSaltCalls checks calls against the Salt policy of the organization on
+// ctx. A denied call is audited and answered with 403.
+func (s *Service) allowSaltCalls(ctx context.Context, w http.ResponseWriter, calls []saltCall) bool {
+	// Without auth there is no role on context and the user acts as an admin
+	role, ok := hasRoleContext(ctx)
+	if !ok {
+		role = roles.AdminRoleName
+	}
+
+	rules, err := s.saltPolicyRules(ctx)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return false
+	}
+
+	call, denied := deniedSaltCall(rules, role, calls)
+	if !denied {
+		return true
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgSaltCallDenied.String(), call, role)
+	s.logChange(ctx, "Salt", msg, nil, nil)
+
+	Error(w, http.StatusForbidden, fmt.Sprintf("role %s is not allowed to call %s", role, call), s.Logger)
+	return false
+}
+
+// validSaltPolicy checks that every rule names a role, clients and functions
+// and that all of its patterns are well formed
+func validSaltPolicy(config cloudhub.SaltPolicyConfig) error {
+	for i, r := range config.Rules {
+		if _, ok := saltRoleRanks[r.Role]; !ok {
+			return fmt.Errorf("rule %d: unknown role %q", i, r.Role)
+		}
+		if len(r.Clients) == 0 {
+			return fmt.Errorf("rule %d: clients are required", i)
+		}
+		if len(r.Functions) == 0 {
+			return fmt.Errorf("rule %d: functions are required", i)
+		}
+		for _, patterns := range [][]string{r.Clients, r.Functions, r.Targets, r.Args} {
+			for _, p := range patterns {
+				if _, err := path.Match(p, ""); err != nil {
+					return fmt.Errorf("rule %d: invalid pattern %q", i, p)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type saltPolicyConfigResponse struct {
+	Links selfLinks `json:"links"`
+	cloudhub.SaltPolicyConfig
+}
+
+// newSaltPolicyConfigResponse lists the rules in effect, which are the
+// default ones if the organization has none
+func newSaltPolicyConfigResponse(c cloudhub.SaltPolicyConfig) *saltPolicyConfigResponse {
+	return &saltPolicyConfigResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/org_config/salt_policy",
+		},
+		SaltPolicyConfig: cloudhub.SaltPolicyConfig{
+			Rules: saltRules(c),
+		},
+	}
+}
+
+// OrganizationSaltPolicyConfig retrieves the Salt policy section of the organization config
+func (s *Service) OrganizationSaltPolicyConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := newSaltPolicyConfigResponse(config.SaltPolicy)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ReplaceOrganizationSaltPolicyConfig replaces the Salt policy section of the
+// organization config. Replacing it without rules restores the default policy.
+func (s *Service) ReplaceOrganizationSaltPolicyConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	var policyConfig cloudhub.SaltPolicyConfig
+	if err := json.NewDecoder(r.Body).Decode(&policyConfig); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if err := validSaltPolicy(policyConfig); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	before := config.SaltPolicy
+	config.SaltPolicy = policyConfig
+	if err := s.Store.OrganizationConfig(ctx).Put(ctx, config); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgSaltPolicyModified.String(), orgID)
+	s.logChange(ctx, "Organizations", msg, before, config.SaltPolicy)
+
+	res := newSaltPolicyConfigResponse(config.SaltPolicy)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
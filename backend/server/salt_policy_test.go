@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/organizations"
+	"github.com/snetsystems/cloudhub/backend/roles"
+)
+
+func TestService_SaltProxyPost_Policy(t *testing.T) {
+	var forwarded []string
+	salt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		forwarded = append(forwarded, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"return":[{"minion1":true}]}`))
+	}))
+	defer salt.Close()
+
+	restricted := cloudhub.SaltPolicyConfig{
+		Rules: []cloudhub.SaltRule{
+			{Role: roles.ViewerRoleName, Clients: []string{"local"}, Functions: []string{"cmd.run"}, Targets: []string{"web*"}, Args: []string{"uptime"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		role       string
+		policy     cloudhub.SaltPolicyConfig
+		array      bool
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "viewer pings minions",
+			role:       roles.ViewerRoleName,
+			body:       `{"client":"local","fun":"test.ping","tgt":"*"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "viewer runs a command",
+			role:       roles.ViewerRoleName,
+			body:       `{"client":"local","fun":"cmd.run","tgt":"*","arg":["rm -rf /"]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "viewer runs a command through the salt.cmd runner",
+			role:       roles.ViewerRoleName,
+			body:       `{"client":"runner","fun":"salt.cmd","kwarg":{"fun":"cmd.run","cmd":"id"}}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "viewer lists the allowed minions",
+			role:       roles.ViewerRoleName,
+			body:       `{"client":"runner","fun":"manage.allowed"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "viewer accepts minion keys",
+			role:       roles.ViewerRoleName,
+			body:       `{"client":"runner","fun":"manage.safe_accept","kwarg":{"target":"*"}}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "viewer reads cluster secrets",
+			role:       roles.ViewerRoleName,
+			body:       `{"client":"local","fun":"kubernetes.show_secret","tgt":"master","arg":["db-password"]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "editor reads cluster secrets",
+			role:       roles.EditorRoleName,
+			body:       `{"client":"local","fun":"kubernetes.secrets","tgt":"master"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "editor writes a file through the salt.cmd runner",
+			role:       roles.EditorRoleName,
+			body:       `{"client":"runner","fun":"salt.cmd","kwarg":{"fun":"file.write","path":"/etc/telegraf.conf","args":["[agent]"]}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "editor hides a command in a list",
+			role:       roles.EditorRoleName,
+			array:      true,
+			body:       `[{"client":"local","fun":"test.ping","tgt":"*"},{"client":"local","fun":["service.status","cmd.run"],"tgt":"*","arg":[["telegraf"],["id"]]}]`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin runs a command",
+			role:       roles.AdminRoleName,
+			body:       `{"client":"local","fun":"cmd.run","tgt":"*","arg":["id"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "policy of the organization allows a command on some minions",
+			role:       roles.ViewerRoleName,
+			policy:     restricted,
+			body:       `{"client":"local","fun":"cmd.run","tgt":"web01","arg":["uptime"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "policy of the organization limits the targets",
+			role:       roles.EditorRoleName,
+			policy:     restricted,
+			body:       `{"client":"local","fun":"cmd.run","tgt":"db01","arg":["uptime"]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "policy of the organization limits the target expression",
+			role:       roles.ViewerRoleName,
+			policy:     restricted,
+			body:       `{"client":"local","fun":"cmd.run","tgt":"web01 or db01","tgt_type":"compound","arg":["uptime"]}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "policy of the organization limits the arguments",
+			role:       roles.ViewerRoleName,
+			policy:     restricted,
+			body:       `{"client":"local","fun":"cmd.run","tgt":"web01","arg":["uptime"],"kwarg":{"runas":"root"}}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "policy of the organization replaces the default one",
+			role:       roles.ViewerRoleName,
+			policy:     restricted,
+			body:       `{"client":"local","fun":"test.ping","tgt":"*"}`,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded = nil
+			var audited []cloudhub.AuditEvent
+			s := &Service{
+				Store: &mocks.Store{
+					OrganizationConfigStore: &mocks.OrganizationConfigStore{
+						FindOrCreateF: func(ctx context.Context, id string) (*cloudhub.OrganizationConfig, error) {
+							return &cloudhub.OrganizationConfig{OrganizationID: id, SaltPolicy: tt.policy}, nil
+						},
+					},
+					AuditStore: &mocks.AuditStore{
+						AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+							audited = append(audited, *e)
+							return e, nil
+						},
+					},
+				},
+				Logger:      log.New(log.DebugLevel),
+				AddonURLs:   map[string]string{"salt": salt.URL},
+				AddonTokens: map[string]string{"salt": "1.21-gigawatts"},
+			}
+
+			url := "http://any.url/cloudhub/v1/proxy/salt?path=/"
+			if tt.array {
+				url += "&type=array"
+			}
+			ctx := context.WithValue(context.Background(), organizations.ContextKey, "default")
+			ctx = context.WithValue(ctx, roles.ContextKey, tt.role)
+			ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{Name: "marty"})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", url, strings.NewReader(tt.body)).WithContext(ctx)
+			s.SaltProxyPost(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("SaltProxyPost() = %d %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				if len(forwarded) != 0 {
+					t.Errorf("SaltProxyPost() forwarded a denied call: %v", forwarded)
+				}
+				if len(audited) != 1 || audited[0].Action != "Salt" {
+					t.Errorf("SaltProxyPost() audited %v, want a Salt event", audited)
+				}
+				return
+			}
+			if len(forwarded) != 1 || !strings.Contains(forwarded[0], "1.21-gigawatts") {
+				t.Errorf("SaltProxyPost() forwarded %v, want the call with the token", forwarded)
+			}
+			if len(audited) != 0 {
+				t.Errorf("SaltProxyPost() audited an allowed call: %v", audited)
+			}
+		})
+	}
+}
+
+func TestService_ReplaceOrganizationSaltPolicyConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantRules  int
+	}{
+		{
+			name:       "custom rules",
+			body:       `{"rules":[{"role":"editor","clients":["local"],"functions":["state.*"],"targets":["web*"]}]}`,
+			wantStatus: http.StatusOK,
+			wantRules:  1,
+		},
+		{
+			name:       "no rules restore the default policy",
+			body:       `{"rules":[]}`,
+			wantStatus: http.StatusOK,
+			wantRules:  len(defaultSaltRules),
+		},
+		{
+			name:       "unknown role",
+			body:       `{"rules":[{"role":"owner","clients":["*"],"functions":["*"]}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "no functions",
+			body:       `{"rules":[{"role":"viewer","clients":["local"]}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "malformed pattern",
+			body:       `{"rules":[{"role":"viewer","clients":["local"],"functions":["grains.[item"]}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &cloudhub.OrganizationConfig{OrganizationID: "default"}
+			s := &Service{
+				Store: &mocks.Store{
+					OrganizationConfigStore: &mocks.OrganizationConfigStore{
+						FindOrCreateF: func(ctx context.Context, id string) (*cloudhub.OrganizationConfig, error) {
+							return config, nil
+						},
+						PutF: func(ctx context.Context, c *cloudhub.OrganizationConfig) error {
+							config = c
+							return nil
+						},
+					},
+					AuditStore: &mocks.AuditStore{
+						AddF: func(ctx context.Context, e *cloudhub.AuditEvent) (*cloudhub.AuditEvent, error) {
+							return e, nil
+						},
+					},
+				},
+				Logger: log.New(log.DebugLevel),
+			}
+
+			ctx := context.WithValue(context.Background(), organizations.ContextKey, "default")
+			ctx = context.WithValue(ctx, UserContextKey, &cloudhub.User{Name: "doc"})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("PUT", "http://any.url/cloudhub/v1/org_config/salt_policy", strings.NewReader(tt.body)).WithContext(ctx)
+			s.ReplaceOrganizationSaltPolicyConfig(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ReplaceOrganizationSaltPolicyConfig() = %d %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var res saltPolicyConfigResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Rules) != tt.wantRules {
+				t.Errorf("ReplaceOrganizationSaltPolicyConfig() returned %d rules, want %d", len(res.Rules), tt.wantRules)
+			}
+		})
+	}
+}
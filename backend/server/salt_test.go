@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -97,15 +98,14 @@ func TestService_DaemonReload(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			statusCode, resp, err := tt.s.DaemonReload(tt.args.name)
+			job, err := tt.s.DaemonReload(context.Background(), tt.args.name)
 			if err != nil {
 				t.Errorf("Service.DaemonReload() error = %v\n", err)
-			} else if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
-				t.Errorf("Service.DaemonReload() statusCode = %v\n", statusCode)
+			} else if job.JID == "" {
+				t.Errorf("Service.DaemonReload() returned a job without a jid\n")
 			}
 			tt.s.Logger.
-				WithField("1-statusCode", statusCode).
-				WithField("2-resp", resp).
+				WithField("1-job", job).
 				Debug("Responsed Data")
 		})
 	}
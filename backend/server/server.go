@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -22,6 +23,7 @@ import (
 	"time"
 
 	basicAuth "github.com/abbot/go-http-auth"
+	"github.com/crewjam/saml"
 	client "github.com/influxdata/usage-client/v1"
 	flags "github.com/jessevdk/go-flags"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
@@ -31,7 +33,9 @@ import (
 	"github.com/snetsystems/cloudhub/backend/kv/bolt"
 	"github.com/snetsystems/cloudhub/backend/kv/etcd"
 	clog "github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mail"
 	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/recordings"
 	"github.com/snetsystems/cloudhub/backend/server/config"
 )
 
@@ -91,6 +95,9 @@ type Server struct {
 	EtcdKey            flags.Filename `long:"etcd-key" description:"Path to private key associated with given certificate. " env:"ETCD_PRIVATE_KEY"`
 	EtcdRootCA         flags.Filename `long:"etcd-root-ca" description:"File location of root CA cert for TLS verification." env:"ETCD_ROOT_CA"`
 
+	MasterKey     string         `long:"master-key" description:"Base64 or hex encoded 32-byte master key used to encrypt credentials stored in boltDB or etcd. Without a master key credentials are stored in cleartext." env:"MASTER_KEY"`
+	MasterKeyFile flags.Filename `long:"master-key-file" description:"File location of the master key used to encrypt credentials stored in boltDB or etcd." env:"MASTER_KEY_FILE"`
+
 	GoogleClientID     string   `long:"google-client-id" description:"Google Client ID for OAuth 2 support" env:"GOOGLE_CLIENT_ID"`
 	GoogleClientSecret string   `long:"google-client-secret" description:"Google Client Secret for OAuth 2 support" env:"GOOGLE_CLIENT_SECRET"`
 	GoogleDomains      []string `long:"google-domains" description:"Google email domain user is required to have active membership (env comma separated)" env:"GOOGLE_DOMAINS" env-delim:","`
@@ -120,13 +127,48 @@ type Server struct {
 	Auth0Organizations []string `long:"auth0-organizations" description:"Auth0 organizations permitted to access CloudHub (env comma separated)" env:"AUTH0_ORGS" env-delim:","`
 	Auth0SuperAdminOrg string   `long:"auth0-superadmin-org" description:"Auth0 organization from which users are automatically granted SuperAdmin status" env:"AUTH0_SUPERADMIN_ORG"`
 
-	LoginAuthType string `long:"login-auth-type" description:"Login auth type (mix, oauth, basic)" env:"LOGIN_AUTH_TYPE" default:"oauth"`
-
-	PasswordPolicy        string `long:"password-policy" description:"Regular expression to validate password strength" env:"PASSWORD_POLICY"`
+	LDAPURL            string         `long:"ldap-url" description:"URL of the LDAP or Active Directory server used for LDAP authentication (ldap://host:389 or ldaps://host:636)" env:"LDAP_URL"`
+	LDAPStartTLS       bool           `long:"ldap-starttls" description:"Upgrade the ldap:// connection with StartTLS" env:"LDAP_STARTTLS"`
+	LDAPInsecure       bool           `long:"ldap-insecure" description:"Whether or not to verify the LDAP server's tls certificates." env:"LDAP_INSECURE"`
+	LDAPRootCA         flags.Filename `long:"ldap-root-ca" description:"File location of root ca cert for LDAP tls verification." env:"LDAP_ROOT_CA"`
+	LDAPBindDN         string         `long:"ldap-bind-dn" description:"DN of the account searching for users and groups. Binds anonymously if empty." env:"LDAP_BIND_DN"`
+	LDAPBindPassword   string         `long:"ldap-bind-password" description:"Password of the LDAP bind DN" env:"LDAP_BIND_PASSWORD"`
+	LDAPUserBaseDN     string         `long:"ldap-user-base-dn" description:"Base DN of the LDAP user search" env:"LDAP_USER_BASE_DN"`
+	LDAPUserFilter     string         `long:"ldap-user-filter" description:"LDAP user search filter; %s is replaced by the login name. (Active Directory should be (sAMAccountName=%s))" default:"(uid=%s)" env:"LDAP_USER_FILTER"`
+	LDAPGroupBaseDN    string         `long:"ldap-group-base-dn" description:"Base DN of the LDAP group search. Defaults to the user base DN." env:"LDAP_GROUP_BASE_DN"`
+	LDAPGroupFilter    string         `long:"ldap-group-filter" description:"LDAP group search filter; %s is replaced by the DN of the user" default:"(member=%s)" env:"LDAP_GROUP_FILTER"`
+	LDAPGroupAttribute string         `long:"ldap-group-attribute" description:"Attribute of LDAP groups matched by ldap:ldap:<group> mappings" default:"cn" env:"LDAP_GROUP_ATTRIBUTE"`
+
+	SAMLName            string         `long:"saml-name" description:"SAML name presented on the login page and used as the provider of saml:oauth2:<group> mappings" default:"saml" env:"SAML_NAME"`
+	SAMLIDPMetadataURL  string         `long:"saml-idp-metadata-url" description:"URL of the SAML identity provider metadata" env:"SAML_IDP_METADATA_URL"`
+	SAMLIDPMetadataFile flags.Filename `long:"saml-idp-metadata-file" description:"File location of the SAML identity provider metadata. Used instead of the metadata url." env:"SAML_IDP_METADATA_FILE"`
+	SAMLCert            flags.Filename `long:"saml-cert" description:"File location of the PEM encoded certificate CloudHub signs SAML requests with" env:"SAML_CERT"`
+	SAMLKey             flags.Filename `long:"saml-key" description:"File location of the PEM encoded RSA private key of the SAML certificate" env:"SAML_KEY"`
+	SAMLEntityID        string         `long:"saml-entity-id" description:"SAML entity ID of CloudHub. Defaults to the URL of the SAML metadata endpoint." env:"SAML_ENTITY_ID"`
+	SAMLEmailAttribute  string         `long:"saml-email-attribute" description:"SAML attribute used as the user name. The NameID is used if empty." env:"SAML_EMAIL_ATTRIBUTE"`
+	SAMLGroupAttribute  string         `long:"saml-group-attribute" description:"SAML attribute whose values are matched by saml:oauth2:<group> mappings" env:"SAML_GROUP_ATTRIBUTE"`
+
+	LoginAuthType string `long:"login-auth-type" description:"Login auth type (mix, oauth, basic, ldap)" env:"LOGIN_AUTH_TYPE" default:"oauth"`
+
+	PasswordPolicy        string `long:"password-policy" description:"Regular expression to validate password strength, as a JavaScript regular expression matched case insensitively" env:"PASSWORD_POLICY"`
 	PasswordPolicyMessage string `long:"password-policy-message" description:"The description about password-policy set" env:"PASSWORD_POLICY_MESSAGE"`
 
 	MailSubject     string `long:"mail-subject" description:"Mail subject" env:"MAIL_SUBJECT"`
-	MailBodyMessage string `long:"mail-body-message" description:"Mail body message" env:"MAIL_BODY_MESSAGE"`
+	MailBodyMessage string `long:"mail-body-message" description:"Mail body message. With --smtp-host, $user_id, $reset_link and $expires are replaced; the link is appended if $reset_link is missing" env:"MAIL_BODY_MESSAGE"`
+
+	SMTPHost               string        `long:"smtp-host" description:"SMTP server that mails password reset links to basic users. Requires --public-url and --token-secret" env:"SMTP_HOST"`
+	SMTPPort               int           `long:"smtp-port" description:"Port of the SMTP server" default:"587" env:"SMTP_PORT"`
+	SMTPUsername           string        `long:"smtp-username" description:"Username of the SMTP server. Mail is sent without authentication if empty" env:"SMTP_USERNAME"`
+	SMTPPassword           string        `long:"smtp-password" description:"Password of the SMTP server" env:"SMTP_PASSWORD"`
+	SMTPFrom               string        `long:"smtp-from" description:"Sender address of password reset mails (e.g. 'CloudHub <cloudhub@example.com>')" env:"SMTP_FROM"`
+	SMTPTLS                string        `long:"smtp-tls" value-name:"choice" choice:"starttls" choice:"tls" choice:"none" default:"starttls" description:"TLS of the SMTP connection: STARTTLS, implicit TLS or none" env:"SMTP_TLS"`
+	SMTPInsecureSkipVerify bool          `long:"smtp-insecure-skip-verify" description:"Skip verification of the SMTP server certificate" env:"SMTP_INSECURE_SKIP_VERIFY"`
+	PasswordResetLifespan  time.Duration `long:"password-reset-lifespan" description:"How long password reset links are valid" default:"1h" env:"PASSWORD_RESET_LIFESPAN"`
+
+	AuditRetention      time.Duration `long:"audit-retention" description:"How long audit events are kept. Audit events are kept forever if 0" default:"0" env:"AUDIT_RETENTION"`
+	AlertEventRetention time.Duration `long:"alert-event-retention" description:"How long the Kapacitor alert events of the alert timeline are kept. Alert events are kept forever if 0" default:"0" env:"ALERT_EVENT_RETENTION"`
+
+	TerminalRecordingsPath string `long:"terminal-recordings-path" description:"Directory web terminal sessions are recorded to in asciicast v2 format. Sessions are not recorded if empty" default:"cloudhub-recordings" env:"TERMINAL_RECORDINGS_PATH"`
 
 	ExternaExec     string `long:"external-exec" description:"External program path" env:"EXTERNAL_EXEC"`
 	ExternaExecArgs string `long:"external-exec-args" description:"Arguments of external program" env:"EXTERNAL_EXEC_ARGS"`
@@ -310,6 +352,165 @@ func (s *Server) UseGenericOAuth2() error {
 	return nil
 }
 
+// UseLDAP validates the CLI parameters to enable LDAP authentication
+func (s *Server) UseLDAP() error {
+	if s.LDAPURL == "" && s.LDAPUserBaseDN == "" {
+		return errNoAuth
+	}
+
+	errMsg := []string{}
+	if s.TokenSecret == "" {
+		errMsg = append(errMsg, "token secret")
+	}
+	if s.LDAPURL == "" {
+		errMsg = append(errMsg, "url")
+	}
+	if s.LDAPUserBaseDN == "" {
+		errMsg = append(errMsg, "user base dn")
+	}
+	if len(errMsg) > 0 {
+		return fmt.Errorf("missing LDAP setting[s]: %s", strings.Join(errMsg, ", "))
+	}
+
+	l, err := s.ldap(nil)
+	if err != nil {
+		return err
+	}
+	return l.Valid()
+}
+
+func (s *Server) ldap(logger cloudhub.Logger) (*oauth2.LDAP, error) {
+	certs, err := getCerts(string(s.LDAPRootCA))
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.LDAP{
+		URL:                s.LDAPURL,
+		StartTLS:           s.LDAPStartTLS,
+		InsecureSkipVerify: s.LDAPInsecure,
+		RootCAs:            certs,
+		BindDN:             s.LDAPBindDN,
+		BindPassword:       s.LDAPBindPassword,
+		UserBaseDN:         s.LDAPUserBaseDN,
+		UserFilter:         s.LDAPUserFilter,
+		GroupBaseDN:        s.LDAPGroupBaseDN,
+		GroupFilter:        s.LDAPGroupFilter,
+		GroupAttribute:     s.LDAPGroupAttribute,
+		Timeout:            10 * time.Second,
+		Logger:             logger,
+	}, nil
+}
+
+// UseSAML validates the CLI parameters to enable SAML single sign-on
+func (s *Server) UseSAML() error {
+	if s.SAMLIDPMetadataURL == "" && s.SAMLIDPMetadataFile == "" && s.SAMLCert == "" && s.SAMLKey == "" {
+		return errNoAuth
+	}
+
+	errMsg := []string{}
+	if s.TokenSecret == "" {
+		errMsg = append(errMsg, "token secret")
+	}
+	if s.PublicURL == "" {
+		errMsg = append(errMsg, "public url")
+	}
+	if s.SAMLIDPMetadataURL == "" && s.SAMLIDPMetadataFile == "" {
+		errMsg = append(errMsg, "idp metadata url or file")
+	}
+	if s.SAMLCert == "" {
+		errMsg = append(errMsg, "cert")
+	}
+	if s.SAMLKey == "" {
+		errMsg = append(errMsg, "key")
+	}
+	if len(errMsg) > 0 {
+		return fmt.Errorf("missing SAML setting[s]: %s", strings.Join(errMsg, ", "))
+	}
+
+	if _, err := url.Parse(s.PublicURL); err != nil {
+		return fmt.Errorf("invalid public url: %v", err)
+	}
+	_, err := tls.LoadX509KeyPair(string(s.SAMLCert), string(s.SAMLKey))
+	return err
+}
+
+// saml builds the SAML service provider. The identity provider metadata is
+// read once at startup.
+func (s *Server) saml(logger cloudhub.Logger, auth oauth2.Authenticator) (*oauth2.SAML, error) {
+	pair, err := tls.LoadX509KeyPair(string(s.SAMLCert), string(s.SAMLKey))
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("saml key must be an RSA private key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.samlIDPMetadata()
+	if err != nil {
+		return nil, err
+	}
+	idp, err := oauth2.ParseSAMLMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(s.PublicURL)
+	if err != nil {
+		return nil, err
+	}
+	name := s.SAMLName
+	if name == "" {
+		name = oauth2.SAMLProviderName
+	}
+	base.Path = path.Join(base.Path, s.Basepath, "oauth", url.PathEscape(strings.ToLower(name)))
+	metadataURL, acsURL := *base, *base
+	metadataURL.Path = path.Join(base.Path, "metadata")
+	acsURL.Path = path.Join(base.Path, "callback")
+
+	entityID := s.SAMLEntityID
+	if entityID == "" {
+		entityID = metadataURL.String()
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:    entityID,
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: metadataURL,
+		AcsURL:      acsURL,
+		IDPMetadata: idp,
+	}
+	tokens := oauth2.NewJWT(s.TokenSecret, s.JwksURL)
+	m := oauth2.NewSAMLMux(sp, auth, tokens, s.Basepath, logger)
+	m.PageName = name
+	m.EmailAttribute = s.SAMLEmailAttribute
+	m.GroupAttribute = s.SAMLGroupAttribute
+	return m, nil
+}
+
+func (s *Server) samlIDPMetadata() ([]byte, error) {
+	if s.SAMLIDPMetadataFile != "" {
+		return ioutil.ReadFile(string(s.SAMLIDPMetadataFile))
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(s.SAMLIDPMetadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get saml idp metadata: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get saml idp metadata: %s", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
 // getCerts gets the read certs from rootPath to the systemCerts.
 func getCerts(rootPath string) (*x509.CertPool, error) {
 	if rootPath == "" {
@@ -445,6 +646,43 @@ func (s *Server) genericRedirectURL() string {
 	return publicURL.String()
 }
 
+// UseSMTP validates the CLI parameters to mail password reset links
+func (s *Server) UseSMTP() error {
+	if s.SMTPHost == "" {
+		return errNoAuth
+	}
+
+	errMsg := []string{}
+	if s.TokenSecret == "" {
+		errMsg = append(errMsg, "token secret")
+	}
+	if s.PublicURL == "" {
+		errMsg = append(errMsg, "public url")
+	}
+	if s.SMTPFrom == "" {
+		errMsg = append(errMsg, "from")
+	}
+	if len(errMsg) > 0 {
+		return fmt.Errorf("missing SMTP setting[s]: %s", strings.Join(errMsg, ", "))
+	}
+	if s.PasswordResetLifespan <= 0 {
+		return fmt.Errorf("password reset lifespan must be positive")
+	}
+	return nil
+}
+
+func (s *Server) mailer() *mail.SMTP {
+	return &mail.SMTP{
+		Host:               s.SMTPHost,
+		Port:               s.SMTPPort,
+		Username:           s.SMTPUsername,
+		Password:           s.SMTPPassword,
+		From:               s.SMTPFrom,
+		TLS:                s.SMTPTLS,
+		InsecureSkipVerify: s.SMTPInsecureSkipVerify,
+	}
+}
+
 func (s *Server) useAuth() bool {
 	useAuths := []func() error{
 		s.UseGithub,
@@ -452,6 +690,8 @@ func (s *Server) useAuth() bool {
 		s.UseHeroku,
 		s.UseGenericOAuth2,
 		s.UseAuth0,
+		s.UseLDAP,
+		s.UseSAML,
 	}
 
 	var err error
@@ -478,6 +718,8 @@ func (s *Server) validateAuth() error {
 		s.UseHeroku,
 		s.UseGenericOAuth2,
 		s.UseAuth0,
+		s.UseLDAP,
+		s.UseSAML,
 	}
 
 	var errs []string
@@ -498,6 +740,21 @@ func (s *Server) validateAuth() error {
 	return errors.New(strings.Join(errs, "; "))
 }
 
+// masterKey returns the master key used to encrypt secrets in the kv store,
+// or nil if none is configured.
+func (s *Server) masterKey() ([]byte, error) {
+	if s.MasterKey != "" && s.MasterKeyFile != "" {
+		return nil, errors.New("only one of master key and master key file may be specified")
+	}
+	if s.MasterKeyFile != "" {
+		return kv.ReadMasterKeyFile(string(s.MasterKeyFile))
+	}
+	if s.MasterKey != "" {
+		return kv.DecodeMasterKey(s.MasterKey)
+	}
+	return nil, nil
+}
+
 func (s *Server) useTLS() bool {
 	return s.Cert != ""
 }
@@ -643,19 +900,46 @@ func (s *Server) Serve(ctx context.Context) {
 		s.LoginAuthType = ""
 	}
 
-	// no kapacitor and no program path
+	useSMTP := s.UseSMTP()
+	if useSMTP != nil && useSMTP != errNoAuth {
+		logger.
+			WithField("component", "server").
+			WithField("smtp", "invalid").
+			Error(useSMTP)
+		return
+	}
+
+	// no kapacitor, no program path and no smtp
 	var basicPasswordResetType string
-	if s.KapacitorURL == "" && s.ExternaExec == "" {
+	if s.KapacitorURL == "" && s.ExternaExec == "" && useSMTP != nil {
 		basicPasswordResetType = "admin"
 	} else {
 		basicPasswordResetType = "all"
 	}
 
+	masterKey, err := s.masterKey()
+	if err != nil {
+		logger.Error("Unable to load master key", err)
+		os.Exit(1)
+	}
+
+	var passwordPolicy *PasswordPolicy
+	if s.PasswordPolicy != "" {
+		if passwordPolicy, err = NewPasswordPolicy(s.PasswordPolicy); err != nil {
+			logger.
+				WithField("component", "server").
+				WithField("password-policy", "invalid").
+				Error(err)
+			return
+		}
+	}
+
 	templatesManager := NewConfigTemplatesManager(s.TemplatesPath, logger)
 
 	service := openService(
 		ctx,
 		db,
+		masterKey,
 		s.newBuilders(logger),
 		logger,
 		s.useAuth(),
@@ -673,6 +957,29 @@ func (s *Server) Serve(ctx context.Context) {
 	service.SuperAdminProviderGroups = superAdminProviderGroups{
 		auth0: s.Auth0SuperAdminOrg,
 	}
+	service.AuditSinks = []cloudhub.AuditSink{
+		&InfluxAuditSink{Store: service.Store, Logger: logger},
+	}
+	if s.AuditRetention > 0 {
+		go service.retainAuditEvents(ctx, s.AuditRetention, time.Hour)
+	}
+	if s.AlertEventRetention > 0 {
+		go service.retainAlertEvents(ctx, s.AlertEventRetention, time.Hour)
+	}
+	service.TOTPTokens = NewTOTPTokenizer(s.TokenSecret)
+	service.PasswordPolicy = passwordPolicy
+	if s.PublicURL != "" {
+		service.AlertsURL = s.PublicURL + s.Basepath + "/alerts/kapacitors"
+	}
+	if useSMTP == nil {
+		service.Mailer = s.mailer()
+		service.ResetLinks = NewResetLinks(s.TokenSecret, s.PublicURL+s.Basepath+"/password-reset", s.PasswordResetLifespan)
+	}
+	if s.TerminalRecordingsPath != "" {
+		service.RecordingStorage = &recordings.Dir{Path: s.TerminalRecordingsPath}
+		go service.retainTerminalRecordings(ctx, time.Hour)
+	}
+	go service.runMaintenanceWindows(ctx, time.Minute)
 
 	service.Env = cloudhub.Environment{
 		TelegrafSystemInterval: s.TelegrafSystemInterval,
@@ -725,6 +1032,24 @@ func (s *Server) Serve(ctx context.Context) {
 		provide(s.auth0OAuth(logger, auth)),
 	}
 
+	var ldapProvider oauth2.PasswordProvider
+	if s.UseLDAP() == nil {
+		ldapProvider, err = s.ldap(logger)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+	}
+
+	var samlMux *oauth2.SAML
+	if s.UseSAML() == nil {
+		samlMux, err = s.saml(logger, auth)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+	}
+
 	var basicAuthenticator *basicAuth.BasicAuth
 	if !s.useAuth() && len(s.BasicAuthHtpasswd) > 0 {
 		logger.
@@ -738,9 +1063,16 @@ func (s *Server) Serve(ctx context.Context) {
 		)
 	}
 
+	// Accept API tokens of service accounts alongside user sessions
+	tokenAuth := &APITokenAuthenticator{
+		Authenticator: auth,
+		Store:         service.Store,
+		Logger:        logger,
+	}
+
 	handler := NewMux(MuxOpts{
 		Develop:               s.Develop,
-		Auth:                  auth,
+		Auth:                  tokenAuth,
 		Logger:                logger,
 		UseAuth:               s.useAuth(),
 		ProviderFuncs:         providerFuncs,
@@ -750,6 +1082,8 @@ func (s *Server) Serve(ctx context.Context) {
 		PprofEnabled:          s.PprofEnabled,
 		DisableGZip:           s.DisableGZip,
 		BasicAuth:             basicAuthenticator,
+		LDAP:                  ldapProvider,
+		SAML:                  samlMux,
 		PasswordPolicy:        s.PasswordPolicy,
 		PasswordPolicyMessage: s.PasswordPolicyMessage,
 	}, service)
@@ -827,6 +1161,7 @@ func (s *Server) Serve(ctx context.Context) {
 func openService(
 	ctx context.Context,
 	db kv.Store,
+	masterKey []byte,
 	builder builders,
 	logger cloudhub.Logger,
 	useAuth bool,
@@ -842,7 +1177,7 @@ func openService(
 	osp OSP,
 ) Service {
 
-	svc, err := kv.NewService(ctx, db, kv.WithLogger(logger))
+	svc, err := kv.NewService(ctx, db, kv.WithLogger(logger), kv.WithMasterKey(masterKey))
 	if err != nil {
 		logger.Error("Unable to create kv service", err)
 		os.Exit(1)
@@ -917,6 +1252,16 @@ func openService(
 			MLNxRstStore:            svc.MLNxRstStore(),
 			DLNxRstStore:            svc.DLNxRstStore(),
 			DLNxRstStgStore:         svc.DLNxRstStgStore(),
+			AuditStore:              svc.AuditStore(),
+			DashboardRevisionsStore: svc.DashboardRevisionsStore(),
+			APITokensStore:          svc.APITokensStore(),
+			HostKeysStore:           svc.HostKeysStore(),
+			TerminalRecordingsStore: svc.TerminalRecordingsStore(),
+			TerminalProfilesStore:   svc.TerminalProfilesStore(),
+			SaltJobsStore:           svc.SaltJobsStore(),
+			AlertEventsStore:        svc.AlertEventsStore(),
+			MaintenanceWindowsStore: svc.MaintenanceWindowsStore(),
+			RuleTemplatesStore:      svc.RuleTemplatesStore(),
 		},
 		Logger:                 logger,
 		UseAuth:                useAuth,
@@ -931,6 +1276,7 @@ func openService(
 		AddonURLs:              addonURLs,
 		AddonTokens:            addonTokens,
 		OSP:                    osp,
+		Backups:                svc,
 	}
 }
 
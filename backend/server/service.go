@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"time"
 
 	cloudhub "github.com/snetsystems/cloudhub/backend"
 	"github.com/snetsystems/cloudhub/backend/influx"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
 )
 
 // Service handles REST calls to the persistence
@@ -27,6 +29,15 @@ type Service struct {
 	AddonTokens              map[string]string // Tokens to access to Addon Features API, as passed in via CLI/ENV
 	OSP                      OSP
 	InternalENV              cloudhub.InternalEnvironment
+	AuditSinks               []cloudhub.AuditSink              // AuditSinks receive a copy of every audit event
+	TOTPTokens               oauth2.Tokenizer                  // TOTPTokens signs the token between the password and TOTP steps of a login
+	Mailer                   cloudhub.Mailer                   // Mailer sends password reset links; nil if SMTP is not configured
+	ResetLinks               *ResetLinks                       // ResetLinks signs the links sent by Mailer
+	PasswordPolicy           *PasswordPolicy                   // PasswordPolicy checks the passwords set with reset links; nil if any password is allowed
+	RecordingStorage         cloudhub.TerminalRecordingStorage // RecordingStorage keeps the asciicast of web terminal sessions; nil if recording is disabled
+	Backups                  Snapshotter                       // Backups takes the snapshots of the store downloaded as backups
+	AlertsURL                string                            // AlertsURL is the alert ingestion endpoint kapacitor posts to; empty if CloudHub has no public URL
+	Now                      func() time.Time                  // Now returns the current time (for testing)
 }
 
 type superAdminProviderGroups struct {
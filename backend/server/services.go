@@ -139,6 +139,10 @@ func (s *Service) NewService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// log registrationte
+	msg := fmt.Sprintf(MsgServiceCreated.String(), srv.Name)
+	s.logChange(ctx, "Services", msg, nil, srv)
+
 	res := newService(srv)
 	location(w, res.Links.Self)
 	encodeJSON(w, http.StatusCreated, res, s.Logger)
@@ -224,6 +228,10 @@ func (s *Service) RemoveService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// log registrationte
+	msg := fmt.Sprintf(MsgServiceDeleted.String(), srv.Name)
+	s.logChange(ctx, "Services", msg, srv, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -287,6 +295,7 @@ func (s *Service) UpdateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := srv
 	if req.Name != nil {
 		srv.Name = *req.Name
 	}
@@ -315,6 +324,10 @@ func (s *Service) UpdateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// log registrationte
+	msg := fmt.Sprintf(MsgServiceModified.String(), srv.Name)
+	s.logChange(ctx, "Services", msg, before, srv)
+
 	res := newService(srv)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
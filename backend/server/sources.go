@@ -190,7 +190,7 @@ func (s *Service) NewSource(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgSourcesCreated.String(), src.Name)
-	s.logRegistration(ctx, "Sources", msg)
+	s.logChange(ctx, "Sources", msg, nil, src)
 
 	res := newSourceResponse(ctx, src)
 	location(w, res.Links.Self)
@@ -339,7 +339,7 @@ func (s *Service) RemoveSource(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgSourcesDeleted.String(), src.Name)
-	s.logRegistration(ctx, "Sources", msg)
+	s.logChange(ctx, "Sources", msg, src, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -420,6 +420,7 @@ func (s *Service) UpdateSource(w http.ResponseWriter, r *http.Request) {
 		notFound(w, id, s.Logger)
 		return
 	}
+	before := src
 
 	var req cloudhub.Source
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -486,7 +487,7 @@ func (s *Service) UpdateSource(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgSourcesModified.String(), src.Name)
-	s.logRegistration(ctx, "Sources", msg)
+	s.logChange(ctx, "Sources", msg, before, src)
 
 	res := newSourceResponse(ctx, src)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -563,7 +564,7 @@ func (s *Service) NewSourceUser(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	src, _ := s.Store.Sources(ctx).Get(ctx, srcID)
 	msg := fmt.Sprintf(MsgSourceUserCreated.String(), res.Name, src.Name)
-	s.logRegistration(ctx, "Sources Users", msg)
+	s.logChange(ctx, "Sources Users", msg, nil, *res)
 
 	su := newSourceUserResponse(srcID, res.Name).WithPermissions(res.Permissions)
 	if _, hasRoles := s.hasRoles(ctx, ts); hasRoles {
@@ -639,6 +640,12 @@ func (s *Service) RemoveSourceUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := store.Get(ctx, cloudhub.UserQuery{Name: &uid})
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
 	if err := store.Delete(ctx, &cloudhub.User{Name: uid}); err != nil {
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
 		return
@@ -647,7 +654,7 @@ func (s *Service) RemoveSourceUser(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	src, _ := s.Store.Sources(ctx).Get(ctx, srcID)
 	msg := fmt.Sprintf(MsgSourceUserDeleted.String(), uid, src.Name)
-	s.logRegistration(ctx, "Sources Users", msg)
+	s.logChange(ctx, "Sources Users", msg, *before, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -679,6 +686,12 @@ func (s *Service) UpdateSourceUser(w http.ResponseWriter, r *http.Request) {
 	}
 	store := ts.Users(ctx)
 
+	before, err := store.Get(ctx, cloudhub.UserQuery{Name: &uid})
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
 	if err := store.Update(ctx, user); err != nil {
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
 		return
@@ -693,7 +706,7 @@ func (s *Service) UpdateSourceUser(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	src, _ := s.Store.Sources(ctx).Get(ctx, srcID)
 	msg := fmt.Sprintf(MsgSourceUserModified.String(), uid, src.Name)
-	s.logRegistration(ctx, "Sources Users", msg)
+	s.logChange(ctx, "Sources Users", msg, *before, *u)
 
 	res := newSourceUserResponse(srcID, u.Name).WithPermissions(u.Permissions)
 	if _, hasRoles := s.hasRoles(ctx, ts); hasRoles {
@@ -882,7 +895,7 @@ func (s *Service) NewSourceRole(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	src, _ := s.Store.Sources(ctx).Get(ctx, srcID)
 	msg := fmt.Sprintf(MsgSourceRoleCreated.String(), res.Name, src.Name)
-	s.logRegistration(ctx, "Sources Roles", msg)
+	s.logChange(ctx, "Sources Roles", msg, nil, res)
 
 	rr := newSourceRoleResponse(srcID, res)
 	location(w, rr.Links.Self)
@@ -916,6 +929,12 @@ func (s *Service) UpdateSourceRole(w http.ResponseWriter, r *http.Request) {
 	rid := httprouter.GetParamFromContext(ctx, "rid")
 	req.Name = rid
 
+	before, err := roles.Get(ctx, rid)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
 	if err := roles.Update(ctx, &req.Role); err != nil {
 		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
 		return
@@ -930,7 +949,7 @@ func (s *Service) UpdateSourceRole(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	src, _ := s.Store.Sources(ctx).Get(ctx, srcID)
 	msg := fmt.Sprintf(MsgSourceRoleModified.String(), role.Name, src.Name)
-	s.logRegistration(ctx, "Sources Roles", msg)
+	s.logChange(ctx, "Sources Roles", msg, before, role)
 
 	rr := newSourceRoleResponse(srcID, role)
 	location(w, rr.Links.Self)
@@ -1016,7 +1035,7 @@ func (s *Service) RemoveSourceRole(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	src, _ := s.Store.Sources(ctx).Get(ctx, srcID)
 	msg := fmt.Sprintf(MsgSourceRoleDeleted.String(), role.Name, src.Name)
-	s.logRegistration(ctx, "Sources Roles", msg)
+	s.logChange(ctx, "Sources Roles", msg, role, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
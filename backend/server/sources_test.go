@@ -1144,6 +1144,9 @@ func TestService_RemoveSourceUser(t *testing.T) {
 					},
 					UsersF: func(ctx context.Context) cloudhub.UsersStore {
 						return &mocks.UsersStore{
+							GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+								return &cloudhub.User{Name: *q.Name}, nil
+							},
 							DeleteF: func(ctx context.Context, u *cloudhub.User) error {
 								return nil
 							},
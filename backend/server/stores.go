@@ -101,6 +101,16 @@ type DataStore interface {
 	MLNxRst(ctx context.Context) cloudhub.MLNxRstStore
 	DLNxRst(ctx context.Context) cloudhub.DLNxRstStore
 	DLNxRstStg(ctx context.Context) cloudhub.DLNxRstStgStore
+	Audit(ctx context.Context) cloudhub.AuditStore
+	DashboardRevisions(ctx context.Context) cloudhub.DashboardRevisionsStore
+	APITokens(ctx context.Context) cloudhub.APITokensStore
+	HostKeys(ctx context.Context) cloudhub.HostKeysStore
+	TerminalRecordings(ctx context.Context) cloudhub.TerminalRecordingsStore
+	TerminalProfiles(ctx context.Context) cloudhub.TerminalProfilesStore
+	SaltJobs(ctx context.Context) cloudhub.SaltJobsStore
+	AlertEvents(ctx context.Context) cloudhub.AlertEventsStore
+	MaintenanceWindows(ctx context.Context) cloudhub.MaintenanceWindowsStore
+	RuleTemplates(ctx context.Context) cloudhub.RuleTemplatesStore
 }
 
 // ensure that Store implements a DataStore
@@ -126,6 +136,16 @@ type Store struct {
 	MLNxRstStore            cloudhub.MLNxRstStore
 	DLNxRstStore            cloudhub.DLNxRstStore
 	DLNxRstStgStore         cloudhub.DLNxRstStgStore
+	AuditStore              cloudhub.AuditStore
+	DashboardRevisionsStore cloudhub.DashboardRevisionsStore
+	APITokensStore          cloudhub.APITokensStore
+	HostKeysStore           cloudhub.HostKeysStore
+	TerminalRecordingsStore cloudhub.TerminalRecordingsStore
+	TerminalProfilesStore   cloudhub.TerminalProfilesStore
+	SaltJobsStore           cloudhub.SaltJobsStore
+	AlertEventsStore        cloudhub.AlertEventsStore
+	MaintenanceWindowsStore cloudhub.MaintenanceWindowsStore
+	RuleTemplatesStore      cloudhub.RuleTemplatesStore
 }
 
 // Sources returns a noop.SourcesStore if the context has no organization specified
@@ -188,7 +208,15 @@ func (s *Store) Dashboards(ctx context.Context) cloudhub.DashboardsStore {
 		return s.DashboardsStore
 	}
 	if org, ok := hasOrganizationContext(ctx); ok {
-		return organizations.NewDashboardsStore(s.DashboardsStore, org)
+		store := organizations.NewDashboardsStore(s.DashboardsStore, org)
+		if s.DashboardRevisionsStore == nil {
+			return store
+		}
+		return &revisionedDashboardsStore{
+			DashboardsStore: store,
+			revisions:       s.DashboardRevisionsStore,
+			configs:         s.OrganizationConfigStore,
+		}
 	}
 
 	return &noop.DashboardsStore{}
@@ -334,3 +362,150 @@ func (s *Store) DLNxRstStg(ctx context.Context) cloudhub.DLNxRstStgStore {
 
 	return &noop.DLNxRstStgStore{}
 }
+
+// Audit returns the underlying AuditStore if the context is a server or
+// super admin context, an organizations.AuditStore if it has an organization
+// specified, and a noop.AuditStore otherwise.
+func (s *Store) Audit(ctx context.Context) cloudhub.AuditStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.AuditStore
+	}
+	if hasSuperAdminContext(ctx) {
+		return s.AuditStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewAuditStore(s.AuditStore, org)
+	}
+
+	return &noop.AuditStore{}
+}
+
+// DashboardRevisions returns the underlying DashboardRevisionsStore if the
+// context is a server context or has an organization specified, and a
+// noop.DashboardRevisionsStore otherwise. Revisions are looked up by
+// dashboard ID, so callers check access through Dashboards first.
+func (s *Store) DashboardRevisions(ctx context.Context) cloudhub.DashboardRevisionsStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.DashboardRevisionsStore
+	}
+	if _, ok := hasOrganizationContext(ctx); ok {
+		return s.DashboardRevisionsStore
+	}
+
+	return &noop.DashboardRevisionsStore{}
+}
+
+// APITokens returns the underlying APITokensStore if the context is a server
+// context, an organizations.APITokensStore if it has an organization
+// specified, and a noop.APITokensStore otherwise.
+func (s *Store) APITokens(ctx context.Context) cloudhub.APITokensStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.APITokensStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewAPITokensStore(s.APITokensStore, org)
+	}
+
+	return &noop.APITokensStore{}
+}
+
+// HostKeys returns the underlying HostKeysStore if the context is a server
+// context, an organizations.HostKeysStore if it has an organization
+// specified, and a noop.HostKeysStore otherwise.
+func (s *Store) HostKeys(ctx context.Context) cloudhub.HostKeysStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.HostKeysStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewHostKeysStore(s.HostKeysStore, org)
+	}
+
+	return &noop.HostKeysStore{}
+}
+
+// TerminalRecordings returns the underlying TerminalRecordingsStore if the
+// context is a server context, an organizations.TerminalRecordingsStore if it
+// has an organization specified, and a noop.TerminalRecordingsStore otherwise.
+func (s *Store) TerminalRecordings(ctx context.Context) cloudhub.TerminalRecordingsStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.TerminalRecordingsStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewTerminalRecordingsStore(s.TerminalRecordingsStore, org)
+	}
+
+	return &noop.TerminalRecordingsStore{}
+}
+
+// TerminalProfiles returns the underlying TerminalProfilesStore if the
+// context is a server context, an organizations.TerminalProfilesStore if it
+// has an organization specified, and a noop.TerminalProfilesStore otherwise.
+func (s *Store) TerminalProfiles(ctx context.Context) cloudhub.TerminalProfilesStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.TerminalProfilesStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewTerminalProfilesStore(s.TerminalProfilesStore, org)
+	}
+
+	return &noop.TerminalProfilesStore{}
+}
+
+// SaltJobs returns the underlying SaltJobsStore if the context is a server
+// context, an organizations.SaltJobsStore if it has an organization
+// specified, and a noop.SaltJobsStore otherwise.
+func (s *Store) SaltJobs(ctx context.Context) cloudhub.SaltJobsStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.SaltJobsStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewSaltJobsStore(s.SaltJobsStore, org)
+	}
+
+	return &noop.SaltJobsStore{}
+}
+
+// AlertEvents returns the underlying AlertEventsStore if the context is a
+// server or super admin context, an organizations.AlertEventsStore if it has
+// an organization specified, and a noop.AlertEventsStore otherwise.
+func (s *Store) AlertEvents(ctx context.Context) cloudhub.AlertEventsStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.AlertEventsStore
+	}
+	if hasSuperAdminContext(ctx) {
+		return s.AlertEventsStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewAlertEventsStore(s.AlertEventsStore, org)
+	}
+
+	return &noop.AlertEventsStore{}
+}
+
+// MaintenanceWindows returns the underlying MaintenanceWindowsStore if the
+// context is a server context, an organizations.MaintenanceWindowsStore if it
+// has an organization specified, and a noop.MaintenanceWindowsStore otherwise.
+func (s *Store) MaintenanceWindows(ctx context.Context) cloudhub.MaintenanceWindowsStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.MaintenanceWindowsStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewMaintenanceWindowsStore(s.MaintenanceWindowsStore, org)
+	}
+
+	return &noop.MaintenanceWindowsStore{}
+}
+
+// RuleTemplates returns the underlying RuleTemplatesStore if the context is
+// a server context, an organizations.RuleTemplatesStore if it has an
+// organization specified, and a noop.RuleTemplatesStore otherwise.
+func (s *Store) RuleTemplates(ctx context.Context) cloudhub.RuleTemplatesStore {
+	if isServer := hasServerContext(ctx); isServer {
+		return s.RuleTemplatesStore
+	}
+	if org, ok := hasOrganizationContext(ctx); ok {
+		return organizations.NewRuleTemplatesStore(s.RuleTemplatesStore, org)
+	}
+
+	return &noop.RuleTemplatesStore{}
+}
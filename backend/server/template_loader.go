@@ -18,11 +18,13 @@ const (
 	PredictionTaskField cloudhub.TemplateFieldType = "predict-task"
 	// LogstashTemplateField represents the logstash_gen template field
 	LogstashTemplateField cloudhub.TemplateFieldType = "logstash-snmp_nx"
+	// RuleTemplateField represents the alert rule of a rule template
+	RuleTemplateField cloudhub.TemplateFieldType = "rule-template"
 )
 
 // LoadTemplate loads and parses the template from the given file path and field type
 func (s *TemplateService) LoadTemplate(config cloudhub.LoadTemplateConfig, tmplParams []cloudhub.TemplateBlock) (string, error) {
-	tmpl, err := template.New(string(config.Field)).Parse(config.TemplateString)
+	tmpl, err := template.New(string(config.Field)).Delims(config.LeftDelim, config.RightDelim).Parse(config.TemplateString)
 	if err != nil {
 		return "", fmt.Errorf("error parsing template: %v", err)
 	}
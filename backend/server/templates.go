@@ -86,6 +86,7 @@ func (s *Service) Templates(w http.ResponseWriter, r *http.Request) {
 	res := templatesResponses{
 		Templates: newTemplateResponses(cloudhub.DashboardID(id), d.Templates),
 	}
+	setETag(w, d.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -133,7 +134,7 @@ func (s *Service) NewTemplate(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardTemplateCreated.String(), template.Label, dash.Name)
-	s.logRegistration(ctx, "Dashboards Templates", msg)
+	s.logChange(ctx, "Dashboards Templates", msg, nil, template)
 
 	res := newTemplateResponse(dash.ID, template)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
@@ -158,6 +159,7 @@ func (s *Service) TemplateID(w http.ResponseWriter, r *http.Request) {
 	for _, t := range dash.Templates {
 		if t.ID == cloudhub.TemplateID(tid) {
 			res := newTemplateResponse(cloudhub.DashboardID(id), t)
+			setETag(w, dash.Revision)
 			encodeJSON(w, http.StatusOK, res, s.Logger)
 			return
 		}
@@ -205,7 +207,7 @@ func (s *Service) RemoveTemplate(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardTemplateDeleted.String(), template.Label, dash.Name)
-	s.logRegistration(ctx, "Dashboards Templates", msg)
+	s.logChange(ctx, "Dashboards Templates", msg, template, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -224,12 +226,18 @@ func (s *Service) ReplaceTemplate(w http.ResponseWriter, r *http.Request) {
 		notFound(w, id, s.Logger)
 		return
 	}
+	if ctx, err = ifMatch(ctx, r, dash.Revision); err != nil {
+		revisionConflict(w, r, s.Logger)
+		return
+	}
 
 	tid := httprouter.GetParamFromContext(ctx, "tid")
 	pos := -1
+	var before cloudhub.Template
 	for i, t := range dash.Templates {
 		if t.ID == cloudhub.TemplateID(tid) {
 			pos = i
+			before = t
 			break
 		}
 	}
@@ -251,7 +259,10 @@ func (s *Service) ReplaceTemplate(w http.ResponseWriter, r *http.Request) {
 	template.ID = cloudhub.TemplateID(tid)
 
 	dash.Templates[pos] = template
-	if err := s.Store.Dashboards(ctx).Update(ctx, dash); err != nil {
+	if err := s.Store.Dashboards(ctx).Update(ctx, dash); err == cloudhub.ErrRevisionMismatch {
+		revisionConflict(w, r, s.Logger)
+		return
+	} else if err != nil {
 		msg := fmt.Sprintf("Error updating template %s in dashboard %d: %v", tid, id, err)
 		Error(w, http.StatusInternalServerError, msg, s.Logger)
 		return
@@ -259,8 +270,9 @@ func (s *Service) ReplaceTemplate(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgDashboardTemplateModified.String(), template.Label, dash.Name)
-	s.logRegistration(ctx, "Dashboards Templates", msg)
+	s.logChange(ctx, "Dashboards Templates", msg, before, template)
 
 	res := newTemplateResponse(cloudhub.DashboardID(id), template)
+	setETag(w, dash.Revision+1)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
@@ -2,10 +2,10 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"time"
 
@@ -20,7 +20,11 @@ const (
 	sshTtyOpIspeed          = 14400
 	sshTtyOpOspeed          = 14400
 	wsTimeout               = 30 * time.Minute
+	handshakeTimeout        = 30 * time.Second // time the client has to send the handshake
 	sshConnfailCloseMessage = "Connection failed to establish because the connected host did not respond. Please check the connection information again"
+	// Close reasons must fit in 123 bytes
+	sshRecordingCloseMessage = "The session cannot be recorded, so it was not opened"
+	sshHandshakeCloseMessage = "The first message must be the connection handshake"
 	// Time to wait before force close on connection.
 	closeGracePeriod = 1 * time.Second
 )
@@ -31,18 +35,31 @@ const (
 	Resize
 )
 
+// Terminal sizes used when the client sends none, and the largest accepted
+const (
+	defaultTerminalCols = 82
+	defaultTerminalRows = 24
+	maxTerminalSize     = 1000
+)
+
+var errNoHostKeyVerifier = errors.New("ssh connection without host key verification")
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024 * 1024 * 10,
 }
 
 type ssh struct {
-	user    string
-	pwd     string
-	addr    string
-	port    int
-	client  *gossh.Client
-	session *gossh.Session
+	user     string
+	pwd      string
+	signer   gossh.Signer // signer authenticates with a private key before pwd is tried
+	addr     string
+	port     int
+	jump     *ssh // jump is the host connected through, as with ssh -J
+	hostKeys *hostKeyVerifier
+	recorder *terminalRecorder
+	client   *gossh.Client
+	session  *gossh.Session
 }
 
 // WindowResize ssh terminal
@@ -51,6 +68,11 @@ type WindowResize struct {
 	Rows int `json:"rows"`
 }
 
+// valid reports whether the size can be applied to a pseudo terminal
+func (r WindowResize) valid() bool {
+	return r.Cols > 0 && r.Rows > 0 && r.Cols <= maxTerminalSize && r.Rows <= maxTerminalSize
+}
+
 // WebTerminalHandler connects websocket and remote ssh
 func (s *Service) WebTerminalHandler(w http.ResponseWriter, r *http.Request) {
 	ws, err := upgrader.Upgrade(w, r, nil)
@@ -63,47 +85,57 @@ func (s *Service) WebTerminalHandler(w http.ResponseWriter, r *http.Request) {
 	defer ws.Close()
 
 	ws.SetWriteDeadline(time.Now().Add(wsTimeout))
-	ws.SetReadDeadline(time.Now().Add(wsTimeout))
 
-	// Parse to the original query string
-	qs, err := url.QueryUnescape(r.URL.RawQuery)
-	if err != nil {
+	// The connection comes in the first message rather than the query
+	// string, which ends up in proxy logs and the browser history
+	ws.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	var hs terminalHandshake
+	if err := ws.ReadJSON(&hs); err != nil {
 		s.Logger.
-			WithField("component", "terminal > WebTerminalHandler > url.QueryUnescape").
+			WithField("component", "terminal > WebTerminalHandler > ws.ReadJSON").
 			Error(err.Error())
+		closeWebTerminal(ws, websocket.CloseInvalidFramePayloadData, sshHandshakeCloseMessage)
 		return
 	}
+	ws.SetReadDeadline(time.Now().Add(wsTimeout))
 
-	// query string convert to map
-	params, err := url.ParseQuery(qs)
+	size := hs.WindowResize
+	if !size.valid() {
+		size = WindowResize{Cols: defaultTerminalCols, Rows: defaultTerminalRows}
+	}
+
+	ctx := r.Context()
+	p, err := hs.profile(ctx, s.Store.TerminalProfiles(ctx))
 	if err != nil {
 		s.Logger.
-			WithField("component", "terminal > WebTerminalHandler > url.ParseQuery").
+			WithField("component", "terminal > WebTerminalHandler > hs.profile").
 			Error(err.Error())
+		closeWebTerminal(ws, websocket.CloseInvalidFramePayloadData, err.Error())
 		return
 	}
 
-	port, err := strconv.Atoi(params["port"][0])
+	sh, err := s.terminalSSH(ctx, p)
 	if err != nil {
 		s.Logger.
-			WithField("component", "terminal > WebTerminalHandler > strconv.Atoi").
+			WithField("component", "terminal > WebTerminalHandler > s.terminalSSH").
 			Error(err.Error())
+		closeWebTerminal(ws, websocket.CloseInvalidFramePayloadData, err.Error())
 		return
 	}
 
-	sh := &ssh{
-		user: params["user"][0],
-		pwd:  params["pwd"][0],
-		addr: params["addr"][0],
-		port: port,
-	}
-
 	sh, err = sh.Connect()
 	if nil != err {
 		s.Logger.
 			WithField("component", "terminal > WebTerminalHandler > sh.Connect").
 			Error(err.Error())
 
+		// An untrusted host key gets its own close code, so the UI can
+		// point the user to the host key approval
+		if hkErr, ok := err.(*hostKeyError); ok {
+			closeWebTerminal(ws, hkErr.closeCode(), hkErr.closeReason())
+			return
+		}
+
 		msg := websocket.FormatCloseMessage(websocket.CloseInvalidFramePayloadData, err.Error())
 		err = ws.WriteMessage(websocket.CloseMessage, msg)
 		time.Sleep(closeGracePeriod)
@@ -116,7 +148,7 @@ func (s *Service) WebTerminalHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer sh.Close()
 
-	err = sh.Config(82, 24) // 80, 30
+	err = sh.Config(size.Cols, size.Rows)
 	if err != nil {
 		s.Logger.
 			WithField("component", "terminal > WebTerminalHandler > sh.Config").
@@ -124,6 +156,17 @@ func (s *Service) WebTerminalHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Sessions are not opened unless they can be recorded
+	sh.recorder, err = s.startTerminalRecording(ctx, sh, size.Cols, size.Rows)
+	if err != nil {
+		s.Logger.
+			WithField("component", "terminal > WebTerminalHandler > s.startTerminalRecording").
+			Error(err.Error())
+		closeWebTerminal(ws, websocket.CloseInternalServerErr, sshRecordingCloseMessage)
+		return
+	}
+	defer sh.recorder.close()
+
 	sshReader, err := sh.session.StdoutPipe()
 	if err != nil {
 		s.Logger.
@@ -156,6 +199,7 @@ func (s *Service) WebTerminalHandler(w http.ResponseWriter, r *http.Request) {
 	go sh.SessionWait(s, quitChan)
 
 	<-quitChan
+	sh.recorder.close()
 	s.Logger.
 		WithField("component", "terminal > WebTerminalHandler").
 		Info("terminal closed")
@@ -174,28 +218,19 @@ func (sh *ssh) Config(cols, rows int) error {
 	return err
 }
 
-// connect to the ssh.
+// connect to the ssh, through the jump hosts if any. The host key of every
+// hop is checked by its hostKeys verifier.
 func (sh *ssh) Connect() (*ssh, error) {
-	auth := []gossh.AuthMethod{
-		gossh.Password(sh.pwd),
-	}
-
-	config := &gossh.ClientConfig{
-		User:            sh.user,
-		Auth:            auth,
-		Timeout:         30 * time.Second,
-		HostKeyCallback: func(hostname string, remote net.Addr, key gossh.PublicKey) error { return nil },
-	}
-
-	// connect to ths ssh.
-	client, err := gossh.Dial(protocol, sh.addr+":"+strconv.Itoa(sh.port), config)
-	if nil != err {
+	client, err := sh.dial()
+	if err != nil {
 		return nil, err
 	}
 
 	// create session.
 	session, err := client.NewSession()
 	if nil != err {
+		client.Close()
+		sh.closeJump()
 		return nil, err
 	}
 
@@ -204,12 +239,94 @@ func (sh *ssh) Connect() (*ssh, error) {
 	return sh, nil
 }
 
+// dial opens the ssh client of the host. A host behind a jump host is
+// reached through a connection forwarded by the jump host's client.
+func (sh *ssh) dial() (*gossh.Client, error) {
+	if sh.hostKeys == nil {
+		return nil, errNoHostKeyVerifier
+	}
+
+	var auth []gossh.AuthMethod
+	if sh.signer != nil {
+		auth = append(auth, gossh.PublicKeys(sh.signer))
+	}
+	if sh.pwd != "" || sh.signer == nil {
+		auth = append(auth, gossh.Password(sh.pwd))
+	}
+
+	config := &gossh.ClientConfig{
+		User:              sh.user,
+		Auth:              auth,
+		Timeout:           30 * time.Second,
+		HostKeyCallback:   sh.hostKeys.callback,
+		HostKeyAlgorithms: sh.hostKeys.algorithms(),
+	}
+	addr := net.JoinHostPort(sh.addr, strconv.Itoa(sh.port))
+
+	if sh.jump == nil {
+		// connect to ths ssh.
+		client, err := gossh.Dial(protocol, addr, config)
+		if nil != err {
+			return nil, sh.dialError(err)
+		}
+		return client, nil
+	}
+
+	jumpClient, err := sh.jump.dial()
+	if err != nil {
+		return nil, err
+	}
+	sh.jump.client = jumpClient
+
+	conn, err := jumpClient.Dial(protocol, addr)
+	if err != nil {
+		sh.closeJump()
+		return nil, err
+	}
+	c, chans, reqs, err := gossh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		sh.closeJump()
+		return nil, sh.dialError(err)
+	}
+	return gossh.NewClient(c, chans, reqs), nil
+}
+
+// dialError prefers the host key error, since gossh only keeps the text of
+// the callback error
+func (sh *ssh) dialError(err error) error {
+	if sh.hostKeys.err != nil {
+		return sh.hostKeys.err
+	}
+	return err
+}
+
+// closeJump closes the clients of the jump hosts
+func (sh *ssh) closeJump() {
+	for j := sh.jump; j != nil; j = j.jump {
+		if j.client != nil {
+			j.client.Close()
+		}
+	}
+}
+
 // close ssh session
 func (sh *ssh) Close() {
 	if sh.session != nil {
 		sh.session.Close()
 		sh.client.Close()
 	}
+	sh.closeJump()
+}
+
+// closeWebTerminal closes ws with code. The reason is truncated to fit a
+// close frame.
+func closeWebTerminal(ws *websocket.Conn, code int, reason string) {
+	if len(reason) > maxCloseReasonLength {
+		reason = reason[:maxCloseReasonLength]
+	}
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	time.Sleep(closeGracePeriod)
 }
 
 // FromWsClientToSSH Send websocket client message to ssh
@@ -225,9 +342,13 @@ func (sh *ssh) FromWsClientToSSH(ws *websocket.Conn, s *Service, sshWriter io.Wr
 			SetQuit(exitCh)
 			return
 		}
+		if len(wsData) == 0 {
+			continue
+		}
 
 		switch wsData[0] {
 		case Terminal:
+			sh.recorder.input(wsData[1:])
 			_, err = sshWriter.Write(wsData[1:])
 			if err != nil {
 				ws.WriteMessage(websocket.BinaryMessage, []byte(err.Error()))
@@ -245,6 +366,9 @@ func (sh *ssh) FromWsClientToSSH(ws *websocket.Conn, s *Service, sshWriter io.Wr
 					Error(err.Error())
 				continue
 			}
+			if !resize.valid() {
+				continue
+			}
 
 			if err := sh.session.WindowChange(resize.Rows, resize.Cols); err != nil {
 				s.Logger.
@@ -252,6 +376,7 @@ func (sh *ssh) FromWsClientToSSH(ws *websocket.Conn, s *Service, sshWriter io.Wr
 					Error(err.Error())
 				continue
 			}
+			sh.recorder.resize(resize.Cols, resize.Rows)
 		}
 	}
 }
@@ -271,6 +396,7 @@ func (sh *ssh) FromSSHtoWsClient(ws *websocket.Conn, s *Service, sshReader io.Re
 			return
 		}
 
+		sh.recorder.output(buf[:n])
 		err = ws.WriteMessage(websocket.BinaryMessage, buf[:n])
 		if err != nil {
 			s.Logger.
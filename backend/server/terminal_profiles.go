@@ -0,0 +1,430 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultSSHPort is used when neither the profile nor its network device has a port
+	defaultSSHPort = 22
+	// maxTerminalJumps limits the jump hosts a web terminal connects through
+	maxTerminalJumps = 4
+)
+
+var (
+	errTerminalJumpLoop = errors.New("jump profiles form a loop")
+	errTerminalJumps    = fmt.Errorf("a terminal connection can use at most %d jump hosts", maxTerminalJumps)
+)
+
+// terminalHandshake is the first message of a web terminal websocket. It
+// names a saved profile or a network device, whose credentials are kept
+// server-side, or carries the credentials of an ad hoc connection.
+type terminalHandshake struct {
+	Profile       string `json:"profile,omitempty"`
+	NetworkDevice string `json:"networkDevice,omitempty"`
+	Addr          string `json:"addr,omitempty"`
+	Port          int    `json:"port,omitempty"`
+	User          string `json:"user,omitempty"`
+	Password      string `json:"password,omitempty"`
+	PrivateKey    string `json:"privateKey,omitempty"`
+	Passphrase    string `json:"passphrase,omitempty"`
+	JumpProfile   string `json:"jumpProfile,omitempty"`
+	WindowResize         // initial size of the terminal
+}
+
+// profile returns the connection the handshake asks for as a profile
+func (hs *terminalHandshake) profile(ctx context.Context, store cloudhub.TerminalProfilesStore) (*cloudhub.TerminalProfile, error) {
+	if hs.Profile != "" {
+		return store.Get(ctx, hs.Profile)
+	}
+	if hs.NetworkDevice != "" {
+		return &cloudhub.TerminalProfile{
+			NetworkDevice: hs.NetworkDevice,
+			JumpProfile:   hs.JumpProfile,
+		}, nil
+	}
+	if hs.Addr == "" {
+		return nil, fmt.Errorf("handshake requires a profile, a network device or an address")
+	}
+	return &cloudhub.TerminalProfile{
+		Addr:        hs.Addr,
+		Port:        hs.Port,
+		User:        hs.User,
+		Password:    hs.Password,
+		PrivateKey:  hs.PrivateKey,
+		Passphrase:  hs.Passphrase,
+		JumpProfile: hs.JumpProfile,
+	}, nil
+}
+
+// parseSSHSigner parses a PEM encoded private key, decrypting it with
+// passphrase when one is given.
+func parseSSHSigner(key, passphrase string) (gossh.Signer, error) {
+	if passphrase != "" {
+		return gossh.ParsePrivateKeyWithPassphrase([]byte(key), []byte(passphrase))
+	}
+	signer, err := gossh.ParsePrivateKey([]byte(key))
+	if _, ok := err.(*gossh.PassphraseMissingError); ok {
+		return nil, fmt.Errorf("private key is encrypted, a passphrase is required")
+	}
+	return signer, err
+}
+
+// terminalSSH builds the ssh connection of a profile, with its jump hosts.
+// Every hop is checked against the known host keys of the organization.
+func (s *Service) terminalSSH(ctx context.Context, p *cloudhub.TerminalProfile) (*ssh, error) {
+	return s.terminalHop(ctx, *p, map[string]bool{p.ID: true})
+}
+
+func (s *Service) terminalHop(ctx context.Context, p cloudhub.TerminalProfile, seen map[string]bool) (*ssh, error) {
+	if p.NetworkDevice != "" {
+		device, err := s.Store.NetworkDevice(ctx).Get(ctx, cloudhub.NetworkDeviceQuery{ID: &p.NetworkDevice})
+		if err != nil {
+			return nil, err
+		}
+		if p.Addr == "" {
+			p.Addr = device.DeviceIP
+		}
+		if p.User == "" {
+			p.User = device.SSHConfig.UserID
+		}
+		if p.Port == 0 {
+			p.Port = device.SSHConfig.Port
+		}
+		if p.Password == "" && p.PrivateKey == "" {
+			p.Password = device.SSHConfig.Password
+		}
+	}
+	if p.Port == 0 {
+		p.Port = defaultSSHPort
+	}
+
+	sh := &ssh{
+		user: p.User,
+		pwd:  p.Password,
+		addr: p.Addr,
+		port: p.Port,
+	}
+	if p.PrivateKey != "" {
+		signer, err := parseSSHSigner(p.PrivateKey, p.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		sh.signer = signer
+	}
+
+	var err error
+	host := net.JoinHostPort(p.Addr, strconv.Itoa(p.Port))
+	sh.hostKeys, err = newHostKeyVerifier(ctx, s.Store.HostKeys(ctx), host, s.now)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.JumpProfile == "" {
+		return sh, nil
+	}
+	if seen[p.JumpProfile] {
+		return nil, errTerminalJumpLoop
+	}
+	if len(seen) > maxTerminalJumps {
+		return nil, errTerminalJumps
+	}
+	seen[p.JumpProfile] = true
+
+	jump, err := s.Store.TerminalProfiles(ctx).Get(ctx, p.JumpProfile)
+	if err != nil {
+		return nil, err
+	}
+	if sh.jump, err = s.terminalHop(ctx, *jump, seen); err != nil {
+		return nil, err
+	}
+	return sh, nil
+}
+
+type terminalProfileLinks struct {
+	Self string `json:"self"` // Self link mapping to this resource
+}
+
+// terminalProfileResponse is a profile without its credentials, which never
+// leave the server.
+type terminalProfileResponse struct {
+	ID            string               `json:"id"`
+	Organization  string               `json:"organization"`
+	Name          string               `json:"name"`
+	Addr          string               `json:"addr"`
+	Port          int                  `json:"port"`
+	User          string               `json:"user"`
+	NetworkDevice string               `json:"networkDevice,omitempty"`
+	JumpProfile   string               `json:"jumpProfile,omitempty"`
+	HasPassword   bool                 `json:"hasPassword"`
+	HasPrivateKey bool                 `json:"hasPrivateKey"`
+	Links         terminalProfileLinks `json:"links"`
+}
+
+func newTerminalProfileResponse(p *cloudhub.TerminalProfile) *terminalProfileResponse {
+	return &terminalProfileResponse{
+		ID:            p.ID,
+		Organization:  p.Organization,
+		Name:          p.Name,
+		Addr:          p.Addr,
+		Port:          p.Port,
+		User:          p.User,
+		NetworkDevice: p.NetworkDevice,
+		JumpProfile:   p.JumpProfile,
+		HasPassword:   p.Password != "",
+		HasPrivateKey: p.PrivateKey != "",
+		Links: terminalProfileLinks{
+			Self: fmt.Sprintf("/cloudhub/v1/terminal_profiles/%s", p.ID),
+		},
+	}
+}
+
+type terminalProfilesResponse struct {
+	Links    selfLinks                  `json:"links"`
+	Profiles []*terminalProfileResponse `json:"profiles"`
+}
+
+// terminalProfileRequest creates a profile or changes the fields it sets.
+// Credentials are write-only, so an update that leaves them out keeps them.
+type terminalProfileRequest struct {
+	Name          *string `json:"name"`
+	Addr          *string `json:"addr"`
+	Port          *int    `json:"port"`
+	User          *string `json:"user"`
+	Password      *string `json:"password"`
+	PrivateKey    *string `json:"privateKey"`
+	Passphrase    *string `json:"passphrase"`
+	NetworkDevice *string `json:"networkDevice"`
+	JumpProfile   *string `json:"jumpProfile"`
+}
+
+func (r *terminalProfileRequest) apply(p *cloudhub.TerminalProfile) {
+	if r.Name != nil {
+		p.Name = *r.Name
+	}
+	if r.Addr != nil {
+		p.Addr = *r.Addr
+	}
+	if r.Port != nil {
+		p.Port = *r.Port
+	}
+	if r.User != nil {
+		p.User = *r.User
+	}
+	if r.Password != nil {
+		p.Password = *r.Password
+	}
+	if r.PrivateKey != nil {
+		p.PrivateKey = *r.PrivateKey
+	}
+	if r.Passphrase != nil {
+		p.Passphrase = *r.Passphrase
+	}
+	if r.NetworkDevice != nil {
+		p.NetworkDevice = *r.NetworkDevice
+	}
+	if r.JumpProfile != nil {
+		p.JumpProfile = *r.JumpProfile
+	}
+}
+
+// validTerminalProfile checks that a profile can be connected to. Its
+// network device and jump profiles must exist, and the jump profiles must
+// not loop back to the profile.
+func (s *Service) validTerminalProfile(ctx context.Context, p *cloudhub.TerminalProfile) error {
+	if p.Name == "" {
+		return fmt.Errorf("name required on terminal profile request body")
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+
+	if p.NetworkDevice != "" {
+		if _, err := s.Store.NetworkDevice(ctx).Get(ctx, cloudhub.NetworkDeviceQuery{ID: &p.NetworkDevice}); err != nil {
+			return fmt.Errorf("network device %s: %v", p.NetworkDevice, err)
+		}
+	} else {
+		if p.Addr == "" || p.User == "" {
+			return fmt.Errorf("addr and user required on terminal profile request body")
+		}
+		if p.Password == "" && p.PrivateKey == "" {
+			return fmt.Errorf("password or privateKey required on terminal profile request body")
+		}
+	}
+	if p.PrivateKey != "" {
+		if _, err := parseSSHSigner(p.PrivateKey, p.Passphrase); err != nil {
+			return fmt.Errorf("invalid privateKey: %v", err)
+		}
+	}
+
+	seen := map[string]bool{p.ID: true}
+	for id := p.JumpProfile; id != ""; {
+		if seen[id] {
+			return errTerminalJumpLoop
+		}
+		if len(seen) > maxTerminalJumps {
+			return errTerminalJumps
+		}
+		seen[id] = true
+		jump, err := s.Store.TerminalProfiles(ctx).Get(ctx, id)
+		if err != nil {
+			return fmt.Errorf("jump profile %s: %v", id, err)
+		}
+		id = jump.JumpProfile
+	}
+	return nil
+}
+
+// TerminalProfiles lists the terminal profiles of the current organization
+func (s *Service) TerminalProfiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	profiles, err := s.Store.TerminalProfiles(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	res := terminalProfilesResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/terminal_profiles",
+		},
+		Profiles: []*terminalProfileResponse{},
+	}
+	for i := range profiles {
+		res.Profiles = append(res.Profiles, newTerminalProfileResponse(&profiles[i]))
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// TerminalProfileByID returns a terminal profile without its credentials
+func (s *Service) TerminalProfileByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+
+	p, err := s.Store.TerminalProfiles(ctx).Get(ctx, id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newTerminalProfileResponse(p), s.Logger)
+}
+
+// NewTerminalProfile saves a web terminal connection of the current organization
+func (s *Service) NewTerminalProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req terminalProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	p := &cloudhub.TerminalProfile{}
+	req.apply(p)
+	if err := s.validTerminalProfile(ctx, p); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	p, err := s.Store.TerminalProfiles(ctx).Add(ctx, p)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTerminalProfileCreated.String(), p.Name)
+	s.logChange(ctx, "TerminalProfiles", msg, nil, *p)
+
+	res := newTerminalProfileResponse(p)
+	location(w, res.Links.Self)
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// UpdateTerminalProfile changes the fields of a terminal profile set in the request
+func (s *Service) UpdateTerminalProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+
+	var req terminalProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	p, err := s.Store.TerminalProfiles(ctx).Get(ctx, id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+	before := *p
+
+	req.apply(p)
+	if err := s.validTerminalProfile(ctx, p); err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+
+	if err := s.Store.TerminalProfiles(ctx).Update(ctx, p); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTerminalProfileModified.String(), p.Name)
+	s.logChange(ctx, "TerminalProfiles", msg, before, *p)
+
+	encodeJSON(w, http.StatusOK, newTerminalProfileResponse(p), s.Logger)
+}
+
+// RemoveTerminalProfile deletes a terminal profile. Profiles used as a jump
+// host by another profile are kept.
+func (s *Service) RemoveTerminalProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+
+	p, err := s.Store.TerminalProfiles(ctx).Get(ctx, id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	profiles, err := s.Store.TerminalProfiles(ctx).All(ctx)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	for _, other := range profiles {
+		if other.JumpProfile == p.ID {
+			Error(w, http.StatusConflict, fmt.Sprintf("terminal profile %s is the jump host of %s", p.Name, other.Name), s.Logger)
+			return
+		}
+	}
+
+	if err := s.Store.TerminalProfiles(ctx).Delete(ctx, p); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTerminalProfileDeleted.String(), p.Name)
+	s.logChange(ctx, "TerminalProfiles", msg, *p, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// memTerminalProfiles is a TerminalProfilesStore kept in memory
+func memTerminalProfiles(profiles ...cloudhub.TerminalProfile) *mocks.TerminalProfilesStore {
+	ps := map[string]cloudhub.TerminalProfile{}
+	for _, p := range profiles {
+		ps[p.ID] = p
+	}
+	return &mocks.TerminalProfilesStore{
+		AddF: func(ctx context.Context, p *cloudhub.TerminalProfile) (*cloudhub.TerminalProfile, error) {
+			p.ID = strconv.Itoa(len(ps) + 1)
+			p.Organization = "default"
+			ps[p.ID] = *p
+			return p, nil
+		},
+		AllF: func(ctx context.Context) ([]cloudhub.TerminalProfile, error) {
+			var all []cloudhub.TerminalProfile
+			for _, p := range ps {
+				all = append(all, p)
+			}
+			return all, nil
+		},
+		GetF: func(ctx context.Context, id string) (*cloudhub.TerminalProfile, error) {
+			p, ok := ps[id]
+			if !ok {
+				return nil, cloudhub.ErrTerminalProfileNotFound
+			}
+			return &p, nil
+		},
+	}
+}
+
+// approveFakeSSH trusts the current host key of srv
+func approveFakeSSH(t *testing.T, store cloudhub.HostKeysStore, srv *fakeSSHServer) {
+	t.Helper()
+	srv.mu.Lock()
+	key := srv.key.PublicKey()
+	srv.mu.Unlock()
+	_, err := store.Add(context.Background(), &cloudhub.HostKey{
+		Host:        net.JoinHostPort("127.0.0.1", strconv.Itoa(srv.port())),
+		KeyType:     key.Type(),
+		Fingerprint: gossh.FingerprintSHA256(key),
+		Approved:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestService_terminalSSH(t *testing.T) {
+	bastion := newFakeSSHServer(t)
+	target := newFakeSSHServer(t)
+	hostKeys, _ := memHostKeys()
+	approveFakeSSH(t, hostKeys, bastion)
+	approveFakeSSH(t, hostKeys, target)
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := gossh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("flux capacitor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := gossh.NewSignerFromKey(priv)
+	bastion.mu.Lock()
+	bastion.authorized = signer.PublicKey()
+	bastion.mu.Unlock()
+
+	s := &Service{
+		Store: &mocks.Store{
+			HostKeysStore: hostKeys,
+			TerminalProfilesStore: memTerminalProfiles(
+				cloudhub.TerminalProfile{ID: "1", Name: "bastion", Addr: "127.0.0.1", Port: bastion.port(), User: "jump", PrivateKey: string(pem.EncodeToMemory(block)), Passphrase: "flux capacitor"},
+				cloudhub.TerminalProfile{ID: "2", Name: "loop", JumpProfile: "3"},
+				cloudhub.TerminalProfile{ID: "3", Name: "back", JumpProfile: "2"},
+			),
+			NetworkDeviceStore: &mocks.NetworkDeviceStore{
+				GetF: func(ctx context.Context, q cloudhub.NetworkDeviceQuery) (*cloudhub.NetworkDevice, error) {
+					return &cloudhub.NetworkDevice{
+						ID:        *q.ID,
+						DeviceIP:  "127.0.0.1",
+						SSHConfig: cloudhub.SSHConfig{UserID: "admin", Password: "secret", Port: target.port()},
+					}, nil
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+	ctx := context.Background()
+
+	// The credentials of the device are used on the host behind the bastion
+	hs := terminalHandshake{NetworkDevice: "7", JumpProfile: "1"}
+	p, err := hs.profile(ctx, s.Store.TerminalProfiles(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, err := s.terminalSSH(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sh.Connect(); err != nil {
+		t.Fatalf("Connect() through a jump host error = %v", err)
+	}
+	sh.Close()
+	if got := bastion.loggedIn(); len(got) != 1 || got[0] != "publickey:jump" {
+		t.Errorf("bastion logins = %v, want publickey:jump", got)
+	}
+	if got := target.loggedIn(); len(got) != 1 || got[0] != "password:admin" {
+		t.Errorf("target logins = %v, want password:admin", got)
+	}
+
+	if _, err := s.terminalSSH(ctx, &cloudhub.TerminalProfile{ID: "2", JumpProfile: "3"}); err != errTerminalJumpLoop {
+		t.Errorf("terminalSSH() of looping jump profiles error = %v, want %v", err, errTerminalJumpLoop)
+	}
+	if _, err := (&terminalHandshake{}).profile(ctx, s.Store.TerminalProfiles(ctx)); err == nil {
+		t.Errorf("profile() of an empty handshake succeeded")
+	}
+}
+
+func TestService_NewTerminalProfile(t *testing.T) {
+	s := &Service{
+		Store: &mocks.Store{
+			TerminalProfilesStore: memTerminalProfiles(),
+			NetworkDeviceStore: &mocks.NetworkDeviceStore{
+				GetF: func(ctx context.Context, q cloudhub.NetworkDeviceQuery) (*cloudhub.NetworkDevice, error) {
+					return nil, cloudhub.ErrDeviceNotFound
+				},
+			},
+		},
+		Logger: log.New(log.DebugLevel),
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "password", body: `{"name":"db","addr":"10.0.0.1","user":"root","password":"88mph"}`, wantStatus: http.StatusCreated},
+		{name: "no credentials", body: `{"name":"db","addr":"10.0.0.1","user":"root"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "bad key", body: `{"name":"db","addr":"10.0.0.1","user":"root","privateKey":"not a key"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "unknown device", body: `{"name":"switch","networkDevice":"7"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "unknown jump profile", body: `{"name":"db","addr":"10.0.0.1","user":"root","password":"88mph","jumpProfile":"42"}`, wantStatus: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), UserContextKey, &cloudhub.User{Name: "doc"})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "http://any.url/cloudhub/v1/terminal_profiles", strings.NewReader(tt.body)).WithContext(ctx)
+			s.NewTerminalProfile(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("NewTerminalProfile() = %d %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if w.Code == http.StatusCreated {
+				if bytes.Contains(w.Body.Bytes(), []byte("88mph")) || !bytes.Contains(w.Body.Bytes(), []byte(`"hasPassword":true`)) {
+					t.Errorf("NewTerminalProfile() returned %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestService_WebTerminalHandler_Handshake(t *testing.T) {
+	s := &Service{
+		Store:  &mocks.Store{TerminalProfilesStore: memTerminalProfiles()},
+		Logger: log.New(log.DebugLevel),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(s.WebTerminalHandler))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		message    []byte
+		wantReason string
+	}{
+		{name: "terminal input first", message: []byte("\x00ls\r"), wantReason: sshHandshakeCloseMessage},
+		{name: "unknown profile", message: []byte(`{"profile":"42"}`), wantReason: cloudhub.ErrTerminalProfileNotFound.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			if err := ws.WriteMessage(websocket.TextMessage, tt.message); err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = ws.ReadMessage()
+			closeErr, ok := err.(*websocket.CloseError)
+			if !ok || closeErr.Code != websocket.CloseInvalidFramePayloadData || closeErr.Text != tt.wantReason {
+				t.Errorf("WebTerminalHandler() closed with %v, want %d %q", err, websocket.CloseInvalidFramePayloadData, tt.wantReason)
+			}
+		})
+	}
+}
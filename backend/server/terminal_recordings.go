@@ -0,0 +1,547 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bouk/httprouter"
+	"github.com/gorilla/websocket"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/recordings"
+)
+
+const (
+	maxTerminalRecordingRetention = 3650 // days
+	maxReplaySpeed                = 16
+	defaultReplayIdle             = 2 * time.Second
+)
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// terminalRecorder records a web terminal session. A nil recorder records
+// nothing, which is the case when recording is not configured.
+type terminalRecorder struct {
+	ctx     context.Context
+	store   cloudhub.TerminalRecordingsStore
+	logger  cloudhub.Logger
+	now     func() time.Time
+	rec     *cloudhub.TerminalRecording
+	file    io.WriteCloser
+	counter *countingWriter
+	cast    *recordings.Writer
+	once    sync.Once
+}
+
+// startTerminalRecording starts recording the session of sh, whose terminal
+// is cols by rows large
+func (s *Service) startTerminalRecording(ctx context.Context, sh *ssh, cols, rows int) (*terminalRecorder, error) {
+	if s.RecordingStorage == nil {
+		return nil, nil
+	}
+
+	start := s.now()
+	rec := &cloudhub.TerminalRecording{
+		Host:      sh.hostKeys.host,
+		SSHUser:   sh.user,
+		StartedAt: start.UTC(),
+	}
+	if u, ok := hasUserContext(ctx); ok {
+		rec.User = u.Name
+	}
+	store := s.Store.TerminalRecordings(ctx)
+	rec, err := store.Add(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.RecordingStorage.Create(ctx, rec.ID)
+	if err != nil {
+		store.Delete(ctx, rec)
+		return nil, err
+	}
+	counter := &countingWriter{w: file}
+	cast, err := recordings.NewWriter(counter, recordings.Header{
+		Width:  cols,
+		Height: rows,
+		Title:  fmt.Sprintf("%s@%s", sh.user, rec.Host),
+		Env:    map[string]string{"TERM": term},
+	}, start)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &terminalRecorder{
+		ctx:     ctx,
+		store:   store,
+		logger:  s.Logger,
+		now:     s.now,
+		rec:     rec,
+		file:    file,
+		counter: counter,
+		cast:    cast,
+	}, nil
+}
+
+func (t *terminalRecorder) output(data []byte) {
+	if t != nil {
+		t.cast.Output(t.now(), data)
+	}
+}
+
+func (t *terminalRecorder) input(data []byte) {
+	if t != nil {
+		t.cast.Input(t.now(), data)
+	}
+}
+
+func (t *terminalRecorder) resize(cols, rows int) {
+	if t != nil {
+		t.cast.Resize(t.now(), cols, rows)
+	}
+}
+
+// close ends the recording and stores its end and size
+func (t *terminalRecorder) close() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		logs := t.logger.WithField("component", "terminal > recording").WithField("recording", t.rec.ID)
+		if err := t.cast.Close(); err != nil {
+			logs.Error(err.Error())
+		}
+		if err := t.file.Close(); err != nil {
+			logs.Error(err.Error())
+		}
+		t.rec.EndedAt = t.now().UTC()
+		t.rec.Size = t.counter.n
+		if err := t.store.Update(t.ctx, t.rec); err != nil {
+			logs.Error(err.Error())
+		}
+	})
+}
+
+// pruneTerminalRecordings deletes the recordings that are older than the
+// retention of their organization
+func (s *Service) pruneTerminalRecordings(ctx context.Context) error {
+	if s.RecordingStorage == nil {
+		return nil
+	}
+	ctx = serverContext(ctx)
+	all, err := s.Store.TerminalRecordings(ctx).All(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	retention := map[string]time.Duration{}
+	pruned := 0
+	for i := range all {
+		rec := &all[i]
+		keep, ok := retention[rec.Organization]
+		if !ok {
+			config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, rec.Organization)
+			if err != nil {
+				return err
+			}
+			keep = config.TerminalRecordings.Keep()
+			retention[rec.Organization] = keep
+		}
+
+		// Sessions that were never closed, e.g. because the server stopped,
+		// age from their start
+		ended := rec.EndedAt
+		if ended.IsZero() {
+			ended = rec.StartedAt
+		}
+		if now.Sub(ended) < keep {
+			continue
+		}
+
+		if err := s.RecordingStorage.Delete(ctx, rec.ID); err != nil {
+			return err
+		}
+		if err := s.Store.TerminalRecordings(ctx).Delete(ctx, rec); err != nil {
+			return err
+		}
+		pruned++
+	}
+
+	if pruned > 0 {
+		s.Logger.
+			WithField("component", "terminal > recording").
+			Info(fmt.Sprintf("Deleted %d terminal recordings past their retention", pruned))
+	}
+	return nil
+}
+
+// retainTerminalRecordings prunes terminal recordings every interval until
+// ctx is done
+func (s *Service) retainTerminalRecordings(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.pruneTerminalRecordings(ctx); err != nil {
+			s.Logger.
+				WithField("component", "terminal > recording").
+				Error(err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replayTerminalRecording plays the output and resize events of a recording.
+// Pauses are shortened by speed and capped at idle, unless idle is zero;
+// wait returns false when the replay should stop.
+func replayTerminalRecording(d *recordings.Decoder, speed float64, idle time.Duration, wait func(time.Duration) bool, play func(recordings.Event) error) error {
+	last := 0.0
+	for {
+		e, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e.Code != recordings.Output && e.Code != recordings.Resize {
+			continue
+		}
+
+		pause := time.Duration((e.Time - last) / speed * float64(time.Second))
+		last = e.Time
+		if idle > 0 && pause > idle {
+			pause = idle
+		}
+		if pause > 0 && !wait(pause) {
+			return nil
+		}
+		if err := play(e); err != nil {
+			return err
+		}
+	}
+}
+
+type terminalRecordingLinks struct {
+	Self     string `json:"self"`     // Self link mapping to this resource
+	Download string `json:"download"` // Download link to the asciicast of the session
+	Replay   string `json:"replay"`   // Replay link to the websocket that plays the session
+}
+
+type terminalRecordingResponse struct {
+	ID           string                 `json:"id"`
+	Organization string                 `json:"organization"`
+	User         string                 `json:"user"`
+	Host         string                 `json:"host"`
+	SSHUser      string                 `json:"sshUser"`
+	StartedAt    time.Time              `json:"startedAt"`
+	EndedAt      *time.Time             `json:"endedAt,omitempty"`
+	Size         int64                  `json:"size"`
+	Links        terminalRecordingLinks `json:"links"`
+}
+
+func newTerminalRecordingResponse(r *cloudhub.TerminalRecording) *terminalRecordingResponse {
+	selfLink := fmt.Sprintf("/cloudhub/v1/terminal_recordings/%s", r.ID)
+	res := &terminalRecordingResponse{
+		ID:           r.ID,
+		Organization: r.Organization,
+		User:         r.User,
+		Host:         r.Host,
+		SSHUser:      r.SSHUser,
+		StartedAt:    r.StartedAt,
+		Size:         r.Size,
+		Links: terminalRecordingLinks{
+			Self:     selfLink,
+			Download: selfLink + "/download",
+			Replay:   selfLink + "/replay",
+		},
+	}
+	if !r.EndedAt.IsZero() {
+		ended := r.EndedAt
+		res.EndedAt = &ended
+	}
+	return res
+}
+
+type terminalRecordingsResponse struct {
+	Links      selfLinks                    `json:"links"`
+	Recordings []*terminalRecordingResponse `json:"recordings"`
+}
+
+// TerminalRecordings lists the recorded web terminal sessions of the organization, newest first
+func (s *Service) TerminalRecordings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	all, err := s.Store.TerminalRecordings(ctx).All(ctx)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].StartedAt.After(all[j].StartedAt)
+	})
+
+	res := terminalRecordingsResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/terminal_recordings",
+		},
+		Recordings: []*terminalRecordingResponse{},
+	}
+	for i := range all {
+		res.Recordings = append(res.Recordings, newTerminalRecordingResponse(&all[i]))
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// TerminalRecordingByID returns a recorded web terminal session
+func (s *Service) TerminalRecordingByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+
+	rec, err := s.Store.TerminalRecordings(ctx).Get(ctx, id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	encodeJSON(w, http.StatusOK, newTerminalRecordingResponse(rec), s.Logger)
+}
+
+// openTerminalRecording returns the asciicast of the recording named by the
+// id parameter, writing an error if it is not found
+func (s *Service) openTerminalRecording(w http.ResponseWriter, r *http.Request) (*cloudhub.TerminalRecording, io.ReadCloser, bool) {
+	ctx := r.Context()
+	id := httprouter.GetParamFromContext(ctx, "id")
+
+	if s.RecordingStorage == nil {
+		Error(w, http.StatusNotFound, "terminal recording is not enabled", s.Logger)
+		return nil, nil, false
+	}
+	rec, err := s.Store.TerminalRecordings(ctx).Get(ctx, id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return nil, nil, false
+	}
+	cast, err := s.RecordingStorage.Open(ctx, rec.ID)
+	if err == cloudhub.ErrTerminalRecordingNotFound {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return nil, nil, false
+	}
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return nil, nil, false
+	}
+	return rec, cast, true
+}
+
+// DownloadTerminalRecording returns the asciicast v2 file of a recorded web terminal session
+func (s *Service) DownloadTerminalRecording(w http.ResponseWriter, r *http.Request) {
+	rec, cast, ok := s.openTerminalRecording(w, r)
+	if !ok {
+		return
+	}
+	defer cast.Close()
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="cloudhub-terminal-%s.cast"`, rec.ID))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, cast); err != nil {
+		s.Logger.
+			WithField("component", "terminal > DownloadTerminalRecording").
+			Error(err.Error())
+	}
+}
+
+// ReplayTerminalRecording plays a recorded web terminal session over a
+// websocket. Output is sent as binary messages like the web terminal does;
+// the size of the terminal is sent as a WindowResize text message first and
+// whenever it changed. The speed and idle query parameters speed the replay
+// up and cap pauses at idle seconds.
+func (s *Service) ReplayTerminalRecording(w http.ResponseWriter, r *http.Request) {
+	speed, idle := 1.0, defaultReplayIdle
+	if v := r.URL.Query().Get("speed"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > maxReplaySpeed {
+			invalidData(w, fmt.Errorf("speed must be greater than 0 and at most %d", maxReplaySpeed), s.Logger)
+			return
+		}
+		speed = f
+	}
+	if v := r.URL.Query().Get("idle"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			invalidData(w, fmt.Errorf("idle must be a number of seconds"), s.Logger)
+			return
+		}
+		idle = time.Duration(f * float64(time.Second))
+	}
+
+	_, cast, ok := s.openTerminalRecording(w, r)
+	if !ok {
+		return
+	}
+	defer cast.Close()
+
+	d, err := recordings.NewDecoder(cast)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.Logger.
+			WithField("component", "terminal > ReplayTerminalRecording > upgrader.Upgrade").
+			Error(err.Error())
+		return
+	}
+	defer ws.Close()
+
+	// The client only sends a close message; stop when it goes away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	wait := func(d time.Duration) bool {
+		select {
+		case <-done:
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+	sendSize := func(cols, rows int) error {
+		b, err := json.Marshal(WindowResize{Cols: cols, Rows: rows})
+		if err != nil {
+			return err
+		}
+		return ws.WriteMessage(websocket.TextMessage, b)
+	}
+
+	h := d.Header()
+	err = sendSize(h.Width, h.Height)
+	if err == nil {
+		err = replayTerminalRecording(d, speed, idle, wait, func(e recordings.Event) error {
+			if e.Code == recordings.Resize {
+				var cols, rows int
+				if _, err := fmt.Sscanf(e.Data, "%dx%d", &cols, &rows); err != nil {
+					return nil
+				}
+				return sendSize(cols, rows)
+			}
+			return ws.WriteMessage(websocket.BinaryMessage, []byte(e.Data))
+		})
+	}
+	if err != nil {
+		s.Logger.
+			WithField("component", "terminal > ReplayTerminalRecording").
+			Error(err.Error())
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "end of recording")
+	ws.WriteMessage(websocket.CloseMessage, msg)
+	select {
+	case <-done:
+	case <-time.After(closeGracePeriod):
+	}
+}
+
+type terminalRecordingsConfigResponse struct {
+	Links selfLinks `json:"links"`
+	cloudhub.TerminalRecordingsConfig
+}
+
+func newTerminalRecordingsConfigResponse(c cloudhub.TerminalRecordingsConfig) *terminalRecordingsConfigResponse {
+	return &terminalRecordingsConfigResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/org_config/terminal_recordings",
+		},
+		TerminalRecordingsConfig: c,
+	}
+}
+
+// OrganizationTerminalRecordingsConfig retrieves the terminal recordings section of the organization config
+func (s *Service) OrganizationTerminalRecordingsConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := newTerminalRecordingsConfigResponse(config.TerminalRecordings)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ReplaceOrganizationTerminalRecordingsConfig replaces the terminal recordings section of the organization config
+func (s *Service) ReplaceOrganizationTerminalRecordingsConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	var recordingsConfig cloudhub.TerminalRecordingsConfig
+	if err := json.NewDecoder(r.Body).Decode(&recordingsConfig); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+	if recordingsConfig.Retention < 1 || recordingsConfig.Retention > maxTerminalRecordingRetention {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("retention must be between 1 and %d days", maxTerminalRecordingRetention), s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	before := config.TerminalRecordings
+	config.TerminalRecordings = recordingsConfig
+	if err := s.Store.OrganizationConfig(ctx).Put(ctx, config); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTerminalRecordingsPolicy.String(), orgID)
+	s.logChange(ctx, "Organizations", msg, before, config.TerminalRecordings)
+
+	res := newTerminalRecordingsConfigResponse(config.TerminalRecordings)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
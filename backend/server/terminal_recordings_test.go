@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/recordings"
+)
+
+// memTerminalRecordings is a TerminalRecordingsStore kept in memory
+func memTerminalRecordings() (*mocks.TerminalRecordingsStore, map[string]*cloudhub.TerminalRecording) {
+	recs := map[string]*cloudhub.TerminalRecording{}
+	next := 0
+	return &mocks.TerminalRecordingsStore{
+		AddF: func(ctx context.Context, r *cloudhub.TerminalRecording) (*cloudhub.TerminalRecording, error) {
+			next++
+			r.ID = strconv.Itoa(next)
+			if r.Organization == "" {
+				r.Organization = "default"
+			}
+			recs[r.ID] = r
+			return r, nil
+		},
+		AllF: func(ctx context.Context) ([]cloudhub.TerminalRecording, error) {
+			var all []cloudhub.TerminalRecording
+			for _, r := range recs {
+				all = append(all, *r)
+			}
+			return all, nil
+		},
+		GetF: func(ctx context.Context, id string) (*cloudhub.TerminalRecording, error) {
+			r, ok := recs[id]
+			if !ok {
+				return nil, cloudhub.ErrTerminalRecordingNotFound
+			}
+			found := *r
+			return &found, nil
+		},
+		UpdateF: func(ctx context.Context, r *cloudhub.TerminalRecording) error {
+			recs[r.ID] = r
+			return nil
+		},
+		DeleteF: func(ctx context.Context, r *cloudhub.TerminalRecording) error {
+			delete(recs, r.ID)
+			return nil
+		},
+	}, recs
+}
+
+func newRecordingTestService(t *testing.T, clock *fakeClock) (*Service, map[string]*cloudhub.TerminalRecording, string) {
+	t.Helper()
+	store, recs := memTerminalRecordings()
+	dir := t.TempDir()
+	return &Service{
+		Store: &mocks.Store{
+			TerminalRecordingsStore: store,
+			OrganizationConfigStore: &mocks.OrganizationConfigStore{
+				FindOrCreateF: func(ctx context.Context, id string) (*cloudhub.OrganizationConfig, error) {
+					config := &cloudhub.OrganizationConfig{OrganizationID: id}
+					if id == "1" {
+						config.TerminalRecordings.Retention = 1
+					}
+					return config, nil
+				},
+			},
+		},
+		Logger:           log.New(log.DebugLevel),
+		RecordingStorage: &recordings.Dir{Path: dir},
+		Now:              clock.Now,
+	}, recs, dir
+}
+
+func TestService_startTerminalRecording(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)}
+	s, recs, dir := newRecordingTestService(t, clock)
+	ctx := context.WithValue(context.Background(), UserContextKey, &cloudhub.User{Name: "alice"})
+	sh := &ssh{user: "root", addr: "10.0.0.1", port: 22, hostKeys: &hostKeyVerifier{host: "10.0.0.1:22"}}
+
+	rec, err := s.startTerminalRecording(ctx, sh, 82, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(time.Second)
+	rec.output([]byte("$ "))
+	clock.now = clock.now.Add(time.Second)
+	rec.input([]byte("exit\r"))
+	rec.resize(100, 30)
+	clock.now = clock.now.Add(time.Second)
+	rec.close()
+	rec.output([]byte("after close"))
+	rec.close()
+
+	got := recs["1"]
+	if got.User != "alice" || got.Host != "10.0.0.1:22" || got.SSHUser != "root" || got.EndedAt.Sub(got.StartedAt) != 3*time.Second {
+		t.Errorf("startTerminalRecording() stored %+v", got)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "1.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(b)) != got.Size {
+		t.Errorf("recording size = %d, file has %d bytes", got.Size, len(b))
+	}
+	want := `{"version":2,"width":82,"height":24,"timestamp":1445444940,"title":"root@10.0.0.1:22","env":{"TERM":"xterm-256color"}}
+[1,"o","$ "]
+[2,"i","exit\r"]
+[2,"r","100x30"]
+`
+	if string(b) != want {
+		t.Errorf("recording =\n%s\nwant\n%s", b, want)
+	}
+
+	// Sessions are not recorded without storage
+	s.RecordingStorage = nil
+	if rec, err := s.startTerminalRecording(ctx, sh, 82, 24); rec != nil || err != nil {
+		t.Errorf("startTerminalRecording() without storage = %v, %v", rec, err)
+	}
+}
+
+func TestReplayTerminalRecording(t *testing.T) {
+	cast := `{"version":2,"width":82,"height":24}
+[0.5,"o","$ "]
+[1,"i","ls\r"]
+[1.5,"o","ls\r\n"]
+[61.5,"r","100x30"]
+[62,"o","bye"]
+`
+	d, err := recordings.NewDecoder(strings.NewReader(cast))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pauses []time.Duration
+	var played []string
+	wait := func(d time.Duration) bool {
+		pauses = append(pauses, d)
+		return true
+	}
+	err = replayTerminalRecording(d, 2, 5*time.Second, wait, func(e recordings.Event) error {
+		played = append(played, e.Code+":"+e.Data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPauses := []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, 5 * time.Second, 250 * time.Millisecond}
+	if len(pauses) != len(wantPauses) {
+		t.Fatalf("pauses = %v, want %v", pauses, wantPauses)
+	}
+	for i := range pauses {
+		if pauses[i] != wantPauses[i] {
+			t.Errorf("pauses = %v, want %v", pauses, wantPauses)
+			break
+		}
+	}
+	if strings.Join(played, "|") != "o:$ |o:ls\r\n|r:100x30|o:bye" {
+		t.Errorf("played %q", played)
+	}
+}
+
+func TestService_pruneTerminalRecordings(t *testing.T) {
+	now := time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+	s, recs, dir := newRecordingTestService(t, &fakeClock{now: now})
+	ctx := context.Background()
+
+	for _, r := range []cloudhub.TerminalRecording{
+		{Organization: "default", StartedAt: now.Add(-48 * time.Hour), EndedAt: now.Add(-47 * time.Hour)},
+		{Organization: "1", StartedAt: now.Add(-48 * time.Hour), EndedAt: now.Add(-47 * time.Hour)},
+		{Organization: "1", StartedAt: now.Add(-time.Hour), EndedAt: now.Add(-time.Minute)},
+		{Organization: "1", StartedAt: now.Add(-25 * time.Hour)},
+	} {
+		r := r
+		rec, _ := s.Store.TerminalRecordings(ctx).Add(ctx, &r)
+		w, err := s.RecordingStorage.Create(ctx, rec.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+
+	if err := s.pruneTerminalRecordings(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs["1"] == nil || recs["3"] == nil {
+		t.Errorf("pruneTerminalRecordings() kept %v", recs)
+	}
+	for id, want := range map[string]bool{"1": true, "2": false, "3": true, "4": false} {
+		if _, err := os.Stat(filepath.Join(dir, id+".cast")); (err == nil) != want {
+			t.Errorf("recording %s exists = %v, want %v", id, err == nil, want)
+		}
+	}
+}
+
+func TestService_DownloadTerminalRecording(t *testing.T) {
+	s, _, _ := newRecordingTestService(t, &fakeClock{now: time.Unix(1445444940, 0)})
+	ctx := context.Background()
+	rec, _ := s.Store.TerminalRecordings(ctx).Add(ctx, &cloudhub.TerminalRecording{})
+	w, _ := s.RecordingStorage.Create(ctx, rec.ID)
+	io.WriteString(w, "{\"version\":2}\n")
+	w.Close()
+
+	tests := []struct {
+		id         string
+		wantStatus int
+	}{
+		{id: rec.ID, wantStatus: http.StatusOK},
+		{id: "42", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		ctx := httprouter.WithParams(context.Background(), httprouter.Params{{Key: "id", Value: tt.id}})
+		w := httptest.NewRecorder()
+		s.DownloadTerminalRecording(w, httptest.NewRequest("GET", "http://any.url/cloudhub/v1/terminal_recordings/"+tt.id+"/download", nil).WithContext(ctx))
+		if w.Code != tt.wantStatus {
+			t.Errorf("DownloadTerminalRecording(%s) = %d, want %d", tt.id, w.Code, tt.wantStatus)
+		}
+		if tt.wantStatus == http.StatusOK {
+			if w.Body.String() != "{\"version\":2}\n" || w.Header().Get("Content-Type") != "application/x-asciicast" {
+				t.Errorf("DownloadTerminalRecording() = %q, %v", w.Body.String(), w.Header())
+			}
+		}
+	}
+}
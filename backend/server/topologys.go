@@ -82,6 +82,7 @@ func (s *Service) Topology(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := newTopologyResponse(topology, true)
+	setETag(w, topology.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -140,7 +141,7 @@ func (s *Service) NewTopology(w http.ResponseWriter, r *http.Request) {
 	// log registration
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &res.Organization})
 	msg := fmt.Sprintf(MsgTopologyCreated.String(), org.Name)
-	s.logRegistration(ctx, "Topologies", msg)
+	s.logChange(ctx, "Topologies", msg, nil, *res)
 
 	tp := newTopologyResponse(res, false)
 	location(w, tp.Links.Self)
@@ -170,7 +171,7 @@ func (s *Service) RemoveTopology(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &topology.Organization})
 	msg := fmt.Sprintf(MsgTopologyDeleted.String(), org.Name)
-	s.logRegistration(ctx, "Topologies", msg)
+	s.logChange(ctx, "Topologies", msg, *topology, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -201,6 +202,10 @@ func (s *Service) UpdateTopology(w http.ResponseWriter, r *http.Request) {
 		notFound(w, id, s.Logger)
 		return
 	}
+	if ctx, err = ifMatch(ctx, r, topology.Revision); err != nil {
+		revisionConflict(w, r, s.Logger)
+		return
+	}
 
 	var requestData RequestBody
 
@@ -210,6 +215,7 @@ func (s *Service) UpdateTopology(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := *topology
 	topology.Diagram = requestData.Cells
 	topology.Preferences = requestData.Preferences
 	topology.TopologyOptions = cloudhub.TopologyOptions{
@@ -219,7 +225,10 @@ func (s *Service) UpdateTopology(w http.ResponseWriter, r *http.Request) {
 		LinkVisible:       requestData.TopologyOptions.LinkVisible,
 	}
 
-	if err := s.Store.Topologies(ctx).Update(ctx, topology); err != nil {
+	if err := s.Store.Topologies(ctx).Update(ctx, topology); err == cloudhub.ErrRevisionMismatch {
+		revisionConflict(w, r, s.Logger)
+		return
+	} else if err != nil {
 		msg := fmt.Sprintf("Error updating topology ID %s: %v", id, err)
 		Error(w, http.StatusInternalServerError, msg, s.Logger)
 		return
@@ -228,9 +237,10 @@ func (s *Service) UpdateTopology(w http.ResponseWriter, r *http.Request) {
 	// log registration
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &topology.Organization})
 	msg := fmt.Sprintf(MsgTopologyModified.String(), org.Name)
-	s.logRegistration(ctx, "Topologies", msg)
+	s.logChange(ctx, "Topologies", msg, before, *topology)
 
 	res := newTopologyResponse(topology, false)
+	setETag(w, topology.Revision)
 	encodeJSON(w, http.StatusOK, res, s.Logger)
 }
 
@@ -0,0 +1,563 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+	"github.com/snetsystems/cloudhub/backend/totp"
+)
+
+const (
+	// totpIssuer is the account issuer shown by authenticator apps
+	totpIssuer = "CloudHub"
+	// totpLoginLifespan is how long a password login waits for its TOTP code
+	totpLoginLifespan = 5 * time.Minute
+	// recoveryCodeCount is the number of recovery codes issued on enrolment
+	recoveryCodeCount = 10
+
+	// TwoFactorVerify asks the client for a code of the user's authenticator
+	TwoFactorVerify = "verify"
+	// TwoFactorEnroll asks the client to enrol an authenticator first,
+	// because the organization policy requires one
+	TwoFactorEnroll = "enroll"
+)
+
+type totpLoginRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type totpEnrollResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// NewTOTPTokenizer returns the tokenizer of the token that carries a
+// password login over to its TOTP step. Its key is derived from the token
+// secret so that the token cannot be used as a session cookie.
+func NewTOTPTokenizer(tokenSecret string) oauth2.Tokenizer {
+	mac := hmac.New(sha256.New, []byte(tokenSecret))
+	mac.Write([]byte("cloudhub totp login"))
+	return oauth2.NewJWT(hex.EncodeToString(mac.Sum(nil)), "")
+}
+
+func (s *Service) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// twoFactorRequired reports whether an organization the user administers
+// requires two-factor authentication. Super admins follow the policy of the
+// default organization.
+func (s *Service) twoFactorRequired(ctx context.Context, u *cloudhub.User) (bool, error) {
+	orgIDs := []string{}
+	for _, role := range u.Roles {
+		if role.Name == roles.AdminRoleName {
+			orgIDs = append(orgIDs, role.Organization)
+		}
+	}
+	if u.SuperAdmin {
+		defaultOrg, err := s.Store.Organizations(ctx).DefaultOrganization(ctx)
+		if err != nil {
+			return false, err
+		}
+		orgIDs = append(orgIDs, defaultOrg.ID)
+	}
+
+	for _, id := range orgIDs {
+		config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		if config.TwoFactor.RequiredForAdmins {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// twoFactorStep returns the step that has to follow the password of the
+// user, or an empty string if the password is enough.
+func (s *Service) twoFactorStep(ctx context.Context, u *cloudhub.User) (string, error) {
+	if u.TOTPEnabled {
+		return TwoFactorVerify, nil
+	}
+	required, err := s.twoFactorRequired(ctx, u)
+	if err != nil || !required {
+		return "", err
+	}
+	return TwoFactorEnroll, nil
+}
+
+// requireTOTP answers a valid password with the token for the TOTP step
+// instead of a session cookie.
+func (s *Service) requireTOTP(ctx context.Context, w http.ResponseWriter, u *cloudhub.User, step string) {
+	now := s.now()
+	token, err := s.TOTPTokens.Create(ctx, oauth2.Principal{
+		Subject:   u.Name,
+		Issuer:    BasicProvider,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(totpLoginLifespan),
+	})
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registration
+	msg := fmt.Sprintf(MsgTOTPRequired.String())
+	s.logRegistration(ctx, "Login", msg, u.Name)
+
+	res := &loginResponse{
+		PasswordResetFlag: u.PasswordResetFlag,
+		TwoFactor:         step,
+		TwoFactorToken:    string(token),
+	}
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// totpLoginUser returns the basic user whose password was accepted for the
+// token of the TOTP step.
+func (s *Service) totpLoginUser(ctx context.Context, token string) (*cloudhub.User, error) {
+	p, err := s.TOTPTokens.ValidPrincipal(ctx, oauth2.Token(token), totpLoginLifespan)
+	if err != nil {
+		return nil, err
+	}
+	if p.Issuer != BasicProvider {
+		return nil, fmt.Errorf("token was not issued for a basic login")
+	}
+	return s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{
+		Name:     &p.Subject,
+		Provider: &BasicProvider,
+		Scheme:   &BasicScheme,
+	})
+}
+
+// LoginTOTP is the second step of a basic login that requires two-factor
+// authentication. It accepts a code of the user's authenticator or one of
+// their recovery codes. The first code of a user that enrolled during login
+// also confirms the enrolment.
+func (s *Service) LoginTOTP(auth oauth2.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := serverContext(r.Context())
+
+		var req totpLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidJSON(w, s.Logger)
+			return
+		}
+		if req.Token == "" || req.Code == "" {
+			invalidData(w, fmt.Errorf("token and code required on TOTP login request body"), s.Logger)
+			return
+		}
+
+		user, err := s.totpLoginUser(ctx, req.Token)
+		if err != nil {
+			Error(w, http.StatusUnauthorized, "Invalid or expired login token.", s.Logger)
+			return
+		}
+		if user.Locked {
+			msg := fmt.Sprintf(MsgRetryLoginLocked.String(), user.Name)
+			s.logRegistration(ctx, "Retry", msg, user.Name)
+			ErrorBasic(w, http.StatusLocked, msg, user.RetryCount, user.LockedTime, user.Locked, s.Logger)
+			return
+		}
+		if user.TOTPSecret == "" {
+			invalidData(w, fmt.Errorf("two-factor authentication is not enrolled"), s.Logger)
+			return
+		}
+
+		logMsg := MsgTOTPLogin
+		counter, ok := totp.Validate(user.TOTPSecret, req.Code, s.now(), user.TOTPLastCounter)
+		if ok {
+			user.TOTPLastCounter = counter
+			user.TOTPEnabled = true
+		} else if user.TOTPEnabled && useRecoveryCode(user, req.Code) {
+			ok = true
+			logMsg = MsgRecoveryCodeLogin
+		}
+		if !ok {
+			msg := fmt.Sprintf(MsgTOTPInvalid.String())
+			s.logRegistration(ctx, "Login", msg, user.Name)
+			s.loginFailed(ctx, w, user, "TOTP code does not match.")
+			return
+		}
+
+		user.RetryCount = 0
+		user.Locked = false
+		user.LockedTime = ""
+		if err := s.Store.Users(ctx).Update(ctx, user); err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+
+		principal := basicPrincipal(user)
+		if err := auth.Authorize(ctx, w, principal); err != nil {
+			Error(w, http.StatusInternalServerError, fmt.Sprintf("Failed auth.Authorize: %v, %v", err, principal), s.Logger)
+			return
+		}
+		s.Logger.Info("User ", user.Name, " is authenticated with TOTP")
+
+		// log registration
+		msg := fmt.Sprintf(logMsg.String())
+		s.logRegistration(ctx, "Login", msg, user.Name)
+
+		res := &loginResponse{
+			PasswordResetFlag: user.PasswordResetFlag,
+		}
+		encodeJSON(w, http.StatusOK, res, s.Logger)
+	}
+}
+
+// LoginTOTPEnroll enrols an authenticator for a user whose organization
+// requires two-factor authentication, between the password and TOTP steps
+// of their login.
+func (s *Service) LoginTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	ctx := serverContext(r.Context())
+
+	var req totpLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	user, err := s.totpLoginUser(ctx, req.Token)
+	if err != nil {
+		Error(w, http.StatusUnauthorized, "Invalid or expired login token.", s.Logger)
+		return
+	}
+	if user.TOTPEnabled {
+		invalidData(w, fmt.Errorf("two-factor authentication is already enabled"), s.Logger)
+		return
+	}
+
+	s.enrollTOTP(ctx, w, user)
+}
+
+// enrollTOTP gives the user a new secret and recovery codes. The secret is
+// pending until the user confirms it with a code.
+func (s *Service) enrollTOTP(ctx context.Context, w http.ResponseWriter, u *cloudhub.User) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	u.TOTPSecret = secret
+	u.TOTPEnabled = false
+	u.TOTPLastCounter = 0
+	u.RecoveryCodes = hashes
+	if err := s.Store.Users(ctx).Update(ctx, u); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	res := &totpEnrollResponse{
+		Secret:        secret,
+		URI:           totp.URI(totpIssuer, u.Name, secret),
+		RecoveryCodes: codes,
+	}
+	encodeJSON(w, http.StatusCreated, res, s.Logger)
+}
+
+// meBasicUser returns the basic user of the session. Users of other
+// providers authenticate with them and have no TOTP of their own.
+func (s *Service) meBasicUser(ctx context.Context) (*cloudhub.User, error) {
+	p, err := getValidPrincipal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.Issuer != BasicProvider {
+		return nil, fmt.Errorf("two-factor authentication is only available to basic users")
+	}
+
+	serverCtx := serverContext(ctx)
+	return s.Store.Users(serverCtx).Get(serverCtx, cloudhub.UserQuery{
+		Name:     &p.Subject,
+		Provider: &BasicProvider,
+		Scheme:   &BasicScheme,
+	})
+}
+
+// EnrollMeTOTP starts the enrolment of an authenticator for the current user
+func (s *Service) EnrollMeTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := s.meBasicUser(ctx)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if user.TOTPEnabled {
+		invalidData(w, fmt.Errorf("two-factor authentication is already enabled"), s.Logger)
+		return
+	}
+
+	s.enrollTOTP(serverContext(ctx), w, user)
+}
+
+// VerifyMeTOTP confirms the pending enrolment of the current user with a
+// code of their authenticator, which enables two-factor authentication.
+func (s *Service) VerifyMeTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	user, err := s.meBasicUser(ctx)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		invalidData(w, fmt.Errorf("no pending two-factor enrolment"), s.Logger)
+		return
+	}
+
+	counter, ok := totp.Validate(user.TOTPSecret, req.Code, s.now(), user.TOTPLastCounter)
+	if !ok {
+		invalidData(w, fmt.Errorf("invalid TOTP code"), s.Logger)
+		return
+	}
+
+	before := *user
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+	serverCtx := serverContext(ctx)
+	if err := s.Store.Users(serverCtx).Update(serverCtx, user); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTOTPEnabled.String(), user.Name)
+	s.logChange(ctx, "Users", msg, before, *user)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableMeTOTP turns off two-factor authentication of the current user,
+// unless an organization they administer requires it.
+func (s *Service) DisableMeTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	serverCtx := serverContext(ctx)
+
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	user, err := s.meBasicUser(ctx)
+	if err != nil {
+		invalidData(w, err, s.Logger)
+		return
+	}
+	if !user.TOTPEnabled {
+		invalidData(w, fmt.Errorf("two-factor authentication is not enabled"), s.Logger)
+		return
+	}
+
+	required, err := s.twoFactorRequired(serverCtx, user)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	if required {
+		Error(w, http.StatusForbidden, "two-factor authentication is required by the organization", s.Logger)
+		return
+	}
+
+	if _, ok := totp.Validate(user.TOTPSecret, req.Code, s.now(), user.TOTPLastCounter); !ok && !useRecoveryCode(user, req.Code) {
+		invalidData(w, fmt.Errorf("invalid TOTP code"), s.Logger)
+		return
+	}
+
+	before := *user
+	clearTOTP(user)
+	if err := s.Store.Users(serverCtx).Update(serverCtx, user); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTOTPDisabled.String(), user.Name)
+	s.logChange(ctx, "Users", msg, before, *user)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetUserTOTP removes the authenticator and recovery codes of a user who
+// lost them. If their organization requires two-factor authentication, they
+// enrol a new authenticator on their next login.
+func (s *Service) ResetUserTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := httprouter.GetParamFromContext(ctx, "id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		Error(w, http.StatusBadRequest, fmt.Sprintf("invalid user id: %s", err.Error()), s.Logger)
+		return
+	}
+
+	u, err := s.Store.Users(ctx).Get(ctx, cloudhub.UserQuery{ID: &id})
+	if err != nil {
+		Error(w, http.StatusNotFound, err.Error(), s.Logger)
+		return
+	}
+
+	before := *u
+	clearTOTP(u)
+	if err := s.Store.Users(ctx).Update(ctx, u); err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTOTPReset.String(), u.Name)
+	s.logChange(ctx, "Users", msg, before, *u)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type twoFactorConfigResponse struct {
+	Links selfLinks `json:"links"`
+	cloudhub.TwoFactorConfig
+}
+
+func newTwoFactorConfigResponse(c cloudhub.TwoFactorConfig) *twoFactorConfigResponse {
+	return &twoFactorConfigResponse{
+		Links: selfLinks{
+			Self: "/cloudhub/v1/org_config/two_factor",
+		},
+		TwoFactorConfig: c,
+	}
+}
+
+// OrganizationTwoFactorConfig retrieves the two-factor authentication section of the organization config
+func (s *Service) OrganizationTwoFactorConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+
+	res := newTwoFactorConfigResponse(config.TwoFactor)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+// ReplaceOrganizationTwoFactorConfig replaces the two-factor authentication section of the organization config
+func (s *Service) ReplaceOrganizationTwoFactorConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orgID, ok := hasOrganizationContext(ctx)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Organization not found on context", s.Logger)
+		return
+	}
+
+	var twoFactorConfig cloudhub.TwoFactorConfig
+	if err := json.NewDecoder(r.Body).Decode(&twoFactorConfig); err != nil {
+		invalidJSON(w, s.Logger)
+		return
+	}
+
+	config, err := s.Store.OrganizationConfig(ctx).FindOrCreate(ctx, orgID)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error(), s.Logger)
+		return
+	}
+	before := config.TwoFactor
+	config.TwoFactor = twoFactorConfig
+	if err := s.Store.OrganizationConfig(ctx).Put(ctx, config); err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+
+	// log registrationte
+	msg := fmt.Sprintf(MsgTOTPPolicy.String(), orgID)
+	s.logChange(ctx, "Organizations", msg, before, config.TwoFactor)
+
+	res := newTwoFactorConfigResponse(config.TwoFactor)
+	encodeJSON(w, http.StatusOK, res, s.Logger)
+}
+
+func clearTOTP(u *cloudhub.User) {
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastCounter = 0
+	u.RecoveryCodes = nil
+}
+
+// newRecoveryCodes returns n random recovery codes and their hashes
+func newRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case and dashes. The
+// codes are random, so a fast hash is enough.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// useRecoveryCode removes the recovery code from the user if it is one of
+// theirs. The caller saves the user.
+func useRecoveryCode(u *cloudhub.User, code string) bool {
+	hash := hashRecoveryCode(code)
+	for i, h := range u.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			u.RecoveryCodes = append(u.RecoveryCodes[:i:i], u.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bouk/httprouter"
+	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/log"
+	"github.com/snetsystems/cloudhub/backend/mocks"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
+	"github.com/snetsystems/cloudhub/backend/roles"
+	"github.com/snetsystems/cloudhub/backend/totp"
+)
+
+const totpTestSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// fakeClock is the clock of the TOTP tests
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) code(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Counter(c.now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// newTOTPTestService returns a service with a single basic user and the
+// two-factor policy of the default organization.
+func newTOTPTestService(user *cloudhub.User, required bool, clock *fakeClock) *Service {
+	return &Service{
+		Store: &mocks.Store{
+			UsersStore: &mocks.UsersStore{
+				GetF: func(ctx context.Context, q cloudhub.UserQuery) (*cloudhub.User, error) {
+					if (q.ID != nil && *q.ID == user.ID) || (q.Name != nil && *q.Name == user.Name) {
+						return user, nil
+					}
+					return nil, cloudhub.ErrUserNotFound
+				},
+				UpdateF: func(ctx context.Context, u *cloudhub.User) error {
+					*user = *u
+					return nil
+				},
+			},
+			OrganizationsStore: &mocks.OrganizationsStore{
+				DefaultOrganizationF: func(ctx context.Context) (*cloudhub.Organization, error) {
+					return &cloudhub.Organization{ID: "default"}, nil
+				},
+			},
+			OrganizationConfigStore: &mocks.OrganizationConfigStore{
+				FindOrCreateF: func(ctx context.Context, id string) (*cloudhub.OrganizationConfig, error) {
+					return &cloudhub.OrganizationConfig{
+						OrganizationID: id,
+						TwoFactor:      cloudhub.TwoFactorConfig{RequiredForAdmins: required},
+					}, nil
+				},
+			},
+		},
+		Logger:      log.New(log.DebugLevel),
+		RetryPolicy: map[string]string{"count": "3"},
+		TOTPTokens:  &oauth2.JWT{Secret: "totp-secret", Now: clock.Now},
+		Now:         clock.Now,
+	}
+}
+
+func newTOTPTestUser(admin bool) *cloudhub.User {
+	role := roles.ViewerRoleName
+	if admin {
+		role = roles.AdminRoleName
+	}
+	return &cloudhub.User{
+		ID:                1,
+		Name:              "marty",
+		Passwd:            getPasswordToSHA512("hoverboard", SecretKey),
+		Provider:          BasicProvider,
+		Scheme:            BasicScheme,
+		PasswordResetFlag: "N",
+		Roles: []cloudhub.Role{
+			{Name: role, Organization: "default"},
+		},
+	}
+}
+
+func passwordLogin(t *testing.T, s *Service, auth oauth2.Authenticator) (int, loginResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "http://any.url/basic/login", bytes.NewBufferString(`{"name":"marty","password":"hoverboard"}`))
+	s.Login(auth, "")(w, r)
+
+	var res loginResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, res
+}
+
+func totpLogin(s *Service, auth oauth2.Authenticator, token, code string) int {
+	w := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"token":%q,"code":%q}`, token, code)
+	r := httptest.NewRequest("POST", "http://any.url/basic/login/totp", bytes.NewBufferString(body))
+	s.LoginTOTP(auth)(w, r)
+	return w.Code
+}
+
+func TestService_Login_TwoFactorStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		admin    bool
+		enabled  bool
+		required bool
+		wantStep string
+	}{
+		{name: "TOTP enabled", enabled: true, wantStep: TwoFactorVerify},
+		{name: "Admin required to enrol", admin: true, required: true, wantStep: TwoFactorEnroll},
+		{name: "Admin without policy", admin: true},
+		{name: "Viewer not affected by policy", required: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Unix(1700000000, 0)}
+			user := newTOTPTestUser(tt.admin)
+			if tt.enabled {
+				user.TOTPSecret = totpTestSecret
+				user.TOTPEnabled = true
+			}
+			s := newTOTPTestService(user, tt.required, clock)
+			auth := &recordingAuthenticator{}
+
+			code, res := passwordLogin(t, s, auth)
+			if code != http.StatusOK {
+				t.Fatalf("Login() status = %d", code)
+			}
+			if res.TwoFactor != tt.wantStep {
+				t.Errorf("Login() twoFactor = %q, want %q", res.TwoFactor, tt.wantStep)
+			}
+			if tt.wantStep == "" && auth.authorized == nil {
+				t.Errorf("Login() did not authorize")
+			}
+			if tt.wantStep != "" && (auth.authorized != nil || res.TwoFactorToken == "") {
+				t.Errorf("Login() authorized %+v with token %q before the TOTP step", auth.authorized, res.TwoFactorToken)
+			}
+		})
+	}
+}
+
+func TestService_LoginTOTP(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	user := newTOTPTestUser(false)
+	user.TOTPSecret = totpTestSecret
+	user.TOTPEnabled = true
+	user.RecoveryCodes = []string{hashRecoveryCode("abcde-12345")}
+	s := newTOTPTestService(user, false, clock)
+
+	_, res := passwordLogin(t, s, &recordingAuthenticator{})
+	token := res.TwoFactorToken
+
+	// A session token cannot stand in for the login token
+	session, err := oauth2.NewJWT("session-secret", "").Create(context.Background(), oauth2.Principal{
+		Subject:   "marty",
+		Issuer:    BasicProvider,
+		IssuedAt:  clock.now,
+		ExpiresAt: clock.now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := totpLogin(s, &recordingAuthenticator{}, string(session), clock.code(t, totpTestSecret)); got != http.StatusUnauthorized {
+		t.Errorf("LoginTOTP() with a session token = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	auth := &recordingAuthenticator{}
+	code := clock.code(t, totpTestSecret)
+	if got := totpLogin(s, auth, token, code); got != http.StatusOK {
+		t.Fatalf("LoginTOTP() = %d, want %d", got, http.StatusOK)
+	}
+	if auth.authorized == nil || auth.authorized.Subject != "marty" || auth.authorized.Issuer != BasicProvider {
+		t.Errorf("LoginTOTP() authorized %+v", auth.authorized)
+	}
+
+	// The same code cannot be used twice and counts as a failed login
+	auth = &recordingAuthenticator{}
+	if got := totpLogin(s, auth, token, code); got != http.StatusUnauthorized {
+		t.Errorf("LoginTOTP() with a reused code = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if auth.authorized != nil || user.RetryCount != 1 {
+		t.Errorf("LoginTOTP() with a reused code authorized %+v, retry count %d", auth.authorized, user.RetryCount)
+	}
+
+	// Recovery codes work once
+	if got := totpLogin(s, &recordingAuthenticator{}, token, "ABCDE12345"); got != http.StatusOK {
+		t.Errorf("LoginTOTP() with a recovery code = %d, want %d", got, http.StatusOK)
+	}
+	if len(user.RecoveryCodes) != 0 || user.RetryCount != 0 {
+		t.Errorf("LoginTOTP() left recovery codes %v, retry count %d", user.RecoveryCodes, user.RetryCount)
+	}
+	if got := totpLogin(s, &recordingAuthenticator{}, token, "abcde-12345"); got != http.StatusUnauthorized {
+		t.Errorf("LoginTOTP() with a used recovery code = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	clock.now = clock.now.Add(totpLoginLifespan + time.Minute)
+	if got := totpLogin(s, &recordingAuthenticator{}, token, clock.code(t, totpTestSecret)); got != http.StatusUnauthorized {
+		t.Errorf("LoginTOTP() with an expired token = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestService_LoginTOTP_Locks(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	user := newTOTPTestUser(false)
+	user.TOTPSecret = totpTestSecret
+	user.TOTPEnabled = true
+	s := newTOTPTestService(user, false, clock)
+
+	_, res := passwordLogin(t, s, &recordingAuthenticator{})
+	for i := 0; i < 3; i++ {
+		totpLogin(s, &recordingAuthenticator{}, res.TwoFactorToken, "000000")
+	}
+	if !user.Locked {
+		t.Fatalf("LoginTOTP() did not lock the user after %d wrong codes", user.RetryCount)
+	}
+	if got := totpLogin(s, &recordingAuthenticator{}, res.TwoFactorToken, clock.code(t, totpTestSecret)); got != http.StatusLocked {
+		t.Errorf("LoginTOTP() of a locked user = %d, want %d", got, http.StatusLocked)
+	}
+}
+
+func TestService_LoginTOTPEnroll(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	user := newTOTPTestUser(true)
+	s := newTOTPTestService(user, true, clock)
+
+	_, res := passwordLogin(t, s, &recordingAuthenticator{})
+	if res.TwoFactor != TwoFactorEnroll {
+		t.Fatalf("Login() twoFactor = %q, want %q", res.TwoFactor, TwoFactorEnroll)
+	}
+
+	w := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"token":%q}`, res.TwoFactorToken)
+	s.LoginTOTPEnroll(w, httptest.NewRequest("POST", "http://any.url/basic/login/totp/enroll", bytes.NewBufferString(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("LoginTOTPEnroll() = %d: %s", w.Code, w.Body.String())
+	}
+	var enrolled totpEnrollResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &enrolled); err != nil {
+		t.Fatal(err)
+	}
+	if enrolled.URI != totp.URI(totpIssuer, "marty", enrolled.Secret) || len(enrolled.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("LoginTOTPEnroll() = %+v", enrolled)
+	}
+	if user.TOTPEnabled || user.TOTPSecret != enrolled.Secret || user.RecoveryCodes[0] != hashRecoveryCode(enrolled.RecoveryCodes[0]) {
+		t.Errorf("LoginTOTPEnroll() stored %+v", user)
+	}
+
+	// Recovery codes are not accepted before the enrolment is confirmed
+	if got := totpLogin(s, &recordingAuthenticator{}, res.TwoFactorToken, enrolled.RecoveryCodes[0]); got != http.StatusUnauthorized {
+		t.Errorf("LoginTOTP() with a recovery code of a pending enrolment = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := totpLogin(s, &recordingAuthenticator{}, res.TwoFactorToken, clock.code(t, enrolled.Secret)); got != http.StatusOK {
+		t.Fatalf("LoginTOTP() = %d, want %d", got, http.StatusOK)
+	}
+	if !user.TOTPEnabled {
+		t.Errorf("LoginTOTP() did not confirm the enrolment")
+	}
+}
+
+func TestService_DisableMeTOTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		required    bool
+		code        func(c *fakeClock, t *testing.T) string
+		wantStatus  int
+		wantEnabled bool
+	}{
+		{
+			name:       "Disabled with a code",
+			code:       func(c *fakeClock, t *testing.T) string { return c.code(t, totpTestSecret) },
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:        "Wrong code",
+			code:        func(c *fakeClock, t *testing.T) string { return "000000" },
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantEnabled: true,
+		},
+		{
+			name:        "Required by the organization",
+			required:    true,
+			code:        func(c *fakeClock, t *testing.T) string { return c.code(t, totpTestSecret) },
+			wantStatus:  http.StatusForbidden,
+			wantEnabled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Unix(1700000000, 0)}
+			user := newTOTPTestUser(true)
+			user.TOTPSecret = totpTestSecret
+			user.TOTPEnabled = true
+			s := newTOTPTestService(user, tt.required, clock)
+
+			w := httptest.NewRecorder()
+			body := fmt.Sprintf(`{"code":%q}`, tt.code(clock, t))
+			r := httptest.NewRequest("DELETE", "http://any.url/cloudhub/v1/me/totp", bytes.NewBufferString(body))
+			r = r.WithContext(context.WithValue(r.Context(), oauth2.PrincipalKey, oauth2.Principal{
+				Subject: "marty",
+				Issuer:  BasicProvider,
+			}))
+			s.DisableMeTOTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("DisableMeTOTP() = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if user.TOTPEnabled != tt.wantEnabled {
+				t.Errorf("DisableMeTOTP() left TOTP enabled = %v, want %v", user.TOTPEnabled, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestService_ResetUserTOTP(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	user := newTOTPTestUser(true)
+	user.TOTPSecret = totpTestSecret
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = 42
+	user.RecoveryCodes = []string{hashRecoveryCode("abcde-12345")}
+	s := newTOTPTestService(user, true, clock)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("DELETE", "http://any.url/cloudhub/v1/users/1/totp", nil)
+	r = r.WithContext(httprouter.WithParams(r.Context(), httprouter.Params{{Key: "id", Value: "1"}}))
+	s.ResetUserTOTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("ResetUserTOTP() = %d: %s", w.Code, w.Body.String())
+	}
+	if user.TOTPEnabled || user.TOTPSecret != "" || user.TOTPLastCounter != 0 || user.RecoveryCodes != nil {
+		t.Errorf("ResetUserTOTP() left %+v", user)
+	}
+
+	// The policy still applies, so the next login enrols a new authenticator
+	if _, res := passwordLogin(t, s, &recordingAuthenticator{}); res.TwoFactor != TwoFactorEnroll {
+		t.Errorf("Login() after reset twoFactor = %q, want %q", res.TwoFactor, TwoFactorEnroll)
+	}
+}
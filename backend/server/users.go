@@ -14,7 +14,9 @@ import (
 
 	"github.com/bouk/httprouter"
 	cloudhub "github.com/snetsystems/cloudhub/backend"
+	"github.com/snetsystems/cloudhub/backend/oauth2"
 	"github.com/snetsystems/cloudhub/backend/organizations"
+	"github.com/snetsystems/cloudhub/backend/passwd"
 	"github.com/snetsystems/cloudhub/backend/roles"
 )
 
@@ -55,12 +57,15 @@ func (r *userRequest) ValidCreate() error {
 		return fmt.Errorf("scheme required on CloudHub basic User request body")
 	}
 
-	if r.Scheme != "basic" {
+	if r.Scheme != "basic" && r.Scheme != LDAPScheme {
 		r.Scheme = "oauth2"
 	}
 	if r.Scheme == "basic" && r.Provider != "cloudhub" {
 		return fmt.Errorf("When scheme is basic, provider should be cloudhub")
 	}
+	if r.Scheme == LDAPScheme && r.Provider != oauth2.LDAPProviderName {
+		return fmt.Errorf("When scheme is ldap, provider should be ldap")
+	}
 	return r.ValidRoles()
 }
 
@@ -133,6 +138,7 @@ type userResponse struct {
 	RetryCount         int32   `json:"retryCount"`
 	LockedTime         string  `json:"lockedTime"`
 	Locked             bool    `json:"locked"`
+	TOTPEnabled        bool    `json:"totpEnabled,omitempty"`
 }
 
 func newUserResponse(u *cloudhub.User, org string, password string) *userResponse {
@@ -163,6 +169,7 @@ func newUserResponse(u *cloudhub.User, org string, password string) *userRespons
 		RetryCount:         u.RetryCount,
 		LockedTime:         u.LockedTime,
 		Locked:             u.Locked,
+		TOTPEnabled:        u.TOTPEnabled,
 	}
 
 	if password != "" {
@@ -265,9 +272,13 @@ func (s *Service) NewUser(w http.ResponseWriter, r *http.Request) {
 	var resetPassword string
 	if req.Provider == "cloudhub" && (hasAuthorizedRole(user, roles.AdminRoleName) || hasSuperAdminContext(ctx)) {
 		resetPassword = randResetPassword()
-		hashPassword := getPasswordToSHA512(resetPassword, SecretKey)
+		hash, err := hashPassword(resetPassword)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
 
-		user.Passwd = hashPassword
+		user.Passwd = hash
 		user.PasswordResetFlag = "Y"
 		user.PasswordUpdateDate = getNowDate()
 	}
@@ -285,7 +296,7 @@ func (s *Service) NewUser(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgUserCreated.String(), user.Name)
-	s.logRegistration(ctx, "Users", msg)
+	s.logChange(ctx, "Users", msg, nil, *res)
 
 	cu := newUserResponse(res, "", resetPassword)
 	location(w, cu.Links.Self)
@@ -333,9 +344,13 @@ func (s *Service) OrganizationNewUser(w http.ResponseWriter, r *http.Request) {
 	var resetPassword string
 	if req.Provider == "cloudhub" && (hasAuthorizedRole(user, roles.AdminRoleName) || hasSuperAdminContext(ctx)) {
 		resetPassword = randResetPassword()
-		hashPassword := getPasswordToSHA512(resetPassword, SecretKey)
+		hash, err := hashPassword(resetPassword)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
 
-		user.Passwd = hashPassword
+		user.Passwd = hash
 		user.PasswordResetFlag = "Y"
 		user.PasswordUpdateDate = getNowDate()
 	}
@@ -356,7 +371,7 @@ func (s *Service) OrganizationNewUser(w http.ResponseWriter, r *http.Request) {
 	// log registrationte
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &orgID})
 	msg := fmt.Sprintf(MsgOrganizationUserCreated.String(), user.Name, org.Name)
-	s.logRegistration(ctx, "Organizations Users", msg)
+	s.logChange(ctx, "Organizations Users", msg, nil, *res)
 	
 	cu := newUserResponse(res, orgID, resetPassword)
 	location(w, cu.Links.Self)
@@ -406,13 +421,16 @@ func (s *Service) NewBasicUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	secretKey := "cloudhub"
-	hashPassword := ""
+	hash := ""
 	pwdResetFlag := ""
 	pwdUpdateDate := ""
 
 	if req.Password != "" {
-		hashPassword = getPasswordToSHA512(req.Password, secretKey)
+		hash, err = hashPassword(req.Password)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
 		pwdResetFlag = "N"
 		pwdUpdateDate = getNowDate()
 	}
@@ -422,7 +440,7 @@ func (s *Service) NewBasicUser(w http.ResponseWriter, r *http.Request) {
 		Provider: req.Provider,
 		Scheme:   req.Scheme,
 		Roles:    roles,
-		Passwd:   hashPassword,
+		Passwd:   hash,
 		PasswordResetFlag: pwdResetFlag,
 		PasswordUpdateDate: pwdUpdateDate,
 		Email:    req.Email,
@@ -480,7 +498,12 @@ func (s *Service) UserPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user.Passwd = getPasswordToSHA512(req.Password, SecretKey)
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		unknownErrorWithMessage(w, err, s.Logger)
+		return
+	}
+	user.Passwd = hash
 	user.PasswordUpdateDate = getNowDate()
 	user.PasswordResetFlag = "N"
 	user.RetryCount = 0
@@ -520,7 +543,7 @@ func (s *Service) RemoveUser(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgUserDeleted.String(), u.Name)
-	s.logRegistration(ctx, "Users", msg)
+	s.logChange(ctx, "Users", msg, *u, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -550,7 +573,7 @@ func (s *Service) OrganizationRemoveUser(w http.ResponseWriter, r *http.Request)
 	// log registrationte	
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &orgID})
 	msg := fmt.Sprintf(MsgOrganizationUserDeleted.String(), user.Name, org.Name)
-	s.logRegistration(ctx, "Organizations Users", msg)	
+	s.logChange(ctx, "Organizations Users", msg, *user, nil)	
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -581,6 +604,7 @@ func (s *Service) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		Error(w, http.StatusNotFound, err.Error(), s.Logger)
 		return
 	}
+	before := *u
 
 	roles, err := s.validRoles(ctx, req.Roles, u.Roles)
 	if err != nil {
@@ -615,7 +639,12 @@ func (s *Service) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	// provider = cloudhub
 	u.Email = req.Email
 	if req.Password != "" {
-		u.Passwd = getPasswordToSHA512(req.Password, SecretKey)
+		hash, err := hashPassword(req.Password)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		u.Passwd = hash
 		u.PasswordUpdateDate = getNowDate()
 		u.PasswordResetFlag = "N"
 	}
@@ -648,7 +677,7 @@ func (s *Service) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgUserModified.String(), u.Name)
-	s.logRegistration(ctx, "Users", msg)
+	s.logChange(ctx, "Users", msg, before, *u)
 
 	cu := newUserResponse(u, "", "")
 	location(w, cu.Links.Self)
@@ -683,6 +712,7 @@ func (s *Service) OrganizationUpdateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	before := *u
 	serverCtx := serverContext(ctx)
 	roles, err := s.validRoles(serverCtx, req.Roles, u.Roles)
 	if err != nil {
@@ -717,7 +747,12 @@ func (s *Service) OrganizationUpdateUser(w http.ResponseWriter, r *http.Request)
 	// provider = cloudhub
 	u.Email = req.Email
 	if req.Password != "" {
-		u.Passwd = getPasswordToSHA512(req.Password, SecretKey)
+		hash, err := hashPassword(req.Password)
+		if err != nil {
+			unknownErrorWithMessage(w, err, s.Logger)
+			return
+		}
+		u.Passwd = hash
 		u.PasswordUpdateDate = getNowDate()
 		u.PasswordResetFlag = "N"
 	}
@@ -753,7 +788,7 @@ func (s *Service) OrganizationUpdateUser(w http.ResponseWriter, r *http.Request)
 	// log registrationte	
 	org, _ := s.Store.Organizations(ctx).Get(ctx, cloudhub.OrganizationQuery{ID: &orgID})
 	msg := fmt.Sprintf(MsgOrganizationUserModified.String(), u.Name, org.Name)
-	s.logRegistration(ctx, "Organizations Users", msg)
+	s.logChange(ctx, "Organizations Users", msg, before, *u)
 
 	cu := newUserResponse(u, orgID, "")
 	location(w, cu.Links.Self)
@@ -799,6 +834,7 @@ func (s *Service) LockedUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := *user
 	var msg string
 	if req.Locked {
 		user.RetryCount = 0
@@ -818,7 +854,7 @@ func (s *Service) LockedUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// log registrationte
-	s.logRegistration(ctx, "Users", msg)
+	s.logChange(ctx, "Users", msg, before, *user)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -881,6 +917,13 @@ func getNowDate() string {
 	return sDate
 }
 
+// hashPassword returns the hash stored for the password of a basic user: the
+// argon2id hash of its HMAC-SHA512 digest, which is what isEncoded logins
+// send instead of the password.
+func hashPassword(password string) (string, error) {
+	return passwd.Hash(getPasswordToSHA512(password, SecretKey))
+}
+
 func getPasswordToSHA512(reqPassword, secret string) string {
 	key := []byte(secret)
 	mac := hmac.New(sha512.New, key)
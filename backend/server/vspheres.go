@@ -191,7 +191,7 @@ func (s *Service) NewVsphere(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgvSpheresCreated.String(), vs.Host)
-	s.logRegistration(ctx, "vSpheres", msg)
+	s.logChange(ctx, "vSpheres", msg, nil, res)
 
 	resVs := newVsphereResponse(res)
 	location(w, resVs.Links.Self)
@@ -220,7 +220,7 @@ func (s *Service) RemoveVsphere(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgvSpheresDeleted.String(), vs.Host)
-	s.logRegistration(ctx, "vSpheres", msg)
+	s.logChange(ctx, "vSpheres", msg, vs, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -251,6 +251,7 @@ func (s *Service) UpdateVsphere(w http.ResponseWriter, r *http.Request) {
 		notFound(w, id, s.Logger)
 		return
 	}
+	before := orig
 
 	if req.Host != "" {
 		orig.Host = req.Host
@@ -315,7 +316,7 @@ func (s *Service) UpdateVsphere(w http.ResponseWriter, r *http.Request) {
 
 	// log registrationte
 	msg := fmt.Sprintf(MsgvSpheresModified.String(), orig.Host)
-	s.logRegistration(ctx, "vSpheres", msg)
+	s.logChange(ctx, "vSpheres", msg, before, orig)
 
 	res := newVsphereResponse(orig)
 	location(w, res.Links.Self)
@@ -0,0 +1,93 @@
+package totp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snetsystems/cloudhub/backend/totp"
+)
+
+// The SHA1 secret of the test vectors in RFC 6238, appendix B
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		got, err := totp.Code(rfcSecret, totp.Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := totp.Code("not base32!", 1); err == nil {
+		t.Errorf("Code() with an invalid secret should fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := totp.Counter(now)
+	code := func(c int64) string {
+		s, _ := totp.Code(rfcSecret, c)
+		return s
+	}
+
+	tests := []struct {
+		name        string
+		code        string
+		last        int64
+		wantCounter int64
+		wantOK      bool
+	}{
+		{name: "Current step", code: code(counter), wantCounter: counter, wantOK: true},
+		{name: "Previous step", code: code(counter - 1), wantCounter: counter - 1, wantOK: true},
+		{name: "Next step", code: code(counter + 1), wantCounter: counter + 1, wantOK: true},
+		{name: "Too old", code: code(counter - 2)},
+		{name: "Already used", code: code(counter), last: counter},
+		{name: "Wrong code", code: "000000"},
+		{name: "Wrong length", code: "12345"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := totp.Validate(rfcSecret, tt.code, now, tt.last)
+			if ok != tt.wantOK || got != tt.wantCounter {
+				t.Errorf("Validate() = %d, %v, want %d, %v", got, ok, tt.wantCounter, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 || strings.Contains(secret, "=") {
+		t.Errorf("NewSecret() = %q, want 32 unpadded base32 characters", secret)
+	}
+	if _, err := totp.Code(secret, 1); err != nil {
+		t.Errorf("NewSecret() is not a valid secret: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := totp.URI("CloudHub", "marty mcfly", rfcSecret)
+	want := "otpauth://totp/CloudHub:marty%20mcfly?algorithm=SHA1&digits=6&issuer=CloudHub&period=30&secret=" + rfcSecret
+	if got != want {
+		t.Errorf("URI() = %s, want %s", got, want)
+	}
+}
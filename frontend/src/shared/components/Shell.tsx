@@ -124,16 +124,12 @@ const Shell = (props: Props) => {
   const handleOpenTerminal = (newTabshell: ShellInfo): void => {
     const protocol = window.location.protocol === 'https:' ? 'wss://' : 'ws://'
 
-    const urlParam =
-      'user=' + user + '&pwd=' + pwd + '&addr=' + addr + '&port=' + port
-
     const socketURL =
       protocol +
       window.location.hostname +
       ':' +
       window.location.port +
-      '/cloudhub/v1/WebTerminalHandler?' +
-      encodeURIComponent(urlParam)
+      '/cloudhub/v1/WebTerminalHandler'
 
     let _socket = new WebSocket(socketURL)
     _socket.binaryType = 'arraybuffer'
@@ -280,6 +276,16 @@ const Shell = (props: Props) => {
   useEffect(() => {
     if (socket) {
       socket.onopen = function () {
+        // credentials are sent in the first message, never in the URL
+        socket.send(
+          JSON.stringify({
+            addr,
+            port: Number(port),
+            user,
+            password: pwd,
+          })
+        )
+
         if (term) {
           term.dispose()
         }